@@ -0,0 +1,38 @@
+package ec2ext
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ElasticGpuSpecification is an Elastic GPU attached to instances launched by RunInstances.
+type ElasticGpuSpecification struct {
+	// Type is the type of the Elastic GPU, such as eg1.medium.
+	Type string
+}
+
+// ElasticInferenceAccelerator is an Elastic Inference accelerator attached to instances launched by RunInstances.
+type ElasticInferenceAccelerator struct {
+	// Type is the type of the accelerator, such as eia2.medium.
+	Type string
+
+	// Count is the number of accelerators of the type, defaulting to 1.
+	Count int64 `json:",omitempty"`
+}
+
+// AcceleratorParams encodes the Elastic GPUs and Elastic Inference accelerators attached to instances launched by
+// RunInstances.
+func AcceleratorParams(gpus []ElasticGpuSpecification, accelerators []ElasticInferenceAccelerator) url.Values {
+	params := url.Values{}
+	for i, gpu := range gpus {
+		params.Set(fmt.Sprintf("ElasticGpuSpecification.%d.Type", i+1), gpu.Type)
+	}
+	for i, accelerator := range accelerators {
+		prefix := fmt.Sprintf("ElasticInferenceAccelerator.%d", i+1)
+		params.Set(prefix+".Type", accelerator.Type)
+		if accelerator.Count > 0 {
+			params.Set(prefix+".Count", fmt.Sprint(accelerator.Count))
+		}
+	}
+	return params
+}
@@ -0,0 +1,31 @@
+package ec2ext
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// CPUCreditsStandard limits burstable instances to the CPU credits they earn.
+	CPUCreditsStandard = "standard"
+
+	// CPUCreditsUnlimited allows burstable instances to burst beyond their earned credits, at an additional charge.
+	CPUCreditsUnlimited = "unlimited"
+)
+
+// CreditSpecificationParams encodes the credit option of the CPU usage of burstable instances launched by
+// RunInstances.
+func CreditSpecificationParams(cpuCredits string) url.Values {
+	if cpuCredits == "" {
+		return url.Values{}
+	}
+	return url.Values{"CreditSpecification.CpuCredits": {cpuCredits}}
+}
+
+// burstableFamilies are the instance families with burstable CPU performance.
+var burstableFamilies = map[string]bool{"t2": true, "t3": true, "t3a": true, "t4g": true}
+
+// Burstable determines whether an instance type has burstable CPU performance, and so accepts a credit specification.
+func Burstable(instanceType string) bool {
+	return burstableFamilies[strings.SplitN(instanceType, ".", 2)[0]]
+}
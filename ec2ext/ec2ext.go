@@ -0,0 +1,67 @@
+// Package ec2ext provides EC2 API actions and parameters that are newer than the vendored aws-sdk-go.
+package ec2ext
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"io/ioutil"
+	"net/url"
+)
+
+// APIVersion is the EC2 API version used for actions that are not modeled by the vendored SDK.
+const APIVersion = "2016-11-15"
+
+// WithParams returns a build handler that adds parameters to an EC2 query request.  Existing parameters of the same
+// name are replaced.
+func WithParams(params url.Values) func(*request.Request) {
+	return func(r *request.Request) {
+		if r.Error != nil || len(params) == 0 {
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.GetBody())
+		if err != nil {
+			r.Error = awserr.New("SerializationError", "failed to read EC2 Query request", err)
+			return
+		}
+
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			r.Error = awserr.New("SerializationError", "failed to parse EC2 Query request", err)
+			return
+		}
+
+		for key, value := range params {
+			values[key] = value
+		}
+		r.SetBufferBody([]byte(values.Encode()))
+	}
+}
+
+// EC2 invokes EC2 API actions that are not modeled by the vendored SDK.
+type EC2 struct {
+	client *client.Client
+}
+
+// New creates a client that shares the configuration and handlers of an SDK client.
+func New(c *ec2.EC2) *EC2 {
+	return &EC2{client: c.Client}
+}
+
+func (c *EC2) send(action string, input, output interface{}) error {
+	return Send(c.client.NewRequest(&request.Operation{Name: action, HTTPMethod: "POST", HTTPPath: "/"}, input, output), nil)
+}
+
+// Send sends a request built by the SDK, adding parameters that are not modeled by the vendored SDK.  The request
+// is made with APIVersion, since the parameters are typically newer than the SDK.
+func Send(req *request.Request, params url.Values) error {
+	versioned := url.Values{"Version": {APIVersion}}
+	for key, value := range params {
+		versioned[key] = value
+	}
+
+	req.Handlers.Build.PushBack(WithParams(versioned))
+	return req.Send()
+}
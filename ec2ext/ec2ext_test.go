@@ -0,0 +1,376 @@
+package ec2ext
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestWithParams(t *testing.T) {
+	client := ec2.New(session.New(aws.NewConfig().WithRegion("us-west-2")))
+
+	req, _ := client.StopInstancesRequest(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String("test-id")}})
+	req.Handlers.Build.PushBack(WithParams(url.Values{"Hibernate": {"true"}}))
+	require.NoError(t, req.Build())
+
+	body, err := ioutil.ReadAll(req.GetBody())
+	require.NoError(t, err)
+
+	values, err := url.ParseQuery(string(body))
+	require.NoError(t, err)
+	require.Equal(t, "StopInstances", values.Get("Action"))
+	require.Equal(t, "test-id", values.Get("InstanceId.1"))
+	require.Equal(t, "true", values.Get("Hibernate"))
+}
+
+func TestDescribeInstanceTypeOfferings(t *testing.T) {
+	var requestValues url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		requestValues = r.PostForm
+		w.Write([]byte(`<DescribeInstanceTypeOfferingsResponse>
+  <instanceTypeOfferingSet>
+    <item>
+      <instanceType>t3.micro</instanceType>
+      <locationType>availability-zone</locationType>
+      <location>us-west-2a</location>
+    </item>
+  </instanceTypeOfferingSet>
+</DescribeInstanceTypeOfferingsResponse>`))
+	}))
+	defer server.Close()
+
+	client := New(ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))))
+
+	output, err := client.DescribeInstanceTypeOfferings(&DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String("availability-zone"),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("location"), Values: []*string{aws.String("us-west-2a")}},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "DescribeInstanceTypeOfferings", requestValues.Get("Action"))
+	require.Equal(t, APIVersion, requestValues.Get("Version"))
+	require.Equal(t, "availability-zone", requestValues.Get("LocationType"))
+	require.Equal(t, "location", requestValues.Get("Filter.1.Name"))
+	require.Equal(t, "us-west-2a", requestValues.Get("Filter.1.Value.1"))
+
+	require.Len(t, output.InstanceTypeOfferings, 1)
+	require.Equal(t, "t3.micro", *output.InstanceTypeOfferings[0].InstanceType)
+	require.Equal(t, "us-west-2a", *output.InstanceTypeOfferings[0].Location)
+}
+
+func TestGetInstanceTypesFromInstanceRequirements(t *testing.T) {
+	var requestValues url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		requestValues = r.PostForm
+		w.Write([]byte(`<GetInstanceTypesFromInstanceRequirementsResponse>
+  <instanceTypeSet>
+    <item><instanceType>m5.large</instanceType></item>
+    <item><instanceType>m6i.large</instanceType></item>
+  </instanceTypeSet>
+</GetInstanceTypesFromInstanceRequirementsResponse>`))
+	}))
+	defer server.Close()
+
+	client := New(ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))))
+
+	output, err := client.GetInstanceTypesFromInstanceRequirements(&GetInstanceTypesFromInstanceRequirementsInput{
+		ArchitectureTypes:   []*string{aws.String("x86_64")},
+		VirtualizationTypes: []*string{aws.String("hvm")},
+		InstanceRequirements: &InstanceRequirements{
+			VCpuCount: &IntegerRange{Min: aws.Int64(2), Max: aws.Int64(4)},
+			MemoryMiB: &IntegerRange{Min: aws.Int64(8192)},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "GetInstanceTypesFromInstanceRequirements", requestValues.Get("Action"))
+	require.Equal(t, "x86_64", requestValues.Get("ArchitectureType.1"))
+	require.Equal(t, "hvm", requestValues.Get("VirtualizationType.1"))
+	require.Equal(t, "2", requestValues.Get("InstanceRequirements.VCpuCount.Min"))
+	require.Equal(t, "4", requestValues.Get("InstanceRequirements.VCpuCount.Max"))
+	require.Equal(t, "8192", requestValues.Get("InstanceRequirements.MemoryMiB.Min"))
+	require.Empty(t, requestValues.Get("InstanceRequirements.MemoryMiB.Max"))
+
+	require.Len(t, output.InstanceTypes, 2)
+	require.Equal(t, "m6i.large", *output.InstanceTypes[1].InstanceType)
+}
+
+func TestTagSpecificationParams(t *testing.T) {
+	params := TagSpecificationParams(
+		TagSpecification{
+			ResourceType: ResourceTypeVolume,
+			Tags: []*ec2.Tag{
+				{Key: aws.String("cluster"), Value: aws.String("test")},
+				{Key: aws.String("group"), Value: aws.String("workers")},
+			},
+		},
+		TagSpecification{
+			ResourceType: ResourceTypeNetworkInterface,
+			Tags:         []*ec2.Tag{{Key: aws.String("cluster"), Value: aws.String("test")}},
+		})
+
+	require.Equal(t, url.Values{
+		"TagSpecification.1.ResourceType": {"volume"},
+		"TagSpecification.1.Tag.1.Key":    {"cluster"},
+		"TagSpecification.1.Tag.1.Value":  {"test"},
+		"TagSpecification.1.Tag.2.Key":    {"group"},
+		"TagSpecification.1.Tag.2.Value":  {"workers"},
+		"TagSpecification.2.ResourceType": {"network-interface"},
+		"TagSpecification.2.Tag.1.Key":    {"cluster"},
+		"TagSpecification.2.Tag.1.Value":  {"test"},
+	}, params)
+}
+
+func TestIpv6AddressCountParams(t *testing.T) {
+	require.Empty(t, Ipv6AddressCountParams(&ec2.RunInstancesInput{}, 0))
+	require.Equal(t,
+		url.Values{"Ipv6AddressCount": {"1"}},
+		Ipv6AddressCountParams(&ec2.RunInstancesInput{SubnetId: aws.String("subnet-1")}, 1))
+	require.Equal(t,
+		url.Values{"NetworkInterface.2.Ipv6AddressCount": {"2"}},
+		Ipv6AddressCountParams(&ec2.RunInstancesInput{NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
+			{DeviceIndex: aws.Int64(1)},
+			{DeviceIndex: aws.Int64(0)},
+		}}, 2))
+	require.Empty(t,
+		Ipv6AddressCountParams(&ec2.RunInstancesInput{NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
+			{DeviceIndex: aws.Int64(0), NetworkInterfaceId: aws.String("eni-1")},
+		}}, 1))
+}
+
+func TestIpv4PrefixCountParams(t *testing.T) {
+	require.Empty(t, Ipv4PrefixCountParams(&ec2.RunInstancesInput{}, 2))
+	require.Empty(t, Ipv4PrefixCountParams(&ec2.RunInstancesInput{
+		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{{NetworkInterfaceId: aws.String("eni-1")}},
+	}, 2))
+	require.Equal(t,
+		url.Values{"NetworkInterface.2.Ipv4PrefixCount": {"2"}},
+		Ipv4PrefixCountParams(&ec2.RunInstancesInput{
+			NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
+				{DeviceIndex: aws.Int64(1)},
+				{DeviceIndex: aws.Int64(0)},
+			},
+		}, 2))
+}
+
+func TestAcceleratorParams(t *testing.T) {
+	require.Empty(t, AcceleratorParams(nil, nil))
+	require.Equal(t,
+		url.Values{
+			"ElasticGpuSpecification.1.Type":      {"eg1.medium"},
+			"ElasticInferenceAccelerator.1.Type":  {"eia2.medium"},
+			"ElasticInferenceAccelerator.2.Type":  {"eia2.large"},
+			"ElasticInferenceAccelerator.2.Count": {"2"},
+		},
+		AcceleratorParams(
+			[]ElasticGpuSpecification{{Type: "eg1.medium"}},
+			[]ElasticInferenceAccelerator{{Type: "eia2.medium"}, {Type: "eia2.large", Count: 2}}))
+}
+
+func TestCreditSpecificationParams(t *testing.T) {
+	require.Empty(t, CreditSpecificationParams(""))
+	require.Equal(t,
+		url.Values{"CreditSpecification.CpuCredits": {"unlimited"}},
+		CreditSpecificationParams(CPUCreditsUnlimited))
+	require.True(t, Burstable("t3a.small"))
+	require.False(t, Burstable("m5.large"))
+	require.False(t, Burstable(""))
+}
+
+func TestSpotMarketParams(t *testing.T) {
+	params := SpotMarketParams("0.05")
+	require.Equal(t, "spot", params.Get("InstanceMarketOptions.MarketType"))
+	require.Equal(t, "0.05", params.Get("InstanceMarketOptions.SpotOptions.MaxPrice"))
+
+	_, hasMaxPrice := SpotMarketParams("")["InstanceMarketOptions.SpotOptions.MaxPrice"]
+	require.False(t, hasMaxPrice)
+}
+
+func TestLaunchOptionsParams(t *testing.T) {
+	require.Empty(t, LaunchOptionsParams(nil, &HibernationOptions{}))
+	require.Equal(t,
+		url.Values{"EnclaveOptions.Enabled": {"true"}},
+		LaunchOptionsParams(&EnclaveOptions{Enabled: true}, nil))
+}
+
+func TestMetadataOptionsParams(t *testing.T) {
+	require.Empty(t, MetadataOptionsParams(nil))
+	require.Equal(t,
+		url.Values{
+			"MetadataOptions.HttpTokens":              {"required"},
+			"MetadataOptions.HttpPutResponseHopLimit": {"2"},
+			"MetadataOptions.InstanceMetadataTags":    {"enabled"},
+		},
+		MetadataOptionsParams(&MetadataOptions{
+			HttpTokens:              "required",
+			HttpPutResponseHopLimit: 2,
+			InstanceMetadataTags:    "enabled",
+		}))
+}
+
+func TestDescribeVpcIpv6CidrBlocks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<DescribeVpcsResponse>
+  <vpcSet>
+    <item>
+      <vpcId>vpc-1</vpcId>
+      <ipv6CidrBlockAssociationSet>
+        <item>
+          <associationId>vpc-cidr-assoc-1</associationId>
+          <ipv6CidrBlock>2600:1f14:abc:8800::/56</ipv6CidrBlock>
+          <ipv6CidrBlockState>
+            <state>associated</state>
+          </ipv6CidrBlockState>
+        </item>
+      </ipv6CidrBlockAssociationSet>
+    </item>
+  </vpcSet>
+</DescribeVpcsResponse>`))
+	}))
+	defer server.Close()
+
+	client := New(ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))))
+
+	output, err := client.DescribeVpcIpv6CidrBlocks(&ec2.DescribeVpcsInput{VpcIds: []*string{aws.String("vpc-1")}})
+	require.NoError(t, err)
+	require.Len(t, output.Vpcs, 1)
+	require.Len(t, output.Vpcs[0].Ipv6CidrBlockAssociations, 1)
+	association := output.Vpcs[0].Ipv6CidrBlockAssociations[0]
+	require.Equal(t, "2600:1f14:abc:8800::/56", *association.Ipv6CidrBlock)
+	require.Equal(t, "associated", *association.Ipv6CidrBlockState.State)
+}
+
+func TestGetEbsEncryptionByDefault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "GetEbsEncryptionByDefault", r.PostForm.Get("Action"))
+		w.Write([]byte(`<GetEbsEncryptionByDefaultResponse>
+  <ebsEncryptionByDefault>true</ebsEncryptionByDefault>
+</GetEbsEncryptionByDefaultResponse>`))
+	}))
+	defer server.Close()
+
+	client := New(ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))))
+
+	output, err := client.GetEbsEncryptionByDefault()
+	require.NoError(t, err)
+	require.True(t, *output.EbsEncryptionByDefault)
+}
+
+func TestTransitGatewayRoutes(t *testing.T) {
+	requests := []url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		requests = append(requests, r.PostForm)
+		if r.PostForm.Get("Action") != "DescribeRouteTables" {
+			w.Write([]byte(`<CreateRouteResponse><return>true</return></CreateRouteResponse>`))
+			return
+		}
+		w.Write([]byte(`<DescribeRouteTablesResponse>
+  <routeTableSet>
+    <item>
+      <routeTableId>rtb-1</routeTableId>
+      <routeSet>
+        <item>
+          <destinationCidrBlock>10.100.0.0/16</destinationCidrBlock>
+          <transitGatewayId>tgw-1</transitGatewayId>
+          <origin>CreateRoute</origin>
+        </item>
+      </routeSet>
+    </item>
+  </routeTableSet>
+</DescribeRouteTablesResponse>`))
+	}))
+	defer server.Close()
+
+	client := New(ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))))
+
+	output, err := client.DescribeRouteTableRoutes(&ec2.DescribeRouteTablesInput{
+		RouteTableIds: []*string{aws.String("rtb-1")},
+	})
+	require.NoError(t, err)
+	require.Len(t, output.RouteTables, 1)
+	require.Len(t, output.RouteTables[0].Routes, 1)
+	require.Equal(t, "tgw-1", *output.RouteTables[0].Routes[0].TransitGatewayId)
+
+	err = client.CreateRoute(&RouteInput{
+		RouteTableId:         aws.String("rtb-1"),
+		DestinationCidrBlock: aws.String("10.200.0.0/16"),
+		TransitGatewayId:     aws.String("tgw-1"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "CreateRoute", requests[1].Get("Action"))
+	require.Equal(t, "tgw-1", requests[1].Get("TransitGatewayId"))
+	require.Equal(t, "10.200.0.0/16", requests[1].Get("DestinationCidrBlock"))
+}
+
+func TestTransitGatewayVpcAttachments(t *testing.T) {
+	requests := []url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		requests = append(requests, r.PostForm)
+		switch r.PostForm.Get("Action") {
+		case "CreateTransitGatewayVpcAttachment":
+			w.Write([]byte(`<CreateTransitGatewayVpcAttachmentResponse>
+  <transitGatewayVpcAttachment>
+    <transitGatewayAttachmentId>tgw-attach-1</transitGatewayAttachmentId>
+    <transitGatewayId>tgw-1</transitGatewayId>
+    <vpcId>vpc-1</vpcId>
+    <state>pending</state>
+  </transitGatewayVpcAttachment>
+</CreateTransitGatewayVpcAttachmentResponse>`))
+		default:
+			w.Write([]byte(`<EnableTransitGatewayRouteTablePropagationResponse>
+  <propagation><state>enabling</state></propagation>
+</EnableTransitGatewayRouteTablePropagationResponse>`))
+		}
+	}))
+	defer server.Close()
+
+	client := New(ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))))
+
+	output, err := client.CreateTransitGatewayVpcAttachment(&CreateTransitGatewayVpcAttachmentInput{
+		TransitGatewayId: aws.String("tgw-1"),
+		VpcId:            aws.String("vpc-1"),
+		SubnetIds:        []*string{aws.String("subnet-1")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "tgw-attach-1", *output.TransitGatewayVpcAttachment.TransitGatewayAttachmentId)
+	require.Equal(t, "subnet-1", requests[0].Get("SubnetIds.1"))
+
+	err = client.EnableTransitGatewayRouteTablePropagation(&TransitGatewayRouteTableInput{
+		TransitGatewayRouteTableId: aws.String("tgw-rtb-1"),
+		TransitGatewayAttachmentId: aws.String("tgw-attach-1"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "tgw-rtb-1", requests[1].Get("TransitGatewayRouteTableId"))
+}
@@ -0,0 +1,227 @@
+package ec2ext
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// DescribeInstanceTypeOfferingsInput is the input of DescribeInstanceTypeOfferings.
+type DescribeInstanceTypeOfferingsInput struct {
+	_ struct{} `type:"structure"`
+
+	// Filters may include location and instance-type.
+	Filters []*ec2.Filter `locationName:"Filter" locationNameList:"Filter" type:"list"`
+
+	// LocationType is one of region, availability-zone, or availability-zone-id.
+	LocationType *string `type:"string"`
+
+	NextToken *string `type:"string"`
+}
+
+// InstanceTypeOffering is an instance type that is offered in a location.
+type InstanceTypeOffering struct {
+	_ struct{} `type:"structure"`
+
+	InstanceType *string `locationName:"instanceType" type:"string"`
+
+	Location *string `locationName:"location" type:"string"`
+
+	LocationType *string `locationName:"locationType" type:"string"`
+}
+
+// DescribeInstanceTypeOfferingsOutput is the output of DescribeInstanceTypeOfferings.
+type DescribeInstanceTypeOfferingsOutput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceTypeOfferings []*InstanceTypeOffering `locationName:"instanceTypeOfferingSet" locationNameList:"item" type:"list"`
+
+	NextToken *string `locationName:"nextToken" type:"string"`
+}
+
+// DescribeInstanceTypeOfferings lists the instance types offered in a location.
+func (c *EC2) DescribeInstanceTypeOfferings(
+	input *DescribeInstanceTypeOfferingsInput) (*DescribeInstanceTypeOfferingsOutput, error) {
+
+	output := &DescribeInstanceTypeOfferingsOutput{}
+	return output, c.send("DescribeInstanceTypeOfferings", input, output)
+}
+
+// DescribeInstanceTypesInput is the input of DescribeInstanceTypes.
+type DescribeInstanceTypesInput struct {
+	_ struct{} `type:"structure"`
+
+	Filters []*ec2.Filter `locationName:"Filter" locationNameList:"Filter" type:"list"`
+
+	InstanceTypes []*string `locationName:"InstanceType" type:"list"`
+
+	NextToken *string `type:"string"`
+}
+
+// ProcessorInfo describes the processor of an instance type.
+type ProcessorInfo struct {
+	_ struct{} `type:"structure"`
+
+	// SupportedArchitectures are the image architectures supported, such as x86_64 or arm64.
+	SupportedArchitectures []*string `locationName:"supportedArchitectures" locationNameList:"item" type:"list"`
+}
+
+// VCpuInfo describes the vCPUs of an instance type.
+type VCpuInfo struct {
+	_ struct{} `type:"structure"`
+
+	DefaultVCpus *int64 `locationName:"defaultVCpus" type:"integer"`
+}
+
+// MemoryInfo describes the memory of an instance type.
+type MemoryInfo struct {
+	_ struct{} `type:"structure"`
+
+	SizeInMiB *int64 `locationName:"sizeInMiB" type:"long"`
+}
+
+// AcceleratorDeviceInfo describes the GPUs or inference accelerators of an instance type.
+type AcceleratorDeviceInfo struct {
+	_ struct{} `type:"structure"`
+
+	Name *string `locationName:"name" type:"string"`
+
+	// Manufacturer is the manufacturer of the device, such as NVIDIA, AMD, or AWS.
+	Manufacturer *string `locationName:"manufacturer" type:"string"`
+
+	Count *int64 `locationName:"count" type:"integer"`
+}
+
+// GpuInfo describes the GPUs of an instance type.
+type GpuInfo struct {
+	_ struct{} `type:"structure"`
+
+	Gpus []*AcceleratorDeviceInfo `locationName:"gpus" locationNameList:"item" type:"list"`
+}
+
+// InferenceAcceleratorInfo describes the inference accelerators of an instance type.
+type InferenceAcceleratorInfo struct {
+	_ struct{} `type:"structure"`
+
+	Accelerators []*AcceleratorDeviceInfo `locationName:"accelerators" locationNameList:"item" type:"list"`
+}
+
+// NetworkInfo describes the networking of an instance type.
+type NetworkInfo struct {
+	_ struct{} `type:"structure"`
+
+	// EncryptionInTransitSupported is whether traffic between instances of supported types is encrypted by the
+	// Nitro hardware.
+	EncryptionInTransitSupported *bool `locationName:"encryptionInTransitSupported" type:"boolean"`
+}
+
+// InstanceTypeInfo describes an instance type.
+type InstanceTypeInfo struct {
+	_ struct{} `type:"structure"`
+
+	InstanceType *string `locationName:"instanceType" type:"string"`
+
+	// Hypervisor is nitro or xen, and is omitted for bare metal instance types.
+	Hypervisor *string `locationName:"hypervisor" type:"string"`
+
+	HibernationSupported *bool `locationName:"hibernationSupported" type:"boolean"`
+
+	// NitroEnclavesSupport is supported or unsupported.
+	NitroEnclavesSupport *string `locationName:"nitroEnclavesSupport" type:"string"`
+
+	NetworkInfo *NetworkInfo `locationName:"networkInfo" type:"structure"`
+
+	ProcessorInfo *ProcessorInfo `locationName:"processorInfo" type:"structure"`
+
+	VCpuInfo *VCpuInfo `locationName:"vCpuInfo" type:"structure"`
+
+	MemoryInfo *MemoryInfo `locationName:"memoryInfo" type:"structure"`
+
+	GpuInfo *GpuInfo `locationName:"gpuInfo" type:"structure"`
+
+	InferenceAcceleratorInfo *InferenceAcceleratorInfo `locationName:"inferenceAcceleratorInfo" type:"structure"`
+}
+
+// DescribeInstanceTypesOutput is the output of DescribeInstanceTypes.
+type DescribeInstanceTypesOutput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceTypes []*InstanceTypeInfo `locationName:"instanceTypeSet" locationNameList:"item" type:"list"`
+
+	NextToken *string `locationName:"nextToken" type:"string"`
+}
+
+// DescribeInstanceTypes describes the properties of instance types.
+func (c *EC2) DescribeInstanceTypes(input *DescribeInstanceTypesInput) (*DescribeInstanceTypesOutput, error) {
+	output := &DescribeInstanceTypesOutput{}
+	return output, c.send("DescribeInstanceTypes", input, output)
+}
+
+// IntegerRange is an inclusive range of an instance type attribute.  Max is unbounded if omitted.
+type IntegerRange struct {
+	_ struct{} `type:"structure"`
+
+	Max *int64 `type:"integer"`
+
+	Min *int64 `type:"integer"`
+}
+
+// FloatRange is an inclusive range of an instance type attribute.  Max is unbounded if omitted.
+type FloatRange struct {
+	_ struct{} `type:"structure"`
+
+	Max *float64 `type:"double"`
+
+	Min *float64 `type:"double"`
+}
+
+// InstanceRequirements are the attributes that matching instance types must have.
+type InstanceRequirements struct {
+	_ struct{} `type:"structure"`
+
+	// BurstablePerformance is one of included, excluded, or required.
+	BurstablePerformance *string `type:"string"`
+
+	MemoryMiB *IntegerRange `type:"structure"`
+
+	NetworkBandwidthGbps *FloatRange `type:"structure"`
+
+	VCpuCount *IntegerRange `type:"structure"`
+}
+
+// GetInstanceTypesFromInstanceRequirementsInput is the input of GetInstanceTypesFromInstanceRequirements.
+type GetInstanceTypesFromInstanceRequirementsInput struct {
+	_ struct{} `type:"structure"`
+
+	// ArchitectureTypes are image architectures, such as x86_64 or arm64.
+	ArchitectureTypes []*string `locationName:"ArchitectureType" locationNameList:"item" type:"list"`
+
+	InstanceRequirements *InstanceRequirements `type:"structure"`
+
+	NextToken *string `type:"string"`
+
+	// VirtualizationTypes are hvm or paravirtual.
+	VirtualizationTypes []*string `locationName:"VirtualizationType" locationNameList:"item" type:"list"`
+}
+
+// InstanceTypeInfoFromInstanceRequirements is an instance type matching instance requirements.
+type InstanceTypeInfoFromInstanceRequirements struct {
+	_ struct{} `type:"structure"`
+
+	InstanceType *string `locationName:"instanceType" type:"string"`
+}
+
+// GetInstanceTypesFromInstanceRequirementsOutput is the output of GetInstanceTypesFromInstanceRequirements.
+type GetInstanceTypesFromInstanceRequirementsOutput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceTypes []*InstanceTypeInfoFromInstanceRequirements `locationName:"instanceTypeSet" locationNameList:"item" type:"list"`
+
+	NextToken *string `locationName:"nextToken" type:"string"`
+}
+
+// GetInstanceTypesFromInstanceRequirements lists the instance types with the attributes of instance requirements.
+func (c *EC2) GetInstanceTypesFromInstanceRequirements(
+	input *GetInstanceTypesFromInstanceRequirementsInput) (*GetInstanceTypesFromInstanceRequirementsOutput, error) {
+
+	output := &GetInstanceTypesFromInstanceRequirementsOutput{}
+	return output, c.send("GetInstanceTypesFromInstanceRequirements", input, output)
+}
@@ -0,0 +1,134 @@
+package ec2ext
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net/url"
+)
+
+// Ipv6AddressCountParams encodes the number of IPv6 addresses assigned to the primary network interface of instances
+// launched by RunInstances.  When the request specifies network interfaces, the count is set on the interface with
+// device index 0.  No parameters are returned for an existing interface, whose addresses are its own.
+func Ipv6AddressCountParams(input *ec2.RunInstancesInput, count int64) url.Values {
+	if count <= 0 {
+		return url.Values{}
+	}
+
+	for i, networkInterface := range input.NetworkInterfaces {
+		if networkInterface.DeviceIndex == nil || *networkInterface.DeviceIndex == 0 {
+			if networkInterface.NetworkInterfaceId != nil {
+				return url.Values{}
+			}
+			return url.Values{fmt.Sprintf("NetworkInterface.%d.Ipv6AddressCount", i+1): {fmt.Sprint(count)}}
+		}
+	}
+	return url.Values{"Ipv6AddressCount": {fmt.Sprint(count)}}
+}
+
+// InstanceIpv6Address is an IPv6 address assigned to a network interface.
+type InstanceIpv6Address struct {
+	_ struct{} `type:"structure"`
+
+	Ipv6Address *string `locationName:"ipv6Address" type:"string"`
+}
+
+// NetworkInterfaceIpv6Addresses lists the IPv6 addresses of a network interface, along with its delegated IPv4
+// prefixes.
+type NetworkInterfaceIpv6Addresses struct {
+	_ struct{} `type:"structure"`
+
+	NetworkInterfaceId *string `locationName:"networkInterfaceId" type:"string"`
+
+	Attachment *ec2.NetworkInterfaceAttachment `locationName:"attachment" type:"structure"`
+
+	Ipv6Addresses []*InstanceIpv6Address `locationName:"ipv6AddressesSet" locationNameList:"item" type:"list"`
+
+	Ipv4Prefixes []*Ipv4PrefixSpecification `locationName:"ipv4PrefixSet" locationNameList:"item" type:"list"`
+}
+
+// DescribeNetworkInterfaceIpv6AddressesOutput is an output of DescribeNetworkInterfaces that includes the IPv6
+// addresses and IPv4 prefixes of each interface.  It is used as the output of a request built by the SDK.
+type DescribeNetworkInterfaceIpv6AddressesOutput struct {
+	_ struct{} `type:"structure"`
+
+	NetworkInterfaces []*NetworkInterfaceIpv6Addresses `locationName:"networkInterfaceSet" locationNameList:"item" type:"list"`
+}
+
+// VpcCidrBlockState is the state of a CIDR block associated with a VPC or subnet.
+type VpcCidrBlockState struct {
+	_ struct{} `type:"structure"`
+
+	State *string `locationName:"state" type:"string"`
+}
+
+// Ipv6CidrBlockAssociation is an IPv6 CIDR block associated with a VPC or subnet.
+type Ipv6CidrBlockAssociation struct {
+	_ struct{} `type:"structure"`
+
+	AssociationId *string `locationName:"associationId" type:"string"`
+
+	Ipv6CidrBlock *string `locationName:"ipv6CidrBlock" type:"string"`
+
+	Ipv6CidrBlockState *VpcCidrBlockState `locationName:"ipv6CidrBlockState" type:"structure"`
+}
+
+// VpcIpv6CidrBlocks lists the IPv6 CIDR blocks of a VPC.
+type VpcIpv6CidrBlocks struct {
+	_ struct{} `type:"structure"`
+
+	VpcId *string `locationName:"vpcId" type:"string"`
+
+	Ipv6CidrBlockAssociations []*Ipv6CidrBlockAssociation `locationName:"ipv6CidrBlockAssociationSet" locationNameList:"item" type:"list"`
+}
+
+// DescribeVpcIpv6CidrBlocksOutput is an output of DescribeVpcs that includes the IPv6 CIDR blocks of each VPC.
+type DescribeVpcIpv6CidrBlocksOutput struct {
+	_ struct{} `type:"structure"`
+
+	Vpcs []*VpcIpv6CidrBlocks `locationName:"vpcSet" locationNameList:"item" type:"list"`
+}
+
+// DescribeVpcIpv6CidrBlocks lists VPCs along with their IPv6 CIDR blocks.
+func (c *EC2) DescribeVpcIpv6CidrBlocks(input *ec2.DescribeVpcsInput) (*DescribeVpcIpv6CidrBlocksOutput, error) {
+	output := &DescribeVpcIpv6CidrBlocksOutput{}
+	return output, c.send("DescribeVpcs", input, output)
+}
+
+// AssociateSubnetCidrBlockInput is the input of AssociateSubnetCidrBlock.
+type AssociateSubnetCidrBlockInput struct {
+	_ struct{} `type:"structure"`
+
+	SubnetId *string `type:"string"`
+
+	// Ipv6CidrBlock is a /64 block of the IPv6 CIDR block of the VPC.
+	Ipv6CidrBlock *string `type:"string"`
+}
+
+// AssociateSubnetCidrBlockOutput is the output of AssociateSubnetCidrBlock.
+type AssociateSubnetCidrBlockOutput struct {
+	_ struct{} `type:"structure"`
+
+	Ipv6CidrBlockAssociation *Ipv6CidrBlockAssociation `locationName:"ipv6CidrBlockAssociation" type:"structure"`
+}
+
+// AssociateSubnetCidrBlock associates an IPv6 CIDR block with a subnet.
+func (c *EC2) AssociateSubnetCidrBlock(input *AssociateSubnetCidrBlockInput) (*AssociateSubnetCidrBlockOutput, error) {
+	output := &AssociateSubnetCidrBlockOutput{}
+	return output, c.send("AssociateSubnetCidrBlock", input, output)
+}
+
+// CreateIpv6RouteInput is the input of CreateRoute for an IPv6 destination, which the vendored SDK does not allow.
+type CreateIpv6RouteInput struct {
+	_ struct{} `type:"structure"`
+
+	RouteTableId *string `type:"string"`
+
+	DestinationIpv6CidrBlock *string `type:"string"`
+
+	GatewayId *string `type:"string"`
+}
+
+// CreateIpv6Route creates a route to an IPv6 destination.
+func (c *EC2) CreateIpv6Route(input *CreateIpv6RouteInput) error {
+	return c.send("CreateRoute", input, &ec2.CreateRouteOutput{})
+}
@@ -0,0 +1,43 @@
+package ec2ext
+
+import (
+	"net/url"
+)
+
+// EnclaveOptions enables Nitro Enclaves, isolated compute environments carved from the vCPUs and memory of an
+// instance.
+type EnclaveOptions struct {
+	Enabled bool
+}
+
+// HibernationOptions enables hibernation, which saves the memory of an instance to its encrypted root volume when it
+// is stopped.
+type HibernationOptions struct {
+	Configured bool
+}
+
+// LaunchOptionsParams encodes the enclave and hibernation options of instances launched by RunInstances.  Either
+// option may be nil.
+func LaunchOptionsParams(enclave *EnclaveOptions, hibernation *HibernationOptions) url.Values {
+	params := url.Values{}
+	if enclave != nil && enclave.Enabled {
+		params["EnclaveOptions.Enabled"] = []string{"true"}
+	}
+	if hibernation != nil && hibernation.Configured {
+		params["HibernationOptions.Configured"] = []string{"true"}
+	}
+	return params
+}
+
+// GetEbsEncryptionByDefaultOutput is the output of GetEbsEncryptionByDefault.
+type GetEbsEncryptionByDefaultOutput struct {
+	_ struct{} `type:"structure"`
+
+	EbsEncryptionByDefault *bool `locationName:"ebsEncryptionByDefault" type:"boolean"`
+}
+
+// GetEbsEncryptionByDefault determines whether new EBS volumes of the account are encrypted in the region.
+func (c *EC2) GetEbsEncryptionByDefault() (*GetEbsEncryptionByDefaultOutput, error) {
+	output := &GetEbsEncryptionByDefaultOutput{}
+	return output, c.send("GetEbsEncryptionByDefault", &struct{}{}, output)
+}
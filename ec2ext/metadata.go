@@ -0,0 +1,38 @@
+package ec2ext
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// MetadataOptions are the instance metadata service options of instances.
+type MetadataOptions struct {
+	// HttpTokens is optional, or required to only serve IMDSv2 requests with a session token.
+	HttpTokens string `json:",omitempty"`
+
+	// HttpPutResponseHopLimit is the number of network hops session tokens may travel, such as 2 for containers that
+	// are not on the host network.
+	HttpPutResponseHopLimit int64 `json:",omitempty"`
+
+	// InstanceMetadataTags is enabled to serve the tags of the instance from the metadata service, or disabled.
+	InstanceMetadataTags string `json:",omitempty"`
+}
+
+// MetadataOptionsParams encodes the metadata options of instances launched by RunInstances.  The options may be nil.
+func MetadataOptionsParams(options *MetadataOptions) url.Values {
+	params := url.Values{}
+	if options == nil {
+		return params
+	}
+	if options.HttpTokens != "" {
+		params["MetadataOptions.HttpTokens"] = []string{options.HttpTokens}
+	}
+	if options.HttpPutResponseHopLimit > 0 {
+		params["MetadataOptions.HttpPutResponseHopLimit"] = []string{
+			strconv.FormatInt(options.HttpPutResponseHopLimit, 10)}
+	}
+	if options.InstanceMetadataTags != "" {
+		params["MetadataOptions.InstanceMetadataTags"] = []string{options.InstanceMetadataTags}
+	}
+	return params
+}
@@ -0,0 +1,21 @@
+package ec2ext
+
+// SubnetLocation is a subnet, along with the Outpost it is on, if any.
+type SubnetLocation struct {
+	_ struct{} `type:"structure"`
+
+	SubnetId *string `locationName:"subnetId" type:"string"`
+
+	AvailabilityZone *string `locationName:"availabilityZone" type:"string"`
+
+	// OutpostArn is the Outpost of a subnet of an Outpost.
+	OutpostArn *string `locationName:"outpostArn" type:"string"`
+}
+
+// DescribeSubnetLocationsOutput is an output of DescribeSubnets that includes the Outpost of each subnet.  It is used
+// as the output of a request built by the SDK.
+type DescribeSubnetLocationsOutput struct {
+	_ struct{} `type:"structure"`
+
+	Subnets []*SubnetLocation `locationName:"subnetSet" locationNameList:"item" type:"list"`
+}
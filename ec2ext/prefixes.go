@@ -0,0 +1,33 @@
+package ec2ext
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net/url"
+)
+
+// Ipv4PrefixCountParams encodes the number of IPv4 prefixes delegated to the primary network interface of instances
+// launched by RunInstances.  Prefixes may only be requested for network interfaces, so the request must specify the
+// interface with device index 0.  No parameters are returned for an existing interface, whose prefixes are its own.
+func Ipv4PrefixCountParams(input *ec2.RunInstancesInput, count int64) url.Values {
+	if count <= 0 {
+		return url.Values{}
+	}
+
+	for i, networkInterface := range input.NetworkInterfaces {
+		if networkInterface.DeviceIndex == nil || *networkInterface.DeviceIndex == 0 {
+			if networkInterface.NetworkInterfaceId != nil {
+				return url.Values{}
+			}
+			return url.Values{fmt.Sprintf("NetworkInterface.%d.Ipv4PrefixCount", i+1): {fmt.Sprint(count)}}
+		}
+	}
+	return url.Values{}
+}
+
+// Ipv4PrefixSpecification is an IPv4 prefix delegated to a network interface.
+type Ipv4PrefixSpecification struct {
+	_ struct{} `type:"structure"`
+
+	Ipv4Prefix *string `locationName:"ipv4Prefix" type:"string"`
+}
@@ -0,0 +1,79 @@
+package ec2ext
+
+const (
+	// ReplaceRootVolumeTaskStateSucceeded is the state of a root volume replacement that completed.
+	ReplaceRootVolumeTaskStateSucceeded = "succeeded"
+
+	// ReplaceRootVolumeTaskStateFailed is the state of a root volume replacement that failed, leaving the original
+	// root volume attached.
+	ReplaceRootVolumeTaskStateFailed = "failed"
+
+	// ReplaceRootVolumeTaskStateFailedDetached is the state of a root volume replacement that failed with the
+	// original root volume detached.
+	ReplaceRootVolumeTaskStateFailedDetached = "failed-detached"
+)
+
+// CreateReplaceRootVolumeTaskInput is the input of CreateReplaceRootVolumeTask.
+type CreateReplaceRootVolumeTaskInput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceId *string `type:"string"`
+
+	// ImageId restores the root volume from the image, rather than from the launch state of the instance.
+	ImageId *string `type:"string"`
+
+	// DeleteReplacedRootVolume deletes the original root volume once it is replaced, rather than keeping it detached.
+	DeleteReplacedRootVolume *bool `type:"boolean"`
+
+	ClientToken *string `type:"string"`
+}
+
+// ReplaceRootVolumeTask is the replacement of the root volume of an instance, which reboots the instance.
+type ReplaceRootVolumeTask struct {
+	_ struct{} `type:"structure"`
+
+	ReplaceRootVolumeTaskId *string `locationName:"replaceRootVolumeTaskId" type:"string"`
+
+	InstanceId *string `locationName:"instanceId" type:"string"`
+
+	// TaskState is pending, in-progress, failing, succeeded, failed, or failed-detached.
+	TaskState *string `locationName:"taskState" type:"string"`
+}
+
+// CreateReplaceRootVolumeTaskOutput is the output of CreateReplaceRootVolumeTask.
+type CreateReplaceRootVolumeTaskOutput struct {
+	_ struct{} `type:"structure"`
+
+	ReplaceRootVolumeTask *ReplaceRootVolumeTask `locationName:"replaceRootVolumeTask" type:"structure"`
+}
+
+// CreateReplaceRootVolumeTask replaces the root volume of a running instance, keeping its network interfaces,
+// addresses, and other volumes.
+func (c *EC2) CreateReplaceRootVolumeTask(
+	input *CreateReplaceRootVolumeTaskInput) (*CreateReplaceRootVolumeTaskOutput, error) {
+
+	output := &CreateReplaceRootVolumeTaskOutput{}
+	return output, c.send("CreateReplaceRootVolumeTask", input, output)
+}
+
+// DescribeReplaceRootVolumeTasksInput is the input of DescribeReplaceRootVolumeTasks.
+type DescribeReplaceRootVolumeTasksInput struct {
+	_ struct{} `type:"structure"`
+
+	ReplaceRootVolumeTaskIds []*string `locationName:"ReplaceRootVolumeTaskId" type:"list"`
+}
+
+// DescribeReplaceRootVolumeTasksOutput is the output of DescribeReplaceRootVolumeTasks.
+type DescribeReplaceRootVolumeTasksOutput struct {
+	_ struct{} `type:"structure"`
+
+	ReplaceRootVolumeTasks []*ReplaceRootVolumeTask `locationName:"replaceRootVolumeTaskSet" locationNameList:"item" type:"list"`
+}
+
+// DescribeReplaceRootVolumeTasks looks up root volume replacements.
+func (c *EC2) DescribeReplaceRootVolumeTasks(
+	input *DescribeReplaceRootVolumeTasksInput) (*DescribeReplaceRootVolumeTasksOutput, error) {
+
+	output := &DescribeReplaceRootVolumeTasksOutput{}
+	return output, c.send("DescribeReplaceRootVolumeTasks", input, output)
+}
@@ -0,0 +1,74 @@
+package ec2ext
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Route is a route of a route table, including targets that the vendored SDK does not model.
+type Route struct {
+	_ struct{} `type:"structure"`
+
+	DestinationCidrBlock *string `locationName:"destinationCidrBlock" type:"string"`
+
+	DestinationIpv6CidrBlock *string `locationName:"destinationIpv6CidrBlock" type:"string"`
+
+	DestinationPrefixListId *string `locationName:"destinationPrefixListId" type:"string"`
+
+	GatewayId *string `locationName:"gatewayId" type:"string"`
+
+	NatGatewayId *string `locationName:"natGatewayId" type:"string"`
+
+	VpcPeeringConnectionId *string `locationName:"vpcPeeringConnectionId" type:"string"`
+
+	TransitGatewayId *string `locationName:"transitGatewayId" type:"string"`
+
+	// Origin is CreateRouteTable, CreateRoute, or EnableVgwRoutePropagation.
+	Origin *string `locationName:"origin" type:"string"`
+}
+
+// RouteTableRoutes lists the routes of a route table.
+type RouteTableRoutes struct {
+	_ struct{} `type:"structure"`
+
+	RouteTableId *string `locationName:"routeTableId" type:"string"`
+
+	Routes []*Route `locationName:"routeSet" locationNameList:"item" type:"list"`
+}
+
+// DescribeRouteTableRoutesOutput is an output of DescribeRouteTables that includes all targets of each route.
+type DescribeRouteTableRoutesOutput struct {
+	_ struct{} `type:"structure"`
+
+	RouteTables []*RouteTableRoutes `locationName:"routeTableSet" locationNameList:"item" type:"list"`
+}
+
+// DescribeRouteTableRoutes lists route tables along with all targets of their routes.
+func (c *EC2) DescribeRouteTableRoutes(input *ec2.DescribeRouteTablesInput) (*DescribeRouteTableRoutesOutput, error) {
+	output := &DescribeRouteTableRoutesOutput{}
+	return output, c.send("DescribeRouteTables", input, output)
+}
+
+// RouteInput is the input of CreateRoute and ReplaceRoute, with a transit gateway target.
+type RouteInput struct {
+	_ struct{} `type:"structure"`
+
+	RouteTableId *string `type:"string"`
+
+	DestinationCidrBlock *string `type:"string"`
+
+	GatewayId *string `type:"string"`
+
+	VpcPeeringConnectionId *string `type:"string"`
+
+	TransitGatewayId *string `type:"string"`
+}
+
+// CreateRoute creates a route in a route table.
+func (c *EC2) CreateRoute(input *RouteInput) error {
+	return c.send("CreateRoute", input, &ec2.CreateRouteOutput{})
+}
+
+// ReplaceRoute replaces the target of a route in a route table.
+func (c *EC2) ReplaceRoute(input *RouteInput) error {
+	return c.send("ReplaceRoute", input, &ec2.ReplaceRouteOutput{})
+}
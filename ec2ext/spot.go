@@ -0,0 +1,18 @@
+package ec2ext
+
+import (
+	"net/url"
+)
+
+// SpotMarketParams encodes the market options of one-time spot instances launched by RunInstances.  The maximum price
+// is the hourly on-demand price when maxPrice is empty.
+func SpotMarketParams(maxPrice string) url.Values {
+	params := url.Values{
+		"InstanceMarketOptions.MarketType":                   {"spot"},
+		"InstanceMarketOptions.SpotOptions.SpotInstanceType": {"one-time"},
+	}
+	if maxPrice != "" {
+		params["InstanceMarketOptions.SpotOptions.MaxPrice"] = []string{maxPrice}
+	}
+	return params
+}
@@ -0,0 +1,39 @@
+package ec2ext
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net/url"
+)
+
+const (
+	// ResourceTypeInstance is the resource type for tagging instances on creation.
+	ResourceTypeInstance = "instance"
+
+	// ResourceTypeVolume is the resource type for tagging volumes on creation.
+	ResourceTypeVolume = "volume"
+
+	// ResourceTypeNetworkInterface is the resource type for tagging network interfaces on creation.
+	ResourceTypeNetworkInterface = "network-interface"
+)
+
+// TagSpecification is a set of tags applied to resources of a type when they are created.
+type TagSpecification struct {
+	ResourceType string
+	Tags         []*ec2.Tag
+}
+
+// TagSpecificationParams encodes tag specifications as the TagSpecification parameters of actions such as
+// RunInstances.
+func TagSpecificationParams(specs ...TagSpecification) url.Values {
+	params := url.Values{}
+	for i, spec := range specs {
+		prefix := fmt.Sprintf("TagSpecification.%d", i+1)
+		params.Set(prefix+".ResourceType", spec.ResourceType)
+		for j, tag := range spec.Tags {
+			params.Set(fmt.Sprintf("%s.Tag.%d.Key", prefix, j+1), *tag.Key)
+			params.Set(fmt.Sprintf("%s.Tag.%d.Value", prefix, j+1), *tag.Value)
+		}
+	}
+	return params
+}
@@ -0,0 +1,119 @@
+package ec2ext
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// TransitGatewayAttachmentStateAvailable is the state of an attachment that routes traffic.
+	TransitGatewayAttachmentStateAvailable = "available"
+
+	// TransitGatewayAttachmentStatePendingAcceptance is the state of an attachment to a transit gateway of another
+	// account that does not accept attachments automatically.
+	TransitGatewayAttachmentStatePendingAcceptance = "pendingAcceptance"
+
+	// TransitGatewayAttachmentStateDeleted is the state of a deleted attachment.
+	TransitGatewayAttachmentStateDeleted = "deleted"
+
+	// TransitGatewayAttachmentStateFailed is the state of an attachment that could not be created.
+	TransitGatewayAttachmentStateFailed = "failed"
+)
+
+// TransitGatewayVpcAttachment is the attachment of a VPC to a transit gateway.
+type TransitGatewayVpcAttachment struct {
+	_ struct{} `type:"structure"`
+
+	TransitGatewayAttachmentId *string `locationName:"transitGatewayAttachmentId" type:"string"`
+
+	TransitGatewayId *string `locationName:"transitGatewayId" type:"string"`
+
+	VpcId *string `locationName:"vpcId" type:"string"`
+
+	// State is pendingAcceptance, pending, available, modifying, deleting, deleted, failed, or rejected.
+	State *string `locationName:"state" type:"string"`
+}
+
+// CreateTransitGatewayVpcAttachmentInput is the input of CreateTransitGatewayVpcAttachment.
+type CreateTransitGatewayVpcAttachmentInput struct {
+	_ struct{} `type:"structure"`
+
+	TransitGatewayId *string `type:"string"`
+
+	VpcId *string `type:"string"`
+
+	// SubnetIds are the subnets of the attachment, one for each availability zone that reaches the transit gateway.
+	SubnetIds []*string `type:"list"`
+}
+
+// CreateTransitGatewayVpcAttachmentOutput is the output of CreateTransitGatewayVpcAttachment.
+type CreateTransitGatewayVpcAttachmentOutput struct {
+	_ struct{} `type:"structure"`
+
+	TransitGatewayVpcAttachment *TransitGatewayVpcAttachment `locationName:"transitGatewayVpcAttachment" type:"structure"`
+}
+
+// CreateTransitGatewayVpcAttachment attaches a VPC to a transit gateway.
+func (c *EC2) CreateTransitGatewayVpcAttachment(
+	input *CreateTransitGatewayVpcAttachmentInput) (*CreateTransitGatewayVpcAttachmentOutput, error) {
+
+	output := &CreateTransitGatewayVpcAttachmentOutput{}
+	return output, c.send("CreateTransitGatewayVpcAttachment", input, output)
+}
+
+// DescribeTransitGatewayVpcAttachmentsInput is the input of DescribeTransitGatewayVpcAttachments.
+type DescribeTransitGatewayVpcAttachmentsInput struct {
+	_ struct{} `type:"structure"`
+
+	TransitGatewayAttachmentIds []*string `locationName:"TransitGatewayAttachmentIds" type:"list"`
+
+	// Filters may include transit-gateway-id, vpc-id, state, and tags.
+	Filters []*ec2.Filter `locationName:"Filter" locationNameList:"Filter" type:"list"`
+}
+
+// DescribeTransitGatewayVpcAttachmentsOutput is the output of DescribeTransitGatewayVpcAttachments.
+type DescribeTransitGatewayVpcAttachmentsOutput struct {
+	_ struct{} `type:"structure"`
+
+	TransitGatewayVpcAttachments []*TransitGatewayVpcAttachment `locationName:"transitGatewayVpcAttachments" locationNameList:"item" type:"list"`
+}
+
+// DescribeTransitGatewayVpcAttachments lists the attachments of VPCs to transit gateways.
+func (c *EC2) DescribeTransitGatewayVpcAttachments(
+	input *DescribeTransitGatewayVpcAttachmentsInput) (*DescribeTransitGatewayVpcAttachmentsOutput, error) {
+
+	output := &DescribeTransitGatewayVpcAttachmentsOutput{}
+	return output, c.send("DescribeTransitGatewayVpcAttachments", input, output)
+}
+
+// TransitGatewayAttachmentInput identifies an attachment of a transit gateway.
+type TransitGatewayAttachmentInput struct {
+	_ struct{} `type:"structure"`
+
+	TransitGatewayAttachmentId *string `type:"string"`
+}
+
+// DeleteTransitGatewayVpcAttachment detaches a VPC from a transit gateway.
+func (c *EC2) DeleteTransitGatewayVpcAttachment(input *TransitGatewayAttachmentInput) error {
+	return c.send("DeleteTransitGatewayVpcAttachment", input, &struct{}{})
+}
+
+// TransitGatewayRouteTableInput is the input of AssociateTransitGatewayRouteTable and
+// EnableTransitGatewayRouteTablePropagation.
+type TransitGatewayRouteTableInput struct {
+	_ struct{} `type:"structure"`
+
+	TransitGatewayRouteTableId *string `type:"string"`
+
+	TransitGatewayAttachmentId *string `type:"string"`
+}
+
+// AssociateTransitGatewayRouteTable routes the traffic of an attachment with a route table of its transit gateway.
+func (c *EC2) AssociateTransitGatewayRouteTable(input *TransitGatewayRouteTableInput) error {
+	return c.send("AssociateTransitGatewayRouteTable", input, &struct{}{})
+}
+
+// EnableTransitGatewayRouteTablePropagation propagates the routes of an attachment, the CIDR blocks of its VPC, to a
+// route table of its transit gateway.
+func (c *EC2) EnableTransitGatewayRouteTablePropagation(input *TransitGatewayRouteTableInput) error {
+	return c.send("EnableTransitGatewayRouteTablePropagation", input, &struct{}{})
+}
@@ -0,0 +1,110 @@
+package bootstrap
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"strings"
+)
+
+const (
+	nvidiaDrivers = "nvidia"
+	amdDrivers    = "amd"
+	neuronDrivers = "neuron"
+
+	// driversTag is the image tag listing the accelerator drivers installed in an image, such as "nvidia" or
+	// "nvidia,neuron", for images whose names do not follow the naming convention.
+	driversTag = "infrakit.drivers"
+)
+
+// acceleratorFamilies are the instance families with GPUs or machine learning accelerators, and the drivers their
+// images must include.  The families are used when the instance type information does not identify the devices.
+var acceleratorFamilies = map[string]string{
+	"p2":   nvidiaDrivers,
+	"p3":   nvidiaDrivers,
+	"p3dn": nvidiaDrivers,
+	"p4d":  nvidiaDrivers,
+	"p4de": nvidiaDrivers,
+	"p5":   nvidiaDrivers,
+	"g3":   nvidiaDrivers,
+	"g3s":  nvidiaDrivers,
+	"g4dn": nvidiaDrivers,
+	"g4ad": amdDrivers,
+	"g5":   nvidiaDrivers,
+	"g5g":  nvidiaDrivers,
+	"g6":   nvidiaDrivers,
+	"g6e":  nvidiaDrivers,
+	"gr6":  nvidiaDrivers,
+	"inf1": neuronDrivers,
+	"inf2": neuronDrivers,
+	"trn1": neuronDrivers,
+}
+
+// driverNameKeywords are the words in image names that identify images with accelerator drivers, such as the Deep
+// Learning AMIs.
+var driverNameKeywords = map[string][]string{
+	nvidiaDrivers: {"nvidia", "cuda", "gpu", "deep learning", "deeplearning"},
+	amdDrivers:    {"amd", "radeon", "rocm"},
+	neuronDrivers: {"neuron"},
+}
+
+func instanceFamily(instanceType string) string {
+	return strings.SplitN(instanceType, ".", 2)[0]
+}
+
+// requiredDrivers returns the accelerator drivers required by an instance type, if any.  The manufacturer of the
+// instance type's devices takes precedence over the instance family.
+func requiredDrivers(instanceType string, info *ec2ext.InstanceTypeInfo) string {
+	devices := []*ec2ext.AcceleratorDeviceInfo{}
+	if info != nil && info.GpuInfo != nil {
+		devices = append(devices, info.GpuInfo.Gpus...)
+	}
+	if info != nil && info.InferenceAcceleratorInfo != nil {
+		devices = append(devices, info.InferenceAcceleratorInfo.Accelerators...)
+	}
+	for _, device := range devices {
+		switch strings.ToLower(aws.StringValue(device.Manufacturer)) {
+		case "nvidia":
+			return nvidiaDrivers
+		case "amd":
+			return amdDrivers
+		case "aws":
+			return neuronDrivers
+		}
+	}
+	return acceleratorFamilies[instanceFamily(instanceType)]
+}
+
+// hasDrivers determines whether an image includes accelerator drivers, by the driversTag tag of the image or, when
+// it is not tagged, by the image name.
+func hasDrivers(image *ec2.Image, drivers string) bool {
+	for _, tag := range image.Tags {
+		if aws.StringValue(tag.Key) == driversTag {
+			for _, tagged := range strings.Split(aws.StringValue(tag.Value), ",") {
+				if strings.TrimSpace(tagged) == drivers {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	name := strings.ToLower(aws.StringValue(image.Name) + " " + aws.StringValue(image.Description))
+	for _, keyword := range driverNameKeywords[drivers] {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// validElasticGpuType determines whether an Elastic GPU type is well formed, such as eg1.medium.
+func validElasticGpuType(t string) bool {
+	return strings.HasPrefix(t, "eg1.") && len(t) > len("eg1.")
+}
+
+// validElasticInferenceType determines whether an Elastic Inference accelerator type is well formed, such as
+// eia2.medium.
+func validElasticInferenceType(t string) bool {
+	return (strings.HasPrefix(t, "eia1.") || strings.HasPrefix(t, "eia2.")) && len(t) > len("eia1.")
+}
@@ -0,0 +1,232 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSSHUser is the user of the Ubuntu images of the image channels.
+	defaultSSHUser = "ubuntu"
+
+	// defaultKeyExpiry is the time that keys authorized with Run Command remain authorized.
+	defaultKeyExpiry = time.Hour
+
+	// authorizedKeyComment is the comment of keys authorized with Run Command, followed by the Unix time at which the
+	// key expires.
+	authorizedKeyComment = "infrakit-operator-key-"
+
+	// instanceConnectKeyLifetime is the time that keys pushed with EC2 Instance Connect may be used to connect.
+	instanceConnectKeyLifetime = 60 * time.Second
+)
+
+var (
+	publicKeyPattern = regexp.MustCompile(`^(ssh-rsa|ssh-ed25519|ecdsa-sha2-nistp(256|384|521)) [A-Za-z0-9+/=]+( .*)?$`)
+	userPattern      = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+)
+
+// sshKeyRequest is a public key of an operator to grant SSH access to instances of a cluster for debugging, without
+// baking the key into images or key pairs of the cluster.
+type sshKeyRequest struct {
+	// PublicKey is an OpenSSH public key.
+	PublicKey string
+
+	// User is the user of the instances the key may log in as.
+	User string
+
+	// Expiry is the time after which a key authorized with Run Command is removed, or zero to keep the key.
+	Expiry time.Duration
+}
+
+func (r sshKeyRequest) validate() error {
+	if !publicKeyPattern.MatchString(strings.TrimSpace(r.PublicKey)) {
+		return errors.New("The public key must be a single OpenSSH public key")
+	}
+	if !userPattern.MatchString(r.User) {
+		return fmt.Errorf("Invalid user name: %s", r.User)
+	}
+	if r.Expiry < 0 {
+		return errors.New("The key expiry must not be negative")
+	}
+	return nil
+}
+
+// accessTargets returns the running instances of a cluster, limited to those of a group or to an instance if named.
+func accessTargets(
+	config client.ConfigProvider,
+	cluster clusterID,
+	group string,
+	instanceID string) ([]inventoryInstance, error) {
+
+	filters := []*ec2.Filter{
+		cluster.clusterFilter(),
+		{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"running"})},
+	}
+	if group != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("tag:" + instance.GroupTag),
+			Values: aws.StringSlice([]string{group}),
+		})
+	}
+	input := ec2.DescribeInstancesInput{Filters: filters}
+	if instanceID != "" {
+		input.InstanceIds = aws.StringSlice([]string{instanceID})
+	}
+
+	targets := []inventoryInstance{}
+	err := ec2.New(config).DescribeInstancesPages(&input, func(page *ec2.DescribeInstancesOutput, last bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, ec2Instance := range reservation.Instances {
+				targets = append(targets, inventoryInstance{
+					InstanceID:       *ec2Instance.InstanceId,
+					AvailabilityZone: aws.StringValue(ec2Instance.Placement.AvailabilityZone),
+					PrivateIP:        aws.StringValue(ec2Instance.PrivateIpAddress),
+					PublicIP:         aws.StringValue(ec2Instance.PublicIpAddress),
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up instances: %s", err)
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("No running instances of the cluster match")
+	}
+	return targets, nil
+}
+
+func newInstanceConnectClient(config client.ConfigProvider) *client.Client {
+	c := config.ClientConfig("ec2-instance-connect")
+	connect := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "ec2-instance-connect",
+			SigningName:   "ec2-instance-connect",
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2018-04-02",
+			JSONVersion:   "1.1",
+			TargetPrefix:  "AWSEC2InstanceConnectService",
+		},
+		c.Handlers)
+	connect.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	connect.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	connect.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	connect.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	connect.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+	return connect
+}
+
+type sendSSHPublicKeyInput struct {
+	InstanceId       string
+	InstanceOSUser   string
+	SSHPublicKey     string
+	AvailabilityZone string
+}
+
+type sendSSHPublicKeyOutput struct {
+	RequestId string
+	Success   bool
+}
+
+// pushSSHKey pushes a key to instances with EC2 Instance Connect, such that the key may be used to connect to them for
+// the next minute.  The instances run the EC2 Instance Connect agent, which is included in the Ubuntu images of the
+// image channels, and must be reachable with SSH.
+func pushSSHKey(config client.ConfigProvider, key sshKeyRequest, targets []inventoryInstance) error {
+	connect := newInstanceConnectClient(config)
+	for _, target := range targets {
+		output := sendSSHPublicKeyOutput{}
+		input := sendSSHPublicKeyInput{
+			InstanceId:       target.InstanceID,
+			InstanceOSUser:   key.User,
+			SSHPublicKey:     strings.TrimSpace(key.PublicKey),
+			AvailabilityZone: target.AvailabilityZone,
+		}
+		operation := request.Operation{Name: "SendSSHPublicKey", HTTPMethod: "POST", HTTPPath: "/"}
+		err := connect.NewRequest(&operation, &input, &output).Send()
+		if err != nil {
+			return fmt.Errorf("Failed to push the key to %s: %s", target.InstanceID, err)
+		}
+		if !output.Success {
+			return fmt.Errorf("Failed to push the key to %s: request %s did not succeed", target.InstanceID, output.RequestId)
+		}
+		log.Infof("Pushed the key to %s for %s, connect as %s@%s", target.InstanceID, instanceConnectKeyLifetime,
+			key.User, targetAddress(target))
+	}
+	return nil
+}
+
+// authorizedKeyCommands are the commands adding a key to the authorized keys of a user, scheduling the removal of the
+// key when it expires.  The comment of the key is replaced by one identifying it as an operator key, so that expired
+// keys are recognized.
+func authorizedKeyCommands(key sshKeyRequest, now time.Time) []string {
+	fields := strings.Fields(key.PublicKey)
+	comment := authorizedKeyComment + "0"
+	if key.Expiry > 0 {
+		comment = fmt.Sprintf("%s%d", authorizedKeyComment, now.Add(key.Expiry).Unix())
+	}
+
+	commands := []string{
+		fmt.Sprintf(`home=$(getent passwd %s | cut -d: -f6)`, key.User),
+		`test -n "$home"`,
+		fmt.Sprintf(`install -d -m 700 -o %s -g %s "$home/.ssh"`, key.User, key.User),
+		fmt.Sprintf(`echo '%s %s %s' >> "$home/.ssh/authorized_keys"`, fields[0], fields[1], comment),
+		fmt.Sprintf(`chown %s:%s "$home/.ssh/authorized_keys"`, key.User, key.User),
+		`chmod 600 "$home/.ssh/authorized_keys"`,
+	}
+	if key.Expiry > 0 {
+		commands = append(commands, fmt.Sprintf(
+			`systemd-run --on-active=%d /bin/sed -i '/ %s$/d' "$home/.ssh/authorized_keys"`,
+			int64(key.Expiry.Seconds()), comment))
+	}
+	return commands
+}
+
+// authorizeSSHKey adds a key to the authorized keys of instances with Run Command, for clusters with SSMAccess whose
+// instances may not be reached by EC2 Instance Connect.  Since their instances do not allow SSH from outside the VPC,
+// the key is used over a Session Manager session with the AWS-StartSSHSession document.  The instances remove the key
+// once it expires.
+func authorizeSSHKey(
+	config client.ConfigProvider,
+	access ssmAccess,
+	key sshKeyRequest,
+	targets []inventoryInstance) error {
+
+	ssm := newSSMClient(config)
+	commands := authorizedKeyCommands(key, time.Now())
+	for _, target := range targets {
+		deadline := time.Now().Add(access.timeout())
+		err := runShellCommands(ssm, target.InstanceID, "InfraKit operator SSH key", commands, deadline)
+		if err != nil {
+			return err
+		}
+		if key.Expiry > 0 {
+			log.Infof("Authorized the key on %s for user %s until %s", target.InstanceID, key.User,
+				time.Now().Add(key.Expiry).Format(time.RFC3339))
+		} else {
+			log.Infof("Authorized the key on %s for user %s", target.InstanceID, key.User)
+		}
+	}
+	return nil
+}
+
+// targetAddress is the address an operator connects to an instance with, preferring its public address.
+func targetAddress(target inventoryInstance) string {
+	if target.PublicIP != "" {
+		return target.PublicIP
+	}
+	return target.PrivateIP
+}
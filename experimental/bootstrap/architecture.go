@@ -0,0 +1,111 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"strings"
+)
+
+// defaultInstanceTypes are the instance types used for groups that do not specify one, by image architecture.
+var defaultInstanceTypes = map[string]string{
+	"x86_64": "t2.micro",
+	"arm64":  "t4g.micro",
+}
+
+func describeImage(ec2Client ec2iface.EC2API, imageID *string) (*ec2.Image, error) {
+	images, err := ec2Client.DescribeImages(&ec2.DescribeImagesInput{ImageIds: []*string{imageID}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe image %s: %s", *imageID, err)
+	}
+	if len(images.Images) != 1 {
+		return nil, fmt.Errorf("image %s not found", *imageID)
+	}
+	if aws.StringValue(images.Images[0].Architecture) == "" {
+		return nil, fmt.Errorf("image %s has no architecture", *imageID)
+	}
+	return images.Images[0], nil
+}
+
+func imageArchitecture(ec2Client ec2iface.EC2API, imageID *string) (string, error) {
+	image, err := describeImage(ec2Client, imageID)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(image.Architecture), nil
+}
+
+// launchCandidate is an instance type and image that a group may launch.
+type launchCandidate struct {
+	instanceType *string
+	imageID      *string
+}
+
+// launchCandidates returns the instance type and image combinations a group may launch.
+func launchCandidates(grp instanceGroupSpec) []launchCandidate {
+	run := grp.Config.RunInstancesInput
+	if len(grp.Config.InstanceTypes) == 0 {
+		return []launchCandidate{{instanceType: run.InstanceType, imageID: run.ImageId}}
+	}
+
+	candidates := []launchCandidate{}
+	for _, option := range grp.Config.InstanceTypes {
+		candidate := launchCandidate{instanceType: aws.String(option.InstanceType), imageID: run.ImageId}
+		if option.ImageID != "" {
+			candidate.imageID = aws.String(option.ImageID)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// resolveInstanceTypes chooses the instance types of groups with instance requirements, and an instance type for
+// other groups that do not specify one, matching the architecture of the group's image.
+func (s *clusterSpec) resolveInstanceTypes(config client.ConfigProvider) error {
+	errs := []string{}
+
+	s.mutateGroups(func(grp *instanceGroupSpec) {
+		if grp.InstanceRequirements != nil {
+			az, err := s.availabilityZone()
+			if err != nil {
+				errs = append(errs, err.Error())
+				return
+			}
+			ec2Client := ec2.New(s.cluster().getGroupAWSClient(config, *grp))
+			if err := applyInstanceRequirements(ec2Client, grp, az); err != nil {
+				errs = append(errs, fmt.Sprintf("In group %s: %s", grp.Name, err))
+			}
+			return
+		}
+
+		run := &grp.Config.RunInstancesInput
+		if run.InstanceType != nil || run.ImageId == nil {
+			return
+		}
+
+		architecture, err := imageArchitecture(ec2.New(s.cluster().getGroupAWSClient(config, *grp)), run.ImageId)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("In group %s: %s", grp.Name, err))
+			return
+		}
+
+		instanceType, known := defaultInstanceTypes[architecture]
+		if !known {
+			errs = append(errs, fmt.Sprintf(
+				"In group %s: no default instance type for architecture %s, InstanceType must be set",
+				grp.Name,
+				architecture))
+			return
+		}
+		run.InstanceType = aws.String(instanceType)
+	})
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// managerBackups configures snapshots of the data volumes of the managers.
+type managerBackups struct {
+	// Cron is when the volumes are snapshotted, as a cron expression of five fields.  Backups are taken by the boot
+	// leader.
+	Cron string
+
+	// Retain is the number of snapshots of each volume kept, defaulting to 7.
+	Retain int `json:",omitempty"`
+}
+
+func (b *managerBackups) validate() error {
+	if err := validateCron(b.Cron); err != nil {
+		return fmt.Errorf("Backups %s", err)
+	}
+	if b.Retain < 0 {
+		return errors.New("Backups Retain must not be negative")
+	}
+	return nil
+}
+
+// applyBackups restores the volume of a manager from its latest snapshot when the manager is replaced and its volume
+// no longer exists.
+func applyBackupsHook(s *clusterSpec, group *instanceGroupSpec) error {
+	if s.Backups != nil && group.isManager() {
+		group.Config.RestoreVolumes = true
+	}
+	return nil
+}
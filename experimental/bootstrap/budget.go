@@ -0,0 +1,141 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"sort"
+	"strings"
+)
+
+// clusterBudget limits the size and cost of a cluster, protecting against a runaway scale-up from a bad spec.  Limits
+// that are not set do not apply.
+type clusterBudget struct {
+	// MaxGroupSize is the maximum size of each group, including the sizes of its schedule.
+	MaxGroupSize int `json:",omitempty"`
+
+	// MaxVCpus is the maximum number of vCPUs of the instances of all groups.
+	MaxVCpus int64 `json:",omitempty"`
+
+	// MaxHourlyCost is the maximum estimated hourly cost of the instances of all groups, in USD, at on-demand prices.
+	MaxHourlyCost float64 `json:",omitempty"`
+}
+
+func (b *clusterBudget) validate() error {
+	if b.MaxGroupSize < 0 || b.MaxVCpus < 0 || b.MaxHourlyCost < 0 {
+		return errors.New("Budget limits must not be negative")
+	}
+	return nil
+}
+
+// peakSize is the largest size of a group, either its size or one of the sizes of its schedule.
+func (i instanceGroupSpec) peakSize() int {
+	size := i.Size
+	for _, entry := range i.Schedule {
+		if entry.Size > size {
+			size = entry.Size
+		}
+	}
+	return size
+}
+
+// checkBudget verifies that the groups of the cluster, at their peak sizes, are within the limits of its budget.  The
+// instance types of the groups must be resolved.  Groups launching one of several instance types are estimated with
+// the largest and most expensive of them, and spot instances at on-demand prices, so that the estimates are upper
+// bounds.
+func (s *clusterSpec) checkBudget(config client.ConfigProvider) error {
+	if s.Budget == nil {
+		return nil
+	}
+
+	errs := []string{}
+	for _, grp := range s.Groups {
+		if s.Budget.MaxGroupSize > 0 && grp.peakSize() > s.Budget.MaxGroupSize {
+			errs = append(errs, fmt.Sprintf("Group %s scales to %d instances, exceeding Budget.MaxGroupSize %d",
+				grp.Name, grp.peakSize(), s.Budget.MaxGroupSize))
+		}
+	}
+
+	if s.Budget.MaxVCpus > 0 || s.Budget.MaxHourlyCost > 0 {
+		if err := s.checkBudgetTotals(config); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (s *clusterSpec) checkBudgetTotals(config client.ConfigProvider) error {
+	seen := map[string]bool{}
+	instanceTypes := []string{}
+	for _, grp := range s.Groups {
+		for _, candidate := range launchCandidates(grp) {
+			instanceType := aws.StringValue(candidate.instanceType)
+			if instanceType == "" {
+				return fmt.Errorf("In group %s: InstanceType must be set to check the budget", grp.Name)
+			}
+			if !seen[instanceType] {
+				instanceTypes = append(instanceTypes, instanceType)
+			}
+			seen[instanceType] = true
+		}
+	}
+	sort.Strings(instanceTypes)
+
+	vCPUs := map[string]int64{}
+	if s.Budget.MaxVCpus > 0 {
+		var err error
+		if vCPUs, err = instanceTypeVCPUs(ec2.New(config), instanceTypes); err != nil {
+			return fmt.Errorf("Failed to describe instance types: %s", err)
+		}
+	}
+
+	prices := map[string]float64{}
+	if s.Budget.MaxHourlyCost > 0 {
+		pricing := newPricingClient(config)
+		for _, instanceType := range instanceTypes {
+			price, err := onDemandPrice(pricing, s.cluster().region, instanceType)
+			if err != nil {
+				return fmt.Errorf("Failed to look up the price of %s: %s", instanceType, err)
+			}
+			prices[instanceType] = price
+		}
+	}
+
+	totalVCPUs := int64(0)
+	totalCost := 0.0
+	for _, grp := range s.Groups {
+		groupVCPUs := int64(0)
+		groupPrice := 0.0
+		for _, candidate := range launchCandidates(grp) {
+			instanceType := aws.StringValue(candidate.instanceType)
+			if vCPUs[instanceType] > groupVCPUs {
+				groupVCPUs = vCPUs[instanceType]
+			}
+			if prices[instanceType] > groupPrice {
+				groupPrice = prices[instanceType]
+			}
+		}
+		totalVCPUs += groupVCPUs * int64(grp.peakSize())
+		totalCost += groupPrice * float64(grp.peakSize())
+	}
+
+	errs := []string{}
+	if s.Budget.MaxVCpus > 0 && totalVCPUs > s.Budget.MaxVCpus {
+		errs = append(errs, fmt.Sprintf("Groups require %d vCPUs, exceeding Budget.MaxVCpus %d",
+			totalVCPUs, s.Budget.MaxVCpus))
+	}
+	if s.Budget.MaxHourlyCost > 0 && totalCost > s.Budget.MaxHourlyCost {
+		errs = append(errs, fmt.Sprintf("Groups are estimated to cost $%.4f an hour, exceeding Budget.MaxHourlyCost "+
+			"$%.4f", totalCost, s.Budget.MaxHourlyCost))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -7,11 +7,15 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit.aws/plugin/migrate"
+	"github.com/docker/infrakit.aws/plugin/strict"
+	"github.com/docker/infrakit.aws/plugin/yaml"
 	"github.com/docker/infrakit/spi/group"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 // NewCLI creates a CLI.
@@ -23,14 +27,39 @@ func NewCLI() *CLI {
 type CLI struct {
 }
 
+// readSpecDocument reads a cluster spec file as JSON, upgraded to the current version of the schema.
+func readSpecDocument(clusterSpecFile string) ([]byte, error) {
+	specData, err := ioutil.ReadFile(clusterSpecFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config file: %s", err)
+	}
+
+	if !yaml.IsJSON(specData) {
+		specData, err = clusterSpecFromYAML(specData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	document := migrate.Document{}
+	err = json.Unmarshal(specData, &document)
+	if err != nil {
+		return nil, err
+	}
+	if err := upgradeClusterSpec(document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
 func readConfig(clusterSpecFile string) (clusterSpec, error) {
 	spec := clusterSpec{}
-	specData, err := ioutil.ReadFile(clusterSpecFile)
+	specData, err := readSpecDocument(clusterSpecFile)
 	if err != nil {
-		return spec, fmt.Errorf("Failed to read config file: %s", err)
+		return spec, err
 	}
 
-	err = json.Unmarshal(specData, &spec)
+	err = strict.Unmarshal(specData, &spec)
 	if err != nil {
 		return spec, err
 	}
@@ -40,8 +69,7 @@ func readConfig(clusterSpecFile string) (clusterSpec, error) {
 		return spec, err
 	}
 
-	spec.applyDefaults()
-
+	err = spec.applyDefaults()
 	return spec, err
 }
 
@@ -53,6 +81,7 @@ func (c *clusterIDFlags) flags() *pflag.FlagSet {
 	clusterIDFlags := pflag.NewFlagSet("cluster ID", pflag.ExitOnError)
 	clusterIDFlags.StringVar(&c.ID.region, "region", "", "AWS region")
 	clusterIDFlags.StringVar(&c.ID.name, "cluster", "", "Infrakit cluster name")
+	clusterIDFlags.StringVar(&c.ID.tagKey, "cluster-tag", clusterTag, "Tag name used to identify cluster resources")
 	return clusterIDFlags
 }
 
@@ -70,8 +99,12 @@ func (a *CLI) AddCommands(root *cobra.Command) {
 	cluster := clusterIDFlags{}
 
 	var keyName string
+	var instanceType string
 
 	workerSize := 3
+	outputsTo := outputsDestinations{}
+	overrideBudget := false
+	networkTimeout := defaultNetworkTimeout
 
 	createCmd := cobra.Command{
 		Use:   "create [<cluster config>]",
@@ -79,7 +112,7 @@ func (a *CLI) AddCommands(root *cobra.Command) {
 		Run: func(cmd *cobra.Command, args []string) {
 			spec := clusterSpec{}
 			if len(args) == 1 {
-				if keyName != "" || cluster.ID.name != "" || cluster.ID.region != "" {
+				if keyName != "" || instanceType != "" || cluster.ID.name != "" || cluster.ID.region != "" {
 					abort("No other cluster-related flags may be set when a spec file is used")
 				}
 
@@ -105,7 +138,11 @@ func (a *CLI) AddCommands(root *cobra.Command) {
 				}
 
 				spec = clusterSpec{
-					ClusterName: cluster.ID.name,
+					Version:             clusterSchema.Current(),
+					ClusterName:         cluster.ID.name,
+					ClusterTagKey:       cluster.ID.tagKey,
+					Region:              cluster.ID.region,
+					DefaultInstanceType: instanceType,
 					Groups: []instanceGroupSpec{
 						{
 							Name:   group.ID("Managers"),
@@ -124,21 +161,57 @@ func (a *CLI) AddCommands(root *cobra.Command) {
 
 				err := spec.validate()
 				if err != nil {
-					abort(err.Error())
+					abort("%s", err)
 				}
 
-				spec.applyDefaults()
+				if err := spec.applyDefaults(); err != nil {
+					abort("%s", err)
+				}
+			}
+
+			if err := outputsTo.validate(); err != nil {
+				abort("%s", err)
+			}
+
+			outputs, err := bootstrap(spec, networkTimeout, overrideBudget)
+			if err != nil {
+				abort("%s", err)
 			}
 
-			err := bootstrap(spec)
+			err = writeOutputs(spec.cluster().getAWSClient(), os.Stdout, outputs, outputsTo)
 			if err != nil {
-				abort(err.Error())
+				abort("%s", err)
 			}
 		},
 	}
 	createCmd.Flags().AddFlagSet(cluster.flags())
 	createCmd.Flags().StringVar(&keyName, "key", "", "The existing SSH key in AWS to use for provisioned instances")
+	createCmd.Flags().StringVar(
+		&instanceType,
+		"instance-type",
+		"",
+		"Instance type to use, defaulting to a type matching the image architecture")
 	createCmd.Flags().IntVar(&workerSize, "worker_size", workerSize, "Size of worker group")
+	createCmd.Flags().DurationVar(
+		&networkTimeout,
+		"network-timeout",
+		networkTimeout,
+		"How long to wait for subnets, security groups, NAT gateways, and VPC endpoints before provisioning instances")
+	createCmd.Flags().StringVar(
+		&outputsTo.S3URL,
+		"outputs-s3-url",
+		"",
+		"An s3://<bucket>/<key> URL to write the cluster outputs to, in addition to stdout")
+	createCmd.Flags().StringVar(
+		&outputsTo.SSMParameter,
+		"outputs-ssm-parameter",
+		"",
+		"The name of an SSM parameter to write the cluster outputs to, in addition to stdout")
+	createCmd.Flags().BoolVar(
+		&overrideBudget,
+		"override-budget",
+		false,
+		"Create the cluster even if its groups exceed the Budget of the spec")
 
 	root.AddCommand(&createCmd)
 
@@ -148,9 +221,11 @@ func (a *CLI) AddCommands(root *cobra.Command) {
 		Short: "destroy a swarm cluster",
 		Long: `destroy all resources associated with a cluster
 
-The cluster may be identified manually or based on the contents of a cluster spec file.`,
+The cluster may be identified manually or based on the contents of a cluster spec file.  The instances, volumes, and
+roles of groups with their own Credentials are only destroyed when the cluster is identified by its spec file.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			var id clusterID
+			var groups []instanceGroupSpec
 			if clusterSpec == "" {
 				if !cluster.valid() {
 					abort("Must specify --config or both of --region and --cluster")
@@ -163,11 +238,12 @@ The cluster may be identified manually or based on the contents of a cluster spe
 					abort("Invalid config file: %s", err)
 				}
 				id = spec.cluster()
+				groups = spec.Groups
 			}
 
-			err := destroy(id)
+			err := destroy(id, groups)
 			if err != nil {
-				abort(err.Error())
+				abort("%s", err)
 			}
 		},
 	}
@@ -175,11 +251,648 @@ The cluster may be identified manually or based on the contents of a cluster spe
 
 	destroyCmd.Flags().AddFlagSet(cluster.flags())
 	root.AddCommand(&destroyCmd)
+
+	var strict bool
+	reconcileCmd := cobra.Command{
+		Use:   "reconcile-security-groups",
+		Short: "reconcile the rules of a swarm cluster's security groups",
+		Long: `authorize the rules missing from the security groups created for a cluster
+
+Rules added out of band are kept, unless --strict is set, in which case they are revoked.  The cluster may be
+identified manually or based on the contents of a cluster spec file.  Clusters with SSMAccess must be identified by
+their spec file, since their managers do not allow SSH.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var id clusterID
+			ssh := true
+			if clusterSpec == "" {
+				if !cluster.valid() {
+					abort("Must specify --config or both of --region and --cluster")
+				}
+
+				id = cluster.ID
+			} else {
+				spec, err := readConfig(clusterSpec)
+				if err != nil {
+					abort("Invalid config file: %s", err)
+				}
+				id = spec.cluster()
+				ssh = spec.SSMAccess == nil
+			}
+
+			err := reconcileSecurityGroups(id.getAWSClient(), id, strict, ssh)
+			if err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	reconcileCmd.Flags().StringVar(&clusterSpec, "config", "", "A cluster spec file")
+	reconcileCmd.Flags().BoolVar(&strict, "strict", false, "Revoke rules that are not managed by the cluster")
+	reconcileCmd.Flags().AddFlagSet(cluster.flags())
+	root.AddCommand(&reconcileCmd)
+
+	var strictRoutes bool
+	reconcileNetworkCmd := cobra.Command{
+		Use:   "reconcile-network <cluster config>",
+		Short: "reconcile the routes and network ACL of a swarm cluster's network",
+		Long: `apply the Routes and NetworkACL of a cluster spec to the network created for the cluster
+
+Missing routes are created and routes through another target are replaced.  Routes to peering connections, transit
+gateways, and VPN gateways that are not declared are kept, unless --strict is set, in which case they are deleted.
+The rules of the network ACL always match the spec, and the network ACL is removed once it is no longer declared.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				cmd.Usage()
+				return
+			}
+
+			spec, err := readConfig(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+			if spec.usesExistingSubnets() {
+				abort("Groups use existing subnets, whose network is not managed by the cluster")
+			}
+
+			if err := reconcileNetwork(spec.cluster().getAWSClient(), &spec, strictRoutes); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	reconcileNetworkCmd.Flags().BoolVar(&strictRoutes, "strict", false, "Delete routes that are not declared")
+	root.AddCommand(&reconcileNetworkCmd)
+
+	costCmd := cobra.Command{
+		Use:   "cost <cluster config>",
+		Short: "estimate the cost of a swarm cluster",
+		Long: `estimate the hourly and monthly cost of each group of a cluster spec, without creating any resources
+
+On-demand prices are looked up with the AWS Price List API, and spot prices are the current spot prices in the
+availability zone of the cluster.  Prices are for Linux instances in USD, excluding storage and data transfer.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				cmd.Usage()
+				return
+			}
+
+			spec, err := readConfig(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+
+			costs, err := estimateCost(spec.cluster().getAWSClient(), spec)
+			if err != nil {
+				abort("%s", err)
+			}
+			if err := printCost(os.Stdout, costs); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	root.AddCommand(&costCmd)
+
+	exportCmd := cobra.Command{
+		Use:   "export-terraform",
+		Short: "export the resources of a swarm cluster as Terraform import blocks",
+		Long: `print Terraform import blocks for the resources of a cluster
+
+The instances, volumes, network, security groups, IAM resources, shared storage, load balancer, and log group of the
+cluster are included.  Running terraform plan -generate-config-out with the import blocks generates their
+configuration.  The cluster may be identified manually or based on the contents of a cluster spec file.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var id clusterID
+			if clusterSpec == "" {
+				if !cluster.valid() {
+					abort("Must specify --config or both of --region and --cluster")
+				}
+
+				id = cluster.ID
+			} else {
+				spec, err := readConfig(clusterSpec)
+				if err != nil {
+					abort("Invalid config file: %s", err)
+				}
+				id = spec.cluster()
+			}
+
+			resources, err := terraformResources(id.getAWSClient(), id)
+			if err != nil {
+				abort("%s", err)
+			}
+			if err := printTerraformImports(os.Stdout, resources); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	exportCmd.Flags().StringVar(&clusterSpec, "config", "", "A cluster spec file")
+	exportCmd.Flags().AddFlagSet(cluster.flags())
+	root.AddCommand(&exportCmd)
+
+	importCmd := cobra.Command{
+		Use:   "import-terraform <plan JSON>",
+		Short: "translate the instances of a Terraform plan to instance plugin properties",
+		Long: `print the instance plugin properties of each aws_instance resource of a Terraform plan
+
+The plan is the JSON written by terraform show -json.  User data is not translated, since Terraform only records a
+hash of it.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				cmd.Usage()
+				return
+			}
+
+			planJSON, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				abort("Failed to read plan: %s", err)
+			}
+			requests, err := instancesFromTerraformPlan(planJSON)
+			if err != nil {
+				abort("%s", err)
+			}
+			if err := printInstanceRequests(os.Stdout, requests); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	root.AddCommand(&importCmd)
+
+	copyOptions := imageCopyOptions{}
+	var copiedSpecFile string
+	var copyMappingFile string
+	copyImagesCmd := cobra.Command{
+		Use:   "copy-images <cluster config>",
+		Short: "copy the images of a swarm cluster to another region",
+		Long: `copy the images launched by the groups of a cluster spec to another region, and print the spec with the
+copies in place of the images
+
+Copies are tagged with their source image, and reused when images are copied again.  --kms-key-id re-encrypts the
+snapshots of the copies with a key of the target region.  --mapping merges the copies into an import mapping file,
+for importing an exported cluster into the region.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 || copyOptions.Region == "" {
+				cmd.Usage()
+				return
+			}
+
+			spec, err := readConfig(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+
+			copies, err := copyImages(spec.cluster().getAWSClient(), spec, copyOptions)
+			if err != nil {
+				abort("%s", err)
+			}
+
+			if copyMappingFile != "" {
+				mapping := importMapping{}
+				if _, err := os.Stat(copyMappingFile); err == nil {
+					if mapping, err = readMapping(copyMappingFile); err != nil {
+						abort("%s", err)
+					}
+				}
+				data, err := json.MarshalIndent(imageMapping(mapping, copyOptions.Region, copies), "", "  ")
+				if err != nil {
+					abort("%s", err)
+				}
+				if err := ioutil.WriteFile(copyMappingFile, append(data, '\n'), 0644); err != nil {
+					abort("Failed to write mapping file: %s", err)
+				}
+			}
+
+			spec.rewriteImages(copies)
+			out := os.Stdout
+			if copiedSpecFile != "" {
+				if out, err = os.Create(copiedSpecFile); err != nil {
+					abort("Failed to create spec file: %s", err)
+				}
+				defer out.Close()
+			}
+			if err := printClusterSpec(out, spec); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	copyImagesCmd.Flags().StringVar(&copyOptions.Region, "region", "", "The region to copy the images to")
+	copyImagesCmd.Flags().BoolVar(&copyOptions.Encrypted, "encrypted", false, "Encrypt the snapshots of the copies")
+	copyImagesCmd.Flags().StringVar(&copyOptions.KMSKeyID, "kms-key-id", "", "The KMS key encrypting the copies")
+	copyImagesCmd.Flags().StringVar(&copiedSpecFile, "output", "", "The cluster spec file to write, instead of stdout")
+	copyImagesCmd.Flags().StringVar(&copyMappingFile, "mapping", "", "An import mapping file to merge the copies into")
+	root.AddCommand(&copyImagesCmd)
+
+	var refreshedSpecFile string
+	var updateGroups bool
+	updateTimeout := defaultUpdateTimeout
+	refreshImagesCmd := cobra.Command{
+		Use:   "refresh-images <cluster config>",
+		Short: "update the images of a swarm cluster's groups to the current images of their channels",
+		Long: `resolve the current image of the channel of each group with an ImageChannel, and print the spec with the
+images of the groups updated
+
+Changed images are logged.  --update also commits the changed images to the group specs in the state bucket of the
+cluster, and updates the groups on a running manager with Run Command, replacing their instances in a rolling update.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				cmd.Usage()
+				return
+			}
+
+			spec, err := readConfig(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+
+			config := spec.cluster().getAWSClient()
+			refreshed, err := spec.resolveImageChannels(config, true)
+			if err != nil {
+				abort("%s", err)
+			}
+			if len(refreshed) == 0 {
+				log.Infof("The images of all groups are current")
+			}
+
+			out := os.Stdout
+			if refreshedSpecFile != "" {
+				if out, err = os.Create(refreshedSpecFile); err != nil {
+					abort("Failed to create spec file: %s", err)
+				}
+				defer out.Close()
+			}
+			if err := printClusterSpec(out, spec); err != nil {
+				abort("%s", err)
+			}
+
+			if updateGroups {
+				if err := rollOutImages(config, spec, refreshed, updateTimeout); err != nil {
+					abort("%s", err)
+				}
+			}
+		},
+	}
+	refreshImagesCmd.Flags().StringVar(
+		&refreshedSpecFile, "output", "", "The cluster spec file to write, instead of stdout")
+	refreshImagesCmd.Flags().BoolVar(&updateGroups, "update", false, "Roll out the changed images to the cluster")
+	refreshImagesCmd.Flags().DurationVar(
+		&updateTimeout, "update-timeout", defaultUpdateTimeout, "The maximum time to wait for the groups to update")
+	root.AddCommand(&refreshImagesCmd)
+
+	var deleteOrphaned bool
+	var orphanGracePeriod time.Duration
+	gcCmd := cobra.Command{
+		Use:   "gc <cluster config>",
+		Short: "find resources of a swarm cluster that are no longer used",
+		Long: `report the resources tagged with a cluster that are not used by any of its groups
+
+Detached network interfaces, unattached volumes, Elastic IP addresses that are not associated, and spot requests
+without a live instance are reported.  The volumes and static network interfaces of manager IPs are kept, as are the
+network interfaces of pending and running instances and volumes created within --grace-period, which a provision in
+progress may attach.  With --delete, the reported resources are deleted.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				cmd.Usage()
+				return
+			}
+
+			spec, err := readConfig(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+
+			config := spec.cluster().getAWSClient()
+			groups, err := committedGroups(config, spec)
+			if err != nil {
+				abort("%s", err)
+			}
+			orphans, err := findOrphans(config, spec, groups, orphanGracePeriod)
+			if err != nil {
+				abort("%s", err)
+			}
+			if err := printOrphans(os.Stdout, orphans); err != nil {
+				abort("%s", err)
+			}
+			if deleteOrphaned {
+				if err := deleteOrphans(config, orphans); err != nil {
+					abort("%s", err)
+				}
+			}
+		},
+	}
+	gcCmd.Flags().BoolVar(&deleteOrphaned, "delete", false, "Delete the resources that are no longer used")
+	gcCmd.Flags().DurationVar(&orphanGracePeriod, "grace-period", 15*time.Minute,
+		"Age below which unattached volumes are kept for the provisions attaching them")
+	root.AddCommand(&gcCmd)
+
+	key := sshKeyRequest{User: defaultSSHUser, Expiry: defaultKeyExpiry}
+	var publicKeyFile, keyGroup, keyInstance string
+	sshKeyCmd := cobra.Command{
+		Use:   "ssh-key <cluster config>",
+		Short: "grant an operator temporary SSH access to instances of a swarm cluster",
+		Long: `grant temporary SSH access to the running instances of a cluster with a public key of an operator
+
+The key is pushed with EC2 Instance Connect, and may be used to connect for the next minute.  Clusters with SSMAccess
+authorize the key with Run Command instead, until it expires, for use over Session Manager.  Every instance of the
+cluster is granted access, unless --group or --instance is set.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 || publicKeyFile == "" {
+				cmd.Usage()
+				return
+			}
+
+			spec, err := readConfig(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+			publicKey, err := ioutil.ReadFile(publicKeyFile)
+			if err != nil {
+				abort("Failed to read public key: %s", err)
+			}
+			key.PublicKey = string(publicKey)
+			if err := key.validate(); err != nil {
+				abort("%s", err)
+			}
+
+			config := spec.cluster().getAWSClient()
+			targets, err := accessTargets(config, spec.cluster(), keyGroup, keyInstance)
+			if err != nil {
+				abort("%s", err)
+			}
+			if spec.SSMAccess != nil {
+				err = authorizeSSHKey(config, *spec.SSMAccess, key, targets)
+			} else {
+				err = pushSSHKey(config, key, targets)
+			}
+			if err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	sshKeyCmd.Flags().StringVar(&publicKeyFile, "public-key", "", "The OpenSSH public key file of the operator")
+	sshKeyCmd.Flags().StringVar(&key.User, "user", key.User, "The user of the instances to log in as")
+	sshKeyCmd.Flags().StringVar(&keyGroup, "group", "", "Grant access to the instances of a group")
+	sshKeyCmd.Flags().StringVar(&keyInstance, "instance", "", "Grant access to an instance")
+	sshKeyCmd.Flags().DurationVar(
+		&key.Expiry, "expires", key.Expiry, "The time keys authorized with Run Command remain authorized, or 0 to keep them")
+	root.AddCommand(&sshKeyCmd)
+
+	clustersCmd := cobra.Command{
+		Use:   "clusters",
+		Short: "list and inspect swarm clusters",
+	}
+
+	listCmd := cobra.Command{
+		Use:   "list",
+		Short: "list the clusters of a region",
+		Long: `list the clusters of a region, discovered by the cluster tag of their EC2 resources
+
+The number of tagged resources of each cluster is printed by resource type.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if cluster.ID.region == "" {
+				abort("Must specify --region")
+			}
+
+			clusters, err := listClusters(cluster.ID.getAWSClient(), cluster.ID.clusterTagKey())
+			if err != nil {
+				abort("%s", err)
+			}
+			if err := printClusters(os.Stdout, clusters); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	listCmd.Flags().AddFlagSet(cluster.flags())
+	clustersCmd.AddCommand(&listCmd)
+
+	describeCmd := cobra.Command{
+		Use:   "describe <cluster>",
+		Short: "describe the resources of a cluster",
+		Long: `print an inventory of the resources of a cluster as JSON
+
+Instances are listed by group, along with the network, IAM roles, volumes, shared storage, load balancer, and log
+group of the cluster.  The cluster may be named as an argument or based on the contents of a cluster spec file.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var id clusterID
+			switch {
+			case clusterSpec != "":
+				spec, err := readConfig(clusterSpec)
+				if err != nil {
+					abort("Invalid config file: %s", err)
+				}
+				id = spec.cluster()
+			case len(args) == 1:
+				id = cluster.ID
+				id.name = args[0]
+				if id.region == "" {
+					abort("Must specify --region")
+				}
+			default:
+				cmd.Usage()
+				return
+			}
+
+			inventory, err := describeCluster(id.getAWSClient(), id)
+			if err != nil {
+				abort("%s", err)
+			}
+			if err := printClusterInventory(os.Stdout, inventory); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	describeCmd.Flags().StringVar(&clusterSpec, "config", "", "A cluster spec file")
+	describeCmd.Flags().AddFlagSet(cluster.flags())
+	clustersCmd.AddCommand(&describeCmd)
+
+	var snapshotFile string
+	snapshotCmd := cobra.Command{
+		Use:   "snapshot <cluster>",
+		Short: "snapshot the resources of a cluster to a JSON inventory",
+		Long: `record every resource of a cluster, along with the tags of its EC2 resources, for comparison with the
+diff command
+
+The cluster may be named as an argument or based on the contents of a cluster spec file.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var id clusterID
+			switch {
+			case clusterSpec != "":
+				spec, err := readConfig(clusterSpec)
+				if err != nil {
+					abort("Invalid config file: %s", err)
+				}
+				id = spec.cluster()
+			case len(args) == 1:
+				id = cluster.ID
+				id.name = args[0]
+				if id.region == "" {
+					abort("Must specify --region")
+				}
+			default:
+				cmd.Usage()
+				return
+			}
+
+			snapshot, err := snapshotCluster(id.getAWSClient(), id)
+			if err != nil {
+				abort("%s", err)
+			}
+
+			out := os.Stdout
+			if snapshotFile != "" {
+				if out, err = os.Create(snapshotFile); err != nil {
+					abort("Failed to create snapshot file: %s", err)
+				}
+				defer out.Close()
+			}
+			if err := writeSnapshot(out, snapshot); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	snapshotCmd.Flags().StringVar(&clusterSpec, "config", "", "A cluster spec file")
+	snapshotCmd.Flags().StringVar(&snapshotFile, "output", "", "The snapshot file to write, instead of stdout")
+	snapshotCmd.Flags().AddFlagSet(cluster.flags())
+	clustersCmd.AddCommand(&snapshotCmd)
+
+	var onlyUnexpected bool
+	diffCmd := cobra.Command{
+		Use:   "diff <snapshot> [<snapshot>]",
+		Short: "compare snapshots of the resources of a cluster",
+		Long: `print the resources added, removed, and retagged between two snapshots of a cluster, or between a
+snapshot and the resources of the cluster now
+
+Changes of resources that are not managed by a group plugin, which are only created and destroyed along with the
+cluster, are unexpected and marked with an exclamation mark.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 && len(args) != 2 {
+				cmd.Usage()
+				return
+			}
+
+			before, err := readSnapshot(args[0])
+			if err != nil {
+				abort("%s", err)
+			}
+			var after inventorySnapshot
+			if len(args) == 2 {
+				after, err = readSnapshot(args[1])
+			} else {
+				id := before.snapshotClusterID()
+				after, err = snapshotCluster(id.getAWSClient(), id)
+			}
+			if err != nil {
+				abort("%s", err)
+			}
+
+			changes := diffSnapshots(before, after)
+			if err := printChanges(os.Stdout, changes, onlyUnexpected); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	diffCmd.Flags().BoolVar(&onlyUnexpected, "unexpected", false, "Only print unexpected changes")
+	clustersCmd.AddCommand(&diffCmd)
+
+	var archiveFile string
+	archiveCmd := cobra.Command{
+		Use:   "export <cluster config>",
+		Short: "export the definition and state of a cluster to an archive",
+		Long: `write the cluster spec, the committed group specs, and an inventory of the resources of a cluster to a
+gzipped tar archive
+
+The archive records the slots and logical IDs of instances, along with the IDs of their resources, so that a cluster
+lost to a regional outage or account compromise can be recreated with the import command.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 || archiveFile == "" {
+				cmd.Usage()
+				return
+			}
+
+			specDocument, err := readSpecDocument(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+			spec, err := readConfig(args[0])
+			if err != nil {
+				abort("Invalid config file: %s", err)
+			}
+
+			archive, err := exportCluster(spec.cluster().getAWSClient(), spec, specDocument)
+			if err != nil {
+				abort("%s", err)
+			}
+			out, err := os.Create(archiveFile)
+			if err != nil {
+				abort("Failed to create archive: %s", err)
+			}
+			defer out.Close()
+			if err := writeArchive(out, archive); err != nil {
+				abort("Failed to write archive: %s", err)
+			}
+			log.Infof("Exported cluster %s to %s", spec.ClusterName, archiveFile)
+		},
+	}
+	archiveCmd.Flags().StringVar(&archiveFile, "output", "", "The archive file to write")
+	clustersCmd.AddCommand(&archiveCmd)
+
+	var mappingFile string
+	var importedSpecFile string
+	restoreCmd := cobra.Command{
+		Use:   "import <archive>",
+		Short: "translate an exported cluster to a cluster spec for another region or account",
+		Long: `print a cluster spec recreating an exported cluster, for use with the create command
+
+The sizes, images, and instance types of the committed group specs in the archive replace those of the exported
+spec.  The mapping file translates availability zones, images, and subnets to those of the new region, and may rename
+the cluster and its state bucket.  Every zone, image, and subnet of the spec must be mapped when the region changes.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				cmd.Usage()
+				return
+			}
+
+			mapping := importMapping{}
+			if mappingFile != "" {
+				var err error
+				if mapping, err = readMapping(mappingFile); err != nil {
+					abort("%s", err)
+				}
+			}
+
+			in, err := os.Open(args[0])
+			if err != nil {
+				abort("Failed to open archive: %s", err)
+			}
+			defer in.Close()
+			archive, err := readArchive(in)
+			if err != nil {
+				abort("%s", err)
+			}
+
+			spec, err := importCluster(archive, mapping)
+			if err != nil {
+				abort("%s", err)
+			}
+
+			out := os.Stdout
+			if importedSpecFile != "" {
+				if out, err = os.Create(importedSpecFile); err != nil {
+					abort("Failed to create spec file: %s", err)
+				}
+				defer out.Close()
+			}
+			if err := printClusterSpec(out, spec); err != nil {
+				abort("%s", err)
+			}
+		},
+	}
+	restoreCmd.Flags().StringVar(&mappingFile, "mapping", "", "A file mapping resources to the new region or account")
+	restoreCmd.Flags().StringVar(&importedSpecFile, "output", "", "The cluster spec file to write, instead of stdout")
+	clustersCmd.AddCommand(&restoreCmd)
+
+	root.AddCommand(&clustersCmd)
 }
 
 type logger struct {
 }
 
 func (l logger) Log(args ...interface{}) {
-	log.Println(args)
+	log.Println(args...)
 }
@@ -0,0 +1,311 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// clusterSummary is a cluster discovered by the tags of its EC2 resources.
+type clusterSummary struct {
+	name string
+
+	// resources counts the tagged resources of the cluster, by resource type.
+	resources map[string]int
+}
+
+// listClusters discovers the clusters of a region from the cluster tag of EC2 resources.
+func listClusters(config client.ConfigProvider, tagKey string) ([]clusterSummary, error) {
+	clusters := map[string]clusterSummary{}
+	err := ec2.New(config).DescribeTagsPages(
+		&ec2.DescribeTagsInput{Filters: []*ec2.Filter{
+			{Name: aws.String("key"), Values: []*string{aws.String(tagKey)}},
+		}},
+		func(page *ec2.DescribeTagsOutput, last bool) bool {
+			for _, tag := range page.Tags {
+				name := aws.StringValue(tag.Value)
+				summary, has := clusters[name]
+				if !has {
+					summary = clusterSummary{name: name, resources: map[string]int{}}
+					clusters[name] = summary
+				}
+				summary.resources[aws.StringValue(tag.ResourceType)]++
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up cluster tags: %s", err)
+	}
+
+	names := []string{}
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summaries := []clusterSummary{}
+	for _, name := range names {
+		summaries = append(summaries, clusters[name])
+	}
+	return summaries, nil
+}
+
+func printClusters(out io.Writer, clusters []clusterSummary) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tINSTANCES\tVOLUMES\tRESOURCES")
+	for _, cluster := range clusters {
+		resourceTypes := []string{}
+		total := 0
+		for resourceType, count := range cluster.resources {
+			resourceTypes = append(resourceTypes, resourceType)
+			total += count
+		}
+		sort.Strings(resourceTypes)
+
+		counts := []string{}
+		for _, resourceType := range resourceTypes {
+			counts = append(counts, fmt.Sprintf("%s=%d", resourceType, cluster.resources[resourceType]))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d (%s)\n",
+			cluster.name,
+			cluster.resources[ec2.ResourceTypeInstance],
+			cluster.resources[ec2.ResourceTypeVolume],
+			total,
+			strings.Join(counts, ", "))
+	}
+	return w.Flush()
+}
+
+// clusterInventory is the resources of a cluster, organized by their role in the cluster.
+type clusterInventory struct {
+	Cluster string
+	Region  string
+	Groups  map[string][]inventoryInstance
+	Network *inventoryNetwork `json:",omitempty"`
+	IAM     []inventoryIAMRole
+
+	Volumes       []string `json:",omitempty"`
+	FileSystems   []string `json:",omitempty"`
+	LoadBalancers []string `json:",omitempty"`
+	LogGroups     []string `json:",omitempty"`
+}
+
+type inventoryInstance struct {
+	InstanceID       string
+	State            string
+	InstanceType     string
+	AvailabilityZone string
+	PrivateIP        string `json:",omitempty"`
+	PublicIP         string `json:",omitempty"`
+	LogicalID        string `json:",omitempty"`
+	Slot             string `json:",omitempty"`
+}
+
+type inventoryNetwork struct {
+	VpcID string
+
+	// Created is set when the VPC was created for the cluster, rather than being an existing VPC.
+	Created        bool
+	Subnets        []string
+	SecurityGroups []string
+	RouteTables    []string `json:",omitempty"`
+	NATGateways    []string `json:",omitempty"`
+	VpcEndpoints   []string `json:",omitempty"`
+}
+
+type inventoryIAMRole struct {
+	Role            string
+	InstanceProfile string `json:",omitempty"`
+	Policy          string `json:",omitempty"`
+}
+
+// describeCluster looks up the resources of a cluster.  Instances are grouped by their group tag, with instances that
+// are not in a group listed under an empty group name.
+func describeCluster(config client.ConfigProvider, cluster clusterID) (clusterInventory, error) {
+	ec2Client := ec2.New(config)
+	inventory := clusterInventory{
+		Cluster: cluster.name,
+		Region:  cluster.region,
+		Groups:  map[string][]inventoryInstance{},
+		IAM:     []inventoryIAMRole{},
+	}
+
+	err := ec2Client.DescribeInstancesPages(
+		&ec2.DescribeInstancesInput{Filters: []*ec2.Filter{
+			cluster.clusterFilter(),
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"}),
+			},
+		}},
+		func(page *ec2.DescribeInstancesOutput, last bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, ec2Instance := range reservation.Instances {
+					groupName := tagValue(ec2Instance.Tags, instance.GroupTag)
+					inventory.Groups[groupName] = append(inventory.Groups[groupName], inventoryInstance{
+						InstanceID:       *ec2Instance.InstanceId,
+						State:            aws.StringValue(ec2Instance.State.Name),
+						InstanceType:     aws.StringValue(ec2Instance.InstanceType),
+						AvailabilityZone: aws.StringValue(ec2Instance.Placement.AvailabilityZone),
+						PrivateIP:        aws.StringValue(ec2Instance.PrivateIpAddress),
+						PublicIP:         aws.StringValue(ec2Instance.PublicIpAddress),
+						LogicalID:        tagValue(ec2Instance.Tags, instance.LogicalIDTag),
+						Slot:             tagValue(ec2Instance.Tags, instance.SlotTag),
+					})
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return inventory, fmt.Errorf("Failed to look up instances: %s", err)
+	}
+
+	vpcID, network, err := findClusterVpc(ec2Client, cluster)
+	if err == nil {
+		inventory.Network, err = describeClusterNetwork(ec2Client, cluster, vpcID, network)
+		if err != nil {
+			return inventory, err
+		}
+	}
+
+	volumes, err := ec2Client.DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{cluster.clusterFilter()},
+	})
+	if err != nil {
+		return inventory, fmt.Errorf("Failed to look up volumes: %s", err)
+	}
+	for _, volume := range volumes.Volumes {
+		inventory.Volumes = append(inventory.Volumes, *volume.VolumeId)
+	}
+
+	iamClient := iam.New(config)
+	roles := []inventoryIAMRole{
+		{cluster.roleName(), cluster.instanceProfileName(), cluster.managerPolicyName()},
+		{cluster.workerRoleName(), cluster.workerInstanceProfileName(), cluster.workerPolicyName()},
+	}
+	for _, role := range roles {
+		if _, err := iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(role.Role)}); err != nil {
+			continue
+		}
+		_, err := iamClient.GetInstanceProfile(
+			&iam.GetInstanceProfileInput{InstanceProfileName: aws.String(role.InstanceProfile)})
+		if err != nil {
+			role.InstanceProfile = ""
+		}
+		inventory.IAM = append(inventory.IAM, role)
+	}
+
+	fileSystems, err := efs.New(config).DescribeFileSystems(&efs.DescribeFileSystemsInput{
+		CreationToken: aws.String(cluster.fileSystemToken()),
+	})
+	if err == nil {
+		for _, fileSystem := range fileSystems.FileSystems {
+			inventory.FileSystems = append(inventory.FileSystems, *fileSystem.FileSystemId)
+		}
+	}
+
+	loadBalancers, err := elbv2.New(config).DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
+		Names: []*string{aws.String(cluster.managerLoadBalancerName())},
+	})
+	if err == nil {
+		for _, loadBalancer := range loadBalancers.LoadBalancers {
+			inventory.LoadBalancers = append(inventory.LoadBalancers, aws.StringValue(loadBalancer.DNSName))
+		}
+	}
+
+	logGroups, err := cloudwatchlogs.New(config).DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(cluster.logGroupName()),
+	})
+	if err == nil {
+		for _, logGroup := range logGroups.LogGroups {
+			if *logGroup.LogGroupName == cluster.logGroupName() {
+				inventory.LogGroups = append(inventory.LogGroups, *logGroup.LogGroupName)
+			}
+		}
+	}
+
+	return inventory, nil
+}
+
+func describeClusterNetwork(
+	ec2Client *ec2.EC2,
+	cluster clusterID,
+	vpcID string,
+	network clusterNetwork) (*inventoryNetwork, error) {
+
+	inventory := inventoryNetwork{VpcID: vpcID, Created: network == createdNetwork}
+
+	subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up subnets: %s", err)
+	}
+	for _, subnet := range subnets.Subnets {
+		inventory.Subnets = append(inventory.Subnets,
+			fmt.Sprintf("%s (%s, %s)", *subnet.SubnetId, *subnet.AvailabilityZone, *subnet.CidrBlock))
+	}
+
+	securityGroups, err := ec2Client.DescribeSecurityGroups(
+		&ec2.DescribeSecurityGroupsInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up security groups: %s", err)
+	}
+	for _, securityGroup := range securityGroups.SecurityGroups {
+		inventory.SecurityGroups = append(inventory.SecurityGroups,
+			fmt.Sprintf("%s (%s)", *securityGroup.GroupId, aws.StringValue(securityGroup.GroupName)))
+	}
+
+	if !inventory.Created {
+		return &inventory, nil
+	}
+
+	routeTables, err := ec2Client.DescribeRouteTables(
+		&ec2.DescribeRouteTablesInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up route tables: %s", err)
+	}
+	for _, routeTable := range routeTables.RouteTables {
+		inventory.RouteTables = append(inventory.RouteTables, *routeTable.RouteTableId)
+	}
+
+	gateways, err := ec2Client.DescribeNatGateways(
+		&ec2.DescribeNatGatewaysInput{Filter: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up NAT gateways: %s", err)
+	}
+	for _, gateway := range gateways.NatGateways {
+		if aws.StringValue(gateway.State) != ec2.NatGatewayStateDeleted {
+			inventory.NATGateways = append(inventory.NATGateways, *gateway.NatGatewayId)
+		}
+	}
+
+	endpoints, err := describeVpcEndpoints(ec2Client, cluster.resourceFilter(vpcID))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up VPC endpoints: %s", err)
+	}
+	for _, endpoint := range endpoints {
+		inventory.VpcEndpoints = append(inventory.VpcEndpoints,
+			fmt.Sprintf("%s (%s)", *endpoint.VpcEndpointId, aws.StringValue(endpoint.ServiceName)))
+	}
+
+	return &inventory, nil
+}
+
+func printClusterInventory(out io.Writer, inventory clusterInventory) error {
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
@@ -0,0 +1,567 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// peerRegionTag records the region of the peer VPC of a peering connection, which the vendored SDK does not
+	// describe, so that the routes of the peer VPC are deleted along with the connection.
+	peerRegionTag = "infrakit.peer-region"
+
+	// connectionPolls is how many times connections are checked, five seconds apart, for their state to change.
+	connectionPolls = 60
+)
+
+// transitGatewayAttachment attaches the VPC of a cluster to an existing transit gateway.
+type transitGatewayAttachment struct {
+	TransitGatewayID string `json:"TransitGatewayId"`
+
+	// DestinationCidrBlocks are routed through the transit gateway from the route tables of the cluster.
+	DestinationCidrBlocks []string `json:",omitempty"`
+
+	// RouteTables is public, private, or all (the default).
+	RouteTables string `json:",omitempty"`
+
+	// AssociationRouteTableID is the route table of the transit gateway that routes the traffic of the VPC, in place
+	// of the default route table of the transit gateway.
+	AssociationRouteTableID string `json:"AssociationRouteTableId,omitempty"`
+
+	// PropagationRouteTableIDs are route tables of the transit gateway that the CIDR block of the VPC is propagated
+	// to, so that the networks using them reach the cluster.
+	PropagationRouteTableIDs []string `json:"PropagationRouteTableIds,omitempty"`
+}
+
+// vpcPeering is a peering connection between the VPC of a cluster and another VPC.
+type vpcPeering struct {
+	PeerVpcID string `json:"PeerVpcId"`
+
+	// PeerOwnerID is the account of the peer VPC, if it is not the account of the cluster.  Connections with VPCs
+	// of other accounts must be accepted by their owners.
+	PeerOwnerID string `json:"PeerOwnerId,omitempty"`
+
+	// PeerRegion is the region of the peer VPC, if it is not the region of the cluster.
+	PeerRegion string `json:",omitempty"`
+
+	// PeerCidrBlocks are routed through the connection from the route tables of the cluster.
+	PeerCidrBlocks []string
+
+	// RouteTables is public, private, or all (the default).
+	RouteTables string `json:",omitempty"`
+
+	// PeerRouteTableIDs are route tables of the peer VPC that route the CIDR block of the cluster's VPC through the
+	// connection.  They may only be set for VPCs of the same account.
+	PeerRouteTableIDs []string `json:"PeerRouteTableIds,omitempty"`
+}
+
+func (p vpcPeering) sameAccount() bool {
+	return p.PeerOwnerID == ""
+}
+
+// connectionRoutes are the routes through the transit gateway and peering connections of a cluster.  Peering
+// connections are identified by the ID of their peer VPC until they are established.
+func (s *clusterSpec) connectionRoutes(peeringConnections map[string]string) []networkRoute {
+	routes := []networkRoute{}
+	if s.TransitGateway != nil {
+		for _, cidr := range s.TransitGateway.DestinationCidrBlocks {
+			routes = append(routes, networkRoute{
+				DestinationCidrBlock: cidr,
+				RouteTables:          s.TransitGateway.RouteTables,
+				TransitGatewayID:     s.TransitGateway.TransitGatewayID,
+			})
+		}
+	}
+	for _, peering := range s.Peering {
+		connectionID, established := peeringConnections[peering.PeerVpcID]
+		if !established {
+			if peeringConnections != nil {
+				continue
+			}
+			connectionID = peering.PeerVpcID
+		}
+		for _, cidr := range peering.PeerCidrBlocks {
+			routes = append(routes, networkRoute{
+				DestinationCidrBlock:   cidr,
+				RouteTables:            peering.RouteTables,
+				VpcPeeringConnectionID: connectionID,
+			})
+		}
+	}
+	return routes
+}
+
+func (s *clusterSpec) validateConnections() error {
+	errs := []string{}
+	if s.TransitGateway != nil && s.TransitGateway.TransitGatewayID == "" {
+		errs = append(errs, "TransitGateway.TransitGatewayId must be set")
+	}
+	peers := map[string]bool{}
+	for _, peering := range s.Peering {
+		if peering.PeerVpcID == "" {
+			errs = append(errs, "Peering.PeerVpcId must be set")
+		}
+		if peers[peering.PeerVpcID] {
+			errs = append(errs, fmt.Sprintf("Peering may not have the same PeerVpcId %s", peering.PeerVpcID))
+		}
+		peers[peering.PeerVpcID] = true
+		if len(peering.PeerCidrBlocks) == 0 {
+			errs = append(errs, fmt.Sprintf("Peering with %s must have PeerCidrBlocks", peering.PeerVpcID))
+		}
+		if !peering.sameAccount() && len(peering.PeerRouteTableIDs) > 0 {
+			errs = append(errs, fmt.Sprintf("Peering with %s may not set PeerRouteTableIds of another account",
+				peering.PeerVpcID))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// connectNetworks attaches the VPC of a cluster to its transit gateway and establishes its peering connections, if
+// they do not exist yet.  It returns the routes through the connections that are ready to route traffic: connections
+// awaiting acceptance by another account are routed once they are accepted and the network is reconciled.
+func connectNetworks(config client.ConfigProvider, spec *clusterSpec, vpcID, vpcCIDR string) ([]networkRoute, error) {
+	ec2Client := ec2.New(config)
+	routes := []networkRoute{}
+	if spec.TransitGateway != nil {
+		ready, err := attachTransitGateway(ec2Client, spec, vpcID)
+		if err != nil {
+			return nil, err
+		}
+		if ready {
+			routes = append(routes, spec.connectionRoutes(map[string]string{})...)
+		}
+	}
+
+	peeringConnections := map[string]string{}
+	for _, peering := range spec.Peering {
+		connectionID, err := establishPeering(config, ec2Client, spec, vpcID, vpcCIDR, peering)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to peer with VPC %s: %s", peering.PeerVpcID, err)
+		}
+		if connectionID != "" {
+			peeringConnections[peering.PeerVpcID] = connectionID
+		}
+	}
+	for _, route := range spec.connectionRoutes(peeringConnections) {
+		if route.VpcPeeringConnectionID != "" {
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+// attachTransitGateway attaches the VPC of a cluster to its transit gateway, in one subnet of each availability zone
+// of the cluster, and waits for the attachment to become available.  The attachment is associated with and
+// propagated to the route tables of the transit gateway when it is created.  It returns whether the attachment
+// routes traffic, which it does not while it awaits acceptance by the owner of the transit gateway.
+func attachTransitGateway(ec2Client *ec2.EC2, spec *clusterSpec, vpcID string) (bool, error) {
+	ext := ec2ext.New(ec2Client)
+	attachment := spec.TransitGateway
+	attachments, err := ext.DescribeTransitGatewayVpcAttachments(&ec2ext.DescribeTransitGatewayVpcAttachmentsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}},
+			{Name: aws.String("transit-gateway-id"), Values: []*string{aws.String(attachment.TransitGatewayID)}},
+			{
+				Name:   aws.String("state"),
+				Values: aws.StringSlice([]string{"pendingAcceptance", "pending", "available", "modifying"}),
+			},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to look up transit gateway attachments: %s", err)
+	}
+
+	var attachmentID *string
+	created := false
+	if len(attachments.TransitGatewayVpcAttachments) > 0 {
+		attachmentID = attachments.TransitGatewayVpcAttachments[0].TransitGatewayAttachmentId
+	} else {
+		subnetIDs, err := attachmentSubnets(ec2Client, spec.cluster(), vpcID)
+		if err != nil {
+			return false, err
+		}
+		result, err := ext.CreateTransitGatewayVpcAttachment(&ec2ext.CreateTransitGatewayVpcAttachmentInput{
+			TransitGatewayId: aws.String(attachment.TransitGatewayID),
+			VpcId:            aws.String(vpcID),
+			SubnetIds:        subnetIDs,
+		})
+		if err != nil {
+			return false, fmt.Errorf("Failed to attach transit gateway %s: %s", attachment.TransitGatewayID, err)
+		}
+		attachmentID = result.TransitGatewayVpcAttachment.TransitGatewayAttachmentId
+		created = true
+		log.Infof("  transit gateway attachment %s, waiting for it to become available", *attachmentID)
+
+		_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{Resources: []*string{attachmentID}, Tags: spec.resourceTags()})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	state, err := waitForAttachment(ext, attachmentID, ec2ext.TransitGatewayAttachmentStateAvailable)
+	if err != nil {
+		return false, err
+	}
+	switch state {
+	case ec2ext.TransitGatewayAttachmentStateAvailable:
+	case ec2ext.TransitGatewayAttachmentStatePendingAcceptance:
+		log.Warnf("  transit gateway attachment %s is awaiting acceptance by the owner of %s; reconcile the network "+
+			"once it is accepted", *attachmentID, attachment.TransitGatewayID)
+		return false, nil
+	default:
+		return false, fmt.Errorf("Transit gateway attachment %s is %s", *attachmentID, state)
+	}
+
+	if !created {
+		return true, nil
+	}
+	if attachment.AssociationRouteTableID != "" {
+		err := ext.AssociateTransitGatewayRouteTable(&ec2ext.TransitGatewayRouteTableInput{
+			TransitGatewayRouteTableId: aws.String(attachment.AssociationRouteTableID),
+			TransitGatewayAttachmentId: attachmentID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("Failed to associate transit gateway route table %s: %s",
+				attachment.AssociationRouteTableID, err)
+		}
+	}
+	for _, routeTableID := range attachment.PropagationRouteTableIDs {
+		err := ext.EnableTransitGatewayRouteTablePropagation(&ec2ext.TransitGatewayRouteTableInput{
+			TransitGatewayRouteTableId: aws.String(routeTableID),
+			TransitGatewayAttachmentId: attachmentID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("Failed to propagate to transit gateway route table %s: %s", routeTableID, err)
+		}
+		log.Infof("  propagating to transit gateway route table %s", routeTableID)
+	}
+	return true, nil
+}
+
+// attachmentSubnets returns a subnet of the cluster in each of its availability zones.
+func attachmentSubnets(ec2Client *ec2.EC2, cluster clusterID, vpcID string) ([]*string, error) {
+	subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up subnets: %s", err)
+	}
+	byZone := map[string]string{}
+	for _, subnet := range subnets.Subnets {
+		zone := aws.StringValue(subnet.AvailabilityZone)
+		if id, has := byZone[zone]; !has || *subnet.SubnetId < id {
+			byZone[zone] = *subnet.SubnetId
+		}
+	}
+	if len(byZone) == 0 {
+		return nil, fmt.Errorf("No subnets of cluster %s to attach", cluster.name)
+	}
+
+	subnetIDs := []string{}
+	for _, id := range byZone {
+		subnetIDs = append(subnetIDs, id)
+	}
+	sort.Strings(subnetIDs)
+	return aws.StringSlice(subnetIDs), nil
+}
+
+// waitForAttachment waits for a transit gateway attachment to leave its transitional states, or to reach a state.
+func waitForAttachment(ext *ec2ext.EC2, attachmentID *string, state string) (string, error) {
+	current := ""
+	for i := 0; i < connectionPolls; i++ {
+		attachments, err := ext.DescribeTransitGatewayVpcAttachments(&ec2ext.DescribeTransitGatewayVpcAttachmentsInput{
+			TransitGatewayAttachmentIds: []*string{attachmentID},
+		})
+		if err != nil && !notFound(err) {
+			return "", err
+		}
+		if err == nil && len(attachments.TransitGatewayVpcAttachments) > 0 {
+			current = aws.StringValue(attachments.TransitGatewayVpcAttachments[0].State)
+			switch current {
+			case state, ec2ext.TransitGatewayAttachmentStatePendingAcceptance, ec2ext.TransitGatewayAttachmentStateFailed,
+				ec2ext.TransitGatewayAttachmentStateDeleted, "rejected":
+				return current, nil
+			}
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return "", fmt.Errorf("Timed out waiting for transit gateway attachment %s, which is %s", *attachmentID, current)
+}
+
+// describePeering returns the peering connection of a cluster with a peer VPC that is not deleted, if any.
+func describePeering(
+	ec2Client *ec2.EC2, cluster clusterID, vpcID, peerVpcID string) (*ec2.VpcPeeringConnection, error) {
+
+	connections, err := ec2Client.DescribeVpcPeeringConnections(&ec2.DescribeVpcPeeringConnectionsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("requester-vpc-info.vpc-id"), Values: []*string{aws.String(vpcID)}},
+			{Name: aws.String("accepter-vpc-info.vpc-id"), Values: []*string{aws.String(peerVpcID)}},
+			{
+				Name: aws.String("status-code"),
+				Values: aws.StringSlice([]string{
+					ec2.VpcPeeringConnectionStateReasonCodeInitiatingRequest,
+					ec2.VpcPeeringConnectionStateReasonCodePendingAcceptance,
+					ec2.VpcPeeringConnectionStateReasonCodeProvisioning,
+					ec2.VpcPeeringConnectionStateReasonCodeActive,
+				}),
+			},
+			cluster.clusterFilter(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(connections.VpcPeeringConnections) == 0 {
+		return nil, nil
+	}
+	return connections.VpcPeeringConnections[0], nil
+}
+
+// regionClient returns a client of the EC2 API of a region, or of the region of the cluster when it is empty.
+func regionClient(config client.ConfigProvider, region string) *ec2.EC2 {
+	if region == "" {
+		return ec2.New(config)
+	}
+	return ec2.New(config, aws.NewConfig().WithRegion(region))
+}
+
+// establishPeering requests a peering connection with a peer VPC, if there is none, and accepts it when the peer VPC
+// is of the same account, routing the CIDR block of the cluster's VPC from the route tables of the peer VPC.  It
+// returns the ID of the connection once it is active, or an empty string while it awaits acceptance.
+func establishPeering(
+	config client.ConfigProvider,
+	ec2Client *ec2.EC2,
+	spec *clusterSpec,
+	vpcID string,
+	vpcCIDR string,
+	peering vpcPeering) (string, error) {
+
+	connection, err := describePeering(ec2Client, spec.cluster(), vpcID, peering.PeerVpcID)
+	if err != nil {
+		return "", err
+	}
+
+	if connection == nil {
+		input := &ec2.CreateVpcPeeringConnectionInput{VpcId: aws.String(vpcID), PeerVpcId: aws.String(peering.PeerVpcID)}
+		if !peering.sameAccount() {
+			input.PeerOwnerId = aws.String(peering.PeerOwnerID)
+		}
+		tags := spec.resourceTags()
+		params := url.Values{}
+		if peering.PeerRegion != "" {
+			params.Set("PeerRegion", peering.PeerRegion)
+			tags = append(tags, &ec2.Tag{Key: aws.String(peerRegionTag), Value: aws.String(peering.PeerRegion)})
+		}
+
+		// The vendored SDK does not model peering with other regions.
+		req, result := ec2Client.CreateVpcPeeringConnectionRequest(input)
+		if err := ec2ext.Send(req, params); err != nil {
+			return "", err
+		}
+		connection = result.VpcPeeringConnection
+		log.Infof("  peering connection %s with %s", *connection.VpcPeeringConnectionId, peering.PeerVpcID)
+
+		_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{connection.VpcPeeringConnectionId},
+			Tags:      tags,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	connectionID := connection.VpcPeeringConnectionId
+
+	if !peering.sameAccount() {
+		status, err := peeringStatus(ec2Client, connectionID)
+		if err != nil {
+			return "", err
+		}
+		if status != ec2.VpcPeeringConnectionStateReasonCodeActive {
+			log.Warnf("  peering connection %s is awaiting acceptance by account %s; reconcile the network once "+
+				"it is accepted", *connectionID, peering.PeerOwnerID)
+			return "", nil
+		}
+		return *connectionID, nil
+	}
+
+	peerClient := regionClient(config, peering.PeerRegion)
+	if err := acceptPeering(ec2Client, peerClient, connectionID); err != nil {
+		return "", err
+	}
+
+	// Routes of the peer VPC are created or replaced, since they may be left from an earlier connection.
+	ext := ec2ext.New(peerClient)
+	for _, routeTableID := range peering.PeerRouteTableIDs {
+		input := &ec2ext.RouteInput{
+			RouteTableId:           aws.String(routeTableID),
+			DestinationCidrBlock:   aws.String(vpcCIDR),
+			VpcPeeringConnectionId: connectionID,
+		}
+		err := ext.CreateRoute(input)
+		if awsErr, is := err.(awserr.Error); is && awsErr.Code() == "RouteAlreadyExists" {
+			err = ext.ReplaceRoute(input)
+		}
+		if err != nil {
+			return "", fmt.Errorf("Failed to route %s in peer route table %s: %s", vpcCIDR, routeTableID, err)
+		}
+	}
+	return *connectionID, nil
+}
+
+func peeringStatus(ec2Client *ec2.EC2, connectionID *string) (string, error) {
+	connections, err := ec2Client.DescribeVpcPeeringConnections(&ec2.DescribeVpcPeeringConnectionsInput{
+		VpcPeeringConnectionIds: []*string{connectionID},
+	})
+	if err != nil {
+		if notFound(err) {
+			return ec2.VpcPeeringConnectionStateReasonCodeInitiatingRequest, nil
+		}
+		return "", err
+	}
+	if len(connections.VpcPeeringConnections) == 0 || connections.VpcPeeringConnections[0].Status == nil {
+		return ec2.VpcPeeringConnectionStateReasonCodeInitiatingRequest, nil
+	}
+	return aws.StringValue(connections.VpcPeeringConnections[0].Status.Code), nil
+}
+
+// acceptPeering accepts a peering connection with a VPC of the same account, once it is pending acceptance, and waits
+// for it to become active.
+func acceptPeering(ec2Client, peerClient *ec2.EC2, connectionID *string) error {
+	for i := 0; i < connectionPolls; i++ {
+		status, err := peeringStatus(ec2Client, connectionID)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case ec2.VpcPeeringConnectionStateReasonCodeActive:
+			return nil
+		case ec2.VpcPeeringConnectionStateReasonCodePendingAcceptance:
+			log.Infof("  accepting peering connection %s", *connectionID)
+			_, err := peerClient.AcceptVpcPeeringConnection(&ec2.AcceptVpcPeeringConnectionInput{
+				VpcPeeringConnectionId: connectionID,
+			})
+			if err != nil && !notFound(err) {
+				return fmt.Errorf("Failed to accept peering connection %s: %s", *connectionID, err)
+			}
+		case ec2.VpcPeeringConnectionStateReasonCodeInitiatingRequest, ec2.VpcPeeringConnectionStateReasonCodeProvisioning:
+		default:
+			return fmt.Errorf("Peering connection %s is %s", *connectionID, status)
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return fmt.Errorf("Timed out waiting for peering connection %s to become active", *connectionID)
+}
+
+// destroyConnections detaches the VPC of a cluster from transit gateways, and deletes its peering connections along
+// with the routes through them in the peer VPCs of the same account.  Attachments must be deleted before the subnets
+// they are in.
+func destroyConnections(config client.ConfigProvider, ec2Client *ec2.EC2, cluster clusterID, vpcID string) {
+	ext := ec2ext.New(ec2Client)
+	attachments, err := ext.DescribeTransitGatewayVpcAttachments(&ec2ext.DescribeTransitGatewayVpcAttachmentsInput{
+		Filters: cluster.resourceFilter(vpcID),
+	})
+	if err != nil {
+		log.Warnf("  error while describing transit gateway attachments: %s", err)
+	}
+	deleting := []*string{}
+	if err == nil {
+		for _, attachment := range attachments.TransitGatewayVpcAttachments {
+			switch aws.StringValue(attachment.State) {
+			case ec2ext.TransitGatewayAttachmentStateDeleted, "deleting", "rejected":
+				continue
+			}
+			log.Infof("  transit gateway attachment %s", *attachment.TransitGatewayAttachmentId)
+			err := ext.DeleteTransitGatewayVpcAttachment(&ec2ext.TransitGatewayAttachmentInput{
+				TransitGatewayAttachmentId: attachment.TransitGatewayAttachmentId,
+			})
+			if err != nil {
+				log.Warnf("  error while deleting transit gateway attachment: %s", err)
+				continue
+			}
+			deleting = append(deleting, attachment.TransitGatewayAttachmentId)
+		}
+	}
+	for _, attachmentID := range deleting {
+		if _, err := waitForAttachment(ext, attachmentID, ec2ext.TransitGatewayAttachmentStateDeleted); err != nil {
+			log.Warnf("  error while waiting for transit gateway attachment to be deleted: %s", err)
+		}
+	}
+
+	connections, err := ec2Client.DescribeVpcPeeringConnections(&ec2.DescribeVpcPeeringConnectionsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("requester-vpc-info.vpc-id"), Values: []*string{aws.String(vpcID)}},
+			cluster.clusterFilter(),
+		},
+	})
+	if err != nil {
+		log.Warnf("  error while describing peering connections: %s", err)
+		return
+	}
+	for _, connection := range connections.VpcPeeringConnections {
+		switch aws.StringValue(connection.Status.Code) {
+		case ec2.VpcPeeringConnectionStateReasonCodeDeleted, ec2.VpcPeeringConnectionStateReasonCodeRejected,
+			ec2.VpcPeeringConnectionStateReasonCodeFailed, ec2.VpcPeeringConnectionStateReasonCodeExpired:
+			continue
+		}
+
+		requester, accepter := connection.RequesterVpcInfo, connection.AccepterVpcInfo
+		if requester != nil && accepter != nil && aws.StringValue(requester.OwnerId) == aws.StringValue(accepter.OwnerId) {
+			region := ""
+			for _, tag := range connection.Tags {
+				if aws.StringValue(tag.Key) == peerRegionTag {
+					region = aws.StringValue(tag.Value)
+				}
+			}
+			deletePeerRoutes(regionClient(config, region), connection)
+		}
+
+		log.Infof("  peering connection %s", *connection.VpcPeeringConnectionId)
+		_, err := ec2Client.DeleteVpcPeeringConnection(&ec2.DeleteVpcPeeringConnectionInput{
+			VpcPeeringConnectionId: connection.VpcPeeringConnectionId,
+		})
+		if err != nil {
+			log.Warnf("  error while deleting peering connection: %s", err)
+		}
+	}
+}
+
+// deletePeerRoutes deletes the routes through a peering connection from the route tables of its peer VPC.
+func deletePeerRoutes(peerClient *ec2.EC2, connection *ec2.VpcPeeringConnection) {
+	routeTables, err := peerClient.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{connection.AccepterVpcInfo.VpcId}},
+			{Name: aws.String("route.vpc-peering-connection-id"), Values: []*string{connection.VpcPeeringConnectionId}},
+		},
+	})
+	if err != nil {
+		log.Warnf("  error while describing the route tables of peer VPC: %s", err)
+		return
+	}
+	for _, routeTable := range routeTables.RouteTables {
+		for _, route := range routeTable.Routes {
+			if aws.StringValue(route.VpcPeeringConnectionId) != *connection.VpcPeeringConnectionId {
+				continue
+			}
+			log.Infof("  route to %s in peer route table %s", aws.StringValue(route.DestinationCidrBlock),
+				*routeTable.RouteTableId)
+			_, err := peerClient.DeleteRoute(&ec2.DeleteRouteInput{
+				RouteTableId:         routeTable.RouteTableId,
+				DestinationCidrBlock: route.DestinationCidrBlock,
+			})
+			if err != nil {
+				log.Warnf("  error while deleting peer route: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/group"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// hoursPerMonth is the average number of hours in a month, as used by AWS pricing.
+	hoursPerMonth = 730
+
+	// pricingRegion is a region hosting the Price List API, which serves prices of all regions.
+	pricingRegion = "us-east-1"
+)
+
+// groupCost is the estimated hourly cost of a group, in USD.
+type groupCost struct {
+	group        group.ID
+	instanceType string
+	size         int
+	onDemand     float64
+	spot         float64
+}
+
+// newPricingClient creates a client of the Price List API.  The API is newer than the vendored SDK, so the client is
+// assembled from the SDK's JSON protocol handlers.
+func newPricingClient(config client.ConfigProvider) *client.Client {
+	c := config.ClientConfig("api.pricing", aws.NewConfig().WithRegion(pricingRegion))
+	pricing := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "api.pricing",
+			SigningName:   "pricing",
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2017-10-15",
+			JSONVersion:   "1.1",
+			TargetPrefix:  "AWSPriceListService",
+		},
+		c.Handlers)
+	pricing.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	pricing.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	pricing.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	pricing.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	pricing.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+	return pricing
+}
+
+type pricingFilter struct {
+	Type  string
+	Field string
+	Value string
+}
+
+type getProductsInput struct {
+	ServiceCode   string
+	Filters       []pricingFilter
+	FormatVersion string
+	MaxResults    int64
+}
+
+type getProductsOutput struct {
+	PriceList []string
+}
+
+// priceListItem is the part of a Price List API product holding its on-demand prices.
+type priceListItem struct {
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				PricePerUnit map[string]string `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// onDemandPrice looks up the hourly on-demand price of a Linux instance type in a region.
+func onDemandPrice(pricing *client.Client, region, instanceType string) (float64, error) {
+	input := &getProductsInput{
+		ServiceCode: "AmazonEC2",
+		Filters: []pricingFilter{
+			{Type: "TERM_MATCH", Field: "regionCode", Value: region},
+			{Type: "TERM_MATCH", Field: "instanceType", Value: instanceType},
+			{Type: "TERM_MATCH", Field: "operatingSystem", Value: "Linux"},
+			{Type: "TERM_MATCH", Field: "tenancy", Value: "Shared"},
+			{Type: "TERM_MATCH", Field: "preInstalledSw", Value: "NA"},
+			{Type: "TERM_MATCH", Field: "capacitystatus", Value: "Used"},
+		},
+		FormatVersion: "aws_v1",
+		MaxResults:    1,
+	}
+	output := &getProductsOutput{}
+
+	err := pricing.NewRequest(
+		&request.Operation{Name: "GetProducts", HTTPMethod: "POST", HTTPPath: "/"},
+		input,
+		output).Send()
+	if err != nil {
+		return 0, err
+	}
+	if len(output.PriceList) == 0 {
+		return 0, fmt.Errorf("No on-demand price found for %s in %s", instanceType, region)
+	}
+
+	item := priceListItem{}
+	if err := json.Unmarshal([]byte(output.PriceList[0]), &item); err != nil {
+		return 0, err
+	}
+	for _, term := range item.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			return strconv.ParseFloat(dimension.PricePerUnit["USD"], 64)
+		}
+	}
+	return 0, fmt.Errorf("No on-demand price found for %s in %s", instanceType, region)
+}
+
+// spotPrice looks up the current hourly spot price of a Linux instance type in an availability zone, returning zero if
+// the instance type has no spot price history.
+func spotPrice(ec2Client *ec2.EC2, availabilityZone, instanceType string) (float64, error) {
+	history, err := ec2Client.DescribeSpotPriceHistory(&ec2.DescribeSpotPriceHistoryInput{
+		AvailabilityZone:    aws.String(availabilityZone),
+		InstanceTypes:       []*string{aws.String(instanceType)},
+		ProductDescriptions: []*string{aws.String("Linux/UNIX")},
+		StartTime:           aws.Time(time.Now()),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(history.SpotPriceHistory) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseFloat(aws.StringValue(history.SpotPriceHistory[0].SpotPrice), 64)
+}
+
+// estimateCost estimates the hourly cost of each group of a cluster spec, without creating any resources.
+func estimateCost(config client.ConfigProvider, spec clusterSpec) ([]groupCost, error) {
+	ec2Client := ec2.New(config)
+	if err := spec.resolveSubnets(ec2Client); err != nil {
+		return nil, err
+	}
+	if _, err := spec.resolveImageChannels(config, false); err != nil {
+		return nil, err
+	}
+	if err := spec.resolveInstanceTypes(config); err != nil {
+		return nil, err
+	}
+
+	pricing := newPricingClient(config)
+	region := spec.cluster().region
+	az, err := spec.availabilityZone()
+	if err != nil {
+		return nil, err
+	}
+
+	costs := []groupCost{}
+	for _, grp := range spec.Groups {
+		instanceType := aws.StringValue(grp.Config.RunInstancesInput.InstanceType)
+		if instanceType == "" {
+			return nil, fmt.Errorf("In group %s: InstanceType must be set", grp.Name)
+		}
+
+		onDemand, err := onDemandPrice(pricing, region, instanceType)
+		if err != nil {
+			return nil, fmt.Errorf("In group %s: %s", grp.Name, err)
+		}
+		spot, err := spotPrice(ec2Client, az, instanceType)
+		if err != nil {
+			return nil, fmt.Errorf("In group %s: %s", grp.Name, err)
+		}
+
+		costs = append(costs, groupCost{
+			group:        grp.Name,
+			instanceType: instanceType,
+			size:         grp.Size,
+			onDemand:     onDemand * float64(grp.Size),
+			spot:         spot * float64(grp.Size),
+		})
+	}
+	return costs, nil
+}
+
+// printCost prints the hourly and monthly cost of each group, and of the cluster.
+func printCost(out io.Writer, costs []groupCost) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tINSTANCE TYPE\tSIZE\tON-DEMAND/HOUR\tON-DEMAND/MONTH\tSPOT/HOUR\tSPOT/MONTH")
+
+	total := groupCost{group: "Total"}
+	for _, cost := range costs {
+		printGroupCost(w, cost)
+		total.size += cost.size
+		total.onDemand += cost.onDemand
+		total.spot += cost.spot
+	}
+	printGroupCost(w, total)
+	return w.Flush()
+}
+
+func printGroupCost(w io.Writer, cost groupCost) {
+	fmt.Fprintf(w, "%s\t%s\t%d\t$%.4f\t$%.2f\t$%.4f\t$%.2f\n",
+		cost.group,
+		cost.instanceType,
+		cost.size,
+		cost.onDemand,
+		cost.onDemand*hoursPerMonth,
+		cost.spot,
+		cost.spot*hoursPerMonth)
+}
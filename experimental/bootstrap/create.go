@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/docker/infrakit.aws/plugin/iamrole"
 	infrakit_instance "github.com/docker/infrakit.aws/plugin/instance"
 	"github.com/docker/infrakit/spi/group"
 	"github.com/docker/infrakit/spi/instance"
@@ -21,11 +22,15 @@ import (
 func createEBSVolumes(config client.ConfigProvider, spec clusterSpec) error {
 	log.Info("Creating EBS volumes")
 	ec2Client := ec2.New(config)
+	az, err := spec.availabilityZone()
+	if err != nil {
+		return err
+	}
 
 	volumeIDs := []*string{}
 	for _, managerIP := range spec.ManagerIPs {
 		volume, err := ec2Client.CreateVolume(&ec2.CreateVolumeInput{
-			AvailabilityZone: aws.String(spec.availabilityZone()),
+			AvailabilityZone: aws.String(az),
 			Size:             aws.Int64(4),
 		})
 		volumeIDs = append(volumeIDs, volume.VolumeId)
@@ -37,13 +42,10 @@ func createEBSVolumes(config client.ConfigProvider, spec clusterSpec) error {
 
 		_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
 			Resources: []*string{volume.VolumeId},
-			Tags: []*ec2.Tag{
-				spec.cluster().resourceTag(),
-				{
-					Key:   aws.String(infrakit_instance.VolumeTag),
-					Value: aws.String(managerIP),
-				},
-			},
+			Tags: append(spec.resourceTags(), &ec2.Tag{
+				Key:   aws.String(infrakit_instance.VolumeTag),
+				Value: aws.String(managerIP),
+			}),
 		})
 		if err != nil {
 			return err
@@ -53,13 +55,15 @@ func createEBSVolumes(config client.ConfigProvider, spec clusterSpec) error {
 	return nil
 }
 
+// applySubnetAndSecurityGroups launches instances in a subnet, with security groups in addition to those already
+// configured, such as the security groups inherited from the cluster defaults.
 func applySubnetAndSecurityGroups(run *ec2.RunInstancesInput, subnetID *string, securityGroupIDs ...*string) {
 	if run.NetworkInterfaces == nil || len(run.NetworkInterfaces) == 0 {
 		run.SubnetId = subnetID
-		run.SecurityGroupIds = securityGroupIDs
+		run.SecurityGroupIds = append(securityGroupIDs, run.SecurityGroupIds...)
 	} else {
 		run.NetworkInterfaces[0].SubnetId = subnetID
-		run.NetworkInterfaces[0].Groups = securityGroupIDs
+		run.NetworkInterfaces[0].Groups = append(securityGroupIDs, run.NetworkInterfaces[0].Groups...)
 	}
 }
 
@@ -123,14 +127,23 @@ func createNetwork(config client.ConfigProvider, spec *clusterSpec) (string, err
 
 	ec2Client := ec2.New(config)
 
-	vpc, err := ec2Client.CreateVpc(&ec2.CreateVpcInput{CidrBlock: aws.String("192.168.0.0/16")})
+	if spec.existingVpcID != "" {
+		return spec.existingVpcID, useExistingNetwork(ec2Client, spec)
+	}
+
+	az, err := spec.availabilityZone()
+	if err != nil {
+		return "", err
+	}
+
+	vpc, err := createVpc(ec2Client, spec.DualStack)
 	if err != nil {
 		return "", err
 	}
-	vpcID := *vpc.Vpc.VpcId
+	vpcID := *vpc.VpcId
 
 	log.Infof("  VPC %s, waiting for it to become available", vpcID)
-	vpcDescribe := ec2.DescribeVpcsInput{VpcIds: []*string{vpc.Vpc.VpcId}}
+	vpcDescribe := ec2.DescribeVpcsInput{VpcIds: []*string{vpc.VpcId}}
 	err = ec2Client.WaitUntilVpcExists(&vpcDescribe)
 	if err != nil {
 		return "", fmt.Errorf("Failed while waiting for VPC to exist - %s", err)
@@ -142,7 +155,7 @@ func createNetwork(config client.ConfigProvider, spec *clusterSpec) (string, err
 	}
 
 	_, err = ec2Client.ModifyVpcAttribute(&ec2.ModifyVpcAttributeInput{
-		VpcId:            vpc.Vpc.VpcId,
+		VpcId:            vpc.VpcId,
 		EnableDnsSupport: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
 	})
 	if err != nil {
@@ -152,7 +165,7 @@ func createNetwork(config client.ConfigProvider, spec *clusterSpec) (string, err
 	// The API does not allow enabling DnsSupport and DnsHostnames in the same request, so a second modification
 	// is made for DnsHostnames.
 	_, err = ec2Client.ModifyVpcAttribute(&ec2.ModifyVpcAttributeInput{
-		VpcId:              vpc.Vpc.VpcId,
+		VpcId:              vpc.VpcId,
 		EnableDnsHostnames: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
 	})
 	if err != nil {
@@ -161,8 +174,8 @@ func createNetwork(config client.ConfigProvider, spec *clusterSpec) (string, err
 
 	workerSubnet, err := ec2Client.CreateSubnet(&ec2.CreateSubnetInput{
 		VpcId:            aws.String(vpcID),
-		CidrBlock:        aws.String("192.168.34.0/24"),
-		AvailabilityZone: aws.String(spec.availabilityZone()),
+		CidrBlock:        aws.String(workerSubnetCIDR),
+		AvailabilityZone: aws.String(az),
 	})
 	if err != nil {
 		return "", err
@@ -171,61 +184,38 @@ func createNetwork(config client.ConfigProvider, spec *clusterSpec) (string, err
 
 	managerSubnet, err := ec2Client.CreateSubnet(&ec2.CreateSubnetInput{
 		VpcId:            aws.String(vpcID),
-		CidrBlock:        aws.String("192.168.33.0/24"),
-		AvailabilityZone: aws.String(spec.availabilityZone()),
+		CidrBlock:        aws.String(managerSubnetCIDR),
+		AvailabilityZone: aws.String(az),
 	})
 	if err != nil {
 		return "", err
 	}
 	log.Infof("  manager subnet %s", *managerSubnet.Subnet.SubnetId)
 
-	workerGroupRequest := ec2.CreateSecurityGroupInput{
-		GroupName:   aws.String("WorkerSecurityGroup"),
-		VpcId:       aws.String(vpcID),
-		Description: aws.String("Worker node network rules"),
-	}
-	workerSecurityGroup, err := ec2Client.CreateSecurityGroup(&workerGroupRequest)
-	if err != nil {
-		return "", err
-	}
-	log.Infof("  worker security group %s", *workerSecurityGroup.GroupId)
-
-	managerGroupRequest := ec2.CreateSecurityGroupInput{
-		GroupName:   aws.String("ManagerSecurityGroup"),
-		VpcId:       aws.String(vpcID),
-		Description: aws.String("Manager node network rules"),
-	}
-	managerSecurityGroup, err := ec2Client.CreateSecurityGroup(&managerGroupRequest)
-	if err != nil {
-		return "", err
-	}
-	log.Infof("  manager security group %s", *managerSecurityGroup.GroupId)
-
-	err = configureManagerSecurityGroup(
+	managerSecurityGroupID, workerSecurityGroupID, err := createSecurityGroups(
 		ec2Client,
-		*managerSecurityGroup.GroupId,
-		*managerSubnet.Subnet,
-		*workerSubnet.Subnet)
-	if err != nil {
-		return "", err
-	}
-
-	err = configureWorkerSecurityGroup(ec2Client, *workerSecurityGroup.GroupId, *managerSubnet.Subnet)
+		vpcID,
+		createdNetwork,
+		spec.SSMAccess == nil)
 	if err != nil {
 		return "", err
 	}
+	spec.network = createdNetwork
 
 	routeTable, internetGateway, err := createRouteTable(ec2Client, vpcID)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = ec2Client.AssociateRouteTable(&ec2.AssociateRouteTableInput{
-		SubnetId:     workerSubnet.Subnet.SubnetId,
-		RouteTableId: routeTable.RouteTableId,
-	})
-	if err != nil {
-		return "", err
+	// Private workers are routed through NAT gateways once the public subnet is routed to the internet.
+	if spec.PrivateWorkers == nil {
+		_, err = ec2Client.AssociateRouteTable(&ec2.AssociateRouteTableInput{
+			SubnetId:     workerSubnet.Subnet.SubnetId,
+			RouteTableId: routeTable.RouteTableId,
+		})
+		if err != nil {
+			return "", err
+		}
 	}
 
 	_, err = ec2Client.AssociateRouteTable(&ec2.AssociateRouteTableInput{
@@ -239,31 +229,106 @@ func createNetwork(config client.ConfigProvider, spec *clusterSpec) (string, err
 	// Tag all resources created.
 	_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
 		Resources: []*string{
-			vpc.Vpc.VpcId,
+			vpc.VpcId,
 			workerSubnet.Subnet.SubnetId,
 			managerSubnet.Subnet.SubnetId,
-			managerSecurityGroup.GroupId,
-			workerSecurityGroup.GroupId,
+			managerSecurityGroupID,
+			workerSecurityGroupID,
 			routeTable.RouteTableId,
 			internetGateway.InternetGatewayId,
 		},
-		Tags: []*ec2.Tag{spec.cluster().resourceTag()},
+		Tags: spec.resourceTags(),
 	})
 	if err != nil {
 		return "", err
 	}
 
+	if spec.PrivateWorkers != nil {
+		natResources, err := createNATGateways(
+			ec2Client,
+			vpcID,
+			spec.PrivateWorkers.mode(),
+			[]subnetPlacement{{managerSubnet.Subnet.SubnetId, az}},
+			[]subnetPlacement{{workerSubnet.Subnet.SubnetId, az}})
+		if len(natResources) > 0 {
+			_, tagErr := ec2Client.CreateTags(&ec2.CreateTagsInput{Resources: natResources, Tags: spec.resourceTags()})
+			if err == nil {
+				err = tagErr
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(spec.VpcEndpoints) > 0 {
+		if err := createVpcEndpoints(ec2Client, spec, vpcID, managerSubnet.Subnet.SubnetId); err != nil {
+			return "", err
+		}
+	}
+
+	routes := append([]networkRoute{}, spec.Routes...)
+	if spec.TransitGateway != nil || len(spec.Peering) > 0 {
+		log.Info("Connecting networks")
+		connectionRoutes, err := connectNetworks(config, spec, vpcID, vpcCIDR)
+		if err != nil {
+			return "", err
+		}
+		routes = append(routes, connectionRoutes...)
+	}
+
+	if len(routes) > 0 {
+		log.Info("Creating routes")
+		if err := reconcileRoutes(ec2Client, spec.cluster(), vpcID, routes, false); err != nil {
+			return "", err
+		}
+	}
+	if spec.NetworkACL != nil {
+		if err := reconcileNetworkACL(ec2Client, spec, vpcID); err != nil {
+			return "", err
+		}
+	}
+
+	if spec.DualStack {
+		err = enableIpv6(
+			ec2Client,
+			vpcID,
+			[]*string{workerSubnet.Subnet.SubnetId, managerSubnet.Subnet.SubnetId},
+			routeTable.RouteTableId,
+			internetGateway.InternetGatewayId)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if spec.StaticManagerInterfaces {
+		err = createManagerInterfaces(
+			ec2Client,
+			spec,
+			managerSubnet.Subnet.SubnetId,
+			managerSecurityGroupID)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	spec.mutateGroups(func(group *instanceGroupSpec) {
 		if group.isManager() {
 			applySubnetAndSecurityGroups(
 				&group.Config.RunInstancesInput,
 				managerSubnet.Subnet.SubnetId,
-				managerSecurityGroup.GroupId)
+				managerSecurityGroupID)
+			if spec.SSMAccess != nil {
+				withoutPublicAddress(&group.Config.RunInstancesInput)
+			}
 		} else {
 			applySubnetAndSecurityGroups(
 				&group.Config.RunInstancesInput,
 				workerSubnet.Subnet.SubnetId,
-				workerSecurityGroup.GroupId)
+				workerSecurityGroupID)
+			if spec.PrivateWorkers != nil || spec.SSMAccess != nil {
+				withoutPublicAddress(&group.Config.RunInstancesInput)
+			}
 		}
 	})
 
@@ -274,30 +339,10 @@ func createAccessRole(config client.ConfigProvider, spec *clusterSpec) error {
 	log.Info("Creating IAM resources")
 
 	iamClient := iam.New(config)
-
-	// TODO(wfarner): IAM roles are a global concept in AWS, meaning we will probably need to include region
-	// in these entities to avoid collisions.
-	role, err := iamClient.CreateRole(&iam.CreateRoleInput{
-		RoleName: aws.String(spec.cluster().roleName()),
-		AssumeRolePolicyDocument: aws.String(`{
-			"Version" : "2012-10-17",
-			"Statement": [{
-				"Effect": "Allow",
-				"Principal": {
-					"Service": ["ec2.amazonaws.com"]
-				},
-				"Action": ["sts:AssumeRole"]
-			}]
-		}`),
-	})
-	if err != nil {
-		return err
-	}
-
-	log.Infof("  role %s (id %s)", *role.Role.RoleName, *role.Role.RoleId)
+	cluster := spec.cluster()
 
 	policy, err := iamClient.CreatePolicy(&iam.CreatePolicyInput{
-		PolicyName: aws.String(spec.cluster().managerPolicyName()),
+		PolicyName: aws.String(cluster.managerPolicyName()),
 
 		PolicyDocument: aws.String(`{
 			"Version" : "2012-10-17",
@@ -313,32 +358,11 @@ func createAccessRole(config client.ConfigProvider, spec *clusterSpec) error {
 	}
 	log.Infof("  policy %s (id %s)", *policy.Policy.PolicyName, *policy.Policy.PolicyId)
 
-	_, err = iamClient.AttachRolePolicy(&iam.AttachRolePolicyInput{
-		RoleName:  role.Role.RoleName,
-		PolicyArn: policy.Policy.Arn,
-	})
-
-	instanceProfile, err := iamClient.CreateInstanceProfile(&iam.CreateInstanceProfileInput{
-		InstanceProfileName: aws.String(spec.cluster().instanceProfileName()),
-	})
-	if err != nil {
-		return err
-	}
-	log.Infof(
-		"  instance profile %s (id %s), waiting for it to exist",
-		*instanceProfile.InstanceProfile.InstanceProfileName,
-		*instanceProfile.InstanceProfile.InstanceProfileId)
-
-	err = iamClient.WaitUntilInstanceProfileExists(&iam.GetInstanceProfileInput{
-		InstanceProfileName: instanceProfile.InstanceProfile.InstanceProfileName,
-	})
-	if err != nil {
-		return err
-	}
-
-	_, err = iamClient.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{
-		InstanceProfileName: instanceProfile.InstanceProfile.InstanceProfileName,
-		RoleName:            role.Role.RoleName,
+	// TODO(wfarner): IAM roles are a global concept in AWS, meaning we will probably need to include region
+	// in these entities to avoid collisions.
+	profileARN, err := provisionClusterRole(config, cluster, cluster.roleName(), iamrole.CreateRoleRequest{
+		ManagedPolicyARNs:   []string{*policy.Policy.Arn},
+		InstanceProfileName: cluster.instanceProfileName(),
 	})
 	if err != nil {
 		return err
@@ -354,66 +378,10 @@ func createAccessRole(config client.ConfigProvider, spec *clusterSpec) error {
 
 	spec.mutateManagers(func(managers *instanceGroupSpec) {
 		managers.Config.RunInstancesInput.IamInstanceProfile = &ec2.IamInstanceProfileSpecification{
-			Arn: instanceProfile.InstanceProfile.Arn,
+			Arn: aws.String(profileARN),
 		}
 	})
-
-	return err
-}
-
-func configureManagerSecurityGroup(
-	ec2Client ec2iface.EC2API,
-	groupID string,
-	managerSubnet ec2.Subnet,
-	workerSubnet ec2.Subnet) error {
-
-	// Authorize traffic from worker nodes.
-	_, err := ec2Client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId:    &groupID,
-		IpProtocol: aws.String("-1"),
-		FromPort:   aws.Int64(-1),
-		ToPort:     aws.Int64(-1),
-		CidrIp:     workerSubnet.CidrBlock,
-	})
-	if err != nil {
-		return err
-	}
-
-	// Authorize traffic between managers.
-	_, err = ec2Client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId:    &groupID,
-		IpProtocol: aws.String("-1"),
-		FromPort:   aws.Int64(-1),
-		ToPort:     aws.Int64(-1),
-		CidrIp:     managerSubnet.CidrBlock,
-	})
-	if err != nil {
-		return err
-	}
-
-	// Authorize SSH to managers.
-	_, err = ec2Client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId:    &groupID,
-		IpProtocol: aws.String("tcp"),
-		CidrIp:     aws.String("0.0.0.0/0"),
-		FromPort:   aws.Int64(22),
-		ToPort:     aws.Int64(22),
-	})
-
-	return err
-}
-
-func configureWorkerSecurityGroup(ec2Client ec2iface.EC2API, groupID string, managerSubnet ec2.Subnet) error {
-	// Authorize traffic from manager nodes.
-	_, err := ec2Client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId:    aws.String(groupID),
-		IpProtocol: aws.String("-1"),
-		FromPort:   aws.Int64(-1),
-		ToPort:     aws.Int64(-1),
-		CidrIp:     managerSubnet.CidrBlock,
-	})
-
-	return err
+	return nil
 }
 
 // ProvisionManager creates a single manager instance, replacing the IP address wildcard with the provided IP.
@@ -454,30 +422,61 @@ cat << 'EOF' > "$configs/{{ $name }}.json"
 {{ $config }}
 EOF
 {{ end }}
+{{ if .StateURL }}
+# Restore the latest committed group specs, which take precedence over those from bootstrap.
+{{ range $name, $config := .ConfigsByName }}
+docker run --rm -v $configs:$configs amazon/aws-cli s3 cp "{{ $.StateURL }}/groups/{{ $name }}.json" "$configs/{{ $name }}.json" || true
+{{ end }}
+{{ end }}
 
 docker pull $image
 $run_plugin --name flavor-combo $image infrakit-flavor-combo
 $run_plugin --name flavor-swarm -v /var/run/docker.sock:/var/run/docker.sock $image infrakit-flavor-swarm
 $run_plugin --name flavor-vanilla $image infrakit-flavor-vanilla
 $run_plugin --name group-default $image infrakit-group-default
-$run_plugin --name instance-aws $image infrakit-instance-aws --namespace-tags infrakit.cluster={{.ClusterName}}
+$run_plugin --name instance-aws $image infrakit-instance-aws --region {{.Region}} --namespace-tags '{{.NamespaceTags}}'
+{{ range $name, $role := .RolePlugins }}
+$run_plugin --name {{ $name }} $image infrakit-instance-aws --name {{ $name }} --region {{$.Region}} --role-arn {{ $role }} --namespace-tags '{{$.NamespaceTags}}'
+{{ end }}
 
 echo "alias infrakit='docker run --rm $discovery -v $configs:$configs $image infrakit'" >> /home/ubuntu/.bashrc
 
 {{ range $name, $config := .ConfigsByName }}
 docker run --rm $discovery -v $configs:$configs $image infrakit group watch $configs/{{ $name }}.json
 {{ end }}
+{{ if .Schedules }}
+# Commit the scheduled sizes of groups when their schedules fire.
+mkdir -p $configs/schedules
+{{ range .Schedules }}
+cat << 'EOF' > "$configs/schedules/{{ .Name }}.json"
+{{ .Spec }}
+EOF
+echo "{{ .Cron }} root docker run --rm $discovery -v $configs:$configs $image infrakit group update $configs/schedules/{{ .Name }}.json{{ if $.StateURL }} && docker run --rm -v $configs:$configs amazon/aws-cli s3 cp $configs/schedules/{{ .Name }}.json {{ $.StateURL }}/groups/{{ .Group }}.json{{ end }} || logger -p user.err -t infrakit-schedules 'Failed to commit {{ .Name }}'" >> /etc/cron.d/infrakit-schedules
+{{ end }}
+chmod 644 /etc/cron.d/infrakit-schedules
+{{ end }}
+{{ if .Backups }}
+# Snapshot the manager volumes, deleting old snapshots.
+echo "{{ .Backups.Cron }} root docker run --rm $image infrakit-instance-aws backup --region {{ .Region }} --namespace-tags '{{ .NamespaceTags }}' --retain {{ .Backups.Retain }}" > /etc/cron.d/infrakit-backups
+chmod 644 /etc/cron.d/infrakit-backups
+{{ end }}
 `
 
 func startInitialManager(config client.ConfigProvider, spec clusterSpec) error {
 	log.Info("Starting cluster boot leader instance")
-	builder := infrakit_instance.Builder{Config: config}
-	provisioner, err := builder.BuildInstancePlugin(spec.cluster().clusterTagMap())
+	if err := spec.runHooks(UserDataStage); err != nil {
+		return err
+	}
+	managerGroup, err := spec.managers()
 	if err != nil {
 		return err
 	}
 
-	managerGroup := spec.managers()
+	builder := infrakit_instance.Builder{Config: spec.cluster().getGroupAWSClient(config, managerGroup)}
+	provisioner, err := builder.BuildInstancePlugin(spec.namespaceTags())
+	if err != nil {
+		return err
+	}
 
 	// Produce InfraKit groups.
 	infrakitGroups, err := generateInfraKitGroups(spec)
@@ -485,10 +484,47 @@ func startInitialManager(config client.ConfigProvider, spec clusterSpec) error {
 		return err
 	}
 
+	schedules, err := generateScheduledGroups(spec)
+	if err != nil {
+		return err
+	}
+	if len(schedules) > 0 {
+		log.Warnf("Scheduled sizes of groups are committed by the boot leader only, and stop if it is replaced")
+	}
+
+	stateURL := ""
+	if spec.State != nil {
+		err = saveState(config, spec, infrakitGroups)
+		if err != nil {
+			return err
+		}
+		stateURL = spec.stateURL()
+	}
+
 	buffer := bytes.Buffer{}
+	namespaceTags := []string{}
+	for _, tag := range spec.resourceTags() {
+		namespaceTags = append(namespaceTags, fmt.Sprintf("%s=%s", *tag.Key, *tag.Value))
+	}
+
+	rolePlugins := map[string]string{}
+	for _, grp := range spec.Groups {
+		if grp.Credentials != nil && grp.Credentials.RoleARN != "" {
+			rolePlugins[grp.instancePluginName()] = grp.Credentials.RoleARN
+		}
+	}
+
 	err = template.Must(template.New("").Parse(prepareGroupWatches)).Execute(
 		&buffer,
-		map[string]interface{}{"ClusterName": spec.ClusterName, "ConfigsByName": infrakitGroups})
+		map[string]interface{}{
+			"NamespaceTags": strings.Join(namespaceTags, ","),
+			"ConfigsByName": infrakitGroups,
+			"RolePlugins":   rolePlugins,
+			"Schedules":     schedules,
+			"Backups":       spec.Backups,
+			"StateURL":      stateURL,
+			"Region":        spec.cluster().region,
+		})
 	if err != nil {
 		return err
 	}
@@ -496,7 +532,7 @@ func startInitialManager(config client.ConfigProvider, spec clusterSpec) error {
 	// TODO(wfarner): Include shell code that creates infrakit group JSON files, and watches the groups.
 	managerGroup.Config.RunInstancesInput.UserData = aws.String(strings.Join([]string{
 		"#!/bin/bash",
-		initializeManager,
+		managerGroup.bootScript,
 		"docker swarm init",
 		string(buffer.Bytes()),
 	}, "\n"))
@@ -543,6 +579,27 @@ systemctl start docker
 `
 )
 
+// bootScript is the script run by instances of a group before their flavor configures them.
+func (s *clusterSpec) bootScript(grp instanceGroupSpec) string {
+	script := ""
+	if s.Logs != nil {
+		script = logsScript(s.cluster().logGroupName())
+	}
+	if s.ECRCredentialHelper {
+		script += ecrCredentialHelperScript
+	}
+	if s.SSMAccess != nil {
+		script += ssmAgentScript
+	}
+	if s.fileSystemID != "" {
+		script += mountScript(s.fileSystemDNSName(), s.SharedStorage.mountPath())
+	}
+	if grp.isManager() {
+		script += initializeManager
+	}
+	return script
+}
+
 const (
 	managerGroup = `{
   "ID": {{.ID}},
@@ -551,7 +608,7 @@ const (
       "LogicalIDs": {{.ManagerIPs}}
     },
     "Instance": {
-      "Plugin": "instance-aws",
+      "Plugin": {{.InstancePlugin}},
       "Properties": {{.CreateInstanceRequest}}
     },
     "Flavor": {
@@ -570,7 +627,8 @@ const (
           {
             "Plugin": "flavor-swarm",
             "Properties": {
-              "Type": "manager",
+              "Type": "manager",{{ if .JoinAddress }}
+              "JoinAddress": {{.JoinAddress}},{{ end }}
               "DockerRestartCommand": "systemctl restart docker"
             }
           }
@@ -587,55 +645,161 @@ const (
       "Size": {{.WorkerCount}}
     },
     "Instance": {
-      "Plugin": "instance-aws",
+      "Plugin": {{.InstancePlugin}},
       "Properties": {{.CreateInstanceRequest}}
     },
-    "Flavor": {
+    "Flavor": {{ if .BootScript }}{
+      "Plugin": "flavor-combo",
+      "Properties": {
+        "Flavors": [
+          {
+            "Plugin": "flavor-vanilla",
+            "Properties": {
+              "Init": [
+                "#!/bin/bash",
+                {{.BootScript}}
+              ]
+            }
+          },
+          {
+            "Plugin": "flavor-swarm",
+            "Properties": {
+              "Type": "worker",{{ if .JoinAddress }}
+              "JoinAddress": {{.JoinAddress}},{{ end }}
+              "DockerRestartCommand": "systemctl restart docker"
+            }
+          }
+        ]
+      }
+    }{{ else }}{
       "Plugin": "flavor-swarm",
       "Properties": {
-        "Type": "worker",
+        "Type": "worker",{{ if .JoinAddress }}
+        "JoinAddress": {{.JoinAddress}},{{ end }}
         "DockerRestartCommand": "systemctl restart docker"
       }
-    }
+    }{{ end }}
   }
 }`
 )
 
-func bootstrap(spec clusterSpec) error {
+// bootstrap creates a cluster, returning the outputs of its resources.  Instances are provisioned once the network
+// resources they depend on are available, waiting up to networkTimeout.  The cluster is not created if it exceeds its
+// budget, unless overrideBudget is set.
+func bootstrap(spec clusterSpec, networkTimeout time.Duration, overrideBudget bool) (*clusterOutputs, error) {
 	sess := spec.cluster().getAWSClient()
 
-	keyNames := []*string{}
+	err := spec.resolveSubnets(ec2.New(sess))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = spec.resolveImageChannels(sess, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = spec.resolveInstanceTypes(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	err = spec.verify(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	err = spec.checkQuotas(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	err = spec.checkBudget(sess)
+	if err != nil {
+		if !overrideBudget {
+			return nil, fmt.Errorf("%s\nSet --override-budget to create the cluster regardless", err)
+		}
+		log.Warnf("Creating the cluster over its budget: %s", err)
+	}
+
+	err = spec.checkPermissions(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	// Key pairs are verified with each group's credentials, since groups may be provisioned in other accounts.
 	for _, g := range spec.Groups {
-		keyNames = append(keyNames, g.Config.RunInstancesInput.KeyName)
+		if g.Config.RunInstancesInput.KeyName == nil {
+			continue
+		}
+		_, err := ec2.New(spec.cluster().getGroupAWSClient(sess, g)).DescribeKeyPairs(&ec2.DescribeKeyPairsInput{
+			KeyNames: []*string{g.Config.RunInstancesInput.KeyName},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("In group %s: %s", g.Name, err)
+		}
 	}
 
 	ec2Client := ec2.New(sess)
-	_, err := ec2Client.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{
-		KeyNames: keyNames,
-	})
+
+	err = createAccessRole(sess, &spec)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = createAccessRole(sess, &spec)
+	if spec.Logs != nil {
+		err = createLogGroup(sess, &spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = createWorkerRole(sess, &spec)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if spec.hasAlarms() {
+		err = createAlarmTopic(sess, &spec)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	vpcID, err := createNetwork(sess, &spec)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if spec.ManagerLoadBalancer {
+		err = createManagerLoadBalancer(sess, &spec, vpcID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.SharedStorage != nil {
+		err = createSharedStorage(sess, &spec, vpcID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("Waiting for network resources to become available")
+	err = waitUntilReady(spec.networkDependencies(ec2Client, vpcID), networkTimeout)
+	if err != nil {
+		return nil, err
 	}
 
 	err = createEBSVolumes(sess, spec)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create one manager instance.  The manager boot container will handle setting up other containers.
 	err = startInitialManager(sess, spec)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	getInstances := func(req *ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
@@ -653,11 +817,12 @@ func bootstrap(spec clusterSpec) error {
 
 	instances, err := getInstances(&ec2.DescribeInstancesInput{Filters: spec.cluster().resourceFilter(vpcID)})
 	if err != nil {
-		return fmt.Errorf("Failed to fetch boot leader: %s", err)
+		return nil, fmt.Errorf("Failed to fetch boot leader: %s", err)
 	}
+	outputs := spec.outputs(vpcID)
 	if len(instances) != 1 {
 		log.Warnf("Expected exactly one instance to be starting up, but found %d", len(instances))
-		return nil
+		return outputs, nil
 	}
 
 	// Public IP addresses are assigned some time between when an instance is started and when it enters running.
@@ -666,20 +831,33 @@ func bootstrap(spec clusterSpec) error {
 	getBootLeader := ec2.DescribeInstancesInput{InstanceIds: []*string{instances[0].InstanceId}}
 	err = ec2Client.WaitUntilInstanceRunning(&getBootLeader)
 	if err != nil {
-		return fmt.Errorf("Failed while waiting for boot leader to start up: %s", err)
+		return nil, fmt.Errorf("Failed while waiting for boot leader to start up: %s", err)
 	}
 
 	leaders, err := getInstances(&getBootLeader)
 	if err != nil {
-		return fmt.Errorf("Failed to fetch boot leader: %s", err)
+		return nil, fmt.Errorf("Failed to fetch boot leader: %s", err)
 	}
 	if len(leaders) != 1 {
-		log.Warnf("Expected exactly one boot leader, but found %s", len(instances))
-		return nil
+		log.Warnf("Expected exactly one boot leader, but found %d", len(leaders))
+		return outputs, nil
 	}
 
 	leader := leaders[0]
-	if leader.PublicIpAddress == nil {
+	outputs.BootLeader = newInstanceOutputs(leader)
+	if spec.SSMAccess != nil {
+		outputs.SessionManager = newSessionManagerOutputs(spec.cluster().region, *leader.InstanceId)
+		if err := runBootLeaderCommands(sess, *spec.SSMAccess, *leader.InstanceId); err != nil {
+			return nil, err
+		}
+
+		log.Infof("")
+		log.Infof("Your Docker cluster is now booting!")
+		log.Infof("")
+		log.Infof("It may take a few more minutes for the cluster to be ready, at which point you can connect")
+		log.Infof("to the boot leader with Session Manager by running '%s'.", outputs.SessionManager.Command)
+		log.Infof("You can see other nodes that have joined the cluster by running 'docker node ls'")
+	} else if leader.PublicIpAddress == nil {
 		log.Warnf(
 			"Expected instances to have public IPs but %s does not",
 			*leader.InstanceId)
@@ -693,46 +871,66 @@ func bootstrap(spec clusterSpec) error {
 		log.Infof("You can see other nodes tha thave joined the cluster by running 'docker node ls'")
 	}
 
-	return nil
+	if spec.managerEndpoint != "" {
+		log.Infof("Managers are reachable within the VPC through the load balancer at %s", spec.managerEndpoint)
+	}
+
+	return outputs, nil
 }
 
 func generateInfraKitGroups(spec clusterSpec) (map[group.ID]string, error) {
 	groups := map[group.ID]string{}
 
 	for _, grp := range spec.Groups {
-		buffer := bytes.Buffer{}
-		templateText := ""
-		templateParams := map[string]interface{}{
-			"CreateInstanceRequest": grp.Config,
-			"ID": grp.Name,
+		groupSpec, err := spec.groupSpec(grp)
+		if err != nil {
+			return nil, err
 		}
+		groups[grp.Name] = groupSpec
+	}
 
-		if grp.isManager() {
-			templateText = managerGroup
-			templateParams["ManagerIPs"] = spec.ManagerIPs
-			templateParams["BootScript"] = initializeManager
-		} else {
-			templateText = workerGroup
-			templateParams["WorkerCount"] = grp.Size
-		}
+	return groups, nil
+}
 
-		// Convert all template parameters to JSON.
-		for k, v := range templateParams {
-			vJSON, err := json.MarshalIndent(v, "      ", "  ")
-			if err != nil {
-				return nil, err
-			}
+// groupSpec renders the InfraKit group spec of a group.
+func (s *clusterSpec) groupSpec(grp instanceGroupSpec) (string, error) {
+	buffer := bytes.Buffer{}
+	templateText := ""
+	templateParams := map[string]interface{}{
+		"CreateInstanceRequest": grp.Config,
+		"ID":                    grp.Name,
+		"InstancePlugin":        grp.instancePluginName(),
+	}
+	if s.managerEndpoint != "" {
+		templateParams["JoinAddress"] = s.managerEndpoint
+	}
 
-			templateParams[k] = string(vJSON)
+	if grp.isManager() {
+		templateText = managerGroup
+		templateParams["ManagerIPs"] = s.ManagerIPs
+		templateParams["BootScript"] = grp.bootScript
+	} else {
+		templateText = workerGroup
+		templateParams["WorkerCount"] = grp.Size
+		if grp.bootScript != "" {
+			templateParams["BootScript"] = grp.bootScript
 		}
+	}
 
-		err := template.Must(template.New("").Parse(templateText)).Execute(&buffer, templateParams)
+	// Convert all template parameters to JSON.
+	for k, v := range templateParams {
+		vJSON, err := json.MarshalIndent(v, "      ", "  ")
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
-		groups[grp.Name] = string(buffer.Bytes())
+		templateParams[k] = string(vJSON)
 	}
 
-	return groups, nil
+	err := template.Must(template.New("").Parse(templateText)).Execute(&buffer, templateParams)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buffer.Bytes()), nil
 }
@@ -0,0 +1,85 @@
+package bootstrap
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// groupDefaults are launch settings inherited by every group of a cluster that does not set them.
+type groupDefaults struct {
+	// IamInstanceProfile is the instance profile of worker groups.  Managers always use the manager profile created
+	// for the cluster.
+	IamInstanceProfile *ec2.IamInstanceProfileSpecification `json:",omitempty"`
+
+	KeyName string `json:",omitempty"`
+
+	// SecurityGroupIds are added to the security groups of every group, along with those created for the cluster.
+	SecurityGroupIds []string `json:",omitempty"`
+
+	// Tags are added to the tags of every group, which take precedence for the same keys.
+	Tags map[string]string `json:",omitempty"`
+
+	// Monitoring enables detailed CloudWatch monitoring.
+	Monitoring *bool `json:",omitempty"`
+
+	// CreditSpecification is the credit option of burstable instance types, standard or unlimited.  Groups of other
+	// instance types ignore it.
+	CreditSpecification string `json:",omitempty"`
+}
+
+// apply sets the defaults that a group does not override.
+func (d *groupDefaults) apply(group *instanceGroupSpec) {
+	if d == nil {
+		return
+	}
+	run := &group.Config.RunInstancesInput
+
+	if d.IamInstanceProfile != nil && !group.isManager() && run.IamInstanceProfile == nil {
+		profile := *d.IamInstanceProfile
+		run.IamInstanceProfile = &profile
+	}
+
+	if d.KeyName != "" && run.KeyName == nil {
+		run.KeyName = aws.String(d.KeyName)
+	}
+
+	if len(d.SecurityGroupIds) > 0 {
+		groups := &run.SecurityGroupIds
+		if len(run.NetworkInterfaces) > 0 {
+			groups = &run.NetworkInterfaces[0].Groups
+		}
+		present := map[string]bool{}
+		for _, id := range *groups {
+			present[aws.StringValue(id)] = true
+		}
+		for _, id := range d.SecurityGroupIds {
+			if !present[id] {
+				*groups = append(*groups, aws.String(id))
+			}
+		}
+	}
+
+	if d.Monitoring != nil && run.Monitoring == nil {
+		run.Monitoring = &ec2.RunInstancesMonitoringEnabled{Enabled: aws.Bool(*d.Monitoring)}
+	}
+
+	if d.CreditSpecification != "" && group.Config.CreditSpecification == "" {
+		group.Config.CreditSpecification = d.CreditSpecification
+	}
+}
+
+// applyTags adds the default tags that a group does not override.
+func (d *groupDefaults) applyTags(group *instanceGroupSpec) {
+	if d == nil || len(d.Tags) == 0 {
+		return
+	}
+
+	tags := map[string]string{}
+	for key, value := range d.Tags {
+		tags[key] = value
+	}
+	for key, value := range group.Config.Tags {
+		tags[key] = value
+	}
+	group.Config.Tags = tags
+}
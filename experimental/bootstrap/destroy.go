@@ -1,12 +1,12 @@
 package bootstrap
 
 import (
-	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
+	infrakit_instance "github.com/docker/infrakit.aws/plugin/instance"
 )
 
 func destroyInstances(config client.ConfigProvider, cluster clusterID, vpcID string) {
@@ -20,13 +20,26 @@ func destroyInstances(config client.ConfigProvider, cluster clusterID, vpcID str
 		return
 	}
 
+	instances := []*ec2.Instance{}
 	instanceIDs := []*string{}
 	for _, reservation := range instancesResp.Reservations {
 		for _, instance := range reservation.Instances {
+			instances = append(instances, instance)
 			instanceIDs = append(instanceIDs, instance.InstanceId)
 		}
 	}
 
+	// Managers may have termination protection enabled, which must be disabled for each instance.
+	for _, id := range instanceIDs {
+		_, err := ec2Client.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+			InstanceId:            id,
+			DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(false)},
+		})
+		if err != nil {
+			log.Warnf("  failed to disable termination protection of %s: %s", *id, err)
+		}
+	}
+
 	if len(instanceIDs) > 0 {
 		nonPointerIds := []string{}
 		for _, id := range instanceIDs {
@@ -47,6 +60,10 @@ func destroyInstances(config client.ConfigProvider, cluster clusterID, vpcID str
 		if err != nil {
 			log.Warnf("  error while waiting for instances to terminate: %s", err)
 		}
+
+		if err := infrakit_instance.DeleteAlarms(config, instances); err != nil {
+			log.Warnf("  error while deleting instance alarms: %s", err)
+		}
 	} else {
 		log.Warnf("  did not find any instances to terminate")
 	}
@@ -76,38 +93,21 @@ func destroyEBSVolues(config client.ConfigProvider, cluster clusterID) {
 
 func destroyAccessRoles(config client.ConfigProvider, cluster clusterID) {
 	log.Info("Destroying IAM resources")
-	iamClient := iam.New(config)
-
-	_, err := iamClient.RemoveRoleFromInstanceProfile(&iam.RemoveRoleFromInstanceProfileInput{
-		InstanceProfileName: aws.String(cluster.instanceProfileName()),
-		RoleName:            aws.String(cluster.roleName()),
-	})
-	if err != nil {
-		log.Warnf("  error while removing role from instance profile: %s", err)
-	}
-
-	log.Infof("  instance profile %s", cluster.instanceProfileName())
-	_, err = iamClient.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{
-		InstanceProfileName: aws.String(cluster.instanceProfileName()),
-	})
-	if err != nil {
-		log.Warnf("  error while deleting instance profile: %s", err)
-	}
+	destroyClusterRole(config, cluster, cluster.roleName(), cluster.instanceProfileName())
+	destroyClusterRole(config, cluster, cluster.workerRoleName(), cluster.workerInstanceProfileName())
 
+	// The manager policy is detached from the role when it is deleted.
 	// There must be a better way...but i couldn't find another way to look up the policy ARN.
+	iamClient := iam.New(config)
 	policies, err := iamClient.ListPolicies(&iam.ListPoliciesInput{
 		Scope: aws.String("Local"),
 	})
+	if err != nil {
+		log.Warnf("  error while listing policies: %s", err)
+		return
+	}
 	for _, policy := range policies.Policies {
 		if *policy.PolicyName == cluster.managerPolicyName() {
-			_, err = iamClient.DetachRolePolicy(&iam.DetachRolePolicyInput{
-				RoleName:  aws.String(cluster.roleName()),
-				PolicyArn: policy.Arn,
-			})
-			if err != nil {
-				log.Warnf("  error while detaching role policy: %s", err)
-			}
-
 			log.Infof("  policy %s", *policy.Arn)
 			_, err = iamClient.DeletePolicy(&iam.DeletePolicyInput{
 				PolicyArn: policy.Arn,
@@ -117,38 +117,52 @@ func destroyAccessRoles(config client.ConfigProvider, cluster clusterID) {
 			}
 		}
 	}
+}
 
+func destroySecurityGroups(ec2Client *ec2.EC2, cluster clusterID, vpcID string) {
+	securityGroups, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: cluster.resourceFilter(vpcID),
+	})
 	if err != nil {
-		log.Warnf("  error while deleting role policy: %s", err)
+		log.Warnf("  error while describing security groups: %s", err)
+		return
 	}
 
-	log.Infof("  role %s", cluster.roleName())
-	_, err = iamClient.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String(cluster.roleName())})
-	if err != nil {
-		log.Warnf("  error while deleting IAM role: %s", err)
+	for _, securityGroup := range securityGroups.SecurityGroups {
+		log.Infof("  security group %s", *securityGroup.GroupId)
+		_, err = ec2Client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{
+			GroupId: securityGroup.GroupId,
+		})
+		if err != nil {
+			log.Warnf("  error while deleting security group: %s", err)
+		}
 	}
 }
 
+// destroyExistingNetwork deletes the resources a cluster created in an existing VPC, leaving the VPC and its
+// subnets.
+func destroyExistingNetwork(config client.ConfigProvider, cluster clusterID, vpcID string) {
+	log.Info("Destroying network resources")
+	ec2Client := ec2.New(config)
+
+	destroyNetworkInterfaces(ec2Client, cluster, vpcID)
+
+	destroySecurityGroups(ec2Client, cluster, vpcID)
+}
+
 func destroyNetwork(config client.ConfigProvider, cluster clusterID, vpcID string) {
 	log.Info("Destroying network resources")
 	ec2Client := ec2.New(config)
 
-	securityGroups, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
-		Filters: cluster.resourceFilter(vpcID),
-	})
-	if err == nil {
-		for _, securityGroup := range securityGroups.SecurityGroups {
-			log.Infof("  security group %s", *securityGroup.GroupId)
-			_, err = ec2Client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{
-				GroupId: securityGroup.GroupId,
-			})
-			if err != nil {
-				log.Warnf("  error while deleting security group: %s", err)
-			}
-		}
-	} else {
-		log.Warnf("  error while describing security groups: %s", err)
-	}
+	destroyVpcEndpoints(ec2Client, cluster, vpcID)
+
+	destroyNetworkInterfaces(ec2Client, cluster, vpcID)
+
+	destroySecurityGroups(ec2Client, cluster, vpcID)
+
+	destroyNATGateways(ec2Client, cluster, vpcID)
+
+	destroyConnections(config, ec2Client, cluster, vpcID)
 
 	subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: []*ec2.Filter{
 		{
@@ -220,6 +234,9 @@ func destroyNetwork(config client.ConfigProvider, cluster clusterID, vpcID strin
 		log.Warnf("  error while describing route tables: %s", err)
 	}
 
+	// The subnets of the network ACL were disassociated from it when they were deleted.
+	destroyNetworkACL(ec2Client, cluster, vpcID)
+
 	log.Infof("  VPC %s", vpcID)
 	_, err = ec2Client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)})
 	if err != nil {
@@ -227,39 +244,49 @@ func destroyNetwork(config client.ConfigProvider, cluster clusterID, vpcID strin
 	}
 }
 
-func destroy(cluster clusterID) error {
+// destroy deletes the resources of a cluster.  The instances, volumes, and roles of groups with their own credentials
+// are deleted with those credentials as well, since they may have been created in other accounts.
+func destroy(cluster clusterID, groups []instanceGroupSpec) error {
 	sess := cluster.getAWSClient()
 	ec2Client := ec2.New(sess)
-
-	vpcs, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: []*ec2.Filter{cluster.clusterFilter()}})
-	if err != nil {
-		return fmt.Errorf("Failed to look up VPC: %s", err)
-	}
+	groupConfigs := cluster.getGroupCredentialsAWSClients(sess, groups)
 
 	// TODO(wfarner): We omit the VPC ID from resource tags and allow more failure-resistant cleanup as long as we
 	// disallow clusters of the same name to exist within a region.
-	var vpcID string
-	switch len(vpcs.Vpcs) {
-	case 0:
-		log.Warnf("No VPCs found for cluster %s, unable to remove networks or instances", cluster.name)
-	case 1:
-		vpcID = *vpcs.Vpcs[0].VpcId
-	default:
-		log.Warnf(
-			"Found multiple VPCs for cluster %s, unable to remove networks or instances",
-			cluster.name)
+	vpcID, network, err := findClusterVpc(ec2Client, cluster)
+	if err != nil {
+		log.Warnf("%s, unable to remove networks or instances", err)
 	}
 
 	if vpcID != "" {
 		destroyInstances(sess, cluster, vpcID)
+		for _, config := range groupConfigs {
+			destroyInstances(config, cluster, vpcID)
+		}
 	}
 
+	destroyManagerLoadBalancer(sess, cluster)
+
+	destroySharedStorage(sess, cluster)
+
 	destroyEBSVolues(sess, cluster)
+	for _, config := range groupConfigs {
+		destroyEBSVolues(config, cluster)
+	}
 
 	destroyAccessRoles(sess, cluster)
+	for _, config := range groupConfigs {
+		destroyAccessRoles(config, cluster)
+	}
+
+	destroyAlarmTopic(sess, cluster)
 
 	if vpcID != "" {
-		destroyNetwork(sess, cluster, vpcID)
+		if network == createdNetwork {
+			destroyNetwork(sess, cluster, vpcID)
+		} else {
+			destroyExistingNetwork(sess, cluster, vpcID)
+		}
 	}
 
 	return nil
@@ -0,0 +1,20 @@
+package bootstrap
+
+// ecrCredentialHelperScript installs the Amazon ECR credential helper, and configures the Docker client to use it
+// for all registries, so that images may be pulled from ECR with the instance role.
+const ecrCredentialHelperScript = `
+# Authenticate to ECR with the instance role.
+(
+set -o errexit
+apt-get install -y amazon-ecr-credential-helper || yum install -y amazon-ecr-credential-helper
+
+for home in /root /home/ubuntu /home/ec2-user
+do
+  if [ -d "$home" ]
+  then
+    mkdir -p "$home/.docker"
+    echo '{"credsStore": "ecr-login"}' > "$home/.docker/config.json"
+  fi
+done
+) || echo "Failed to configure the ECR credential helper"
+`
@@ -0,0 +1,212 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"time"
+)
+
+const (
+	defaultMountPath = "/mnt/efs"
+	nfsPort          = 2049
+)
+
+// sharedStorage configures an EFS file system mounted by all instances of the cluster.
+type sharedStorage struct {
+	// PerformanceMode is the EFS performance mode, generalPurpose or maxIO.  Defaults to generalPurpose.
+	PerformanceMode string `json:",omitempty"`
+
+	// MountPath is where instances mount the file system.  Defaults to /mnt/efs.
+	MountPath string `json:",omitempty"`
+}
+
+func (s *sharedStorage) mountPath() string {
+	if s.MountPath == "" {
+		return defaultMountPath
+	}
+	return s.MountPath
+}
+
+// sharedStorageSecurityGroupName is the name of the security group of the shared file system's mount targets.
+func (c clusterID) sharedStorageSecurityGroupName() string {
+	return fmt.Sprintf("%s-SharedStorage", c.name)
+}
+
+// fileSystemToken is the creation token of the shared file system, which identifies it when the cluster is destroyed.
+func (c clusterID) fileSystemToken() string {
+	return fmt.Sprintf("%s-%s-shared", c.name, c.region)
+}
+
+func (s *clusterSpec) fileSystemDNSName() string {
+	return fmt.Sprintf("%s.efs.%s.amazonaws.com", s.fileSystemID, s.cluster().region)
+}
+
+// createSharedStorage creates the shared file system, with a mount target in the availability zone of each cluster
+// subnet.  Mount targets allow NFS traffic from within the VPC.
+func createSharedStorage(config client.ConfigProvider, spec *clusterSpec, vpcID string) error {
+	log.Info("Creating shared storage")
+	ec2Client := ec2.New(config)
+	efsClient := efs.New(config)
+
+	securityGroup, err := ec2Client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(spec.cluster().sharedStorageSecurityGroupName()),
+		Description: aws.String("Shared storage mount targets"),
+		VpcId:       aws.String(vpcID),
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("  security group %s", *securityGroup.GroupId)
+
+	err = configureSecurityGroup(ec2Client, *securityGroup.GroupId, sharedStorageSecurityGroupRules(spec.network))
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{securityGroup.GroupId},
+		Tags:      spec.resourceTags(),
+	})
+	if err != nil {
+		return err
+	}
+
+	input := &efs.CreateFileSystemInput{CreationToken: aws.String(spec.cluster().fileSystemToken())}
+	if spec.SharedStorage.PerformanceMode != "" {
+		input.PerformanceMode = aws.String(spec.SharedStorage.PerformanceMode)
+	}
+	fileSystem, err := efsClient.CreateFileSystem(input)
+	if err != nil {
+		return err
+	}
+	log.Infof("  file system %s, waiting for it to become available", *fileSystem.FileSystemId)
+
+	efsTags := []*efs.Tag{}
+	for _, tag := range spec.resourceTags() {
+		efsTags = append(efsTags, &efs.Tag{Key: tag.Key, Value: tag.Value})
+	}
+	_, err = efsClient.CreateTags(&efs.CreateTagsInput{FileSystemId: fileSystem.FileSystemId, Tags: efsTags})
+	if err != nil {
+		return err
+	}
+
+	for {
+		described, err := efsClient.DescribeFileSystems(&efs.DescribeFileSystemsInput{
+			FileSystemId: fileSystem.FileSystemId,
+		})
+		if err != nil {
+			return err
+		}
+		if len(described.FileSystems) == 1 &&
+			*described.FileSystems[0].LifeCycleState == efs.LifeCycleStateAvailable {
+			break
+		}
+		time.Sleep(5 * time.Second)
+	}
+
+	// A file system has at most one mount target in each availability zone, which serves all subnets in the zone.
+	subnetIDs := []*string{}
+	spec.mutateGroups(func(group *instanceGroupSpec) {
+		if subnet := subnetOf(group.Config.RunInstancesInput); subnet != nil {
+			subnetIDs = append(subnetIDs, subnet)
+		}
+	})
+	subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: subnetIDs})
+	if err != nil {
+		return err
+	}
+
+	zones := map[string]bool{}
+	for _, subnet := range subnets.Subnets {
+		if zones[*subnet.AvailabilityZone] {
+			continue
+		}
+		zones[*subnet.AvailabilityZone] = true
+
+		mountTarget, err := efsClient.CreateMountTarget(&efs.CreateMountTargetInput{
+			FileSystemId:   fileSystem.FileSystemId,
+			SubnetId:       subnet.SubnetId,
+			SecurityGroups: []*string{securityGroup.GroupId},
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("  mount target %s in %s", *mountTarget.MountTargetId, *subnet.AvailabilityZone)
+	}
+
+	spec.fileSystemID = *fileSystem.FileSystemId
+	return nil
+}
+
+// destroySharedStorage deletes the shared file system and its mount targets.  Mount targets must be deleted before
+// the file system, and before the network they are attached to.
+func destroySharedStorage(config client.ConfigProvider, cluster clusterID) {
+	efsClient := efs.New(config)
+
+	fileSystems, err := efsClient.DescribeFileSystems(&efs.DescribeFileSystemsInput{
+		CreationToken: aws.String(cluster.fileSystemToken()),
+	})
+	if err != nil {
+		log.Warnf("  error while looking up shared storage: %s", err)
+		return
+	}
+
+	for _, fileSystem := range fileSystems.FileSystems {
+		log.Info("Destroying shared storage")
+
+		mountTargets, err := efsClient.DescribeMountTargets(&efs.DescribeMountTargetsInput{
+			FileSystemId: fileSystem.FileSystemId,
+		})
+		if err != nil {
+			log.Warnf("  error while looking up mount targets: %s", err)
+			continue
+		}
+
+		for _, mountTarget := range mountTargets.MountTargets {
+			log.Infof("  mount target %s", *mountTarget.MountTargetId)
+			_, err := efsClient.DeleteMountTarget(&efs.DeleteMountTargetInput{MountTargetId: mountTarget.MountTargetId})
+			if err != nil {
+				log.Warnf("  error while deleting mount target: %s", err)
+			}
+		}
+
+		for i := 0; i < 60; i++ {
+			remaining, err := efsClient.DescribeMountTargets(&efs.DescribeMountTargetsInput{
+				FileSystemId: fileSystem.FileSystemId,
+			})
+			if err != nil || len(remaining.MountTargets) == 0 {
+				break
+			}
+			time.Sleep(5 * time.Second)
+		}
+
+		log.Infof("  file system %s", *fileSystem.FileSystemId)
+		_, err = efsClient.DeleteFileSystem(&efs.DeleteFileSystemInput{FileSystemId: fileSystem.FileSystemId})
+		if err != nil {
+			log.Warnf("  error while deleting file system: %s", err)
+		}
+	}
+}
+
+// mountScript mounts the shared file system, retrying while its mount targets become available.
+func mountScript(dnsName string, mountPath string) string {
+	return fmt.Sprintf(`
+# Mount the shared file system.
+(
+set -o errexit
+command -v mount.nfs4 > /dev/null || apt-get install -y nfs-common || yum install -y nfs-utils
+
+mkdir -p %[2]s
+echo "%[1]s:/ %[2]s nfs4 nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,_netdev 0 0" >> /etc/fstab
+for i in $(seq 1 30)
+do
+  mount %[2]s && break
+  sleep 10
+done
+) || echo "Failed to mount shared storage"
+`, dnsName, mountPath)
+}
@@ -0,0 +1,185 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const httpsPort = 443
+
+var (
+	// gatewayEndpointServices are services reached through gateway endpoints, which are routes of route tables.
+	// Other services are reached through interface endpoints in a subnet.
+	gatewayEndpointServices = map[string]bool{"s3": true, "dynamodb": true}
+
+	// endpointServiceAliases expand the names of services that are reached through several endpoints.
+	endpointServiceAliases = map[string][]string{
+		"ecr": {"ecr.api", "ecr.dkr"},
+		"ssm": {"ssm", "ssmmessages", "ec2messages"},
+	}
+)
+
+// endpointServices expands the services of VpcEndpoints to the names of their endpoint services, without duplicates.
+func endpointServices(services []string) []string {
+	expanded := map[string]bool{}
+	for _, service := range services {
+		if aliases, has := endpointServiceAliases[service]; has {
+			for _, alias := range aliases {
+				expanded[alias] = true
+			}
+		} else {
+			expanded[service] = true
+		}
+	}
+
+	names := []string{}
+	for name := range expanded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// endpointsSecurityGroupName is the name of the security group of the cluster's interface endpoints.
+func (c clusterID) endpointsSecurityGroupName() string {
+	return fmt.Sprintf("%s-Endpoints", c.name)
+}
+
+func endpointsSecurityGroupRules(network clusterNetwork) securityGroupRules {
+	return securityGroupRules{
+		Ingress: []securityGroupRule{tcpPort(httpsPort, network.vpcCIDR)},
+		Egress:  []securityGroupRule{allTraffic(anywhereCIDR)},
+	}
+}
+
+// createVpcEndpoints creates the VPC endpoints of the services of a cluster.  Gateway endpoints are added to the route
+// tables of the cluster, and interface endpoints are created in a subnet with private DNS enabled, so that the regional
+// service names resolve to the endpoints throughout the VPC.
+func createVpcEndpoints(ec2Client *ec2.EC2, spec *clusterSpec, vpcID string, subnetID *string) error {
+	log.Info("Creating VPC endpoints")
+	cluster := spec.cluster()
+
+	routeTables, err := ec2Client.DescribeRouteTables(
+		&ec2.DescribeRouteTablesInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return err
+	}
+	routeTableIDs := []*string{}
+	for _, routeTable := range routeTables.RouteTables {
+		routeTableIDs = append(routeTableIDs, routeTable.RouteTableId)
+	}
+
+	var securityGroupID *string
+	endpointIDs := []*string{}
+	for _, service := range endpointServices(spec.VpcEndpoints) {
+		serviceName := fmt.Sprintf("com.amazonaws.%s.%s", cluster.region, service)
+		input := &ec2.CreateVpcEndpointInput{VpcId: aws.String(vpcID), ServiceName: aws.String(serviceName)}
+
+		// The vendored SDK only models gateway endpoints, so interface endpoints are requested with parameters of a
+		// newer API version.
+		params := url.Values{}
+		if gatewayEndpointServices[service] {
+			input.RouteTableIds = routeTableIDs
+			params.Set("VpcEndpointType", "Gateway")
+		} else {
+			if securityGroupID == nil {
+				securityGroupID, err = createEndpointsSecurityGroup(ec2Client, spec, vpcID)
+				if err != nil {
+					return err
+				}
+			}
+			params.Set("VpcEndpointType", "Interface")
+			params.Set("SubnetId.1", *subnetID)
+			params.Set("SecurityGroupId.1", *securityGroupID)
+			params.Set("PrivateDnsEnabled", "true")
+		}
+
+		req, endpoint := ec2Client.CreateVpcEndpointRequest(input)
+		if err := ec2ext.Send(req, params); err != nil {
+			return fmt.Errorf("Failed to create VPC endpoint of %s: %s", serviceName, err)
+		}
+		log.Infof("  %s endpoint %s", service, *endpoint.VpcEndpoint.VpcEndpointId)
+		endpointIDs = append(endpointIDs, endpoint.VpcEndpoint.VpcEndpointId)
+	}
+
+	if len(endpointIDs) == 0 {
+		return nil
+	}
+	_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{Resources: endpointIDs, Tags: spec.resourceTags()})
+	return err
+}
+
+func createEndpointsSecurityGroup(ec2Client *ec2.EC2, spec *clusterSpec, vpcID string) (*string, error) {
+	securityGroup, err := ec2Client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(spec.cluster().endpointsSecurityGroupName()),
+		Description: aws.String("VPC endpoints of AWS services"),
+		VpcId:       aws.String(vpcID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("  security group %s", *securityGroup.GroupId)
+
+	err = configureSecurityGroup(ec2Client, *securityGroup.GroupId, endpointsSecurityGroupRules(spec.network))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{securityGroup.GroupId},
+		Tags:      spec.resourceTags(),
+	})
+	return securityGroup.GroupId, err
+}
+
+// destroyVpcEndpoints deletes the VPC endpoints of a cluster, waiting for interface endpoints to release their
+// network interfaces, which otherwise prevent their subnet and security group from being deleted.
+func destroyVpcEndpoints(ec2Client *ec2.EC2, cluster clusterID, vpcID string) {
+	endpoints, err := describeVpcEndpoints(ec2Client, cluster.resourceFilter(vpcID))
+	if err != nil {
+		log.Warnf("  error while describing VPC endpoints: %s", err)
+		return
+	}
+
+	endpointIDs := []*string{}
+	for _, endpoint := range endpoints {
+		log.Infof("  VPC endpoint %s", *endpoint.VpcEndpointId)
+		endpointIDs = append(endpointIDs, endpoint.VpcEndpointId)
+	}
+	if len(endpointIDs) == 0 {
+		return
+	}
+
+	_, err = ec2Client.DeleteVpcEndpoints(&ec2.DeleteVpcEndpointsInput{VpcEndpointIds: endpointIDs})
+	if err != nil {
+		log.Warnf("  error while deleting VPC endpoints: %s", err)
+		return
+	}
+
+	for i := 0; i < 60; i++ {
+		remaining, err := describeVpcEndpoints(ec2Client, append(cluster.resourceFilter(vpcID), &ec2.Filter{
+			Name:   aws.String("vpc-endpoint-state"),
+			Values: aws.StringSlice([]string{"pending", "available", "deleting"}),
+		}))
+		if err != nil || len(remaining) == 0 {
+			break
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// describeVpcEndpoints describes VPC endpoints with the API version of ec2ext, since the vendored SDK's version does not
+// support tag filters of endpoints.
+func describeVpcEndpoints(ec2Client *ec2.EC2, filters []*ec2.Filter) ([]*ec2.VpcEndpoint, error) {
+	req, output := ec2Client.DescribeVpcEndpointsRequest(&ec2.DescribeVpcEndpointsInput{Filters: filters})
+	if err := ec2ext.Send(req, nil); err != nil {
+		return nil, err
+	}
+	return output.VpcEndpoints, nil
+}
@@ -0,0 +1,350 @@
+package bootstrap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/docker/infrakit.aws/plugin/strict"
+	"github.com/docker/infrakit.aws/plugin/yaml"
+	"github.com/docker/infrakit/spi/group"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const archiveVersion = 1
+
+// archiveManifest describes a cluster archive.
+type archiveManifest struct {
+	Version  int
+	Cluster  string
+	Region   string
+	Exported time.Time
+}
+
+// clusterArchive is the definition and state of a cluster, for recreating it elsewhere.  It is written as a gzipped
+// tar of manifest.json, cluster.json, inventory.json, and groups/<group>.json.
+type clusterArchive struct {
+	Manifest archiveManifest
+
+	// Spec is the cluster spec, as JSON of the current schema version.
+	Spec json.RawMessage
+
+	// Groups are the committed group specs in the state bucket of the cluster, by group.
+	Groups map[string]json.RawMessage
+
+	// Inventory is the resources of the cluster, such as the instances of each group with their logical IDs and
+	// slots.
+	Inventory clusterInventory
+}
+
+// exportCluster collects the archive of a cluster.  specDocument is the cluster spec as it was read.
+func exportCluster(config client.ConfigProvider, spec clusterSpec, specDocument []byte) (clusterArchive, error) {
+	archive := clusterArchive{
+		Manifest: archiveManifest{
+			Version:  archiveVersion,
+			Cluster:  spec.ClusterName,
+			Region:   spec.cluster().region,
+			Exported: time.Now().UTC(),
+		},
+		Spec:   json.RawMessage(specDocument),
+		Groups: map[string]json.RawMessage{},
+	}
+
+	if spec.State != nil {
+		groups, err := committedGroups(config, spec)
+		if err != nil {
+			return archive, err
+		}
+		for name := range groups {
+			committed := json.RawMessage{}
+			if err := spec.stateSnapshot(config, groupStateKey(group.ID(name))).Load(&committed); err != nil {
+				return archive, fmt.Errorf("Failed to load committed spec of group %s: %s", name, err)
+			}
+			if len(committed) > 0 {
+				archive.Groups[name] = committed
+			}
+		}
+	}
+
+	inventory, err := describeCluster(config, spec.cluster())
+	if err != nil {
+		return archive, err
+	}
+	archive.Inventory = inventory
+	return archive, nil
+}
+
+func writeArchive(out io.Writer, archive clusterArchive) error {
+	files := map[string]interface{}{
+		"manifest.json":  archive.Manifest,
+		"cluster.json":   archive.Spec,
+		"inventory.json": archive.Inventory,
+	}
+	for name, committed := range archive.Groups {
+		files["groups/"+name+".json"] = committed
+	}
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compressed := gzip.NewWriter(out)
+	archiveWriter := tar.NewWriter(compressed)
+	for _, name := range names {
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: archive.Manifest.Exported,
+		}
+		if err := archiveWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archiveWriter.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := archiveWriter.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+func readArchive(in io.Reader) (clusterArchive, error) {
+	archive := clusterArchive{Groups: map[string]json.RawMessage{}}
+
+	compressed, err := gzip.NewReader(in)
+	if err != nil {
+		return archive, fmt.Errorf("Failed to read archive: %s", err)
+	}
+	archiveReader := tar.NewReader(compressed)
+	for {
+		header, err := archiveReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return archive, fmt.Errorf("Failed to read archive: %s", err)
+		}
+		data, err := ioutil.ReadAll(archiveReader)
+		if err != nil {
+			return archive, err
+		}
+
+		switch {
+		case header.Name == "manifest.json":
+			err = json.Unmarshal(data, &archive.Manifest)
+		case header.Name == "cluster.json":
+			archive.Spec = json.RawMessage(data)
+		case header.Name == "inventory.json":
+			err = json.Unmarshal(data, &archive.Inventory)
+		case strings.HasPrefix(header.Name, "groups/"):
+			archive.Groups[strings.TrimSuffix(path.Base(header.Name), ".json")] = json.RawMessage(data)
+		}
+		if err != nil {
+			return archive, fmt.Errorf("Failed to read %s of archive: %s", header.Name, err)
+		}
+	}
+
+	if archive.Manifest.Version != archiveVersion {
+		return archive, fmt.Errorf("Unsupported archive version %d", archive.Manifest.Version)
+	}
+	if len(archive.Spec) == 0 {
+		return archive, fmt.Errorf("Archive has no cluster spec")
+	}
+	return archive, nil
+}
+
+// importMapping translates the resources of an exported cluster to those of the region or account it is imported
+// into.  Images and subnets are specific to a region, so they must be mapped when the region changes.
+type importMapping struct {
+	// Region is the region the cluster is imported into, defaulting to the region it was exported from.
+	Region string `json:",omitempty"`
+
+	// ClusterName renames the cluster, such as when it is imported alongside the original.
+	ClusterName string `json:",omitempty"`
+
+	// StateBucket replaces the state bucket of the cluster, since bucket names are global.
+	StateBucket string `json:",omitempty"`
+
+	AvailabilityZones map[string]string `json:",omitempty"`
+	Images            map[string]string `json:",omitempty"`
+	Subnets           map[string]string `json:",omitempty"`
+}
+
+// readMapping reads an import mapping file, as JSON or YAML.
+func readMapping(mappingFile string) (importMapping, error) {
+	mapping := importMapping{}
+	data, err := ioutil.ReadFile(mappingFile)
+	if err != nil {
+		return mapping, fmt.Errorf("Failed to read mapping file: %s", err)
+	}
+	if !yaml.IsJSON(data) {
+		if data, err = yaml.ToJSON(data); err != nil {
+			return mapping, err
+		}
+	}
+	if err := strict.Unmarshal(data, &mapping); err != nil {
+		return mapping, fmt.Errorf("Invalid mapping file: %s", err)
+	}
+	return mapping, nil
+}
+
+// committedGroupSpec is the part of a committed group spec that is imported.
+type committedGroupSpec struct {
+	Properties struct {
+		Allocation struct {
+			Size int
+		}
+		Instance struct {
+			Properties struct {
+				RunInstancesInput struct {
+					ImageId      *string
+					InstanceType *string
+				}
+			}
+		}
+	}
+}
+
+// remapper translates resource IDs, collecting the IDs that have no mapping.
+type remapper struct {
+	required bool
+	unmapped map[string]bool
+}
+
+func (r *remapper) remap(kind string, mapping map[string]string, id *string) *string {
+	if id == nil || *id == "" {
+		return id
+	}
+	if mapped, has := mapping[*id]; has {
+		return aws.String(mapped)
+	}
+	if r.required {
+		r.unmapped[fmt.Sprintf("%s %s", kind, *id)] = true
+	}
+	return id
+}
+
+// remapImages translates the images a group launches.
+func (r *remapper) remapImages(grp *instanceGroupSpec, images map[string]string) {
+	grp.Config.RunInstancesInput.ImageId = r.remap("image", images, grp.Config.RunInstancesInput.ImageId)
+	for j, option := range grp.Config.InstanceTypes {
+		grp.Config.InstanceTypes[j].ImageID = aws.StringValue(r.remap("image", images, aws.String(option.ImageID)))
+	}
+}
+
+// importCluster translates an exported cluster to a cluster spec for the region of a mapping.  The sizes, images,
+// and instance types of committed group specs replace those of the spec, since groups may have been scaled or updated
+// since the cluster was created.  Other resources of the cluster, such as its network, are created by bootstrap.
+func importCluster(archive clusterArchive, mapping importMapping) (clusterSpec, error) {
+	spec := clusterSpec{}
+	if err := strict.Unmarshal(archive.Spec, &spec); err != nil {
+		return spec, fmt.Errorf("Invalid cluster spec in archive: %s", err)
+	}
+
+	for i, grp := range spec.Groups {
+		data, has := archive.Groups[string(grp.Name)]
+		if !has {
+			continue
+		}
+		committed := committedGroupSpec{}
+		if err := json.Unmarshal(data, &committed); err != nil {
+			return spec, fmt.Errorf("Invalid committed spec of group %s: %s", grp.Name, err)
+		}
+
+		run := &spec.Groups[i].Config.RunInstancesInput
+		if !grp.isManager() {
+			spec.Groups[i].Size = committed.Properties.Allocation.Size
+		}
+		if image := committed.Properties.Instance.Properties.RunInstancesInput.ImageId; image != nil {
+			run.ImageId = image
+		}
+		if instanceType := committed.Properties.Instance.Properties.RunInstancesInput.InstanceType; instanceType != nil {
+			run.InstanceType = instanceType
+		}
+		log.Infof("Imported the committed size and image of group %s", grp.Name)
+	}
+
+	exportedRegion := archive.Manifest.Region
+	if mapping.Region != "" && mapping.Region != exportedRegion {
+		spec.Region = mapping.Region
+	}
+	if mapping.ClusterName != "" {
+		spec.ClusterName = mapping.ClusterName
+	}
+	if mapping.StateBucket != "" && spec.State != nil {
+		spec.State.Bucket = mapping.StateBucket
+	}
+
+	r := remapper{required: spec.Region != "" && spec.Region != exportedRegion, unmapped: map[string]bool{}}
+	for i := range spec.Groups {
+		grp := &spec.Groups[i]
+		run := &grp.Config.RunInstancesInput
+
+		if run.Placement != nil {
+			run.Placement.AvailabilityZone = r.remap(
+				"availability zone", mapping.AvailabilityZones, run.Placement.AvailabilityZone)
+		}
+		r.remapImages(grp, mapping.Images)
+		run.SubnetId = r.remap("subnet", mapping.Subnets, run.SubnetId)
+		for _, networkInterface := range run.NetworkInterfaces {
+			networkInterface.SubnetId = r.remap("subnet", mapping.Subnets, networkInterface.SubnetId)
+		}
+		for j, networkInterface := range grp.Config.NetworkInterfaces {
+			grp.Config.NetworkInterfaces[j].SubnetID = aws.StringValue(
+				r.remap("subnet", mapping.Subnets, aws.String(networkInterface.SubnetID)))
+		}
+		for j, option := range grp.Config.AvailabilityZones {
+			grp.Config.AvailabilityZones[j].AvailabilityZone = aws.StringValue(
+				r.remap("availability zone", mapping.AvailabilityZones, aws.String(option.AvailabilityZone)))
+			grp.Config.AvailabilityZones[j].SubnetID = aws.StringValue(
+				r.remap("subnet", mapping.Subnets, aws.String(option.SubnetID)))
+		}
+		if grp.Subnets != nil {
+			for j, id := range grp.Subnets.IDs {
+				grp.Subnets.IDs[j] = aws.StringValue(r.remap("subnet", mapping.Subnets, aws.String(id)))
+			}
+		}
+	}
+
+	if len(r.unmapped) > 0 {
+		unmapped := []string{}
+		for id := range r.unmapped {
+			unmapped = append(unmapped, id)
+		}
+		sort.Strings(unmapped)
+		return spec, fmt.Errorf(
+			"The mapping must translate these resources to region %s: %s", spec.Region, strings.Join(unmapped, ", "))
+	}
+
+	if err := spec.validate(); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
+
+// printClusterSpec prints a cluster spec as indented JSON, for use with the create command.
+func printClusterSpec(out io.Writer, spec clusterSpec) error {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, bytes.NewReader(append(data, '\n')))
+	return err
+}
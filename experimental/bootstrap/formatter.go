@@ -39,14 +39,23 @@ func formatVolumes(config client.ConfigProvider, spec clusterSpec, volumeIDs []*
 		return fmt.Errorf("Failed to generate UserData: %s", err)
 	}
 
+	managers, err := spec.managers()
+	if err != nil {
+		return err
+	}
+	az, err := spec.availabilityZone()
+	if err != nil {
+		return err
+	}
+
 	// TODO(wfarner): Need to pick the appropriate image based on the region.
 	ec2Client := ec2.New(config)
 	instance, err := ec2Client.RunInstances(&ec2.RunInstancesInput{
 		InstanceType: aws.String("t2.micro"),
-		KeyName:      spec.managers().Config.RunInstancesInput.KeyName,
+		KeyName:      managers.Config.RunInstancesInput.KeyName,
 		ImageId:      aws.String("ami-99c812f9"),
 		Placement: &ec2.Placement{
-			AvailabilityZone: aws.String(spec.availabilityZone()),
+			AvailabilityZone: aws.String(az),
 		},
 		UserData: aws.String(base64.StdEncoding.EncodeToString([]byte(buffer.String()))),
 		MinCount: aws.Int64(1),
@@ -59,13 +68,10 @@ func formatVolumes(config client.ConfigProvider, spec clusterSpec, volumeIDs []*
 
 	_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
 		Resources: []*string{formatterInstance},
-		Tags: []*ec2.Tag{
-			spec.cluster().resourceTag(),
-			{
-				Key:   aws.String("Name"),
-				Value: aws.String(fmt.Sprintf("%s formatter", spec.cluster().name)),
-			},
-		},
+		Tags: append(spec.resourceTags(), &ec2.Tag{
+			Key:   aws.String("Name"),
+			Value: aws.String(fmt.Sprintf("%s formatter", spec.cluster().name)),
+		}),
 	})
 	if err != nil {
 		return fmt.Errorf("Error while tagging formatter instance: %s", err)
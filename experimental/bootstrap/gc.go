@@ -0,0 +1,243 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// orphanResource is a resource tagged with a cluster that is not used by the cluster.
+type orphanResource struct {
+	resourceType string
+	id           string
+	reason       string
+}
+
+// committedGroups returns the groups of a cluster.  When the cluster stores its state, the groups committed to the
+// state bucket are included, since groups may be committed after the cluster is created.
+func committedGroups(config client.ConfigProvider, spec clusterSpec) (map[string]bool, error) {
+	groups := map[string]bool{}
+	for _, group := range spec.Groups {
+		groups[string(group.Name)] = true
+	}
+
+	if spec.State == nil {
+		return groups, nil
+	}
+
+	prefix := spec.statePrefix() + "/groups/"
+	err := s3.New(config).ListObjectsPages(
+		&s3.ListObjectsInput{Bucket: aws.String(spec.State.Bucket), Prefix: aws.String(prefix)},
+		func(page *s3.ListObjectsOutput, last bool) bool {
+			for _, object := range page.Contents {
+				groups[strings.TrimSuffix(path.Base(*object.Key), ".json")] = true
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list committed groups in %s: %s", spec.stateURL(), err)
+	}
+	return groups, nil
+}
+
+// findOrphans finds the resources of a cluster that are left over from instances that no longer exist: network
+// interfaces and volumes that are not attached, Elastic IP addresses that are not associated, and spot requests
+// without a live instance.  The volumes and static network interfaces of manager IPs are kept for the managers that
+// will attach them, as are the resources of instances in committed groups.  Network interfaces and volumes that a
+// provision in progress may not have attached yet are kept as well: those of pending or running instances, and
+// volumes created within the grace period.
+func findOrphans(
+	config client.ConfigProvider,
+	spec clusterSpec,
+	groups map[string]bool,
+	gracePeriod time.Duration) ([]orphanResource, error) {
+
+	ec2Client := ec2.New(config)
+	cluster := spec.cluster()
+	orphans := []orphanResource{}
+
+	managerIPs := map[string]bool{}
+	for _, ip := range spec.ManagerIPs {
+		managerIPs[ip] = true
+	}
+
+	instanceStates, err := describeInstanceStates(ec2Client, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	// reason explains why a detached resource is an orphan, or returns an empty string if it is used by the cluster.
+	reason := func(tags []*ec2.Tag, state string, created *time.Time) string {
+		if managerIPs[tagValue(tags, instance.LogicalIDTag)] || managerIPs[tagValue(tags, instance.VolumeTag)] {
+			return ""
+		}
+		if created != nil && time.Since(*created) < gracePeriod {
+			return ""
+		}
+		switch instanceStates[tagValue(tags, instance.NetworkInterfaceInstanceTag)] {
+		case ec2.InstanceStateNamePending, ec2.InstanceStateNameRunning:
+			return ""
+		}
+		if group := tagValue(tags, instance.GroupTag); group != "" && !groups[group] {
+			return fmt.Sprintf("%s, group %s is not committed", state, group)
+		}
+		return state
+	}
+
+	interfaces, err := ec2Client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			cluster.clusterFilter(),
+			{Name: aws.String("status"), Values: []*string{aws.String(ec2.NetworkInterfaceStatusAvailable)}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up network interfaces: %s", err)
+	}
+	for _, networkInterface := range interfaces.NetworkInterfaces {
+		if why := reason(networkInterface.TagSet, "detached", nil); why != "" {
+			orphans = append(orphans, orphanResource{"network-interface", *networkInterface.NetworkInterfaceId, why})
+		}
+	}
+
+	volumes, err := ec2Client.DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{
+			cluster.clusterFilter(),
+			{Name: aws.String("status"), Values: []*string{aws.String(ec2.VolumeStateAvailable)}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up volumes: %s", err)
+	}
+	for _, volume := range volumes.Volumes {
+		if why := reason(volume.Tags, "unattached", volume.CreateTime); why != "" {
+			orphans = append(orphans, orphanResource{"volume", *volume.VolumeId, why})
+		}
+	}
+
+	addresses, err := ec2Client.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{cluster.clusterFilter()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up elastic IPs: %s", err)
+	}
+	for _, address := range addresses.Addresses {
+		if address.AssociationId == nil {
+			orphans = append(orphans, orphanResource{"elastic-ip", *address.AllocationId, "not associated"})
+		}
+	}
+
+	spotOrphans, err := findOrphanSpotRequests(ec2Client, cluster, instanceStates)
+	if err != nil {
+		return nil, err
+	}
+	return append(orphans, spotOrphans...), nil
+}
+
+// describeInstanceStates returns the states of the instances of a cluster, by their IDs.
+func describeInstanceStates(ec2Client *ec2.EC2, cluster clusterID) (map[string]string, error) {
+	instanceStates := map[string]string{}
+	err := ec2Client.DescribeInstancesPages(
+		&ec2.DescribeInstancesInput{Filters: []*ec2.Filter{cluster.clusterFilter()}},
+		func(page *ec2.DescribeInstancesOutput, last bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, ec2Instance := range reservation.Instances {
+					instanceStates[*ec2Instance.InstanceId] = aws.StringValue(ec2Instance.State.Name)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up instances: %s", err)
+	}
+	return instanceStates, nil
+}
+
+// findOrphanSpotRequests finds the spot requests of a cluster that are not fulfilled by a live instance.  Spot
+// requests belong to a cluster when they are tagged with it, or when they launched an instance of the cluster.
+func findOrphanSpotRequests(
+	ec2Client *ec2.EC2,
+	cluster clusterID,
+	instanceStates map[string]string) ([]orphanResource, error) {
+
+	requests, err := ec2Client.DescribeSpotInstanceRequests(&ec2.DescribeSpotInstanceRequestsInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("state"),
+			Values: aws.StringSlice([]string{ec2.SpotInstanceStateOpen, ec2.SpotInstanceStateActive}),
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up spot requests: %s", err)
+	}
+
+	orphans := []orphanResource{}
+	for _, request := range requests.SpotInstanceRequests {
+		instanceID := aws.StringValue(request.InstanceId)
+		state, launched := instanceStates[instanceID]
+		if !launched && tagValue(request.Tags, cluster.clusterTagKey()) != cluster.name {
+			continue
+		}
+
+		switch {
+		case instanceID == "":
+			orphans = append(orphans, orphanResource{"spot-request", *request.SpotInstanceRequestId, "unfulfilled"})
+		case !launched, state == ec2.InstanceStateNameShuttingDown, state == ec2.InstanceStateNameTerminated:
+			orphans = append(orphans, orphanResource{
+				"spot-request",
+				*request.SpotInstanceRequestId,
+				fmt.Sprintf("instance %s is terminated", instanceID),
+			})
+		}
+	}
+	return orphans, nil
+}
+
+func printOrphans(out io.Writer, orphans []orphanResource) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tID\tREASON")
+	for _, orphan := range orphans {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", orphan.resourceType, orphan.id, orphan.reason)
+	}
+	return w.Flush()
+}
+
+// deleteOrphans deletes orphaned resources, continuing past failures.  It returns an error if any deletion failed.
+func deleteOrphans(config client.ConfigProvider, orphans []orphanResource) error {
+	ec2Client := ec2.New(config)
+	failed := 0
+	for _, orphan := range orphans {
+		log.Infof("Deleting %s %s (%s)", orphan.resourceType, orphan.id, orphan.reason)
+
+		var err error
+		switch orphan.resourceType {
+		case "network-interface":
+			_, err = ec2Client.DeleteNetworkInterface(
+				&ec2.DeleteNetworkInterfaceInput{NetworkInterfaceId: aws.String(orphan.id)})
+		case "volume":
+			_, err = ec2Client.DeleteVolume(&ec2.DeleteVolumeInput{VolumeId: aws.String(orphan.id)})
+		case "elastic-ip":
+			_, err = ec2Client.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: aws.String(orphan.id)})
+		case "spot-request":
+			_, err = ec2Client.CancelSpotInstanceRequests(&ec2.CancelSpotInstanceRequestsInput{
+				SpotInstanceRequestIds: []*string{aws.String(orphan.id)},
+			})
+		}
+		if err != nil {
+			log.Warnf("  error while deleting %s %s: %s", orphan.resourceType, orphan.id, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Failed to delete %d of %d orphaned resources", failed, len(orphans))
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit/spi/group"
+	"strings"
+)
+
+// SpecStage is a stage of the pipeline of hooks that transform the groups of a validated cluster spec.  The stages
+// run in order, and the hooks of each stage run in the order they are registered.
+type SpecStage int
+
+// The stages of the pipeline.
+const (
+	// DefaultingStage applies the defaults of the spec and its features to the launch settings of groups.
+	DefaultingStage SpecStage = iota
+
+	// AddressingStage allocates the private IP addresses of managers.
+	AddressingStage
+
+	// TaggingStage adds tags to the instances of groups.
+	TaggingStage
+
+	// UserDataStage renders the scripts run by instances of groups as they boot.  It runs once the resources the
+	// scripts refer to, such as the shared file system, are created.
+	UserDataStage
+)
+
+func (s SpecStage) String() string {
+	switch s {
+	case DefaultingStage:
+		return "defaulting"
+	case AddressingStage:
+		return "addressing"
+	case TaggingStage:
+		return "tagging"
+	case UserDataStage:
+		return "user data"
+	}
+	return fmt.Sprintf("stage %d", int(s))
+}
+
+// specHook transforms a group of a cluster spec, returning an error if the group cannot be transformed.
+type specHook func(spec *clusterSpec, group *instanceGroupSpec) error
+
+type registeredHook struct {
+	stage SpecStage
+	name  string
+	hook  specHook
+}
+
+// specHooks are the hooks of the pipeline, beginning with those of the bootstrap features.
+var specHooks = []registeredHook{
+	{DefaultingStage, "instance defaults", applyInstanceDefaultsHook},
+	{DefaultingStage, "group defaults", applyGroupDefaultsHook},
+	{DefaultingStage, "termination protection", applyTerminationProtectionHook},
+	{DefaultingStage, "monitoring", applyMonitoringHook},
+	{DefaultingStage, "backups", applyBackupsHook},
+	{DefaultingStage, "role defaults", applyRoleDefaultsHook},
+	{DefaultingStage, "SSM access", applySSMAccessHook},
+	{AddressingStage, "manager IPs", allocateManagerIPsHook},
+	{TaggingStage, "default tags", applyDefaultTagsHook},
+	{TaggingStage, "role tags", applyRoleTagHook},
+	{UserDataStage, "boot script", renderBootScriptHook},
+}
+
+// Group is a group of a cluster spec, as seen by the hooks registered with RegisterGroupHook.
+type Group struct {
+	// Cluster is the name of the cluster.
+	Cluster string
+
+	// Name is the name of the group.
+	Name group.ID
+
+	// Manager is whether the group is the managers of the cluster.
+	Manager bool
+
+	// Size is the number of instances of the group.
+	Size int
+
+	// Config is the properties of the instance plugin of the group, which the hook may change.
+	Config *instance.CreateInstanceRequest
+}
+
+// GroupHook transforms a group of a cluster spec, returning an error if the group cannot be transformed.
+type GroupHook func(group Group) error
+
+// RegisterGroupHook adds a hook to a stage of the pipeline, to run on every group after the hooks already registered
+// for the stage.  Instance plugins and flavors that require settings of the groups they manage register hooks from
+// init functions, before any cluster spec is read.
+func RegisterGroupHook(stage SpecStage, name string, hook GroupHook) {
+	specHooks = append(specHooks, registeredHook{
+		stage: stage,
+		name:  name,
+		hook: func(spec *clusterSpec, grp *instanceGroupSpec) error {
+			return hook(Group{
+				Cluster: spec.ClusterName,
+				Name:    grp.Name,
+				Manager: grp.isManager(),
+				Size:    grp.Size,
+				Config:  &grp.Config,
+			})
+		},
+	})
+}
+
+// runHooks runs the hooks of the stages on each group of the spec, in order.  Each stage runs on every group before
+// the next begins, and the pipeline stops at the first stage that fails for any group.
+func (s *clusterSpec) runHooks(stages ...SpecStage) error {
+	for _, stage := range stages {
+		errs := []string{}
+		for _, registered := range specHooks {
+			if registered.stage != stage {
+				continue
+			}
+			for i := range s.Groups {
+				if err := registered.hook(s, &s.Groups[i]); err != nil {
+					errs = append(errs, fmt.Sprintf("In group %s: %s: %s", s.Groups[i].Name, registered.name, err))
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("Failed %s of the cluster spec:\n%s", stage, strings.Join(errs, "\n"))
+		}
+	}
+	return nil
+}
+
+func applyInstanceDefaultsHook(s *clusterSpec, group *instanceGroupSpec) error {
+	instanceType := s.DefaultInstanceType
+	if len(group.Config.InstanceTypes) > 0 {
+		instanceType = group.Config.InstanceTypes[0].InstanceType
+	}
+	if group.InstanceRequirements != nil {
+		// The instance types are selected once the cluster is created.
+		instanceType = ""
+	}
+	applyInstanceDefaults(&group.Config.RunInstancesInput, instanceType)
+	return nil
+}
+
+func applyGroupDefaultsHook(s *clusterSpec, group *instanceGroupSpec) error {
+	s.Defaults.apply(group)
+	return nil
+}
+
+func applyDefaultTagsHook(s *clusterSpec, group *instanceGroupSpec) error {
+	s.Defaults.applyTags(group)
+	return nil
+}
+
+// applySSMAccessHook adds the VPC endpoints of SSMAccess.  It changes the spec rather than the group, so it is the
+// same for every group.
+func applySSMAccessHook(s *clusterSpec, group *instanceGroupSpec) error {
+	s.applySSMAccess()
+	return nil
+}
+
+func renderBootScriptHook(s *clusterSpec, group *instanceGroupSpec) error {
+	group.bootScript = s.bootScript(*group)
+	return nil
+}
+
+// allocateManagerIPsHook allocates the addresses of managers in the subnet created for them.  Managers in existing
+// subnets use the manager IPs of the spec, or addresses of their subnet.
+func allocateManagerIPsHook(s *clusterSpec, group *instanceGroupSpec) error {
+	if !group.isManager() || group.Subnets != nil {
+		return nil
+	}
+
+	bootLeaderLastOctet := 4
+	if bootLeaderLastOctet+group.Size > 255 {
+		return errors.New("Too many managers for the manager subnet")
+	}
+	s.ManagerIPs = []string{}
+	for i := 0; i < group.Size; i++ {
+		s.ManagerIPs = append(s.ManagerIPs, fmt.Sprintf("192.168.33.%d", bootLeaderLastOctet+i))
+	}
+	return nil
+}
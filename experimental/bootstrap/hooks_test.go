@@ -0,0 +1,36 @@
+package bootstrap
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRegisterGroupHook(t *testing.T) {
+	registered := specHooks
+	defer func() { specHooks = registered }()
+
+	RegisterGroupHook(TaggingStage, "owner tag", func(group Group) error {
+		if group.Name == "broken" {
+			return errors.New("no owner")
+		}
+		if group.Manager {
+			group.Config.Tags = map[string]string{"owner": group.Cluster}
+		}
+		return nil
+	})
+
+	spec := clusterSpec{ClusterName: "prod", Groups: []instanceGroupSpec{
+		{Name: "managers", Type: managerType, Size: 3},
+		{Name: "workers", Type: workerType, Size: 5},
+	}}
+	require.NoError(t, spec.runHooks(TaggingStage))
+	require.Equal(t, map[string]string{"owner": "prod"}, spec.Groups[0].Config.Tags)
+	require.Nil(t, spec.Groups[1].Config.Tags)
+
+	// The errors of the hook fail the stage, naming the group and the hook.
+	spec.Groups = append(spec.Groups, instanceGroupSpec{Name: "broken", Type: workerType})
+	err := spec.runHooks(TaggingStage)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "In group broken: owner tag: no owner")
+}
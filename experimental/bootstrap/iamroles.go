@@ -0,0 +1,69 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+	"github.com/docker/infrakit.aws/plugin/iamrole"
+	"github.com/docker/infrakit/spi/instance"
+)
+
+// provisionClusterRole creates a role of a cluster and its instance profile with the IAM role plugin, namespaced by
+// the cluster tag, and returns the ARN of the instance profile.
+func provisionClusterRole(
+	config client.ConfigProvider,
+	cluster clusterID,
+	name string,
+	request iamrole.CreateRoleRequest) (string, error) {
+
+	properties, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	raw := json.RawMessage(properties)
+	logicalID := instance.LogicalID(name)
+
+	iamClient := iam.New(config)
+	_, err = iamrole.NewRolePlugin(iamClient, cluster.clusterTagMap()).Provision(instance.Spec{
+		Properties: &raw,
+		LogicalID:  &logicalID,
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Infof("  role %s", name)
+
+	profile, err := iamClient.GetInstanceProfile(&iam.GetInstanceProfileInput{
+		InstanceProfileName: aws.String(request.InstanceProfileName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to look up instance profile %s: %s", request.InstanceProfileName, err)
+	}
+	log.Infof("  instance profile %s", *profile.InstanceProfile.Arn)
+	return *profile.InstanceProfile.Arn, nil
+}
+
+// destroyClusterRole deletes a role of a cluster and its instance profile.  Clusters created before roles were
+// managed by the IAM role plugin have instance profiles outside of its path, which are deleted by name.
+func destroyClusterRole(config client.ConfigProvider, cluster clusterID, name, profileName string) {
+	iamClient := iam.New(config)
+	if _, err := iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(name)}); err != nil {
+		return
+	}
+
+	log.Infof("  role %s", name)
+	if err := iamrole.NewRolePlugin(iamClient, cluster.clusterTagMap()).Destroy(instance.ID(name)); err != nil {
+		log.Warnf("  error while deleting IAM role: %s", err)
+	}
+
+	_, err := iamClient.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{
+		InstanceProfileName: aws.String(profileName),
+	})
+	if err != nil && awserrors.Code(err) != "NoSuchEntity" {
+		log.Warnf("  error while deleting instance profile: %s", err)
+	}
+}
@@ -0,0 +1,335 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/docker/infrakit/spi/group"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultUpdateTimeout is the default maximum time to wait for groups to update to refreshed images.
+const defaultUpdateTimeout = 30 * time.Minute
+
+// imageChannel is a stream of images that are replaced as they are patched, such as the current release of an
+// operating system.  A channel is resolved either from a public SSM parameter, or by finding the most recent image
+// matching a name.
+type imageChannel struct {
+	// SSMParameter is the name of an SSM parameter holding the current image ID, as published by Canonical and Amazon.
+	SSMParameter string `json:",omitempty"`
+
+	// Owners are the accounts or aliases owning the images of the channel, when selecting images by Name.
+	Owners []string `json:",omitempty"`
+
+	// Name is the pattern of the names of the images of the channel, such as "my-base-image-*".
+	Name string `json:",omitempty"`
+
+	// Architecture is the architecture of the images selected by Name, defaulting to x86_64.
+	Architecture string `json:",omitempty"`
+}
+
+// builtinImageChannels are the channels that may be subscribed to without defining them in ImageChannels.
+var builtinImageChannels = map[string]imageChannel{
+	"ubuntu-22.04-stable": {
+		SSMParameter: "/aws/service/canonical/ubuntu/server/22.04/stable/current/amd64/hvm/ebs-gp2/ami-id",
+	},
+	"ubuntu-22.04-stable-arm64": {
+		SSMParameter: "/aws/service/canonical/ubuntu/server/22.04/stable/current/arm64/hvm/ebs-gp2/ami-id",
+	},
+	"ubuntu-24.04-stable": {
+		SSMParameter: "/aws/service/canonical/ubuntu/server/24.04/stable/current/amd64/hvm/ebs-gp3/ami-id",
+	},
+	"ubuntu-24.04-stable-arm64": {
+		SSMParameter: "/aws/service/canonical/ubuntu/server/24.04/stable/current/arm64/hvm/ebs-gp3/ami-id",
+	},
+	"amazon-linux-2023": {
+		SSMParameter: "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64",
+	},
+	"amazon-linux-2023-arm64": {
+		SSMParameter: "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-arm64",
+	},
+}
+
+func (c imageChannel) validate() error {
+	switch {
+	case c.SSMParameter != "" && c.Name != "":
+		return errors.New("only one of SSMParameter and Name may be set")
+	case c.SSMParameter == "" && c.Name == "":
+		return errors.New("one of SSMParameter and Name must be set")
+	case c.Name != "" && len(c.Owners) == 0:
+		return errors.New("Owners must be set with Name")
+	case c.SSMParameter != "" && (len(c.Owners) > 0 || c.Architecture != ""):
+		return errors.New("Owners and Architecture may only be set with Name")
+	}
+	return nil
+}
+
+// imageChannel returns the channel a group subscribes to.
+func (s *clusterSpec) imageChannel(name string) (imageChannel, bool) {
+	if channel, has := s.ImageChannels[name]; has {
+		return channel, true
+	}
+	channel, has := builtinImageChannels[name]
+	return channel, has
+}
+
+// validateImageChannels checks the channels of the spec, and that every channel subscribed to exists.
+func (s *clusterSpec) validateImageChannels() error {
+	errs := []string{}
+	names := []string{}
+	for name := range s.ImageChannels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.ImageChannels[name].validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("In image channel %s: %s", name, err))
+		}
+	}
+	for _, grp := range s.Groups {
+		if grp.ImageChannel == "" {
+			continue
+		}
+		if _, has := s.imageChannel(grp.ImageChannel); !has {
+			errs = append(errs, fmt.Sprintf("In group %s: unknown ImageChannel %s", grp.Name, grp.ImageChannel))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+type getParameterInput struct {
+	Name string
+}
+
+type getParameterOutput struct {
+	Parameter struct {
+		Value string
+	}
+}
+
+// latestImage finds the most recently created available image of a channel selected by name.
+func latestImage(ec2Client ec2iface.EC2API, channel imageChannel) (string, error) {
+	architecture := channel.Architecture
+	if architecture == "" {
+		architecture = ec2.ArchitectureValuesX8664
+	}
+	images, err := ec2Client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: aws.StringSlice(channel.Owners),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("name"), Values: []*string{aws.String(channel.Name)}},
+			{Name: aws.String("architecture"), Values: []*string{aws.String(architecture)}},
+			{Name: aws.String("state"), Values: []*string{aws.String(ec2.ImageStateAvailable)}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to look up images named %s: %s", channel.Name, err)
+	}
+
+	// Creation dates are RFC 3339 timestamps in UTC, which sort chronologically.
+	latest := ""
+	latestCreated := ""
+	for _, image := range images.Images {
+		if created := aws.StringValue(image.CreationDate); created > latestCreated {
+			latest = aws.StringValue(image.ImageId)
+			latestCreated = created
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("No %s images named %s", architecture, channel.Name)
+	}
+	return latest, nil
+}
+
+// resolveImageChannel looks up the current image of a channel.
+func resolveImageChannel(config client.ConfigProvider, channel imageChannel) (string, error) {
+	if channel.SSMParameter == "" {
+		return latestImage(ec2.New(config), channel)
+	}
+
+	output := getParameterOutput{}
+	err := sendSSM(newSSMClient(config), "GetParameter", &getParameterInput{Name: channel.SSMParameter}, &output)
+	if err != nil {
+		return "", fmt.Errorf("Failed to look up SSM parameter %s: %s", channel.SSMParameter, err)
+	}
+	if !strings.HasPrefix(output.Parameter.Value, "ami-") {
+		return "", fmt.Errorf("SSM parameter %s is not an image ID: %s", channel.SSMParameter, output.Parameter.Value)
+	}
+	return output.Parameter.Value, nil
+}
+
+// imageRefresh is a change of the image of a group to the current image of its channel.
+type imageRefresh struct {
+	Group    group.ID
+	Channel  string
+	Previous string
+	Current  string
+}
+
+// resolveImageChannels sets the image of the groups subscribed to a channel to the current image of the channel.  The
+// images of groups are pinned: unless refresh is set, only groups without an ImageId are resolved.  The groups whose
+// image changed are returned.
+func (s *clusterSpec) resolveImageChannels(config client.ConfigProvider, refresh bool) ([]imageRefresh, error) {
+	refreshed := []imageRefresh{}
+	errs := []string{}
+
+	// Channels are resolved once with the credentials of each account, since groups may be in other accounts.
+	resolved := map[string]string{}
+	s.mutateGroups(func(grp *instanceGroupSpec) {
+		run := &grp.Config.RunInstancesInput
+		if grp.ImageChannel == "" || (run.ImageId != nil && !refresh) {
+			return
+		}
+
+		groupConfig := s.cluster().getGroupAWSClient(config, *grp)
+		key := grp.ImageChannel
+		if grp.Credentials != nil {
+			key = fmt.Sprintf("%s/%s/%s", grp.Credentials.Profile, grp.Credentials.RoleARN, grp.ImageChannel)
+		}
+		image, has := resolved[key]
+		if !has {
+			channel, _ := s.imageChannel(grp.ImageChannel)
+			var err error
+			if image, err = resolveImageChannel(groupConfig, channel); err != nil {
+				errs = append(errs, fmt.Sprintf("In group %s: %s", grp.Name, err))
+				return
+			}
+			resolved[key] = image
+		}
+
+		previous := aws.StringValue(run.ImageId)
+		if previous == image {
+			return
+		}
+		run.ImageId = aws.String(image)
+		refreshed = append(refreshed, imageRefresh{
+			Group:    grp.Name,
+			Channel:  grp.ImageChannel,
+			Previous: previous,
+			Current:  image,
+		})
+		if previous == "" {
+			log.Infof("Group %s launches image %s of channel %s", grp.Name, image, grp.ImageChannel)
+		} else {
+			log.Infof("Group %s updates from image %s to %s of channel %s", grp.Name, previous, image, grp.ImageChannel)
+		}
+	})
+
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	return refreshed, nil
+}
+
+// withImage replaces the image of a committed group spec, keeping the rest of the spec as it was committed.
+func withImage(groupSpec json.RawMessage, imageID string) (json.RawMessage, error) {
+	document := map[string]interface{}{}
+	if err := json.Unmarshal(groupSpec, &document); err != nil {
+		return nil, err
+	}
+
+	run := document
+	for _, field := range []string{"Properties", "Instance", "Properties", "RunInstancesInput"} {
+		next, is := run[field].(map[string]interface{})
+		if !is {
+			return nil, fmt.Errorf("%s is not set", field)
+		}
+		run = next
+	}
+	run["ImageId"] = imageID
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// groupUpdateCommands update a group on a manager to its spec in the state bucket, which the group plugin rolls out
+// by replacing instances one at a time.
+func groupUpdateCommands(stateURL string, name group.ID) []string {
+	file := fmt.Sprintf("/infrakit/configs/%s.json", name)
+	return []string{
+		fmt.Sprintf("docker run --rm -v /infrakit/configs:/infrakit/configs amazon/aws-cli s3 cp %s/%s %s",
+			stateURL, groupStateKey(name), file),
+		"docker run --rm -e INFRAKIT_PLUGINS_DIR=/infrakit/plugins -v /infrakit/plugins:/infrakit/plugins " +
+			"-v /infrakit/configs:/infrakit/configs wfarner/infrakit-demo-plugins infrakit group update " + file,
+	}
+}
+
+// runningManager finds a running manager of a cluster.
+func runningManager(config client.ConfigProvider, spec clusterSpec) (string, error) {
+	managers, err := spec.managers()
+	if err != nil {
+		return "", err
+	}
+	inventory, err := describeCluster(config, spec.cluster())
+	if err != nil {
+		return "", err
+	}
+	for _, managed := range inventory.Groups[string(managers.Name)] {
+		if managed.State == ec2.InstanceStateNameRunning {
+			return managed.InstanceID, nil
+		}
+	}
+	return "", fmt.Errorf("No running manager of cluster %s", spec.ClusterName)
+}
+
+// rollOutImages commits the refreshed images of groups to the state bucket of a cluster, and updates the groups on a
+// running manager with Run Command, starting rolling updates of their instances.  Groups that were not committed to
+// the state bucket are skipped.
+func rollOutImages(
+	config client.ConfigProvider,
+	spec clusterSpec,
+	refreshed []imageRefresh,
+	timeout time.Duration) error {
+
+	if spec.State == nil {
+		return errors.New("State must be set to update groups")
+	}
+	if len(refreshed) == 0 {
+		return nil
+	}
+
+	managerID, err := runningManager(config, spec)
+	if err != nil {
+		return err
+	}
+	ssm := newSSMClient(config)
+	deadline := time.Now().Add(timeout)
+	if err := waitForSSMRegistration(ssm, managerID, deadline); err != nil {
+		return err
+	}
+
+	for _, refresh := range refreshed {
+		snapshot := spec.stateSnapshot(config, groupStateKey(refresh.Group))
+		committed := json.RawMessage{}
+		if err := snapshot.Load(&committed); err != nil {
+			return fmt.Errorf("Failed to load committed spec of group %s: %s", refresh.Group, err)
+		}
+		if len(committed) == 0 {
+			log.Warnf("Group %s is not committed to %s, skipping its update", refresh.Group, spec.stateURL())
+			continue
+		}
+
+		updated, err := withImage(committed, refresh.Current)
+		if err != nil {
+			return fmt.Errorf("Invalid committed spec of group %s: %s", refresh.Group, err)
+		}
+		if err := snapshot.Save(json.RawMessage(updated)); err != nil {
+			return fmt.Errorf("Failed to save spec of group %s: %s", refresh.Group, err)
+		}
+
+		log.Infof("Updating group %s on manager %s", refresh.Group, managerID)
+		comment := fmt.Sprintf("InfraKit image refresh of group %s", refresh.Group)
+		err = runShellCommands(ssm, managerID, comment, groupUpdateCommands(spec.stateURL(), refresh.Group), deadline)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// sourceImageTag is the tag name recording the region and ID of the image an image was copied from, so that copies
+// are reused when images are copied again.
+const sourceImageTag = "infrakit.source-image"
+
+// imageCopyOptions configures the copies of the images of a cluster to another region.
+type imageCopyOptions struct {
+	Region string
+
+	// Encrypted encrypts the snapshots of the copies, with the default EBS key of the region unless KMSKeyID is set.
+	Encrypted bool
+
+	// KMSKeyID is the key encrypting the snapshots of the copies, re-keying images encrypted with a key of the source
+	// region.
+	KMSKeyID string
+}
+
+// groupImages returns the images a group launches.
+func groupImages(grp instanceGroupSpec) []string {
+	images := []string{}
+	for _, candidate := range launchCandidates(grp) {
+		if candidate.imageID != nil && *candidate.imageID != "" {
+			images = append(images, *candidate.imageID)
+		}
+	}
+	return images
+}
+
+// findImageCopy looks up an existing copy of an image in the target region.
+func findImageCopy(target ec2iface.EC2API, source string) (*ec2.Image, error) {
+	images, err := target.DescribeImages(&ec2.DescribeImagesInput{
+		Owners:  []*string{aws.String("self")},
+		Filters: []*ec2.Filter{{Name: aws.String("tag:" + sourceImageTag), Values: []*string{aws.String(source)}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up copies of image %s: %s", source, err)
+	}
+	for _, image := range images.Images {
+		switch aws.StringValue(image.State) {
+		case ec2.ImageStatePending, ec2.ImageStateAvailable:
+			return image, nil
+		}
+	}
+	return nil, nil
+}
+
+func copyImage(source, target ec2iface.EC2API, sourceRegion, imageID string, options imageCopyOptions,
+	tags []*ec2.Tag) (string, error) {
+
+	sourceImage := fmt.Sprintf("%s/%s", sourceRegion, imageID)
+	existing, err := findImageCopy(target, sourceImage)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		log.Infof("  image %s was copied to %s", imageID, *existing.ImageId)
+		return *existing.ImageId, nil
+	}
+
+	image, err := describeImage(source, aws.String(imageID))
+	if err != nil {
+		return "", err
+	}
+
+	input := &ec2.CopyImageInput{
+		SourceImageId: aws.String(imageID),
+		SourceRegion:  aws.String(sourceRegion),
+		Name:          image.Name,
+		Description:   image.Description,
+		ClientToken:   aws.String(fmt.Sprintf("%s-%s", imageID, options.Region)),
+	}
+	if options.Encrypted || options.KMSKeyID != "" {
+		input.Encrypted = aws.Bool(true)
+	}
+	if options.KMSKeyID != "" {
+		input.KmsKeyId = aws.String(options.KMSKeyID)
+	}
+	copied, err := target.CopyImage(input)
+	if err != nil {
+		return "", fmt.Errorf("Failed to copy image %s to %s: %s", imageID, options.Region, err)
+	}
+
+	_, err = target.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{copied.ImageId},
+		Tags:      append([]*ec2.Tag{{Key: aws.String(sourceImageTag), Value: aws.String(sourceImage)}}, tags...),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to tag image %s: %s", *copied.ImageId, err)
+	}
+	log.Infof("  image %s copying to %s", imageID, *copied.ImageId)
+	return *copied.ImageId, nil
+}
+
+// copyImages copies the images of the groups of a cluster to another region, returning the copy of each image.
+// Images of groups with their own credentials are copied within the accounts of the groups.  Copies made by earlier
+// runs are reused, and the copies are available when copyImages returns.
+func copyImages(config client.ConfigProvider, spec clusterSpec, options imageCopyOptions) (map[string]string, error) {
+	log.Infof("Copying images to %s", options.Region)
+	sourceCluster := spec.cluster()
+	targetCluster := sourceCluster
+	targetCluster.region = options.Region
+	targetConfig := targetCluster.getAWSClient()
+
+	copies := map[string]string{}
+	pending := map[ec2iface.EC2API][]*string{}
+	for _, grp := range spec.Groups {
+		source := ec2.New(sourceCluster.getGroupAWSClient(config, grp))
+		target := ec2.New(targetCluster.getGroupAWSClient(targetConfig, grp))
+		for _, imageID := range groupImages(grp) {
+			if _, has := copies[imageID]; has {
+				continue
+			}
+			copied, err := copyImage(source, target, sourceCluster.region, imageID, options, spec.resourceTags())
+			if err != nil {
+				return nil, err
+			}
+			copies[imageID] = copied
+			pending[target] = append(pending[target], aws.String(copied))
+		}
+	}
+
+	for target, images := range pending {
+		if err := target.WaitUntilImageAvailable(&ec2.DescribeImagesInput{ImageIds: images}); err != nil {
+			return nil, fmt.Errorf("Copied images did not become available: %s", err)
+		}
+	}
+	return copies, nil
+}
+
+// rewriteImages replaces the images of the groups of a cluster with their copies.
+func (s *clusterSpec) rewriteImages(copies map[string]string) {
+	r := remapper{unmapped: map[string]bool{}}
+	s.mutateGroups(func(grp *instanceGroupSpec) {
+		r.remapImages(grp, copies)
+	})
+}
+
+// imageMapping is the import mapping of the images of a cluster to their copies, merged into an existing mapping.
+func imageMapping(mapping importMapping, region string, copies map[string]string) importMapping {
+	mapping.Region = region
+	if mapping.Images == nil {
+		mapping.Images = map[string]string{}
+	}
+	for image, copied := range copies {
+		mapping.Images[image] = copied
+	}
+	return mapping
+}
@@ -0,0 +1,66 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/docker/infrakit.aws/plugin/instance"
+)
+
+// createManagerInterfaces creates a network interface for each manager IP, which the instance plugin attaches to
+// the manager holding that IP as its logical ID.  Replacement managers attach the same interface, keeping the address
+// and swarm identity of the manager they replace.
+func createManagerInterfaces(ec2Client ec2iface.EC2API, spec *clusterSpec, subnetID, securityGroupID *string) error {
+	for _, ip := range spec.ManagerIPs {
+		created, err := ec2Client.CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{
+			SubnetId:         subnetID,
+			Groups:           []*string{securityGroupID},
+			PrivateIpAddress: aws.String(ip),
+			Description:      aws.String(fmt.Sprintf("Static interface of %s", ip)),
+		})
+		if err != nil {
+			return err
+		}
+		interfaceID := created.NetworkInterface.NetworkInterfaceId
+		log.Infof("  manager network interface %s for %s", *interfaceID, ip)
+
+		_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{interfaceID},
+			Tags: append(
+				spec.resourceTags(),
+				&ec2.Tag{Key: aws.String(instance.LogicalIDTag), Value: aws.String(ip)}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	spec.mutateManagers(func(managers *instanceGroupSpec) {
+		managers.Config.StaticNetworkInterface = true
+	})
+	return nil
+}
+
+// destroyNetworkInterfaces deletes the network interfaces of the cluster that remain once its instances are
+// terminated.
+func destroyNetworkInterfaces(ec2Client *ec2.EC2, cluster clusterID, vpcID string) {
+	interfaces, err := ec2Client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: cluster.resourceFilter(vpcID),
+	})
+	if err != nil {
+		log.Warnf("  error while describing network interfaces: %s", err)
+		return
+	}
+
+	for _, networkInterface := range interfaces.NetworkInterfaces {
+		log.Infof("  network interface %s", *networkInterface.NetworkInterfaceId)
+		_, err = ec2Client.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
+		})
+		if err != nil {
+			log.Warnf("  error while deleting network interface: %s", err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// describeTagsBatchSize is the number of resource IDs of each filter of DescribeTags.
+const describeTagsBatchSize = 200
+
+// inventorySnapshot is every resource of a cluster at a point in time, for comparison with a later snapshot.
+type inventorySnapshot struct {
+	Cluster   string
+	Region    string
+	TagKey    string
+	Time      time.Time
+	Resources []inventoryResource
+}
+
+// inventoryResource is a resource of a cluster.  The tags of resources other than EC2 resources are not recorded.
+type inventoryResource struct {
+	Type string
+	ID   string
+	Tags map[string]string `json:",omitempty"`
+}
+
+func (r inventoryResource) key() string {
+	return r.Type + " " + r.ID
+}
+
+// group returns the group of a resource, if it is managed by a group plugin.
+func (r inventoryResource) group() string {
+	return r.Tags[instance.GroupTag]
+}
+
+type resourcesByKey []inventoryResource
+
+func (r resourcesByKey) Len() int {
+	return len(r)
+}
+
+func (r resourcesByKey) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+func (r resourcesByKey) Less(i, j int) bool {
+	return r[i].key() < r[j].key()
+}
+
+// snapshotCluster records the EC2 resources tagged with a cluster, along with their tags, and the IAM roles, file
+// systems, load balancers, and log groups that are named after the cluster.  Instances are only recorded until they
+// are terminated, although EC2 reports the tags of terminated instances for a while.
+func snapshotCluster(config client.ConfigProvider, cluster clusterID) (inventorySnapshot, error) {
+	snapshot := inventorySnapshot{
+		Cluster: cluster.name,
+		Region:  cluster.region,
+		TagKey:  cluster.clusterTagKey(),
+		Time:    time.Now().UTC(),
+	}
+
+	inventory, err := describeCluster(config, cluster)
+	if err != nil {
+		return snapshot, err
+	}
+	liveInstances := map[string]bool{}
+	for _, instances := range inventory.Groups {
+		for _, inst := range instances {
+			liveInstances[inst.InstanceID] = true
+		}
+	}
+
+	ec2Client := ec2.New(config)
+	resources := map[string]inventoryResource{}
+	err = ec2Client.DescribeTagsPages(
+		&ec2.DescribeTagsInput{Filters: []*ec2.Filter{
+			{Name: aws.String("key"), Values: []*string{aws.String(cluster.clusterTagKey())}},
+			{Name: aws.String("value"), Values: []*string{aws.String(cluster.name)}},
+		}},
+		func(page *ec2.DescribeTagsOutput, last bool) bool {
+			for _, tag := range page.Tags {
+				resourceType := aws.StringValue(tag.ResourceType)
+				id := aws.StringValue(tag.ResourceId)
+				if resourceType == ec2.ResourceTypeInstance && !liveInstances[id] {
+					continue
+				}
+				resources[id] = inventoryResource{Type: resourceType, ID: id, Tags: map[string]string{}}
+			}
+			return true
+		})
+	if err != nil {
+		return snapshot, fmt.Errorf("Failed to look up cluster tags: %s", err)
+	}
+
+	ids := []string{}
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for start := 0; start < len(ids); start += describeTagsBatchSize {
+		end := start + describeTagsBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		err := ec2Client.DescribeTagsPages(
+			&ec2.DescribeTagsInput{Filters: []*ec2.Filter{
+				{Name: aws.String("resource-id"), Values: aws.StringSlice(ids[start:end])},
+			}},
+			func(page *ec2.DescribeTagsOutput, last bool) bool {
+				for _, tag := range page.Tags {
+					if resource, has := resources[aws.StringValue(tag.ResourceId)]; has {
+						resource.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+					}
+				}
+				return true
+			})
+		if err != nil {
+			return snapshot, fmt.Errorf("Failed to look up the tags of cluster resources: %s", err)
+		}
+	}
+
+	for _, role := range inventory.IAM {
+		resources["role "+role.Role] = inventoryResource{Type: "iam-role", ID: role.Role}
+		if role.InstanceProfile != "" {
+			resources["profile "+role.InstanceProfile] = inventoryResource{
+				Type: "instance-profile",
+				ID:   role.InstanceProfile,
+			}
+		}
+	}
+	for _, fileSystem := range inventory.FileSystems {
+		resources[fileSystem] = inventoryResource{Type: "file-system", ID: fileSystem}
+	}
+	for _, loadBalancer := range inventory.LoadBalancers {
+		resources[loadBalancer] = inventoryResource{Type: "load-balancer", ID: loadBalancer}
+	}
+	for _, logGroup := range inventory.LogGroups {
+		resources[logGroup] = inventoryResource{Type: "log-group", ID: logGroup}
+	}
+
+	snapshot.Resources = []inventoryResource{}
+	for _, resource := range resources {
+		snapshot.Resources = append(snapshot.Resources, resource)
+	}
+	sort.Stable(resourcesByKey(snapshot.Resources))
+	return snapshot, nil
+}
+
+func writeSnapshot(out io.Writer, snapshot inventorySnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+func readSnapshot(snapshotFile string) (inventorySnapshot, error) {
+	snapshot := inventorySnapshot{}
+	data, err := ioutil.ReadFile(snapshotFile)
+	if err != nil {
+		return snapshot, fmt.Errorf("Failed to read snapshot: %s", err)
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("Invalid snapshot %s: %s", snapshotFile, err)
+	}
+	return snapshot, nil
+}
+
+// snapshotClusterID is the cluster a snapshot was taken of, to take another snapshot of.
+func (s inventorySnapshot) snapshotClusterID() clusterID {
+	return clusterID{region: s.Region, name: s.Cluster, tagKey: s.TagKey}
+}
+
+// inventoryChange is a difference between two snapshots of a cluster.
+type inventoryChange struct {
+	change   string
+	resource inventoryResource
+	detail   string
+
+	// expected is set for changes of resources managed by a group plugin, which replaces instances and their
+	// resources as a matter of course.  Changes of other resources are unexpected, since they are only created and
+	// destroyed along with the cluster.
+	expected bool
+}
+
+// diffSnapshots returns the resources added to, removed from, and retagged between two snapshots, in the order of
+// their types and IDs.
+func diffSnapshots(before, after inventorySnapshot) []inventoryChange {
+	beforeResources := map[string]inventoryResource{}
+	for _, resource := range before.Resources {
+		beforeResources[resource.key()] = resource
+	}
+	afterResources := map[string]inventoryResource{}
+	for _, resource := range after.Resources {
+		afterResources[resource.key()] = resource
+	}
+
+	changes := []inventoryChange{}
+	for _, resource := range after.Resources {
+		previous, has := beforeResources[resource.key()]
+		switch {
+		case !has:
+			changes = append(changes, inventoryChange{
+				change:   "added",
+				resource: resource,
+				expected: resource.group() != "",
+			})
+		case !tagsEqual(previous.Tags, resource.Tags):
+			changes = append(changes, inventoryChange{
+				change:   "retagged",
+				resource: resource,
+				detail:   describeTagChanges(previous.Tags, resource.Tags),
+				expected: previous.group() != "" && resource.group() != "",
+			})
+		}
+	}
+	for _, resource := range before.Resources {
+		if _, has := afterResources[resource.key()]; !has {
+			changes = append(changes, inventoryChange{
+				change:   "removed",
+				resource: resource,
+				expected: resource.group() != "",
+			})
+		}
+	}
+	sort.Stable(changesByResource(changes))
+	return changes
+}
+
+type changesByResource []inventoryChange
+
+func (c changesByResource) Len() int {
+	return len(c)
+}
+
+func (c changesByResource) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c changesByResource) Less(i, j int) bool {
+	return c[i].resource.key() < c[j].resource.key()
+}
+
+func tagsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, has := b[key]; !has || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// describeTagChanges lists the tags that were set, changed, or removed, by key.
+func describeTagChanges(before, after map[string]string) string {
+	keys := []string{}
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, has := before[key]; !has {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []string{}
+	for _, key := range keys {
+		previous, had := before[key]
+		value, has := after[key]
+		switch {
+		case !had:
+			changes = append(changes, fmt.Sprintf("+%s=%s", key, value))
+		case !has:
+			changes = append(changes, fmt.Sprintf("-%s", key))
+		case previous != value:
+			changes = append(changes, fmt.Sprintf("%s=%s->%s", key, previous, value))
+		}
+	}
+	return strings.Join(changes, ", ")
+}
+
+// printChanges prints the changes between snapshots, marking unexpected changes with an exclamation mark.  Expected
+// changes are left out when onlyUnexpected is set.
+func printChanges(out io.Writer, changes []inventoryChange, onlyUnexpected bool) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\tCHANGE\tTYPE\tID\tGROUP\tTAGS")
+	for _, change := range changes {
+		if change.expected && onlyUnexpected {
+			continue
+		}
+		mark := "!"
+		if change.expected {
+			mark = ""
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			mark, change.change, change.resource.Type, change.resource.ID, change.resource.group(), change.detail)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,115 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"net"
+	"net/url"
+	"time"
+)
+
+const anywhereIpv6CIDR = "::/0"
+
+// createVpc creates the VPC of the cluster.  A dual-stack VPC is also assigned an IPv6 CIDR block by Amazon.
+func createVpc(ec2Client *ec2.EC2, dualStack bool) (*ec2.Vpc, error) {
+	req, vpc := ec2Client.CreateVpcRequest(&ec2.CreateVpcInput{CidrBlock: aws.String(vpcCIDR)})
+	params := url.Values{}
+	if dualStack {
+		params.Set("AmazonProvidedIpv6CidrBlock", "true")
+	}
+	if err := ec2ext.Send(req, params); err != nil {
+		return nil, err
+	}
+	return vpc.Vpc, nil
+}
+
+// vpcIpv6CIDR waits for the IPv6 CIDR block of a VPC to be associated, and returns it.
+func vpcIpv6CIDR(ec2Client *ec2.EC2, vpcID string) (string, error) {
+	for i := 0; i < 30; i++ {
+		vpcs, err := ec2ext.New(ec2Client).DescribeVpcIpv6CidrBlocks(
+			&ec2.DescribeVpcsInput{VpcIds: []*string{aws.String(vpcID)}})
+		if err != nil {
+			return "", err
+		}
+
+		for _, vpc := range vpcs.Vpcs {
+			for _, association := range vpc.Ipv6CidrBlockAssociations {
+				if association.Ipv6CidrBlockState != nil &&
+					aws.StringValue(association.Ipv6CidrBlockState.State) == "associated" {
+
+					return aws.StringValue(association.Ipv6CidrBlock), nil
+				}
+			}
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return "", fmt.Errorf("VPC %s has no IPv6 CIDR block", vpcID)
+}
+
+// ipv6SubnetCIDR returns the /64 block with an index within the /56 block of a VPC.
+func ipv6SubnetCIDR(vpcBlock string, index int) (string, error) {
+	ip, network, err := net.ParseCIDR(vpcBlock)
+	if err != nil {
+		return "", err
+	}
+	if ip.To4() != nil {
+		return "", fmt.Errorf("%s is not an IPv6 CIDR block", vpcBlock)
+	}
+	if ones, _ := network.Mask.Size(); ones != 56 || index < 0 || index > 255 {
+		return "", fmt.Errorf("No /64 block %d in %s", index, vpcBlock)
+	}
+
+	subnet := make(net.IP, net.IPv6len)
+	copy(subnet, network.IP)
+	subnet[7] = byte(index)
+	return fmt.Sprintf("%s/64", subnet), nil
+}
+
+// enableIpv6 assigns a /64 block of the IPv6 CIDR block of the VPC to each subnet, so that instances launched in the
+// subnets are assigned IPv6 addresses, and routes IPv6 traffic to the internet through the internet gateway.
+func enableIpv6(ec2Client *ec2.EC2, vpcID string, subnetIDs []*string, routeTableID, internetGatewayID *string) error {
+	vpcBlock, err := vpcIpv6CIDR(ec2Client, vpcID)
+	if err != nil {
+		return err
+	}
+	log.Infof("  IPv6 CIDR block %s", vpcBlock)
+
+	client := ec2ext.New(ec2Client)
+	for i, subnetID := range subnetIDs {
+		subnetBlock, err := ipv6SubnetCIDR(vpcBlock, i)
+		if err != nil {
+			return err
+		}
+
+		_, err = client.AssociateSubnetCidrBlock(&ec2ext.AssociateSubnetCidrBlockInput{
+			SubnetId:      subnetID,
+			Ipv6CidrBlock: aws.String(subnetBlock),
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("  subnet %s IPv6 CIDR block %s", *subnetID, subnetBlock)
+
+		// The subnet does not accept the attribute until the association of its block completes.
+		for attempt := 0; ; attempt++ {
+			req, _ := ec2Client.ModifySubnetAttributeRequest(&ec2.ModifySubnetAttributeInput{SubnetId: subnetID})
+			err = ec2ext.Send(req, url.Values{"AssignIpv6AddressOnCreation.Value": {"true"}})
+			if err == nil {
+				break
+			}
+			if attempt == 15 {
+				return fmt.Errorf("Failed to assign IPv6 addresses in subnet %s - %s", *subnetID, err)
+			}
+			time.Sleep(2 * time.Second)
+		}
+	}
+
+	return client.CreateIpv6Route(&ec2ext.CreateIpv6RouteInput{
+		RouteTableId:             routeTableID,
+		DestinationIpv6CidrBlock: aws.String(anywhereIpv6CIDR),
+		GatewayId:                internetGatewayID,
+	})
+}
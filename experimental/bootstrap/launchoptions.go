@@ -0,0 +1,108 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+)
+
+// minEnclaveVCpus is the fewest vCPUs of an instance type that supports Nitro Enclaves, since the parent instance
+// keeps at least two vCPUs.
+const minEnclaveVCpus = 4
+
+func (i instanceGroupSpec) enclavesEnabled() bool {
+	return i.Config.EnclaveOptions != nil && i.Config.EnclaveOptions.Enabled
+}
+
+func (i instanceGroupSpec) hibernationConfigured() bool {
+	return i.Config.HibernationOptions != nil && i.Config.HibernationOptions.Configured
+}
+
+// rootVolume is the EBS root volume instances are launched with, from the block device mappings of the launch request
+// overriding those of the image.
+func rootVolume(run ec2.RunInstancesInput, image *ec2.Image) *ec2.EbsBlockDevice {
+	rootDevice := aws.StringValue(image.RootDeviceName)
+	volume := ec2.EbsBlockDevice{}
+	found := false
+	for _, mapping := range image.BlockDeviceMappings {
+		if aws.StringValue(mapping.DeviceName) == rootDevice && mapping.Ebs != nil {
+			volume = *mapping.Ebs
+			found = true
+		}
+	}
+	for _, mapping := range run.BlockDeviceMappings {
+		if aws.StringValue(mapping.DeviceName) != rootDevice || mapping.Ebs == nil {
+			continue
+		}
+		found = true
+		if mapping.Ebs.Encrypted != nil {
+			volume.Encrypted = mapping.Ebs.Encrypted
+		}
+		if mapping.Ebs.VolumeSize != nil {
+			volume.VolumeSize = mapping.Ebs.VolumeSize
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &volume
+}
+
+// verifyLaunchOptions checks that an instance type and image support the enclave, hibernation, and encryption in
+// transit options of a group.  encryptedByDefault is whether the account encrypts new EBS volumes.
+func verifyLaunchOptions(
+	grp instanceGroupSpec,
+	typeInfo *ec2ext.InstanceTypeInfo,
+	image *ec2.Image,
+	encryptedByDefault bool) []string {
+
+	errs := []string{}
+	instanceType := aws.StringValue(typeInfo.InstanceType)
+
+	if grp.enclavesEnabled() {
+		if aws.StringValue(typeInfo.NitroEnclavesSupport) != "supported" {
+			errs = append(errs, fmt.Sprintf("instance type %s does not support Nitro Enclaves", instanceType))
+		} else if typeInfo.VCpuInfo != nil && aws.Int64Value(typeInfo.VCpuInfo.DefaultVCpus) < minEnclaveVCpus {
+			errs = append(errs, fmt.Sprintf(
+				"instance type %s has fewer than %d vCPUs, the minimum for Nitro Enclaves",
+				instanceType,
+				minEnclaveVCpus))
+		}
+	}
+
+	if grp.hibernationConfigured() {
+		if !aws.BoolValue(typeInfo.HibernationSupported) {
+			errs = append(errs, fmt.Sprintf("instance type %s does not support hibernation", instanceType))
+		}
+
+		root := rootVolume(grp.Config.RunInstancesInput, image)
+		if aws.StringValue(image.RootDeviceType) != ec2.DeviceTypeEbs || root == nil {
+			errs = append(errs, fmt.Sprintf(
+				"image %s does not have an EBS root volume, which hibernation requires",
+				aws.StringValue(image.ImageId)))
+		} else {
+			if !aws.BoolValue(root.Encrypted) && !encryptedByDefault {
+				errs = append(errs, fmt.Sprintf(
+					"hibernation requires an encrypted root volume, which image %s does not have and "+
+						"BlockDeviceMappings do not configure",
+					aws.StringValue(image.ImageId)))
+			}
+			if typeInfo.MemoryInfo != nil && root.VolumeSize != nil &&
+				*root.VolumeSize*1024 < aws.Int64Value(typeInfo.MemoryInfo.SizeInMiB) {
+
+				errs = append(errs, fmt.Sprintf(
+					"the root volume of %d GiB is smaller than the memory of instance type %s, which hibernation saves",
+					*root.VolumeSize,
+					instanceType))
+			}
+		}
+	}
+
+	if grp.EncryptionInTransit &&
+		(typeInfo.NetworkInfo == nil || !aws.BoolValue(typeInfo.NetworkInfo.EncryptionInTransitSupported)) {
+
+		errs = append(errs, fmt.Sprintf("instance type %s does not encrypt traffic in transit", instanceType))
+	}
+	return errs
+}
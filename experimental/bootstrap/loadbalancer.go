@@ -0,0 +1,131 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"net/url"
+)
+
+const swarmPort = 2377
+
+// subnetOf is the subnet that instances are launched in.
+func subnetOf(run ec2.RunInstancesInput) *string {
+	if len(run.NetworkInterfaces) > 0 {
+		return run.NetworkInterfaces[0].SubnetId
+	}
+	return run.SubnetId
+}
+
+// createManagerLoadBalancer creates an internal network load balancer forwarding the swarm port to the managers.
+// Managers are registered with the target group by the instance plugin as they are provisioned and destroyed.
+func createManagerLoadBalancer(config client.ConfigProvider, spec *clusterSpec, vpcID string) error {
+	log.Info("Creating manager load balancer")
+	managers, err := spec.managers()
+	if err != nil {
+		return err
+	}
+	elbClient := elbv2.New(config)
+	name := spec.cluster().managerLoadBalancerName()
+
+	tags := []*elbv2.Tag{}
+	for _, tag := range spec.resourceTags() {
+		tags = append(tags, &elbv2.Tag{Key: tag.Key, Value: tag.Value})
+	}
+
+	targetGroup, err := elbClient.CreateTargetGroup(&elbv2.CreateTargetGroupInput{
+		Name:                aws.String(name),
+		Protocol:            aws.String("TCP"),
+		Port:                aws.Int64(swarmPort),
+		VpcId:               aws.String(vpcID),
+		HealthCheckProtocol: aws.String("TCP"),
+	})
+	if err != nil {
+		return err
+	}
+	targetGroupARN := targetGroup.TargetGroups[0].TargetGroupArn
+	log.Infof("  target group %s", *targetGroupARN)
+
+	// The vendored SDK predates network load balancers, so the load balancer type is added to the request.
+	req, loadBalancer := elbClient.CreateLoadBalancerRequest(&elbv2.CreateLoadBalancerInput{
+		Name:    aws.String(name),
+		Scheme:  aws.String(elbv2.LoadBalancerSchemeEnumInternal),
+		Subnets: []*string{subnetOf(managers.Config.RunInstancesInput)},
+		Tags:    tags,
+	})
+	req.Handlers.Build.PushBack(ec2ext.WithParams(url.Values{"Type": {"network"}}))
+	if err := req.Send(); err != nil {
+		return err
+	}
+	loadBalancerARN := loadBalancer.LoadBalancers[0].LoadBalancerArn
+	log.Infof("  load balancer %s", *loadBalancerARN)
+
+	_, err = elbClient.AddTags(&elbv2.AddTagsInput{ResourceArns: []*string{targetGroupARN}, Tags: tags})
+	if err != nil {
+		return err
+	}
+
+	_, err = elbClient.CreateListener(&elbv2.CreateListenerInput{
+		LoadBalancerArn: loadBalancerARN,
+		Protocol:        aws.String("TCP"),
+		Port:            aws.Int64(swarmPort),
+		DefaultActions: []*elbv2.Action{
+			{Type: aws.String(elbv2.ActionTypeEnumForward), TargetGroupArn: targetGroupARN},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	spec.managerEndpoint = fmt.Sprintf("%s:%d", *loadBalancer.LoadBalancers[0].DNSName, swarmPort)
+	log.Infof("  manager endpoint %s", spec.managerEndpoint)
+
+	spec.mutateManagers(func(managers *instanceGroupSpec) {
+		managers.Config.TargetGroupARNs = []string{*targetGroupARN}
+	})
+	return nil
+}
+
+func destroyManagerLoadBalancer(config client.ConfigProvider, cluster clusterID) {
+	log.Info("Destroying manager load balancer")
+	elbClient := elbv2.New(config)
+	name := cluster.managerLoadBalancerName()
+
+	loadBalancers, err := elbClient.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
+		Names: []*string{aws.String(name)},
+	})
+	if err == nil {
+		for _, loadBalancer := range loadBalancers.LoadBalancers {
+			log.Infof("  load balancer %s", *loadBalancer.LoadBalancerArn)
+			_, err := elbClient.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{
+				LoadBalancerArn: loadBalancer.LoadBalancerArn,
+			})
+			if err != nil {
+				log.Warnf("  error while deleting load balancer: %s", err)
+			}
+		}
+	} else {
+		log.Warnf("  did not find a manager load balancer: %s", err)
+	}
+
+	targetGroups, err := elbClient.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+		Names: []*string{aws.String(name)},
+	})
+	if err == nil {
+		for _, targetGroup := range targetGroups.TargetGroups {
+			log.Infof("  target group %s", *targetGroup.TargetGroupArn)
+			_, err := elbClient.DeleteTargetGroup(&elbv2.DeleteTargetGroupInput{
+				TargetGroupArn: targetGroup.TargetGroupArn,
+			})
+			if err != nil {
+				log.Warnf("  error while deleting target group: %s", err)
+			}
+		}
+	} else {
+		log.Warnf("  did not find a manager target group: %s", err)
+	}
+}
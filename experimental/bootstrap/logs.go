@@ -0,0 +1,128 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// logsConfig configures shipping of system and Docker logs to CloudWatch Logs.
+type logsConfig struct {
+	// RetentionDays is the number of days log events are kept.  Events are kept indefinitely when unset.
+	RetentionDays int64 `json:",omitempty"`
+}
+
+// retentionDays are the retention periods supported by CloudWatch Logs.
+var retentionDays = []int64{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1827, 3653}
+
+func (l logsConfig) validRetention() bool {
+	if l.RetentionDays == 0 {
+		return true
+	}
+	for _, days := range retentionDays {
+		if l.RetentionDays == days {
+			return true
+		}
+	}
+	return false
+}
+
+func (c clusterID) logGroupName() string {
+	return fmt.Sprintf("/infrakit/%s", c.name)
+}
+
+// tagLogGroupInput is the input of the TagLogGroup action, which is newer than the vendored SDK.
+type tagLogGroupInput struct {
+	_ struct{} `type:"structure"`
+
+	LogGroupName *string            `locationName:"logGroupName" type:"string"`
+	Tags         map[string]*string `locationName:"tags" type:"map"`
+}
+
+// createLogGroup creates the log group of the cluster.
+func createLogGroup(config client.ConfigProvider, spec *clusterSpec) error {
+	log.Info("Creating log resources")
+	logsClient := cloudwatchlogs.New(config)
+	logGroup := aws.String(spec.cluster().logGroupName())
+
+	_, err := logsClient.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{LogGroupName: logGroup})
+	if awsErr, is := err.(awserr.Error); is && awsErr.Code() == "ResourceAlreadyExistsException" {
+		log.Infof("  log group %s already exists", *logGroup)
+	} else if err != nil {
+		return err
+	} else {
+		log.Infof("  log group %s", *logGroup)
+	}
+
+	if spec.Logs.RetentionDays > 0 {
+		_, err = logsClient.PutRetentionPolicy(&cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    logGroup,
+			RetentionInDays: aws.Int64(spec.Logs.RetentionDays),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	tags := map[string]*string{}
+	for key, value := range spec.namespaceTags() {
+		tags[key] = aws.String(value)
+	}
+	err = logsClient.NewRequest(
+		&request.Operation{Name: "TagLogGroup", HTTPMethod: "POST", HTTPPath: "/"},
+		&tagLogGroupInput{LogGroupName: logGroup, Tags: tags},
+		&struct{}{}).Send()
+	return err
+}
+
+// logsScript configures the Docker engine to send container logs to the log group, and installs the CloudWatch agent
+// to send system logs.  Failures are reported without interrupting the remainder of the boot script.
+func logsScript(logGroup string) string {
+	return fmt.Sprintf(`
+# Ship Docker and system logs to CloudWatch Logs.
+(
+set -o errexit
+region=$(curl -s http://169.254.169.254/latest/meta-data/placement/availability-zone | sed 's/.$//')
+
+mkdir -p /etc/docker
+cat << EOF > /etc/docker/daemon.json
+{
+  "log-driver": "awslogs",
+  "log-opts": {"awslogs-region": "$region", "awslogs-group": "%[1]s", "tag": "{{.Name}}/{{.ID}}"}
+}
+EOF
+systemctl restart docker || true
+
+if command -v dpkg > /dev/null
+then
+  curl -sSfo /tmp/amazon-cloudwatch-agent.deb \
+    "https://s3.amazonaws.com/amazoncloudwatch-agent/ubuntu/$(dpkg --print-architecture)/latest/amazon-cloudwatch-agent.deb"
+  dpkg -i /tmp/amazon-cloudwatch-agent.deb
+else
+  yum install -y amazon-cloudwatch-agent
+fi
+
+cat << EOF > /opt/aws/amazon-cloudwatch-agent/etc/amazon-cloudwatch-agent.json
+{
+  "logs": {
+    "logs_collected": {
+      "files": {
+        "collect_list": [
+          {"file_path": "/var/log/syslog", "log_group_name": "%[1]s", "log_stream_name": "{instance_id}/syslog"},
+          {"file_path": "/var/log/messages", "log_group_name": "%[1]s", "log_stream_name": "{instance_id}/messages"},
+          {"file_path": "/var/log/cloud-init-output.log", "log_group_name": "%[1]s", "log_stream_name": "{instance_id}/cloud-init"}
+        ]
+      }
+    }
+  }
+}
+EOF
+/opt/aws/amazon-cloudwatch-agent/bin/amazon-cloudwatch-agent-ctl -a fetch-config -m ec2 -s \
+  -c file:/opt/aws/amazon-cloudwatch-agent/etc/amazon-cloudwatch-agent.json
+) || echo "Failed to configure CloudWatch Logs"
+`, logGroup)
+}
@@ -0,0 +1,181 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/docker/infrakit.aws/plugin/instance"
+)
+
+// groupMonitoring configures the CloudWatch monitoring of the instances of a group.
+type groupMonitoring struct {
+	// Detailed enables detailed monitoring, which publishes instance metrics every minute rather than every five
+	// minutes.  Alarms of groups with detailed monitoring are evaluated every minute.
+	Detailed bool `json:",omitempty"`
+
+	// CPUUtilization alarms when the average CPU utilization of an instance exceeds the percentage, if set.
+	CPUUtilization float64 `json:",omitempty"`
+
+	// StatusCheckFailed alarms when an instance fails its status checks.
+	StatusCheckFailed bool `json:",omitempty"`
+
+	// Recover recovers an instance onto other hardware when it fails its system status checks, so that managers
+	// survive host failures without being replaced.
+	Recover bool `json:",omitempty"`
+}
+
+func (m *groupMonitoring) hasAlarms() bool {
+	return m != nil && (m.CPUUtilization > 0 || m.StatusCheckFailed || m.Recover)
+}
+
+// alarmNotifications configures the SNS topic notified of alarms.
+type alarmNotifications struct {
+	// Emails are addresses subscribed to the alarm topic.  Each address must confirm its subscription.
+	Emails []string `json:",omitempty"`
+}
+
+func (c clusterID) alarmTopicName() string {
+	return fmt.Sprintf("%s-alarms", c.name)
+}
+
+// applyMonitoring applies the monitoring options of the groups to their instance configuration.
+func applyMonitoringHook(s *clusterSpec, group *instanceGroupSpec) error {
+	if group.Monitoring == nil {
+		return nil
+	}
+	if group.Monitoring.Detailed {
+		group.Config.RunInstancesInput.Monitoring = &ec2.RunInstancesMonitoringEnabled{Enabled: aws.Bool(true)}
+	}
+	if group.Monitoring.hasAlarms() {
+		group.Config.Alarms = &instance.Alarms{
+			CPUUtilization:    group.Monitoring.CPUUtilization,
+			StatusCheckFailed: group.Monitoring.StatusCheckFailed,
+			Recover:           group.Monitoring.Recover,
+		}
+		if group.Monitoring.Detailed {
+			group.Config.Alarms.Period = 60
+		}
+	}
+	return nil
+}
+
+func (s *clusterSpec) hasAlarms() bool {
+	for _, group := range s.Groups {
+		if group.Monitoring.hasAlarms() {
+			return true
+		}
+	}
+	return false
+}
+
+// newSNSClient creates a client of SNS.  SNS is not vendored, so the client is assembled from the SDK's query protocol
+// handlers.
+func newSNSClient(config client.ConfigProvider) *client.Client {
+	c := config.ClientConfig("sns")
+	sns := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "sns",
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2010-03-31",
+		},
+		c.Handlers)
+	sns.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	sns.Handlers.Build.PushBackNamed(query.BuildHandler)
+	sns.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	sns.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	sns.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return sns
+}
+
+type snsTag struct {
+	Key   string
+	Value string
+}
+
+type createTopicInput struct {
+	Name string
+	Tags []snsTag
+}
+
+type createTopicOutput struct {
+	TopicArn string
+}
+
+type subscribeInput struct {
+	TopicArn string
+	Protocol string
+	Endpoint string
+}
+
+type deleteTopicInput struct {
+	TopicArn string
+}
+
+func sendSNS(sns *client.Client, action string, input, output interface{}) error {
+	return sns.NewRequest(&request.Operation{Name: action, HTTPMethod: "POST", HTTPPath: "/"}, input, output).Send()
+}
+
+// createAlarmTopic creates the SNS topic of the cluster's alarms, subscribes the notification addresses, and notifies
+// the topic of the alarms of each group.
+func createAlarmTopic(config client.ConfigProvider, spec *clusterSpec) error {
+	log.Info("Creating alarm notifications")
+	sns := newSNSClient(config)
+
+	input := createTopicInput{Name: spec.cluster().alarmTopicName()}
+	for _, tag := range spec.resourceTags() {
+		input.Tags = append(input.Tags, snsTag{Key: *tag.Key, Value: *tag.Value})
+	}
+	topic := createTopicOutput{}
+	if err := sendSNS(sns, "CreateTopic", &input, &topic); err != nil {
+		return fmt.Errorf("Failed to create alarm topic: %s", err)
+	}
+	log.Infof("  topic %s", topic.TopicArn)
+
+	if spec.AlarmNotifications != nil {
+		for _, email := range spec.AlarmNotifications.Emails {
+			err := sendSNS(sns, "Subscribe", &subscribeInput{
+				TopicArn: topic.TopicArn,
+				Protocol: "email",
+				Endpoint: email,
+			}, &struct{}{})
+			if err != nil {
+				return fmt.Errorf("Failed to subscribe %s to alarm topic: %s", email, err)
+			}
+			log.Infof("  subscription of %s, pending confirmation", email)
+		}
+	}
+
+	spec.mutateGroups(func(group *instanceGroupSpec) {
+		if group.Config.Alarms != nil {
+			group.Config.Alarms.Actions = append(group.Config.Alarms.Actions, topic.TopicArn)
+		}
+	})
+	return nil
+}
+
+// destroyAlarmTopic deletes the SNS topic of the cluster's alarms, if it exists.
+func destroyAlarmTopic(config client.ConfigProvider, cluster clusterID) {
+	identity, err := sts.New(config).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		log.Warnf("  error while looking up account of alarm topic: %s", err)
+		return
+	}
+
+	topicARN := fmt.Sprintf("arn:aws:sns:%s:%s:%s", cluster.region, *identity.Account, cluster.alarmTopicName())
+	err = sendSNS(newSNSClient(config), "DeleteTopic", &deleteTopicInput{TopicArn: topicARN}, &struct{}{})
+	if awsErr, is := err.(awserr.Error); is && awsErr.Code() == "NotFound" {
+		return
+	} else if err != nil {
+		log.Warnf("  error while deleting alarm topic: %s", err)
+	}
+}
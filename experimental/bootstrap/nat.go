@@ -0,0 +1,203 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"time"
+)
+
+const (
+	// singleNATGateway routes all private subnets through one NAT gateway.
+	singleNATGateway = "single"
+
+	// perZoneNATGateways routes the private subnets of each availability zone through a NAT gateway in the zone, so
+	// that the loss of a zone does not disconnect the others.
+	perZoneNATGateways = "per-zone"
+)
+
+// privateWorkers places workers in private subnets, without public IP addresses.  Workers reach the internet through
+// NAT gateways in the public manager subnets.
+type privateWorkers struct {
+	// NATGateways is single (the default) or per-zone.
+	NATGateways string `json:",omitempty"`
+}
+
+func (p *privateWorkers) mode() string {
+	if p.NATGateways == "" {
+		return singleNATGateway
+	}
+	return p.NATGateways
+}
+
+// subnetPlacement is a subnet created in an availability zone.
+type subnetPlacement struct {
+	subnetID         *string
+	availabilityZone string
+}
+
+// createNATGateways creates NAT gateways with Elastic IP addresses in public subnets, one or one per zone of the
+// private subnets, and routes the private subnets to the internet through them.  It returns the resources to tag.
+func createNATGateways(
+	ec2Client *ec2.EC2,
+	vpcID string,
+	mode string,
+	public []subnetPlacement,
+	private []subnetPlacement) ([]*string, error) {
+
+	publicByZone := map[string]*string{}
+	for _, subnet := range public {
+		if _, has := publicByZone[subnet.availabilityZone]; !has {
+			publicByZone[subnet.availabilityZone] = subnet.subnetID
+		}
+	}
+
+	// Private subnets are routed through the gateway of their zone, or the gateway of the first zone.
+	gatewayZone := func(subnet subnetPlacement) string {
+		if mode == perZoneNATGateways {
+			return subnet.availabilityZone
+		}
+		return private[0].availabilityZone
+	}
+
+	created := []*string{}
+	routeTables := map[string]*string{}
+	for _, subnet := range private {
+		zone := gatewayZone(subnet)
+		if _, has := routeTables[zone]; !has {
+			publicSubnet, has := publicByZone[zone]
+			if !has {
+				return created, fmt.Errorf("No public subnet in %s for a NAT gateway", zone)
+			}
+
+			resources, routeTable, err := createNATGateway(ec2Client, vpcID, publicSubnet)
+			created = append(created, resources...)
+			if err != nil {
+				return created, err
+			}
+			routeTables[zone] = routeTable
+		}
+
+		_, err := ec2Client.AssociateRouteTable(&ec2.AssociateRouteTableInput{
+			SubnetId:     subnet.subnetID,
+			RouteTableId: routeTables[zone],
+		})
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// createNATGateway creates a NAT gateway in a public subnet, and a route table routing to the internet through it.
+func createNATGateway(ec2Client *ec2.EC2, vpcID string, subnetID *string) ([]*string, *string, error) {
+	created := []*string{}
+
+	address, err := ec2Client.AllocateAddress(&ec2.AllocateAddressInput{Domain: aws.String(ec2.DomainTypeVpc)})
+	if err != nil {
+		return created, nil, err
+	}
+	created = append(created, address.AllocationId)
+	log.Infof("  elastic IP %s", *address.PublicIp)
+
+	gateway, err := ec2Client.CreateNatGateway(&ec2.CreateNatGatewayInput{
+		AllocationId: address.AllocationId,
+		SubnetId:     subnetID,
+	})
+	if err != nil {
+		return created, nil, err
+	}
+	gatewayID := gateway.NatGateway.NatGatewayId
+	created = append(created, gatewayID)
+	log.Infof("  NAT gateway %s, waiting for it to become available", *gatewayID)
+
+	err = ec2Client.WaitUntilNatGatewayAvailable(&ec2.DescribeNatGatewaysInput{NatGatewayIds: []*string{gatewayID}})
+	if err != nil {
+		return created, nil, fmt.Errorf("Failed while waiting for NAT gateway to become available - %s", err)
+	}
+
+	routeTable, err := ec2Client.CreateRouteTable(&ec2.CreateRouteTableInput{VpcId: aws.String(vpcID)})
+	if err != nil {
+		return created, nil, err
+	}
+	created = append(created, routeTable.RouteTable.RouteTableId)
+	log.Infof("  private route table %s", *routeTable.RouteTable.RouteTableId)
+
+	_, err = ec2Client.CreateRoute(&ec2.CreateRouteInput{
+		RouteTableId:         routeTable.RouteTable.RouteTableId,
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		NatGatewayId:         gatewayID,
+	})
+	if err != nil {
+		return created, nil, err
+	}
+
+	return created, routeTable.RouteTable.RouteTableId, nil
+}
+
+// withoutPublicAddress launches instances without public IP addresses.
+func withoutPublicAddress(run *ec2.RunInstancesInput) {
+	for _, networkInterface := range run.NetworkInterfaces {
+		if aws.Int64Value(networkInterface.DeviceIndex) == 0 {
+			networkInterface.AssociatePublicIpAddress = aws.Bool(false)
+		}
+	}
+}
+
+// destroyNATGateways deletes the NAT gateways of a cluster and releases their addresses.  NAT gateways must be deleted
+// before the subnets and internet gateway of the VPC.
+func destroyNATGateways(ec2Client *ec2.EC2, cluster clusterID, vpcID string) {
+	gateways, err := ec2Client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		Filter: cluster.resourceFilter(vpcID),
+	})
+	if err != nil {
+		log.Warnf("  error while describing NAT gateways: %s", err)
+		return
+	}
+
+	gatewayIDs := []*string{}
+	for _, gateway := range gateways.NatGateways {
+		if aws.StringValue(gateway.State) == ec2.NatGatewayStateDeleted {
+			continue
+		}
+		log.Infof("  NAT gateway %s", *gateway.NatGatewayId)
+		_, err := ec2Client.DeleteNatGateway(&ec2.DeleteNatGatewayInput{NatGatewayId: gateway.NatGatewayId})
+		if err != nil {
+			log.Warnf("  error while deleting NAT gateway: %s", err)
+			continue
+		}
+		gatewayIDs = append(gatewayIDs, gateway.NatGatewayId)
+	}
+
+	// Addresses are only released once their gateways are deleted.
+	for i := 0; i < 60 && len(gatewayIDs) > 0; i++ {
+		remaining, err := ec2Client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{NatGatewayIds: gatewayIDs})
+		if err != nil {
+			break
+		}
+		deleted := true
+		for _, gateway := range remaining.NatGateways {
+			deleted = deleted && aws.StringValue(gateway.State) == ec2.NatGatewayStateDeleted
+		}
+		if deleted {
+			break
+		}
+		time.Sleep(5 * time.Second)
+	}
+
+	addresses, err := ec2Client.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{cluster.clusterFilter()},
+	})
+	if err != nil {
+		log.Warnf("  error while describing elastic IPs: %s", err)
+		return
+	}
+	for _, address := range addresses.Addresses {
+		log.Infof("  elastic IP %s", *address.PublicIp)
+		_, err := ec2Client.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: address.AllocationId})
+		if err != nil {
+			log.Warnf("  error while releasing elastic IP: %s", err)
+		}
+	}
+}
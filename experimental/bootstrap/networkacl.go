@@ -0,0 +1,368 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net"
+	"strings"
+)
+
+const (
+	// defaultNetworkACLRule is the rule number of the rule that denies traffic not matched by other rules, which
+	// cannot be changed.
+	defaultNetworkACLRule = 32767
+
+	maxPort = 65535
+)
+
+// networkACLProtocols are the protocol numbers of the protocols of network ACL rules.
+var networkACLProtocols = map[string]string{"all": "-1", "icmp": "1", "tcp": "6", "udp": "17"}
+
+// networkACL is the network ACL of the subnets of a cluster, in place of the default network ACL of the VPC.  Traffic
+// not allowed by its rules is denied.  Network ACLs are stateless, so responses must be allowed by the rules of the
+// opposite direction, typically with the ephemeral ports 1024-65535.
+type networkACL struct {
+	Ingress []networkACLRule `json:",omitempty"`
+	Egress  []networkACLRule `json:",omitempty"`
+}
+
+// networkACLRule is a rule of a network ACL.  Rules are evaluated in the order of their rule numbers.
+type networkACLRule struct {
+	RuleNumber int64
+
+	// Protocol is tcp, udp, icmp, or all (the default).
+	Protocol string `json:",omitempty"`
+
+	CidrBlock string
+
+	// FromPort and ToPort are the range of TCP or UDP ports, which is all ports when they are not set.
+	FromPort int64 `json:",omitempty"`
+	ToPort   int64 `json:",omitempty"`
+
+	// Deny denies the traffic rather than allowing it.
+	Deny bool `json:",omitempty"`
+}
+
+// normalized returns the rule with the defaults of its protocol and ports, as it is reported by
+// DescribeNetworkAcls.
+func (r networkACLRule) normalized() networkACLRule {
+	if r.Protocol == "" {
+		r.Protocol = "all"
+	}
+	if r.Protocol != "tcp" && r.Protocol != "udp" {
+		r.FromPort, r.ToPort = 0, 0
+	} else if r.FromPort == 0 && r.ToPort == 0 {
+		r.ToPort = maxPort
+	}
+	return r
+}
+
+func (a *networkACL) validate() error {
+	if a == nil {
+		return nil
+	}
+	errs := []string{}
+	for _, direction := range []struct {
+		name  string
+		rules []networkACLRule
+	}{{"Ingress", a.Ingress}, {"Egress", a.Egress}} {
+		numbers := map[int64]bool{}
+		for _, rule := range direction.rules {
+			prefix := fmt.Sprintf("NetworkACL.%s rule %d: ", direction.name, rule.RuleNumber)
+			if rule.RuleNumber < 1 || rule.RuleNumber >= defaultNetworkACLRule {
+				errs = append(errs, prefix+fmt.Sprintf("RuleNumber must be between 1 and %d", defaultNetworkACLRule-1))
+			}
+			if numbers[rule.RuleNumber] {
+				errs = append(errs, prefix+"RuleNumber must be unique")
+			}
+			numbers[rule.RuleNumber] = true
+
+			normalized := rule.normalized()
+			if _, known := networkACLProtocols[normalized.Protocol]; !known {
+				errs = append(errs, prefix+fmt.Sprintf("Protocol must be tcp, udp, icmp, or all: %s", rule.Protocol))
+			}
+			if _, _, err := net.ParseCIDR(rule.CidrBlock); err != nil || !strings.Contains(rule.CidrBlock, ".") {
+				errs = append(errs, prefix+fmt.Sprintf("CidrBlock must be an IPv4 CIDR block: %s", rule.CidrBlock))
+			}
+			if normalized.FromPort < 0 || normalized.FromPort > normalized.ToPort || normalized.ToPort > maxPort {
+				errs = append(errs, prefix+fmt.Sprintf("Invalid port range %d-%d", rule.FromPort, rule.ToPort))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// entryRule translates an entry of a network ACL to a rule.
+func entryRule(entry *ec2.NetworkAclEntry) networkACLRule {
+	rule := networkACLRule{
+		RuleNumber: aws.Int64Value(entry.RuleNumber),
+		Protocol:   aws.StringValue(entry.Protocol),
+		CidrBlock:  aws.StringValue(entry.CidrBlock),
+		Deny:       aws.StringValue(entry.RuleAction) == ec2.RuleActionDeny,
+	}
+	for name, number := range networkACLProtocols {
+		if number == rule.Protocol {
+			rule.Protocol = name
+		}
+	}
+	if entry.PortRange != nil {
+		rule.FromPort = aws.Int64Value(entry.PortRange.From)
+		rule.ToPort = aws.Int64Value(entry.PortRange.To)
+	}
+	return rule.normalized()
+}
+
+// ruleAction returns the action of a rule.
+func (r networkACLRule) ruleAction() *string {
+	if r.Deny {
+		return aws.String(ec2.RuleActionDeny)
+	}
+	return aws.String(ec2.RuleActionAllow)
+}
+
+// createEntryInput creates the request of the entry of a normalized rule.
+func (r networkACLRule) createEntryInput(aclID *string, egress bool) *ec2.CreateNetworkAclEntryInput {
+	input := &ec2.CreateNetworkAclEntryInput{
+		NetworkAclId: aclID,
+		Egress:       aws.Bool(egress),
+		RuleNumber:   aws.Int64(r.RuleNumber),
+		Protocol:     aws.String(networkACLProtocols[r.Protocol]),
+		CidrBlock:    aws.String(r.CidrBlock),
+		RuleAction:   r.ruleAction(),
+	}
+	switch r.Protocol {
+	case "tcp", "udp":
+		input.PortRange = &ec2.PortRange{From: aws.Int64(r.FromPort), To: aws.Int64(r.ToPort)}
+	case "icmp":
+		input.IcmpTypeCode = &ec2.IcmpTypeCode{Type: aws.Int64(-1), Code: aws.Int64(-1)}
+	}
+	return input
+}
+
+// findNetworkACL returns the network ACL created for a cluster, or nil if there is none.
+func findNetworkACL(ec2Client *ec2.EC2, cluster clusterID, vpcID string) (*ec2.NetworkAcl, error) {
+	acls, err := ec2Client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up network ACLs: %s", err)
+	}
+	switch len(acls.NetworkAcls) {
+	case 0:
+		return nil, nil
+	case 1:
+		return acls.NetworkAcls[0], nil
+	}
+	return nil, fmt.Errorf("Found multiple network ACLs for cluster %s", cluster.name)
+}
+
+// reconcileNetworkACL applies the changes needed for the network ACL of a cluster to have the declared rules, and to
+// be associated with all subnets of the cluster.  The network ACL is created when it is first declared, and its
+// subnets are returned to the default network ACL of the VPC when it is no longer declared.  Rules added out of band
+// are deleted, since the network ACL is managed by the cluster.
+func reconcileNetworkACL(ec2Client *ec2.EC2, spec *clusterSpec, vpcID string) error {
+	cluster := spec.cluster()
+	acl, err := findNetworkACL(ec2Client, cluster, vpcID)
+	if err != nil {
+		return err
+	}
+	if spec.NetworkACL == nil {
+		if acl != nil {
+			log.Infof("Removing the network ACL of cluster %s", cluster.name)
+			destroyNetworkACL(ec2Client, cluster, vpcID)
+		}
+		return nil
+	}
+
+	log.Infof("Reconciling the network ACL of cluster %s", cluster.name)
+	if acl == nil {
+		created, err := ec2Client.CreateNetworkAcl(&ec2.CreateNetworkAclInput{VpcId: aws.String(vpcID)})
+		if err != nil {
+			return fmt.Errorf("Failed to create network ACL: %s", err)
+		}
+		acl = created.NetworkAcl
+		log.Infof("  network ACL %s", *acl.NetworkAclId)
+		_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{acl.NetworkAclId},
+			Tags:      spec.resourceTags(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := reconcileNetworkACLEntries(ec2Client, acl, *spec.NetworkACL); err != nil {
+		return fmt.Errorf("Failed to reconcile network ACL %s: %s", *acl.NetworkAclId, err)
+	}
+	return associateNetworkACL(ec2Client, cluster, vpcID, acl.NetworkAclId)
+}
+
+// reconcileNetworkACLEntries creates, replaces, and deletes the entries of a network ACL to match its rules.
+func reconcileNetworkACLEntries(ec2Client *ec2.EC2, acl *ec2.NetworkAcl, desired networkACL) error {
+	type entryKey struct {
+		egress     bool
+		ruleNumber int64
+	}
+	existing := map[entryKey]networkACLRule{}
+	for _, entry := range acl.Entries {
+		if aws.Int64Value(entry.RuleNumber) != defaultNetworkACLRule {
+			existing[entryKey{aws.BoolValue(entry.Egress), aws.Int64Value(entry.RuleNumber)}] = entryRule(entry)
+		}
+	}
+
+	wanted := map[entryKey]bool{}
+	for _, direction := range []struct {
+		egress bool
+		rules  []networkACLRule
+	}{{false, desired.Ingress}, {true, desired.Egress}} {
+		for _, rule := range direction.rules {
+			rule = rule.normalized()
+			key := entryKey{direction.egress, rule.RuleNumber}
+			wanted[key] = true
+			input := rule.createEntryInput(acl.NetworkAclId, direction.egress)
+
+			current, has := existing[key]
+			switch {
+			case !has:
+				log.Infof("  %s create rule %d %s", *acl.NetworkAclId, rule.RuleNumber, directionName(direction.egress))
+				if _, err := ec2Client.CreateNetworkAclEntry(input); err != nil {
+					return err
+				}
+			case current != rule:
+				log.Infof("  %s replace rule %d %s", *acl.NetworkAclId, rule.RuleNumber, directionName(direction.egress))
+				_, err := ec2Client.ReplaceNetworkAclEntry(&ec2.ReplaceNetworkAclEntryInput{
+					NetworkAclId: input.NetworkAclId,
+					Egress:       input.Egress,
+					RuleNumber:   input.RuleNumber,
+					Protocol:     input.Protocol,
+					CidrBlock:    input.CidrBlock,
+					RuleAction:   input.RuleAction,
+					PortRange:    input.PortRange,
+					IcmpTypeCode: input.IcmpTypeCode,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, entry := range acl.Entries {
+		key := entryKey{aws.BoolValue(entry.Egress), aws.Int64Value(entry.RuleNumber)}
+		if _, managed := existing[key]; !managed || wanted[key] {
+			continue
+		}
+		log.Infof("  %s delete rule %d %s", *acl.NetworkAclId, key.ruleNumber, directionName(key.egress))
+		_, err := ec2Client.DeleteNetworkAclEntry(&ec2.DeleteNetworkAclEntryInput{
+			NetworkAclId: acl.NetworkAclId,
+			Egress:       aws.Bool(key.egress),
+			RuleNumber:   aws.Int64(key.ruleNumber),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func directionName(egress bool) string {
+	if egress {
+		return "egress"
+	}
+	return "ingress"
+}
+
+// associateNetworkACL associates the subnets of a cluster with a network ACL, replacing their current network ACLs.
+func associateNetworkACL(ec2Client *ec2.EC2, cluster clusterID, vpcID string, aclID *string) error {
+	subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return fmt.Errorf("Failed to look up subnets: %s", err)
+	}
+	subnetIDs := []*string{}
+	for _, subnet := range subnets.Subnets {
+		subnetIDs = append(subnetIDs, subnet.SubnetId)
+	}
+	if len(subnetIDs) == 0 {
+		return nil
+	}
+	return replaceNetworkACLAssociations(ec2Client, subnetIDs, aclID)
+}
+
+// replaceNetworkACLAssociations associates subnets with a network ACL.  Every subnet is associated with a network ACL,
+// so the associations are replaced rather than created.
+func replaceNetworkACLAssociations(ec2Client *ec2.EC2, subnetIDs []*string, aclID *string) error {
+	acls, err := ec2Client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{Filters: []*ec2.Filter{
+		{Name: aws.String("association.subnet-id"), Values: subnetIDs},
+	}})
+	if err != nil {
+		return fmt.Errorf("Failed to look up network ACL associations: %s", err)
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range subnetIDs {
+		wanted[*id] = true
+	}
+	for _, acl := range acls.NetworkAcls {
+		if aws.StringValue(acl.NetworkAclId) == *aclID {
+			continue
+		}
+		for _, association := range acl.Associations {
+			if !wanted[aws.StringValue(association.SubnetId)] {
+				continue
+			}
+			log.Infof("  associating subnet %s with network ACL %s", *association.SubnetId, *aclID)
+			_, err := ec2Client.ReplaceNetworkAclAssociation(&ec2.ReplaceNetworkAclAssociationInput{
+				AssociationId: association.NetworkAclAssociationId,
+				NetworkAclId:  aclID,
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to associate subnet %s with network ACL %s: %s", *association.SubnetId, *aclID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// destroyNetworkACL returns the subnets of the network ACL of a cluster to the default network ACL of the VPC, and
+// deletes it.
+func destroyNetworkACL(ec2Client *ec2.EC2, cluster clusterID, vpcID string) {
+	acl, err := findNetworkACL(ec2Client, cluster, vpcID)
+	if err != nil {
+		log.Warnf("  error while describing network ACLs: %s", err)
+		return
+	}
+	if acl == nil {
+		return
+	}
+
+	if len(acl.Associations) > 0 {
+		defaults, err := ec2Client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}},
+			{Name: aws.String("default"), Values: []*string{aws.String("true")}},
+		}})
+		if err != nil || len(defaults.NetworkAcls) != 1 {
+			log.Warnf("  error while looking up the default network ACL of VPC %s: %v", vpcID, err)
+			return
+		}
+		for _, association := range acl.Associations {
+			_, err := ec2Client.ReplaceNetworkAclAssociation(&ec2.ReplaceNetworkAclAssociationInput{
+				AssociationId: association.NetworkAclAssociationId,
+				NetworkAclId:  defaults.NetworkAcls[0].NetworkAclId,
+			})
+			if err != nil {
+				log.Warnf("  error while disassociating subnet %s from network ACL: %s",
+					aws.StringValue(association.SubnetId), err)
+			}
+		}
+	}
+
+	log.Infof("  network ACL %s", *acl.NetworkAclId)
+	_, err = ec2Client.DeleteNetworkAcl(&ec2.DeleteNetworkAclInput{NetworkAclId: acl.NetworkAclId})
+	if err != nil {
+		log.Warnf("  error while deleting network ACL: %s", err)
+	}
+}
@@ -0,0 +1,204 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/docker/infrakit.aws/plugin/store"
+	"io"
+	"strings"
+)
+
+// clusterOutputs are the connection details of a cluster created by bootstrap, for downstream automation.
+type clusterOutputs struct {
+	ClusterName string
+	Region      string
+	VpcID       string
+
+	// ManagerIPs are the private IP addresses of the managers.
+	ManagerIPs []string
+
+	// BootLeader is the first manager, once it is running.
+	BootLeader *instanceOutputs `json:",omitempty"`
+
+	// ManagerEndpoint is the address of the manager load balancer, if any.
+	ManagerEndpoint string `json:",omitempty"`
+
+	// SessionManager describes connecting to the boot leader, for clusters with SSMAccess.
+	SessionManager *sessionManagerOutputs `json:",omitempty"`
+
+	FileSystemID string `json:",omitempty"`
+
+	Groups []groupOutputs
+}
+
+type instanceOutputs struct {
+	InstanceID       string
+	PrivateIPAddress string `json:",omitempty"`
+	PrivateDNSName   string `json:",omitempty"`
+	PublicIPAddress  string `json:",omitempty"`
+	PublicDNSName    string `json:",omitempty"`
+}
+
+type groupOutputs struct {
+	Name               string
+	Type               string
+	SubnetID           string   `json:",omitempty"`
+	SecurityGroupIDs   []string `json:",omitempty"`
+	InstanceProfileARN string   `json:",omitempty"`
+	TargetGroupARNs    []string `json:",omitempty"`
+}
+
+// securityGroupsOf are the security groups that instances are launched with.
+func securityGroupsOf(run ec2.RunInstancesInput) []*string {
+	if len(run.NetworkInterfaces) > 0 {
+		return run.NetworkInterfaces[0].Groups
+	}
+	return run.SecurityGroupIds
+}
+
+// outputs are the details of the resources created for the cluster in a VPC.
+func (s *clusterSpec) outputs(vpcID string) *clusterOutputs {
+	outputs := clusterOutputs{
+		ClusterName:     s.ClusterName,
+		Region:          s.cluster().region,
+		VpcID:           vpcID,
+		ManagerIPs:      s.ManagerIPs,
+		ManagerEndpoint: s.managerEndpoint,
+		FileSystemID:    s.fileSystemID,
+		Groups:          []groupOutputs{},
+	}
+	for _, group := range s.Groups {
+		run := group.Config.RunInstancesInput
+		groupOutput := groupOutputs{
+			Name:             string(group.Name),
+			Type:             group.Type,
+			SubnetID:         aws.StringValue(subnetOf(run)),
+			SecurityGroupIDs: aws.StringValueSlice(securityGroupsOf(run)),
+			TargetGroupARNs:  group.Config.TargetGroupARNs,
+		}
+		if run.IamInstanceProfile != nil {
+			groupOutput.InstanceProfileARN = aws.StringValue(run.IamInstanceProfile.Arn)
+		}
+		outputs.Groups = append(outputs.Groups, groupOutput)
+	}
+	return &outputs
+}
+
+func newInstanceOutputs(ec2Instance *ec2.Instance) *instanceOutputs {
+	return &instanceOutputs{
+		InstanceID:       aws.StringValue(ec2Instance.InstanceId),
+		PrivateIPAddress: aws.StringValue(ec2Instance.PrivateIpAddress),
+		PrivateDNSName:   aws.StringValue(ec2Instance.PrivateDnsName),
+		PublicIPAddress:  aws.StringValue(ec2Instance.PublicIpAddress),
+		PublicDNSName:    aws.StringValue(ec2Instance.PublicDnsName),
+	}
+}
+
+// outputsDestinations are the places the outputs of a cluster are written to, in addition to stdout.
+type outputsDestinations struct {
+	// S3URL is an s3://bucket/key URL of an object to write.
+	S3URL string
+
+	// SSMParameter is the name of an SSM parameter to write.
+	SSMParameter string
+}
+
+// parseS3URL splits an s3://bucket/key URL.
+func parseS3URL(url string) (string, string, error) {
+	path := strings.TrimPrefix(url, "s3://")
+	parts := strings.SplitN(path, "/", 2)
+	if path == url || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("Invalid S3 URL %s, expected s3://<bucket>/<key>", url)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (d outputsDestinations) validate() error {
+	if d.S3URL != "" {
+		if _, _, err := parseS3URL(d.S3URL); err != nil {
+			return err
+		}
+	}
+	if d.SSMParameter != "" && !strings.HasPrefix(d.SSMParameter, "/") && strings.Contains(d.SSMParameter, "/") {
+		return fmt.Errorf("SSM parameter names with a path must start with /: %s", d.SSMParameter)
+	}
+	return nil
+}
+
+// newSSMClient creates a client of SSM.  SSM is not vendored, so the client is assembled from the SDK's JSON protocol
+// handlers.
+func newSSMClient(config client.ConfigProvider) *client.Client {
+	c := config.ClientConfig("ssm")
+	ssm := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "ssm",
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2014-11-06",
+			JSONVersion:   "1.1",
+			TargetPrefix:  "AmazonSSM",
+		},
+		c.Handlers)
+	ssm.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	ssm.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	ssm.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	ssm.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	ssm.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+	return ssm
+}
+
+type putParameterInput struct {
+	Name        string
+	Description string
+	Value       string
+	Type        string
+	Overwrite   bool
+}
+
+// writeOutputs writes the outputs of a cluster to stdout and to the configured destinations.
+func writeOutputs(config client.ConfigProvider, stdout io.Writer, outputs *clusterOutputs, to outputsDestinations) error {
+	data, err := json.MarshalIndent(outputs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(stdout, string(data)); err != nil {
+		return err
+	}
+
+	if to.S3URL != "" {
+		bucket, key, err := parseS3URL(to.S3URL)
+		if err != nil {
+			return err
+		}
+		if err := store.NewS3Snapshot(s3.New(config), bucket, key, "").Save(outputs); err != nil {
+			return fmt.Errorf("Failed to write outputs to %s: %s", to.S3URL, err)
+		}
+		log.Infof("Wrote outputs to %s", to.S3URL)
+	}
+
+	if to.SSMParameter != "" {
+		input := putParameterInput{
+			Name:        to.SSMParameter,
+			Description: fmt.Sprintf("Outputs of cluster %s", outputs.ClusterName),
+			Value:       string(data),
+			Type:        "String",
+			Overwrite:   true,
+		}
+		operation := &request.Operation{Name: "PutParameter", HTTPMethod: "POST", HTTPPath: "/"}
+		if err := newSSMClient(config).NewRequest(operation, &input, &struct{}{}).Send(); err != nil {
+			return fmt.Errorf("Failed to write outputs to SSM parameter %s: %s", to.SSMParameter, err)
+		}
+		log.Infof("Wrote outputs to SSM parameter %s", to.SSMParameter)
+	}
+	return nil
+}
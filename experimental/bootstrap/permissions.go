@@ -0,0 +1,277 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"sort"
+	"strings"
+)
+
+// simulatedActionBatch is the number of actions simulated by each SimulatePrincipalPolicy request.
+const simulatedActionBatch = 50
+
+// actionSet collects IAM actions.
+type actionSet map[string]bool
+
+func (a actionSet) add(actions ...string) {
+	for _, action := range actions {
+		a[action] = true
+	}
+}
+
+func (a actionSet) sorted() []string {
+	actions := []string{}
+	for action := range a {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// launchActions are the actions performed with the credentials of a group, to launch its instances.
+func (i instanceGroupSpec) launchActions() []string {
+	actions := []string{"ec2:DescribeKeyPairs", "ec2:DescribeImages", "ec2:RunInstances", "ec2:CreateTags"}
+	if i.InstanceRequirements != nil {
+		actions = append(actions, "ec2:GetInstanceTypesFromInstanceRequirements", "ec2:DescribeInstanceTypes")
+	}
+	return actions
+}
+
+// plannedActions are the actions bootstrap performs to create a cluster, other than those performed with the
+// credentials of groups.
+func (s *clusterSpec) plannedActions() []string {
+	actions := actionSet{}
+	actions.add(
+		"ec2:DescribeSubnets",
+		"ec2:DescribeSecurityGroups",
+		"ec2:DescribeInstances",
+		"ec2:DescribeInstanceTypeOfferings",
+		"ec2:DescribeInstanceTypes",
+		"ec2:CreateTags",
+		"ec2:CreateSecurityGroup",
+		"ec2:AuthorizeSecurityGroupIngress",
+		"ec2:AuthorizeSecurityGroupEgress",
+		"ec2:CreateVolume",
+		"iam:GetRole",
+		"iam:CreateRole",
+		"iam:CreatePolicy",
+		"iam:ListRolePolicies",
+		"iam:ListAttachedRolePolicies",
+		"iam:AttachRolePolicy",
+		"iam:CreateInstanceProfile",
+		"iam:AddRoleToInstanceProfile",
+		"iam:GetInstanceProfile",
+		"iam:PassRole",
+		"servicequotas:GetServiceQuota",
+	)
+
+	if s.existingVpcID == "" {
+		actions.add(
+			"ec2:CreateVpc",
+			"ec2:DescribeVpcs",
+			"ec2:ModifyVpcAttribute",
+			"ec2:CreateSubnet",
+			"ec2:CreateRouteTable",
+			"ec2:CreateRoute",
+			"ec2:AssociateRouteTable",
+			"ec2:CreateInternetGateway",
+			"ec2:AttachInternetGateway",
+		)
+	}
+	if s.PrivateWorkers != nil {
+		actions.add(
+			"ec2:AllocateAddress",
+			"ec2:CreateNatGateway",
+			"ec2:DescribeNatGateways",
+			"ec2:CreateRouteTable",
+			"ec2:CreateRoute",
+			"ec2:AssociateRouteTable",
+		)
+	}
+	if s.Budget != nil && s.Budget.MaxHourlyCost > 0 {
+		actions.add("pricing:GetProducts")
+	}
+	if len(s.VpcEndpoints) > 0 {
+		actions.add("ec2:CreateVpcEndpoint", "ec2:DescribeVpcEndpoints", "ec2:DescribeRouteTables")
+	}
+	if s.DualStack {
+		actions.add("ec2:AssociateSubnetCidrBlock", "ec2:ModifySubnetAttribute", "ec2:CreateRoute")
+	}
+	if len(s.Routes) > 0 {
+		actions.add("ec2:DescribeRouteTables", "ec2:CreateRoute")
+	}
+	if s.NetworkACL != nil {
+		actions.add(
+			"ec2:CreateNetworkAcl",
+			"ec2:DescribeNetworkAcls",
+			"ec2:CreateNetworkAclEntry",
+			"ec2:ReplaceNetworkAclAssociation",
+		)
+	}
+	if s.TransitGateway != nil {
+		actions.add(
+			"ec2:CreateTransitGatewayVpcAttachment",
+			"ec2:DescribeTransitGatewayVpcAttachments",
+			"ec2:AssociateTransitGatewayRouteTable",
+			"ec2:EnableTransitGatewayRouteTablePropagation",
+			"ec2:DescribeRouteTables",
+			"ec2:CreateRoute",
+		)
+	}
+	if len(s.Peering) > 0 {
+		actions.add(
+			"ec2:CreateVpcPeeringConnection",
+			"ec2:DescribeVpcPeeringConnections",
+			"ec2:AcceptVpcPeeringConnection",
+			"ec2:DescribeRouteTables",
+			"ec2:CreateRoute",
+			"ec2:ReplaceRoute",
+		)
+	}
+	if s.SSMAccess != nil && len(s.SSMAccess.Commands) > 0 {
+		actions.add("ssm:DescribeInstanceInformation", "ssm:SendCommand", "ssm:GetCommandInvocation")
+	}
+	if s.StaticManagerInterfaces {
+		actions.add("ec2:CreateNetworkInterface", "ec2:DescribeNetworkInterfaces")
+	}
+	if s.Logs != nil {
+		actions.add("logs:CreateLogGroup", "logs:PutRetentionPolicy", "logs:TagLogGroup")
+	}
+	if len(s.workerPolicyStatements()) > 0 {
+		actions.add("iam:PutRolePolicy")
+	}
+	if s.hasAlarms() {
+		actions.add("sns:CreateTopic", "sns:TagResource")
+		if s.AlarmNotifications != nil && len(s.AlarmNotifications.Emails) > 0 {
+			actions.add("sns:Subscribe")
+		}
+	}
+	if s.ManagerLoadBalancer {
+		actions.add(
+			"elasticloadbalancing:CreateLoadBalancer",
+			"elasticloadbalancing:CreateTargetGroup",
+			"elasticloadbalancing:CreateListener",
+			"elasticloadbalancing:AddTags",
+		)
+	}
+	if s.SharedStorage != nil {
+		actions.add(
+			"elasticfilesystem:CreateFileSystem",
+			"elasticfilesystem:CreateMountTarget",
+			"elasticfilesystem:CreateTags",
+			"elasticfilesystem:DescribeFileSystems",
+			"elasticfilesystem:DescribeMountTargets",
+		)
+	}
+	if s.State != nil {
+		actions.add("s3:CreateBucket", "s3:ListBucket", "s3:PutBucketVersioning", "s3:PutObject")
+		if s.State.KMSKeyID != "" {
+			actions.add("kms:GenerateDataKey")
+		}
+	}
+	for _, grp := range s.Groups {
+		if grp.Credentials == nil {
+			actions.add(grp.launchActions()...)
+		}
+	}
+	return actions.sorted()
+}
+
+// principalARN is the IAM principal of a caller identity, which is a role for assumed role sessions.  An empty ARN is
+// returned for principals that may not be simulated, such as the root user.
+func principalARN(iamClient *iam.IAM, callerARN string) string {
+	parts := strings.SplitN(callerARN, ":", 6)
+	if len(parts) != 6 {
+		return ""
+	}
+	resource := parts[5]
+	switch {
+	case strings.HasPrefix(resource, "user/"):
+		return callerARN
+	case strings.HasPrefix(resource, "assumed-role/"):
+		roleName := strings.Split(resource, "/")[1]
+
+		// The role is looked up for its path, which the session ARN omits.
+		role, err := iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+		if err == nil {
+			return aws.StringValue(role.Role.Arn)
+		}
+		return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], roleName)
+	}
+	return ""
+}
+
+// deniedActions simulates the policies of the caller of a client for actions, returning the actions that are denied.
+func deniedActions(config client.ConfigProvider, actions []string) ([]string, error) {
+	identity, err := sts.New(config).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up caller identity: %s", err)
+	}
+
+	iamClient := iam.New(config)
+	principal := principalARN(iamClient, aws.StringValue(identity.Arn))
+	if principal == "" {
+		log.Warnf("  permissions of %s may not be simulated", aws.StringValue(identity.Arn))
+		return nil, nil
+	}
+
+	denied := []string{}
+	for start := 0; start < len(actions); start += simulatedActionBatch {
+		end := start + simulatedActionBatch
+		if end > len(actions) {
+			end = len(actions)
+		}
+		err := iamClient.SimulatePrincipalPolicyPages(&iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principal),
+			ActionNames:     aws.StringSlice(actions[start:end]),
+		}, func(page *iam.SimulatePolicyResponse, lastPage bool) bool {
+			for _, result := range page.EvaluationResults {
+				if aws.StringValue(result.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+					denied = append(denied, aws.StringValue(result.EvalActionName))
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to simulate the policies of %s: %s", principal, err)
+		}
+	}
+	sort.Strings(denied)
+	return denied, nil
+}
+
+// checkPermissions simulates the IAM policies of the caller for every action bootstrap will perform, and of the
+// credentials of each group for the actions that launch its instances, so that missing permissions are reported
+// before any resource is created.  Callers that may not simulate policies are warned rather than failed, since they
+// may nonetheless have the permissions.
+func (s *clusterSpec) checkPermissions(config client.ConfigProvider) error {
+	log.Info("Checking permissions")
+	errs := []string{}
+	check := func(description string, config client.ConfigProvider, actions []string) {
+		denied, err := deniedActions(config, actions)
+		if err != nil {
+			log.Warnf("  %s", err)
+			return
+		}
+		if len(denied) > 0 {
+			errs = append(errs, fmt.Sprintf("%s lack permission for %s", description, strings.Join(denied, ", ")))
+		}
+	}
+
+	check("The credentials of bootstrap", config, s.plannedActions())
+	for _, grp := range s.Groups {
+		if grp.Credentials != nil {
+			check(fmt.Sprintf("The credentials of group %s", grp.Name),
+				s.cluster().getGroupAWSClient(config, grp), grp.launchActions())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Missing permissions:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
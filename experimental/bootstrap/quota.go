@@ -0,0 +1,307 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"sort"
+	"strings"
+)
+
+// vCPUQuota is a service quota limiting the vCPUs of running on-demand instances of a set of instance families.
+type vCPUQuota struct {
+	code        string
+	description string
+}
+
+var (
+	standardQuota   = vCPUQuota{"L-1216C47A", "Running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instances"}
+	highMemoryQuota = vCPUQuota{"L-43DA4232", "Running On-Demand High Memory instances"}
+
+	// familyQuotas maps the family of an instance type, the letters of its name preceding the generation, to the
+	// quota limiting it.
+	familyQuotas = map[string]vCPUQuota{
+		"a":   standardQuota,
+		"c":   standardQuota,
+		"d":   standardQuota,
+		"h":   standardQuota,
+		"i":   standardQuota,
+		"im":  standardQuota,
+		"is":  standardQuota,
+		"m":   standardQuota,
+		"r":   standardQuota,
+		"t":   standardQuota,
+		"z":   standardQuota,
+		"f":   {"L-74FC7D96", "Running On-Demand F instances"},
+		"g":   {"L-DB2E81BA", "Running On-Demand G and VT instances"},
+		"vt":  {"L-DB2E81BA", "Running On-Demand G and VT instances"},
+		"p":   {"L-417A185B", "Running On-Demand P instances"},
+		"x":   {"L-7295265B", "Running On-Demand X instances"},
+		"inf": {"L-1945791B", "Running On-Demand Inf instances"},
+		"dl":  {"L-6E869C2A", "Running On-Demand DL instances"},
+		"trn": {"L-2C3B7624", "Running On-Demand Trn instances"},
+	}
+)
+
+// quotaOf returns the quota limiting an instance type, and false if the instance type is not limited by a known
+// quota.
+func quotaOf(instanceType string) (vCPUQuota, bool) {
+	if strings.HasPrefix(instanceType, "u-") {
+		return highMemoryQuota, true
+	}
+	// Strip the generation and any attributes following it, as in m5dn or c6gn.
+	family := strings.SplitN(instanceType, ".", 2)[0]
+	if i := strings.IndexAny(family, "0123456789"); i >= 0 {
+		family = family[:i]
+	}
+	quota, known := familyQuotas[family]
+	return quota, known
+}
+
+// newQuotasClient creates a client of the Service Quotas API.  The API is newer than the vendored SDK, so the client
+// is assembled from the SDK's JSON protocol handlers.
+func newQuotasClient(config client.ConfigProvider, region string) *client.Client {
+	c := config.ClientConfig("servicequotas", aws.NewConfig().WithRegion(region))
+	quotas := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "servicequotas",
+			SigningName:   "servicequotas",
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2019-06-24",
+			JSONVersion:   "1.1",
+			TargetPrefix:  "ServiceQuotasV20190624",
+		},
+		c.Handlers)
+	quotas.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	quotas.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	quotas.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	quotas.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	quotas.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+	return quotas
+}
+
+type getServiceQuotaInput struct {
+	ServiceCode string
+	QuotaCode   string
+}
+
+type getServiceQuotaOutput struct {
+	Quota struct {
+		Value float64
+	}
+}
+
+// quotaValue looks up the number of vCPUs allowed by a quota.
+func quotaValue(quotas *client.Client, quota vCPUQuota) (int64, error) {
+	output := &getServiceQuotaOutput{}
+	err := quotas.NewRequest(
+		&request.Operation{Name: "GetServiceQuota", HTTPMethod: "POST", HTTPPath: "/"},
+		&getServiceQuotaInput{ServiceCode: "ec2", QuotaCode: quota.code},
+		output).Send()
+	if err != nil {
+		return 0, err
+	}
+	return int64(output.Quota.Value), nil
+}
+
+// instanceTypeVCPUs looks up the default number of vCPUs of instance types.
+func instanceTypeVCPUs(ec2Client *ec2.EC2, instanceTypes []string) (map[string]int64, error) {
+	vCPUs := map[string]int64{}
+
+	// DescribeInstanceTypes accepts at most 100 instance types in a request.
+	for start := 0; start < len(instanceTypes); start += 100 {
+		end := start + 100
+		if end > len(instanceTypes) {
+			end = len(instanceTypes)
+		}
+		types, err := ec2ext.New(ec2Client).DescribeInstanceTypes(&ec2ext.DescribeInstanceTypesInput{
+			InstanceTypes: aws.StringSlice(instanceTypes[start:end]),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, typeInfo := range types.InstanceTypes {
+			if typeInfo.VCpuInfo != nil {
+				vCPUs[aws.StringValue(typeInfo.InstanceType)] = aws.Int64Value(typeInfo.VCpuInfo.DefaultVCpus)
+			}
+		}
+	}
+	return vCPUs, nil
+}
+
+// runningOnDemandInstances counts the pending and running on-demand instances of each instance type.  Spot instances
+// are limited by separate quotas.
+func runningOnDemandInstances(ec2Client *ec2.EC2) (map[string]int64, error) {
+	counts := map[string]int64{}
+	err := ec2Client.DescribeInstancesPages(
+		&ec2.DescribeInstancesInput{Filters: []*ec2.Filter{
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running"})},
+		}},
+		func(page *ec2.DescribeInstancesOutput, last bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					if aws.StringValue(instance.InstanceLifecycle) == ec2.InstanceLifecycleTypeSpot {
+						continue
+					}
+					counts[aws.StringValue(instance.InstanceType)]++
+				}
+			}
+			return true
+		})
+	return counts, err
+}
+
+// quotaUsage is the vCPU usage of a quota.
+type quotaUsage struct {
+	quota     vCPUQuota
+	running   int64
+	requested int64
+	groups    []string
+}
+
+// checkQuotas verifies that launching every group would not exceed the running on-demand vCPU quotas of the account,
+// counting the vCPUs of instances already running.  Groups are counted at their size, with the first instance type
+// they may launch.  Groups with separate credentials are checked against the quotas of their own account.
+func (s *clusterSpec) checkQuotas(config client.ConfigProvider) error {
+	accounts := map[groupCredentials][]instanceGroupSpec{}
+	order := []groupCredentials{}
+	for _, grp := range s.Groups {
+		credentials := groupCredentials{}
+		if grp.Credentials != nil {
+			credentials = *grp.Credentials
+		}
+		if _, exists := accounts[credentials]; !exists {
+			order = append(order, credentials)
+		}
+		accounts[credentials] = append(accounts[credentials], grp)
+	}
+
+	errs := []string{}
+	for _, credentials := range order {
+		groups := accounts[credentials]
+		if err := s.checkAccountQuotas(s.cluster().getGroupAWSClient(config, groups[0]), groups); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (s *clusterSpec) checkAccountQuotas(config client.ConfigProvider, groups []instanceGroupSpec) error {
+	ec2Client := ec2.New(config)
+
+	running, err := runningOnDemandInstances(ec2Client)
+	if err != nil {
+		return fmt.Errorf("Failed to describe running instances: %s", err)
+	}
+
+	requested := map[string]int64{}
+	requestedBy := map[string][]string{}
+	for _, grp := range groups {
+		candidates := launchCandidates(grp)
+		if len(candidates) == 0 || candidates[0].instanceType == nil || grp.Size == 0 {
+			continue
+		}
+		instanceType := *candidates[0].instanceType
+		requested[instanceType] += int64(grp.Size)
+		requestedBy[instanceType] = append(requestedBy[instanceType], string(grp.Name))
+	}
+	if len(requested) == 0 {
+		return nil
+	}
+
+	instanceTypes := []string{}
+	for instanceType := range running {
+		instanceTypes = append(instanceTypes, instanceType)
+	}
+	for instanceType := range requested {
+		if _, exists := running[instanceType]; !exists {
+			instanceTypes = append(instanceTypes, instanceType)
+		}
+	}
+	sort.Strings(instanceTypes)
+
+	vCPUs, err := instanceTypeVCPUs(ec2Client, instanceTypes)
+	if err != nil {
+		return fmt.Errorf("Failed to describe instance types: %s", err)
+	}
+
+	usage := map[string]*quotaUsage{}
+	usageOf := func(instanceType string) *quotaUsage {
+		quota, known := quotaOf(instanceType)
+		if !known {
+			return nil
+		}
+		if _, exists := usage[quota.code]; !exists {
+			usage[quota.code] = &quotaUsage{quota: quota}
+		}
+		return usage[quota.code]
+	}
+	for instanceType, count := range running {
+		if u := usageOf(instanceType); u != nil {
+			u.running += count * vCPUs[instanceType]
+		}
+	}
+	for _, instanceType := range instanceTypes {
+		count, exists := requested[instanceType]
+		if !exists {
+			continue
+		}
+		u := usageOf(instanceType)
+		if u == nil {
+			log.Warnf("No known vCPU quota for instance type %s, skipping the quota check", instanceType)
+			continue
+		}
+		u.requested += count * vCPUs[instanceType]
+		u.groups = append(u.groups, requestedBy[instanceType]...)
+	}
+
+	codes := []string{}
+	for code, u := range usage {
+		if u.requested > 0 {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	quotas := newQuotasClient(config, s.cluster().region)
+	errs := []string{}
+	for _, code := range codes {
+		u := usage[code]
+		limit, err := quotaValue(quotas, u.quota)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Failed to look up quota %s (%s): %s", code, u.quota.description, err))
+			continue
+		}
+		if u.running+u.requested > limit {
+			sort.Strings(u.groups)
+			errs = append(errs, fmt.Sprintf(
+				"Groups %s require %d vCPUs of %s, but %d of the quota of %d are in use.  "+
+					"Request a quota increase for %s, or reduce the size of the groups",
+				strings.Join(u.groups, ", "),
+				u.requested,
+				u.quota.description,
+				u.running,
+				limit,
+				code))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultNetworkTimeout is how long instances wait for the network of a cluster to become available.
+	defaultNetworkTimeout = 10 * time.Minute
+
+	readinessInterval = 5 * time.Second
+)
+
+// readinessCheck is a dependency of the instances of a cluster, which reports whether it is ready.  Checks fail when
+// a dependency enters a state it will not recover from.
+type readinessCheck struct {
+	name  string
+	ready func() (bool, error)
+}
+
+// waitUntilReady waits for checks in order, so that each dependency is only checked once those listed before it are
+// ready.
+func waitUntilReady(checks []readinessCheck, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, check := range checks {
+		for {
+			ready, err := check.ready()
+			if err != nil {
+				return fmt.Errorf("%s: %s", check.name, err)
+			}
+			if ready {
+				log.Infof("  %s ready", check.name)
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("Timed out after %s waiting for %s", timeout, check.name)
+			}
+			time.Sleep(readinessInterval)
+		}
+	}
+	return nil
+}
+
+// notFound determines whether a request failed because a resource does not exist, as newly created resources may
+// not be found for a while.
+func notFound(err error) bool {
+	awsErr, is := err.(awserr.Error)
+	return is && strings.HasSuffix(awsErr.Code(), ".NotFound")
+}
+
+// networkDependencies are the network resources that instances of a cluster depend on: the subnets and security
+// groups they are launched with, the NAT gateways that route private workers to the internet, and the VPC endpoints
+// of AWS services.
+func (s *clusterSpec) networkDependencies(ec2Client *ec2.EC2, vpcID string) []readinessCheck {
+	subnetIDs := []*string{}
+	securityGroupIDs := []*string{}
+	seen := map[string]bool{}
+	for _, grp := range s.Groups {
+		run := grp.Config.RunInstancesInput
+		if subnet := subnetOf(run); subnet != nil && !seen[*subnet] {
+			seen[*subnet] = true
+			subnetIDs = append(subnetIDs, subnet)
+		}
+		for _, securityGroup := range securityGroupsOf(run) {
+			if securityGroup != nil && !seen[*securityGroup] {
+				seen[*securityGroup] = true
+				securityGroupIDs = append(securityGroupIDs, securityGroup)
+			}
+		}
+	}
+
+	checks := []readinessCheck{}
+	if len(subnetIDs) > 0 {
+		checks = append(checks, readinessCheck{"subnets", func() (bool, error) {
+			subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: subnetIDs})
+			if notFound(err) {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			}
+			for _, subnet := range subnets.Subnets {
+				if aws.StringValue(subnet.State) != ec2.SubnetStateAvailable {
+					return false, nil
+				}
+			}
+			return len(subnets.Subnets) == len(subnetIDs), nil
+		}})
+	}
+
+	if len(securityGroupIDs) > 0 {
+		checks = append(checks, readinessCheck{"security groups", func() (bool, error) {
+			// Security groups have no state, but may not be found for a while after they are created.
+			groups, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: securityGroupIDs})
+			if notFound(err) {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			}
+			return len(groups.SecurityGroups) == len(securityGroupIDs), nil
+		}})
+	}
+
+	checks = append(checks, readinessCheck{"NAT gateways", func() (bool, error) {
+		gateways, err := ec2Client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+			Filter: s.cluster().resourceFilter(vpcID),
+		})
+		if err != nil {
+			return false, err
+		}
+		ready := true
+		for _, gateway := range gateways.NatGateways {
+			switch aws.StringValue(gateway.State) {
+			case ec2.NatGatewayStateAvailable, ec2.NatGatewayStateDeleting, ec2.NatGatewayStateDeleted:
+			case ec2.NatGatewayStateFailed:
+				return false, fmt.Errorf(
+					"NAT gateway %s failed: %s",
+					aws.StringValue(gateway.NatGatewayId),
+					aws.StringValue(gateway.FailureMessage))
+			default:
+				ready = false
+			}
+		}
+		return ready, nil
+	}})
+
+	checks = append(checks, readinessCheck{"VPC endpoints", func() (bool, error) {
+		endpoints, err := describeVpcEndpoints(ec2Client, s.cluster().resourceFilter(vpcID))
+		if err != nil {
+			return false, err
+		}
+		ready := true
+		for _, endpoint := range endpoints {
+			switch state := aws.StringValue(endpoint.State); state {
+			case "available", "Available":
+			case "failed", "Failed", "rejected", "Rejected":
+				return false, fmt.Errorf("VPC endpoint %s is %s", aws.StringValue(endpoint.VpcEndpointId), state)
+			default:
+				ready = false
+			}
+		}
+		return ready, nil
+	}})
+
+	return checks
+}
@@ -0,0 +1,228 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"sort"
+)
+
+const (
+	defaultMaxCandidates = 5
+
+	// describeInstanceTypesLimit is the number of instance types that may be described in one call.
+	describeInstanceTypesLimit = 100
+)
+
+// instanceRequirements selects the instance types of a group by the resources they provide, rather than by name.
+type instanceRequirements struct {
+	MinVCpus int64
+	MaxVCpus int64 `json:",omitempty"`
+
+	MinMemoryMiB int64
+	MaxMemoryMiB int64 `json:",omitempty"`
+
+	MinNetworkBandwidthGbps float64 `json:",omitempty"`
+
+	// Architecture is the architecture of the instance types, defaulting to the architecture of the group's image.
+	Architecture string `json:",omitempty"`
+
+	// BurstablePerformance is included, excluded, or required.  EC2 excludes burstable instance types by default.
+	BurstablePerformance string `json:",omitempty"`
+
+	// MaxCandidates is the number of instance types chosen, defaulting to 5.
+	MaxCandidates int `json:",omitempty"`
+}
+
+func (r instanceRequirements) maxCandidates() int {
+	if r.MaxCandidates < 1 {
+		return defaultMaxCandidates
+	}
+	return r.MaxCandidates
+}
+
+func (r instanceRequirements) request() *ec2ext.InstanceRequirements {
+	request := &ec2ext.InstanceRequirements{
+		VCpuCount: &ec2ext.IntegerRange{Min: aws.Int64(r.MinVCpus)},
+		MemoryMiB: &ec2ext.IntegerRange{Min: aws.Int64(r.MinMemoryMiB)},
+	}
+	if r.MaxVCpus > 0 {
+		request.VCpuCount.Max = aws.Int64(r.MaxVCpus)
+	}
+	if r.MaxMemoryMiB > 0 {
+		request.MemoryMiB.Max = aws.Int64(r.MaxMemoryMiB)
+	}
+	if r.MinNetworkBandwidthGbps > 0 {
+		request.NetworkBandwidthGbps = &ec2ext.FloatRange{Min: aws.Float64(r.MinNetworkBandwidthGbps)}
+	}
+	if r.BurstablePerformance != "" {
+		request.BurstablePerformance = aws.String(r.BurstablePerformance)
+	}
+	return request
+}
+
+// matchingInstanceTypes lists the instance types meeting requirements.
+func matchingInstanceTypes(client *ec2ext.EC2, requirements instanceRequirements, architecture string) ([]string, error) {
+	input := &ec2ext.GetInstanceTypesFromInstanceRequirementsInput{
+		ArchitectureTypes:    []*string{aws.String(architecture)},
+		VirtualizationTypes:  []*string{aws.String("hvm")},
+		InstanceRequirements: requirements.request(),
+	}
+
+	instanceTypes := []string{}
+	for {
+		output, err := client.GetInstanceTypesFromInstanceRequirements(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range output.InstanceTypes {
+			instanceTypes = append(instanceTypes, aws.StringValue(info.InstanceType))
+		}
+		if output.NextToken == nil {
+			return instanceTypes, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// offeredInstanceTypes returns the instance types that are offered in an availability zone.
+func offeredInstanceTypes(client *ec2ext.EC2, az string) (map[string]bool, error) {
+	input := &ec2ext.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String("availability-zone"),
+		Filters:      []*ec2.Filter{{Name: aws.String("location"), Values: []*string{aws.String(az)}}},
+	}
+
+	offered := map[string]bool{}
+	for {
+		output, err := client.DescribeInstanceTypeOfferings(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, offering := range output.InstanceTypeOfferings {
+			offered[aws.StringValue(offering.InstanceType)] = true
+		}
+		if output.NextToken == nil {
+			return offered, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// byResources orders instance types from the fewest vCPUs and least memory, so that the cheapest types meeting the
+// requirements are preferred.
+type byResources []*ec2ext.InstanceTypeInfo
+
+func (b byResources) Len() int      { return len(b) }
+func (b byResources) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byResources) Less(i, j int) bool {
+	vcpus := func(info *ec2ext.InstanceTypeInfo) int64 {
+		if info.VCpuInfo == nil {
+			return 0
+		}
+		return aws.Int64Value(info.VCpuInfo.DefaultVCpus)
+	}
+	memory := func(info *ec2ext.InstanceTypeInfo) int64 {
+		if info.MemoryInfo == nil {
+			return 0
+		}
+		return aws.Int64Value(info.MemoryInfo.SizeInMiB)
+	}
+
+	switch {
+	case vcpus(b[i]) != vcpus(b[j]):
+		return vcpus(b[i]) < vcpus(b[j])
+	case memory(b[i]) != memory(b[j]):
+		return memory(b[i]) < memory(b[j])
+	default:
+		return aws.StringValue(b[i].InstanceType) < aws.StringValue(b[j].InstanceType)
+	}
+}
+
+// selectInstanceTypes chooses the instance types of a group with instance requirements, in order of preference.
+// The instance types are offered in the availability zone, and ordered from the smallest.
+func selectInstanceTypes(
+	ec2Client *ec2.EC2,
+	requirements instanceRequirements,
+	architecture string,
+	az string) ([]string, error) {
+
+	client := ec2ext.New(ec2Client)
+
+	matching, err := matchingInstanceTypes(client, requirements, architecture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find instance types matching requirements: %s", err)
+	}
+
+	offered, err := offeredInstanceTypes(client, az)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instance type offerings: %s", err)
+	}
+
+	candidates := []*string{}
+	for _, instanceType := range matching {
+		if offered[instanceType] {
+			candidates = append(candidates, aws.String(instanceType))
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no instance types matching requirements are offered in %s", az)
+	}
+
+	infos := []*ec2ext.InstanceTypeInfo{}
+	for start := 0; start < len(candidates); start += describeInstanceTypesLimit {
+		end := start + describeInstanceTypesLimit
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+		output, err := client.DescribeInstanceTypes(&ec2ext.DescribeInstanceTypesInput{
+			InstanceTypes: candidates[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instance types: %s", err)
+		}
+		infos = append(infos, output.InstanceTypes...)
+	}
+	sort.Sort(byResources(infos))
+
+	selected := []string{}
+	for _, info := range infos {
+		if len(selected) == requirements.maxCandidates() {
+			break
+		}
+		selected = append(selected, aws.StringValue(info.InstanceType))
+	}
+	return selected, nil
+}
+
+// applyInstanceRequirements sets the instance types of a group with instance requirements, which the instance plugin
+// falls back through when EC2 has insufficient capacity.
+func applyInstanceRequirements(ec2Client *ec2.EC2, grp *instanceGroupSpec, az string) error {
+	requirements := *grp.InstanceRequirements
+	run := &grp.Config.RunInstancesInput
+
+	architecture := requirements.Architecture
+	if architecture == "" {
+		if run.ImageId == nil {
+			return fmt.Errorf("ImageId must be set to select instance types")
+		}
+		var err error
+		architecture, err = imageArchitecture(ec2Client, run.ImageId)
+		if err != nil {
+			return err
+		}
+	}
+
+	instanceTypes, err := selectInstanceTypes(ec2Client, requirements, architecture, az)
+	if err != nil {
+		return err
+	}
+
+	grp.Config.InstanceTypes = []instance.InstanceTypeOption{}
+	for _, instanceType := range instanceTypes {
+		grp.Config.InstanceTypes = append(grp.Config.InstanceTypes, instance.InstanceTypeOption{InstanceType: instanceType})
+	}
+	run.InstanceType = aws.String(instanceTypes[0])
+	return nil
+}
@@ -0,0 +1,124 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"sort"
+)
+
+const (
+	edgeType    = "edge"
+	gpuType     = "gpu"
+	storageType = "storage"
+
+	// roleTag is the tag name identifying the role of instances of groups with a role other than manager or worker,
+	// such that workloads can be placed on them.
+	roleTag = "infrakit.role"
+)
+
+// groupRole is a Type of group.  Groups of roles other than manager join the swarm as workers, with the defaults and
+// validation of their role.
+type groupRole struct {
+	// manager is set for the role of the group that runs the swarm managers, of which a cluster has exactly one.
+	manager bool
+
+	// tagged tags the instances of groups of the role with roleTag, with the tagging hooks.
+	tagged bool
+
+	// defaults applies the defaults of the role to a group, if set.  The defaults run with the defaulting hooks, after
+	// the defaults of the spec.
+	defaults func(group *instanceGroupSpec)
+
+	// validate returns the problems with a group of the role in a spec, if set.
+	validate func(spec *clusterSpec, group instanceGroupSpec) []string
+}
+
+// groupRoles are the roles of groups, by Type.
+var groupRoles = map[string]groupRole{}
+
+func init() {
+	registerRole(managerType, groupRole{manager: true})
+	registerRole(workerType, groupRole{})
+	registerRole(edgeType, groupRole{tagged: true, validate: validateEdgeGroup})
+	registerRole(gpuType, groupRole{tagged: true, validate: validateGPUGroup})
+	registerRole(storageType, groupRole{tagged: true, defaults: applyStorageDefaults, validate: validateStorageGroup})
+}
+
+// registerRole adds a role of groups, replacing any role of the same Type.
+func registerRole(groupType string, role groupRole) {
+	groupRoles[groupType] = role
+}
+
+func roleTypes() []string {
+	types := []string{}
+	for groupType := range groupRoles {
+		types = append(types, groupType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func applyRoleDefaultsHook(s *clusterSpec, group *instanceGroupSpec) error {
+	if role := groupRoles[group.Type]; role.defaults != nil {
+		role.defaults(group)
+	}
+	return nil
+}
+
+// applyRoleTagHook tags the instances of groups of tagged roles with the role, unless the group sets the tag.
+func applyRoleTagHook(s *clusterSpec, group *instanceGroupSpec) error {
+	if !groupRoles[group.Type].tagged {
+		return nil
+	}
+	if _, has := group.Config.Tags[roleTag]; has {
+		return nil
+	}
+	if group.Config.Tags == nil {
+		group.Config.Tags = map[string]string{}
+	}
+	group.Config.Tags[roleTag] = group.Type
+	return nil
+}
+
+// validateEdgeGroup requires that edge groups, which serve traffic from outside the VPC, have public addresses.
+func validateEdgeGroup(spec *clusterSpec, group instanceGroupSpec) []string {
+	errs := []string{}
+	if spec.PrivateWorkers != nil {
+		errs = append(errs, "Groups of type edge may not be private, and may not be set with PrivateWorkers")
+	}
+	if spec.SSMAccess != nil {
+		errs = append(errs, "Groups of type edge require public addresses, and may not be set with SSMAccess")
+	}
+	return errs
+}
+
+// validateGPUGroup requires that gpu groups launch instance types with accelerators.  InstanceRequirements do not
+// select accelerators, so gpu groups name their instance types.
+func validateGPUGroup(spec *clusterSpec, group instanceGroupSpec) []string {
+	if group.InstanceRequirements != nil {
+		return []string{"Groups of type gpu may not set InstanceRequirements"}
+	}
+
+	errs := []string{}
+	for _, instanceType := range group.instanceTypes() {
+		if _, has := acceleratorFamilies[instanceFamily(instanceType)]; !has {
+			errs = append(errs, fmt.Sprintf("Groups of type gpu require accelerated instance types, not %s", instanceType))
+		}
+	}
+	return errs
+}
+
+// applyStorageDefaults optimizes the instances of storage groups for EBS, unless the group sets EbsOptimized.
+func applyStorageDefaults(group *instanceGroupSpec) {
+	if group.Config.RunInstancesInput.EbsOptimized == nil {
+		group.Config.RunInstancesInput.EbsOptimized = aws.Bool(true)
+	}
+}
+
+// validateStorageGroup requires that storage groups attach volumes beyond the root volume of their image.
+func validateStorageGroup(spec *clusterSpec, group instanceGroupSpec) []string {
+	if len(group.Config.RunInstancesInput.BlockDeviceMappings) == 0 {
+		return []string{"Groups of type storage must set BlockDeviceMappings of their data volumes"}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"net"
+	"strings"
+)
+
+const (
+	// publicRouteTables are the route tables routing to the internet through the internet gateway of the cluster.
+	publicRouteTables = "public"
+
+	// privateRouteTables are the route tables routing to the internet through the NAT gateways of the cluster.
+	privateRouteTables = "private"
+
+	// allRouteTables are all the route tables of the cluster.
+	allRouteTables = "all"
+)
+
+// networkRoute is a route added to the route tables of a cluster, to a peered VPC, a transit gateway, or a VPN gateway.
+type networkRoute struct {
+	DestinationCidrBlock string
+
+	// RouteTables is public, private, or all (the default).
+	RouteTables string `json:",omitempty"`
+
+	VpcPeeringConnectionID string `json:"VpcPeeringConnectionId,omitempty"`
+	TransitGatewayID       string `json:"TransitGatewayId,omitempty"`
+	VpnGatewayID           string `json:"VpnGatewayId,omitempty"`
+}
+
+func (r networkRoute) routeTables() string {
+	if r.RouteTables == "" {
+		return allRouteTables
+	}
+	return r.RouteTables
+}
+
+func (r networkRoute) validate() error {
+	if _, _, err := net.ParseCIDR(r.DestinationCidrBlock); err != nil || !strings.Contains(r.DestinationCidrBlock, ".") {
+		return fmt.Errorf("Routes must have an IPv4 DestinationCidrBlock: %s", r.DestinationCidrBlock)
+	}
+	if r.DestinationCidrBlock == anywhereCIDR {
+		return fmt.Errorf("Routes may not replace the route of %s to the internet", anywhereCIDR)
+	}
+	switch r.routeTables() {
+	case publicRouteTables, privateRouteTables, allRouteTables:
+	default:
+		return fmt.Errorf("Routes.RouteTables must be %s, %s, or %s: %s",
+			publicRouteTables, privateRouteTables, allRouteTables, r.RouteTables)
+	}
+
+	targets := 0
+	for _, target := range []string{r.VpcPeeringConnectionID, r.TransitGatewayID, r.VpnGatewayID} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("Route to %s must have exactly one of VpcPeeringConnectionId, TransitGatewayId, and "+
+			"VpnGatewayId", r.DestinationCidrBlock)
+	}
+	return nil
+}
+
+// input creates the request of the route in a route table.
+func (r networkRoute) input(routeTableID *string) *ec2ext.RouteInput {
+	input := &ec2ext.RouteInput{RouteTableId: routeTableID, DestinationCidrBlock: aws.String(r.DestinationCidrBlock)}
+	switch {
+	case r.VpcPeeringConnectionID != "":
+		input.VpcPeeringConnectionId = aws.String(r.VpcPeeringConnectionID)
+	case r.TransitGatewayID != "":
+		input.TransitGatewayId = aws.String(r.TransitGatewayID)
+	default:
+		input.GatewayId = aws.String(r.VpnGatewayID)
+	}
+	return input
+}
+
+// target returns the target of the route, as it is reported by DescribeRouteTables.
+func (r networkRoute) target() string {
+	return r.VpcPeeringConnectionID + r.TransitGatewayID + r.VpnGatewayID
+}
+
+// routeTarget returns the target of an existing route, if it is a target of declared routes, or an empty string.
+func routeTarget(route *ec2ext.Route) string {
+	switch {
+	case route.VpcPeeringConnectionId != nil:
+		return *route.VpcPeeringConnectionId
+	case route.TransitGatewayId != nil:
+		return *route.TransitGatewayId
+	case strings.HasPrefix(aws.StringValue(route.GatewayId), "vgw-"):
+		return *route.GatewayId
+	}
+	return ""
+}
+
+// routeTableRole distinguishes the public and private route tables of a cluster by their routes to the internet.
+func routeTableRole(routeTable *ec2ext.RouteTableRoutes) string {
+	for _, route := range routeTable.Routes {
+		if aws.StringValue(route.DestinationCidrBlock) != anywhereCIDR {
+			continue
+		}
+		if route.NatGatewayId != nil {
+			return privateRouteTables
+		}
+		if strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+			return publicRouteTables
+		}
+	}
+	return ""
+}
+
+func (s *clusterSpec) validateRoutes() error {
+	errs := []string{}
+	destinations := map[string]bool{}
+	for _, route := range append(s.Routes, s.connectionRoutes(nil)...) {
+		if err := route.validate(); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		// Routes of the same destination in the public and private route tables do not conflict.
+		for _, role := range []string{publicRouteTables, privateRouteTables} {
+			if route.routeTables() != allRouteTables && route.routeTables() != role {
+				continue
+			}
+			if destinations[role+route.DestinationCidrBlock] {
+				errs = append(errs, fmt.Sprintf("Routes may not have the same DestinationCidrBlock %s in the %s "+
+					"route tables", route.DestinationCidrBlock, role))
+			}
+			destinations[role+route.DestinationCidrBlock] = true
+		}
+		if route.routeTables() == privateRouteTables && s.PrivateWorkers == nil {
+			errs = append(errs, fmt.Sprintf("Route to %s requires PrivateWorkers for private route tables",
+				route.DestinationCidrBlock))
+		}
+	}
+	if err := s.NetworkACL.validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// reconcileRoutes applies the changes needed for the route tables of a cluster to have its declared routes.  Routes
+// to peering connections, transit gateways, and VPN gateways that are not declared are kept unless strict is set, in
+// which case they are deleted.  Routes propagated by VPN gateways are never deleted.
+func reconcileRoutes(ec2Client *ec2.EC2, cluster clusterID, vpcID string, routes []networkRoute, strict bool) error {
+	ext := ec2ext.New(ec2Client)
+	routeTables, err := ext.DescribeRouteTableRoutes(
+		&ec2.DescribeRouteTablesInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return fmt.Errorf("Failed to look up route tables: %s", err)
+	}
+
+	for _, routeTable := range routeTables.RouteTables {
+		id := *routeTable.RouteTableId
+		role := routeTableRole(routeTable)
+		existing := map[string]*ec2ext.Route{}
+		for _, route := range routeTable.Routes {
+			if route.DestinationCidrBlock != nil {
+				existing[*route.DestinationCidrBlock] = route
+			}
+		}
+
+		declared := map[string]bool{}
+		for _, route := range routes {
+			if route.routeTables() != allRouteTables && route.routeTables() != role {
+				continue
+			}
+			declared[route.DestinationCidrBlock] = true
+
+			var err error
+			current, has := existing[route.DestinationCidrBlock]
+			switch {
+			case !has:
+				log.Infof("  %s create route to %s through %s", id, route.DestinationCidrBlock, route.target())
+				err = ext.CreateRoute(route.input(routeTable.RouteTableId))
+			case routeTarget(current) != route.target():
+				log.Infof("  %s replace route to %s through %s", id, route.DestinationCidrBlock, route.target())
+				err = ext.ReplaceRoute(route.input(routeTable.RouteTableId))
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to route %s in route table %s: %s", route.DestinationCidrBlock, id, err)
+			}
+		}
+
+		if !strict {
+			continue
+		}
+		for _, route := range routeTable.Routes {
+			destination := aws.StringValue(route.DestinationCidrBlock)
+			if destination == "" || declared[destination] || routeTarget(route) == "" ||
+				aws.StringValue(route.Origin) == ec2.RouteOriginEnableVgwRoutePropagation {
+				continue
+			}
+			log.Infof("  %s delete route to %s through %s", id, destination, routeTarget(route))
+			_, err := ec2Client.DeleteRoute(&ec2.DeleteRouteInput{
+				RouteTableId:         routeTable.RouteTableId,
+				DestinationCidrBlock: aws.String(destination),
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete route to %s from route table %s: %s", destination, id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileNetwork reconciles the declared routes, network ACL, transit gateway attachment, and peering connections of
+// the network created for a cluster.
+func reconcileNetwork(config client.ConfigProvider, spec *clusterSpec, strict bool) error {
+	ec2Client := ec2.New(config)
+	cluster := spec.cluster()
+
+	vpcID, network, err := findClusterVpc(ec2Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	connectionRoutes, err := connectNetworks(config, spec, vpcID, network.vpcCIDR)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Reconciling routes of cluster %s", cluster.name)
+	routes := append(append([]networkRoute{}, spec.Routes...), connectionRoutes...)
+	if err := reconcileRoutes(ec2Client, cluster, vpcID, routes, strict); err != nil {
+		return err
+	}
+	return reconcileNetworkACL(ec2Client, spec, vpcID)
+}
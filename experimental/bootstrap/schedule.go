@@ -0,0 +1,114 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/docker/infrakit/spi/group"
+	"strconv"
+	"strings"
+)
+
+// scheduledSize sets the size of a worker group on a schedule, such as scaling a group to zero at night.  Schedules
+// are installed on the boot leader alongside the plugins, so they are lost, like the group watches, when it is replaced.
+type scheduledSize struct {
+	// Cron is when the size is applied, as a cron expression of five fields: minute, hour, day of month, month, and
+	// day of week.  Schedules run in the time zone of the managers, which is UTC on most images.
+	Cron string
+
+	Size int
+}
+
+// cronFields are the ranges of the fields of a cron expression.  Both 0 and 7 are Sunday.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// validateCron checks that an expression has five fields, each a comma-separated list of values, ranges, or *, with
+// optional steps.
+func validateCron(expression string) error {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("Cron '%s' must have %d fields", expression, len(cronFields))
+	}
+
+	for i, field := range fields {
+		limits := cronFields[i]
+		for _, item := range strings.Split(field, ",") {
+			values := item
+			if slash := strings.Index(item, "/"); slash >= 0 {
+				values = item[:slash]
+				step, err := strconv.Atoi(item[slash+1:])
+				if err != nil || step < 1 {
+					return fmt.Errorf("Cron '%s' has an invalid step in %s field '%s'", expression, limits.name, item)
+				}
+			}
+			if values == "*" {
+				continue
+			}
+
+			bounds := strings.SplitN(values, "-", 2)
+			for _, bound := range bounds {
+				value, err := strconv.Atoi(bound)
+				if err != nil || value < limits.min || value > limits.max {
+					return fmt.Errorf(
+						"Cron '%s' %s field '%s' must be between %d and %d",
+						expression,
+						limits.name,
+						item,
+						limits.min,
+						limits.max)
+				}
+			}
+			if len(bounds) == 2 {
+				low, _ := strconv.Atoi(bounds[0])
+				high, _ := strconv.Atoi(bounds[1])
+				if low > high {
+					return fmt.Errorf("Cron '%s' has a reversed range in %s field '%s'", expression, limits.name, item)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scheduledGroup is the spec of a group at a size it is scheduled to be scaled to.
+type scheduledGroup struct {
+	Group group.ID
+	Name  string
+	Cron  string
+	Spec  string
+}
+
+// generateScheduledGroups renders the spec of each scheduled size of the groups, to be committed by cron jobs on the
+// boot leader.
+func generateScheduledGroups(spec clusterSpec) ([]scheduledGroup, error) {
+	scheduled := []scheduledGroup{}
+	for _, grp := range spec.Groups {
+		sized := map[int]string{}
+		for _, entry := range grp.Schedule {
+			name := fmt.Sprintf("%s-size-%d", grp.Name, entry.Size)
+			if _, has := sized[entry.Size]; !has {
+				resized := grp
+				resized.Size = entry.Size
+				groupSpec, err := spec.groupSpec(resized)
+				if err != nil {
+					return nil, err
+				}
+				sized[entry.Size] = groupSpec
+			}
+			scheduled = append(scheduled, scheduledGroup{
+				Group: grp.Name,
+				Name:  name,
+				Cron:  strings.Join(strings.Fields(entry.Cron), " "),
+				Spec:  sized[entry.Size],
+			})
+		}
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,43 @@
+package bootstrap
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateCron(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"0 19 * * 1-5",
+		"*/15 * * * *",
+		"0 0-12/2 1,15 * 0",
+		"59 23 31 12 7",
+		"0  7 * *  1-5",
+	}
+	for _, expression := range valid {
+		require.NoError(t, validateCron(expression), expression)
+	}
+
+	invalid := map[string]string{
+		"":                  "Cron '' must have 5 fields",
+		"0 19 * *":          "Cron '0 19 * *' must have 5 fields",
+		"0 19 * * 1-5 2024": "Cron '0 19 * * 1-5 2024' must have 5 fields",
+		"60 * * * *":        "Cron '60 * * * *' minute field '60' must be between 0 and 59",
+		"0 24 * * *":        "Cron '0 24 * * *' hour field '24' must be between 0 and 23",
+		"0 0 0 * *":         "Cron '0 0 0 * *' day of month field '0' must be between 1 and 31",
+		"0 0 * 13 *":        "Cron '0 0 * 13 *' month field '13' must be between 1 and 12",
+		"0 0 * * 8":         "Cron '0 0 * * 8' day of week field '8' must be between 0 and 7",
+		"0 0 * * mon":       "Cron '0 0 * * mon' day of week field 'mon' must be between 0 and 7",
+		"0 0 * * 1-9":       "Cron '0 0 * * 1-9' day of week field '1-9' must be between 0 and 7",
+		"0 0,,12 * * *":     "Cron '0 0,,12 * * *' hour field '' must be between 0 and 23",
+		"*/0 * * * *":       "Cron '*/0 * * * *' has an invalid step in minute field '*/0'",
+		"*/x * * * *":       "Cron '*/x * * * *' has an invalid step in minute field '*/x'",
+		"0 17-9 * * *":      "Cron '0 17-9 * * *' has a reversed range in hour field '17-9'",
+		"0 0 * 12-1/2 *":    "Cron '0 0 * 12-1/2 *' has a reversed range in month field '12-1/2'",
+	}
+	for expression, message := range invalid {
+		err := validateCron(expression)
+		require.Error(t, err, expression)
+		require.Equal(t, message, err.Error())
+	}
+}
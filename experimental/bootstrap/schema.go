@@ -7,11 +7,16 @@ import (
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
 	"github.com/docker/infrakit.aws/plugin/instance"
 	"github.com/docker/infrakit/spi/group"
+	"sort"
 	"strings"
 )
 
@@ -24,6 +29,15 @@ const (
 type clusterID struct {
 	region string
 	name   string
+	tagKey string
+}
+
+// clusterTagKey is the tag name used to associate resources with the cluster.
+func (c clusterID) clusterTagKey() string {
+	if c.tagKey == "" {
+		return clusterTag
+	}
+	return c.tagKey
 }
 
 func (c clusterID) getAWSClient() client.ConfigProvider {
@@ -33,11 +47,68 @@ func (c clusterID) getAWSClient() client.ConfigProvider {
 		&credentials.SharedCredentialsProvider{},
 	}
 
-	return session.New(aws.NewConfig().
+	return session.New(request.WithRetryer(aws.NewConfig().
 		WithRegion(c.region).
 		WithCredentialsChainVerboseErrors(true).
 		WithCredentials(credentials.NewChainCredentials(providers)).
-		WithLogger(&logger{}))
+		WithLogger(&logger{}),
+		awserrors.NewRetryer(awserrors.DefaultMaxRetries)))
+}
+
+// groupCredentials overrides the API credentials used for a group, allowing groups to be provisioned in
+// different accounts.
+type groupCredentials struct {
+	// Profile is a profile in the local shared credentials file, used for operations performed by bootstrap.
+	Profile string
+
+	// RoleARN is an IAM role assumed for all operations on the group, including those performed by InfraKit
+	// on the managers.
+	RoleARN string
+}
+
+// getGroupAWSClient returns a client for operations on a group, applying any credentials override.
+func (c clusterID) getGroupAWSClient(base client.ConfigProvider, group instanceGroupSpec) client.ConfigProvider {
+	if group.Credentials == nil {
+		return base
+	}
+
+	config := base
+	if group.Credentials.Profile != "" {
+		config = session.New(request.WithRetryer(aws.NewConfig().
+			WithRegion(c.region).
+			WithCredentials(credentials.NewSharedCredentials("", group.Credentials.Profile)).
+			WithLogger(&logger{}),
+			awserrors.NewRetryer(awserrors.DefaultMaxRetries)))
+	}
+
+	if group.Credentials.RoleARN != "" {
+		config = session.New(request.WithRetryer(aws.NewConfig().
+			WithRegion(c.region).
+			WithCredentials(stscreds.NewCredentials(config, group.Credentials.RoleARN)).
+			WithLogger(&logger{}),
+			awserrors.NewRetryer(awserrors.DefaultMaxRetries)))
+	}
+
+	return config
+}
+
+// getGroupCredentialsAWSClients returns a client for each distinct credentials override of groups, such that resources
+// the groups created with their own credentials are managed once with each.  Groups without an override use the base
+// client, which is not included.
+func (c clusterID) getGroupCredentialsAWSClients(
+	base client.ConfigProvider,
+	groups []instanceGroupSpec) []client.ConfigProvider {
+
+	seen := map[groupCredentials]bool{}
+	configs := []client.ConfigProvider{}
+	for _, grp := range groups {
+		if grp.Credentials == nil || seen[*grp.Credentials] {
+			continue
+		}
+		seen[*grp.Credentials] = true
+		configs = append(configs, c.getGroupAWSClient(base, grp))
+	}
+	return configs
 }
 
 func (c clusterID) resourceFilter(vpcID string) []*ec2.Filter {
@@ -52,7 +123,7 @@ func (c clusterID) resourceFilter(vpcID string) []*ec2.Filter {
 
 func (c clusterID) clusterFilter() *ec2.Filter {
 	return &ec2.Filter{
-		Name:   aws.String("tag:" + clusterTag),
+		Name:   aws.String("tag:" + c.clusterTagKey()),
 		Values: []*string{aws.String(c.name)},
 	}
 }
@@ -69,46 +140,249 @@ func (c clusterID) instanceProfileName() string {
 	return fmt.Sprintf("%s-ManagerProfile", c.name)
 }
 
+// managerLoadBalancerName is the name of the manager load balancer and its target group, which are limited to 32
+// characters.
+func (c clusterID) managerLoadBalancerName() string {
+	name := fmt.Sprintf("%s-managers", c.name)
+	if len(name) > 32 {
+		name = strings.TrimRight(name[:32], "-")
+	}
+	return name
+}
+
 func (c clusterID) clusterTagMap() map[string]string {
-	return map[string]string{clusterTag: c.name}
+	return map[string]string{c.clusterTagKey(): c.name}
 }
 
-func (c clusterID) resourceTag() *ec2.Tag {
-	return &ec2.Tag{
-		Key:   aws.String(clusterTag),
-		Value: aws.String(c.name),
+type instanceGroupSpec struct {
+	Name        group.ID
+	Type        string
+	Size        int
+	Config      instance.CreateInstanceRequest
+	Credentials *groupCredentials `json:",omitempty"`
+
+	// InstanceRequirements selects the instance types of the group, replacing InstanceType and InstanceTypes.
+	InstanceRequirements *instanceRequirements `json:",omitempty"`
+
+	// Subnets launches the group in an existing subnet, rather than a subnet created by bootstrap.  The availability
+	// zone of the group may be omitted, in which case it is the zone of the first matching subnet.
+	Subnets *existingSubnets `json:",omitempty"`
+
+	// Monitoring enables detailed monitoring and CloudWatch alarms of the instances of the group.
+	Monitoring *groupMonitoring `json:",omitempty"`
+
+	// EncryptionInTransit requires the instance types of the group to encrypt traffic between instances, as Nitro
+	// instance types do, for workloads that must not send plaintext within the VPC.
+	EncryptionInTransit bool `json:",omitempty"`
+
+	// ImageChannel subscribes the group to a channel of images, either builtin or defined in ImageChannels.  The group
+	// launches the current image of the channel when ImageId is not set, and refresh-images updates ImageId as the
+	// channel is patched.
+	ImageChannel string `json:",omitempty"`
+
+	// Schedule scales a worker group to sizes on a schedule.  Size applies until the first scheduled size is committed.
+	Schedule []scheduledSize `json:",omitempty"`
+
+	// subnetID is the existing subnet chosen for the group, once it is resolved.
+	subnetID *string
+
+	// bootScript is the script run by instances of the group before their flavor configures them, once it is
+	// rendered by the UserDataStage hooks.
+	bootScript string
+}
+
+// instanceTypes are the instance types the group is configured to launch, if they are known before the cluster is
+// created.
+func (i instanceGroupSpec) instanceTypes() []string {
+	types := []string{}
+	if i.Config.RunInstancesInput.InstanceType != nil {
+		types = append(types, *i.Config.RunInstancesInput.InstanceType)
 	}
+	for _, option := range i.Config.InstanceTypes {
+		types = append(types, option.InstanceType)
+	}
+	return types
 }
 
-type instanceGroupSpec struct {
-	Name   group.ID
-	Type   string
-	Size   int
-	Config instance.CreateInstanceRequest
+func anyBurstable(instanceTypes []string) bool {
+	for _, instanceType := range instanceTypes {
+		if ec2ext.Burstable(instanceType) {
+			return true
+		}
+	}
+	return false
+}
+
+func validCreditSpecification(credits string) bool {
+	return credits == "" || credits == ec2ext.CPUCreditsStandard || credits == ec2ext.CPUCreditsUnlimited
 }
 
 func (i instanceGroupSpec) isManager() bool {
-	return i.Type == managerType
+	return groupRoles[i.Type].manager
+}
+
+// instancePluginName is the name of the instance plugin that manages the group.  Groups that assume a role are
+// managed by a dedicated plugin.
+func (i instanceGroupSpec) instancePluginName() string {
+	if i.Credentials != nil && i.Credentials.RoleARN != "" {
+		return fmt.Sprintf("instance-aws-%s", i.Name)
+	}
+	return "instance-aws"
 }
 
 type clusterSpec struct {
+	// Version is the version of the clusterSchema of the spec.  Specs without a version are upgraded from the
+	// earliest version.
+	Version int `json:",omitempty"`
+
 	ClusterName string
-	ManagerIPs  []string
-	Groups      []instanceGroupSpec
+
+	// Region is the region of the cluster.  When unset, it is derived from the availability zone of the groups.
+	Region string `json:",omitempty"`
+
+	// ClusterTagKey is the tag name used to associate resources with the cluster, defaulting to infrakit.cluster.
+	ClusterTagKey string `json:",omitempty"`
+
+	// Tags are additional tags applied to every resource created for the cluster.
+	Tags map[string]string `json:",omitempty"`
+
+	// Defaults are launch settings inherited by every group that does not set them.
+	Defaults *groupDefaults `json:",omitempty"`
+
+	// DefaultInstanceType is the instance type of groups that do not specify one.  When unset, the default is
+	// chosen to match the architecture of the group's image.
+	DefaultInstanceType string `json:",omitempty"`
+
+	// State configures storage of the cluster state in S3.
+	State *stateStorage `json:",omitempty"`
+
+	// TerminationProtection prevents managers from being terminated through the EC2 API, such that a manager is only
+	// terminated by an instance plugin run with --terminate-protected, or by destroying the cluster.
+	TerminationProtection bool `json:",omitempty"`
+
+	// Logs ships system and Docker logs to a CloudWatch Logs group of the cluster.
+	Logs *logsConfig `json:",omitempty"`
+
+	// AlarmNotifications subscribes addresses to the SNS topic notified of the alarms of the groups.
+	AlarmNotifications *alarmNotifications `json:",omitempty"`
+
+	// ECRCredentialHelper allows instances to pull images from ECR repositories of the account.
+	ECRCredentialHelper bool `json:",omitempty"`
+
+	// SharedStorage creates an EFS file system that is mounted by all instances.
+	SharedStorage *sharedStorage `json:",omitempty"`
+
+	// ManagerLoadBalancer creates an internal network load balancer in front of the managers, which instances join
+	// the swarm through.
+	ManagerLoadBalancer bool `json:",omitempty"`
+
+	// StaticManagerInterfaces creates a network interface for each manager IP, which is attached to every instance
+	// provisioned for that IP.  Managers launched with these interfaces do not have public IP addresses.
+	StaticManagerInterfaces bool `json:",omitempty"`
+
+	// DualStack assigns an IPv6 CIDR block to the VPC and subnets of the cluster, and IPv6 addresses to the instances
+	// launched in them.
+	DualStack bool `json:",omitempty"`
+
+	// PrivateWorkers places workers in a private subnet, reaching the internet through NAT gateways.
+	PrivateWorkers *privateWorkers `json:",omitempty"`
+
+	// VpcEndpoints are the AWS services reached through VPC endpoints, such as ec2, s3, ecr, ssm, and logs, so that
+	// instances do not require internet access to use them.
+	VpcEndpoints []string `json:",omitempty"`
+
+	// Routes are added to the route tables of the network, such as routes to peered VPCs, transit gateways, and VPN
+	// gateways.
+	Routes []networkRoute `json:",omitempty"`
+
+	// NetworkACL replaces the default network ACL of the VPC for the subnets of the cluster.
+	NetworkACL *networkACL `json:",omitempty"`
+
+	// TransitGateway attaches the VPC to an existing transit gateway, routing networks through it.
+	TransitGateway *transitGatewayAttachment `json:",omitempty"`
+
+	// Peering establishes peering connections with other VPCs, such as the VPCs of shared services.
+	Peering []vpcPeering `json:",omitempty"`
+
+	// Backups snapshots the data volumes of the managers on a schedule, and restores the volume of a replaced manager
+	// from its latest snapshot when the volume was lost.
+	Backups *managerBackups `json:",omitempty"`
+
+	// ImageChannels defines the channels of images that groups may subscribe to, in addition to the builtin
+	// channels, by name.
+	ImageChannels map[string]imageChannel `json:",omitempty"`
+
+	// SSMAccess manages instances exclusively through Systems Manager, without SSH or public IP addresses.
+	SSMAccess *ssmAccess `json:",omitempty"`
+
+	// Budget limits the size and estimated cost of the groups, which create checks unless --override-budget is set.
+	Budget *clusterBudget `json:",omitempty"`
+
+	ManagerIPs []string
+	Groups     []instanceGroupSpec
+
+	// managerEndpoint is the address of the manager load balancer, once it is created.
+	managerEndpoint string
+
+	// fileSystemID is the ID of the shared file system, once it is created.
+	fileSystemID string
+
+	// network is the address space of the cluster, once its network is created or resolved.
+	network clusterNetwork
+
+	// existingVpcID is the VPC of the existing subnets of the groups, once they are resolved.
+	existingVpcID string
 }
 
+// cluster identifies the resources of the cluster.  A spec without a Region is in the region of its availability
+// zone, which validate requires; the region is left empty if the zone is not known.
 func (s *clusterSpec) cluster() clusterID {
-	az := s.availabilityZone()
-	return clusterID{region: az[:len(az)-1], name: s.ClusterName}
+	region := s.Region
+	if region == "" {
+		if az, err := s.availabilityZone(); err == nil {
+			region = az[:len(az)-1]
+		}
+	}
+	return clusterID{region: region, name: s.ClusterName, tagKey: s.ClusterTagKey}
+}
+
+// namespaceTags are the tags applied to all resources created for the cluster, including the cluster tag.
+func (s *clusterSpec) namespaceTags() map[string]string {
+	tags := map[string]string{}
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	for k, v := range s.cluster().clusterTagMap() {
+		tags[k] = v
+	}
+	return tags
+}
+
+// resourceTags returns namespaceTags in a form suitable for tagging EC2 resources, sorted by key.
+func (s *clusterSpec) resourceTags() []*ec2.Tag {
+	tags := s.namespaceTags()
+
+	keys := []string{}
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ec2Tags := []*ec2.Tag{}
+	for _, k := range keys {
+		ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+	return ec2Tags
 }
 
-func (s *clusterSpec) managers() instanceGroupSpec {
+// managers returns the manager group of the cluster, or an error if the spec has none.
+func (s *clusterSpec) managers() (instanceGroupSpec, error) {
 	for _, group := range s.Groups {
 		if group.isManager() {
-			return group
+			return group, nil
 		}
 	}
-	panic("No manager group found")
+	return instanceGroupSpec{}, fmt.Errorf("Must specify a group of type %s", managerType)
 }
 
 func (s *clusterSpec) mutateManagers(op func(*instanceGroupSpec)) {
@@ -119,16 +393,17 @@ func (s *clusterSpec) mutateManagers(op func(*instanceGroupSpec)) {
 	})
 }
 
+// mutateGroups applies an operation to each group of the spec in place, such that the operation sees the changes made
+// to earlier groups through the spec.
 func (s *clusterSpec) mutateGroups(op func(*instanceGroupSpec)) {
-	for i, group := range s.Groups {
-		op(&group)
-		s.Groups[i] = group
+	for i := range s.Groups {
+		op(&s.Groups[i])
 	}
 }
 
-func applyInstanceDefaults(r *ec2.RunInstancesInput) {
-	if r.InstanceType == nil {
-		r.InstanceType = aws.String("t2.micro")
+func applyInstanceDefaults(r *ec2.RunInstancesInput, instanceType string) {
+	if r.InstanceType == nil && instanceType != "" {
+		r.InstanceType = aws.String(instanceType)
 	}
 
 	if r.NetworkInterfaces == nil || len(r.NetworkInterfaces) == 0 {
@@ -142,18 +417,17 @@ func applyInstanceDefaults(r *ec2.RunInstancesInput) {
 	}
 }
 
-func (s *clusterSpec) applyDefaults() {
-	s.mutateGroups(func(group *instanceGroupSpec) {
-		if group.Type == managerType {
-			bootLeaderLastOctet := 4
-			s.ManagerIPs = []string{}
-			for i := 0; i < group.Size; i++ {
-				s.ManagerIPs = append(s.ManagerIPs, fmt.Sprintf("192.168.33.%d", bootLeaderLastOctet+i))
-			}
-		}
+// applyDefaults runs the hooks that complete the groups of a validated spec, up to rendering their user data, which
+// waits for the cluster resources it refers to.
+func (s *clusterSpec) applyDefaults() error {
+	return s.runHooks(DefaultingStage, AddressingStage, TaggingStage)
+}
 
-		applyInstanceDefaults(&group.Config.RunInstancesInput)
-	})
+func applyTerminationProtectionHook(s *clusterSpec, group *instanceGroupSpec) error {
+	if group.isManager() && s.TerminationProtection {
+		group.Config.RunInstancesInput.DisableApiTermination = aws.Bool(true)
+	}
+	return nil
 }
 
 func (s *clusterSpec) validate() error {
@@ -164,21 +438,19 @@ func (s *clusterSpec) validate() error {
 	}
 
 	managerGroups := 0
-	workerGroups := 0
 	for _, group := range s.Groups {
-		switch group.Type {
-		case managerType:
+		role, has := groupRoles[group.Type]
+		if !has {
+			addError("Invalid group type '%s', must be one of %s", group.Type, strings.Join(roleTypes(), ", "))
+			continue
+		}
+		if role.manager {
 			managerGroups++
-		case workerType:
-			workerGroups++
-		default:
-			errs = append(
-				errs,
-				fmt.Sprintf(
-					"Invalid instance type '%s', must be %s or %s",
-					group.Type,
-					workerType,
-					managerType))
+		}
+		if role.validate != nil {
+			for _, problem := range role.validate(s, group) {
+				addError("In group %s: %s", group.Name, problem)
+			}
 		}
 	}
 
@@ -186,21 +458,76 @@ func (s *clusterSpec) validate() error {
 		addError("Must specify exactly one group of type %s", managerType)
 	}
 
-	/*
-		if workerGroups == 0 {
-			addError("Must specify exactly one group of type %s", workerType)
-		}
-	*/
-
 	if s.ClusterName == "" {
 		addError("Must specify ClusterName")
 	}
 
+	if s.Backups != nil {
+		if err := s.Backups.validate(); err != nil {
+			addError("%s", err)
+		}
+	}
+
+	if err := s.validateImageChannels(); err != nil {
+		addError("%s", err)
+	}
+
+	if s.SSMAccess != nil {
+		if err := s.validateSSMAccess(); err != nil {
+			addError("%s", err)
+		}
+	}
+
+	if err := s.validateRoutes(); err != nil {
+		addError("%s", err)
+	}
+
+	if err := s.validateConnections(); err != nil {
+		addError("%s", err)
+	}
+
+	if s.Budget != nil {
+		if err := s.Budget.validate(); err != nil {
+			addError("%s", err)
+		}
+	}
+
+	if s.Logs != nil && !s.Logs.validRetention() {
+		addError("Logs.RetentionDays must be one of %v", retentionDays)
+	}
+
+	for _, group := range s.Groups {
+		if group.Monitoring != nil && (group.Monitoring.CPUUtilization < 0 || group.Monitoring.CPUUtilization > 100) {
+			addError("Monitoring.CPUUtilization of group %s must be a percentage", group.Name)
+		}
+	}
+	if s.AlarmNotifications != nil && !s.hasAlarms() {
+		addError("AlarmNotifications may only be set when groups have alarms")
+	}
+
+	if s.SharedStorage != nil && !strings.HasPrefix(s.SharedStorage.mountPath(), "/") {
+		addError("SharedStorage.MountPath must be an absolute path")
+	}
+
+	if s.State != nil && s.State.Bucket == "" {
+		addError("State.Bucket must be set")
+	}
+
+	for k := range s.Tags {
+		if k == (clusterID{tagKey: s.ClusterTagKey}).clusterTagKey() {
+			addError("Tags may not include the cluster tag %s", k)
+		}
+	}
+
 	for _, group := range s.Groups {
 		if group.isManager() {
 			if group.Size != 1 && group.Size != 3 && group.Size != 5 {
 				addError("Group %s Size must be 1, 3, or 5", group.Name)
 			}
+		} else if len(group.Schedule) > 0 {
+			if group.Size < 0 {
+				addError("Group %s Size must not be negative", group.Name)
+			}
 		} else {
 			if group.Size < 1 {
 				addError("Group %s Size must be at least 1", group.Name)
@@ -208,15 +535,149 @@ func (s *clusterSpec) validate() error {
 		}
 	}
 
+	if s.Defaults != nil && !validCreditSpecification(s.Defaults.CreditSpecification) {
+		addError("Defaults.CreditSpecification must be %s or %s", ec2ext.CPUCreditsStandard, ec2ext.CPUCreditsUnlimited)
+	}
+
 	validateGroup := func(gid group.ID, group instanceGroupSpec) {
 		errorPrefix := fmt.Sprintf("In group %s: ", gid)
 
-		if group.Config.RunInstancesInput.Placement == nil {
-			addError(errorPrefix + "run_instance_input.Placement must be set")
+		if credits := group.Config.CreditSpecification; credits != "" {
+			if !validCreditSpecification(credits) {
+				addError(
+					"%sCreditSpecification must be %s or %s",
+					errorPrefix,
+					ec2ext.CPUCreditsStandard,
+					ec2ext.CPUCreditsUnlimited)
+			} else if instanceTypes := group.instanceTypes(); len(instanceTypes) > 0 && !anyBurstable(instanceTypes) {
+				addError(
+					"%sCreditSpecification requires a burstable instance type, such as t2, t3, or t4g",
+					errorPrefix)
+			} else if requirements := group.InstanceRequirements; requirements != nil &&
+				requirements.BurstablePerformance != "included" && requirements.BurstablePerformance != "required" {
+
+				addError("%sCreditSpecification requires InstanceRequirements.BurstablePerformance", errorPrefix)
+			}
+		}
+
+		for _, option := range group.Config.InstanceTypes {
+			if option.InstanceType == "" {
+				addError("%sInstanceTypes entries must set InstanceType", errorPrefix)
+			}
+		}
+
+		if requirements := group.InstanceRequirements; requirements != nil {
+			if group.Config.RunInstancesInput.InstanceType != nil || len(group.Config.InstanceTypes) > 0 {
+				addError("%sInstanceRequirements may not be set with InstanceType or InstanceTypes", errorPrefix)
+			}
+			if requirements.MinVCpus < 1 {
+				addError("%sInstanceRequirements.MinVCpus must be at least 1", errorPrefix)
+			}
+			if requirements.MaxVCpus > 0 && requirements.MaxVCpus < requirements.MinVCpus {
+				addError("%sInstanceRequirements.MaxVCpus must be at least MinVCpus", errorPrefix)
+			}
+			if requirements.MaxMemoryMiB > 0 && requirements.MaxMemoryMiB < requirements.MinMemoryMiB {
+				addError("%sInstanceRequirements.MaxMemoryMiB must be at least MinMemoryMiB", errorPrefix)
+			}
+		}
+
+		if group.enclavesEnabled() && group.hibernationConfigured() {
+			addError("%sEnclaveOptions and HibernationOptions may not both be enabled", errorPrefix)
+		}
+
+		if len(group.Schedule) > 0 && group.isManager() {
+			addError("%sSchedule may only be set in worker groups", errorPrefix)
+		}
+		for _, entry := range group.Schedule {
+			if err := validateCron(entry.Cron); err != nil {
+				addError("%sSchedule %s", errorPrefix, err)
+			}
+			if entry.Size < 0 {
+				addError("%sSchedule Size must not be negative", errorPrefix)
+			}
+		}
+
+		for _, gpu := range group.Config.ElasticGpuSpecifications {
+			if !validElasticGpuType(gpu.Type) {
+				addError("%sElasticGpuSpecifications Type '%s' must be an eg1 type", errorPrefix, gpu.Type)
+			}
+		}
+		for _, accelerator := range group.Config.ElasticInferenceAccelerators {
+			if !validElasticInferenceType(accelerator.Type) {
+				addError("%sElasticInferenceAccelerators Type '%s' must be an eia1 or eia2 type", errorPrefix, accelerator.Type)
+			}
+			if accelerator.Count < 0 {
+				addError("%sElasticInferenceAccelerators Count must not be negative", errorPrefix)
+			}
+		}
+
+		if subnets := group.Subnets; subnets != nil {
+			if len(subnets.IDs) == 0 && len(subnets.Tags) == 0 {
+				addError("%sSubnets must set IDs or Tags", errorPrefix)
+			}
+			if len(subnetIDs(group.Config.RunInstancesInput)) > 0 {
+				addError("%sSubnets may not be set with a SubnetId", errorPrefix)
+			}
+		}
+
+		placed := group.Config.RunInstancesInput.Placement != nil &&
+			aws.StringValue(group.Config.RunInstancesInput.Placement.AvailabilityZone) != ""
+		if group.Subnets != nil && !placed {
+			if s.Region == "" {
+				addError("%sRegion must be set when the availability zone is derived from Subnets", errorPrefix)
+			}
+		} else if group.Config.RunInstancesInput.Placement == nil {
+			addError("%srun_instance_input.Placement must be set", errorPrefix)
 		} else if group.Config.RunInstancesInput.Placement.AvailabilityZone == nil ||
 			*group.Config.RunInstancesInput.Placement.AvailabilityZone == "" {
 
-			addError(errorPrefix + "run_instance_nput.Placement.AvailabilityZone must be set")
+			addError("%srun_instance_nput.Placement.AvailabilityZone must be set", errorPrefix)
+		} else if s.Region != "" && !strings.HasPrefix(*group.Config.RunInstancesInput.Placement.AvailabilityZone, s.Region) {
+			addError("%sAvailabilityZone %s is not in Region %s",
+				errorPrefix,
+				*group.Config.RunInstancesInput.Placement.AvailabilityZone,
+				s.Region)
+		}
+	}
+
+	if s.usesExistingSubnets() {
+		for _, group := range s.Groups {
+			if group.Subnets == nil {
+				addError("Subnets must be set in every group when any group uses existing subnets")
+				break
+			}
+		}
+		if s.DualStack {
+			addError("DualStack may not be set when groups use existing subnets")
+		}
+		if s.PrivateWorkers != nil {
+			addError("PrivateWorkers may not be set when groups use existing subnets")
+		}
+		if len(s.VpcEndpoints) > 0 {
+			addError("VpcEndpoints may not be set when groups use existing subnets")
+		}
+		if len(s.Routes) > 0 {
+			addError("Routes may not be set when groups use existing subnets")
+		}
+		if s.NetworkACL != nil {
+			addError("NetworkACL may not be set when groups use existing subnets")
+		}
+		if s.TransitGateway != nil {
+			addError("TransitGateway may not be set when groups use existing subnets")
+		}
+		if len(s.Peering) > 0 {
+			addError("Peering may not be set when groups use existing subnets")
+		}
+	}
+
+	if s.PrivateWorkers != nil {
+		switch s.PrivateWorkers.mode() {
+		case singleNATGateway, perZoneNATGateways:
+		default:
+			addError("PrivateWorkers.NATGateways must be %s or %s", singleNATGateway, perZoneNATGateways)
+		}
+		if s.DualStack {
+			addError("DualStack may not be set with PrivateWorkers, since IPv6 addresses are not translated")
 		}
 	}
 
@@ -225,7 +686,8 @@ func (s *clusterSpec) validate() error {
 	for _, group := range s.Groups {
 		validateGroup(group.Name, group)
 
-		if group.Config.RunInstancesInput.Placement != nil {
+		if group.Config.RunInstancesInput.Placement != nil &&
+			group.Config.RunInstancesInput.Placement.AvailabilityZone != nil {
 			az := *group.Config.RunInstancesInput.Placement.AvailabilityZone
 			if firstAz == "" {
 				firstAz = az
@@ -244,9 +706,15 @@ func (s *clusterSpec) validate() error {
 	return nil
 }
 
-func (s *clusterSpec) availabilityZone() string {
+// availabilityZone returns the availability zone of the cluster, which all groups are placed in, or an error if the
+// groups are not placed in one.
+func (s *clusterSpec) availabilityZone() (string, error) {
 	for _, group := range s.Groups {
-		return *group.Config.RunInstancesInput.Placement.AvailabilityZone
+		placement := group.Config.RunInstancesInput.Placement
+		if placement == nil || aws.StringValue(placement.AvailabilityZone) == "" {
+			return "", fmt.Errorf("Group %s must set run_instance_input.Placement.AvailabilityZone", group.Name)
+		}
+		return *placement.AvailabilityZone, nil
 	}
-	panic("No groups")
+	return "", errors.New("Must specify at least one group")
 }
@@ -0,0 +1,335 @@
+package bootstrap
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+const (
+	vpcCIDR           = "192.168.0.0/16"
+	managerSubnetCIDR = "192.168.33.0/24"
+	workerSubnetCIDR  = "192.168.34.0/24"
+	anywhereCIDR      = "0.0.0.0/0"
+
+	managerSecurityGroupName = "ManagerSecurityGroup"
+	workerSecurityGroupName  = "WorkerSecurityGroup"
+)
+
+// securityGroupRule is a rule allowing traffic to or from an IPv4 CIDR block.  Rules for all protocols have ports of
+// -1.
+type securityGroupRule struct {
+	Protocol string
+	FromPort int64
+	ToPort   int64
+	CIDR     string
+}
+
+func (r securityGroupRule) String() string {
+	return fmt.Sprintf("%s %d-%d %s", r.Protocol, r.FromPort, r.ToPort, r.CIDR)
+}
+
+func (r securityGroupRule) permission() *ec2.IpPermission {
+	return &ec2.IpPermission{
+		IpProtocol: aws.String(r.Protocol),
+		FromPort:   aws.Int64(r.FromPort),
+		ToPort:     aws.Int64(r.ToPort),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(r.CIDR)}},
+	}
+}
+
+func allTraffic(cidr string) securityGroupRule {
+	return securityGroupRule{Protocol: "-1", FromPort: -1, ToPort: -1, CIDR: cidr}
+}
+
+func tcpPort(port int64, cidr string) securityGroupRule {
+	return securityGroupRule{Protocol: "tcp", FromPort: port, ToPort: port, CIDR: cidr}
+}
+
+// securityGroupRules are the desired rules of a security group.
+type securityGroupRules struct {
+	Ingress []securityGroupRule
+	Egress  []securityGroupRule
+}
+
+// clusterNetwork is the address space of a cluster's instances, which security group rules allow traffic from.
+type clusterNetwork struct {
+	vpcCIDR     string
+	managerCIDR string
+	workerCIDR  string
+}
+
+// createdNetwork is the network of clusters whose VPC and subnets are created by bootstrap.
+var createdNetwork = clusterNetwork{vpcCIDR: vpcCIDR, managerCIDR: managerSubnetCIDR, workerCIDR: workerSubnetCIDR}
+
+// existingNetwork is the network of clusters that use existing subnets of a VPC.  Since other subnets of the VPC may
+// be used by either managers or workers, traffic is allowed from the whole VPC.
+func existingNetwork(vpcCIDR string) clusterNetwork {
+	return clusterNetwork{vpcCIDR: vpcCIDR, managerCIDR: vpcCIDR, workerCIDR: vpcCIDR}
+}
+
+// uniqueRules omits repeated rules, which EC2 rejects.
+func uniqueRules(rules ...securityGroupRule) []securityGroupRule {
+	seen := map[securityGroupRule]bool{}
+	unique := []securityGroupRule{}
+	for _, rule := range rules {
+		if !seen[rule] {
+			seen[rule] = true
+			unique = append(unique, rule)
+		}
+	}
+	return unique
+}
+
+// managerSecurityGroupRules are the rules of managers, which allow SSH from anywhere unless the cluster is managed
+// through Systems Manager.
+func managerSecurityGroupRules(network clusterNetwork, ssh bool) securityGroupRules {
+	ingress := []securityGroupRule{allTraffic(network.workerCIDR), allTraffic(network.managerCIDR)}
+	if ssh {
+		ingress = append(ingress, tcpPort(22, anywhereCIDR))
+	}
+	return securityGroupRules{
+		Ingress: uniqueRules(ingress...),
+		Egress:  []securityGroupRule{allTraffic(anywhereCIDR)},
+	}
+}
+
+func workerSecurityGroupRules(network clusterNetwork) securityGroupRules {
+	return securityGroupRules{
+		Ingress: []securityGroupRule{allTraffic(network.managerCIDR)},
+		Egress:  []securityGroupRule{allTraffic(anywhereCIDR)},
+	}
+}
+
+func sharedStorageSecurityGroupRules(network clusterNetwork) securityGroupRules {
+	return securityGroupRules{
+		Ingress: []securityGroupRule{tcpPort(nfsPort, network.vpcCIDR)},
+		Egress:  []securityGroupRule{allTraffic(anywhereCIDR)},
+	}
+}
+
+// flattenPermissions splits permissions into rules for each CIDR block, along with the permissions granted to
+// other sources, such as security groups and prefix lists.
+func flattenPermissions(permissions []*ec2.IpPermission) ([]securityGroupRule, []*ec2.IpPermission) {
+	rules := []securityGroupRule{}
+	others := []*ec2.IpPermission{}
+	for _, permission := range permissions {
+		rule := securityGroupRule{
+			Protocol: aws.StringValue(permission.IpProtocol),
+			FromPort: -1,
+			ToPort:   -1,
+		}
+		if permission.FromPort != nil {
+			rule.FromPort = *permission.FromPort
+		}
+		if permission.ToPort != nil {
+			rule.ToPort = *permission.ToPort
+		}
+		for _, ipRange := range permission.IpRanges {
+			rule.CIDR = aws.StringValue(ipRange.CidrIp)
+			rules = append(rules, rule)
+		}
+
+		if len(permission.UserIdGroupPairs) > 0 || len(permission.PrefixListIds) > 0 {
+			other := *permission
+			other.IpRanges = nil
+			others = append(others, &other)
+		}
+	}
+	return rules, others
+}
+
+// ruleChanges returns the permissions to authorize and, when strict, to revoke for actual rules to match desired.
+func ruleChanges(
+	desired []securityGroupRule,
+	actual []*ec2.IpPermission,
+	strict bool) (authorize []*ec2.IpPermission, revoke []*ec2.IpPermission) {
+
+	actualRules, others := flattenPermissions(actual)
+
+	existing := map[securityGroupRule]bool{}
+	for _, rule := range actualRules {
+		existing[rule] = true
+	}
+	wanted := map[securityGroupRule]bool{}
+	for _, rule := range desired {
+		wanted[rule] = true
+		if !existing[rule] {
+			authorize = append(authorize, rule.permission())
+		}
+	}
+
+	if strict {
+		for _, rule := range actualRules {
+			if !wanted[rule] {
+				revoke = append(revoke, rule.permission())
+			}
+		}
+		revoke = append(revoke, others...)
+	}
+	return authorize, revoke
+}
+
+func logChanges(groupID, action string, permissions []*ec2.IpPermission) {
+	rules, others := flattenPermissions(permissions)
+	for _, rule := range rules {
+		log.Infof("  %s %s %s", groupID, action, rule)
+	}
+	for _, other := range others {
+		log.Infof("  %s %s %s", groupID, action, other)
+	}
+}
+
+func authorizeIngress(ec2Client ec2iface.EC2API, groupID string, permissions []*ec2.IpPermission) error {
+	_, err := ec2Client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String(groupID),
+		IpPermissions: permissions,
+	})
+	return err
+}
+
+// configureSecurityGroup authorizes the ingress rules of a new security group.  New groups allow all egress, and
+// are not described first, since they may not yet be visible to DescribeSecurityGroups.
+func configureSecurityGroup(ec2Client ec2iface.EC2API, groupID string, desired securityGroupRules) error {
+	permissions := []*ec2.IpPermission{}
+	for _, rule := range desired.Ingress {
+		permissions = append(permissions, rule.permission())
+	}
+	return authorizeIngress(ec2Client, groupID, permissions)
+}
+
+// reconcileSecurityGroup applies the changes needed for the rules of a security group to match the desired rules.
+// Rules added out of band are kept unless strict is set, in which case they are revoked.
+func reconcileSecurityGroup(ec2Client ec2iface.EC2API, groupID string, desired securityGroupRules, strict bool) error {
+	groups, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		GroupIds: []*string{aws.String(groupID)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(groups.SecurityGroups) != 1 {
+		return fmt.Errorf("Security group %s not found", groupID)
+	}
+	group := groups.SecurityGroups[0]
+
+	authorize, revoke := ruleChanges(desired.Ingress, group.IpPermissions, strict)
+	if len(revoke) > 0 {
+		logChanges(groupID, "revoke ingress", revoke)
+		_, err := ec2Client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: revoke,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(authorize) > 0 {
+		logChanges(groupID, "authorize ingress", authorize)
+		if err := authorizeIngress(ec2Client, groupID, authorize); err != nil {
+			return err
+		}
+	}
+
+	authorize, revoke = ruleChanges(desired.Egress, group.IpPermissionsEgress, strict)
+	if len(revoke) > 0 {
+		logChanges(groupID, "revoke egress", revoke)
+		_, err := ec2Client.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: revoke,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(authorize) > 0 {
+		logChanges(groupID, "authorize egress", authorize)
+		_, err := ec2Client.AuthorizeSecurityGroupEgress(&ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: authorize,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileSecurityGroups reconciles the rules of the security groups created for a cluster.
+func reconcileSecurityGroups(config client.ConfigProvider, cluster clusterID, strict, ssh bool) error {
+	ec2Client := ec2.New(config)
+
+	vpcID, network, err := findClusterVpc(ec2Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	groups, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: cluster.resourceFilter(vpcID),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to look up security groups: %s", err)
+	}
+
+	desired := map[string]securityGroupRules{
+		managerSecurityGroupName:                 managerSecurityGroupRules(network, ssh),
+		workerSecurityGroupName:                  workerSecurityGroupRules(network),
+		cluster.sharedStorageSecurityGroupName(): sharedStorageSecurityGroupRules(network),
+		cluster.endpointsSecurityGroupName():     endpointsSecurityGroupRules(network),
+	}
+
+	log.Infof("Reconciling security groups of cluster %s", cluster.name)
+	for _, group := range groups.SecurityGroups {
+		rules, managed := desired[aws.StringValue(group.GroupName)]
+		if !managed {
+			log.Infof("  skipping security group %s (%s)", *group.GroupId, aws.StringValue(group.GroupName))
+			continue
+		}
+		if err := reconcileSecurityGroup(ec2Client, *group.GroupId, rules, strict); err != nil {
+			return fmt.Errorf("Failed to reconcile security group %s: %s", *group.GroupId, err)
+		}
+	}
+	return nil
+}
+
+// createSecurityGroups creates and configures the manager and worker security groups of a cluster.
+func createSecurityGroups(
+	ec2Client ec2iface.EC2API,
+	vpcID string,
+	network clusterNetwork,
+	ssh bool) (managerGroupID *string, workerGroupID *string, err error) {
+
+	workerSecurityGroup, err := ec2Client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(workerSecurityGroupName),
+		VpcId:       aws.String(vpcID),
+		Description: aws.String("Worker node network rules"),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Infof("  worker security group %s", *workerSecurityGroup.GroupId)
+
+	managerSecurityGroup, err := ec2Client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(managerSecurityGroupName),
+		VpcId:       aws.String(vpcID),
+		Description: aws.String("Manager node network rules"),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Infof("  manager security group %s", *managerSecurityGroup.GroupId)
+
+	err = configureSecurityGroup(ec2Client, *managerSecurityGroup.GroupId, managerSecurityGroupRules(network, ssh))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = configureSecurityGroup(ec2Client, *workerSecurityGroup.GroupId, workerSecurityGroupRules(network))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return managerSecurityGroup.GroupId, workerSecurityGroup.GroupId, nil
+}
@@ -0,0 +1,245 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"strings"
+	"time"
+)
+
+const defaultSSMTimeout = 600
+
+var ssmPollInterval = 10 * time.Second
+
+// ssmAccess manages the instances of a cluster exclusively through Systems Manager, rather than SSH.  Instances are
+// launched without key pairs or public addresses, the SSH port is not opened, and the SSM agent is started on boot.
+type ssmAccess struct {
+	// Commands are run on the boot leader with Run Command once it registers with Systems Manager, for configuration
+	// after the cluster is provisioned.
+	Commands []string `json:",omitempty"`
+
+	// Timeout is the maximum wait in seconds for the boot leader to register, and for the commands to complete,
+	// defaulting to 600.
+	Timeout int64 `json:",omitempty"`
+}
+
+func (a *ssmAccess) timeout() time.Duration {
+	if a.Timeout == 0 {
+		return defaultSSMTimeout * time.Second
+	}
+	return time.Duration(a.Timeout) * time.Second
+}
+
+// validateSSMAccess checks that no group may be reached with SSH, and that workers of created networks reach the
+// internet through NAT, since they have no public addresses.
+func (s *clusterSpec) validateSSMAccess() error {
+	errs := []string{}
+	if s.SSMAccess.Timeout < 0 {
+		errs = append(errs, "SSMAccess.Timeout must not be negative")
+	}
+	if !s.usesExistingSubnets() && s.PrivateWorkers == nil {
+		errs = append(errs, "PrivateWorkers must be set with SSMAccess, unless groups use existing subnets")
+	}
+	if s.Defaults != nil && s.Defaults.KeyName != "" {
+		errs = append(errs, "Defaults.KeyName may not be set with SSMAccess")
+	}
+	for _, group := range s.Groups {
+		if group.Config.RunInstancesInput.KeyName != nil {
+			errs = append(errs, fmt.Sprintf("In group %s: KeyName may not be set with SSMAccess", group.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// applySSMAccess reaches Systems Manager through VPC endpoints, since instances have no public addresses.  Clusters in
+// existing subnets rely on the routes of their network.
+func (s *clusterSpec) applySSMAccess() {
+	if s.SSMAccess == nil || s.usesExistingSubnets() {
+		return
+	}
+	for _, service := range s.VpcEndpoints {
+		if service == "ssm" {
+			return
+		}
+	}
+	s.VpcEndpoints = append(s.VpcEndpoints, "ssm")
+}
+
+// ssmAgentScript starts the SSM agent, installing it on images that do not include it.
+const ssmAgentScript = `
+# Register with Systems Manager.
+(
+if ! systemctl list-unit-files | grep -q amazon-ssm-agent
+then
+  snap install amazon-ssm-agent --classic || yum install -y amazon-ssm-agent
+fi
+systemctl enable --now amazon-ssm-agent || systemctl enable --now snap.amazon-ssm-agent.amazon-ssm-agent.service
+) || echo "Failed to start the SSM agent"
+`
+
+// ssmManagedInstanceStatement is the permission of the SSM agent of workers to register and serve sessions and
+// commands.
+var ssmManagedInstanceStatement = policyStatement{
+	Effect: "Allow",
+	Action: []string{
+		"ssm:UpdateInstanceInformation",
+		"ssm:ListInstanceAssociations",
+		"ssm:ListAssociations",
+		"ssmmessages:CreateControlChannel",
+		"ssmmessages:CreateDataChannel",
+		"ssmmessages:OpenControlChannel",
+		"ssmmessages:OpenDataChannel",
+		"ec2messages:AcknowledgeMessage",
+		"ec2messages:DeleteMessage",
+		"ec2messages:FailMessage",
+		"ec2messages:GetEndpoint",
+		"ec2messages:GetMessages",
+		"ec2messages:SendReply",
+	},
+	Resource: "*",
+}
+
+// sessionManagerOutputs describe connecting to the boot leader with Session Manager.
+type sessionManagerOutputs struct {
+	Target  string
+	Command string
+}
+
+func newSessionManagerOutputs(region, instanceID string) *sessionManagerOutputs {
+	return &sessionManagerOutputs{
+		Target:  instanceID,
+		Command: fmt.Sprintf("aws ssm start-session --region %s --target %s", region, instanceID),
+	}
+}
+
+type ssmFilter struct {
+	Key    string
+	Values []string
+}
+
+type describeInstanceInformationInput struct {
+	Filters []ssmFilter
+}
+
+type instanceInformation struct {
+	InstanceId string
+	PingStatus string
+}
+
+type describeInstanceInformationOutput struct {
+	InstanceInformationList []instanceInformation
+}
+
+type sendCommandInput struct {
+	DocumentName   string
+	InstanceIds    []string
+	Comment        string
+	Parameters     map[string][]string
+	TimeoutSeconds int64
+}
+
+type sendCommandOutput struct {
+	Command struct {
+		CommandId string
+	}
+}
+
+type getCommandInvocationInput struct {
+	CommandId  string
+	InstanceId string
+}
+
+type getCommandInvocationOutput struct {
+	Status                string
+	StandardOutputContent string
+	StandardErrorContent  string
+}
+
+func sendSSM(ssm *client.Client, action string, input, output interface{}) error {
+	return ssm.NewRequest(&request.Operation{Name: action, HTTPMethod: "POST", HTTPPath: "/"}, input, output).Send()
+}
+
+// waitForSSMRegistration waits for an instance to register with Systems Manager and report that it is online.
+func waitForSSMRegistration(ssm *client.Client, instanceID string, deadline time.Time) error {
+	for {
+		output := describeInstanceInformationOutput{}
+		err := sendSSM(ssm, "DescribeInstanceInformation", &describeInstanceInformationInput{
+			Filters: []ssmFilter{{Key: "InstanceIds", Values: []string{instanceID}}},
+		}, &output)
+		if err != nil {
+			return fmt.Errorf("Failed to look up the Systems Manager registration of %s: %s", instanceID, err)
+		}
+		for _, information := range output.InstanceInformationList {
+			if information.InstanceId == instanceID && information.PingStatus == "Online" {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Instance %s did not register with Systems Manager", instanceID)
+		}
+		time.Sleep(ssmPollInterval)
+	}
+}
+
+// runBootLeaderCommands runs the commands of SSMAccess on the boot leader with Run Command, once it registers with
+// Systems Manager, failing if the commands do not succeed.
+func runBootLeaderCommands(config client.ConfigProvider, access ssmAccess, instanceID string) error {
+	if len(access.Commands) == 0 {
+		return nil
+	}
+
+	log.Infof("Waiting for boot leader to register with Systems Manager")
+	ssm := newSSMClient(config)
+	deadline := time.Now().Add(access.timeout())
+	if err := waitForSSMRegistration(ssm, instanceID, deadline); err != nil {
+		return err
+	}
+	return runShellCommands(ssm, instanceID, "InfraKit bootstrap configuration", access.Commands, deadline)
+}
+
+// runShellCommands runs commands on an instance registered with Systems Manager, waiting for them to complete.
+func runShellCommands(ssm *client.Client, instanceID, comment string, commands []string, deadline time.Time) error {
+	sent := sendCommandOutput{}
+	err := sendSSM(ssm, "SendCommand", &sendCommandInput{
+		DocumentName:   "AWS-RunShellScript",
+		InstanceIds:    []string{instanceID},
+		Comment:        comment,
+		Parameters:     map[string][]string{"commands": commands},
+		TimeoutSeconds: int64(deadline.Sub(time.Now()).Seconds()),
+	}, &sent)
+	if err != nil {
+		return fmt.Errorf("Failed to run commands on %s: %s", instanceID, err)
+	}
+	log.Infof("  command %s", sent.Command.CommandId)
+
+	for {
+		time.Sleep(ssmPollInterval)
+		invocation := getCommandInvocationOutput{}
+		err := sendSSM(ssm, "GetCommandInvocation", &getCommandInvocationInput{
+			CommandId:  sent.Command.CommandId,
+			InstanceId: instanceID,
+		}, &invocation)
+		// Invocations are not found until the command is delivered to the instance.
+		if err != nil && !strings.Contains(err.Error(), "InvocationDoesNotExist") {
+			return fmt.Errorf("Failed to look up command %s: %s", sent.Command.CommandId, err)
+		}
+
+		switch invocation.Status {
+		case "Success":
+			log.Infof("  command succeeded")
+			return nil
+		case "Failed", "Cancelled", "TimedOut":
+			return fmt.Errorf("Command %s %s on %s: %s",
+				sent.Command.CommandId, strings.ToLower(invocation.Status), instanceID, invocation.StandardErrorContent)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for command %s on %s", sent.Command.CommandId, instanceID)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/docker/infrakit.aws/plugin/store"
+	"github.com/docker/infrakit/spi/group"
+	"strings"
+)
+
+// stateStorage configures an S3 bucket that holds the cluster spec and the committed group specs.  Managers restore
+// the group specs from the bucket when they boot, so a re-provisioned manager recovers the desired state of the
+// cluster without the groups being committed again.
+type stateStorage struct {
+	Bucket string
+
+	// Prefix is prepended to the keys of objects in the bucket, defaulting to the cluster name.
+	Prefix string `json:",omitempty"`
+
+	// KMSKeyID is the KMS key used to encrypt objects, which are otherwise encrypted with S3-managed keys.
+	KMSKeyID string `json:",omitempty"`
+}
+
+func (s *clusterSpec) statePrefix() string {
+	if s.State.Prefix == "" {
+		return s.ClusterName
+	}
+	return strings.Trim(s.State.Prefix, "/")
+}
+
+func (s *clusterSpec) stateURL() string {
+	return fmt.Sprintf("s3://%s/%s", s.State.Bucket, s.statePrefix())
+}
+
+func (s *clusterSpec) stateSnapshot(config client.ConfigProvider, key string) *store.S3Snapshot {
+	return store.NewS3Snapshot(s3.New(config), s.State.Bucket, s.statePrefix()+"/"+key, s.State.KMSKeyID)
+}
+
+func groupStateKey(id group.ID) string {
+	return fmt.Sprintf("groups/%s.json", id)
+}
+
+// saveState stores the cluster spec and group specs, creating the bucket if necessary.
+func saveState(config client.ConfigProvider, spec clusterSpec, groups map[group.ID]string) error {
+	log.Infof("Saving cluster state to %s", spec.stateURL())
+
+	err := store.EnsureBucket(s3.New(config), spec.State.Bucket, spec.cluster().region)
+	if err != nil {
+		return fmt.Errorf("Failed to prepare state bucket: %s", err)
+	}
+
+	err = spec.stateSnapshot(config, "cluster.json").Save(spec)
+	if err != nil {
+		return fmt.Errorf("Failed to save cluster spec: %s", err)
+	}
+
+	for id, groupSpec := range groups {
+		err = spec.stateSnapshot(config, groupStateKey(id)).Save(json.RawMessage(groupSpec))
+		if err != nil {
+			return fmt.Errorf("Failed to save spec of group %s: %s", id, err)
+		}
+	}
+
+	return nil
+}
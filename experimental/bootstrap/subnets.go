@@ -0,0 +1,286 @@
+package bootstrap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"net"
+	"sort"
+	"strings"
+)
+
+// existingSubnets selects subnets of an existing VPC for a group, by ID or by tags, instead of the subnets created by
+// bootstrap.
+type existingSubnets struct {
+	IDs  []string          `json:",omitempty"`
+	Tags map[string]string `json:",omitempty"`
+}
+
+func (e existingSubnets) describeInput() *ec2.DescribeSubnetsInput {
+	input := &ec2.DescribeSubnetsInput{}
+	for _, id := range e.IDs {
+		input.SubnetIds = append(input.SubnetIds, aws.String(id))
+	}
+
+	keys := []string{}
+	for key := range e.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		input.Filters = append(input.Filters, &ec2.Filter{
+			Name:   aws.String("tag:" + key),
+			Values: []*string{aws.String(e.Tags[key])},
+		})
+	}
+	return input
+}
+
+// usesExistingSubnets determines whether the groups of the cluster are launched in existing subnets.
+func (s *clusterSpec) usesExistingSubnets() bool {
+	for _, group := range s.Groups {
+		if group.Subnets != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// bySubnetZone orders subnets by availability zone and ID, so that subnets are chosen in a stable order.
+type bySubnetZone []*ec2.Subnet
+
+func (b bySubnetZone) Len() int      { return len(b) }
+func (b bySubnetZone) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b bySubnetZone) Less(i, j int) bool {
+	if *b[i].AvailabilityZone != *b[j].AvailabilityZone {
+		return *b[i].AvailabilityZone < *b[j].AvailabilityZone
+	}
+	return *b[i].SubnetId < *b[j].SubnetId
+}
+
+func containsAll(cidr string, ips []string) bool {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if !network.Contains(net.ParseIP(ip)) {
+			return false
+		}
+	}
+	return true
+}
+
+// subnetAddresses returns addresses of a subnet for managers, starting after the addresses reserved by AWS.
+func subnetAddresses(cidr string, count int) ([]string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	base := binary.BigEndian.Uint32(network.IP.To4())
+	ones, bits := network.Mask.Size()
+	if bits-ones < 3 || count > (1<<uint(bits-ones))-5 {
+		return nil, fmt.Errorf("Subnet %s is too small for %d managers", cidr, count)
+	}
+
+	addresses := []string{}
+	for i := 0; i < count; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, base+4+uint32(i))
+		addresses = append(addresses, ip.String())
+	}
+	return addresses, nil
+}
+
+// resolveSubnets chooses the subnet of each group that uses existing subnets, and places the group in the
+// availability zone of its subnet.  The subnet of the managers must contain the manager IPs, which are assigned from
+// the subnet when the spec does not set them.  All of the subnets must belong to one VPC.
+func (s *clusterSpec) resolveSubnets(ec2Client ec2iface.EC2API) error {
+	if !s.usesExistingSubnets() {
+		return nil
+	}
+	log.Info("Resolving existing subnets")
+
+	var vpcID string
+	errs := []string{}
+	s.mutateGroups(func(group *instanceGroupSpec) {
+		addError := func(format string, a ...interface{}) {
+			errs = append(errs, fmt.Sprintf("In group %s: ", group.Name)+fmt.Sprintf(format, a...))
+		}
+
+		described, err := ec2Client.DescribeSubnets(group.Subnets.describeInput())
+		if err != nil {
+			addError("failed to describe subnets: %s", err)
+			return
+		}
+		subnets := described.Subnets
+		if len(subnets) == 0 {
+			addError("no subnets match Subnets")
+			return
+		}
+		sort.Sort(bySubnetZone(subnets))
+
+		for _, subnet := range subnets {
+			if vpcID == "" {
+				vpcID = *subnet.VpcId
+			} else if *subnet.VpcId != vpcID {
+				addError("subnet %s is in VPC %s, not %s", *subnet.SubnetId, *subnet.VpcId, vpcID)
+				return
+			}
+		}
+
+		candidates := []*ec2.Subnet{}
+		for _, subnet := range subnets {
+			placement := group.Config.RunInstancesInput.Placement
+			if placement != nil && placement.AvailabilityZone != nil &&
+				*placement.AvailabilityZone != *subnet.AvailabilityZone {
+				continue
+			}
+			if group.isManager() && len(s.ManagerIPs) > 0 && !containsAll(*subnet.CidrBlock, s.ManagerIPs) {
+				continue
+			}
+			candidates = append(candidates, subnet)
+		}
+		if len(candidates) == 0 {
+			addError("none of the %d matching subnets are in the availability zone of the group, "+
+				"and contain the manager IPs of manager groups", len(subnets))
+			return
+		}
+
+		subnet := candidates[0]
+		if group.Config.RunInstancesInput.Placement == nil {
+			group.Config.RunInstancesInput.Placement = &ec2.Placement{}
+		}
+		group.Config.RunInstancesInput.Placement.AvailabilityZone = subnet.AvailabilityZone
+		group.subnetID = subnet.SubnetId
+		log.Infof("  group %s in subnet %s (%s)", group.Name, *subnet.SubnetId, *subnet.AvailabilityZone)
+
+		if group.isManager() && len(s.ManagerIPs) == 0 {
+			s.ManagerIPs, err = subnetAddresses(*subnet.CidrBlock, group.Size)
+			if err != nil {
+				addError("%s", err)
+			}
+		}
+	})
+
+	// MVP restriction - all groups must be in the same Availability Zone.
+	if az, err := s.availabilityZone(); err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		for _, group := range s.Groups {
+			placement := group.Config.RunInstancesInput.Placement
+			if placement != nil && aws.StringValue(placement.AvailabilityZone) != az {
+				errs = append(errs, "All groups must be placed in subnets of the same availability zone")
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	vpcs, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{aws.String(vpcID)}})
+	if err != nil {
+		return fmt.Errorf("Failed to describe VPC %s: %s", vpcID, err)
+	}
+	if len(vpcs.Vpcs) != 1 {
+		return fmt.Errorf("VPC %s not found", vpcID)
+	}
+
+	s.existingVpcID = vpcID
+	s.network = existingNetwork(*vpcs.Vpcs[0].CidrBlock)
+	log.Infof("  VPC %s (%s)", vpcID, *vpcs.Vpcs[0].CidrBlock)
+	return nil
+}
+
+// useExistingNetwork creates the security groups of a cluster in the VPC of its existing subnets, and launches each
+// group in its subnet.
+func useExistingNetwork(ec2Client ec2iface.EC2API, spec *clusterSpec) error {
+	log.Infof("  using existing VPC %s", spec.existingVpcID)
+
+	managerSecurityGroupID, workerSecurityGroupID, err := createSecurityGroups(
+		ec2Client,
+		spec.existingVpcID,
+		spec.network,
+		spec.SSMAccess == nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{managerSecurityGroupID, workerSecurityGroupID},
+		Tags:      spec.resourceTags(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if spec.StaticManagerInterfaces {
+		managers, err := spec.managers()
+		if err != nil {
+			return err
+		}
+		err = createManagerInterfaces(ec2Client, spec, managers.subnetID, managerSecurityGroupID)
+		if err != nil {
+			return err
+		}
+	}
+
+	spec.mutateGroups(func(group *instanceGroupSpec) {
+		securityGroupID := workerSecurityGroupID
+		if group.isManager() {
+			securityGroupID = managerSecurityGroupID
+		}
+		applySubnetAndSecurityGroups(&group.Config.RunInstancesInput, group.subnetID, securityGroupID)
+	})
+	return nil
+}
+
+// findClusterVpc finds the VPC of a cluster, along with its network.  A VPC created for the cluster is tagged with
+// the cluster tag, while an existing VPC is found through the security groups of the cluster.
+func findClusterVpc(ec2Client ec2iface.EC2API, cluster clusterID) (string, clusterNetwork, error) {
+	vpcs, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: []*ec2.Filter{cluster.clusterFilter()}})
+	if err != nil {
+		return "", clusterNetwork{}, fmt.Errorf("Failed to look up VPC: %s", err)
+	}
+	switch len(vpcs.Vpcs) {
+	case 0:
+	case 1:
+		return *vpcs.Vpcs[0].VpcId, createdNetwork, nil
+	default:
+		return "", clusterNetwork{}, fmt.Errorf("Found multiple VPCs for cluster %s", cluster.name)
+	}
+
+	groups, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{cluster.clusterFilter()},
+	})
+	if err != nil {
+		return "", clusterNetwork{}, fmt.Errorf("Failed to look up security groups: %s", err)
+	}
+	vpcIDs := map[string]bool{}
+	for _, group := range groups.SecurityGroups {
+		vpcIDs[aws.StringValue(group.VpcId)] = true
+	}
+	if len(vpcIDs) != 1 {
+		return "", clusterNetwork{}, fmt.Errorf("Expected one VPC for cluster %s, found %d", cluster.name, len(vpcIDs))
+	}
+
+	var vpcID string
+	for id := range vpcIDs {
+		vpcID = id
+	}
+	vpcs, err = ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{aws.String(vpcID)}})
+	if err != nil {
+		return "", clusterNetwork{}, fmt.Errorf("Failed to look up VPC: %s", err)
+	}
+	if len(vpcs.Vpcs) != 1 {
+		return "", clusterNetwork{}, fmt.Errorf("VPC %s of cluster %s not found", vpcID, cluster.name)
+	}
+	return vpcID, existingNetwork(*vpcs.Vpcs[0].CidrBlock), nil
+}
@@ -0,0 +1,471 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"io"
+	"sort"
+	"strings"
+)
+
+// terraformResource is a resource of a cluster that may be imported into Terraform state.
+type terraformResource struct {
+	resourceType string
+	name         string
+	id           string
+}
+
+// terraformNames assigns unique Terraform resource names, which may contain letters, digits, underscores, and dashes,
+// and may not start with a digit or dash.
+type terraformNames map[string]bool
+
+func (n terraformNames) name(resourceType, label string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '_'
+		}
+	}, label)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') || name[0] == '-' {
+		name = "_" + name
+	}
+
+	unique := name
+	for i := 1; n[resourceType+"."+unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	n[resourceType+"."+unique] = true
+	return unique
+}
+
+// tagValue returns the value of a tag, or an empty string if the tag is not set.
+func tagValue(tags []*ec2.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+// terraformResources finds the resources of a cluster, as they would be addressed in Terraform.
+func terraformResources(config client.ConfigProvider, cluster clusterID) ([]terraformResource, error) {
+	ec2Client := ec2.New(config)
+	names := terraformNames{}
+	resources := []terraformResource{}
+	add := func(resourceType, label, id string) {
+		resources = append(resources, terraformResource{
+			resourceType: resourceType,
+			name:         names.name(resourceType, label),
+			id:           id,
+		})
+	}
+
+	vpcID, network, err := findClusterVpc(ec2Client, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == createdNetwork {
+		add("aws_vpc", cluster.name, vpcID)
+
+		subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: cluster.resourceFilter(vpcID)})
+		if err != nil {
+			return nil, err
+		}
+		for _, subnet := range subnets.Subnets {
+			add("aws_subnet", *subnet.AvailabilityZone, *subnet.SubnetId)
+		}
+
+		internetGateways, err := ec2Client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+			Filters: []*ec2.Filter{
+				{Name: aws.String("attachment.vpc-id"), Values: []*string{aws.String(vpcID)}},
+				cluster.clusterFilter(),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, internetGateway := range internetGateways.InternetGateways {
+			add("aws_internet_gateway", cluster.name, *internetGateway.InternetGatewayId)
+		}
+
+		routeTables, err := ec2Client.DescribeRouteTables(
+			&ec2.DescribeRouteTablesInput{Filters: cluster.resourceFilter(vpcID)})
+		if err != nil {
+			return nil, err
+		}
+		for _, routeTable := range routeTables.RouteTables {
+			add("aws_route_table", cluster.name, *routeTable.RouteTableId)
+		}
+
+		gateways, err := ec2Client.DescribeNatGateways(
+			&ec2.DescribeNatGatewaysInput{Filter: cluster.resourceFilter(vpcID)})
+		if err != nil {
+			return nil, err
+		}
+		for _, gateway := range gateways.NatGateways {
+			if aws.StringValue(gateway.State) != ec2.NatGatewayStateDeleted {
+				add("aws_nat_gateway", cluster.name, *gateway.NatGatewayId)
+			}
+		}
+
+		addresses, err := ec2Client.DescribeAddresses(
+			&ec2.DescribeAddressesInput{Filters: []*ec2.Filter{cluster.clusterFilter()}})
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses.Addresses {
+			add("aws_eip", cluster.name, *address.AllocationId)
+		}
+
+		endpoints, err := describeVpcEndpoints(ec2Client, cluster.resourceFilter(vpcID))
+		if err != nil {
+			return nil, err
+		}
+		for _, endpoint := range endpoints {
+			add("aws_vpc_endpoint", aws.StringValue(endpoint.ServiceName), *endpoint.VpcEndpointId)
+		}
+	}
+
+	securityGroups, err := ec2Client.DescribeSecurityGroups(
+		&ec2.DescribeSecurityGroupsInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, err
+	}
+	for _, securityGroup := range securityGroups.SecurityGroups {
+		add("aws_security_group", *securityGroup.GroupName, *securityGroup.GroupId)
+	}
+
+	interfaces, err := ec2Client.DescribeNetworkInterfaces(
+		&ec2.DescribeNetworkInterfacesInput{Filters: cluster.resourceFilter(vpcID)})
+	if err != nil {
+		return nil, err
+	}
+	for _, networkInterface := range interfaces.NetworkInterfaces {
+		// Interfaces created with an instance are part of the instance in Terraform.
+		if attachment := networkInterface.Attachment; attachment != nil &&
+			aws.BoolValue(attachment.DeleteOnTermination) {
+			continue
+		}
+		add("aws_network_interface", aws.StringValue(networkInterface.PrivateIpAddress),
+			*networkInterface.NetworkInterfaceId)
+	}
+
+	err = ec2Client.DescribeInstancesPages(
+		&ec2.DescribeInstancesInput{Filters: append(cluster.resourceFilter(vpcID), &ec2.Filter{
+			Name:   aws.String("instance-state-name"),
+			Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"}),
+		})},
+		func(page *ec2.DescribeInstancesOutput, last bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, ec2Instance := range reservation.Instances {
+					label := tagValue(ec2Instance.Tags, instance.GroupTag)
+					if label == "" {
+						label = *ec2Instance.InstanceId
+					}
+					add("aws_instance", label, *ec2Instance.InstanceId)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, err := ec2Client.DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{cluster.clusterFilter()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes.Volumes {
+		// Volumes created with an instance are part of the instance in Terraform.
+		launched := false
+		for _, attachment := range volume.Attachments {
+			launched = launched || aws.BoolValue(attachment.DeleteOnTermination)
+		}
+		if !launched {
+			add("aws_ebs_volume", *volume.VolumeId, *volume.VolumeId)
+		}
+	}
+
+	iamResources, err := terraformIAMResources(iam.New(config), cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range iamResources {
+		add(resource.resourceType, resource.name, resource.id)
+	}
+
+	fileSystems, err := efs.New(config).DescribeFileSystems(&efs.DescribeFileSystemsInput{
+		CreationToken: aws.String(cluster.fileSystemToken()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, fileSystem := range fileSystems.FileSystems {
+		add("aws_efs_file_system", cluster.name, *fileSystem.FileSystemId)
+	}
+
+	elbClient := elbv2.New(config)
+	loadBalancers, err := elbClient.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
+		Names: []*string{aws.String(cluster.managerLoadBalancerName())},
+	})
+	if err == nil {
+		for _, loadBalancer := range loadBalancers.LoadBalancers {
+			add("aws_lb", "managers", *loadBalancer.LoadBalancerArn)
+		}
+		targetGroups, err := elbClient.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+			Names: []*string{aws.String(cluster.managerLoadBalancerName())},
+		})
+		if err == nil {
+			for _, targetGroup := range targetGroups.TargetGroups {
+				add("aws_lb_target_group", "managers", *targetGroup.TargetGroupArn)
+			}
+		}
+	}
+
+	logGroups, err := cloudwatchlogs.New(config).DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(cluster.logGroupName()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, logGroup := range logGroups.LogGroups {
+		if *logGroup.LogGroupName == cluster.logGroupName() {
+			add("aws_cloudwatch_log_group", cluster.name, *logGroup.LogGroupName)
+		}
+	}
+
+	return resources, nil
+}
+
+// terraformIAMResources finds the roles, instance profiles, and policies of a cluster, along with the attachments of
+// the policies to the roles.  The worker role only exists for clusters with worker permissions.
+func terraformIAMResources(iamClient *iam.IAM, cluster clusterID) ([]terraformResource, error) {
+	policies, err := iamClient.ListPolicies(&iam.ListPoliciesInput{Scope: aws.String("Local")})
+	if err != nil {
+		return nil, err
+	}
+	policyARNs := map[string]string{}
+	for _, policy := range policies.Policies {
+		policyARNs[*policy.PolicyName] = *policy.Arn
+	}
+
+	resources := []terraformResource{}
+	roles := []struct{ role, profile, policy string }{
+		{cluster.roleName(), cluster.instanceProfileName(), cluster.managerPolicyName()},
+		{cluster.workerRoleName(), cluster.workerInstanceProfileName(), cluster.workerPolicyName()},
+	}
+	for _, r := range roles {
+		if _, err := iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(r.role)}); err != nil {
+			continue
+		}
+		resources = append(resources, terraformResource{"aws_iam_role", r.role, r.role})
+
+		_, err := iamClient.GetInstanceProfile(&iam.GetInstanceProfileInput{InstanceProfileName: aws.String(r.profile)})
+		if err == nil {
+			resources = append(resources, terraformResource{"aws_iam_instance_profile", r.profile, r.profile})
+		}
+
+		if arn, has := policyARNs[r.policy]; has {
+			resources = append(resources,
+				terraformResource{"aws_iam_policy", r.policy, arn},
+				terraformResource{"aws_iam_role_policy_attachment", r.policy, r.role + "/" + arn})
+		}
+	}
+	return resources, nil
+}
+
+// printTerraformImports writes Terraform import blocks for resources.  Running terraform plan with
+// -generate-config-out then generates the configuration of the imported resources.
+func printTerraformImports(out io.Writer, resources []terraformResource) error {
+	for _, resource := range resources {
+		_, err := fmt.Fprintf(out, "import {\n  to = %s.%s\n  id = %q\n}\n\n", resource.resourceType, resource.name,
+			resource.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// terraformPlan is the part of the JSON representation of a Terraform plan, as printed by terraform show -json,
+// holding the planned resources.
+type terraformPlan struct {
+	PlannedValues struct {
+		RootModule terraformModule `json:"root_module"`
+	} `json:"planned_values"`
+}
+
+type terraformModule struct {
+	Resources []struct {
+		Address string          `json:"address"`
+		Mode    string          `json:"mode"`
+		Type    string          `json:"type"`
+		Values  json.RawMessage `json:"values"`
+	} `json:"resources"`
+	ChildModules []terraformModule `json:"child_modules"`
+}
+
+// terraformInstance is the part of the attributes of an aws_instance resource that translate to a launch request.
+// User data is omitted since Terraform records a hash of it.
+type terraformInstance struct {
+	AMI                      string            `json:"ami"`
+	InstanceType             string            `json:"instance_type"`
+	KeyName                  string            `json:"key_name"`
+	SubnetID                 string            `json:"subnet_id"`
+	AvailabilityZone         string            `json:"availability_zone"`
+	VpcSecurityGroupIDs      []string          `json:"vpc_security_group_ids"`
+	IamInstanceProfile       string            `json:"iam_instance_profile"`
+	EbsOptimized             *bool             `json:"ebs_optimized"`
+	Monitoring               *bool             `json:"monitoring"`
+	AssociatePublicIPAddress *bool             `json:"associate_public_ip_address"`
+	Tags                     map[string]string `json:"tags"`
+	EbsBlockDevices          []struct {
+		DeviceName          string `json:"device_name"`
+		VolumeSize          int64  `json:"volume_size"`
+		VolumeType          string `json:"volume_type"`
+		Iops                int64  `json:"iops"`
+		DeleteOnTermination *bool  `json:"delete_on_termination"`
+		Encrypted           *bool  `json:"encrypted"`
+		SnapshotID          string `json:"snapshot_id"`
+	} `json:"ebs_block_device"`
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+func optionalInt64(value int64) *int64 {
+	if value == 0 {
+		return nil
+	}
+	return aws.Int64(value)
+}
+
+// createInstanceRequest translates the attributes of an aws_instance to a request of the instance plugin.
+func (t terraformInstance) createInstanceRequest() instance.CreateInstanceRequest {
+	run := ec2.RunInstancesInput{
+		ImageId:      optionalString(t.AMI),
+		InstanceType: optionalString(t.InstanceType),
+		KeyName:      optionalString(t.KeyName),
+		EbsOptimized: t.EbsOptimized,
+	}
+	if t.AvailabilityZone != "" {
+		run.Placement = &ec2.Placement{AvailabilityZone: aws.String(t.AvailabilityZone)}
+	}
+	if t.IamInstanceProfile != "" {
+		run.IamInstanceProfile = &ec2.IamInstanceProfileSpecification{Name: aws.String(t.IamInstanceProfile)}
+	}
+	if t.Monitoring != nil {
+		run.Monitoring = &ec2.RunInstancesMonitoringEnabled{Enabled: t.Monitoring}
+	}
+
+	// A public IP address may only be requested with a network interface specification.
+	if t.AssociatePublicIPAddress != nil {
+		run.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{{
+			DeviceIndex:              aws.Int64(0),
+			AssociatePublicIpAddress: t.AssociatePublicIPAddress,
+			SubnetId:                 optionalString(t.SubnetID),
+			Groups:                   aws.StringSlice(t.VpcSecurityGroupIDs),
+		}}
+	} else {
+		run.SubnetId = optionalString(t.SubnetID)
+		if len(t.VpcSecurityGroupIDs) > 0 {
+			run.SecurityGroupIds = aws.StringSlice(t.VpcSecurityGroupIDs)
+		}
+	}
+
+	for _, device := range t.EbsBlockDevices {
+		run.BlockDeviceMappings = append(run.BlockDeviceMappings, &ec2.BlockDeviceMapping{
+			DeviceName: aws.String(device.DeviceName),
+			Ebs: &ec2.EbsBlockDevice{
+				VolumeSize:          optionalInt64(device.VolumeSize),
+				VolumeType:          optionalString(device.VolumeType),
+				Iops:                optionalInt64(device.Iops),
+				DeleteOnTermination: device.DeleteOnTermination,
+				Encrypted:           device.Encrypted,
+				SnapshotId:          optionalString(device.SnapshotID),
+			},
+		})
+	}
+
+	return instance.CreateInstanceRequest{Tags: t.Tags, RunInstancesInput: run}
+}
+
+// instancesFromTerraformPlan translates the aws_instance resources of a Terraform plan to requests of the instance
+// plugin, keyed by the address of the resource.
+func instancesFromTerraformPlan(planJSON []byte) (map[string]instance.CreateInstanceRequest, error) {
+	plan := terraformPlan{}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("Invalid Terraform plan: %s", err)
+	}
+
+	requests := map[string]instance.CreateInstanceRequest{}
+	modules := []terraformModule{plan.PlannedValues.RootModule}
+	for len(modules) > 0 {
+		module := modules[0]
+		modules = append(modules[1:], module.ChildModules...)
+
+		for _, resource := range module.Resources {
+			if resource.Mode != "managed" || resource.Type != "aws_instance" {
+				continue
+			}
+			attributes := terraformInstance{}
+			if err := json.Unmarshal(resource.Values, &attributes); err != nil {
+				return nil, fmt.Errorf("Invalid attributes of %s: %s", resource.Address, err)
+			}
+			requests[resource.Address] = attributes.createInstanceRequest()
+		}
+	}
+
+	if len(requests) == 0 {
+		log.Warn("No aws_instance resources found in the Terraform plan")
+	}
+	return requests, nil
+}
+
+// terraformInstanceRequest is the instance plugin request translated from a Terraform resource.
+type terraformInstanceRequest struct {
+	Address    string
+	Properties instance.CreateInstanceRequest
+}
+
+// printInstanceRequests writes instance plugin requests as JSON, ordered by the address of their Terraform resource.
+func printInstanceRequests(out io.Writer, requests map[string]instance.CreateInstanceRequest) error {
+	addresses := []string{}
+	for address := range requests {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	ordered := []terraformInstanceRequest{}
+	for _, address := range addresses {
+		ordered = append(ordered, terraformInstanceRequest{Address: address, Properties: requests[address]})
+	}
+
+	data, err := json.MarshalIndent(ordered, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
@@ -0,0 +1,152 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"strings"
+)
+
+// subnetIDs returns the subnets explicitly configured in a launch request.
+func subnetIDs(run ec2.RunInstancesInput) []*string {
+	ids := []*string{}
+	if run.SubnetId != nil {
+		ids = append(ids, run.SubnetId)
+	}
+	for _, networkInterface := range run.NetworkInterfaces {
+		if networkInterface.SubnetId != nil {
+			ids = append(ids, networkInterface.SubnetId)
+		}
+	}
+	return ids
+}
+
+// verify checks the spec against the AWS account using read-only API calls.  Each group is checked for the
+// configured subnets existing in the group's availability zone, and for each instance type the group may launch,
+// the instance type being offered in the availability zone, the image architecture being supported by the
+// instance type, the image having the drivers of the instance type's GPUs or accelerators, and the instance type and
+// image supporting the enclave, hibernation, and encryption in transit options of the group.
+func (s *clusterSpec) verify(config client.ConfigProvider) error {
+	errs := []string{}
+
+	for _, grp := range s.Groups {
+		errorPrefix := fmt.Sprintf("In group %s: ", grp.Name)
+		addError := func(format string, a ...interface{}) {
+			errs = append(errs, errorPrefix+fmt.Sprintf(format, a...))
+		}
+
+		ec2Client := ec2.New(s.cluster().getGroupAWSClient(config, grp))
+		run := grp.Config.RunInstancesInput
+		if run.Placement == nil || aws.StringValue(run.Placement.AvailabilityZone) == "" {
+			addError("Placement.AvailabilityZone must be set")
+			continue
+		}
+		az := aws.StringValue(run.Placement.AvailabilityZone)
+
+		encryptedByDefault := false
+		if grp.hibernationConfigured() {
+			encryption, err := ec2ext.New(ec2Client).GetEbsEncryptionByDefault()
+			if err != nil {
+				addError("failed to look up EBS encryption by default: %s", err)
+			} else {
+				encryptedByDefault = aws.BoolValue(encryption.EbsEncryptionByDefault)
+			}
+		}
+
+		if ids := subnetIDs(run); len(ids) > 0 {
+			subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: ids})
+			if err != nil {
+				addError("failed to describe subnets: %s", err)
+			} else {
+				for _, subnet := range subnets.Subnets {
+					if aws.StringValue(subnet.AvailabilityZone) != az {
+						addError(
+							"subnet %s is in availability zone %s, not %s",
+							aws.StringValue(subnet.SubnetId),
+							aws.StringValue(subnet.AvailabilityZone),
+							az)
+					}
+				}
+			}
+		}
+
+		for _, candidate := range launchCandidates(grp) {
+			if candidate.instanceType == nil {
+				addError("InstanceType must be set")
+				continue
+			}
+			instanceType := *candidate.instanceType
+
+			offerings, err := ec2ext.New(ec2Client).DescribeInstanceTypeOfferings(
+				&ec2ext.DescribeInstanceTypeOfferingsInput{
+					LocationType: aws.String("availability-zone"),
+					Filters: []*ec2.Filter{
+						{Name: aws.String("location"), Values: []*string{aws.String(az)}},
+						{Name: aws.String("instance-type"), Values: []*string{candidate.instanceType}},
+					},
+				})
+			if err != nil {
+				addError("failed to describe instance type offerings: %s", err)
+			} else if len(offerings.InstanceTypeOfferings) == 0 {
+				addError("instance type %s is not offered in %s", instanceType, az)
+			}
+
+			if candidate.imageID == nil {
+				continue
+			}
+
+			image, err := describeImage(ec2Client, candidate.imageID)
+			if err != nil {
+				addError("%s", err)
+				continue
+			}
+			architecture := aws.StringValue(image.Architecture)
+
+			types, err := ec2ext.New(ec2Client).DescribeInstanceTypes(&ec2ext.DescribeInstanceTypesInput{
+				InstanceTypes: []*string{candidate.instanceType},
+			})
+			if err != nil {
+				addError("failed to describe instance type %s: %s", instanceType, err)
+				continue
+			}
+
+			for _, typeInfo := range types.InstanceTypes {
+				supported := false
+				if typeInfo.ProcessorInfo != nil {
+					for _, a := range typeInfo.ProcessorInfo.SupportedArchitectures {
+						supported = supported || aws.StringValue(a) == architecture
+					}
+				}
+				if !supported {
+					addError(
+						"image %s has architecture %s, which is not supported by instance type %s",
+						*candidate.imageID,
+						architecture,
+						instanceType)
+				}
+
+				for _, err := range verifyLaunchOptions(grp, typeInfo, image, encryptedByDefault) {
+					addError("%s", err)
+				}
+
+				if drivers := requiredDrivers(instanceType, typeInfo); drivers != "" && !hasDrivers(image, drivers) {
+					addError(
+						"instance type %s requires %s drivers, which image %s does not have by its name or %s tag",
+						instanceType,
+						drivers,
+						*candidate.imageID,
+						driversTag)
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit.aws/plugin/migrate"
+	"sort"
+)
+
+// clusterSchema is the schema of cluster specs.  Specs of older versions are upgraded when they are read.
+var clusterSchema = migrate.Schema{
+	Name: "cluster spec",
+	Migrations: []migrate.Migration{
+		{
+			// Version 1 lists the groups, each with its Name, rather than mapping names to groups, and drops the
+			// Driver, which could only be aws.
+			Version: 1,
+			Upgrade: func(document migrate.Document) error {
+				if driver, has := document["Driver"]; has {
+					if driver != "aws" {
+						return fmt.Errorf("Driver %v is not supported", driver)
+					}
+					delete(document, "Driver")
+				}
+
+				groups, is := document.Object("Groups")
+				if !is {
+					return nil
+				}
+				names := []string{}
+				for name := range groups {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				list := []interface{}{}
+				for _, name := range names {
+					group, is := groups.Object(name)
+					if !is {
+						return fmt.Errorf("Group %s must be an object", name)
+					}
+					group["Name"] = name
+					list = append(list, map[string]interface{}(group))
+				}
+				document["Groups"] = list
+				return nil
+			},
+		},
+	},
+}
+
+// upgradeClusterSpec upgrades a cluster spec and the instance properties of its groups to their current versions.
+func upgradeClusterSpec(document migrate.Document) error {
+	if err := clusterSchema.UpgradeDocument(document); err != nil {
+		return err
+	}
+
+	groups, _ := document["Groups"].([]interface{})
+	for _, g := range groups {
+		group, is := g.(map[string]interface{})
+		if !is {
+			continue
+		}
+		if config, is := migrate.Document(group).Object("Config"); is {
+			if err := instance.RequestSchema.UpgradeDocument(config); err != nil {
+				return fmt.Errorf("In group %v: %s", group["Name"], err)
+			}
+		}
+	}
+	return nil
+}
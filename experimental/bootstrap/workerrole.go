@@ -0,0 +1,101 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/iamrole"
+	"time"
+)
+
+func (c clusterID) workerRoleName() string {
+	return fmt.Sprintf("%s-WorkerRole", c.name)
+}
+
+func (c clusterID) workerPolicyName() string {
+	return fmt.Sprintf("%s-WorkerPolicy", c.name)
+}
+
+func (c clusterID) workerInstanceProfileName() string {
+	return fmt.Sprintf("%s-WorkerProfile", c.name)
+}
+
+type policyStatement struct {
+	Effect   string
+	Action   []string
+	Resource string
+}
+
+// workerPolicyStatements are the permissions that workers need for the options enabled in the spec.  Managers are
+// granted all permissions by their role.
+func (s *clusterSpec) workerPolicyStatements() []policyStatement {
+	statements := []policyStatement{}
+	if s.Logs != nil {
+		statements = append(statements, policyStatement{
+			Effect:   "Allow",
+			Action:   []string{"logs:CreateLogStream", "logs:PutLogEvents", "logs:DescribeLogStreams"},
+			Resource: fmt.Sprintf("arn:aws:logs:*:*:log-group:%s:*", s.cluster().logGroupName()),
+		})
+	}
+	if s.ECRCredentialHelper {
+		statements = append(statements, policyStatement{
+			Effect: "Allow",
+			Action: []string{
+				"ecr:GetAuthorizationToken",
+				"ecr:BatchCheckLayerAvailability",
+				"ecr:GetDownloadUrlForLayer",
+				"ecr:BatchGetImage",
+			},
+			Resource: "*",
+		})
+	}
+	if s.SSMAccess != nil {
+		statements = append(statements, ssmManagedInstanceStatement)
+	}
+	return statements
+}
+
+// createWorkerRole creates a role with the permissions needed by workers, for worker groups without an instance
+// profile.
+func createWorkerRole(config client.ConfigProvider, spec *clusterSpec) error {
+	statements := spec.workerPolicyStatements()
+
+	needsProfile := false
+	spec.mutateGroups(func(group *instanceGroupSpec) {
+		needsProfile = needsProfile || (!group.isManager() && group.Config.RunInstancesInput.IamInstanceProfile == nil)
+	})
+	if len(statements) == 0 || !needsProfile {
+		return nil
+	}
+
+	log.Info("Creating worker IAM resources")
+	cluster := spec.cluster()
+
+	policy, err := json.Marshal(map[string]interface{}{"Version": "2012-10-17", "Statement": statements})
+	if err != nil {
+		return err
+	}
+
+	profileARN, err := provisionClusterRole(config, cluster, cluster.workerRoleName(), iamrole.CreateRoleRequest{
+		Policies:            map[string]json.RawMessage{cluster.workerPolicyName(): policy},
+		InstanceProfileName: cluster.workerInstanceProfileName(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// As with the manager profile, the profile is not immediately usable once it exists.
+	time.Sleep(10 * time.Second)
+
+	spec.mutateGroups(func(group *instanceGroupSpec) {
+		if !group.isManager() && group.Config.RunInstancesInput.IamInstanceProfile == nil {
+			group.Config.RunInstancesInput.IamInstanceProfile = &ec2.IamInstanceProfileSpecification{
+				Arn: aws.String(profileARN),
+			}
+		}
+	})
+	return nil
+}
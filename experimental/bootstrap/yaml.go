@@ -0,0 +1,46 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/docker/infrakit.aws/plugin/yaml"
+)
+
+// clusterSpecFromYAML converts a YAML cluster spec to JSON.  The groups of the cluster may follow the spec as separate
+// documents, one for each group, which are appended to its Groups.
+func clusterSpecFromYAML(data []byte) ([]byte, error) {
+	documents, err := yaml.Documents(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, errors.New("Config file has no YAML documents")
+	}
+	if len(documents) == 1 {
+		return documents[0], nil
+	}
+
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal(documents[0], &spec); err != nil {
+		return nil, errors.New("The first YAML document must be the cluster spec")
+	}
+
+	groups := []interface{}{}
+	if existing, has := spec["Groups"]; has && existing != nil {
+		list, is := existing.([]interface{})
+		if !is {
+			return nil, errors.New("Groups must be a list when groups are separate YAML documents")
+		}
+		groups = list
+	}
+	for _, document := range documents[1:] {
+		var group interface{}
+		if err := json.Unmarshal(document, &group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	spec["Groups"] = groups
+
+	return json.Marshal(spec)
+}
@@ -0,0 +1,120 @@
+// Package audit records the mutating AWS API calls made by a plugin, for change tracking and postmortems.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"strings"
+	"time"
+)
+
+// Record is an audited API call.
+type Record struct {
+	Time    time.Time
+	Service string
+	Action  string
+
+	// ParamsDigest is the SHA-256 digest of the JSON encoded parameters of the call, which identifies calls made with
+	// the same parameters without recording parameters such as user data.
+	ParamsDigest string
+
+	// Caller is the identity the call was made as.
+	Caller string
+
+	// Result is "ok" for successful calls, or the error code of failed calls.
+	Result string
+
+	// Error is the error message of failed calls.
+	Error string `json:",omitempty"`
+
+	RequestID string
+}
+
+// Sink persists records.
+type Sink interface {
+	Write(record Record) error
+}
+
+// readOnlyPrefixes are the action prefixes of API calls that do not change any resources.
+var readOnlyPrefixes = []string{"Describe", "List", "Get", "Head", "Lookup", "Search", "Query", "Scan", "BatchGet"}
+
+// Mutating determines whether an API action may change resources.
+func Mutating(action string) bool {
+	for _, prefix := range readOnlyPrefixes {
+		if strings.HasPrefix(action, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func digest(params interface{}) string {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// requestID finds the ID AWS assigned to a call, which not all protocols unmarshal from responses.
+func requestID(r *request.Request) string {
+	if r.RequestID != "" {
+		return r.RequestID
+	}
+	if failure, ok := r.Error.(awserr.RequestFailure); ok && failure.RequestID() != "" {
+		return failure.RequestID()
+	}
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Header.Get("X-Amzn-Requestid")
+	}
+	return ""
+}
+
+// Install adds handlers that write a record of each mutating call made with a client's handlers, once the call has
+// succeeded or failed without further retries.  Failures to write records are logged rather than failing calls.
+func Install(handlers *request.Handlers, sink Sink, caller string) {
+	write := func(r *request.Request) {
+		if !Mutating(r.Operation.Name) {
+			return
+		}
+
+		record := Record{
+			Time:         time.Now().UTC(),
+			Service:      r.ClientInfo.ServiceName,
+			Action:       r.Operation.Name,
+			ParamsDigest: digest(r.Params),
+			Caller:       caller,
+			Result:       "ok",
+			RequestID:    requestID(r),
+		}
+		if r.Error != nil {
+			record.Result = "error"
+			if awsErr, ok := r.Error.(awserr.Error); ok {
+				record.Result = awsErr.Code()
+			}
+			record.Error = r.Error.Error()
+		}
+
+		if err := sink.Write(record); err != nil {
+			log.Warnf("Failed to write audit record of %s: %s", record.Action, err)
+		}
+	}
+
+	// Calls that succeed end once their response is unmarshalled, while the error of a failed call is only final
+	// once it will not be retried.
+	handlers.Unmarshal.PushBack(func(r *request.Request) {
+		if r.Error == nil {
+			write(r)
+		}
+	})
+	handlers.AfterRetry.PushBack(func(r *request.Request) {
+		if r.Error != nil {
+			write(r)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recordingSink struct {
+	records []Record
+}
+
+func (r *recordingSink) Write(record Record) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+func TestInstall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		switch r.PostForm.Get("Action") {
+		case "DescribeInstances":
+			w.Header().Set("X-Amzn-Requestid", "req-1")
+			w.Write([]byte(`<DescribeInstancesResponse></DescribeInstancesResponse>`))
+		case "TerminateInstances":
+			w.Header().Set("X-Amzn-Requestid", "req-2")
+			w.Write([]byte(`<TerminateInstancesResponse></TerminateInstancesResponse>`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<Response><Errors><Error><Code>InvalidInstanceID.NotFound</Code>` +
+				`<Message>The instance does not exist</Message></Error></Errors>` +
+				`<RequestID>req-3</RequestID></Response>`))
+		}
+	}))
+	defer server.Close()
+
+	client := ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", ""))))
+	sink := &recordingSink{}
+	Install(&client.Handlers, sink, "arn:aws:iam::123456789012:role/infrakit")
+
+	_, err := client.DescribeInstances(&ec2.DescribeInstancesInput{})
+	require.NoError(t, err)
+
+	terminate := &ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("i-1")}}
+	_, err = client.TerminateInstances(terminate)
+	require.NoError(t, err)
+
+	_, err = client.StopInstances(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String("i-2")}})
+	require.Error(t, err)
+
+	// Read-only calls are not recorded.
+	require.Len(t, sink.records, 2)
+
+	require.Equal(t, "ec2", sink.records[0].Service)
+	require.Equal(t, "TerminateInstances", sink.records[0].Action)
+	require.Equal(t, digest(terminate), sink.records[0].ParamsDigest)
+	require.Equal(t, "arn:aws:iam::123456789012:role/infrakit", sink.records[0].Caller)
+	require.Equal(t, "ok", sink.records[0].Result)
+	require.Equal(t, "req-2", sink.records[0].RequestID)
+
+	require.Equal(t, "StopInstances", sink.records[1].Action)
+	require.Equal(t, "InvalidInstanceID.NotFound", sink.records[1].Result)
+	require.Equal(t, "req-3", sink.records[1].RequestID)
+	require.NotEmpty(t, sink.records[1].Error)
+}
+
+func TestMutating(t *testing.T) {
+	require.True(t, Mutating("RunInstances"))
+	require.True(t, Mutating("PutItem"))
+	require.False(t, Mutating("DescribeInstances"))
+	require.False(t, Mutating("GetItem"))
+	require.False(t, Mutating("ListTagsForResource"))
+}
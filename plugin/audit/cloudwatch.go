@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"sync"
+)
+
+// CloudWatchLogsSink writes records as events of a CloudWatch Logs stream.
+type CloudWatchLogsSink struct {
+	client cloudwatchlogsiface.CloudWatchLogsAPI
+	group  string
+	stream string
+
+	lock          sync.Mutex
+	created       bool
+	sequenceToken *string
+}
+
+// NewCloudWatchLogsSink creates a sink writing to a stream of an existing log group.  The stream is created when the
+// first record is written, if it does not exist.
+func NewCloudWatchLogsSink(client cloudwatchlogsiface.CloudWatchLogsAPI, group, stream string) *CloudWatchLogsSink {
+	return &CloudWatchLogsSink{client: client, group: group, stream: stream}
+}
+
+func (c *CloudWatchLogsSink) createStream() error {
+	_, err := c.client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(c.group),
+		LogStreamName: aws.String(c.stream),
+	})
+	if err == nil {
+		return nil
+	}
+	if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != "ResourceAlreadyExistsException" {
+		return err
+	}
+
+	// The stream was created by an earlier process, and events can only be added after its last event.
+	streams, err := c.client.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(c.group),
+		LogStreamNamePrefix: aws.String(c.stream),
+	})
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams.LogStreams {
+		if aws.StringValue(stream.LogStreamName) == c.stream {
+			c.sequenceToken = stream.UploadSequenceToken
+		}
+	}
+	return nil
+}
+
+// Write implements Sink.Write.
+func (c *CloudWatchLogsSink) Write(record Record) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.created {
+		if err := c.createStream(); err != nil {
+			return err
+		}
+		c.created = true
+	}
+
+	result, err := c.client.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(c.group),
+		LogStreamName: aws.String(c.stream),
+		SequenceToken: c.sequenceToken,
+		LogEvents: []*cloudwatchlogs.InputLogEvent{{
+			Message:   aws.String(string(encoded)),
+			Timestamp: aws.Int64(record.Time.UnixNano() / 1e6),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	c.sequenceToken = result.NextSequenceToken
+	return nil
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink appends records to a local file as JSON, one record per line.
+type FileSink struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens a file for appending records, creating it if it does not exist.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write implements Sink.Write.
+func (f *FileSink) Write(record Record) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_, err = f.file.Write(append(encoded, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (f *FileSink) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,133 @@
+// Package awserrors classifies the errors of AWS API calls by how they should be handled, so that every operation
+// retries, falls back, or fails on the same errors.
+package awserrors
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// DefaultMaxRetries is the number of retries of a call, matching the default of the SDK.
+const DefaultMaxRetries = 3
+
+// Behavior is how the error of a call should be handled.
+type Behavior int
+
+const (
+	// Fail is the behavior of errors that are not classified, which are handled as the SDK handles them by default.
+	Fail Behavior = iota
+
+	// Retry is the behavior of transient errors, such as throttling, internal errors, and resources that are not yet
+	// visible after being created, which are retried with a backoff.
+	Retry
+
+	// Fallback is the behavior of errors caused by a lack of capacity, which are not retried, but may not occur with
+	// another instance type or availability zone.
+	Fallback
+
+	// FailFast is the behavior of errors that no retry or fallback resolves, such as missing permissions, which are
+	// returned immediately.
+	FailFast
+)
+
+func (b Behavior) String() string {
+	switch b {
+	case Retry:
+		return "retry"
+	case Fallback:
+		return "fallback"
+	case FailFast:
+		return "fail-fast"
+	}
+	return "fail"
+}
+
+var (
+	// eventuallyConsistent are codes of resources that may not be found immediately after being created, since EC2
+	// is eventually consistent.
+	eventuallyConsistent = map[string]bool{
+		"InvalidInstanceID.NotFound":         true,
+		"InvalidNetworkInterfaceID.NotFound": true,
+		"InvalidVolume.NotFound":             true,
+		"InvalidGroup.NotFound":              true,
+		"InvalidSubnetID.NotFound":           true,
+		"InvalidAllocationID.NotFound":       true,
+	}
+
+	behaviors = map[string]Behavior{
+		"RequestLimitExceeded":                   Retry,
+		"Throttling":                             Retry,
+		"ThrottlingException":                    Retry,
+		"RequestThrottled":                       Retry,
+		"TooManyRequestsException":               Retry,
+		"ProvisionedThroughputExceededException": Retry,
+		"InternalError":                          Retry,
+		"InternalFailure":                        Retry,
+		"ServiceUnavailable":                     Retry,
+		"Unavailable":                            Retry,
+		"RequestError":                           Retry,
+		"RequestTimeout":                         Retry,
+
+		"InsufficientInstanceCapacity":         Fallback,
+		"InsufficientHostCapacity":             Fallback,
+		"InsufficientReservedInstanceCapacity": Fallback,
+		"InsufficientCapacity":                 Fallback,
+		"Unsupported":                          Fallback,
+		"SpotMaxPriceTooLow":                   Fallback,
+
+		"UnauthorizedOperation": FailFast,
+		"AuthFailure":           FailFast,
+		"AccessDenied":          FailFast,
+		"AccessDeniedException": FailFast,
+		"InvalidClientTokenId":  FailFast,
+		"SignatureDoesNotMatch": FailFast,
+		"OptInRequired":         FailFast,
+		"Blocked":               FailFast,
+		"PendingVerification":   FailFast,
+	}
+)
+
+// Code returns the AWS error code of an error, or an empty string if it is not an AWS error.
+func Code(err error) string {
+	if awsErr, is := err.(awserr.Error); is {
+		return awsErr.Code()
+	}
+	return ""
+}
+
+// Classify determines how an error should be handled.
+func Classify(err error) Behavior {
+	code := Code(err)
+	if eventuallyConsistent[code] {
+		return Retry
+	}
+	return behaviors[code]
+}
+
+// NotYetVisible determines whether an error may be caused by a resource that was created, but is not yet visible.
+func NotYetVisible(err error) bool {
+	return eventuallyConsistent[Code(err)]
+}
+
+// Retryer retries calls according to the classification of their errors, with the backoff of the SDK.  Errors that
+// are not classified are retried as the SDK retries them by default.
+type Retryer struct {
+	client.DefaultRetryer
+}
+
+// NewRetryer creates a retryer that retries each call up to a number of times.
+func NewRetryer(maxRetries int) Retryer {
+	return Retryer{DefaultRetryer: client.DefaultRetryer{NumMaxRetries: maxRetries}}
+}
+
+// ShouldRetry implements request.Retryer.ShouldRetry.
+func (r Retryer) ShouldRetry(req *request.Request) bool {
+	switch Classify(req.Error) {
+	case Retry:
+		return true
+	case Fallback, FailFast:
+		return false
+	}
+	return r.DefaultRetryer.ShouldRetry(req)
+}
@@ -0,0 +1,47 @@
+package awserrors
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	require.Equal(t, Retry, Classify(awserr.New("InvalidInstanceID.NotFound", "not found", nil)))
+	require.Equal(t, Retry, Classify(awserr.New("RequestLimitExceeded", "slow down", nil)))
+	require.Equal(t, Fallback, Classify(awserr.New("InsufficientInstanceCapacity", "no capacity", nil)))
+	require.Equal(t, FailFast, Classify(awserr.New("UnauthorizedOperation", "denied", nil)))
+	require.Equal(t, Fail, Classify(awserr.New("InvalidAMIID.Malformed", "malformed", nil)))
+	require.Equal(t, Fail, Classify(errors.New("not an AWS error")))
+	require.Equal(t, Fail, Classify(nil))
+
+	require.True(t, NotYetVisible(awserr.New("InvalidVolume.NotFound", "not found", nil)))
+	require.False(t, NotYetVisible(awserr.New("RequestLimitExceeded", "slow down", nil)))
+	require.Equal(t, "fail-fast", FailFast.String())
+}
+
+func TestRetryer(t *testing.T) {
+	retryer := NewRetryer(5)
+	require.Equal(t, 5, retryer.MaxRetries())
+
+	failed := func(statusCode int, code string) *request.Request {
+		return &request.Request{
+			HTTPResponse: &http.Response{StatusCode: statusCode},
+			Error:        awserr.NewRequestFailure(awserr.New(code, code, nil), statusCode, ""),
+		}
+	}
+
+	require.True(t, retryer.ShouldRetry(failed(400, "InvalidInstanceID.NotFound")))
+	require.True(t, retryer.ShouldRetry(failed(503, "RequestLimitExceeded")))
+
+	// EC2 reports insufficient capacity as a server error, which is not retried since it falls back instead.
+	require.False(t, retryer.ShouldRetry(failed(500, "InsufficientInstanceCapacity")))
+	require.False(t, retryer.ShouldRetry(failed(403, "UnauthorizedOperation")))
+
+	// Errors that are not classified are retried by default.
+	require.True(t, retryer.ShouldRetry(failed(500, "SomethingElse")))
+	require.False(t, retryer.ShouldRetry(failed(400, "InvalidAMIID.Malformed")))
+}
@@ -0,0 +1,152 @@
+// Package fault injects errors, throttling, latency, and lost responses into AWS API calls, for testing how plugins
+// behave when the API misbehaves.  Faults are injected by wrapping the send handlers of SDK clients or requests, so
+// they apply to any client implementing the SDK's service interfaces, such as ec2iface.EC2API.
+package fault
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Fault is a kind of injected fault.
+type Fault string
+
+const (
+	// Error fails calls with a retryable internal error, before they are sent.
+	Error Fault = "error"
+
+	// Throttle fails calls with a throttling error, before they are sent.
+	Throttle Fault = "throttle"
+
+	// LostResponse sends calls, but fails them with a connection error as if the response was lost.  The call takes
+	// effect even though the caller sees it fail.
+	LostResponse Fault = "lost-response"
+)
+
+// Config sets the rates of faults, each the probability from 0 to 1 that a call attempt has the fault.
+type Config struct {
+	ErrorRate        float64
+	ThrottleRate     float64
+	LostResponseRate float64
+
+	// Latency delays every call attempt.
+	Latency time.Duration
+
+	// Actions limits faults to the named API actions, such as RunInstances.  Faults apply to all actions if empty.
+	Actions []string
+
+	// Seed seeds the choice of faults, making them repeatable.
+	Seed int64
+}
+
+// Injector injects faults into the API calls of the handlers it is installed in.
+type Injector struct {
+	config Config
+
+	lock     sync.Mutex
+	random   *rand.Rand
+	injected map[Fault]int
+}
+
+// New creates an injector.
+func New(config Config) *Injector {
+	return &Injector{config: config, random: rand.New(rand.NewSource(config.Seed)), injected: map[Fault]int{}}
+}
+
+// Injected returns the number of faults of each kind injected so far.
+func (i *Injector) Injected() map[Fault]int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	injected := map[Fault]int{}
+	for fault, count := range i.injected {
+		injected[fault] = count
+	}
+	return injected
+}
+
+func (i *Injector) applies(action string) bool {
+	if len(i.config.Actions) == 0 {
+		return true
+	}
+	for _, a := range i.config.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// choose picks the fault of a call attempt, if any.
+func (i *Injector) choose(action string) (Fault, bool) {
+	if !i.applies(action) {
+		return "", false
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	roll := i.random.Float64()
+	for _, candidate := range []struct {
+		fault Fault
+		rate  float64
+	}{
+		{Error, i.config.ErrorRate},
+		{Throttle, i.config.ThrottleRate},
+		{LostResponse, i.config.LostResponseRate},
+	} {
+		if roll < candidate.rate {
+			i.injected[candidate.fault]++
+			return candidate.fault, true
+		}
+		roll -= candidate.rate
+	}
+	return "", false
+}
+
+// fail fails a call attempt with an error response that was never sent.
+func fail(r *request.Request, statusCode int, err awserr.Error) {
+	r.HTTPResponse = &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}
+	r.Error = awserr.NewRequestFailure(err, statusCode, "")
+}
+
+// Install wraps the send handlers of a client or request with fault injection.  Faults are chosen for each attempt,
+// so the SDK's retries apply to them.
+func (i *Injector) Install(handlers *request.Handlers) {
+	send := handlers.Send
+	handlers.Send.Clear()
+	handlers.Send.PushBackNamed(request.NamedHandler{Name: "fault.SendHandler", Fn: func(r *request.Request) {
+		if i.config.Latency > 0 {
+			time.Sleep(i.config.Latency)
+		}
+
+		fault, inject := i.choose(r.Operation.Name)
+		switch {
+		case !inject:
+			send.Run(r)
+		case fault == Error:
+			fail(r, http.StatusInternalServerError, awserr.New("InternalError", "Injected internal error", nil))
+		case fault == Throttle:
+			fail(r, http.StatusBadRequest, awserr.New("Throttling", "Injected throttling", nil))
+		case fault == LostResponse:
+			send.Run(r)
+			if r.Error == nil {
+				r.Error = awserr.New(
+					"RequestError",
+					"send request failed",
+					errors.New("injected connection reset after the request was sent"))
+			}
+		}
+	}})
+}
@@ -0,0 +1,90 @@
+package fault
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func testClient(t *testing.T, retries int) (*ec2.EC2, *int32, func()) {
+	sent := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		w.Write([]byte(`<StopInstancesResponse></StopInstancesResponse>`))
+	}))
+
+	client := ec2.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithMaxRetries(retries).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", ""))))
+	return client, &sent, server.Close
+}
+
+func stop(client *ec2.EC2) error {
+	_, err := client.StopInstances(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String("i-1")}})
+	return err
+}
+
+func TestThrottleIsRetried(t *testing.T) {
+	client, sent, done := testClient(t, 3)
+	defer done()
+
+	injector := New(Config{ThrottleRate: 1})
+	injector.Install(&client.Handlers)
+
+	err := stop(client)
+	require.Error(t, err)
+	require.Equal(t, "Throttling", err.(awserr.Error).Code())
+	require.Equal(t, int32(0), *sent)
+	require.Equal(t, map[Fault]int{Throttle: 4}, injector.Injected())
+}
+
+func TestLostResponseTakesEffect(t *testing.T) {
+	client, sent, done := testClient(t, 0)
+	defer done()
+
+	injector := New(Config{LostResponseRate: 1})
+	injector.Install(&client.Handlers)
+
+	err := stop(client)
+	require.Error(t, err)
+	require.Equal(t, "RequestError", err.(awserr.Error).Code())
+	require.Equal(t, int32(1), *sent)
+}
+
+func TestActions(t *testing.T) {
+	client, sent, done := testClient(t, 0)
+	defer done()
+
+	injector := New(Config{ErrorRate: 1, Actions: []string{"RunInstances"}})
+	injector.Install(&client.Handlers)
+
+	require.NoError(t, stop(client))
+	require.Equal(t, int32(1), *sent)
+	require.Empty(t, injector.Injected())
+}
+
+func TestRates(t *testing.T) {
+	client, _, done := testClient(t, 0)
+	defer done()
+
+	injector := New(Config{ErrorRate: 0.5, Seed: 1})
+	injector.Install(&client.Handlers)
+
+	failures := 0
+	for i := 0; i < 100; i++ {
+		if stop(client) != nil {
+			failures++
+		}
+	}
+	require.Equal(t, failures, injector.Injected()[Error])
+	require.InDelta(t, 50, failures, 20)
+}
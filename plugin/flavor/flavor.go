@@ -0,0 +1,63 @@
+// Package flavor contains flavor plugins that configure instances for a clustering system running in AWS.  A flavor
+// renders the boot script of instances provisioned by the instance plugin, and determines the health of the instances
+// from the clustering system's point of view.
+package flavor
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	awsinstance "github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit/spi/instance"
+)
+
+// Health is the health of an instance, as determined by a flavor.
+type Health int
+
+const (
+	// Unknown indicates that the health of an instance cannot be determined, such as while it is booting.
+	Unknown Health = iota
+
+	// Healthy indicates that an instance is a functioning member of the cluster.
+	Healthy
+
+	// Unhealthy indicates that an instance should be replaced.
+	Unhealthy
+)
+
+// severity orders health from the least to the most severe.
+var severity = map[Health]int{Healthy: 0, Unknown: 1, Unhealthy: 2}
+
+// Worst returns the most severe of healths: Unhealthy if any is, otherwise Unknown if any is, otherwise Healthy.
+func Worst(healths ...Health) Health {
+	worst := Healthy
+	for _, health := range healths {
+		if severity[health] > severity[worst] {
+			worst = health
+		}
+	}
+	return worst
+}
+
+// InstanceHealth determines the health of an instance from the health sources that the instance plugin reports in
+// its description, its target health and EC2 status checks.  An instance without health sources is Healthy, leaving
+// its health to the clustering system.
+func InstanceHealth(inst instance.Description) Health {
+	health := Healthy
+	switch inst.Tags[awsinstance.TargetHealthTag] {
+	case "", elbv2.TargetHealthStateEnumHealthy, elbv2.TargetHealthStateEnumUnused:
+	case elbv2.TargetHealthStateEnumUnhealthy:
+		return Unhealthy
+	default:
+		// Targets that are being registered or are draining cannot be judged.
+		health = Unknown
+	}
+
+	switch inst.Tags[awsinstance.StatusChecksTag] {
+	case "", ec2.SummaryStatusOk:
+	case ec2.SummaryStatusImpaired:
+		return Unhealthy
+	default:
+		health = Unknown
+	}
+	return health
+}
@@ -0,0 +1,93 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// node is the subset of a Kubernetes node used to determine health.
+type node struct {
+	Status struct {
+		Addresses []struct {
+			Type    string `json:"type"`
+			Address string `json:"address"`
+		} `json:"addresses"`
+
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+func (n node) hasAddress(ip string) bool {
+	for _, address := range n.Status.Addresses {
+		if address.Type == "InternalIP" && address.Address == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// kubernetesAPI is a minimal client of the Kubernetes API server.
+type kubernetesAPI struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+func newKubernetesAPI(apiServer, token, caFile string) (*kubernetesAPI, error) {
+	transport := &http.Transport{}
+	if caFile != "" {
+		caData, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA certificate: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("No certificates found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &kubernetesAPI{
+		client:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		baseURL: strings.TrimSuffix(apiServer, "/"),
+		token:   token,
+	}, nil
+}
+
+func (k *kubernetesAPI) nodes() ([]node, error) {
+	req, err := http.NewRequest("GET", k.baseURL+"/api/v1/nodes", nil)
+	if err != nil {
+		return nil, err
+	}
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to list nodes: %s", resp.Status)
+	}
+
+	list := struct {
+		Items []node `json:"items"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,303 @@
+// Package kubernetes provides a flavor that joins instances to a Kubernetes cluster with kubeadm.  Join credentials
+// are exchanged through the SSM parameter store: the first control plane node initializes the cluster and stores a
+// bootstrap token, the CA certificate hash, and the certificate key, which other nodes read as they boot.
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/flavor"
+	"github.com/docker/infrakit/spi/instance"
+	"strings"
+	"text/template"
+)
+
+const (
+	// TypeTag is the AWS tag name used to record whether an instance is a control plane or worker node.
+	TypeTag = "infrakit.kubernetes.type"
+
+	controlPlaneType = "control-plane"
+	workerType       = "worker"
+)
+
+// Spec is the flavor configuration of a group.
+type Spec struct {
+	// Type is the role of instances in the cluster, either control-plane or worker.
+	Type string
+
+	// ClusterName identifies the cluster to the AWS cloud provider, which requires that instances are tagged with
+	// kubernetes.io/cluster/<ClusterName>.
+	ClusterName string
+
+	// ControlPlaneIPs are the private IP addresses of the control plane nodes.  Control plane nodes are provisioned
+	// with their IP address as the logical ID, following the addressing scheme of the instance plugin.  The first
+	// node initializes the cluster.
+	ControlPlaneIPs []string
+
+	// ControlPlaneEndpoint is the address of the API server used by nodes to join, such as the DNS name of a load
+	// balancer.  Defaults to the first of ControlPlaneIPs.
+	ControlPlaneEndpoint string `json:",omitempty"`
+
+	// ParameterPath is the SSM parameter path under which join credentials are stored, such as
+	// /infrakit/cluster/kubernetes.
+	ParameterPath string
+
+	// KubernetesVersion is the version installed by kubeadm, defaulting to the version of kubeadm on the image.
+	KubernetesVersion string `json:",omitempty"`
+
+	// PodNetworkCIDR is the range of pod IP addresses, required by some network add-ons.
+	PodNetworkCIDR string `json:",omitempty"`
+}
+
+func parseSpec(flavorProperties json.RawMessage) (Spec, error) {
+	spec := Spec{}
+	if err := json.Unmarshal(flavorProperties, &spec); err != nil {
+		return spec, fmt.Errorf("Invalid flavor properties: %s", err)
+	}
+
+	if spec.ControlPlaneEndpoint == "" && len(spec.ControlPlaneIPs) > 0 {
+		spec.ControlPlaneEndpoint = spec.ControlPlaneIPs[0]
+	}
+	spec.ParameterPath = strings.TrimSuffix(spec.ParameterPath, "/")
+	return spec, nil
+}
+
+// Flavor configures instances as Kubernetes control plane and worker nodes.
+type Flavor struct {
+	nodes func() ([]node, error)
+}
+
+// NewFlavor creates a flavor that checks the readiness of nodes with the Kubernetes API server.  The API server is
+// authenticated with a bearer token, and verified with a CA certificate file if one is given.
+func NewFlavor(apiServer, token, caFile string) (*Flavor, error) {
+	api, err := newKubernetesAPI(apiServer, token, caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Flavor{nodes: api.nodes}, nil
+}
+
+// Validate checks the flavor configuration of a group.
+func (f *Flavor) Validate(flavorProperties json.RawMessage) error {
+	spec, err := parseSpec(flavorProperties)
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	if spec.Type != controlPlaneType && spec.Type != workerType {
+		errs = append(errs, fmt.Sprintf("Type must be %s or %s", controlPlaneType, workerType))
+	}
+	if spec.ClusterName == "" {
+		errs = append(errs, "ClusterName must be set")
+	}
+	if len(spec.ControlPlaneIPs) == 0 {
+		errs = append(errs, "ControlPlaneIPs must be set")
+	}
+	if !strings.HasPrefix(spec.ParameterPath, "/") {
+		errs = append(errs, "ParameterPath must be an absolute SSM parameter path")
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// Prepare adds the kubeadm boot script to an instance, and tags the instance for the AWS cloud provider.  Control
+// plane nodes must be provisioned with one of the ControlPlaneIPs as the logical ID.
+func (f *Flavor) Prepare(flavorProperties json.RawMessage, spec instance.Spec) (instance.Spec, error) {
+	kubeSpec, err := parseSpec(flavorProperties)
+	if err != nil {
+		return spec, err
+	}
+
+	params := map[string]interface{}{
+		"Spec":         kubeSpec,
+		"ControlPlane": kubeSpec.Type == controlPlaneType,
+		"Leader":       false,
+	}
+
+	if kubeSpec.Type == controlPlaneType {
+		if spec.LogicalID == nil || !contains(kubeSpec.ControlPlaneIPs, string(*spec.LogicalID)) {
+			return spec, errors.New("Control plane nodes must be provisioned with one of ControlPlaneIPs as the logical ID")
+		}
+		params["IP"] = string(*spec.LogicalID)
+		params["Leader"] = string(*spec.LogicalID) == kubeSpec.ControlPlaneIPs[0]
+	}
+
+	buffer := bytes.Buffer{}
+	if err := bootScript.Execute(&buffer, params); err != nil {
+		return spec, err
+	}
+
+	if spec.Init != "" {
+		buffer.WriteString("\n")
+		buffer.WriteString(spec.Init)
+	}
+	spec.Init = buffer.String()
+
+	tags := map[string]string{}
+	for k, v := range spec.Tags {
+		tags[k] = v
+	}
+	tags[TypeTag] = kubeSpec.Type
+	tags[fmt.Sprintf("kubernetes.io/cluster/%s", kubeSpec.ClusterName)] = "owned"
+	spec.Tags = tags
+
+	return spec, nil
+}
+
+// Healthy determines the health of an instance from the Ready condition of its node, and from the health sources in
+// its description.  Nodes are matched to instances by private IP address.
+func (f *Flavor) Healthy(flavorProperties json.RawMessage, inst instance.Description) (flavor.Health, error) {
+	health, err := f.clusterHealth(inst)
+	if err != nil {
+		return flavor.Unknown, err
+	}
+	return flavor.Worst(health, flavor.InstanceHealth(inst)), nil
+}
+
+func (f *Flavor) clusterHealth(inst instance.Description) (flavor.Health, error) {
+	if inst.LogicalID == nil {
+		return flavor.Unknown, nil
+	}
+
+	nodes, err := f.nodes()
+	if err != nil {
+		return flavor.Unknown, err
+	}
+
+	for _, n := range nodes {
+		if !n.hasAddress(string(*inst.LogicalID)) {
+			continue
+		}
+
+		for _, condition := range n.Status.Conditions {
+			if condition.Type != "Ready" {
+				continue
+			}
+
+			switch condition.Status {
+			case "True":
+				return flavor.Healthy, nil
+			case "False":
+				return flavor.Unhealthy, nil
+			}
+		}
+	}
+
+	// The instance has not yet registered as a node, or its kubelet has stopped reporting.
+	return flavor.Unknown, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var bootScript = template.Must(template.New("kubeadm").Parse(`#!/bin/bash
+set -o errexit
+set -o nounset
+set -o xtrace
+
+metadata=http://169.254.169.254/latest/meta-data
+export AWS_DEFAULT_REGION=$(curl -s $metadata/placement/availability-zone | sed 's/.$//')
+
+# The AWS cloud provider requires nodes to be named after their private DNS name.
+node_name=$(curl -s $metadata/local-hostname)
+
+get_param () {
+  aws ssm get-parameter --with-decryption --name "{{.Spec.ParameterPath}}/$1" --query Parameter.Value --output text
+}
+
+put_param () {
+  aws ssm put-parameter --type SecureString --overwrite --name "{{.Spec.ParameterPath}}/$1" --value "$2"
+}
+
+mkdir -p /etc/kubernetes
+
+if [ -f /etc/kubernetes/kubelet.conf ]
+then
+  echo 'Already a member of the cluster'
+  exit 0
+fi
+{{if .Leader}}
+if ! get_param token > /dev/null
+then
+  cat << EOF > /etc/kubernetes/kubeadm.yaml
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: InitConfiguration
+localAPIEndpoint:
+  advertiseAddress: {{.IP}}
+nodeRegistration:
+  name: $node_name
+  kubeletExtraArgs:
+    cloud-provider: aws
+---
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+clusterName: {{.Spec.ClusterName}}
+controlPlaneEndpoint: {{.Spec.ControlPlaneEndpoint}}:6443
+{{- if .Spec.KubernetesVersion}}
+kubernetesVersion: {{.Spec.KubernetesVersion}}
+{{- end}}
+{{- if .Spec.PodNetworkCIDR}}
+networking:
+  podSubnet: {{.Spec.PodNetworkCIDR}}
+{{- end}}
+apiServer:
+  extraArgs:
+    cloud-provider: aws
+controllerManager:
+  extraArgs:
+    cloud-provider: aws
+EOF
+
+  kubeadm init --config /etc/kubernetes/kubeadm.yaml --upload-certs
+
+  put_param token "$(kubeadm token create --ttl 0)"
+  put_param ca-cert-hash "sha256:$(openssl x509 -pubkey -in /etc/kubernetes/pki/ca.crt \
+    | openssl rsa -pubin -outform der 2>/dev/null | openssl dgst -sha256 -hex | sed 's/^.* //')"
+  put_param certificate-key "$(kubeadm init phase upload-certs --upload-certs | tail -1)"
+  exit 0
+fi
+{{end}}
+until token=$(get_param token) && ca_cert_hash=$(get_param ca-cert-hash)
+do
+  echo 'Waiting for the cluster join credentials'
+  sleep 10
+done
+{{- if .ControlPlane}}
+certificate_key=$(get_param certificate-key)
+{{- end}}
+
+cat << EOF > /etc/kubernetes/kubeadm.yaml
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: JoinConfiguration
+discovery:
+  bootstrapToken:
+    apiServerEndpoint: {{.Spec.ControlPlaneEndpoint}}:6443
+    token: $token
+    caCertHashes:
+    - $ca_cert_hash
+nodeRegistration:
+  name: $node_name
+  kubeletExtraArgs:
+    cloud-provider: aws
+{{- if .ControlPlane}}
+controlPlane:
+  localAPIEndpoint:
+    advertiseAddress: {{.IP}}
+  certificateKey: $certificate_key
+{{- end}}
+EOF
+
+kubeadm join --config /etc/kubernetes/kubeadm.yaml
+`))
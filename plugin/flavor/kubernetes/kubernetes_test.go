@@ -0,0 +1,101 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/flavor"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func properties(nodeType string) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{
+	    "Type": "%s",
+	    "ClusterName": "test",
+	    "ControlPlaneIPs": ["192.168.33.4", "192.168.33.5", "192.168.33.6"],
+	    "ParameterPath": "/infrakit/test/kubernetes/"
+	}`, nodeType))
+}
+
+func TestValidate(t *testing.T) {
+	f := &Flavor{}
+	require.NoError(t, f.Validate(properties(controlPlaneType)))
+	require.NoError(t, f.Validate(properties(workerType)))
+	require.Error(t, f.Validate(properties("other")))
+	require.Error(t, f.Validate(json.RawMessage(`{"Type": "worker"}`)))
+}
+
+func TestPrepareControlPlane(t *testing.T) {
+	f := &Flavor{}
+
+	leaderID := instance.LogicalID("192.168.33.4")
+	leader, err := f.Prepare(properties(controlPlaneType), instance.Spec{LogicalID: &leaderID})
+	require.NoError(t, err)
+	require.Contains(t, leader.Init, "kubeadm init --config /etc/kubernetes/kubeadm.yaml --upload-certs")
+	require.Contains(t, leader.Init, "controlPlaneEndpoint: 192.168.33.4:6443")
+	require.Contains(t, leader.Init, `--name "/infrakit/test/kubernetes/$1"`)
+	require.Contains(t, leader.Init, "cloud-provider: aws")
+	require.Equal(t, map[string]string{
+		TypeTag:                      controlPlaneType,
+		"kubernetes.io/cluster/test": "owned",
+	}, leader.Tags)
+
+	otherID := instance.LogicalID("192.168.33.5")
+	other, err := f.Prepare(properties(controlPlaneType), instance.Spec{LogicalID: &otherID})
+	require.NoError(t, err)
+	require.NotContains(t, other.Init, "kubeadm init")
+	require.Contains(t, other.Init, "certificateKey: $certificate_key")
+	require.Contains(t, other.Init, "advertiseAddress: 192.168.33.5")
+
+	unknownID := instance.LogicalID("10.0.0.1")
+	_, err = f.Prepare(properties(controlPlaneType), instance.Spec{LogicalID: &unknownID})
+	require.Error(t, err)
+}
+
+func TestPrepareWorker(t *testing.T) {
+	f := &Flavor{}
+
+	worker, err := f.Prepare(properties(workerType), instance.Spec{Init: "echo hello"})
+	require.NoError(t, err)
+	require.NotContains(t, worker.Init, "kubeadm init")
+	require.NotContains(t, worker.Init, "controlPlane:")
+	require.Contains(t, worker.Init, "apiServerEndpoint: 192.168.33.4:6443")
+	require.Contains(t, worker.Init, "echo hello")
+}
+
+func TestHealthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/nodes", r.URL.Path)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"items": [
+		    {"status": {
+		        "addresses": [{"type": "InternalIP", "address": "10.0.0.1"}],
+		        "conditions": [{"type": "Ready", "status": "True"}]}},
+		    {"status": {
+		        "addresses": [{"type": "InternalIP", "address": "10.0.0.2"}],
+		        "conditions": [{"type": "Ready", "status": "False"}]}},
+		    {"status": {
+		        "addresses": [{"type": "InternalIP", "address": "10.0.0.3"}],
+		        "conditions": [{"type": "Ready", "status": "Unknown"}]}}
+		]}`))
+	}))
+	defer server.Close()
+
+	f, err := NewFlavor(server.URL, "secret", "")
+	require.NoError(t, err)
+
+	health := func(ip string) flavor.Health {
+		logicalID := instance.LogicalID(ip)
+		h, err := f.Healthy(properties(workerType), instance.Description{LogicalID: &logicalID})
+		require.NoError(t, err)
+		return h
+	}
+
+	require.Equal(t, flavor.Healthy, health("10.0.0.1"))
+	require.Equal(t, flavor.Unhealthy, health("10.0.0.2"))
+	require.Equal(t, flavor.Unknown, health("10.0.0.3"))
+	require.Equal(t, flavor.Unknown, health("10.0.0.4"))
+}
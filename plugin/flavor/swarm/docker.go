@@ -0,0 +1,73 @@
+package swarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// node is the subset of a swarm node in the Docker API used to determine health.
+type node struct {
+	Status struct {
+		State string
+		Addr  string
+	}
+
+	ManagerStatus *struct {
+		Reachability string
+	}
+}
+
+// dockerAPI is a minimal client of the Docker engine API.
+type dockerAPI struct {
+	client  *http.Client
+	baseURL string
+}
+
+func newDockerAPI(host string) (*dockerAPI, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Docker host %s: %s", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		return &dockerAPI{
+			client: &http.Client{
+				Timeout: 10 * time.Second,
+				Transport: &http.Transport{
+					Dial: func(network, addr string) (net.Conn, error) {
+						return net.Dial("unix", socket)
+					},
+				},
+			},
+			baseURL: "http://docker",
+		}, nil
+	case "tcp", "http":
+		return &dockerAPI{client: &http.Client{Timeout: 10 * time.Second}, baseURL: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported Docker host %s", host)
+	}
+}
+
+func (d *dockerAPI) nodes() ([]node, error) {
+	resp, err := d.client.Get(d.baseURL + "/nodes")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to list swarm nodes: %s", resp.Status)
+	}
+
+	nodes := []node{}
+	if err := json.NewDecoder(resp.Body).Decode(&nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
@@ -0,0 +1,258 @@
+// Package swarm provides a flavor that joins instances to a Docker Swarm.  Join tokens are exchanged through the SSM
+// parameter store: the first manager initializes the swarm and stores the tokens, which other nodes read as they boot.
+package swarm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/flavor"
+	"github.com/docker/infrakit/spi/instance"
+	"strings"
+	"text/template"
+)
+
+const (
+	// TypeTag is the AWS tag name used to record whether an instance is a swarm manager or worker.
+	TypeTag = "infrakit.swarm.type"
+
+	managerType = "manager"
+	workerType  = "worker"
+
+	defaultEngineInstallURL = "https://get.docker.com"
+)
+
+// Spec is the flavor configuration of a group.
+type Spec struct {
+	// Type is the role of instances in the swarm, either manager or worker.
+	Type string
+
+	// ManagerIPs are the private IP addresses of the managers.  Managers are provisioned with their IP address as
+	// the logical ID, following the addressing scheme of the instance plugin.  The first manager initializes the
+	// swarm.
+	ManagerIPs []string
+
+	// JoinAddress is the address of a load balancer in front of the managers, such as manager-lb:2377.  When set,
+	// instances join the swarm through the load balancer before trying each of ManagerIPs.
+	JoinAddress string `json:",omitempty"`
+
+	// ParameterPath is the SSM parameter path under which join tokens are stored, such as /infrakit/cluster/swarm.
+	ParameterPath string
+
+	// EngineInstallURL is a script that installs the Docker engine on images that do not include it.
+	EngineInstallURL string `json:",omitempty"`
+
+	// DockerRestartCommand restarts the Docker engine, and is run after the engine is installed.
+	DockerRestartCommand string `json:",omitempty"`
+}
+
+func parseSpec(flavorProperties json.RawMessage) (Spec, error) {
+	spec := Spec{}
+	if err := json.Unmarshal(flavorProperties, &spec); err != nil {
+		return spec, fmt.Errorf("Invalid flavor properties: %s", err)
+	}
+
+	if spec.EngineInstallURL == "" {
+		spec.EngineInstallURL = defaultEngineInstallURL
+	}
+	return spec, nil
+}
+
+// Flavor configures instances as swarm managers and workers.
+type Flavor struct {
+	nodes func() ([]node, error)
+}
+
+// NewFlavor creates a flavor that checks the health of instances with the Docker API of a manager, such as
+// unix:///var/run/docker.sock when the flavor runs on a manager.
+func NewFlavor(dockerHost string) (*Flavor, error) {
+	docker, err := newDockerAPI(dockerHost)
+	if err != nil {
+		return nil, err
+	}
+	return &Flavor{nodes: docker.nodes}, nil
+}
+
+// Validate checks the flavor configuration of a group.
+func (f *Flavor) Validate(flavorProperties json.RawMessage) error {
+	spec, err := parseSpec(flavorProperties)
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	if spec.Type != managerType && spec.Type != workerType {
+		errs = append(errs, fmt.Sprintf("Type must be %s or %s", managerType, workerType))
+	}
+	if len(spec.ManagerIPs) == 0 {
+		errs = append(errs, "ManagerIPs must be set")
+	}
+	if !strings.HasPrefix(spec.ParameterPath, "/") {
+		errs = append(errs, "ParameterPath must be an absolute SSM parameter path")
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// Prepare adds the swarm boot script to an instance.  Managers must be provisioned with one of the ManagerIPs as the
+// logical ID.
+func (f *Flavor) Prepare(flavorProperties json.RawMessage, spec instance.Spec) (instance.Spec, error) {
+	swarmSpec, err := parseSpec(flavorProperties)
+	if err != nil {
+		return spec, err
+	}
+
+	params := map[string]interface{}{
+		"Spec":       swarmSpec,
+		"Manager":    swarmSpec.Type == managerType,
+		"Leader":     false,
+		"JoinAddrs":  joinAddrs(swarmSpec.JoinAddress, swarmSpec.ManagerIPs),
+		"TokenParam": fmt.Sprintf("%s/%s-token", strings.TrimSuffix(swarmSpec.ParameterPath, "/"), swarmSpec.Type),
+		"Path":       strings.TrimSuffix(swarmSpec.ParameterPath, "/"),
+	}
+
+	if swarmSpec.Type == managerType {
+		if spec.LogicalID == nil || !contains(swarmSpec.ManagerIPs, string(*spec.LogicalID)) {
+			return spec, errors.New("Managers must be provisioned with one of ManagerIPs as the logical ID")
+		}
+		params["IP"] = string(*spec.LogicalID)
+		params["Leader"] = string(*spec.LogicalID) == swarmSpec.ManagerIPs[0]
+	}
+
+	buffer := bytes.Buffer{}
+	if err := bootScript.Execute(&buffer, params); err != nil {
+		return spec, err
+	}
+
+	if spec.Init != "" {
+		buffer.WriteString("\n")
+		buffer.WriteString(spec.Init)
+	}
+	spec.Init = buffer.String()
+
+	tags := map[string]string{}
+	for k, v := range spec.Tags {
+		tags[k] = v
+	}
+	tags[TypeTag] = swarmSpec.Type
+	spec.Tags = tags
+
+	return spec, nil
+}
+
+// Healthy determines the health of an instance from the state of its swarm node, and from the health sources in its
+// description.  Nodes are matched to instances by private IP address.
+func (f *Flavor) Healthy(flavorProperties json.RawMessage, inst instance.Description) (flavor.Health, error) {
+	health, err := f.clusterHealth(inst)
+	if err != nil {
+		return flavor.Unknown, err
+	}
+	return flavor.Worst(health, flavor.InstanceHealth(inst)), nil
+}
+
+func (f *Flavor) clusterHealth(inst instance.Description) (flavor.Health, error) {
+	if inst.LogicalID == nil {
+		return flavor.Unknown, nil
+	}
+
+	nodes, err := f.nodes()
+	if err != nil {
+		return flavor.Unknown, err
+	}
+
+	for _, n := range nodes {
+		if n.Status.Addr != string(*inst.LogicalID) {
+			continue
+		}
+
+		if n.ManagerStatus != nil && n.ManagerStatus.Reachability == "unreachable" {
+			return flavor.Unhealthy, nil
+		}
+
+		switch n.Status.State {
+		case "ready":
+			return flavor.Healthy, nil
+		case "down":
+			return flavor.Unhealthy, nil
+		}
+	}
+
+	// The instance has not yet joined the swarm.
+	return flavor.Unknown, nil
+}
+
+func joinAddrs(joinAddress string, managerIPs []string) string {
+	addrs := []string{}
+	if joinAddress != "" {
+		addrs = append(addrs, joinAddress)
+	}
+	for _, ip := range managerIPs {
+		addrs = append(addrs, ip+":2377")
+	}
+	return strings.Join(addrs, " ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var bootScript = template.Must(template.New("swarm").Parse(`#!/bin/bash
+set -o errexit
+set -o nounset
+set -o xtrace
+
+export AWS_DEFAULT_REGION=$(curl -s http://169.254.169.254/latest/meta-data/placement/availability-zone | sed 's/.$//')
+
+if ! command -v docker > /dev/null
+then
+  curl -fsSL {{.Spec.EngineInstallURL}} | sh
+{{- if .Spec.DockerRestartCommand}}
+  {{.Spec.DockerRestartCommand}}
+{{- end}}
+fi
+
+get_token () {
+  aws ssm get-parameter --with-decryption --name "$1" --query Parameter.Value --output text
+}
+
+put_token () {
+  aws ssm put-parameter --type SecureString --overwrite --name "$1" --value "$2"
+}
+
+join () {
+  until token=$(get_token {{.TokenParam}})
+  do
+    echo 'Waiting for the swarm join token'
+    sleep 10
+  done
+
+  for addr in {{.JoinAddrs}}
+  do
+    docker swarm join{{if .Manager}} --advertise-addr {{.IP}}{{end}} --token "$token" "$addr" && return
+  done
+  return 1
+}
+
+if docker info --format '{{"{{"}}.Swarm.LocalNodeState{{"}}"}}' | grep -q active
+then
+  echo 'Already a member of the swarm'
+{{- if .Leader}}
+elif ! get_token {{.TokenParam}} > /dev/null
+then
+  docker swarm init --advertise-addr {{.IP}}
+  put_token {{.Path}}/manager-token "$(docker swarm join-token -q manager)"
+  put_token {{.Path}}/worker-token "$(docker swarm join-token -q worker)"
+{{- end}}
+else
+  join
+fi
+`))
@@ -0,0 +1,123 @@
+package swarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/flavor"
+	awsinstance "github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func properties(swarmType string) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{
+	    "Type": "%s",
+	    "ManagerIPs": ["192.168.33.4", "192.168.33.5", "192.168.33.6"],
+	    "ParameterPath": "/infrakit/test/swarm"
+	}`, swarmType))
+}
+
+func TestValidate(t *testing.T) {
+	f := &Flavor{}
+	require.NoError(t, f.Validate(properties(managerType)))
+	require.NoError(t, f.Validate(properties(workerType)))
+	require.Error(t, f.Validate(properties("other")))
+	require.Error(t, f.Validate(json.RawMessage(`{"Type": "worker"}`)))
+}
+
+func TestPrepareManagers(t *testing.T) {
+	f := &Flavor{}
+
+	leaderID := instance.LogicalID("192.168.33.4")
+	leader, err := f.Prepare(properties(managerType), instance.Spec{
+		Tags:      map[string]string{"group": "managers"},
+		Init:      "echo hello",
+		LogicalID: &leaderID,
+	})
+	require.NoError(t, err)
+	require.Contains(t, leader.Init, "docker swarm init --advertise-addr 192.168.33.4")
+	require.Contains(t, leader.Init, "put_token /infrakit/test/swarm/worker-token")
+	require.True(t, strings.HasSuffix(leader.Init, "\necho hello"))
+	require.Equal(t, map[string]string{"group": "managers", TypeTag: managerType}, leader.Tags)
+
+	otherID := instance.LogicalID("192.168.33.5")
+	other, err := f.Prepare(properties(managerType), instance.Spec{LogicalID: &otherID})
+	require.NoError(t, err)
+	require.NotContains(t, other.Init, "docker swarm init")
+	require.Contains(t, other.Init, "get_token /infrakit/test/swarm/manager-token")
+	require.Contains(t, other.Init, "--advertise-addr 192.168.33.5")
+
+	unknownID := instance.LogicalID("10.0.0.1")
+	_, err = f.Prepare(properties(managerType), instance.Spec{LogicalID: &unknownID})
+	require.Error(t, err)
+}
+
+func TestPrepareWorker(t *testing.T) {
+	f := &Flavor{}
+
+	worker, err := f.Prepare(properties(workerType), instance.Spec{})
+	require.NoError(t, err)
+	require.NotContains(t, worker.Init, "docker swarm init")
+	require.Contains(t, worker.Init, "get_token /infrakit/test/swarm/worker-token")
+	require.Contains(t, worker.Init, "192.168.33.4:2377 192.168.33.5:2377 192.168.33.6:2377")
+	require.Contains(t, worker.Init, "{{.Swarm.LocalNodeState}}")
+
+	balanced, err := f.Prepare(json.RawMessage(`{
+	    "Type": "worker",
+	    "ManagerIPs": ["192.168.33.4"],
+	    "JoinAddress": "managers.elb.amazonaws.com:2377",
+	    "ParameterPath": "/infrakit/test/swarm"
+	}`), instance.Spec{})
+	require.NoError(t, err)
+	require.Contains(t, balanced.Init, "for addr in managers.elb.amazonaws.com:2377 192.168.33.4:2377")
+}
+
+func TestHealthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/nodes", r.URL.Path)
+		w.Write([]byte(`[
+		    {"Status": {"State": "ready", "Addr": "10.0.0.1"}},
+		    {"Status": {"State": "down", "Addr": "10.0.0.2"}},
+		    {"Status": {"State": "ready", "Addr": "10.0.0.3"}, "ManagerStatus": {"Reachability": "unreachable"}}
+		]`))
+	}))
+	defer server.Close()
+
+	f, err := NewFlavor(strings.Replace(server.URL, "http://", "tcp://", 1))
+	require.NoError(t, err)
+
+	health := func(ip string) flavor.Health {
+		logicalID := instance.LogicalID(ip)
+		h, err := f.Healthy(properties(workerType), instance.Description{LogicalID: &logicalID})
+		require.NoError(t, err)
+		return h
+	}
+
+	require.Equal(t, flavor.Healthy, health("10.0.0.1"))
+	require.Equal(t, flavor.Unhealthy, health("10.0.0.2"))
+	require.Equal(t, flavor.Unhealthy, health("10.0.0.3"))
+	require.Equal(t, flavor.Unknown, health("10.0.0.4"))
+
+	// The health sources reported by the instance plugin override the swarm when they are less healthy.
+	targetHealth, statusChecks := awsinstance.TargetHealthTag, awsinstance.StatusChecksTag
+	for _, check := range []struct {
+		ip     string
+		tags   map[string]string
+		health flavor.Health
+	}{
+		{"10.0.0.1", map[string]string{targetHealth: "healthy", statusChecks: "ok"}, flavor.Healthy},
+		{"10.0.0.1", map[string]string{targetHealth: "unhealthy"}, flavor.Unhealthy},
+		{"10.0.0.1", map[string]string{targetHealth: "draining"}, flavor.Unknown},
+		{"10.0.0.1", map[string]string{statusChecks: "initializing"}, flavor.Unknown},
+		{"10.0.0.4", map[string]string{statusChecks: "impaired"}, flavor.Unhealthy},
+	} {
+		logicalID := instance.LogicalID(check.ip)
+		h, err := f.Healthy(properties(workerType), instance.Description{LogicalID: &logicalID, Tags: check.tags})
+		require.NoError(t, err)
+		require.Equal(t, check.health, h, "%v", check.tags)
+	}
+}
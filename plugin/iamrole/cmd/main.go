@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/docker/infrakit.aws/plugin/iamrole"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit/cli"
+	instance_plugin "github.com/docker/infrakit/rpc/instance"
+	"github.com/spf13/cobra"
+)
+
+// parseTags parses a list of key=value tags.
+func parseTags(tagKVs []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tagKV := range tagKVs {
+		keyAndValue := strings.Split(tagKV, "=")
+		if len(keyAndValue) != 2 {
+			return nil, errors.New("Tags must be formatted as key=value")
+		}
+
+		tags[keyAndValue[0]] = keyAndValue[1]
+	}
+	return tags, nil
+}
+
+func main() {
+
+	builder := &instance.Builder{}
+
+	var logLevel int
+	var name string
+	var namespaceTags []string
+	cmd := &cobra.Command{
+		Use:   os.Args[0],
+		Short: "AWS IAM role plugin",
+		Run: func(c *cobra.Command, args []string) {
+			namespace, err := parseTags(namespaceTags)
+			if err != nil {
+				log.Error("Namespace tags must be formatted as key=value")
+				os.Exit(1)
+			}
+
+			config, err := builder.ConfigProvider()
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			cli.SetLogLevel(logLevel)
+			cli.RunPlugin(name, instance_plugin.PluginServer(iamrole.NewRolePlugin(iam.New(config), namespace)))
+		},
+	}
+
+	cmd.Flags().IntVar(&logLevel, "log", cli.DefaultLogLevel, "Logging level. 0 is least verbose. Max is 5")
+	cmd.Flags().StringVar(&name, "name", "iamrole-aws", "Plugin name to advertise for discovery")
+	cmd.PersistentFlags().StringSliceVar(
+		&namespaceTags,
+		"namespace-tags",
+		[]string{},
+		"A list of key=value resource tags to namespace all resources created")
+	cmd.PersistentFlags().AddFlagSet(builder.Flags())
+
+	cmd.AddCommand(cli.VersionCommand())
+
+	err := cmd.Execute()
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,420 @@
+// Package iamrole is an instance plugin whose instances are IAM roles, so that the roles of a cluster, along with
+// their policies, trust relationships, and instance profiles, are committed by a group plugin like any other
+// resource.  Each role is named by the logical ID it is provisioned with.
+package iamrole
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+	"github.com/docker/infrakit.aws/plugin/strict"
+	"github.com/docker/infrakit/spi/instance"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// PathPrefix is the path of the roles and instance profiles of the plugin.  IAM roles are not tagged, so the tags
+	// of a role are recorded by the rest of its path.
+	PathPrefix = "/infrakit/"
+
+	// maxPathLength is the maximum length of IAM paths.
+	maxPathLength = 512
+)
+
+// DefaultTrustPolicy allows EC2 instances to assume a role.
+var DefaultTrustPolicy = json.RawMessage(`{
+	"Version": "2012-10-17",
+	"Statement": [{
+		"Effect": "Allow",
+		"Principal": {
+			"Service": ["ec2.amazonaws.com"]
+		},
+		"Action": ["sts:AssumeRole"]
+	}]
+}`)
+
+// CreateRoleRequest is the properties of an IAM role.  Provisioning a role that exists replaces its trust policy and
+// policies with those of the request.
+type CreateRoleRequest struct {
+	// TrustPolicy is the trust relationship of the role, naming the principals that may assume it.  Roles without a
+	// trust policy may be assumed by EC2 instances.
+	TrustPolicy json.RawMessage `json:",omitempty"`
+
+	// Policies are the policy documents of the inline policies of the role, by policy name.
+	Policies map[string]json.RawMessage `json:",omitempty"`
+
+	// ManagedPolicyARNs are the managed policies attached to the role.
+	ManagedPolicyARNs []string `json:",omitempty"`
+
+	// InstanceProfileName is the name of an instance profile of the role, for EC2 instances, if set.
+	InstanceProfileName string `json:",omitempty"`
+
+	Tags map[string]string `json:",omitempty"`
+}
+
+// IAMAPI is the part of the IAM API used by the plugin, which is implemented by iam.IAM.
+type IAMAPI interface {
+	GetRole(*iam.GetRoleInput) (*iam.GetRoleOutput, error)
+	CreateRole(*iam.CreateRoleInput) (*iam.CreateRoleOutput, error)
+	UpdateAssumeRolePolicy(*iam.UpdateAssumeRolePolicyInput) (*iam.UpdateAssumeRolePolicyOutput, error)
+	DeleteRole(*iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error)
+	ListRolesPages(*iam.ListRolesInput, func(*iam.ListRolesOutput, bool) bool) error
+
+	PutRolePolicy(*iam.PutRolePolicyInput) (*iam.PutRolePolicyOutput, error)
+	DeleteRolePolicy(*iam.DeleteRolePolicyInput) (*iam.DeleteRolePolicyOutput, error)
+	ListRolePolicies(*iam.ListRolePoliciesInput) (*iam.ListRolePoliciesOutput, error)
+	AttachRolePolicy(*iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error)
+	DetachRolePolicy(*iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error)
+	ListAttachedRolePolicies(*iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error)
+
+	GetInstanceProfile(*iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error)
+	CreateInstanceProfile(*iam.CreateInstanceProfileInput) (*iam.CreateInstanceProfileOutput, error)
+	WaitUntilInstanceProfileExists(*iam.GetInstanceProfileInput) error
+	AddRoleToInstanceProfile(*iam.AddRoleToInstanceProfileInput) (*iam.AddRoleToInstanceProfileOutput, error)
+	RemoveRoleFromInstanceProfile(
+		*iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error)
+	DeleteInstanceProfile(*iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error)
+	ListInstanceProfilesForRole(
+		*iam.ListInstanceProfilesForRoleInput) (*iam.ListInstanceProfilesForRoleOutput, error)
+}
+
+type rolePlugin struct {
+	client        IAMAPI
+	namespaceTags map[string]string
+}
+
+// NewRolePlugin creates a new plugin that manages IAM roles.
+func NewRolePlugin(client IAMAPI, namespaceTags map[string]string) instance.Plugin {
+	return &rolePlugin{client: client, namespaceTags: namespaceTags}
+}
+
+func parseRequest(properties json.RawMessage) (CreateRoleRequest, error) {
+	request := CreateRoleRequest{}
+	if err := strict.Unmarshal(properties, &request); err != nil {
+		return request, fmt.Errorf("Invalid input formatting: %s", err)
+	}
+	documents := map[string]json.RawMessage{"TrustPolicy": request.TrustPolicy}
+	for name, policy := range request.Policies {
+		documents["Policies."+name] = policy
+	}
+	for field, document := range documents {
+		if document == nil {
+			continue
+		}
+		var parsed map[string]interface{}
+		if err := json.Unmarshal(document, &parsed); err != nil {
+			return request, fmt.Errorf("%s must be a policy document: %s", field, err)
+		}
+	}
+	return request, nil
+}
+
+// Validate performs local validation on a provision request.
+func (p rolePlugin) Validate(req json.RawMessage) error {
+	_, err := parseRequest(req)
+	return err
+}
+
+// mergeTags merges maps of tags, with the tags of later maps taking precedence.
+func mergeTags(tagMaps ...map[string]string) ([]string, map[string]string) {
+	tags := map[string]string{}
+	for _, tagMap := range tagMaps {
+		for key, value := range tagMap {
+			tags[key] = value
+		}
+	}
+	keys := []string{}
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, tags
+}
+
+// tagPath is the path of a role with tags, which records each tag as an escaped key=value element.
+func tagPath(tags map[string]string) (string, error) {
+	keys, _ := mergeTags(tags)
+	path := PathPrefix
+	for _, key := range keys {
+		path += url.QueryEscape(key) + "=" + url.QueryEscape(tags[key]) + "/"
+	}
+	if len(path) > maxPathLength {
+		return "", fmt.Errorf("The tags of the role exceed the %d characters of its IAM path", maxPathLength)
+	}
+	return path, nil
+}
+
+// pathTags are the tags recorded by the path of a role, or nil if the path is not that of a role of the plugin.
+func pathTags(path string) map[string]string {
+	if !strings.HasPrefix(path, PathPrefix) {
+		return nil
+	}
+	tags := map[string]string{}
+	for _, element := range strings.Split(strings.Trim(strings.TrimPrefix(path, PathPrefix), "/"), "/") {
+		keyAndValue := strings.SplitN(element, "=", 2)
+		if len(keyAndValue) != 2 {
+			continue
+		}
+		key, keyErr := url.QueryUnescape(keyAndValue[0])
+		value, valueErr := url.QueryUnescape(keyAndValue[1])
+		if keyErr == nil && valueErr == nil {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+func notFound(err error) bool {
+	return awserrors.Code(err) == "NoSuchEntity"
+}
+
+// Provision creates a role named by the logical ID of the spec, or replaces the trust policy and policies of the
+// role if it exists, such as when a Provision call that timed out is retried.
+func (p rolePlugin) Provision(spec instance.Spec) (*instance.ID, error) {
+	if spec.Properties == nil {
+		return nil, errors.New("Properties must be set")
+	}
+	if spec.LogicalID == nil {
+		return nil, errors.New("Roles must be provisioned with a logical ID, which names them")
+	}
+	request, err := parseRequest(*spec.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	name := string(*spec.LogicalID)
+	_, tags := mergeTags(request.Tags, spec.Tags, p.namespaceTags)
+	path, err := tagPath(tags)
+	if err != nil {
+		return nil, err
+	}
+	trustPolicy := request.TrustPolicy
+	if trustPolicy == nil {
+		trustPolicy = DefaultTrustPolicy
+	}
+
+	_, err = p.client.GetRole(&iam.GetRoleInput{RoleName: aws.String(name)})
+	switch {
+	case notFound(err):
+		role, err := p.client.CreateRole(&iam.CreateRoleInput{
+			RoleName:                 aws.String(name),
+			Path:                     aws.String(path),
+			AssumeRolePolicyDocument: aws.String(string(trustPolicy)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create role %s: %s", name, err)
+		}
+		log.Infof("Created role %s", aws.StringValue(role.Role.Arn))
+	case err != nil:
+		return nil, fmt.Errorf("Failed to look up role %s: %s", name, err)
+	default:
+		_, err := p.client.UpdateAssumeRolePolicy(&iam.UpdateAssumeRolePolicyInput{
+			RoleName:       aws.String(name),
+			PolicyDocument: aws.String(string(trustPolicy)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to update the trust policy of role %s: %s", name, err)
+		}
+		log.Infof("Updating existing role %s", name)
+	}
+
+	if err := p.reconcilePolicies(name, request); err != nil {
+		return nil, err
+	}
+	if request.InstanceProfileName != "" {
+		if err := p.ensureInstanceProfile(name, path, request.InstanceProfileName); err != nil {
+			return nil, err
+		}
+	}
+
+	id := instance.ID(name)
+	return &id, nil
+}
+
+// reconcilePolicies puts the inline policies and attaches the managed policies of a request to a role, then deletes
+// and detaches those the request does not list.
+func (p rolePlugin) reconcilePolicies(name string, request CreateRoleRequest) error {
+	policyNames := []string{}
+	for policyName := range request.Policies {
+		policyNames = append(policyNames, policyName)
+	}
+	sort.Strings(policyNames)
+	for _, policyName := range policyNames {
+		_, err := p.client.PutRolePolicy(&iam.PutRolePolicyInput{
+			RoleName:       aws.String(name),
+			PolicyName:     aws.String(policyName),
+			PolicyDocument: aws.String(string(request.Policies[policyName])),
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to put policy %s of role %s: %s", policyName, name, err)
+		}
+	}
+
+	inline, err := p.client.ListRolePolicies(&iam.ListRolePoliciesInput{RoleName: aws.String(name)})
+	if err != nil {
+		return fmt.Errorf("Failed to list the policies of role %s: %s", name, err)
+	}
+	for _, policyName := range inline.PolicyNames {
+		if _, listed := request.Policies[*policyName]; listed {
+			continue
+		}
+		_, err := p.client.DeleteRolePolicy(&iam.DeleteRolePolicyInput{RoleName: aws.String(name), PolicyName: policyName})
+		if err != nil {
+			return fmt.Errorf("Failed to delete policy %s of role %s: %s", *policyName, name, err)
+		}
+	}
+
+	attached, err := p.client.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(name)})
+	if err != nil {
+		return fmt.Errorf("Failed to list the managed policies of role %s: %s", name, err)
+	}
+	listed := map[string]bool{}
+	for _, arn := range request.ManagedPolicyARNs {
+		listed[arn] = true
+	}
+	isAttached := map[string]bool{}
+	for _, policy := range attached.AttachedPolicies {
+		arn := aws.StringValue(policy.PolicyArn)
+		isAttached[arn] = true
+		if listed[arn] {
+			continue
+		}
+		_, err := p.client.DetachRolePolicy(&iam.DetachRolePolicyInput{RoleName: aws.String(name), PolicyArn: &arn})
+		if err != nil {
+			return fmt.Errorf("Failed to detach policy %s from role %s: %s", arn, name, err)
+		}
+	}
+	for _, arn := range request.ManagedPolicyARNs {
+		if isAttached[arn] {
+			continue
+		}
+		_, err := p.client.AttachRolePolicy(&iam.AttachRolePolicyInput{
+			RoleName:  aws.String(name),
+			PolicyArn: aws.String(arn),
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to attach policy %s to role %s: %s", arn, name, err)
+		}
+	}
+	return nil
+}
+
+// ensureInstanceProfile creates an instance profile of a role if it does not exist, and adds the role to it.
+func (p rolePlugin) ensureInstanceProfile(name, path, profileName string) error {
+	profile, err := p.client.GetInstanceProfile(&iam.GetInstanceProfileInput{InstanceProfileName: aws.String(profileName)})
+	switch {
+	case notFound(err):
+		_, err := p.client.CreateInstanceProfile(&iam.CreateInstanceProfileInput{
+			InstanceProfileName: aws.String(profileName),
+			Path:                aws.String(path),
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to create instance profile %s: %s", profileName, err)
+		}
+		err = p.client.WaitUntilInstanceProfileExists(&iam.GetInstanceProfileInput{
+			InstanceProfileName: aws.String(profileName),
+		})
+		if err != nil {
+			return fmt.Errorf("Failed waiting for instance profile %s: %s", profileName, err)
+		}
+	case err != nil:
+		return fmt.Errorf("Failed to look up instance profile %s: %s", profileName, err)
+	default:
+		for _, role := range profile.InstanceProfile.Roles {
+			if aws.StringValue(role.RoleName) == name {
+				return nil
+			}
+		}
+	}
+
+	_, err = p.client.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: aws.String(profileName),
+		RoleName:            aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to add role %s to instance profile %s: %s", name, profileName, err)
+	}
+	return nil
+}
+
+// Destroy deletes a role, along with its inline policies and the instance profiles of the plugin containing it.  The
+// role is removed from other instance profiles, and its managed policies are detached but not deleted.
+func (p rolePlugin) Destroy(id instance.ID) error {
+	name := aws.String(string(id))
+	if _, err := p.client.GetRole(&iam.GetRoleInput{RoleName: name}); err != nil {
+		if notFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Failed to look up role %s: %s", id, err)
+	}
+
+	profiles, err := p.client.ListInstanceProfilesForRole(&iam.ListInstanceProfilesForRoleInput{RoleName: name})
+	if err != nil {
+		return fmt.Errorf("Failed to list the instance profiles of role %s: %s", id, err)
+	}
+	for _, profile := range profiles.InstanceProfiles {
+		_, err := p.client.RemoveRoleFromInstanceProfile(&iam.RemoveRoleFromInstanceProfileInput{
+			InstanceProfileName: profile.InstanceProfileName,
+			RoleName:            name,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to remove role %s from instance profile %s: %s", id, *profile.InstanceProfileName, err)
+		}
+		if !strings.HasPrefix(aws.StringValue(profile.Path), PathPrefix) {
+			continue
+		}
+		_, err = p.client.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{
+			InstanceProfileName: profile.InstanceProfileName,
+		})
+		if err != nil && !notFound(err) {
+			return fmt.Errorf("Failed to delete instance profile %s: %s", *profile.InstanceProfileName, err)
+		}
+	}
+
+	if err := p.reconcilePolicies(string(id), CreateRoleRequest{}); err != nil {
+		return err
+	}
+
+	if _, err := p.client.DeleteRole(&iam.DeleteRoleInput{RoleName: name}); err != nil && !notFound(err) {
+		return fmt.Errorf("Failed to delete role %s: %s", id, err)
+	}
+	return nil
+}
+
+// DescribeInstances returns descriptions of the roles of the plugin matching all of the provided tags.
+func (p rolePlugin) DescribeInstances(tags map[string]string) ([]instance.Description, error) {
+	_, match := mergeTags(tags, p.namespaceTags)
+
+	descriptions := []instance.Description{}
+	err := p.client.ListRolesPages(&iam.ListRolesInput{PathPrefix: aws.String(PathPrefix)},
+		func(page *iam.ListRolesOutput, last bool) bool {
+			for _, role := range page.Roles {
+				roleTags := pathTags(aws.StringValue(role.Path))
+				matches := roleTags != nil
+				for key, value := range match {
+					matches = matches && roleTags[key] == value
+				}
+				if !matches {
+					continue
+				}
+
+				logicalID := instance.LogicalID(*role.RoleName)
+				descriptions = append(descriptions, instance.Description{
+					ID:        instance.ID(*role.RoleName),
+					LogicalID: &logicalID,
+					Tags:      roleTags,
+				})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list roles: %s", err)
+	}
+	return descriptions, nil
+}
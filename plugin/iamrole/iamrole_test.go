@@ -0,0 +1,303 @@
+package iamrole
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+var testNamespace = map[string]string{"cluster": "test"}
+
+// fakeIAM is an in-memory IAM of roles and instance profiles.
+type fakeIAM struct {
+	roles    map[string]*iam.Role
+	inline   map[string]map[string]string
+	attached map[string]map[string]bool
+	profiles map[string]*iam.InstanceProfile
+}
+
+func newFakeIAM() *fakeIAM {
+	return &fakeIAM{
+		roles:    map[string]*iam.Role{},
+		inline:   map[string]map[string]string{},
+		attached: map[string]map[string]bool{},
+		profiles: map[string]*iam.InstanceProfile{},
+	}
+}
+
+var errNoSuchEntity = awserr.New("NoSuchEntity", "not found", nil)
+
+func (f *fakeIAM) GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	role, has := f.roles[*input.RoleName]
+	if !has {
+		return nil, errNoSuchEntity
+	}
+	return &iam.GetRoleOutput{Role: role}, nil
+}
+
+func (f *fakeIAM) CreateRole(input *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	role := &iam.Role{
+		RoleName:                 input.RoleName,
+		Path:                     input.Path,
+		Arn:                      aws.String("arn:aws:iam::123456789012:role" + *input.Path + *input.RoleName),
+		AssumeRolePolicyDocument: input.AssumeRolePolicyDocument,
+	}
+	f.roles[*input.RoleName] = role
+	f.inline[*input.RoleName] = map[string]string{}
+	f.attached[*input.RoleName] = map[string]bool{}
+	return &iam.CreateRoleOutput{Role: role}, nil
+}
+
+func (f *fakeIAM) UpdateAssumeRolePolicy(
+	input *iam.UpdateAssumeRolePolicyInput) (*iam.UpdateAssumeRolePolicyOutput, error) {
+
+	f.roles[*input.RoleName].AssumeRolePolicyDocument = input.PolicyDocument
+	return &iam.UpdateAssumeRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) DeleteRole(input *iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	delete(f.roles, *input.RoleName)
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func (f *fakeIAM) ListRolesPages(input *iam.ListRolesInput, fn func(*iam.ListRolesOutput, bool) bool) error {
+	output := &iam.ListRolesOutput{}
+	for _, role := range f.roles {
+		output.Roles = append(output.Roles, role)
+	}
+	fn(output, true)
+	return nil
+}
+
+func (f *fakeIAM) PutRolePolicy(input *iam.PutRolePolicyInput) (*iam.PutRolePolicyOutput, error) {
+	f.inline[*input.RoleName][*input.PolicyName] = *input.PolicyDocument
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) DeleteRolePolicy(input *iam.DeleteRolePolicyInput) (*iam.DeleteRolePolicyOutput, error) {
+	delete(f.inline[*input.RoleName], *input.PolicyName)
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) ListRolePolicies(input *iam.ListRolePoliciesInput) (*iam.ListRolePoliciesOutput, error) {
+	output := &iam.ListRolePoliciesOutput{}
+	for name := range f.inline[*input.RoleName] {
+		output.PolicyNames = append(output.PolicyNames, aws.String(name))
+	}
+	return output, nil
+}
+
+func (f *fakeIAM) AttachRolePolicy(input *iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error) {
+	f.attached[*input.RoleName][*input.PolicyArn] = true
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) DetachRolePolicy(input *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	delete(f.attached[*input.RoleName], *input.PolicyArn)
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) ListAttachedRolePolicies(
+	input *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+
+	output := &iam.ListAttachedRolePoliciesOutput{}
+	for arn := range f.attached[*input.RoleName] {
+		output.AttachedPolicies = append(output.AttachedPolicies, &iam.AttachedPolicy{PolicyArn: aws.String(arn)})
+	}
+	return output, nil
+}
+
+func (f *fakeIAM) GetInstanceProfile(input *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	profile, has := f.profiles[*input.InstanceProfileName]
+	if !has {
+		return nil, errNoSuchEntity
+	}
+	return &iam.GetInstanceProfileOutput{InstanceProfile: profile}, nil
+}
+
+func (f *fakeIAM) CreateInstanceProfile(
+	input *iam.CreateInstanceProfileInput) (*iam.CreateInstanceProfileOutput, error) {
+
+	profile := &iam.InstanceProfile{InstanceProfileName: input.InstanceProfileName, Path: input.Path}
+	f.profiles[*input.InstanceProfileName] = profile
+	return &iam.CreateInstanceProfileOutput{InstanceProfile: profile}, nil
+}
+
+func (f *fakeIAM) WaitUntilInstanceProfileExists(input *iam.GetInstanceProfileInput) error {
+	_, err := f.GetInstanceProfile(input)
+	return err
+}
+
+func (f *fakeIAM) AddRoleToInstanceProfile(
+	input *iam.AddRoleToInstanceProfileInput) (*iam.AddRoleToInstanceProfileOutput, error) {
+
+	profile := f.profiles[*input.InstanceProfileName]
+	profile.Roles = append(profile.Roles, f.roles[*input.RoleName])
+	return &iam.AddRoleToInstanceProfileOutput{}, nil
+}
+
+func (f *fakeIAM) RemoveRoleFromInstanceProfile(
+	input *iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+
+	profile := f.profiles[*input.InstanceProfileName]
+	roles := []*iam.Role{}
+	for _, role := range profile.Roles {
+		if *role.RoleName != *input.RoleName {
+			roles = append(roles, role)
+		}
+	}
+	profile.Roles = roles
+	return &iam.RemoveRoleFromInstanceProfileOutput{}, nil
+}
+
+func (f *fakeIAM) DeleteInstanceProfile(
+	input *iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error) {
+
+	delete(f.profiles, *input.InstanceProfileName)
+	return &iam.DeleteInstanceProfileOutput{}, nil
+}
+
+func (f *fakeIAM) ListInstanceProfilesForRole(
+	input *iam.ListInstanceProfilesForRoleInput) (*iam.ListInstanceProfilesForRoleOutput, error) {
+
+	output := &iam.ListInstanceProfilesForRoleOutput{}
+	for _, profile := range f.profiles {
+		for _, role := range profile.Roles {
+			if *role.RoleName == *input.RoleName {
+				output.InstanceProfiles = append(output.InstanceProfiles, profile)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeIAM) attachedARNs(role string) []string {
+	arns := []string{}
+	for arn := range f.attached[role] {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+func roleSpec(t *testing.T, name string, request CreateRoleRequest) instance.Spec {
+	properties, err := json.Marshal(request)
+	require.NoError(t, err)
+	raw := json.RawMessage(properties)
+	logicalID := instance.LogicalID(name)
+	return instance.Spec{Properties: &raw, Tags: map[string]string{"infrakit.group": "roles"}, LogicalID: &logicalID}
+}
+
+func TestTagPath(t *testing.T) {
+	path, err := tagPath(map[string]string{"infrakit.group": "roles", "owner": "ops team/east"})
+	require.NoError(t, err)
+	require.Equal(t, "/infrakit/infrakit.group=roles/owner=ops+team%2Feast/", path)
+	require.Equal(t, map[string]string{"infrakit.group": "roles", "owner": "ops team/east"}, pathTags(path))
+
+	require.Nil(t, pathTags("/"))
+
+	long := map[string]string{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		long[key] = string(make([]byte, 100))
+	}
+	_, err = tagPath(long)
+	require.Error(t, err)
+}
+
+func TestProvisionRole(t *testing.T) {
+	fake := newFakeIAM()
+	plugin := NewRolePlugin(fake, testNamespace)
+
+	request := CreateRoleRequest{
+		Policies: map[string]json.RawMessage{
+			"logs": json.RawMessage(`{"Version": "2012-10-17", "Statement": []}`),
+		},
+		ManagedPolicyARNs:   []string{"arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"},
+		InstanceProfileName: "workers-profile",
+	}
+	id, err := plugin.Provision(roleSpec(t, "workers", request))
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("workers"), *id)
+
+	role := fake.roles["workers"]
+	require.Equal(t, "/infrakit/cluster=test/infrakit.group=roles/", *role.Path)
+	require.Equal(t, string(DefaultTrustPolicy), *role.AssumeRolePolicyDocument)
+	require.Equal(t, map[string]string{"logs": `{"Version":"2012-10-17","Statement":[]}`}, fake.inline["workers"])
+	require.Equal(t, []string{"arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"}, fake.attachedARNs("workers"))
+	require.Len(t, fake.profiles["workers-profile"].Roles, 1)
+
+	// Provisioning the role again replaces its trust policy and policies.
+	fake.attached["workers"]["arn:aws:iam::123456789012:policy/out-of-band"] = true
+	request = CreateRoleRequest{
+		TrustPolicy:         json.RawMessage(`{"Version":"2012-10-17","Statement":[]}`),
+		Policies:            map[string]json.RawMessage{"ecr": json.RawMessage(`{}`)},
+		InstanceProfileName: "workers-profile",
+	}
+	_, err = plugin.Provision(roleSpec(t, "workers", request))
+	require.NoError(t, err)
+	require.Equal(t, `{"Version":"2012-10-17","Statement":[]}`, *role.AssumeRolePolicyDocument)
+	require.Equal(t, map[string]string{"ecr": `{}`}, fake.inline["workers"])
+	require.Empty(t, fake.attachedARNs("workers"))
+	require.Len(t, fake.profiles["workers-profile"].Roles, 1)
+
+	_, err = plugin.Provision(instance.Spec{Properties: roleSpec(t, "workers", request).Properties})
+	require.Error(t, err)
+	require.Error(t, plugin.Validate(json.RawMessage(`{"TrustPolicy": "not a document"}`)))
+	require.Error(t, plugin.Validate(json.RawMessage(`{"Policy": {}}`)))
+}
+
+func TestDestroyRole(t *testing.T) {
+	fake := newFakeIAM()
+	plugin := NewRolePlugin(fake, testNamespace)
+
+	request := CreateRoleRequest{
+		Policies:            map[string]json.RawMessage{"logs": json.RawMessage(`{}`)},
+		ManagedPolicyARNs:   []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		InstanceProfileName: "managers-profile",
+	}
+	_, err := plugin.Provision(roleSpec(t, "managers", request))
+	require.NoError(t, err)
+
+	// Instance profiles outside of the plugin keep existing without the role.
+	fake.profiles["legacy"] = &iam.InstanceProfile{
+		InstanceProfileName: aws.String("legacy"),
+		Path:                aws.String("/"),
+		Roles:               []*iam.Role{fake.roles["managers"]},
+	}
+
+	require.NoError(t, plugin.Destroy(instance.ID("managers")))
+	require.Empty(t, fake.roles)
+	require.Empty(t, fake.inline["managers"])
+	require.Empty(t, fake.attachedARNs("managers"))
+	require.Len(t, fake.profiles, 1)
+	require.Empty(t, fake.profiles["legacy"].Roles)
+
+	// Roles that do not exist are already destroyed.
+	require.NoError(t, plugin.Destroy(instance.ID("managers")))
+}
+
+func TestDescribeRoles(t *testing.T) {
+	fake := newFakeIAM()
+	plugin := NewRolePlugin(fake, testNamespace)
+
+	_, err := plugin.Provision(roleSpec(t, "workers", CreateRoleRequest{}))
+	require.NoError(t, err)
+	other := NewRolePlugin(fake, map[string]string{"cluster": "other"})
+	_, err = other.Provision(roleSpec(t, "other", CreateRoleRequest{}))
+	require.NoError(t, err)
+	fake.roles["unmanaged"] = &iam.Role{RoleName: aws.String("unmanaged"), Path: aws.String("/")}
+
+	descriptions, err := plugin.DescribeInstances(map[string]string{"infrakit.group": "roles"})
+	require.NoError(t, err)
+	logicalID := instance.LogicalID("workers")
+	require.Equal(t, []instance.Description{{
+		ID:        instance.ID("workers"),
+		LogicalID: &logicalID,
+		Tags:      map[string]string{"cluster": "test", "infrakit.group": "roles"},
+	}}, descriptions)
+}
@@ -0,0 +1,118 @@
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"strings"
+)
+
+// managedTagPrefix prefixes the tags that InfraKit uses to manage instances.
+const managedTagPrefix = "infrakit."
+
+// Adopter brings existing instances under management, and releases instances from management without terminating
+// them.
+type Adopter interface {
+	// Adopt applies the tags of a group to an existing instance.  Unless force is set, the instance must be running
+	// the image and instance type of the group's properties.
+	Adopt(id instance.ID, tags map[string]string, properties json.RawMessage, force bool) error
+
+	// Release removes the tags that identify an instance as managed, leaving the instance running.
+	Release(id instance.ID) error
+}
+
+// resources lists the instance along with its volumes and network interfaces, which are tagged alongside it.
+func resources(ec2Instance *ec2.Instance) []*string {
+	ids := []*string{ec2Instance.InstanceId}
+	for _, mapping := range ec2Instance.BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.VolumeId != nil {
+			ids = append(ids, mapping.Ebs.VolumeId)
+		}
+	}
+	for _, networkInterface := range ec2Instance.NetworkInterfaces {
+		if networkInterface.NetworkInterfaceId != nil {
+			ids = append(ids, networkInterface.NetworkInterfaceId)
+		}
+	}
+	return ids
+}
+
+// Adopt implements Adopter.Adopt.
+func (p awsInstancePlugin) Adopt(id instance.ID, tags map[string]string, properties json.RawMessage, force bool) error {
+	defer p.describeCache.invalidate()
+
+	request, err := parseRequest(properties)
+	if err != nil {
+		return err
+	}
+
+	ec2Instance, err := p.describeInstance(id)
+	if err != nil {
+		return err
+	}
+
+	if isTerminated(ec2Instance) {
+		return fmt.Errorf("Instance %s is terminated", id)
+	}
+	if !force && outdated(ec2Instance, request) {
+		return fmt.Errorf(
+			"Instance %s runs image %s and instance type %s, which do not match the group",
+			id,
+			aws.StringValue(ec2Instance.ImageId),
+			aws.StringValue(ec2Instance.InstanceType))
+	}
+
+	// The instance is named and tagged by the tag policy as it would be if it were provisioned.
+	current := tagsOf(ec2Instance)
+	var logicalID *instance.LogicalID
+	if value, has := current[LogicalIDTag]; has {
+		logicalID = (*instance.LogicalID)(&value)
+	}
+	name := ""
+	if request.Name != nil {
+		name, _ = request.Name.instanceName(tags, current[SlotTag], logicalID)
+	}
+	userTags, name, err := p.policyTags(request, tags, current[SlotTag], logicalID, name)
+	if err != nil {
+		return err
+	}
+	systemTags := map[string]string{}
+	for key, value := range tags {
+		systemTags[key] = value
+	}
+	if name != "" {
+		systemTags[NameTag] = name
+	}
+
+	_, err = p.client.CreateTags(&ec2.CreateTagsInput{
+		Resources: resources(ec2Instance),
+		Tags:      p.ec2Tags(systemTags, userTags),
+	})
+	return err
+}
+
+// Release implements Adopter.Release.  Namespace tags and tags prefixed with infrakit. are removed.
+func (p awsInstancePlugin) Release(id instance.ID) error {
+	defer p.describeCache.invalidate()
+
+	ec2Instance, err := p.describeInstance(id)
+	if err != nil {
+		return err
+	}
+
+	ec2Tags := []*ec2.Tag{}
+	for _, tag := range ec2Instance.Tags {
+		key := aws.StringValue(tag.Key)
+		if _, namespaced := p.namespaceTags[key]; namespaced || strings.HasPrefix(key, managedTagPrefix) {
+			ec2Tags = append(ec2Tags, &ec2.Tag{Key: tag.Key})
+		}
+	}
+	if len(ec2Tags) == 0 {
+		return nil
+	}
+
+	_, err = p.client.DeleteTags(&ec2.DeleteTagsInput{Resources: resources(ec2Instance), Tags: ec2Tags})
+	return err
+}
@@ -0,0 +1,79 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func adoptableInstance(image string, tags map[string]string) *ec2.DescribeInstancesOutput {
+	ec2Tags := []*ec2.Tag{}
+	for key, value := range tags {
+		ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{{
+		InstanceId:   aws.String("i-1"),
+		ImageId:      aws.String(image),
+		InstanceType: aws.String("t2.micro"),
+		State:        &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{
+			{Ebs: &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-1")}},
+		},
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{{NetworkInterfaceId: aws.String("eni-1")}},
+		Tags:              ec2Tags,
+	}}}}}
+}
+
+func TestAdopt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, map[string]string{"cluster": "test"}).(Adopter)
+	group := map[string]string{GroupTag: "workers"}
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(adoptableInstance("ami-new", nil), nil)
+	clientMock.EXPECT().CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String("i-1"), aws.String("vol-1"), aws.String("eni-1")},
+		Tags: []*ec2.Tag{
+			{Key: aws.String("cluster"), Value: aws.String("test")},
+			{Key: aws.String(GroupTag), Value: aws.String("workers")},
+		},
+	}).Return(&ec2.CreateTagsOutput{}, nil)
+	require.NoError(t, pluginImpl.Adopt("i-1", group, updateJSON, false))
+
+	// Instances that do not match the group are adopted only when forced.
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(adoptableInstance("ami-old", nil), nil)
+	require.Error(t, pluginImpl.Adopt("i-1", group, updateJSON, false))
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(adoptableInstance("ami-old", nil), nil)
+	clientMock.EXPECT().CreateTags(gomock.Any()).Return(&ec2.CreateTagsOutput{}, nil)
+	require.NoError(t, pluginImpl.Adopt("i-1", group, updateJSON, true))
+}
+
+func TestRelease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, map[string]string{"cluster": "test"}).(Adopter)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(adoptableInstance("ami-new", map[string]string{
+		"cluster": "test",
+		GroupTag:  "workers",
+		"Name":    "worker",
+	}), nil)
+	clientMock.EXPECT().DeleteTags(gomock.Any()).Do(func(input *ec2.DeleteTagsInput) {
+		require.Len(t, input.Resources, 3)
+		keys := map[string]bool{}
+		for _, tag := range input.Tags {
+			keys[*tag.Key] = true
+		}
+		require.Equal(t, map[string]bool{"cluster": true, GroupTag: true}, keys)
+	}).Return(&ec2.DeleteTagsOutput{}, nil)
+	require.NoError(t, pluginImpl.Release("i-1"))
+}
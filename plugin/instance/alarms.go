@@ -0,0 +1,278 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"strings"
+)
+
+const (
+	// AlarmsTag is the tag name used to record the CloudWatch alarms of an instance, such that the alarms are deleted
+	// when the instance is destroyed.
+	AlarmsTag = "infrakit.alarms"
+
+	cpuAlarm         = "cpu"
+	statusCheckAlarm = "status-check"
+	recoverAlarm     = "recover"
+
+	defaultAlarmPeriod            = 300
+	defaultAlarmEvaluationPeriods = 2
+)
+
+// Alarms are CloudWatch alarms created for each instance of a group, and deleted along with the instance.
+type Alarms struct {
+	// CPUUtilization alarms when the average CPU utilization of an instance exceeds the percentage, if set.
+	CPUUtilization float64 `json:",omitempty"`
+
+	// StatusCheckFailed alarms when an instance fails its instance or system status checks.
+	StatusCheckFailed bool `json:",omitempty"`
+
+	// Recover recovers an instance onto other hardware when it fails its system status checks, such as when its
+	// host fails.  A recovered instance keeps its ID, IP addresses, and EBS volumes, so it need not be replaced.
+	Recover bool `json:",omitempty"`
+
+	// Period is the period of the alarm metrics in seconds, defaulting to 300.  Shorter periods require detailed
+	// monitoring, enabled with the Monitoring of RunInstancesInput.
+	Period int64 `json:",omitempty"`
+
+	// EvaluationPeriods is the number of periods a threshold must be breached to trigger an alarm, defaulting to 2.
+	EvaluationPeriods int64 `json:",omitempty"`
+
+	// Actions are the ARNs notified when alarms are triggered and resolved, such as SNS topics.
+	Actions []string `json:",omitempty"`
+}
+
+// kinds are the kinds of alarms created for each instance.
+func (a *Alarms) kinds() []string {
+	kinds := []string{}
+	if a == nil {
+		return kinds
+	}
+	if a.CPUUtilization > 0 {
+		kinds = append(kinds, cpuAlarm)
+	}
+	if a.StatusCheckFailed {
+		kinds = append(kinds, statusCheckAlarm)
+	}
+	if a.Recover {
+		kinds = append(kinds, recoverAlarm)
+	}
+	return kinds
+}
+
+func alarmName(id instance.ID, kind string) string {
+	return fmt.Sprintf("infrakit-%s-%s", id, kind)
+}
+
+type alarmDimension struct {
+	Name  string
+	Value string
+}
+
+// putMetricAlarmInput is the part of the CloudWatch PutMetricAlarm request used for instance alarms.
+type putMetricAlarmInput struct {
+	AlarmName          string
+	AlarmDescription   string
+	Namespace          string
+	MetricName         string
+	Dimensions         []alarmDimension
+	Statistic          string
+	Period             int64
+	EvaluationPeriods  int64
+	Threshold          float64
+	ComparisonOperator string
+	AlarmActions       []string
+	OKActions          []string
+}
+
+type deleteAlarmsInput struct {
+	AlarmNames []string
+}
+
+// alarmsAPI is the part of the CloudWatch API used to manage instance alarms.
+type alarmsAPI interface {
+	PutMetricAlarm(input *putMetricAlarmInput) error
+	DeleteAlarms(input *deleteAlarmsInput) error
+
+	// Region is the region of the alarms, which their EC2 actions must be in.
+	Region() string
+}
+
+// cloudWatchAlarms is a CloudWatch client.  CloudWatch is not vendored, so the client is assembled from the SDK's
+// query protocol handlers.
+type cloudWatchAlarms struct {
+	client *client.Client
+	region string
+}
+
+func newCloudWatchAlarms(config client.ConfigProvider) *cloudWatchAlarms {
+	c := config.ClientConfig("monitoring")
+	cloudWatch := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "monitoring",
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2010-08-01",
+		},
+		c.Handlers)
+	cloudWatch.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	cloudWatch.Handlers.Build.PushBackNamed(query.BuildHandler)
+	cloudWatch.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	cloudWatch.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	cloudWatch.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return &cloudWatchAlarms{client: cloudWatch, region: c.SigningRegion}
+}
+
+func (c *cloudWatchAlarms) send(action string, input interface{}) error {
+	operation := &request.Operation{Name: action, HTTPMethod: "POST", HTTPPath: "/"}
+	return c.client.NewRequest(operation, input, &struct{}{}).Send()
+}
+
+// PutMetricAlarm creates or updates an alarm.
+func (c *cloudWatchAlarms) PutMetricAlarm(input *putMetricAlarmInput) error {
+	return c.send("PutMetricAlarm", input)
+}
+
+// DeleteAlarms deletes alarms.
+func (c *cloudWatchAlarms) DeleteAlarms(input *deleteAlarmsInput) error {
+	return c.send("DeleteAlarms", input)
+}
+
+// Region is the region of the client.
+func (c *cloudWatchAlarms) Region() string {
+	return c.region
+}
+
+func withAlarmsTag(tags map[string]string, alarms *Alarms) map[string]string {
+	tagged := map[string]string{}
+	for k, v := range tags {
+		tagged[k] = v
+	}
+	delete(tagged, AlarmsTag)
+	if kinds := alarms.kinds(); len(kinds) > 0 {
+		tagged[AlarmsTag] = strings.Join(kinds, ",")
+	}
+	return tagged
+}
+
+// recoverAction is the alarm action that recovers an instance in a region.
+func recoverAction(region string) string {
+	return fmt.Sprintf("arn:aws:automate:%s:ec2:recover", region)
+}
+
+// alarmInput creates the request of an alarm of an instance in a region.
+func alarmInput(id instance.ID, kind string, alarms Alarms, region string) *putMetricAlarmInput {
+	input := &putMetricAlarmInput{
+		AlarmName:          alarmName(id, kind),
+		Namespace:          "AWS/EC2",
+		Dimensions:         []alarmDimension{{Name: "InstanceId", Value: string(id)}},
+		Period:             alarms.Period,
+		EvaluationPeriods:  alarms.EvaluationPeriods,
+		ComparisonOperator: "GreaterThanThreshold",
+		AlarmActions:       alarms.Actions,
+		OKActions:          alarms.Actions,
+	}
+	if input.Period == 0 {
+		input.Period = defaultAlarmPeriod
+	}
+	if input.EvaluationPeriods == 0 {
+		input.EvaluationPeriods = defaultAlarmEvaluationPeriods
+	}
+
+	switch kind {
+	case cpuAlarm:
+		input.AlarmDescription = fmt.Sprintf("CPU utilization of %s exceeds %g%%", id, alarms.CPUUtilization)
+		input.MetricName = "CPUUtilization"
+		input.Statistic = "Average"
+		input.Threshold = alarms.CPUUtilization
+	case statusCheckAlarm:
+		input.AlarmDescription = fmt.Sprintf("Status checks of %s failed", id)
+		input.MetricName = "StatusCheckFailed"
+		input.Statistic = "Maximum"
+		input.Threshold = 0
+	case recoverAlarm:
+		input.AlarmDescription = fmt.Sprintf("System status checks of %s failed, recovering it", id)
+		input.MetricName = "StatusCheckFailed_System"
+		input.Statistic = "Minimum"
+		input.Threshold = 0
+		input.AlarmActions = append([]string{recoverAction(region)}, alarms.Actions...)
+	}
+	return input
+}
+
+func (p awsInstancePlugin) createAlarms(id instance.ID, alarms *Alarms) error {
+	for _, kind := range alarms.kinds() {
+		if err := p.alarms.PutMetricAlarm(alarmInput(id, kind, *alarms, p.alarms.Region())); err != nil {
+			return fmt.Errorf("Failed to create %s alarm of instance %s: %s", kind, id, err)
+		}
+	}
+	return nil
+}
+
+// deleteAlarms deletes the alarms recorded in the tags of an instance.  Failures are logged rather than returned,
+// since they must not prevent the instance from being destroyed.
+func (p awsInstancePlugin) deleteAlarms(id instance.ID) {
+	if p.alarms == nil {
+		return
+	}
+
+	ec2Instance, err := p.describeInstance(id)
+	if err != nil {
+		// Failures to find the instance are reported when terminating it.
+		return
+	}
+
+	names := alarmNames(ec2Instance)
+	if len(names) == 0 {
+		return
+	}
+
+	if err := p.alarms.DeleteAlarms(&deleteAlarmsInput{AlarmNames: names}); err != nil {
+		log.Warnf("Failed to delete alarms %s of instance %s: %s", strings.Join(names, ", "), id, err)
+	}
+}
+
+// alarmNames returns the names of the alarms recorded in the tags of an instance.
+func alarmNames(ec2Instance *ec2.Instance) []string {
+	names := []string{}
+	for _, tag := range ec2Instance.Tags {
+		if aws.StringValue(tag.Key) != AlarmsTag {
+			continue
+		}
+		for _, kind := range strings.Split(aws.StringValue(tag.Value), ",") {
+			names = append(names, alarmName(instance.ID(*ec2Instance.InstanceId), kind))
+		}
+	}
+	return names
+}
+
+// DeleteAlarms deletes the alarms of instances that are terminated without the plugin, such as when a cluster is
+// destroyed.
+func DeleteAlarms(config client.ConfigProvider, instances []*ec2.Instance) error {
+	names := []string{}
+	for _, ec2Instance := range instances {
+		names = append(names, alarmNames(ec2Instance)...)
+	}
+
+	// Up to 100 alarms are deleted by each request.
+	alarms := newCloudWatchAlarms(config)
+	for start := 0; start < len(names); start += 100 {
+		end := start + 100
+		if end > len(names) {
+			end = len(names)
+		}
+		if err := alarms.DeleteAlarms(&deleteAlarmsInput{AlarmNames: names[start:end]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
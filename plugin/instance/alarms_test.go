@@ -0,0 +1,130 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/query/queryutil"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+// fakeAlarms records the alarms that exist.
+type fakeAlarms struct {
+	alarms map[string]*putMetricAlarmInput
+}
+
+func (f *fakeAlarms) PutMetricAlarm(input *putMetricAlarmInput) error {
+	f.alarms[input.AlarmName] = input
+	return nil
+}
+
+func (f *fakeAlarms) DeleteAlarms(input *deleteAlarmsInput) error {
+	for _, name := range input.AlarmNames {
+		delete(f.alarms, name)
+	}
+	return nil
+}
+
+func (f *fakeAlarms) Region() string {
+	return "us-west-2"
+}
+
+func TestAlarms(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	alarms := &fakeAlarms{alarms: map[string]*putMetricAlarmInput{}}
+	pluginImpl := &awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		subnets:       newSubnetCache(),
+		provisions:    newProvisionLimiter(0),
+		slots:         newSlotAllocator(),
+		alarms:        alarms,
+	}
+
+	properties := json.RawMessage(`{
+		"Alarms": {"CPUUtilization": 90, "StatusCheckFailed": true, "Actions": ["arn:aws:sns:us-west-2:1:alarms"]}
+	}`)
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+	require.Len(t, alarms.alarms, 2)
+
+	cpu := alarms.alarms["infrakit-i-1-cpu"]
+	require.NotNil(t, cpu)
+	require.Equal(t, "CPUUtilization", cpu.MetricName)
+	require.Equal(t, 90.0, cpu.Threshold)
+	require.Equal(t, int64(defaultAlarmPeriod), cpu.Period)
+	require.Equal(t, []alarmDimension{{Name: "InstanceId", Value: "i-1"}}, cpu.Dimensions)
+	require.Equal(t, []string{"arn:aws:sns:us-west-2:1:alarms"}, cpu.AlarmActions)
+	require.Equal(t, "StatusCheckFailed", alarms.alarms["infrakit-i-1-status-check"].MetricName)
+
+	params := requestParams(t, runRequest)
+	tagged := false
+	for key, values := range params {
+		if values[0] == AlarmsTag {
+			tagged = params.Get(key[:len(key)-len("Key")]+"Value") == "cpu,status-check"
+		}
+	}
+	require.True(t, tagged)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse([][]string{{"i-1"}}, map[string]string{AlarmsTag: "cpu,status-check"}, nil), nil)
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(gomock.Any()).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("i-1")}}},
+			nil)
+
+	require.NoError(t, pluginImpl.Destroy(*id))
+	require.Empty(t, alarms.alarms)
+}
+
+func TestAlarmsRequireClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pluginImpl := NewInstancePlugin(mock_ec2.NewMockEC2API(ctrl), testNamespace)
+
+	properties := json.RawMessage(`{"Alarms": {"StatusCheckFailed": true}}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.Error(t, err)
+}
+
+func TestAlarmQueryParams(t *testing.T) {
+	params := url.Values{}
+	input := alarmInput("i-1", cpuAlarm, Alarms{CPUUtilization: 75, Period: 60}, "us-west-2")
+	require.NoError(t, queryutil.Parse(params, input, false))
+
+	require.Equal(t, "infrakit-i-1-cpu", params.Get("AlarmName"))
+	require.Equal(t, "InstanceId", params.Get("Dimensions.member.1.Name"))
+	require.Equal(t, "i-1", params.Get("Dimensions.member.1.Value"))
+	require.Equal(t, "75", params.Get("Threshold"))
+	require.Equal(t, "60", params.Get("Period"))
+	require.Equal(t, "2", params.Get("EvaluationPeriods"))
+	_, hasActions := params["AlarmActions"]
+	require.False(t, hasActions)
+}
+
+func TestRecoverAlarm(t *testing.T) {
+	alarms := Alarms{Recover: true, Actions: []string{"arn:aws:sns:us-west-2:1:alarms"}}
+	require.Equal(t, []string{recoverAlarm}, alarms.kinds())
+
+	input := alarmInput("i-1", recoverAlarm, alarms, "us-west-2")
+	require.Equal(t, "infrakit-i-1-recover", input.AlarmName)
+	require.Equal(t, "StatusCheckFailed_System", input.MetricName)
+	require.Equal(t, []string{"arn:aws:automate:us-west-2:ec2:recover", "arn:aws:sns:us-west-2:1:alarms"},
+		input.AlarmActions)
+	require.Equal(t, []string{"arn:aws:sns:us-west-2:1:alarms"}, input.OKActions)
+}
@@ -0,0 +1,259 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+	"time"
+)
+
+const (
+	// SnapshotTimeTag is the AWS tag name used to record when a backup snapshot of a volume was taken, in RFC 3339
+	// format.
+	SnapshotTimeTag = "infrakit.snapshot-time"
+
+	defaultRetainedSnapshots = 7
+)
+
+// BackupOptions controls the backup of volumes.
+type BackupOptions struct {
+	// Retain is the number of snapshots of each volume kept, deleting older snapshots, defaulting to 7.
+	Retain int
+}
+
+// Backuper snapshots the volumes attached to instances by their attachment IDs, such as the data volumes of
+// managers.
+type Backuper interface {
+	// Backup snapshots the volumes in the plugin's namespace that have the VolumeTag tag, tagging each snapshot with
+	// the namespace and attachment ID of its volume and the time it was taken.  Older snapshots of each volume are
+	// then deleted, keeping the newest.
+	Backup(options BackupOptions) error
+}
+
+// namespaceFilters are the filters of resources tagged with the namespace of the plugin.
+func (p awsInstancePlugin) namespaceFilters() []*ec2.Filter {
+	keys, tags := mergeTags(p.namespaceTags)
+	filters := []*ec2.Filter{}
+	for _, key := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", key)),
+			Values: []*string{aws.String(tags[key])},
+		})
+	}
+	return filters
+}
+
+func tagValue(tags []*ec2.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+// snapshotsByAge sorts snapshots from newest to oldest.
+type snapshotsByAge []*ec2.Snapshot
+
+func (s snapshotsByAge) Len() int      { return len(s) }
+func (s snapshotsByAge) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s snapshotsByAge) Less(i, j int) bool {
+	return aws.TimeValue(s[i].StartTime).After(aws.TimeValue(s[j].StartTime))
+}
+
+// snapshots returns the backup snapshots of the volume of an attachment, newest first.
+func (p awsInstancePlugin) snapshots(attachment string) ([]*ec2.Snapshot, error) {
+	filters := append(p.namespaceFilters(), &ec2.Filter{
+		Name:   aws.String(fmt.Sprintf("tag:%s", VolumeTag)),
+		Values: []*string{aws.String(attachment)},
+	})
+
+	snapshots := []*ec2.Snapshot{}
+	err := p.client.DescribeSnapshotsPages(
+		&ec2.DescribeSnapshotsInput{OwnerIds: []*string{aws.String("self")}, Filters: filters},
+		func(page *ec2.DescribeSnapshotsOutput, lastPage bool) bool {
+			snapshots = append(snapshots, page.Snapshots...)
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(snapshotsByAge(snapshots))
+	return snapshots, nil
+}
+
+// snapshotVolume snapshots a volume, tagging the snapshot such that it may be found to restore the volume.
+func (p awsInstancePlugin) snapshotVolume(volume *ec2.Volume, attachment string, taken time.Time) error {
+	snapshot, err := p.client.CreateSnapshot(&ec2.CreateSnapshotInput{
+		VolumeId:    volume.VolumeId,
+		Description: aws.String(fmt.Sprintf("InfraKit backup of %s", attachment)),
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Snapshot %s of volume %s of %s", *snapshot.SnapshotId, *volume.VolumeId, attachment)
+
+	_, err = p.client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{snapshot.SnapshotId},
+		Tags: p.ec2Tags(map[string]string{
+			VolumeTag:       attachment,
+			SnapshotTimeTag: taken.UTC().Format(time.RFC3339),
+		}, nil),
+	})
+	return err
+}
+
+// pruneSnapshots deletes all but the newest snapshots of the volume of an attachment.
+func (p awsInstancePlugin) pruneSnapshots(attachment string, retain int) error {
+	snapshots, err := p.snapshots(attachment)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) <= retain {
+		return nil
+	}
+
+	for _, snapshot := range snapshots[retain:] {
+		_, err := p.client.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: snapshot.SnapshotId})
+		if err != nil {
+			return fmt.Errorf("Failed to delete snapshot %s of %s: %s", *snapshot.SnapshotId, attachment, err)
+		}
+		log.Infof("Deleted snapshot %s of %s", *snapshot.SnapshotId, attachment)
+	}
+	return nil
+}
+
+// Backup implements Backuper.Backup.
+func (p awsInstancePlugin) Backup(options BackupOptions) error {
+	retain := options.Retain
+	if retain <= 0 {
+		retain = defaultRetainedSnapshots
+	}
+
+	volumes, err := p.client.DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: append(p.namespaceFilters(), &ec2.Filter{
+			Name:   aws.String("tag-key"),
+			Values: []*string{aws.String(VolumeTag)},
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	taken := time.Now()
+	for _, volume := range volumes.Volumes {
+		attachment := tagValue(volume.Tags, VolumeTag)
+		if err := p.snapshotVolume(volume, attachment, taken); err != nil {
+			return fmt.Errorf("Failed to snapshot volume %s of %s: %s", *volume.VolumeId, attachment, err)
+		}
+		if err := p.pruneSnapshots(attachment, retain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// launchAvailabilityZone determines the availability zone an instance is launched in, which volumes attached to it
+// must be created in.
+func (p awsInstancePlugin) launchAvailabilityZone(input ec2.RunInstancesInput) (string, error) {
+	if input.Placement != nil && input.Placement.AvailabilityZone != nil {
+		return *input.Placement.AvailabilityZone, nil
+	}
+
+	subnetID := input.SubnetId
+	if len(input.NetworkInterfaces) > 0 && input.NetworkInterfaces[0].SubnetId != nil {
+		subnetID = input.NetworkInterfaces[0].SubnetId
+	}
+	if subnetID == nil {
+		return "", fmt.Errorf("The availability zone of the instance is not known")
+	}
+
+	subnets, err := p.client.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: []*string{subnetID}})
+	if err != nil {
+		return "", err
+	}
+	if len(subnets.Subnets) != 1 {
+		return "", fmt.Errorf("Subnet %s not found", *subnetID)
+	}
+	return aws.StringValue(subnets.Subnets[0].AvailabilityZone), nil
+}
+
+// restoreVolume creates the volume of an attachment from its newest completed backup snapshot, in the availability
+// zone of the instance it is attached to.
+func (p awsInstancePlugin) restoreVolume(attachment instance.Attachment, zone string) (*string, error) {
+	snapshots, err := p.snapshots(string(attachment))
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *ec2.Snapshot
+	for _, snapshot := range snapshots {
+		if aws.StringValue(snapshot.State) == ec2.SnapshotStateCompleted {
+			latest = snapshot
+			break
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("No completed snapshot of %s to restore its volume from", attachment)
+	}
+
+	volume, err := p.client.CreateVolume(&ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String(zone),
+		SnapshotId:       latest.SnapshotId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Restoring volume %s of %s from snapshot %s", *volume.VolumeId, attachment, *latest.SnapshotId)
+
+	_, err = p.client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{volume.VolumeId},
+		Tags:      p.ec2Tags(map[string]string{VolumeTag: string(attachment)}, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.client.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{VolumeIds: []*string{volume.VolumeId}})
+	if err != nil {
+		return nil, fmt.Errorf("Restored volume %s of %s did not become available: %s", *volume.VolumeId, attachment, err)
+	}
+	return volume.VolumeId, nil
+}
+
+// restoreMissingVolumes restores the volumes of the attachments that have none from their backup snapshots.
+func (p awsInstancePlugin) restoreMissingVolumes(
+	attachments []instance.Attachment,
+	volumes []*ec2.Volume,
+	input ec2.RunInstancesInput) ([]*ec2.Volume, error) {
+
+	existing := map[string]bool{}
+	for _, volume := range volumes {
+		existing[tagValue(volume.Tags, VolumeTag)] = true
+	}
+
+	restored := []*ec2.Volume{}
+	zone := ""
+	for _, attachment := range attachments {
+		if existing[string(attachment)] {
+			continue
+		}
+
+		if zone == "" {
+			var err error
+			if zone, err = p.launchAvailabilityZone(input); err != nil {
+				return nil, err
+			}
+		}
+
+		volumeID, err := p.restoreVolume(attachment, zone)
+		if err != nil {
+			return nil, err
+		}
+		restored = append(restored, &ec2.Volume{VolumeId: volumeID})
+	}
+	return restored, nil
+}
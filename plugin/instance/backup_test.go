@@ -0,0 +1,95 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func expectSnapshots(clientMock *mock_ec2.MockEC2API, attachment string, snapshots ...*ec2.Snapshot) {
+	clientMock.EXPECT().DescribeSnapshotsPages(gomock.Any(), gomock.Any()).
+		Do(func(input *ec2.DescribeSnapshotsInput, fn func(*ec2.DescribeSnapshotsOutput, bool) bool) {
+			last := input.Filters[len(input.Filters)-1]
+			if aws.StringValue(last.Name) == "tag:"+VolumeTag && aws.StringValue(last.Values[0]) == attachment {
+				fn(&ec2.DescribeSnapshotsOutput{Snapshots: snapshots}, true)
+			}
+		}).
+		Return(nil)
+}
+
+func snapshotAt(id string, start time.Time, state string) *ec2.Snapshot {
+	return &ec2.Snapshot{SnapshotId: aws.String(id), StartTime: aws.Time(start), State: aws.String(state)}
+}
+
+func TestBackup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Backuper)
+
+	clientMock.EXPECT().DescribeVolumes(gomock.Any()).
+		Do(func(input *ec2.DescribeVolumesInput) {
+			require.Equal(t, "tag-key", *input.Filters[len(input.Filters)-1].Name)
+		}).
+		Return(&ec2.DescribeVolumesOutput{Volumes: []*ec2.Volume{{
+			VolumeId: aws.String("vol-1"),
+			Tags:     []*ec2.Tag{{Key: aws.String(VolumeTag), Value: aws.String("10.0.0.4")}},
+		}}}, nil)
+	clientMock.EXPECT().CreateSnapshot(gomock.Any()).
+		Return(&ec2.Snapshot{SnapshotId: aws.String("snap-3")}, nil)
+	clientMock.EXPECT().CreateTags(gomock.Any()).
+		Do(func(input *ec2.CreateTagsInput) {
+			require.Equal(t, []*string{aws.String("snap-3")}, input.Resources)
+			tags := map[string]string{}
+			for _, tag := range input.Tags {
+				tags[*tag.Key] = *tag.Value
+			}
+			require.Equal(t, "10.0.0.4", tags[VolumeTag])
+			require.Equal(t, "test", tags["cluster"])
+			_, err := time.Parse(time.RFC3339, tags[SnapshotTimeTag])
+			require.NoError(t, err)
+		}).
+		Return(&ec2.CreateTagsOutput{}, nil)
+
+	now := time.Now()
+	expectSnapshots(clientMock, "10.0.0.4",
+		snapshotAt("snap-1", now.Add(-48*time.Hour), ec2.SnapshotStateCompleted),
+		snapshotAt("snap-3", now, ec2.SnapshotStatePending),
+		snapshotAt("snap-2", now.Add(-24*time.Hour), ec2.SnapshotStateCompleted))
+	clientMock.EXPECT().DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String("snap-1")}).
+		Return(&ec2.DeleteSnapshotOutput{}, nil)
+
+	require.NoError(t, pluginImpl.Backup(BackupOptions{Retain: 2}))
+}
+
+func TestRestoreMissingVolumes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := confirmationPlugin(clientMock)
+
+	now := time.Now()
+	expectSnapshots(clientMock, "10.0.0.4",
+		snapshotAt("snap-2", now, ec2.SnapshotStatePending),
+		snapshotAt("snap-1", now.Add(-time.Hour), ec2.SnapshotStateCompleted))
+	clientMock.EXPECT().CreateVolume(&ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String("us-west-2a"),
+		SnapshotId:       aws.String("snap-1"),
+	}).Return(&ec2.Volume{VolumeId: aws.String("vol-2")}, nil)
+	clientMock.EXPECT().CreateTags(gomock.Any()).Return(&ec2.CreateTagsOutput{}, nil)
+	clientMock.EXPECT().WaitUntilVolumeAvailable(gomock.Any()).Return(nil)
+
+	restored, err := pluginImpl.restoreMissingVolumes(
+		[]instance.Attachment{"10.0.0.4"},
+		nil,
+		ec2.RunInstancesInput{Placement: &ec2.Placement{AvailabilityZone: aws.String("us-west-2a")}})
+	require.NoError(t, err)
+	require.Equal(t, []*ec2.Volume{{VolumeId: aws.String("vol-2")}}, restored)
+}
@@ -0,0 +1,208 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+	"sync"
+)
+
+// BatchResult is the outcome of provisioning or destroying one instance of a batch.
+type BatchResult struct {
+	// ID is the instance provisioned or destroyed, if any.
+	ID *instance.ID `json:",omitempty"`
+
+	// Error is the reason the instance was not provisioned or destroyed, if any.
+	Error string `json:",omitempty"`
+}
+
+// Batcher provisions and destroys instances in batches, such that a scale-up or scale-down of a group is requested
+// in one call.
+type Batcher interface {
+	// ProvisionBatch provisions an instance for each spec, returning a result for each spec in order.
+	ProvisionBatch(specs []instance.Spec) []BatchResult
+
+	// DestroyBatch destroys instances, returning a result for each instance in order.
+	DestroyBatch(ids []instance.ID) []BatchResult
+}
+
+func batchResult(id *instance.ID, err error) BatchResult {
+	if err != nil {
+		return BatchResult{ID: id, Error: err.Error()}
+	}
+	return BatchResult{ID: id}
+}
+
+// ProvisionEach provisions the instances of a batch with concurrent calls of Provision, for plugins that do not
+// provision batches themselves.  The provisions are limited by the plugin as they would be otherwise.
+func ProvisionEach(plugin instance.Plugin, specs []instance.Spec) []BatchResult {
+	results := make([]BatchResult, len(specs))
+	var wait sync.WaitGroup
+	for i := range specs {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			results[i] = batchResult(plugin.Provision(specs[i]))
+		}(i)
+	}
+	wait.Wait()
+	return results
+}
+
+// DestroyEach destroys the instances of a batch with calls of Destroy, for plugins that do not destroy batches
+// themselves.
+func DestroyEach(plugin instance.Plugin, ids []instance.ID) []BatchResult {
+	results := []BatchResult{}
+	for i := range ids {
+		results = append(results, batchResult(&ids[i], plugin.Destroy(ids[i])))
+	}
+	return results
+}
+
+// launchedTogether determines whether instances of a spec may be launched with one request, returning the number of
+// instances launched together, or zero if they are provisioned one at a time.  Instances with an identity, such as a
+// logical ID, attachments, a slot, or a fixed address, are provisioned one at a time, as are instances that are
+// balanced across zones, drawn from a warm pool, or assigned a purchase option each.
+func (p awsInstancePlugin) launchedTogether(spec instance.Spec) (int, bool) {
+	if spec.Properties == nil || spec.LogicalID != nil || len(spec.Attachments) > 0 {
+		return 0, false
+	}
+	request, err := parseRequest(*spec.Properties)
+	if err != nil {
+		return 0, false
+	}
+
+	run := request.RunInstancesInput
+	fixedAddress := run.PrivateIpAddress != nil
+	for _, networkInterface := range run.NetworkInterfaces {
+		fixedAddress = fixedAddress || networkInterface.PrivateIpAddress != nil
+	}
+	if request.Slots || request.WarmPool != nil || request.PurchaseMix != nil || request.BalanceZones ||
+		request.StaticNetworkInterface || fixedAddress {
+		return 0, false
+	}
+	return p.provisions.batchSize(request.MaxConcurrentProvisions), true
+}
+
+// ProvisionBatch implements Batcher.ProvisionBatch.  Identical specs are provisioned with one RunInstances request
+// for as many instances as the limit of concurrent provisions of their group, and the instances are tagged by the
+// request.  Instances that EC2 does not launch for lack of capacity are provisioned one at a time.
+func (p awsInstancePlugin) ProvisionBatch(specs []instance.Spec) []BatchResult {
+	// Specs are identical if they encode the same.
+	runs := map[string][]int{}
+	keys := []string{}
+	for i, spec := range specs {
+		encoded, err := json.Marshal(spec)
+		key := string(encoded)
+		if err != nil {
+			key = err.Error()
+		}
+		if _, has := runs[key]; !has {
+			keys = append(keys, key)
+		}
+		runs[key] = append(runs[key], i)
+	}
+
+	results := make([]BatchResult, len(specs))
+	var wait sync.WaitGroup
+	for _, key := range keys {
+		run := runs[key]
+		size, together := p.launchedTogether(specs[run[0]])
+		if !together || len(run) == 1 {
+			size = 1
+		} else if size == 0 {
+			size = len(run)
+		}
+
+		for start := 0; start < len(run); start += size {
+			end := start + size
+			if end > len(run) {
+				end = len(run)
+			}
+			wait.Add(1)
+			go func(indexes []int) {
+				defer wait.Done()
+				for n, result := range p.provisionTogether(specs[indexes[0]], len(indexes)) {
+					results[indexes[n]] = result
+				}
+			}(run[start:end])
+		}
+	}
+	wait.Wait()
+	return results
+}
+
+// provisionTogether provisions count instances of a spec, launching them with one request.
+func (p awsInstancePlugin) provisionTogether(spec instance.Spec, count int) []BatchResult {
+	if count == 1 {
+		return []BatchResult{batchResult(p.Provision(spec))}
+	}
+
+	results := []BatchResult{}
+	launched, err := p.provisionCount(spec, count)
+	for _, result := range launched {
+		p.notifyProvision(spec, result.id, result.err)
+		results = append(results, batchResult(result.id, result.err))
+	}
+	for len(results) < count {
+		if err != nil {
+			p.notifyProvision(spec, nil, err)
+			results = append(results, batchResult(nil, err))
+		} else {
+			results = append(results, batchResult(p.Provision(spec)))
+		}
+	}
+	return results
+}
+
+// DestroyBatch implements Batcher.DestroyBatch.
+func (p awsInstancePlugin) DestroyBatch(ids []instance.ID) []BatchResult {
+	return DestroyEach(p, ids)
+}
+
+// ProvisionBatch implements Batcher.ProvisionBatch, holding the lease of each group while its instances of the batch
+// are provisioned.
+func (p *lockedPlugin) ProvisionBatch(specs []instance.Spec) []BatchResult {
+	batcher, is := p.Plugin.(Batcher)
+	if !is {
+		return ProvisionEach(p, specs)
+	}
+
+	byGroup := map[string][]int{}
+	for i, spec := range specs {
+		key := groupLockKey(spec.Tags)
+		byGroup[key] = append(byGroup[key], i)
+	}
+	keys := []string{}
+	for key := range byGroup {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	results := make([]BatchResult, len(specs))
+	for _, key := range keys {
+		group := []instance.Spec{}
+		for _, i := range byGroup[key] {
+			group = append(group, specs[i])
+		}
+
+		var groupResults []BatchResult
+		err := p.withLease(key, func(leaseLoss) error {
+			groupResults = batcher.ProvisionBatch(group)
+			return nil
+		})
+		for n, i := range byGroup[key] {
+			if err != nil {
+				results[i] = batchResult(nil, err)
+			} else {
+				results[i] = groupResults[n]
+			}
+		}
+	}
+	return results
+}
+
+// DestroyBatch implements Batcher.DestroyBatch.  Each instance is destroyed holding the lease of its group.
+func (p *lockedPlugin) DestroyBatch(ids []instance.ID) []BatchResult {
+	return DestroyEach(p, ids)
+}
@@ -0,0 +1,159 @@
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// maxCountMatcher matches requests launching up to a number of instances.
+type maxCountMatcher int64
+
+func maxCount(count int64) gomock.Matcher {
+	return maxCountMatcher(count)
+}
+
+func (m maxCountMatcher) Matches(x interface{}) bool {
+	input, is := x.(*ec2.RunInstancesInput)
+	return is && aws.Int64Value(input.MinCount) == 1 && aws.Int64Value(input.MaxCount) == int64(m)
+}
+
+func (m maxCountMatcher) String() string {
+	return fmt.Sprintf("launches up to %d instances", int64(m))
+}
+
+func TestLockedProvisionBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	locker := &fakeLocker{held: map[string]bool{"group/managers": true}}
+	pluginImpl := NewLockedPlugin(NewInstancePlugin(clientMock, testNamespace), locker, 0).(Batcher)
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	results := pluginImpl.ProvisionBatch([]instance.Spec{
+		{Properties: &inputJSON, Tags: map[string]string{GroupTag: "managers"}},
+		{Properties: &inputJSON, Tags: map[string]string{GroupTag: "workers"}},
+	})
+	require.Len(t, results, 2)
+
+	// The instances of each group are provisioned holding its lease.
+	require.Nil(t, results[0].ID)
+	require.Contains(t, results[0].Error, "Failed to acquire lease of group/managers")
+	require.Equal(t, instance.ID("i-1"), *results[1].ID)
+	require.Empty(t, results[1].Error)
+	require.Equal(t, []string{"group/workers"}, locker.acquired)
+}
+
+func TestProvisionBatchTogether(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Batcher)
+
+	workers := instance.Spec{Properties: &inputJSON, Tags: map[string]string{GroupTag: "workers"}}
+	logicalID := instance.LogicalID("10.0.0.5")
+	manager := instance.Spec{Properties: &inputJSON, Tags: map[string]string{GroupTag: "managers"}, LogicalID: &logicalID}
+
+	// The identical specs of workers are launched with one request, and EC2 launches two of the three instances.
+	clientMock.EXPECT().RunInstancesRequest(maxCount(3)).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{
+			{InstanceId: aws.String("i-1")},
+			{InstanceId: aws.String("i-2")},
+		}})
+	clientMock.EXPECT().RunInstancesRequest(maxCount(1)).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-3")}}})
+	clientMock.EXPECT().RunInstancesRequest(maxCount(1)).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-4")}}})
+
+	results := pluginImpl.ProvisionBatch([]instance.Spec{workers, manager, workers, workers})
+	require.Len(t, results, 4)
+	ids := []instance.ID{}
+	for _, result := range results {
+		require.Empty(t, result.Error)
+		ids = append(ids, *result.ID)
+	}
+	workerIDs := []string{string(ids[0]), string(ids[2]), string(ids[3])}
+	sort.Strings(workerIDs)
+	require.Equal(t, "i-1", workerIDs[0])
+	require.Equal(t, "i-2", workerIDs[1])
+	require.NotEqual(t, ids[1], instance.ID(workerIDs[2]))
+}
+
+func TestProvisionBatchConcurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(*awsInstancePlugin)
+	pluginImpl.provisions = newProvisionLimiter(2)
+
+	lock := sync.Mutex{}
+	launching := int64(0)
+	peak := int64(0)
+	launch := func(input *ec2.RunInstancesInput) {
+		lock.Lock()
+		launching += aws.Int64Value(input.MaxCount)
+		if launching > peak {
+			peak = launching
+		}
+		lock.Unlock()
+
+		time.Sleep(25 * time.Millisecond)
+
+		lock.Lock()
+		launching -= aws.Int64Value(input.MaxCount)
+		lock.Unlock()
+	}
+	for i := 0; i < 3; i++ {
+		clientMock.EXPECT().RunInstancesRequest(maxCount(2)).Do(launch).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{
+				{InstanceId: aws.String(fmt.Sprintf("i-%d", 2*i))},
+				{InstanceId: aws.String(fmt.Sprintf("i-%d", 2*i+1))},
+			}})
+	}
+
+	workers := instance.Spec{Properties: &inputJSON, Tags: map[string]string{GroupTag: "workers"}}
+	results := pluginImpl.ProvisionBatch([]instance.Spec{workers, workers, workers, workers, workers, workers})
+	for _, result := range results {
+		require.Empty(t, result.Error)
+	}
+
+	// Each launch of two instances holds two of the provision slots of the group, so the launches do not overlap.
+	require.Equal(t, int64(2), peak)
+}
+
+func TestLaunchedTogether(t *testing.T) {
+	pluginImpl := awsInstancePlugin{provisions: newProvisionLimiter(5)}
+
+	size, together := pluginImpl.launchedTogether(instance.Spec{Properties: &inputJSON})
+	require.True(t, together)
+	require.Equal(t, 5, size)
+
+	for _, properties := range []string{
+		`{"Slots": true}`,
+		`{"BalanceZones": true, "AvailabilityZones": ["us-west-2a", "us-west-2b"]}`,
+		`{"RunInstancesInput": {"PrivateIpAddress": "10.0.0.5"}}`,
+	} {
+		raw := json.RawMessage(properties)
+		_, together := pluginImpl.launchedTogether(instance.Spec{Properties: &raw})
+		require.False(t, together, properties)
+	}
+
+	raw := json.RawMessage(`{"MaxConcurrentProvisions": -1}`)
+	size, together = pluginImpl.launchedTogether(instance.Spec{Properties: &raw})
+	require.True(t, together)
+	require.Equal(t, 0, size)
+}
@@ -2,30 +2,71 @@ package instance
 
 import (
 	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"github.com/docker/infrakit.aws/plugin/audit"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+	"github.com/docker/infrakit.aws/plugin/lock"
+	"github.com/docker/infrakit.aws/plugin/notify"
 	"github.com/docker/infrakit/spi/instance"
 	"github.com/spf13/pflag"
+	"io/ioutil"
 	"log"
 	"os"
+	"time"
 )
 
 type options struct {
-	region          string
-	accessKeyID     string
-	secretAccessKey string
-	sessionToken    string
-	retries         int
+	region             string
+	accessKeyID        string
+	secretAccessKey    string
+	sessionToken       string
+	roleARN            string
+	retries            int
+	lockTable          string
+	lockTTL            time.Duration
+	lockTimeout        time.Duration
+	describeDetails    bool
+	terminateProtected bool
+	quorumGroups       []string
+	describeFilters    []string
+	forceQuorumDestroy bool
+	auditFile          string
+	auditLogGroup      string
+	auditLogStream     string
+	notifyTopicARN     string
+	notifyQueueURL     string
+	maxProvisions      int
+	zoneFailures       int
+	zoneCooldown       time.Duration
+	describeCacheTTL   time.Duration
+	http               httpOptions
+	webIdentity        webIdentityOptions
+	credentials        credentialOptions
+	guardrails         guardrailOptions
+	tagPolicyTemplate  string
 }
 
 // Builder is a ProvisionerBuilder that creates an AWS instance provisioner.
 type Builder struct {
-	Config  client.ConfigProvider
+	Config client.ConfigProvider
+
+	// TagPolicy computes the tags and names of provisioned instances, in place of --tag-policy-template, if set.
+	TagPolicy TagPolicy
+
 	options options
 }
 
@@ -36,50 +77,394 @@ func (b *Builder) Flags() *pflag.FlagSet {
 	flags.StringVar(&b.options.accessKeyID, "access-key-id", "", "IAM access key ID")
 	flags.StringVar(&b.options.secretAccessKey, "secret-access-key", "", "IAM access key secret")
 	flags.StringVar(&b.options.sessionToken, "session-token", "", "AWS STS token")
+	flags.StringVar(&b.options.roleARN, "role-arn", "", "IAM role to assume for AWS API operations")
 	flags.IntVar(&b.options.retries, "retries", 5, "Number of retries for AWS API operations")
+	flags.StringVar(
+		&b.options.lockTable,
+		"lock-table",
+		"",
+		"DynamoDB table used to serialize group operations across plugins, created if it does not exist")
+	flags.DurationVar(&b.options.lockTTL, "lock-ttl", 5*time.Minute, "Duration of group operation leases")
+	flags.DurationVar(&b.options.lockTimeout, "lock-timeout", 10*time.Minute, "Maximum wait for a group operation lease")
+	flags.BoolVar(
+		&b.options.describeDetails,
+		"describe-details",
+		false,
+		"Include instance details, such as IP addresses and availability zone, in tags of instance descriptions")
+	flags.BoolVar(
+		&b.options.terminateProtected,
+		"terminate-protected",
+		false,
+		"Disable termination protection of instances being destroyed, rather than failing to destroy them")
+	flags.StringSliceVar(
+		&b.options.quorumGroups,
+		"quorum-groups",
+		[]string{},
+		"A list of group=size manager groups whose instances are not destroyed below quorum")
+	flags.BoolVar(
+		&b.options.forceQuorumDestroy,
+		"force-quorum-destroy",
+		false,
+		"Destroy instances of --quorum-groups even when leaving fewer live instances than a quorum")
+	flags.StringVar(&b.options.auditFile, "audit-file", "", "Local file to record mutating AWS API calls in")
+	flags.StringVar(
+		&b.options.auditLogGroup,
+		"audit-log-group",
+		"",
+		"CloudWatch Logs group to record mutating AWS API calls in")
+	flags.StringVar(
+		&b.options.auditLogStream,
+		"audit-log-stream",
+		"",
+		"CloudWatch Logs stream of audit records, defaulting to the hostname")
+	flags.StringVar(
+		&b.options.notifyTopicARN,
+		"notify-topic-arn",
+		"",
+		"SNS topic to publish the outcomes of instance provisions and destructions to")
+	flags.StringVar(
+		&b.options.notifyQueueURL,
+		"notify-queue-url",
+		"",
+		"SQS queue to send the outcomes of instance provisions and destructions to")
+	flags.IntVar(
+		&b.options.maxProvisions,
+		"max-concurrent-provisions",
+		0,
+		"Maximum number of instances of a group provisioned at the same time, or 0 for no limit")
+	flags.IntVar(
+		&b.options.zoneFailures,
+		"zone-failure-threshold",
+		0,
+		"Consecutive launch or health failures in an availability zone that remove it from placement, or 0 to disable")
+	flags.DurationVar(
+		&b.options.zoneCooldown,
+		"zone-cooldown",
+		10*time.Minute,
+		"Duration a failed availability zone is removed from placement before it is probed again")
+	flags.DurationVar(
+		&b.options.describeCacheTTL,
+		"describe-cache-ttl",
+		0,
+		"Duration the instances of a group are cached between DescribeInstances calls, or 0 to disable caching")
+	flags.StringSliceVar(
+		&b.options.describeFilters,
+		"describe-filters",
+		[]string{},
+		"A list of group:name=value EC2 filters added to the DescribeInstances calls of a group, or of every group with *")
+	b.options.http.flags(flags)
+	flags.StringVar(
+		&b.options.webIdentity.tokenFile,
+		"web-identity-token-file",
+		"",
+		"OIDC token file used to assume --web-identity-role-arn, defaulting to AWS_WEB_IDENTITY_TOKEN_FILE")
+	flags.StringVar(
+		&b.options.webIdentity.roleARN,
+		"web-identity-role-arn",
+		"",
+		"IAM role assumed with the web identity token, defaulting to AWS_ROLE_ARN")
+	flags.StringVar(
+		&b.options.webIdentity.sessionName,
+		"web-identity-session-name",
+		"",
+		"Session name of the web identity role, defaulting to AWS_ROLE_SESSION_NAME")
+	b.options.credentials.flags(flags)
+	b.options.guardrails.flags(flags)
+	flags.StringVar(
+		&b.options.tagPolicyTemplate,
+		"tag-policy-template",
+		"",
+		"Template file of a JSON or YAML object of the tags of provisioned instances, computed from their group and slot")
 	return flags
 }
 
+// ConfigProvider returns the AWS client configuration of the Flags, for plugins of other resources sharing the
+// credentials and region of the instance plugin.
+func (b *Builder) ConfigProvider() (client.ConfigProvider, error) {
+	if err := b.configure(); err != nil {
+		return nil, err
+	}
+	return b.Config, nil
+}
+
+// configure creates the AWS client configuration of the Flags, unless Config is set.
+func (b *Builder) configure() error {
+	if b.Config != nil {
+		return nil
+	}
+
+	region, err := resolveRegion(b.options.region, GetRegion)
+	if err != nil {
+		return err
+	}
+	b.options.region = region
+
+	httpClient, err := b.options.http.client()
+	if err != nil {
+		return err
+	}
+
+	expiring := map[string]expiringProvider{}
+	providers := []credentials.Provider{
+		&ec2rolecreds.EC2RoleProvider{
+			Client:       ec2metadata.New(session.New()),
+			ExpiryWindow: b.options.credentials.renewWindow,
+		},
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{},
+	}
+
+	if (len(b.options.accessKeyID) > 0 && len(b.options.secretAccessKey) > 0) || len(b.options.sessionToken) > 0 {
+		staticCreds := credentials.StaticProvider{
+			Value: credentials.Value{
+				AccessKeyID:     b.options.accessKeyID,
+				SecretAccessKey: b.options.secretAccessKey,
+				SessionToken:    b.options.sessionToken,
+			},
+		}
+		providers = append(providers, &staticCreds)
+	}
+
+	// Instances running pods also have an instance role, so web identity credentials are tried first.
+	webIdentity := b.options.webIdentity.fromEnvironment()
+	useWebIdentity, err := webIdentity.configured()
+	if err != nil {
+		return err
+	}
+	if useWebIdentity {
+		log.Printf("Assuming role %s with web identity token %s\n", webIdentity.roleARN, webIdentity.tokenFile)
+		stsClient := sts.New(session.New(request.WithRetryer(aws.NewConfig().
+			WithRegion(b.options.region).
+			WithCredentials(credentials.AnonymousCredentials).
+			WithLogger(GetLogger()).
+			WithHTTPClient(httpClient),
+			awserrors.NewRetryer(b.options.retries))))
+		webIdentityProvider := newWebIdentityProvider(stsClient, webIdentity)
+		webIdentityProvider.renewWindow = b.options.credentials.renewWindow
+		expiring[WebIdentityProviderName] = webIdentityProvider
+		providers = append([]credentials.Provider{webIdentityProvider}, providers...)
+	}
+
+	creds := credentials.NewChainCredentials(providers)
+	b.Config = session.New(request.WithRetryer(aws.NewConfig().
+		WithRegion(b.options.region).
+		WithCredentials(creds).
+		WithLogger(GetLogger()).
+		//WithLogLevel(aws.LogDebugWithRequestErrors).
+		WithHTTPClient(httpClient),
+		awserrors.NewRetryer(b.options.retries)))
+
+	if b.options.roleARN != "" {
+		log.Printf("Assuming role %s\n", b.options.roleARN)
+		roleProvider := newAssumedRoleProvider(sts.New(b.Config), b.options.roleARN, b.options.credentials)
+		expiring[stscreds.ProviderName] = roleProvider
+		creds = credentials.NewCredentials(roleProvider)
+		b.Config = session.New(request.WithRetryer(aws.NewConfig().
+			WithRegion(b.options.region).
+			WithCredentials(creds).
+			WithLogger(GetLogger()).
+			WithHTTPClient(httpClient),
+			awserrors.NewRetryer(b.options.retries)))
+	}
+
+	if b.options.credentials.checkInterval > 0 {
+		monitor := newCredentialMonitor(creds, sts.New(b.Config), b.options.credentials.expiryWarning, expiring)
+		go monitor.run(b.options.credentials.checkInterval)
+	}
+
+	if b.options.guardrails.configured() {
+		guard := newAccountGuard(b.options.guardrails, sts.New(b.Config))
+		if err := guard.verify(b.options.region); err != nil {
+			return err
+		}
+		log.Printf("Verified the account and region %s of the AWS credentials, verifying them before mutating calls\n",
+			b.options.region)
+		// Clients copy the handlers of the session, so the guard applies to the clients of other plugins sharing the
+		// configuration.
+		if sess, is := b.Config.(*session.Session); is {
+			guard.install(&sess.Handlers)
+		}
+	}
+	return nil
+}
+
 // BuildInstancePlugin creates an instance Provisioner configured with the Flags.
 func (b *Builder) BuildInstancePlugin(namespaceTags map[string]string) (instance.Plugin, error) {
-	if b.Config == nil {
-		providers := []credentials.Provider{
-			&ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(session.New())},
-			&credentials.EnvProvider{},
-			&credentials.SharedCredentialsProvider{},
+	if err := b.configure(); err != nil {
+		return nil, err
+	}
+
+	ec2Client := ec2.New(b.Config)
+	elbClient := elbv2.New(b.Config)
+	dynamoClient := dynamodb.New(b.Config)
+	alarms := newCloudWatchAlarms(b.Config)
+
+	sink, err := b.auditSink()
+	if err != nil {
+		return nil, err
+	}
+	if sink != nil {
+		caller := callerIdentity(b.Config)
+		log.Printf("Recording mutating AWS API calls made as %s\n", caller)
+		for _, handlers := range []*request.Handlers{
+			&ec2Client.Handlers,
+			&elbClient.Handlers,
+			&dynamoClient.Handlers,
+			&alarms.client.Handlers,
+		} {
+			audit.Install(handlers, sink, caller)
 		}
+	}
 
-		if (len(b.options.accessKeyID) > 0 && len(b.options.secretAccessKey) > 0) || len(b.options.sessionToken) > 0 {
-			staticCreds := credentials.StaticProvider{
-				Value: credentials.Value{
-					AccessKeyID:     b.options.accessKeyID,
-					SecretAccessKey: b.options.secretAccessKey,
-					SessionToken:    b.options.sessionToken,
-				},
-			}
-			providers = append(providers, &staticCreds)
+	notifier, err := b.notifier()
+	if err != nil {
+		return nil, err
+	}
+
+	var guard *quorumGuard
+	if len(b.options.quorumGroups) > 0 {
+		groups, err := parseQuorumGroups(b.options.quorumGroups)
+		if err != nil {
+			return nil, err
 		}
+		guard = &quorumGuard{groups: groups, force: b.options.forceQuorumDestroy}
+	}
 
-		if b.options.region == "" {
-			log.Println("region not specified, attempting to discover from EC2 instance metadata")
-			region, err := GetRegion()
+	filters, err := parseDescribeFilters(b.options.describeFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	tagPolicy := b.TagPolicy
+	if tagPolicy == nil && b.options.tagPolicyTemplate != "" {
+		text, err := ioutil.ReadFile(b.options.tagPolicyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		if tagPolicy, err = NewTemplateTagPolicy(string(text)); err != nil {
+			return nil, err
+		}
+		log.Printf("Tagging instances with the tag policy of %s\n", b.options.tagPolicyTemplate)
+	}
+
+	plugin := instance.Plugin(&awsInstancePlugin{
+		client:             ec2Client,
+		elb:                elbClient,
+		namespaceTags:      namespaceTags,
+		describeDetails:    b.options.describeDetails,
+		terminateProtected: b.options.terminateProtected,
+		subnets:            newSubnetCache(),
+		provisions:         newProvisionLimiter(b.options.maxProvisions),
+		slots:              newSlotAllocator(),
+		purchases:          newPurchaseAllocator(),
+		zones:              newZoneBalancer(),
+		warmClaims:         newWarmPoolClaims(),
+		warmFills:          newWarmPoolFills(),
+		zoneHealth:         newZoneHealth(b.options.zoneFailures, b.options.zoneCooldown, notifier),
+		describeFilters:    filters,
+		describeCache:      newDescribeCache(b.options.describeCacheTTL),
+		alarms:             alarms,
+		notifier:           notifier,
+		launches:           newRecentLaunches(),
+		edge:               newEdgeClient(b.Config, ec2Client),
+		rootVolumes:        ec2ext.New(ec2Client),
+		quorum:             guard,
+		tagPolicy:          tagPolicy,
+	})
+
+	if b.options.lockTable != "" {
+		err = lock.EnsureTable(dynamoClient, b.options.lockTable)
+		if err != nil {
+			return nil, err
+		}
+
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		owner := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+		log.Printf("Serializing group operations with lock table %s as %s\n", b.options.lockTable, owner)
+		plugin = NewLockedPlugin(
+			plugin,
+			lock.NewDynamoDBLocker(dynamoClient, b.options.lockTable, owner, b.options.lockTTL),
+			b.options.lockTimeout)
+	}
+
+	return plugin, nil
+}
+
+// regionEnvironment are the environment variables that configure the region, in order of precedence.
+var regionEnvironment = []string{"AWS_REGION", "AWS_DEFAULT_REGION"}
+
+// resolveRegion determines the region of AWS API operations.  A configured region takes precedence over one set in
+// the environment, which takes precedence over the region discovered from EC2 instance metadata.  Discovery is only
+// attempted when no region is set, so the plugin may run outside of EC2.
+func resolveRegion(configured string, discover func() (string, error)) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+
+	for _, variable := range regionEnvironment {
+		if region := os.Getenv(variable); region != "" {
+			log.Printf("Using region %s from %s\n", region, variable)
+			return region, nil
+		}
+	}
+
+	log.Println("region not specified, attempting to discover from EC2 instance metadata")
+	region, err := discover()
+	if err != nil {
+		return "", fmt.Errorf("Unable to determine region, set --region or %s: %s", regionEnvironment[0], err)
+	}
+
+	log.Printf("Defaulting to local region %s\n", region)
+	return region, nil
+}
+
+// auditSink creates the sink of audit records configured with the Flags, if any.
+func (b *Builder) auditSink() (audit.Sink, error) {
+	switch {
+	case b.options.auditFile != "" && b.options.auditLogGroup != "":
+		return nil, errors.New("Only one of --audit-file and --audit-log-group may be set")
+	case b.options.auditFile != "":
+		return audit.NewFileSink(b.options.auditFile)
+	case b.options.auditLogGroup != "":
+		stream := b.options.auditLogStream
+		if stream == "" {
+			hostname, err := os.Hostname()
 			if err != nil {
-				return nil, errors.New("Unable to determine region")
+				return nil, err
 			}
-
-			log.Printf("Defaulting to local region %s\n", region)
-			b.options.region = region
+			stream = hostname
 		}
+		return audit.NewCloudWatchLogsSink(cloudwatchlogs.New(b.Config), b.options.auditLogGroup, stream), nil
+	}
+	return nil, nil
+}
 
-		b.Config = session.New(aws.NewConfig().
-			WithRegion(b.options.region).
-			WithCredentials(credentials.NewChainCredentials(providers)).
-			WithLogger(GetLogger()).
-			//WithLogLevel(aws.LogDebugWithRequestErrors).
-			WithMaxRetries(b.options.retries))
+func (b *Builder) notifier() (notify.Publisher, error) {
+	switch {
+	case b.options.notifyTopicARN != "" && b.options.notifyQueueURL != "":
+		return nil, errors.New("Only one of --notify-topic-arn and --notify-queue-url may be set")
+	case b.options.notifyTopicARN != "":
+		log.Printf("Publishing instance events to %s\n", b.options.notifyTopicARN)
+		return notify.NewSNSPublisher(b.Config, b.options.notifyTopicARN), nil
+	case b.options.notifyQueueURL != "":
+		log.Printf("Sending instance events to %s\n", b.options.notifyQueueURL)
+		return notify.NewSQSPublisher(b.Config, b.options.notifyQueueURL), nil
 	}
+	return nil, nil
+}
 
-	return NewInstancePlugin(ec2.New(b.Config), namespaceTags), nil
+// callerIdentity determines the ARN of the identity AWS API calls are made as.
+func callerIdentity(config client.ConfigProvider) string {
+	identity, err := sts.New(config).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		log.Printf("Unable to determine caller identity: %s\n", err)
+		return "unknown"
+	}
+	return aws.StringValue(identity.Arn)
 }
 
 type logger struct {
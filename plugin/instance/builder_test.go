@@ -0,0 +1,37 @@
+package instance
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestResolveRegion(t *testing.T) {
+	discovered := func() (string, error) { return "us-east-1", nil }
+	undiscoverable := func() (string, error) { return "", errors.New("not on EC2") }
+
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	region, err := resolveRegion("", discovered)
+	require.NoError(t, err)
+	require.Equal(t, "us-east-1", region)
+
+	_, err = resolveRegion("", undiscoverable)
+	require.Error(t, err)
+
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+	region, err = resolveRegion("", undiscoverable)
+	require.NoError(t, err)
+	require.Equal(t, "eu-west-1", region)
+
+	t.Setenv("AWS_REGION", "eu-central-1")
+	region, err = resolveRegion("", undiscoverable)
+	require.NoError(t, err)
+	require.Equal(t, "eu-central-1", region)
+
+	// A configured region takes precedence over the environment.
+	region, err = resolveRegion("us-west-2", undiscoverable)
+	require.NoError(t, err)
+	require.Equal(t, "us-west-2", region)
+}
@@ -0,0 +1,89 @@
+package instance
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"sync"
+	"time"
+)
+
+// describeCache caches the instances matching the tags of DescribeInstances calls, so that the polling of group
+// membership does not describe every instance each time.  Entries are dropped whenever the plugin changes an
+// instance, but changes made elsewhere are only seen once an entry expires.
+type describeCache struct {
+	lock sync.Mutex
+	ttl  time.Duration
+	now  func() time.Time
+
+	// generation is incremented when entries are invalidated, so that a describe started before a change does not
+	// store its result.
+	generation uint64
+	entries    map[string]describeCacheEntry
+}
+
+type describeCacheEntry struct {
+	instances []*ec2.Instance
+	expires   time.Time
+}
+
+// newDescribeCache creates a cache whose entries expire after a TTL.  There is no cache when the TTL is not positive.
+func newDescribeCache(ttl time.Duration) *describeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &describeCache{ttl: ttl, now: time.Now, entries: map[string]describeCacheEntry{}}
+}
+
+// describeCacheKey identifies the instances matching tags.
+func describeCacheKey(namespaceTags, tags map[string]string) string {
+	keys, allTags := mergeTags(tags, namespaceTags)
+	key := bytes.Buffer{}
+	for _, k := range keys {
+		key.WriteString(k)
+		key.WriteByte(0)
+		key.WriteString(allTags[k])
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+// lookup returns the cached instances of a key, and the generation to store a result with when they are not cached.
+func (c *describeCache) lookup(key string) ([]*ec2.Instance, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, has := c.entries[key]
+	if has && c.now().Before(entry.expires) {
+		return entry.instances, c.generation, true
+	}
+	delete(c.entries, key)
+	return nil, c.generation, false
+}
+
+// store caches the instances of a key, unless the cache was invalidated since the generation was looked up.
+func (c *describeCache) store(key string, generation uint64, instances []*ec2.Instance) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation == c.generation {
+		c.entries[key] = describeCacheEntry{instances: instances, expires: c.now().Add(c.ttl)}
+	}
+}
+
+// invalidate drops all entries, since a change to an instance may affect the results of any key.
+func (c *describeCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	c.entries = map[string]describeCacheEntry{}
+}
@@ -0,0 +1,81 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDescribeCacheExpiry(t *testing.T) {
+	require.Nil(t, newDescribeCache(0))
+
+	now := time.Now()
+	cache := newDescribeCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	_, generation, cached := cache.lookup("workers")
+	require.False(t, cached)
+	cache.store("workers", generation, []*ec2.Instance{{InstanceId: aws.String("i-1")}})
+
+	instances, _, cached := cache.lookup("workers")
+	require.True(t, cached)
+	require.Len(t, instances, 1)
+
+	now = now.Add(time.Minute)
+	_, _, cached = cache.lookup("workers")
+	require.False(t, cached)
+
+	// A result described before an invalidation is not stored.
+	_, generation, _ = cache.lookup("workers")
+	cache.invalidate()
+	cache.store("workers", generation, []*ec2.Instance{})
+	_, _, cached = cache.lookup("workers")
+	require.False(t, cached)
+}
+
+func TestDescribeInstancesCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		describeCache: newDescribeCache(time.Minute),
+	}
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse([][]string{{"i-1"}}, tags, nil), nil)
+
+	for i := 0; i < 2; i++ {
+		descriptions, err := pluginImpl.DescribeInstances(tags)
+		require.NoError(t, err)
+		require.Len(t, descriptions, 1)
+	}
+
+	// Provisioning an instance invalidates the cache.
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-2")}}})
+	properties := json.RawMessage(`{}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse([][]string{{"i-1", "i-2"}}, tags, nil), nil)
+	descriptions, err := pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+	require.Len(t, descriptions, 2)
+
+	// Other tags are cached separately.
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse([][]string{}, nil, nil), nil)
+	descriptions, err = pluginImpl.DescribeInstances(map[string]string{"group": "other"})
+	require.NoError(t, err)
+	require.Empty(t, descriptions)
+}
@@ -0,0 +1,159 @@
+package instance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	// userDataBoundary separates the parts of multi-part user data.  It is fixed so that the same properties and
+	// init render the same user data.
+	userDataBoundary = "==INFRAKIT-USER-DATA=="
+
+	// userDataPartHeader records the source of each part of multi-part user data, so that the init of the flavor
+	// may be recovered from the user data of an instance.
+	userDataPartHeader = "X-Infrakit-Part"
+
+	// cloudConfigMergeType merges the lists and mappings of a cloud-config part into those of earlier parts, rather
+	// than replacing them.
+	cloudConfigMergeType = "list(append)+dict(no_replace,recurse_list)+str()"
+)
+
+// userDataContentTypes are the MIME types of the formats of user data that cloud-init recognizes, by their first line.
+var userDataContentTypes = []struct {
+	prefix      string
+	contentType string
+}{
+	{"#!", "text/x-shellscript"},
+	{"#cloud-config", "text/cloud-config"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#include", "text/x-include-url"},
+	{"#upstart-job", "text/upstart-job"},
+	{"#part-handler", "text/part-handler"},
+}
+
+// CloudConfig is a cloud-config section of the user data of instances.
+type CloudConfig struct {
+	// Packages are installed with the package manager of the image.
+	Packages []string `json:",omitempty"`
+
+	// WriteFiles are written before the packages are installed.
+	WriteFiles []CloudConfigFile `json:",omitempty"`
+
+	// RunCmd are shell commands run once the instance has booted.
+	RunCmd []string `json:",omitempty"`
+}
+
+// CloudConfigFile is a file written by cloud-init.
+type CloudConfigFile struct {
+	Path    string
+	Content string
+
+	// Encoding is the encoding of Content, such as b64 or gzip+b64, if it is not plain text.
+	Encoding string `json:",omitempty"`
+
+	// Permissions are the octal permissions of the file, such as 0644.
+	Permissions string `json:",omitempty"`
+
+	// Owner is the user:group owning the file.
+	Owner string `json:",omitempty"`
+}
+
+// cloudConfigDocument is the cloud-config rendered from a CloudConfig, with the keys of cloud-init.
+type cloudConfigDocument struct {
+	Hostname   string                    `json:"hostname,omitempty"`
+	Packages   []string                  `json:"packages,omitempty"`
+	WriteFiles []cloudConfigFileDocument `json:"write_files,omitempty"`
+	RunCmd     []string                  `json:"runcmd,omitempty"`
+}
+
+type cloudConfigFileDocument struct {
+	Path        string `json:"path"`
+	Content     string `json:"content"`
+	Encoding    string `json:"encoding,omitempty"`
+	Permissions string `json:"permissions,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+}
+
+func (c *CloudConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, file := range c.WriteFiles {
+		if !strings.HasPrefix(file.Path, "/") {
+			return fmt.Errorf("WriteFiles must have absolute paths: %s", file.Path)
+		}
+	}
+	return nil
+}
+
+// render renders the cloud-config, setting the hostname if it is not empty.  cloud-config is YAML, of which JSON is a
+// subset, so the document is written as JSON.
+func (c CloudConfig) render(hostname string) (string, error) {
+	document := cloudConfigDocument{Hostname: hostname, Packages: c.Packages, RunCmd: c.RunCmd}
+	for _, file := range c.WriteFiles {
+		document.WriteFiles = append(document.WriteFiles, cloudConfigFileDocument(file))
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+	return "#cloud-config\n" + string(data) + "\n", nil
+}
+
+// userDataContentType returns the MIME type of user data by its first line.  User data of an unknown format is left
+// to cloud-init to recognize.
+func userDataContentType(userData string) string {
+	for _, format := range userDataContentTypes {
+		if strings.HasPrefix(userData, format.prefix) {
+			return format.contentType
+		}
+	}
+	return "text/plain"
+}
+
+// userDataPart is a part of multi-part user data, from the CloudConfig, the properties, or the init of an instance.
+type userDataPart struct {
+	source  string
+	content string
+}
+
+// multipartUserData renders parts of user data as a MIME multi-part document, which cloud-init processes in order.
+// cloud-config parts are merged with the cloud-config parts before them.
+func multipartUserData(parts ...userDataPart) (string, error) {
+	buffer := bytes.Buffer{}
+	fmt.Fprintf(&buffer, "Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n\n", userDataBoundary)
+
+	writer := multipart.NewWriter(&buffer)
+	if err := writer.SetBoundary(userDataBoundary); err != nil {
+		return "", err
+	}
+	for _, part := range parts {
+		if strings.Contains(part.content, userDataBoundary) {
+			return "", fmt.Errorf("User data may not contain %s", userDataBoundary)
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", userDataContentType(part.content)+"; charset=\"utf-8\"")
+		if userDataContentType(part.content) == "text/cloud-config" {
+			header.Set("Merge-Type", cloudConfigMergeType)
+		}
+		header.Set(userDataPartHeader, part.source)
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := partWriter.Write([]byte(part.content)); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
@@ -0,0 +1,107 @@
+package instance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit.aws/plugin/yaml"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRenderCloudConfig(t *testing.T) {
+	config := CloudConfig{
+		Packages:   []string{"docker.io"},
+		WriteFiles: []CloudConfigFile{{Path: "/etc/motd", Content: "hello", Permissions: "0644"}},
+		RunCmd:     []string{"systemctl start docker"},
+	}
+	rendered, err := config.render("workers-1")
+	require.NoError(t, err)
+	require.Equal(t, `#cloud-config
+{"hostname":"workers-1","packages":["docker.io"],`+
+		`"write_files":[{"path":"/etc/motd","content":"hello","permissions":"0644"}],`+
+		`"runcmd":["systemctl start docker"]}
+`, rendered)
+
+	require.Error(t, (&CloudConfig{WriteFiles: []CloudConfigFile{{Path: "etc/motd"}}}).validate())
+}
+
+func TestCloudConfigFromYAML(t *testing.T) {
+	properties, err := yaml.ToJSON([]byte(`
+Tags:
+  CostCenter: 0123
+RunInstancesInput:
+  ImageId: ami-1
+CloudConfig:
+  WriteFiles:
+    - Path: /etc/motd
+      Content: hello
+      Permissions: 0644
+`))
+	require.NoError(t, err)
+
+	// Numbers with leading zeros are kept as written, since they are decoded as strings.
+	request, err := parseRequest(properties)
+	require.NoError(t, err)
+	require.Equal(t, "0644", request.CloudConfig.WriteFiles[0].Permissions)
+	require.Equal(t, "0123", request.Tags["CostCenter"])
+}
+
+func TestMultipartUserData(t *testing.T) {
+	parts := []userDataPart{
+		{cloudConfigSource, "#cloud-config\n{}\n"},
+		{propertiesSource, "#!/bin/sh\necho hello\n"},
+		{initSource, "unknown"},
+	}
+	userData, err := multipartUserData(parts...)
+	require.NoError(t, err)
+	require.Contains(t, userData, `Content-Type: text/cloud-config; charset="utf-8"`)
+	require.Contains(t, userData, `Content-Type: text/x-shellscript; charset="utf-8"`)
+	require.Contains(t, userData, `Content-Type: text/plain; charset="utf-8"`)
+
+	parsed, rendered := parseMultipartUserData(userData)
+	require.True(t, rendered)
+	require.Equal(t, parts, parsed)
+
+	_, err = multipartUserData(userDataPart{initSource, "#!/bin/sh\necho " + userDataBoundary})
+	require.Error(t, err)
+}
+
+func TestProvisionWithCloudConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	var input *ec2.RunInstancesInput
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(runInput *ec2.RunInstancesInput) { input = runInput }).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	properties := json.RawMessage(`{
+		"Name": {"Hostname": true},
+		"CloudConfig": {"Packages": ["docker.io"]}
+	}`)
+	logicalID := instance.LogicalID("10.0.0.5")
+	_, err := pluginImpl.Provision(instance.Spec{
+		Properties: &properties,
+		Tags:       map[string]string{GroupTag: "managers"},
+		LogicalID:  &logicalID,
+		Init:       "#!/bin/sh\ndocker swarm init\n",
+	})
+	require.NoError(t, err)
+
+	userData, err := base64.StdEncoding.DecodeString(aws.StringValue(input.UserData))
+	require.NoError(t, err)
+	parts, rendered := parseMultipartUserData(string(userData))
+	require.True(t, rendered)
+	require.Equal(t, []userDataPart{
+		{cloudConfigSource, "#cloud-config\n{\"hostname\":\"managers-10-0-0-5\",\"packages\":[\"docker.io\"]}\n"},
+		{initSource, "#!/bin/sh\ndocker swarm init\n"},
+	}, parts)
+}
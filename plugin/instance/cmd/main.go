@@ -1,37 +1,594 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/docker/infrakit.aws/plugin/instance"
+	instance_plugin "github.com/docker/infrakit.aws/plugin/instance/rpc"
+	"github.com/docker/infrakit.aws/plugin/yaml"
 	"github.com/docker/infrakit/cli"
-	instance_plugin "github.com/docker/infrakit/rpc/instance"
+	instance_spi "github.com/docker/infrakit/spi/instance"
 	"github.com/spf13/cobra"
 	"strings"
 )
 
+// readProperties reads a file of plugin properties, which may be JSON or YAML.
+func readProperties(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.ToJSON(data)
+}
+
+// parseTags parses a list of key=value tags.
+func parseTags(tagKVs []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tagKV := range tagKVs {
+		keyAndValue := strings.Split(tagKV, "=")
+		if len(keyAndValue) != 2 {
+			return nil, errors.New("Tags must be formatted as key=value")
+		}
+
+		tags[keyAndValue[0]] = keyAndValue[1]
+	}
+	return tags, nil
+}
+
+// lifecycleCommand creates a command that applies a lifecycle operation to each instance ID argument.
+func lifecycleCommand(
+	builder *instance.Builder,
+	use string,
+	short string,
+	op func(instance.Lifecycle, instance_spi.ID) error) *cobra.Command {
+
+	return &cobra.Command{
+		Use:   use + " <instance ID>...",
+		Short: short,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			instancePlugin, err := builder.BuildInstancePlugin(map[string]string{})
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			lifecycle, is := instancePlugin.(instance.Lifecycle)
+			if !is {
+				log.Error("Instance plugin does not support lifecycle operations")
+				os.Exit(1)
+			}
+
+			failed := false
+			for _, id := range args {
+				if err := op(lifecycle, instance_spi.ID(id)); err != nil {
+					log.Errorf("Failed to %s %s: %s", use, id, err)
+					failed = true
+				} else {
+					log.Infof("%s %s", use, id)
+				}
+			}
+
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// updateCommand creates a command that replaces the instances of a group that do not match a properties file.
+func updateCommand(builder *instance.Builder) *cobra.Command {
+	var group string
+	options := instance.UpdateOptions{}
+	update := &cobra.Command{
+		Use:   "update <properties file>",
+		Short: "Replace instances of a group launched with a different image or instance type",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) != 1 || group == "" {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			properties, err := readProperties(args[0])
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			instancePlugin, err := builder.BuildInstancePlugin(map[string]string{})
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			updater, is := instancePlugin.(instance.Updater)
+			if !is {
+				log.Error("Instance plugin does not support updates")
+				os.Exit(1)
+			}
+
+			err = updater.RollingUpdate(map[string]string{instance.GroupTag: group}, properties, options)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+	update.Flags().StringVar(&group, "group", "", "Group whose instances are updated")
+	update.Flags().IntVar(&options.BatchSize, "batch-size", 1, "Number of instances replaced at a time")
+	update.Flags().DurationVar(
+		&options.HealthTimeout,
+		"health-timeout",
+		10*time.Minute,
+		"Maximum time to wait for a replacement to pass status checks")
+	update.Flags().BoolVar(
+		&options.ContinueOnFailure,
+		"continue-on-failure",
+		false,
+		"Continue replacing instances after a failed replacement")
+	update.Flags().BoolVar(
+		&options.ReplaceRootVolume,
+		"replace-root-volume",
+		false,
+		"Replace the root volumes of instances launched with a different image, rather than the instances")
+	return update
+}
+
+// maintainCommand creates a command that hibernates and resumes the instances of a group, replacing those that fail
+// to resume.
+func maintainCommand(builder *instance.Builder) *cobra.Command {
+	var group string
+	options := instance.MaintenanceOptions{}
+	maintain := &cobra.Command{
+		Use:   "maintain <properties file>",
+		Short: "Hibernate and resume instances of a group, replacing those that fail to resume",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) != 1 || group == "" {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			properties, err := readProperties(args[0])
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			instancePlugin, err := builder.BuildInstancePlugin(map[string]string{})
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			maintainer, is := instancePlugin.(instance.Maintainer)
+			if !is {
+				log.Error("Instance plugin does not support maintenance")
+				os.Exit(1)
+			}
+
+			err = maintainer.Maintain(map[string]string{instance.GroupTag: group}, properties, options)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+	maintain.Flags().StringVar(&group, "group", "", "Group whose instances are maintained")
+	maintain.Flags().DurationVar(
+		&options.HealthTimeout,
+		"health-timeout",
+		10*time.Minute,
+		"Maximum time to wait for a resumed instance or replacement to pass status checks")
+	maintain.Flags().BoolVar(
+		&options.ScheduledOnly,
+		"scheduled-only",
+		false,
+		"Only maintain instances with scheduled events, such as system maintenance")
+	return maintain
+}
+
+// rebalanceCommand creates a command that moves instances of a group between availability zones until the group is
+// balanced across them.
+func rebalanceCommand(builder *instance.Builder) *cobra.Command {
+	var group string
+	options := instance.RebalanceOptions{}
+	rebalance := &cobra.Command{
+		Use:   "rebalance <properties file>",
+		Short: "Replace instances of a group until it is balanced across its availability zones",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) != 1 || group == "" {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			properties, err := readProperties(args[0])
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			instancePlugin, err := builder.BuildInstancePlugin(map[string]string{})
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			rebalancer, is := instancePlugin.(instance.Rebalancer)
+			if !is {
+				log.Error("Instance plugin does not support rebalancing")
+				os.Exit(1)
+			}
+
+			err = rebalancer.Rebalance(map[string]string{instance.GroupTag: group}, properties, options)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+	rebalance.Flags().StringVar(&group, "group", "", "Group whose instances are rebalanced")
+	rebalance.Flags().DurationVar(
+		&options.HealthTimeout,
+		"health-timeout",
+		10*time.Minute,
+		"Maximum time to wait for a replacement to pass status checks")
+	return rebalance
+}
+
+// describeCommand creates a command that prints the details of instances matching tags.
+func describeCommand(builder *instance.Builder) *cobra.Command {
+	var tags []string
+	describe := &cobra.Command{
+		Use:   "describe",
+		Short: "Print details of instances, such as IP addresses and availability zone, as JSON",
+		Run: func(c *cobra.Command, args []string) {
+			filter, err := parseTags(tags)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			instancePlugin, err := builder.BuildInstancePlugin(map[string]string{})
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			describer, is := instancePlugin.(instance.DetailDescriber)
+			if !is {
+				log.Error("Instance plugin does not support describing details")
+				os.Exit(1)
+			}
+
+			details, err := describer.DescribeDetails(filter)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			out, err := json.MarshalIndent(details, "", "  ")
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			fmt.Println(string(out))
+		},
+	}
+	describe.Flags().StringSliceVar(&tags, "tags", []string{}, "A list of key=value tags instances must have")
+	return describe
+}
+
+// planCommand creates a command that prints the changes of instances a proposed change of a group would make.
+func planCommand(builder *instance.Builder, namespaceTags *[]string) *cobra.Command {
+	var group string
+	var tags []string
+	var logicalIDs []string
+	options := instance.PlanOptions{}
+	plan := &cobra.Command{
+		Use:   "plan <properties file>",
+		Short: "Print the instances a proposed change of a group would create, destroy, or relabel, as JSON",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) != 1 || group == "" {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			properties, err := readProperties(args[0])
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			if options.Tags, err = parseTags(tags); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			for _, logicalID := range logicalIDs {
+				options.LogicalIDs = append(options.LogicalIDs, instance_spi.LogicalID(logicalID))
+			}
+
+			namespace, err := parseTags(*namespaceTags)
+			if err != nil {
+				log.Error("Namespace tags must be formatted as key=value")
+				os.Exit(1)
+			}
+
+			instancePlugin, err := builder.BuildInstancePlugin(namespace)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			planner, is := instancePlugin.(instance.Planner)
+			if !is {
+				log.Error("Instance plugin does not support plans")
+				os.Exit(1)
+			}
+
+			changes, err := planner.Plan(map[string]string{instance.GroupTag: group}, properties, options)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			out, err := json.MarshalIndent(changes, "", "  ")
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			fmt.Println(string(out))
+		},
+	}
+	plan.Flags().StringVar(&group, "group", "", "Group whose change is planned")
+	plan.Flags().IntVar(&options.Size, "size", -1, "Proposed size of the group, or -1 to keep its size")
+	plan.Flags().StringSliceVar(
+		&logicalIDs,
+		"logical-ids",
+		[]string{},
+		"A list of the proposed logical IDs of a group of pets, replacing --size")
+	plan.Flags().StringSliceVar(
+		&tags,
+		"tags",
+		[]string{},
+		"A list of key=value tags the group provisions instances with, such as the hash of its configuration")
+	return plan
+}
+
+// adoptCommand creates a command that brings existing instances under management by a group.
+func adoptCommand(builder *instance.Builder, namespaceTags *[]string) *cobra.Command {
+	var group string
+	var force bool
+	adopt := &cobra.Command{
+		Use:   "adopt <properties file> <instance ID>...",
+		Short: "Tag existing instances as members of a group",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) < 2 || group == "" {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			properties, err := readProperties(args[0])
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			adopter := buildAdopter(builder, *namespaceTags)
+			failed := false
+			for _, id := range args[1:] {
+				tags := map[string]string{instance.GroupTag: group}
+				if err := adopter.Adopt(instance_spi.ID(id), tags, properties, force); err != nil {
+					log.Errorf("Failed to adopt %s: %s", id, err)
+					failed = true
+				} else {
+					log.Infof("adopted %s", id)
+				}
+			}
+
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	adopt.Flags().StringVar(&group, "group", "", "Group the instances join")
+	adopt.Flags().BoolVar(&force, "force", false, "Adopt instances that do not match the image and instance type")
+	return adopt
+}
+
+// releaseCommand creates a command that releases instances from management without terminating them.
+func releaseCommand(builder *instance.Builder, namespaceTags *[]string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "release <instance ID>...",
+		Short: "Remove the tags that identify instances as managed, leaving them running",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			adopter := buildAdopter(builder, *namespaceTags)
+			failed := false
+			for _, id := range args {
+				if err := adopter.Release(instance_spi.ID(id)); err != nil {
+					log.Errorf("Failed to release %s: %s", id, err)
+					failed = true
+				} else {
+					log.Infof("released %s", id)
+				}
+			}
+
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func buildAdopter(builder *instance.Builder, namespaceTags []string) instance.Adopter {
+	namespace, err := parseTags(namespaceTags)
+	if err != nil {
+		log.Error("Namespace tags must be formatted as key=value")
+		os.Exit(1)
+	}
+
+	instancePlugin, err := builder.BuildInstancePlugin(namespace)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	adopter, is := instancePlugin.(instance.Adopter)
+	if !is {
+		log.Error("Instance plugin does not support adoption")
+		os.Exit(1)
+	}
+	return adopter
+}
+
+// backupCommand creates a command that snapshots the attachment volumes in the namespace, and prunes their old
+// snapshots.
+func backupCommand(builder *instance.Builder, namespaceTags *[]string) *cobra.Command {
+	options := instance.BackupOptions{}
+	backup := &cobra.Command{
+		Use:   "backup",
+		Short: "Snapshot the volumes attached to instances, such as manager data volumes, and delete old snapshots",
+		Run: func(c *cobra.Command, args []string) {
+			namespace, err := parseTags(*namespaceTags)
+			if err != nil {
+				log.Error("Namespace tags must be formatted as key=value")
+				os.Exit(1)
+			}
+
+			instancePlugin, err := builder.BuildInstancePlugin(namespace)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			backuper, is := instancePlugin.(instance.Backuper)
+			if !is {
+				log.Error("Instance plugin does not support backups")
+				os.Exit(1)
+			}
+
+			if err := backuper.Backup(options); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+	backup.Flags().IntVar(&options.Retain, "retain", 7, "Number of snapshots of each volume to keep")
+	return backup
+}
+
+// policyCommand creates a command that prints the least-privilege IAM policy of the plugin, for the features used by
+// the properties files of its groups.
+func policyCommand(builder *instance.Builder, namespaceTags *[]string) *cobra.Command {
+	var volumes, backups, rootVolumeUpdates bool
+	policy := &cobra.Command{
+		Use:   "policy [<properties file>...]",
+		Short: "Print the IAM policy the plugin requires for the features used by the properties of its groups",
+		Run: func(c *cobra.Command, args []string) {
+			namespace, err := parseTags(*namespaceTags)
+			if err != nil {
+				log.Error("Namespace tags must be formatted as key=value")
+				os.Exit(1)
+			}
+
+			properties := []json.RawMessage{}
+			for _, arg := range args {
+				data, err := readProperties(arg)
+				if err != nil {
+					log.Error(err)
+					os.Exit(1)
+				}
+				properties = append(properties, data)
+			}
+
+			features, err := instance.RequestFeatures(properties...)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			features.Volumes = features.Volumes || volumes
+			features.Backups = backups
+			features.RootVolumeUpdates = rootVolumeUpdates
+
+			document, err := builder.Policy(namespace, features)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			out, err := json.MarshalIndent(document, "", "  ")
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			fmt.Println(string(out))
+		},
+	}
+	policy.Flags().BoolVar(&volumes, "volumes", false, "Allow attaching volumes, such as the data volumes of managers")
+	policy.Flags().BoolVar(&backups, "backups", false, "Allow the backup command to snapshot volumes")
+	policy.Flags().BoolVar(
+		&rootVolumeUpdates, "root-volume-updates", false, "Allow the update command to replace root volumes")
+	return policy
+}
+
+// healthCommand creates a command that checks the plugin's access to AWS, exiting with an error if it is unhealthy.
+func healthCommand(builder *instance.Builder) *cobra.Command {
+	return &cobra.Command{
+		Use:   "health",
+		Short: "Check the credentials, region, and instance metadata access of the plugin",
+		Run: func(c *cobra.Command, args []string) {
+			if _, err := builder.BuildInstancePlugin(map[string]string{}); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			report := instance.CheckHealth(builder.Config, ec2metadata.New(builder.Config))
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			fmt.Println(string(out))
+
+			if !report.Healthy {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
 func main() {
 
 	builder := &instance.Builder{}
 
 	var logLevel int
 	var name string
+	var healthListen string
 	var namespaceTags []string
 	cmd := &cobra.Command{
 		Use:   os.Args[0],
 		Short: "AWS instance plugin",
 		Run: func(c *cobra.Command, args []string) {
 
-			namespace := map[string]string{}
-			for _, tagKV := range namespaceTags {
-				keyAndValue := strings.Split(tagKV, "=")
-				if len(keyAndValue) != 2 {
-					log.Error("Namespace tags must be formatted as key=value")
-					os.Exit(1)
-				}
-
-				namespace[keyAndValue[0]] = keyAndValue[1]
+			namespace, err := parseTags(namespaceTags)
+			if err != nil {
+				log.Error("Namespace tags must be formatted as key=value")
+				os.Exit(1)
 			}
 
 			instancePlugin, err := builder.BuildInstancePlugin(namespace)
@@ -40,6 +597,15 @@ func main() {
 				os.Exit(1)
 			}
 
+			if healthListen != "" {
+				go func() {
+					log.Infof("Serving health checks at %s/health", healthListen)
+					mux := http.NewServeMux()
+					mux.Handle("/health", instance.NewHealthHandler(builder.Config))
+					log.Error(http.ListenAndServe(healthListen, mux))
+				}()
+			}
+
 			cli.SetLogLevel(logLevel)
 			cli.RunPlugin(name, instance_plugin.PluginServer(instancePlugin))
 		},
@@ -47,7 +613,12 @@ func main() {
 
 	cmd.Flags().IntVar(&logLevel, "log", cli.DefaultLogLevel, "Logging level. 0 is least verbose. Max is 5")
 	cmd.Flags().StringVar(&name, "name", "instance-aws", "Plugin name to advertise for discovery")
-	cmd.Flags().StringSliceVar(
+	cmd.Flags().StringVar(
+		&healthListen,
+		"health-listen",
+		"",
+		"Address to serve health checks at, such as :8080, or empty to disable")
+	cmd.PersistentFlags().StringSliceVar(
 		&namespaceTags,
 		"namespace-tags",
 		[]string{},
@@ -55,9 +626,25 @@ func main() {
 
 	// TODO(chungers) - the exposed flags here won't be set in plugins, because plugin install doesn't allow
 	// user to pass in command line args like containers with entrypoint.
-	cmd.Flags().AddFlagSet(builder.Flags())
+	cmd.PersistentFlags().AddFlagSet(builder.Flags())
 
 	cmd.AddCommand(cli.VersionCommand())
+	cmd.AddCommand(
+		lifecycleCommand(builder, "stop", "Stop instances", instance.Lifecycle.Stop),
+		lifecycleCommand(builder, "start", "Start stopped or hibernated instances", instance.Lifecycle.Start),
+		lifecycleCommand(builder, "reboot", "Reboot instances", instance.Lifecycle.Reboot),
+		lifecycleCommand(builder, "hibernate", "Hibernate instances", instance.Lifecycle.Hibernate),
+		updateCommand(builder),
+		maintainCommand(builder),
+		rebalanceCommand(builder),
+		describeCommand(builder),
+		planCommand(builder, &namespaceTags),
+		adoptCommand(builder, &namespaceTags),
+		releaseCommand(builder, &namespaceTags),
+		backupCommand(builder, &namespaceTags),
+		policyCommand(builder, &namespaceTags),
+		healthCommand(builder),
+	)
 
 	err := cmd.Execute()
 	if err != nil {
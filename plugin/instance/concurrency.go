@@ -0,0 +1,101 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"sync"
+)
+
+// provisionLimiter bounds the number of instances of each group that are provisioned at the same time.  Provisions
+// beyond the limit wait for a provision of the group to complete, so a large scale-up is made in batches.
+type provisionLimiter struct {
+	lock sync.Mutex
+
+	// limit is the default maximum of concurrent provisions of a group, where zero is unlimited.
+	limit int
+
+	slots map[string]chan struct{}
+
+	// acquiring serializes the provisions of each group waiting for slots, so that provisions acquiring several
+	// slots do not each hold some of them while waiting for the others.
+	acquiring map[string]*sync.Mutex
+}
+
+func newProvisionLimiter(limit int) *provisionLimiter {
+	return &provisionLimiter{limit: limit, slots: map[string]chan struct{}{}, acquiring: map[string]*sync.Mutex{}}
+}
+
+// groupSlots returns the provision slots of a group with a limit, and the lock of the provisions acquiring them.
+// Slots are replaced when the limit of the group changes, and provisions holding the previous slots release them.
+func (l *provisionLimiter) groupSlots(key string, limit int) (chan struct{}, *sync.Mutex) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	slots, has := l.slots[key]
+	if !has || cap(slots) != limit {
+		slots = make(chan struct{}, limit)
+		l.slots[key] = slots
+	}
+	acquiring, has := l.acquiring[key]
+	if !has {
+		acquiring = &sync.Mutex{}
+		l.acquiring[key] = acquiring
+	}
+	return slots, acquiring
+}
+
+// batchSize is the number of instances of a group launched together, which is its limit of concurrent provisions, or
+// zero if it is unlimited.  The limit of the group overrides the default limit when it is set.
+func (l *provisionLimiter) batchSize(limit int) int {
+	if l == nil {
+		return 0
+	}
+	if limit == 0 {
+		limit = l.limit
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// acquire waits for a provision slot of the group of an instance, and returns a function that releases it.  The limit
+// of the group overrides the default limit when it is set.
+func (l *provisionLimiter) acquire(tags map[string]string, limit int) func() {
+	return l.acquireCount(tags, limit, 1)
+}
+
+// acquireCount waits for a provision slot of the group for each of count instances launched together, and returns a
+// function that releases them.  Launches of more instances than the limit acquire every slot of the group.
+func (l *provisionLimiter) acquireCount(tags map[string]string, limit, count int) func() {
+	if l == nil {
+		return func() {}
+	}
+	if limit == 0 {
+		limit = l.limit
+	}
+	if limit <= 0 {
+		return func() {}
+	}
+
+	if count > limit {
+		count = limit
+	}
+
+	key := groupLockKey(tags)
+	slots, acquiring := l.groupSlots(key, limit)
+	acquiring.Lock()
+	defer acquiring.Unlock()
+	for i := 0; i < count; i++ {
+		select {
+		case slots <- struct{}{}:
+		default:
+			log.Infof("Waiting for one of %d concurrent provisions of %s to complete", limit, key)
+			slots <- struct{}{}
+		}
+	}
+	return func() {
+		for i := 0; i < count; i++ {
+			<-slots
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package instance
+
+import (
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// maxConcurrency runs provisions of a group, and reports the most that held a slot at the same time.
+func maxConcurrency(limiter *provisionLimiter, tags map[string]string, limit, provisions int) int {
+	lock := sync.Mutex{}
+	active := 0
+	peak := 0
+
+	wait := sync.WaitGroup{}
+	for i := 0; i < provisions; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			release := limiter.acquire(tags, limit)
+			defer release()
+
+			lock.Lock()
+			active++
+			if active > peak {
+				peak = active
+			}
+			lock.Unlock()
+
+			time.Sleep(25 * time.Millisecond)
+
+			lock.Lock()
+			active--
+			lock.Unlock()
+		}()
+	}
+	wait.Wait()
+	return peak
+}
+
+func TestProvisionLimiter(t *testing.T) {
+	workers := map[string]string{GroupTag: "workers"}
+
+	require.Equal(t, 3, maxConcurrency(newProvisionLimiter(3), workers, 0, 10))
+
+	// The limit of a group overrides the default limit.
+	require.Equal(t, 1, maxConcurrency(newProvisionLimiter(3), workers, 1, 5))
+	require.Equal(t, 5, maxConcurrency(newProvisionLimiter(3), workers, -1, 5))
+
+	// Without a limit, every provision proceeds at once.
+	require.Equal(t, 5, maxConcurrency(newProvisionLimiter(0), workers, 0, 5))
+	require.Equal(t, 5, maxConcurrency(nil, workers, 2, 5))
+}
+
+func TestProvisionLimiterGroups(t *testing.T) {
+	limiter := newProvisionLimiter(1)
+
+	// A provision of one group does not wait for those of another group.
+	releaseWorker := limiter.acquire(map[string]string{GroupTag: "workers"}, 0)
+	defer releaseWorker()
+
+	acquired := make(chan bool)
+	go func() {
+		release := limiter.acquire(map[string]string{GroupTag: "managers"}, 0)
+		release()
+		acquired <- true
+	}()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		require.Fail(t, "Provision of managers waited for workers")
+	}
+}
@@ -0,0 +1,182 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+	"github.com/docker/infrakit/spi/instance"
+	"time"
+)
+
+const (
+	defaultConfirmationTimeout = 600
+
+	// TerminateOnFailure destroys instances that are not confirmed.
+	TerminateOnFailure = "terminate"
+
+	// KeepOnFailure keeps instances that are not confirmed for debugging, tagged with FailedTag.
+	KeepOnFailure = "keep"
+
+	// StopOnFailure stops instances that are not confirmed, tagged with FailedTag, so that their volumes may be
+	// inspected.
+	StopOnFailure = "stop"
+
+	// FailedTag is the tag name used to record why an instance kept by the failure policy of its group was not
+	// confirmed.  Instances with the tag are no longer members of their group.
+	FailedTag = "infrakit.failed"
+)
+
+// confirmationInterval is the time between checks of the state of an instance being confirmed.
+var confirmationInterval = 10 * time.Second
+
+// Confirmation configures the checks an instance must pass before it is reported provisioned, and the time it has to
+// pass them.  Instances that fail the checks, or do not pass them in time, are handled by the failure policy and the
+// provision fails.
+type Confirmation struct {
+	// StatusChecks requires the instance and system status checks of the instance to pass, in addition to the
+	// instance running.
+	StatusChecks bool `json:",omitempty"`
+
+	// Timeout is the number of seconds to wait for the checks to pass, defaulting to 600.  It also limits the wait
+	// for the instance to run before volumes and network interfaces are attached.
+	Timeout int64 `json:",omitempty"`
+
+	// OnFailure is the policy for instances that are not confirmed: terminate (the default), keep, or stop.  Kept
+	// and stopped instances are tagged with FailedTag and leave their group, so that they are replaced, but must be
+	// terminated by the operator.
+	OnFailure string `json:",omitempty"`
+}
+
+func (c *Confirmation) validate() error {
+	if c == nil {
+		return nil
+	}
+	switch c.OnFailure {
+	case "", TerminateOnFailure, KeepOnFailure, StopOnFailure:
+		return nil
+	}
+	return fmt.Errorf("Confirmation.OnFailure must be %s, %s, or %s: %s",
+		TerminateOnFailure, KeepOnFailure, StopOnFailure, c.OnFailure)
+}
+
+func (c Confirmation) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultConfirmationTimeout * time.Second
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
+
+// waitRunning waits for an instance to enter the running state, failing if it stops or terminates instead.  An
+// instance may not be found immediately after it is launched, so it is waited for until the deadline.
+func (p awsInstancePlugin) waitRunning(id instance.ID, deadline time.Time) error {
+	for {
+		result, err := p.client.DescribeInstances(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{aws.String(string(id))},
+		})
+		if awserrors.NotYetVisible(err) {
+			log.Debugf("Instance %s is not yet found", id)
+		} else if err != nil {
+			return err
+		} else {
+			for _, reservation := range result.Reservations {
+				for _, ec2Instance := range reservation.Instances {
+					state := aws.StringValue(ec2Instance.State.Name)
+					switch state {
+					case ec2.InstanceStateNameRunning:
+						return nil
+					case ec2.InstanceStateNamePending:
+					default:
+						reason := ""
+						if ec2Instance.StateReason != nil {
+							reason = ": " + aws.StringValue(ec2Instance.StateReason.Message)
+						}
+						return fmt.Errorf("Instance %s entered state %s%s", id, state, reason)
+					}
+				}
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("Instance %s did not enter running state in time", id)
+		}
+		time.Sleep(confirmationInterval)
+	}
+}
+
+// confirm waits for a provisioned instance to pass the checks of a confirmation by the deadline of its provision,
+// applying the failure policy if it does not.
+func (p awsInstancePlugin) confirm(id instance.ID, confirmation Confirmation, deadline time.Time) error {
+	log.Infof("Waiting for instance %s to be confirmed", id)
+
+	err := p.waitRunning(id, deadline)
+	if err == nil && confirmation.StatusChecks {
+		err = p.waitHealthy(id, deadline.Sub(time.Now()))
+	}
+	if err == nil {
+		return nil
+	}
+	return p.failProvision(id, confirmation, err)
+}
+
+// failProvision applies the failure policy of a confirmation to an instance that was not confirmed, returning the
+// error of the provision.
+func (p awsInstancePlugin) failProvision(id instance.ID, confirmation Confirmation, err error) error {
+	failure := fmt.Errorf("Provisioned instance %s was not confirmed: %s", id, err)
+
+	switch confirmation.OnFailure {
+	case KeepOnFailure, StopOnFailure:
+		defer p.describeCache.invalidate()
+		p.launches.forget(id)
+		p.deregisterTargets(id)
+		p.deleteAlarms(id)
+
+		// Tag values are limited to 256 characters.
+		reason := err.Error()
+		if len(reason) > 256 {
+			reason = reason[:256]
+		}
+		_, tagErr := p.client.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{aws.String(string(id))},
+			Tags:      []*ec2.Tag{{Key: aws.String(FailedTag), Value: aws.String(reason)}},
+		})
+		if tagErr != nil {
+			log.Warnf("Failed to tag instance %s, which failed confirmation, with %s: %s", id, FailedTag, tagErr)
+			break
+		}
+
+		if confirmation.OnFailure == KeepOnFailure {
+			log.Warnf("Keeping instance %s, which failed confirmation: %s", id, err)
+			return failure
+		}
+		log.Warnf("Stopping instance %s, which failed confirmation: %s", id, err)
+		_, stopErr := p.client.StopInstances(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String(string(id))}})
+		if stopErr != nil {
+			log.Warnf("Failed to stop instance %s: %s", id, stopErr)
+		}
+		return failure
+	}
+
+	// Instances that are not tagged as failed would remain members of their group, so they are destroyed.
+	log.Warnf("Destroying instance %s, which failed confirmation: %s", id, err)
+	if destroyErr := p.destroy(id); destroyErr != nil {
+		log.Warnf("Failed to destroy instance %s: %s", id, destroyErr)
+	}
+	return failure
+}
+
+// withoutFailed omits instances tagged as failed by the failure policy of their group.
+func withoutFailed(instances []*ec2.Instance) []*ec2.Instance {
+	members := []*ec2.Instance{}
+	for _, ec2Instance := range instances {
+		failed := false
+		for _, tag := range ec2Instance.Tags {
+			failed = failed || aws.StringValue(tag.Key) == FailedTag
+		}
+		if !failed {
+			members = append(members, ec2Instance)
+		}
+	}
+	return members
+}
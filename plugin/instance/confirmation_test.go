@@ -0,0 +1,143 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func instanceInState(id, state string) *ec2.DescribeInstancesOutput {
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{{
+		InstanceId:  aws.String(id),
+		State:       &ec2.InstanceState{Name: aws.String(state)},
+		StateReason: &ec2.StateReason{Message: aws.String("Client.InternalError")},
+	}}}}}
+}
+
+func confirmationPlugin(clientMock *mock_ec2.MockEC2API) *awsInstancePlugin {
+	return &awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		subnets:       newSubnetCache(),
+		provisions:    newProvisionLimiter(0),
+		slots:         newSlotAllocator(),
+	}
+}
+
+func TestProvisionConfirmed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := confirmationPlugin(clientMock)
+
+	defer func(interval time.Duration) { confirmationInterval = interval }(confirmationInterval)
+	confirmationInterval = time.Millisecond
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+	gomock.InOrder(
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Return(instanceInState("i-1", ec2.InstanceStateNamePending), nil),
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Return(instanceInState("i-1", ec2.InstanceStateNameRunning), nil),
+	)
+	clientMock.EXPECT().DescribeInstanceStatus(gomock.Any()).Return(&ec2.DescribeInstanceStatusOutput{
+		InstanceStatuses: []*ec2.InstanceStatus{{
+			InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+			SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+		}},
+	}, nil)
+
+	properties := json.RawMessage(`{"Confirmation": {"StatusChecks": true, "Timeout": 60}}`)
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("i-1"), *id)
+}
+
+func TestProvisionNotConfirmed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := confirmationPlugin(clientMock)
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(instanceInState("i-1", ec2.InstanceStateNameTerminated), nil)
+
+	// The instance that failed confirmation is destroyed.
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("i-1")}}).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("i-1")}}},
+			nil)
+
+	properties := json.RawMessage(`{"Confirmation": {}}`)
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "entered state terminated: Client.InternalError")
+	require.Nil(t, id)
+}
+
+func TestConfirmationTimeout(t *testing.T) {
+	require.Equal(t, 10*time.Minute, Confirmation{}.timeout())
+	require.Equal(t, 90*time.Second, Confirmation{Timeout: 90}.timeout())
+}
+
+func TestProvisionStoppedOnFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := confirmationPlugin(clientMock)
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(instanceInState("i-1", ec2.InstanceStateNameStopping), nil)
+
+	// The instance is tagged as failed and stopped rather than destroyed.
+	gomock.InOrder(
+		clientMock.EXPECT().CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{aws.String("i-1")},
+			Tags: []*ec2.Tag{{
+				Key:   aws.String(FailedTag),
+				Value: aws.String("Instance i-1 entered state stopping: Client.InternalError"),
+			}},
+		}).Return(&ec2.CreateTagsOutput{}, nil),
+		clientMock.EXPECT().StopInstances(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String("i-1")}}).
+			Return(&ec2.StopInstancesOutput{}, nil),
+	)
+
+	properties := json.RawMessage(`{"Confirmation": {"OnFailure": "stop"}}`)
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.Error(t, err)
+	require.Nil(t, id)
+}
+
+func TestConfirmationOnFailure(t *testing.T) {
+	for _, policy := range []string{"", TerminateOnFailure, KeepOnFailure, StopOnFailure} {
+		require.NoError(t, (&Confirmation{OnFailure: policy}).validate(), policy)
+	}
+	require.Error(t, (&Confirmation{OnFailure: "hibernate"}).validate())
+
+	_, err := parseRequest(json.RawMessage(`{"Confirmation": {"OnFailure": "retry"}}`))
+	require.Error(t, err)
+}
+
+func TestWithoutFailed(t *testing.T) {
+	member := &ec2.Instance{InstanceId: aws.String("i-1")}
+	failed := &ec2.Instance{
+		InstanceId: aws.String("i-2"),
+		Tags:       []*ec2.Tag{{Key: aws.String(FailedTag), Value: aws.String("timed out")}},
+	}
+	require.Equal(t, []*ec2.Instance{member}, withoutFailed([]*ec2.Instance{member, failed}))
+}
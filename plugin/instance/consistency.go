@@ -0,0 +1,198 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// launchVisibilityWindow is how long after it is launched an instance missing from the results of DescribeInstances
+	// is looked up by its ID.  EC2 is eventually consistent, so a new instance may not match tag filters immediately.
+	launchVisibilityWindow = 5 * time.Minute
+
+	// consistencyRetries is the number of times instances that are not found by ID are described again.
+	consistencyRetries = 3
+)
+
+// consistencyBackoff is the delay before describing instances that were not found by ID again, doubled each time.
+var consistencyBackoff = 500 * time.Millisecond
+
+// recentLaunches tracks the instances launched by the plugin recently, so that they are reported as members of their
+// group even when they are not yet visible to DescribeInstances.  Otherwise the group controller would see too few
+// instances and provision another.
+type recentLaunches struct {
+	lock      sync.Mutex
+	now       func() time.Time
+	instances map[string]recentLaunch
+}
+
+type recentLaunch struct {
+	instance *ec2.Instance
+	launched time.Time
+}
+
+func newRecentLaunches() *recentLaunches {
+	return &recentLaunches{now: time.Now, instances: map[string]recentLaunch{}}
+}
+
+// record tracks a launched instance, along with the tags it was launched with.
+func (r *recentLaunches) record(ec2Instance *ec2.Instance, tags []*ec2.Tag) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	launched := *ec2Instance
+	launched.Tags = tags
+	if launched.State == nil {
+		launched.State = &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNamePending)}
+	}
+	r.instances[*launched.InstanceId] = recentLaunch{instance: &launched, launched: r.now()}
+}
+
+// forget stops tracking an instance, such as when it is destroyed.
+func (r *recentLaunches) forget(id instance.ID) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.instances, string(id))
+}
+
+// launched returns the instance launched recently with an ID, or nil if it is not tracked.
+func (r *recentLaunches) launched(id instance.ID) *ec2.Instance {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if launch, has := r.instances[string(id)]; has {
+		return launch.instance
+	}
+	return nil
+}
+
+// missing returns the instances launched within the visibility window that match tags, but are not among the
+// described instances.
+func (r *recentLaunches) missing(tags map[string]string, described []*ec2.Instance) []*ec2.Instance {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	found := map[string]bool{}
+	for _, ec2Instance := range described {
+		found[aws.StringValue(ec2Instance.InstanceId)] = true
+	}
+
+	ids := []string{}
+	for id, launch := range r.instances {
+		switch {
+		case r.now().Sub(launch.launched) > launchVisibilityWindow:
+			delete(r.instances, id)
+		case found[id]:
+			// The instance is visible, so it no longer needs to be tracked.
+			delete(r.instances, id)
+		case hasTags(launch.instance, tags):
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	instances := []*ec2.Instance{}
+	for _, id := range ids {
+		instances = append(instances, r.instances[id].instance)
+	}
+	return instances
+}
+
+func hasTags(ec2Instance *ec2.Instance, tags map[string]string) bool {
+	instanceTags := map[string]string{}
+	for _, tag := range ec2Instance.Tags {
+		instanceTags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	for k, v := range tags {
+		if value, has := instanceTags[k]; !has || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// withRecentLaunches adds the instances launched recently that match tags, but were not described, to the described
+// instances, as they were launched.  Unlike includeRecentLaunches, the missing instances are not described, so that
+// provisions counting the instances of a group, such as to choose a free slot, do not wait for them to be visible.
+func (p awsInstancePlugin) withRecentLaunches(tags map[string]string, described []*ec2.Instance) []*ec2.Instance {
+	_, allTags := mergeTags(tags, p.namespaceTags)
+	return append(append([]*ec2.Instance{}, described...), p.launches.missing(allTags, described)...)
+}
+
+// includeRecentLaunches adds the instances launched recently that match tags, but were not described, to the described
+// instances.  The missing instances are described by ID, retrying with a backoff while they are not found, and are
+// reported as they were launched if they are still not found.  Instances that have since terminated are left out.
+func (p awsInstancePlugin) includeRecentLaunches(
+	tags map[string]string,
+	described []*ec2.Instance) ([]*ec2.Instance, error) {
+
+	_, allTags := mergeTags(tags, p.namespaceTags)
+	missing := p.launches.missing(allTags, described)
+	if len(missing) == 0 {
+		return described, nil
+	}
+
+	ids := []*string{}
+	for _, ec2Instance := range missing {
+		ids = append(ids, ec2Instance.InstanceId)
+	}
+
+	var result *ec2.DescribeInstancesOutput
+	var err error
+	for attempt := 0; ; attempt++ {
+		result, err = p.client.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: ids})
+		if err == nil || !awserrors.NotYetVisible(err) || attempt == consistencyRetries {
+			break
+		}
+		time.Sleep(consistencyBackoff << uint(attempt))
+	}
+	if err != nil && !awserrors.NotYetVisible(err) {
+		return nil, err
+	}
+
+	visible := map[string]*ec2.Instance{}
+	if result != nil {
+		for _, reservation := range result.Reservations {
+			for _, ec2Instance := range reservation.Instances {
+				visible[aws.StringValue(ec2Instance.InstanceId)] = ec2Instance
+			}
+		}
+	}
+
+	instances := append([]*ec2.Instance{}, described...)
+	for _, launched := range missing {
+		id := aws.StringValue(launched.InstanceId)
+		ec2Instance, found := visible[id]
+		switch {
+		case !found:
+			log.Debugf("Instance %s is not yet visible, reporting it as launched", id)
+			instances = append(instances, launched)
+		case isTerminated(ec2Instance):
+			p.launches.forget(instance.ID(id))
+		default:
+			log.Debugf("Instance %s does not yet match the tags of its group", id)
+			ec2Instance.Tags = launched.Tags
+			instances = append(instances, ec2Instance)
+		}
+	}
+	return instances, nil
+}
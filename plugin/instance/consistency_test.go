@@ -0,0 +1,111 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// provisionUnseen provisions an instance, returning a plugin whose next describe of the group does not find it.
+func provisionUnseen(t *testing.T, clientMock *mock_ec2.MockEC2API) *awsInstancePlugin {
+	pluginImpl := confirmationPlugin(clientMock)
+	pluginImpl.launches = newRecentLaunches()
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+	properties := json.RawMessage(`{}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	clientMock.EXPECT().DescribeInstances(describeGroupRequest(testNamespace, tags, nil)).
+		Return(&ec2.DescribeInstancesOutput{}, nil)
+	return pluginImpl
+}
+
+func byID(ids ...string) *ec2.DescribeInstancesInput {
+	return &ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice(ids)}
+}
+
+func TestDescribeLaunchedInstanceNotYetVisible(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	defer func(backoff time.Duration) { consistencyBackoff = backoff }(consistencyBackoff)
+	consistencyBackoff = 0
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := provisionUnseen(t, clientMock)
+
+	notFound := awserr.New("InvalidInstanceID.NotFound", "The instance ID 'i-1' does not exist", nil)
+	clientMock.EXPECT().DescribeInstances(byID("i-1")).Return(nil, notFound).Times(consistencyRetries + 1)
+
+	descriptions, err := pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+	require.Len(t, descriptions, 1)
+	require.Equal(t, instance.ID("i-1"), descriptions[0].ID)
+	require.Equal(t, "workers", descriptions[0].Tags["group"])
+	require.Equal(t, "test", descriptions[0].Tags["cluster"])
+}
+
+func TestDescribeLaunchedInstanceByID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := provisionUnseen(t, clientMock)
+
+	clientMock.EXPECT().DescribeInstances(byID("i-1")).
+		Return(instanceInState("i-1", ec2.InstanceStateNameRunning), nil)
+
+	descriptions, err := pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+	require.Len(t, descriptions, 1)
+	require.Equal(t, "workers", descriptions[0].Tags["group"])
+
+	// Once the instance is visible, it is no longer looked up by ID.
+	clientMock.EXPECT().DescribeInstances(describeGroupRequest(testNamespace, tags, nil)).
+		Return(describeInstancesResponse([][]string{{"i-1"}}, tags, nil), nil)
+	descriptions, err = pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+	require.Len(t, descriptions, 1)
+	require.Empty(t, pluginImpl.launches.instances)
+}
+
+func TestDescribeLaunchedInstanceTerminated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := provisionUnseen(t, clientMock)
+
+	clientMock.EXPECT().DescribeInstances(byID("i-1")).
+		Return(instanceInState("i-1", ec2.InstanceStateNameTerminated), nil)
+
+	descriptions, err := pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+	require.Empty(t, descriptions)
+	require.Empty(t, pluginImpl.launches.instances)
+}
+
+func TestRecentLaunchesExpire(t *testing.T) {
+	now := time.Now()
+	launches := newRecentLaunches()
+	launches.now = func() time.Time { return now }
+
+	launches.record(&ec2.Instance{InstanceId: aws.String("i-1")}, []*ec2.Tag{
+		{Key: aws.String("group"), Value: aws.String("workers")},
+	})
+	require.Len(t, launches.missing(map[string]string{"group": "workers"}, nil), 1)
+	require.Empty(t, launches.missing(map[string]string{"group": "managers"}, nil))
+
+	now = now.Add(launchVisibilityWindow + time.Second)
+	require.Empty(t, launches.missing(map[string]string{"group": "workers"}, nil))
+	require.Empty(t, launches.instances)
+}
@@ -0,0 +1,202 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/pflag"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRenewWindow renews temporary credentials before they expire, allowing for clock skew.
+	defaultRenewWindow = time.Minute
+)
+
+// credentialOptions configure the renewal and validation of the plugin's credentials.
+type credentialOptions struct {
+	checkInterval   time.Duration
+	expiryWarning   time.Duration
+	renewWindow     time.Duration
+	sessionDuration time.Duration
+}
+
+func (o *credentialOptions) flags(flags *pflag.FlagSet) {
+	flags.DurationVar(
+		&o.checkInterval,
+		"credentials-check-interval",
+		5*time.Minute,
+		"Interval between validations of the plugin's credentials with STS GetCallerIdentity, or 0 to disable them")
+	flags.DurationVar(
+		&o.expiryWarning,
+		"credentials-expiry-warning",
+		15*time.Minute,
+		"Warn when temporary credentials expire within this duration")
+	flags.DurationVar(
+		&o.renewWindow,
+		"credentials-renew-window",
+		5*time.Minute,
+		"Renew temporary credentials this long before they expire")
+	flags.DurationVar(
+		&o.sessionDuration,
+		"role-session-duration",
+		time.Hour,
+		"Duration of the sessions of the role assumed with --role-arn")
+}
+
+// expiringProvider is a credentials provider that knows when its credentials expire.
+type expiringProvider interface {
+	credentials.Provider
+	expiresAt() time.Time
+}
+
+// assumedRoleProvider records the expiration of the credentials of an assumed role.  The vendored SDK does not expose
+// it, so it is derived from the session duration.
+type assumedRoleProvider struct {
+	*stscreds.AssumeRoleProvider
+
+	lock       sync.Mutex
+	now        func() time.Time
+	expiration time.Time
+}
+
+func newAssumedRoleProvider(
+	client stscreds.AssumeRoler,
+	roleARN string,
+	options credentialOptions) *assumedRoleProvider {
+
+	return &assumedRoleProvider{
+		AssumeRoleProvider: &stscreds.AssumeRoleProvider{
+			Client:       client,
+			RoleARN:      roleARN,
+			Duration:     options.sessionDuration,
+			ExpiryWindow: options.renewWindow,
+		},
+		now: time.Now,
+	}
+}
+
+// Retrieve implements credentials.Provider.Retrieve.
+func (p *assumedRoleProvider) Retrieve() (credentials.Value, error) {
+	requested := p.now()
+	value, err := p.AssumeRoleProvider.Retrieve()
+	if err == nil {
+		p.lock.Lock()
+		p.expiration = requested.Add(p.Duration)
+		p.lock.Unlock()
+	}
+	return value, err
+}
+
+func (p *assumedRoleProvider) expiresAt() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.expiration
+}
+
+// credentialMonitor periodically validates the plugin's credentials, so that invalid or expiring credentials are
+// reported when they fail rather than when an operation such as a rolling update is underway.
+type credentialMonitor struct {
+	credentials *credentials.Credentials
+
+	// providers are the providers that know when their credentials expire, by provider name.
+	providers map[string]expiringProvider
+
+	// identity returns the caller identity of the credentials.
+	identity func() (string, error)
+
+	expiryWarning time.Duration
+	now           func() time.Time
+}
+
+func newCredentialMonitor(
+	creds *credentials.Credentials,
+	stsClient *sts.STS,
+	expiryWarning time.Duration,
+	providers map[string]expiringProvider) *credentialMonitor {
+
+	return &credentialMonitor{
+		credentials: creds,
+		providers:   providers,
+		identity: func() (string, error) {
+			identity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			if err != nil {
+				return "", err
+			}
+			return aws.StringValue(identity.Arn), nil
+		},
+		expiryWarning: expiryWarning,
+		now:           time.Now,
+	}
+}
+
+// expiredCredentials determines whether an error is caused by expired credentials.
+func expiredCredentials(err error) bool {
+	if awsErr, is := err.(awserr.Error); is {
+		switch awsErr.Code() {
+		case "ExpiredToken", "ExpiredTokenException", "RequestExpired":
+			return true
+		}
+	}
+	return false
+}
+
+// check validates the credentials, renewing them once if they have expired, and warns when they expire soon.  It
+// returns the error of the validation.
+func (m *credentialMonitor) check() error {
+	value, err := m.credentials.Get()
+	if err != nil {
+		log.Errorf("AWS credentials are unavailable: %s", err)
+		return err
+	}
+
+	arn, err := m.identity()
+	if expiredCredentials(err) {
+		log.Warnf("AWS credentials from %s have expired, renewing them", value.ProviderName)
+		m.credentials.Expire()
+		arn, err = m.identity()
+	}
+	if err != nil {
+		log.Errorf("AWS credentials from %s are invalid: %s", value.ProviderName, err)
+		return err
+	}
+
+	// Credentials expiring soon are renewed early, and only reported if the renewed credentials also expire soon, such
+	// as when the session duration is shorter than the warning.
+	if provider, has := m.providers[value.ProviderName]; has && m.expiresSoon(provider) {
+		log.Infof("AWS credentials of %s from %s expire soon, renewing them", arn, value.ProviderName)
+		m.credentials.Expire()
+		if _, err := m.credentials.Get(); err != nil {
+			log.Errorf("Failed to renew AWS credentials from %s: %s", value.ProviderName, err)
+			return err
+		}
+		if m.expiresSoon(provider) {
+			expiration := provider.expiresAt()
+			log.Warnf("AWS credentials of %s from %s expire in %s, at %s",
+				arn,
+				value.ProviderName,
+				expiration.Sub(m.now()),
+				expiration.Format(time.RFC3339))
+		}
+	}
+
+	log.Debugf("AWS credentials of %s from %s are valid", arn, value.ProviderName)
+	return nil
+}
+
+func (m *credentialMonitor) expiresSoon(provider expiringProvider) bool {
+	expiration := provider.expiresAt()
+	return !expiration.IsZero() && expiration.Sub(m.now()) < m.expiryWarning
+}
+
+// run checks the credentials now and at an interval, forever.
+func (m *credentialMonitor) run(interval time.Duration) {
+	m.check()
+	for range time.Tick(interval) {
+		m.check()
+	}
+}
@@ -0,0 +1,118 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// fakeExpiringProvider counts the retrievals of credentials that expire at a fixed time.
+type fakeExpiringProvider struct {
+	retrievals int
+	expiration time.Time
+	expired    bool
+}
+
+func (f *fakeExpiringProvider) Retrieve() (credentials.Value, error) {
+	f.retrievals++
+	f.expired = false
+	return credentials.Value{AccessKeyID: "key", ProviderName: "fake"}, nil
+}
+
+func (f *fakeExpiringProvider) IsExpired() bool {
+	return f.expired
+}
+
+func (f *fakeExpiringProvider) expiresAt() time.Time {
+	return f.expiration
+}
+
+func TestCredentialMonitorRenewsExpiredCredentials(t *testing.T) {
+	now := time.Now()
+	provider := &fakeExpiringProvider{expiration: now.Add(time.Hour)}
+	calls := 0
+	monitor := &credentialMonitor{
+		credentials: credentials.NewCredentials(provider),
+		providers:   map[string]expiringProvider{"fake": provider},
+		identity: func() (string, error) {
+			calls++
+			if calls == 1 {
+				return "", awserr.New("ExpiredToken", "The security token included in the request is expired", nil)
+			}
+			return "arn:aws:sts::123456789012:assumed-role/infrakit/plugin", nil
+		},
+		expiryWarning: 15 * time.Minute,
+		now:           func() time.Time { return now },
+	}
+
+	require.NoError(t, monitor.check())
+	require.Equal(t, 2, calls)
+
+	// The expired credentials are retrieved again when they are next used.
+	_, err := monitor.credentials.Get()
+	require.NoError(t, err)
+	require.Equal(t, 2, provider.retrievals)
+}
+
+func TestCredentialMonitorInvalidCredentials(t *testing.T) {
+	provider := &fakeExpiringProvider{}
+	monitor := &credentialMonitor{
+		credentials:   credentials.NewCredentials(provider),
+		identity:      func() (string, error) { return "", errors.New("InvalidClientTokenId") },
+		expiryWarning: time.Minute,
+		now:           time.Now,
+	}
+	require.Error(t, monitor.check())
+}
+
+type fakeAssumeRoler struct {
+	expiration time.Time
+}
+
+func (f fakeAssumeRoler) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return &sts.AssumeRoleOutput{Credentials: &sts.Credentials{
+		AccessKeyId:     aws.String("key"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(f.expiration),
+	}}, nil
+}
+
+func TestAssumedRoleProviderExpiry(t *testing.T) {
+	now := time.Now()
+	provider := newAssumedRoleProvider(
+		fakeAssumeRoler{expiration: now.Add(time.Hour)},
+		"arn:aws:iam::123456789012:role/infrakit",
+		credentialOptions{sessionDuration: time.Hour, renewWindow: 5 * time.Minute})
+	provider.now = func() time.Time { return now }
+
+	require.True(t, provider.expiresAt().IsZero())
+	_, err := provider.Retrieve()
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Hour), provider.expiresAt())
+	require.False(t, provider.IsExpired())
+
+	// Credentials are renewed within the renew window of their expiration.
+	provider.CurrentTime = func() time.Time { return now.Add(56 * time.Minute) }
+	require.True(t, provider.IsExpired())
+}
+
+func TestCredentialMonitorRenewsExpiringCredentials(t *testing.T) {
+	now := time.Now()
+	provider := &fakeExpiringProvider{expiration: now.Add(5 * time.Minute)}
+	monitor := &credentialMonitor{
+		credentials:   credentials.NewCredentials(provider),
+		providers:     map[string]expiringProvider{"fake": provider},
+		identity:      func() (string, error) { return "arn:aws:iam::123456789012:user/infrakit", nil },
+		expiryWarning: 15 * time.Minute,
+		now:           func() time.Time { return now },
+	}
+
+	require.NoError(t, monitor.check())
+	require.Equal(t, 2, provider.retrievals)
+}
@@ -0,0 +1,147 @@
+package instance
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// anyGroup applies describe filters to the DescribeInstances calls of every group.
+	anyGroup = "*"
+
+	// launchedAfterFilter and launchedBeforeFilter select instances by a range of launch times, which the
+	// launch-time filter of EC2 only matches by wildcard.  They are applied to the instances EC2 returns.
+	launchedAfterFilter  = "launched-after"
+	launchedBeforeFilter = "launched-before"
+)
+
+// groupDescribeFilters are the filters added to the DescribeInstances calls of a group.
+type groupDescribeFilters struct {
+	// filters are EC2 filters by name.  A filter replaces the default filter of the same name, such as
+	// instance-state-name.
+	filters map[string][]string
+
+	launchedAfter  time.Time
+	launchedBefore time.Time
+}
+
+func (f groupDescribeFilters) empty() bool {
+	return len(f.filters) == 0 && f.launchedAfter.IsZero() && f.launchedBefore.IsZero()
+}
+
+// describeFilters are the filters of DescribeInstances calls, by the group tag of the calls.
+type describeFilters map[string]groupDescribeFilters
+
+// parseDescribeFilters parses a list of group:name=value filters.  Filters of the same group and name are combined,
+// matching instances with any of their values.  The group * adds a filter to every group.
+func parseDescribeFilters(groupFilters []string) (describeFilters, error) {
+	filters := describeFilters{}
+	for _, groupFilter := range groupFilters {
+		groupAndFilter := strings.SplitN(groupFilter, ":", 2)
+		if len(groupAndFilter) != 2 {
+			return nil, fmt.Errorf("Describe filters must be formatted as group:name=value: %s", groupFilter)
+		}
+		nameAndValue := strings.SplitN(groupAndFilter[1], "=", 2)
+		if len(nameAndValue) != 2 || groupAndFilter[0] == "" || nameAndValue[0] == "" {
+			return nil, fmt.Errorf("Describe filters must be formatted as group:name=value: %s", groupFilter)
+		}
+
+		group, name, value := groupAndFilter[0], nameAndValue[0], nameAndValue[1]
+		existing, has := filters[group]
+		if !has {
+			existing = groupDescribeFilters{filters: map[string][]string{}}
+		}
+		switch name {
+		case launchedAfterFilter, launchedBeforeFilter:
+			launchTime, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("Filter %s of group %s must be an RFC 3339 time: %s", name, group, err)
+			}
+			if name == launchedAfterFilter {
+				existing.launchedAfter = launchTime
+			} else {
+				existing.launchedBefore = launchTime
+			}
+		default:
+			existing.filters[name] = append(existing.filters[name], value)
+		}
+		filters[group] = existing
+	}
+	return filters, nil
+}
+
+// forTags returns the filters of the DescribeInstances calls matching tags.  The filters of the group of the tags
+// replace those of the same name of every group.
+func (f describeFilters) forTags(tags map[string]string) groupDescribeFilters {
+	combined := groupDescribeFilters{filters: map[string][]string{}}
+	groups := []string{anyGroup}
+	if group, has := tags[GroupTag]; has && group != anyGroup {
+		groups = append(groups, group)
+	}
+	for _, group := range groups {
+		groupFilters, has := f[group]
+		if !has {
+			continue
+		}
+		for name, values := range groupFilters.filters {
+			combined.filters[name] = values
+		}
+		if !groupFilters.launchedAfter.IsZero() {
+			combined.launchedAfter = groupFilters.launchedAfter
+		}
+		if !groupFilters.launchedBefore.IsZero() {
+			combined.launchedBefore = groupFilters.launchedBefore
+		}
+	}
+	return combined
+}
+
+// apply adds the filters to a DescribeInstances request, replacing the filters of the request of the same names.
+func (f groupDescribeFilters) apply(input *ec2.DescribeInstancesInput) *ec2.DescribeInstancesInput {
+	if len(f.filters) == 0 {
+		return input
+	}
+
+	filters := []*ec2.Filter{}
+	for _, filter := range input.Filters {
+		if _, replaced := f.filters[aws.StringValue(filter.Name)]; !replaced {
+			filters = append(filters, filter)
+		}
+	}
+	names := []string{}
+	for name := range f.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		filters = append(filters, &ec2.Filter{Name: aws.String(name), Values: aws.StringSlice(f.filters[name])})
+	}
+
+	filtered := *input
+	filtered.Filters = filters
+	return &filtered
+}
+
+// matchLaunchTime removes the instances launched outside of the launch time range of the filters.
+func (f groupDescribeFilters) matchLaunchTime(instances []*ec2.Instance) []*ec2.Instance {
+	if f.launchedAfter.IsZero() && f.launchedBefore.IsZero() {
+		return instances
+	}
+
+	matched := []*ec2.Instance{}
+	for _, ec2Instance := range instances {
+		launched := aws.TimeValue(ec2Instance.LaunchTime)
+		if !f.launchedAfter.IsZero() && !launched.After(f.launchedAfter) {
+			continue
+		}
+		if !f.launchedBefore.IsZero() && !launched.Before(f.launchedBefore) {
+			continue
+		}
+		matched = append(matched, ec2Instance)
+	}
+	return matched
+}
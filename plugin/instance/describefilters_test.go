@@ -0,0 +1,93 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseDescribeFilters(t *testing.T) {
+	filters, err := parseDescribeFilters([]string{
+		"*:instance-state-name=running",
+		"workers:image-id=ami-1",
+		"workers:image-id=ami-2",
+		"workers:launched-before=2024-01-02T00:00:00Z",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"instance-state-name": {"running"}}, filters[anyGroup].filters)
+	require.Equal(t, map[string][]string{"image-id": {"ami-1", "ami-2"}}, filters["workers"].filters)
+	require.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), filters["workers"].launchedBefore)
+
+	for _, invalid := range []string{"workers", "workers:image-id", ":image-id=ami-1", "workers:launched-after=yesterday"} {
+		_, err := parseDescribeFilters([]string{invalid})
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestDescribeFiltersForTags(t *testing.T) {
+	filters, err := parseDescribeFilters([]string{
+		"*:instance-state-name=running",
+		"*:image-id=ami-1",
+		"workers:image-id=ami-2",
+	})
+	require.NoError(t, err)
+
+	require.Equal(t,
+		map[string][]string{"instance-state-name": {"running"}, "image-id": {"ami-2"}},
+		filters.forTags(map[string]string{GroupTag: "workers"}).filters)
+	require.Equal(t,
+		map[string][]string{"instance-state-name": {"running"}, "image-id": {"ami-1"}},
+		filters.forTags(map[string]string{GroupTag: "managers"}).filters)
+	require.True(t, describeFilters(nil).forTags(map[string]string{GroupTag: "workers"}).empty())
+}
+
+func TestDescribeInstancesWithFilters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+
+	filters, err := parseDescribeFilters([]string{
+		"workers:instance-state-name=running",
+		"workers:instance-state-name=stopped",
+		"workers:launched-after=2024-01-01T00:00:00Z",
+	})
+	require.NoError(t, err)
+
+	groupTags := map[string]string{GroupTag: "workers"}
+	request := describeGroupRequest(testNamespace, groupTags, nil)
+	request.Filters[0].Values = aws.StringSlice([]string{"running", "stopped"})
+	request.Filters = append(request.Filters[1:], request.Filters[0])
+
+	response := describeInstancesResponse([][]string{{"old", "new"}}, groupTags, nil)
+	response.Reservations[0].Instances[0].LaunchTime = aws.Time(time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	response.Reservations[0].Instances[1].LaunchTime = aws.Time(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	clientMock.EXPECT().DescribeInstances(request).Return(response, nil)
+
+	pluginImpl := &awsInstancePlugin{client: clientMock, namespaceTags: testNamespace, describeFilters: filters}
+	descriptions, err := pluginImpl.DescribeInstances(groupTags)
+	require.NoError(t, err)
+	require.Len(t, descriptions, 1)
+	require.Equal(t, "new", string(descriptions[0].ID))
+}
+
+func TestDescribeFiltersLeaveOtherGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+
+	filters, err := parseDescribeFilters([]string{"workers:image-id=ami-1"})
+	require.NoError(t, err)
+
+	groupTags := map[string]string{GroupTag: "managers"}
+	clientMock.EXPECT().DescribeInstances(describeGroupRequest(testNamespace, groupTags, nil)).
+		Return(&ec2.DescribeInstancesOutput{}, nil)
+
+	pluginImpl := &awsInstancePlugin{client: clientMock, namespaceTags: testNamespace, describeFilters: filters}
+	descriptions, err := pluginImpl.DescribeInstances(groupTags)
+	require.NoError(t, err)
+	require.Empty(t, descriptions)
+}
@@ -0,0 +1,168 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DetailTagPrefix prefixes the keys of instance details included in tags of instance descriptions.
+	DetailTagPrefix = "infrakit.aws."
+
+	lifecycleOnDemand = "on-demand"
+)
+
+// Details are properties of an instance reported by EC2.
+type Details struct {
+	ID               instance.ID
+	PrivateIPAddress string     `json:",omitempty"`
+	PublicIPAddress  string     `json:",omitempty"`
+	IPv6Addresses    []string   `json:",omitempty"`
+	IPv4Prefixes     []string   `json:",omitempty"`
+	AvailabilityZone string     `json:",omitempty"`
+	InstanceType     string     `json:",omitempty"`
+	LaunchTime       *time.Time `json:",omitempty"`
+
+	// Lifecycle is spot for spot instances, and on-demand otherwise.
+	Lifecycle string
+
+	// State is the state of the instance, such as pending, running, or stopped.
+	State string `json:",omitempty"`
+
+	Tags map[string]string
+}
+
+// DetailDescriber describes instances along with their EC2 details.
+type DetailDescriber interface {
+	// DescribeDetails lists the details of instances matching all of the provided tags.
+	DescribeDetails(tags map[string]string) ([]Details, error)
+}
+
+func detailsOf(ec2Instance *ec2.Instance) Details {
+	details := Details{
+		ID:               instance.ID(aws.StringValue(ec2Instance.InstanceId)),
+		PrivateIPAddress: aws.StringValue(ec2Instance.PrivateIpAddress),
+		PublicIPAddress:  aws.StringValue(ec2Instance.PublicIpAddress),
+		InstanceType:     aws.StringValue(ec2Instance.InstanceType),
+		LaunchTime:       ec2Instance.LaunchTime,
+		Lifecycle:        aws.StringValue(ec2Instance.InstanceLifecycle),
+		Tags:             map[string]string{},
+	}
+	if details.Lifecycle == "" {
+		details.Lifecycle = lifecycleOnDemand
+	}
+	if ec2Instance.Placement != nil {
+		details.AvailabilityZone = aws.StringValue(ec2Instance.Placement.AvailabilityZone)
+	}
+	if ec2Instance.State != nil {
+		details.State = aws.StringValue(ec2Instance.State.Name)
+	}
+	for _, tag := range ec2Instance.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			details.Tags[*tag.Key] = *tag.Value
+		}
+	}
+	return details
+}
+
+// detailTags flattens details into tags, omitting details that are unknown.
+func (d Details) detailTags() map[string]string {
+	tags := map[string]string{}
+	add := func(key, value string) {
+		if value != "" {
+			tags[DetailTagPrefix+key] = value
+		}
+	}
+
+	add("private-ip", d.PrivateIPAddress)
+	add("public-ip", d.PublicIPAddress)
+	add("ipv6", strings.Join(d.IPv6Addresses, ","))
+	add("ipv4-prefixes", strings.Join(d.IPv4Prefixes, ","))
+	add("availability-zone", d.AvailabilityZone)
+	add("instance-type", d.InstanceType)
+	if d.LaunchTime != nil {
+		add("launch-time", d.LaunchTime.UTC().Format(time.RFC3339))
+	}
+	add("lifecycle", d.Lifecycle)
+	add("state", d.State)
+	return tags
+}
+
+// DescribeDetails implements DetailDescriber.DescribeDetails.
+func (p awsInstancePlugin) DescribeDetails(tags map[string]string) ([]Details, error) {
+	instances, err := p.describeFilteredInstances(tags, p.describeFilters.forTags(tags), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	instances = p.reconcileDuplicates(instances)
+	addresses := p.interfaceAddresses(instances)
+
+	details := []Details{}
+	for _, ec2Instance := range instances {
+		instanceDetails := detailsOf(ec2Instance)
+		instanceDetails.IPv6Addresses = addresses[string(instanceDetails.ID)].ipv6
+		instanceDetails.IPv4Prefixes = addresses[string(instanceDetails.ID)].ipv4Prefixes
+		details = append(details, instanceDetails)
+	}
+	return details, nil
+}
+
+// interfaceAddresses are the addresses of the network interfaces of an instance that are not included in instance
+// descriptions by the vendored SDK.
+type interfaceAddresses struct {
+	ipv6         []string
+	ipv4Prefixes []string
+}
+
+// interfaceAddresses looks up the IPv6 addresses and IPv4 prefixes of the network interfaces attached to instances.
+// Addresses are omitted if the lookup fails.
+func (p awsInstancePlugin) interfaceAddresses(instances []*ec2.Instance) map[string]interfaceAddresses {
+	addresses := map[string]interfaceAddresses{}
+	if len(instances) == 0 {
+		return addresses
+	}
+
+	ids := []*string{}
+	for _, ec2Instance := range instances {
+		ids = append(ids, ec2Instance.InstanceId)
+	}
+
+	req, _ := p.client.DescribeNetworkInterfacesRequest(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("attachment.instance-id"), Values: ids}},
+	})
+	output := &ec2ext.DescribeNetworkInterfaceIpv6AddressesOutput{}
+	req.Data = output
+	if err := ec2ext.Send(req, nil); err != nil {
+		log.Warnf("Failed to look up network interface addresses of instances: %s", err)
+		return addresses
+	}
+
+	for _, networkInterface := range output.NetworkInterfaces {
+		if networkInterface.Attachment == nil || networkInterface.Attachment.InstanceId == nil {
+			continue
+		}
+		id := *networkInterface.Attachment.InstanceId
+		instanceAddresses := addresses[id]
+		for _, address := range networkInterface.Ipv6Addresses {
+			if address.Ipv6Address != nil {
+				instanceAddresses.ipv6 = append(instanceAddresses.ipv6, *address.Ipv6Address)
+			}
+		}
+		for _, prefix := range networkInterface.Ipv4Prefixes {
+			if prefix.Ipv4Prefix != nil {
+				instanceAddresses.ipv4Prefixes = append(instanceAddresses.ipv4Prefixes, *prefix.Ipv4Prefix)
+			}
+		}
+		sort.Strings(instanceAddresses.ipv6)
+		sort.Strings(instanceAddresses.ipv4Prefixes)
+		addresses[id] = instanceAddresses
+	}
+	return addresses
+}
@@ -0,0 +1,161 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func detailedInstances() *ec2.DescribeInstancesOutput {
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{
+		{
+			InstanceId:        aws.String("spot"),
+			PrivateIpAddress:  aws.String("10.0.0.1"),
+			PublicIpAddress:   aws.String("54.0.0.1"),
+			InstanceType:      aws.String("m4.large"),
+			InstanceLifecycle: aws.String("spot"),
+			LaunchTime:        aws.Time(time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)),
+			Placement:         &ec2.Placement{AvailabilityZone: aws.String("us-west-2a")},
+			State:             &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+			Tags:              []*ec2.Tag{{Key: aws.String("group"), Value: aws.String("workers")}},
+		},
+		{
+			InstanceId:       aws.String("on-demand"),
+			PrivateIpAddress: aws.String("10.0.0.2"),
+		},
+	}}}}
+}
+
+// ipv6Request is a DescribeNetworkInterfaces request responding with the IPv6 addresses of instances.
+func ipv6Request(addresses map[string][]string) *request.Request {
+	req := fakeRequest(nil)
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		output := r.Data.(*ec2ext.DescribeNetworkInterfaceIpv6AddressesOutput)
+		for id, instanceAddresses := range addresses {
+			networkInterface := &ec2ext.NetworkInterfaceIpv6Addresses{
+				Attachment: &ec2.NetworkInterfaceAttachment{InstanceId: aws.String(id)},
+			}
+			for _, address := range instanceAddresses {
+				networkInterface.Ipv6Addresses = append(networkInterface.Ipv6Addresses,
+					&ec2ext.InstanceIpv6Address{Ipv6Address: aws.String(address)})
+			}
+			output.NetworkInterfaces = append(output.NetworkInterfaces, networkInterface)
+		}
+	})
+	return req
+}
+
+func TestDescribeDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(detailedInstances(), nil)
+	clientMock.EXPECT().DescribeNetworkInterfacesRequest(gomock.Any()).
+		Do(func(input *ec2.DescribeNetworkInterfacesInput) {
+			require.Equal(t, "attachment.instance-id", *input.Filters[0].Name)
+			require.Equal(t, []*string{aws.String("spot"), aws.String("on-demand")}, input.Filters[0].Values)
+		}).
+		Return(ipv6Request(map[string][]string{"spot": {"2600:1f14::2", "2600:1f14::1"}}), nil)
+
+	details, err := NewInstancePlugin(clientMock, testNamespace).(DetailDescriber).DescribeDetails(tags)
+	require.NoError(t, err)
+	require.Equal(t, []Details{
+		{
+			ID:               "spot",
+			PrivateIPAddress: "10.0.0.1",
+			PublicIPAddress:  "54.0.0.1",
+			IPv6Addresses:    []string{"2600:1f14::1", "2600:1f14::2"},
+			AvailabilityZone: "us-west-2a",
+			InstanceType:     "m4.large",
+			LaunchTime:       aws.Time(time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)),
+			Lifecycle:        "spot",
+			State:            "running",
+			Tags:             map[string]string{"group": "workers"},
+		},
+		{
+			ID:               "on-demand",
+			PrivateIPAddress: "10.0.0.2",
+			Lifecycle:        "on-demand",
+			Tags:             map[string]string{},
+		},
+	}, details)
+}
+
+func TestDescribeInstancesWithDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(detailedInstances(), nil)
+	clientMock.EXPECT().DescribeNetworkInterfacesRequest(gomock.Any()).
+		Return(ipv6Request(map[string][]string{"spot": {"2600:1f14::1"}}), nil)
+
+	pluginImpl := &awsInstancePlugin{client: clientMock, namespaceTags: testNamespace, describeDetails: true}
+	descriptions, err := pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"group":                          "workers",
+		"infrakit.aws.private-ip":        "10.0.0.1",
+		"infrakit.aws.public-ip":         "54.0.0.1",
+		"infrakit.aws.ipv6":              "2600:1f14::1",
+		"infrakit.aws.availability-zone": "us-west-2a",
+		"infrakit.aws.instance-type":     "m4.large",
+		"infrakit.aws.launch-time":       "2016-11-01T12:00:00Z",
+		"infrakit.aws.lifecycle":         "spot",
+		"infrakit.aws.state":             "running",
+	}, descriptions[0].Tags)
+	require.Equal(t, map[string]string{
+		"infrakit.aws.private-ip": "10.0.0.2",
+		"infrakit.aws.lifecycle":  "on-demand",
+	}, descriptions[1].Tags)
+}
+
+func TestDescribeDetailsWithoutIPv6Addresses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(detailedInstances(), nil)
+	clientMock.EXPECT().DescribeNetworkInterfacesRequest(gomock.Any()).
+		Return(fakeRequest(errors.New("UnauthorizedOperation")), nil)
+
+	details, err := NewInstancePlugin(clientMock, testNamespace).(DetailDescriber).DescribeDetails(tags)
+	require.NoError(t, err)
+	require.Len(t, details, 2)
+	require.Empty(t, details[0].IPv6Addresses)
+}
+
+func TestDescribeDetailsWithIpv4Prefixes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	req := fakeRequest(nil)
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		r.Data.(*ec2ext.DescribeNetworkInterfaceIpv6AddressesOutput).NetworkInterfaces = []*ec2ext.NetworkInterfaceIpv6Addresses{{
+			Attachment: &ec2.NetworkInterfaceAttachment{InstanceId: aws.String("spot")},
+			Ipv4Prefixes: []*ec2ext.Ipv4PrefixSpecification{
+				{Ipv4Prefix: aws.String("10.0.1.32/28")},
+				{Ipv4Prefix: aws.String("10.0.1.16/28")},
+			},
+		}}
+	})
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(detailedInstances(), nil)
+	clientMock.EXPECT().DescribeNetworkInterfacesRequest(gomock.Any()).Return(req, nil)
+
+	pluginImpl := &awsInstancePlugin{client: clientMock, namespaceTags: testNamespace, describeDetails: true}
+	descriptions, err := pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.1.16/28,10.0.1.32/28", descriptions[0].Tags["infrakit.aws.ipv4-prefixes"])
+	_, hasPrefixes := descriptions[1].Tags["infrakit.aws.ipv4-prefixes"]
+	require.False(t, hasPrefixes)
+}
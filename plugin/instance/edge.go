@@ -0,0 +1,241 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/restjson"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"sync"
+)
+
+// EdgeLocation places instances on an AWS Outpost or in a Local Zone, rather than in an availability zone of the
+// region.  Instances are placed by their subnet, which must be a subnet of the Outpost or Local Zone, and their
+// instance types must be offered there.
+type EdgeLocation struct {
+	// OutpostARN is the Outpost instances are launched on.
+	OutpostARN string `json:",omitempty"`
+
+	// LocalZone is the Local Zone instances are launched in, such as us-west-2-lax-1a.
+	LocalZone string `json:",omitempty"`
+}
+
+func (e EdgeLocation) String() string {
+	if e.OutpostARN != "" {
+		return fmt.Sprintf("Outpost %s", e.OutpostARN)
+	}
+	return fmt.Sprintf("Local Zone %s", e.LocalZone)
+}
+
+// validate performs local checks of the edge location of a request.
+func (e *EdgeLocation) validate(request CreateInstanceRequest) error {
+	if e == nil {
+		return nil
+	}
+	if (e.OutpostARN == "") == (e.LocalZone == "") {
+		return errors.New("EdgeLocation must set one of OutpostARN or LocalZone")
+	}
+	if len(request.AvailabilityZones) > 0 {
+		return errors.New("AvailabilityZones may not be set with an EdgeLocation")
+	}
+	placement := request.RunInstancesInput.Placement
+	if e.LocalZone != "" && placement != nil && placement.AvailabilityZone != nil &&
+		*placement.AvailabilityZone != e.LocalZone {
+
+		return fmt.Errorf("Placement is in %s rather than Local Zone %s", *placement.AvailabilityZone, e.LocalZone)
+	}
+	return nil
+}
+
+// edgeAPI looks up the instance types offered in edge locations.
+type edgeAPI interface {
+	LocalZoneInstanceTypes(zone string) ([]string, error)
+	OutpostInstanceTypes(outpostARN string) ([]string, error)
+}
+
+type getOutpostInstanceTypesInput struct {
+	_ struct{} `type:"structure"`
+
+	OutpostID *string `location:"uri" locationName:"OutpostId" type:"string" required:"true"`
+	NextToken *string `location:"querystring" locationName:"NextToken" type:"string"`
+}
+
+type outpostInstanceType struct {
+	InstanceType *string `type:"string"`
+}
+
+type getOutpostInstanceTypesOutput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceTypes []*outpostInstanceType `type:"list"`
+	NextToken     *string                `type:"string"`
+}
+
+// edgeClient looks up the instance types of Local Zones with EC2, and of Outposts with the Outposts API.  The Outposts
+// API is not vendored, so its client is assembled from the SDK's REST JSON protocol handlers.  Instance types are
+// cached by location, since they change rarely.
+type edgeClient struct {
+	ec2      *ec2ext.EC2
+	outposts *client.Client
+
+	lock    sync.Mutex
+	offered map[string][]string
+}
+
+func newEdgeClient(config client.ConfigProvider, ec2Client *ec2.EC2) *edgeClient {
+	c := config.ClientConfig("outposts")
+	outposts := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "outposts",
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2019-12-03",
+		},
+		c.Handlers)
+	outposts.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	outposts.Handlers.Build.PushBackNamed(restjson.BuildHandler)
+	outposts.Handlers.Unmarshal.PushBackNamed(restjson.UnmarshalHandler)
+	outposts.Handlers.UnmarshalMeta.PushBackNamed(restjson.UnmarshalMetaHandler)
+	outposts.Handlers.UnmarshalError.PushBackNamed(restjson.UnmarshalErrorHandler)
+	return &edgeClient{ec2: ec2ext.New(ec2Client), outposts: outposts, offered: map[string][]string{}}
+}
+
+func (c *edgeClient) cached(location string, lookup func() ([]string, error)) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if offered, has := c.offered[location]; has {
+		return offered, nil
+	}
+	offered, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+	c.offered[location] = offered
+	return offered, nil
+}
+
+// LocalZoneInstanceTypes lists the instance types offered in a Local Zone.
+func (c *edgeClient) LocalZoneInstanceTypes(zone string) ([]string, error) {
+	return c.cached(zone, func() ([]string, error) {
+		input := &ec2ext.DescribeInstanceTypeOfferingsInput{
+			LocationType: aws.String("availability-zone"),
+			Filters:      []*ec2.Filter{{Name: aws.String("location"), Values: []*string{aws.String(zone)}}},
+		}
+		offered := []string{}
+		for {
+			output, err := c.ec2.DescribeInstanceTypeOfferings(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, offering := range output.InstanceTypeOfferings {
+				offered = append(offered, aws.StringValue(offering.InstanceType))
+			}
+			if aws.StringValue(output.NextToken) == "" {
+				return offered, nil
+			}
+			input.NextToken = output.NextToken
+		}
+	})
+}
+
+// OutpostInstanceTypes lists the instance types of the capacity of an Outpost.
+func (c *edgeClient) OutpostInstanceTypes(outpostARN string) ([]string, error) {
+	return c.cached(outpostARN, func() ([]string, error) {
+		operation := &request.Operation{
+			Name:       "GetOutpostInstanceTypes",
+			HTTPMethod: "GET",
+			HTTPPath:   "/outposts/{OutpostId}/instanceTypes",
+		}
+		input := &getOutpostInstanceTypesInput{OutpostID: aws.String(outpostARN)}
+		offered := []string{}
+		for {
+			output := &getOutpostInstanceTypesOutput{}
+			if err := c.outposts.NewRequest(operation, input, output).Send(); err != nil {
+				return nil, err
+			}
+			for _, instanceType := range output.InstanceTypes {
+				offered = append(offered, aws.StringValue(instanceType.InstanceType))
+			}
+			if aws.StringValue(output.NextToken) == "" {
+				return offered, nil
+			}
+			input.NextToken = output.NextToken
+		}
+	})
+}
+
+// launchSubnet is the subnet a request launches in, if it is set.
+func launchSubnet(run ec2.RunInstancesInput) *string {
+	for _, networkInterface := range run.NetworkInterfaces {
+		if networkInterface.DeviceIndex == nil || *networkInterface.DeviceIndex == 0 {
+			return networkInterface.SubnetId
+		}
+	}
+	return run.SubnetId
+}
+
+// checkEdgeLocation verifies that the subnet of a request is in its edge location, and that its instance types are
+// offered there.  Requests in Local Zones are placed in the zone.
+func (p awsInstancePlugin) checkEdgeLocation(request *CreateInstanceRequest) error {
+	edge := request.EdgeLocation
+	if edge == nil {
+		return nil
+	}
+	if p.edge == nil {
+		return errors.New("EdgeLocation is not supported without an edge location client")
+	}
+
+	subnetID := launchSubnet(request.RunInstancesInput)
+	if subnetID == nil {
+		return fmt.Errorf("A subnet of %s must be set", edge)
+	}
+	req, _ := p.client.DescribeSubnetsRequest(&ec2.DescribeSubnetsInput{SubnetIds: []*string{subnetID}})
+	subnets := &ec2ext.DescribeSubnetLocationsOutput{}
+	req.Data = subnets
+	if err := ec2ext.Send(req, nil); err != nil {
+		return fmt.Errorf("Failed to look up subnet %s: %s", *subnetID, err)
+	}
+	if len(subnets.Subnets) != 1 {
+		return fmt.Errorf("Subnet %s not found", *subnetID)
+	}
+	subnet := subnets.Subnets[0]
+
+	var offered []string
+	var err error
+	if edge.OutpostARN != "" {
+		if aws.StringValue(subnet.OutpostArn) != edge.OutpostARN {
+			return fmt.Errorf("Subnet %s is not a subnet of %s", *subnetID, edge)
+		}
+		offered, err = p.edge.OutpostInstanceTypes(edge.OutpostARN)
+	} else {
+		if aws.StringValue(subnet.AvailabilityZone) != edge.LocalZone {
+			return fmt.Errorf("Subnet %s is not in %s", *subnetID, edge)
+		}
+		if request.RunInstancesInput.Placement == nil {
+			request.RunInstancesInput.Placement = &ec2.Placement{}
+		}
+		request.RunInstancesInput.Placement.AvailabilityZone = aws.String(edge.LocalZone)
+		offered, err = p.edge.LocalZoneInstanceTypes(edge.LocalZone)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to look up the instance types of %s: %s", edge, err)
+	}
+
+	for _, instanceType := range requestInstanceTypes(*request) {
+		supported := false
+		for _, offer := range offered {
+			supported = supported || offer == instanceType
+		}
+		if !supported {
+			return fmt.Errorf("Instance type %s is not offered in %s", instanceType, edge)
+		}
+	}
+	return nil
+}
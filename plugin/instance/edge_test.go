@@ -0,0 +1,149 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type fakeEdge struct {
+	zones    map[string][]string
+	outposts map[string][]string
+}
+
+func (f fakeEdge) LocalZoneInstanceTypes(zone string) ([]string, error) {
+	return f.zones[zone], nil
+}
+
+func (f fakeEdge) OutpostInstanceTypes(outpostARN string) ([]string, error) {
+	return f.outposts[outpostARN], nil
+}
+
+// subnetLocationRequest is a DescribeSubnets request responding with the location of a subnet.
+func subnetLocationRequest(subnet ec2ext.SubnetLocation) *request.Request {
+	req := fakeRequest(nil)
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		output := r.Data.(*ec2ext.DescribeSubnetLocationsOutput)
+		output.Subnets = append(output.Subnets, &subnet)
+	})
+	return req
+}
+
+const testOutpost = "arn:aws:outposts:us-west-2:123456789012:outpost/op-1"
+
+func edgePlugin(clientMock *mock_ec2.MockEC2API) *awsInstancePlugin {
+	pluginImpl := confirmationPlugin(clientMock)
+	pluginImpl.edge = fakeEdge{
+		zones:    map[string][]string{"us-west-2-lax-1a": {"t3.medium", "c5.large"}},
+		outposts: map[string][]string{testOutpost: {"m5.large"}},
+	}
+	return pluginImpl
+}
+
+func TestEdgeLocationValidation(t *testing.T) {
+	for _, properties := range []string{
+		`{"EdgeLocation": {}}`,
+		`{"EdgeLocation": {"OutpostARN": "` + testOutpost + `", "LocalZone": "us-west-2-lax-1a"}}`,
+		`{"EdgeLocation": {"LocalZone": "us-west-2-lax-1a"}, "AvailabilityZones": [{"AvailabilityZone": "us-west-2a"}]}`,
+		`{"EdgeLocation": {"LocalZone": "us-west-2-lax-1a"},
+		  "RunInstancesInput": {"Placement": {"AvailabilityZone": "us-west-2a"}}}`,
+	} {
+		_, err := parseRequest(json.RawMessage(properties))
+		require.Error(t, err, properties)
+	}
+}
+
+func TestProvisionInLocalZone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeSubnetsRequest(gomock.Any()).
+		Do(func(input *ec2.DescribeSubnetsInput) {
+			require.Equal(t, []*string{aws.String("subnet-lax")}, input.SubnetIds)
+		}).
+		Return(subnetLocationRequest(ec2ext.SubnetLocation{
+			SubnetId:         aws.String("subnet-lax"),
+			AvailabilityZone: aws.String("us-west-2-lax-1a"),
+		}), nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			require.Equal(t, "us-west-2-lax-1a", *input.Placement.AvailabilityZone)
+		}).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	properties := json.RawMessage(`{
+	  "EdgeLocation": {"LocalZone": "us-west-2-lax-1a"},
+	  "RunInstancesInput": {"SubnetId": "subnet-lax", "InstanceType": "c5.large"}
+	}`)
+	id, err := edgePlugin(clientMock).Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("i-1"), *id)
+}
+
+func TestProvisionOnOutpost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeSubnetsRequest(gomock.Any()).
+		Return(subnetLocationRequest(ec2ext.SubnetLocation{
+			SubnetId:         aws.String("subnet-op"),
+			AvailabilityZone: aws.String("us-west-2a"),
+			OutpostArn:       aws.String(testOutpost),
+		}), nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	properties := json.RawMessage(`{
+	  "EdgeLocation": {"OutpostARN": "` + testOutpost + `"},
+	  "RunInstancesInput": {"SubnetId": "subnet-op", "InstanceType": "m5.large"}
+	}`)
+	_, err := edgePlugin(clientMock).Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+}
+
+func TestProvisionOutsideEdgeLocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeSubnetsRequest(gomock.Any()).
+		Return(subnetLocationRequest(ec2ext.SubnetLocation{
+			SubnetId:         aws.String("subnet-1"),
+			AvailabilityZone: aws.String("us-west-2a"),
+		}), nil)
+
+	properties := json.RawMessage(`{
+	  "EdgeLocation": {"OutpostARN": "` + testOutpost + `"},
+	  "RunInstancesInput": {"SubnetId": "subnet-1", "InstanceType": "m5.large"}
+	}`)
+	_, err := edgePlugin(clientMock).Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.EqualError(t, err, "Subnet subnet-1 is not a subnet of Outpost "+testOutpost)
+}
+
+func TestProvisionUnofferedInEdgeLocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeSubnetsRequest(gomock.Any()).
+		Return(subnetLocationRequest(ec2ext.SubnetLocation{
+			SubnetId:         aws.String("subnet-lax"),
+			AvailabilityZone: aws.String("us-west-2-lax-1a"),
+		}), nil)
+
+	properties := json.RawMessage(`{
+	  "EdgeLocation": {"LocalZone": "us-west-2-lax-1a"},
+	  "RunInstancesInput": {"SubnetId": "subnet-lax", "InstanceType": "m6i.large"}
+	}`)
+	_, err := edgePlugin(clientMock).Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.EqualError(t, err, "Instance type m6i.large is not offered in Local Zone us-west-2-lax-1a")
+}
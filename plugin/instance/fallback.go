@@ -0,0 +1,162 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+)
+
+const (
+	// FallbackInstanceTypeTag is the AWS tag name used to record the instance type of an instance that was launched
+	// with a fallback instance type, since the preferred type had insufficient capacity.
+	FallbackInstanceTypeTag = "infrakit.fallback.instance-type"
+
+	// FallbackAvailabilityZoneTag is the AWS tag name used to record the availability zone of an instance that was
+	// launched in a fallback availability zone, since the preferred zone had insufficient capacity.
+	FallbackAvailabilityZoneTag = "infrakit.fallback.availability-zone"
+)
+
+// InstanceTypeOption is an instance type that may be launched, along with an image built for its architecture.
+// Listing options of different architectures allows a group to mix, for example, x86_64 and arm64 instances.
+type InstanceTypeOption struct {
+	InstanceType string
+
+	// ImageID is the image launched with the instance type, defaulting to the image in RunInstancesInput.
+	ImageID string `json:"ImageId,omitempty"`
+}
+
+// AvailabilityZoneOption is an availability zone that instances may be launched in.
+type AvailabilityZoneOption struct {
+	AvailabilityZone string
+
+	// SubnetID is the subnet used in the availability zone, defaulting to the subnet in RunInstancesInput.
+	SubnetID string `json:"SubnetId,omitempty"`
+}
+
+// insufficientCapacity determines whether a launch failed because the instance type is currently unavailable, or
+// its spot price is above the maximum price, such that another instance type or availability zone may succeed.
+func insufficientCapacity(err error) bool {
+	return awserrors.Classify(err) == awserrors.Fallback
+}
+
+// launchAttempt is a launch request, along with the tags recording any fallback it makes.
+type launchAttempt struct {
+	input        ec2.RunInstancesInput
+	fallbackTags map[string]string
+}
+
+// launchAttempts returns the launch requests to attempt, in order of preference.  Each instance type is tried in an
+// availability zone before moving to the next zone.  Instances with a fixed identity are not moved between zones,
+// since their private IP address belongs to a subnet.
+//
+// Each request is made with a distinct client token, since EC2 rejects a token reused with different parameters.
+func launchAttempts(request CreateInstanceRequest, fixedZone bool) []launchAttempt {
+	instanceTypes := request.InstanceTypes
+	if len(instanceTypes) == 0 {
+		instanceTypes = []InstanceTypeOption{{InstanceType: aws.StringValue(request.RunInstancesInput.InstanceType)}}
+	}
+
+	zones := request.AvailabilityZones
+	if len(zones) == 0 || fixedZone {
+		zones = []AvailabilityZoneOption{{}}
+	}
+
+	attempts := []launchAttempt{}
+	for z, zone := range zones {
+		for t, option := range instanceTypes {
+			attempt := launchAttempt{input: request.RunInstancesInput, fallbackTags: map[string]string{}}
+			input := &attempt.input
+
+			if option.InstanceType != "" {
+				input.InstanceType = aws.String(option.InstanceType)
+			}
+			if option.ImageID != "" {
+				input.ImageId = aws.String(option.ImageID)
+			}
+			if t > 0 {
+				attempt.fallbackTags[FallbackInstanceTypeTag] = option.InstanceType
+			}
+
+			if zone.AvailabilityZone != "" {
+				placement := ec2.Placement{}
+				if input.Placement != nil {
+					placement = *input.Placement
+				}
+				placement.AvailabilityZone = aws.String(zone.AvailabilityZone)
+				input.Placement = &placement
+			}
+			if zone.SubnetID != "" {
+				if len(input.NetworkInterfaces) > 0 {
+					networkInterface := *input.NetworkInterfaces[0]
+					networkInterface.SubnetId = aws.String(zone.SubnetID)
+					input.NetworkInterfaces = append(
+						[]*ec2.InstanceNetworkInterfaceSpecification{&networkInterface},
+						input.NetworkInterfaces[1:]...)
+				} else {
+					input.SubnetId = aws.String(zone.SubnetID)
+				}
+			}
+			if z > 0 {
+				attempt.fallbackTags[FallbackAvailabilityZoneTag] = zone.AvailabilityZone
+			}
+
+			if i := len(attempts); i > 0 && input.ClientToken != nil {
+				token := fmt.Sprintf("%s-%d", *input.ClientToken, i)
+				if len(token) > 64 {
+					token = token[len(token)-64:]
+				}
+				input.ClientToken = aws.String(token)
+			}
+
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts
+}
+
+// launchWithFallback launches an instance with the first instance type and availability zone that has capacity.
+// Instances launched with a fallback are tagged with the fallback used.
+func (p awsInstancePlugin) launchWithFallback(
+	request CreateInstanceRequest,
+	systemTags map[string]string,
+	fixedZone bool) (*ec2.Reservation, error) {
+
+	var err error
+	for _, attempt := range launchAttempts(request, fixedZone) {
+		_, tags := mergeTags(systemTags, attempt.fallbackTags)
+
+		var reservation *ec2.Reservation
+		reservation, err = p.launch(&attempt.input, p.ec2Tags(tags, request.Tags), request)
+		if err == nil {
+			p.zoneHealth.recordSuccess(launchZone(attempt.input))
+		}
+		if err == nil || !insufficientCapacity(err) {
+			return reservation, err
+		}
+		p.zoneHealth.recordFailure(launchZone(attempt.input), err.Error())
+
+		log.Warnf(
+			"Unable to launch instance type %s in %s: %s",
+			aws.StringValue(attempt.input.InstanceType),
+			availabilityZone(attempt.input),
+			err)
+	}
+	return nil, err
+}
+
+// launchZone is the availability zone a launch request is placed in, if it is placed in one.
+func launchZone(input ec2.RunInstancesInput) string {
+	if input.Placement == nil {
+		return ""
+	}
+	return aws.StringValue(input.Placement.AvailabilityZone)
+}
+
+func availabilityZone(input ec2.RunInstancesInput) string {
+	if input.Placement == nil {
+		return "the default availability zone"
+	}
+	return aws.StringValue(input.Placement.AvailabilityZone)
+}
@@ -0,0 +1,132 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+var instanceTypesJSON = json.RawMessage(`{
+    "RunInstancesInput": {
+        "ImageId": "ami-x86"
+    },
+    "InstanceTypes": [
+        {"InstanceType": "m6g.large", "ImageId": "ami-arm"},
+        {"InstanceType": "m5.large"}
+    ]
+}`)
+
+func TestInstanceTypeFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	capacityError := awserr.NewRequestFailure(
+		awserr.New("InsufficientInstanceCapacity", "no capacity", nil), 500, "request-id")
+
+	tokens := []string{}
+	gomock.InOrder(
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "m6g.large", *input.InstanceType)
+				require.Equal(t, "ami-arm", *input.ImageId)
+				tokens = append(tokens, *input.ClientToken)
+			}).
+			Return(fakeRequest(capacityError), &ec2.Reservation{}),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "m5.large", *input.InstanceType)
+				require.Equal(t, "ami-x86", *input.ImageId)
+				tokens = append(tokens, *input.ClientToken)
+			}).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}}),
+	)
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &instanceTypesJSON, Tags: tags})
+	require.NoError(t, err)
+	require.Equal(t, "test-id", string(*id))
+	require.NotEqual(t, tokens[0], tokens[1])
+}
+
+func TestInstanceTypeNoFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	runError := awserr.NewRequestFailure(awserr.New("InvalidParameterValue", "bad request", nil), 400, "request-id")
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).Return(fakeRequest(runError), &ec2.Reservation{})
+
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &instanceTypesJSON, Tags: tags})
+	require.Error(t, err)
+}
+
+func TestAvailabilityZoneFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	properties := json.RawMessage(`{
+	    "RunInstancesInput": {
+	        "InstanceType": "m5.large",
+	        "Placement": {"AvailabilityZone": "us-west-2a"},
+	        "SubnetId": "subnet-a"
+	    },
+	    "AvailabilityZones": [
+	        {"AvailabilityZone": "us-west-2a"},
+	        {"AvailabilityZone": "us-west-2b", "SubnetId": "subnet-b"}
+	    ]
+	}`)
+
+	capacityError := awserr.New("InsufficientInstanceCapacity", "no capacity", nil)
+
+	runRequest := fakeRequest(nil)
+	gomock.InOrder(
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "us-west-2a", *input.Placement.AvailabilityZone)
+				require.Equal(t, "subnet-a", *input.SubnetId)
+			}).
+			Return(fakeRequest(capacityError), &ec2.Reservation{}),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "us-west-2b", *input.Placement.AvailabilityZone)
+				require.Equal(t, "subnet-b", *input.SubnetId)
+			}).
+			Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}}),
+	)
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+	require.Equal(t, "test-id", string(*id))
+
+	params := requestParams(t, runRequest)
+	fallbackTag := false
+	for key, value := range params {
+		if value[0] == FallbackAvailabilityZoneTag {
+			fallbackTag = true
+			require.Equal(t, "us-west-2b", params.Get(strings.TrimSuffix(key, "Key")+"Value"))
+		}
+	}
+	require.True(t, fallbackTag)
+}
+
+func TestFixedZoneNoFallback(t *testing.T) {
+	request := CreateInstanceRequest{
+		AvailabilityZones: []AvailabilityZoneOption{{AvailabilityZone: "us-west-2a"}, {AvailabilityZone: "us-west-2b"}},
+	}
+	require.Len(t, launchAttempts(request, false), 2)
+	require.Len(t, launchAttempts(request, true), 1)
+}
@@ -0,0 +1,103 @@
+package instance
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/docker/infrakit.aws/plugin/audit"
+	"github.com/spf13/pflag"
+	"strings"
+)
+
+const (
+	// GuardrailViolation is the error code of calls refused because the plugin's credentials are of another account
+	// than the expected one, or the call is made in a region that is not allowed.
+	GuardrailViolation = "GuardrailViolation"
+)
+
+// guardrailOptions pin the plugin to an AWS account and regions.
+type guardrailOptions struct {
+	expectedAccountID string
+	allowedRegions    []string
+}
+
+func (o *guardrailOptions) flags(flags *pflag.FlagSet) {
+	flags.StringVar(
+		&o.expectedAccountID,
+		"expected-account-id",
+		"",
+		"AWS account ID the plugin's credentials must belong to, verified at startup and before every mutating call")
+	flags.StringSliceVar(
+		&o.allowedRegions,
+		"allowed-regions",
+		[]string{},
+		"A list of regions the plugin may make mutating calls in, or empty for any region")
+}
+
+func (o guardrailOptions) configured() bool {
+	return o.expectedAccountID != "" || len(o.allowedRegions) > 0
+}
+
+// accountGuard refuses mutating AWS API calls made with credentials of an unexpected account or in a region that is
+// not allowed, so that leaked or misconfigured credentials do not provision into the wrong account.
+type accountGuard struct {
+	accountID string
+	regions   map[string]bool
+
+	// account returns the account of the plugin's credentials.
+	account func() (string, error)
+}
+
+func newAccountGuard(options guardrailOptions, stsClient *sts.STS) *accountGuard {
+	regions := map[string]bool{}
+	for _, region := range options.allowedRegions {
+		regions[strings.TrimSpace(region)] = true
+	}
+	return &accountGuard{
+		accountID: options.expectedAccountID,
+		regions:   regions,
+		account: func() (string, error) {
+			identity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			if err != nil {
+				return "", err
+			}
+			return aws.StringValue(identity.Account), nil
+		},
+	}
+}
+
+// verify determines whether calls may be made in a region with the plugin's credentials.  The account is verified
+// with every call rather than once, since credentials are renewed and may be replaced while the plugin runs.
+func (g *accountGuard) verify(region string) error {
+	if len(g.regions) > 0 && !g.regions[region] {
+		return awserr.New(GuardrailViolation, fmt.Sprintf("Region %s is not an allowed region", region), nil)
+	}
+	if g.accountID == "" {
+		return nil
+	}
+	account, err := g.account()
+	if err != nil {
+		return awserr.New(GuardrailViolation, "Failed to verify the account of the AWS credentials", err)
+	}
+	if account != g.accountID {
+		return awserr.New(GuardrailViolation,
+			fmt.Sprintf("AWS credentials are of account %s rather than the expected account %s", account, g.accountID),
+			nil)
+	}
+	return nil
+}
+
+// install adds a handler that fails mutating calls made with a client's handlers before they are sent, unless they
+// are verified.  Failed verifications are not retried.
+func (g *accountGuard) install(handlers *request.Handlers) {
+	handlers.Validate.PushBack(func(r *request.Request) {
+		if !audit.Mutating(r.Operation.Name) {
+			return
+		}
+		if err := g.verify(aws.StringValue(r.Config.Region)); err != nil {
+			r.Error = err
+		}
+	})
+}
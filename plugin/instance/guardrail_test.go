@@ -0,0 +1,94 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccountGuardVerify(t *testing.T) {
+	account := "123456789012"
+	var accountErr error
+	guard := &accountGuard{
+		accountID: "123456789012",
+		regions:   map[string]bool{"us-west-2": true, "us-east-1": true},
+		account: func() (string, error) {
+			return account, accountErr
+		},
+	}
+
+	require.NoError(t, guard.verify("us-west-2"))
+	require.NoError(t, guard.verify("us-east-1"))
+
+	err := guard.verify("eu-west-1")
+	require.Error(t, err)
+	require.Equal(t, GuardrailViolation, err.(awserr.Error).Code())
+
+	account = "210987654321"
+	err = guard.verify("us-west-2")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "account 210987654321 rather than the expected account 123456789012")
+
+	accountErr = errors.New("expired")
+	err = guard.verify("us-west-2")
+	require.Error(t, err)
+	require.Equal(t, GuardrailViolation, err.(awserr.Error).Code())
+
+	// Only the region is verified without an expected account.
+	guard.accountID = ""
+	require.NoError(t, guard.verify("us-west-2"))
+}
+
+func TestAccountGuardInstall(t *testing.T) {
+	actions := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		actions = append(actions, r.PostForm.Get("Action"))
+		switch r.PostForm.Get("Action") {
+		case "DescribeInstances":
+			w.Write([]byte(`<DescribeInstancesResponse></DescribeInstancesResponse>`))
+		case "TerminateInstances":
+			w.Write([]byte(`<TerminateInstancesResponse></TerminateInstancesResponse>`))
+		}
+	}))
+	defer server.Close()
+
+	sess := session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+
+	account := "210987654321"
+	guard := &accountGuard{
+		accountID: "123456789012",
+		regions:   map[string]bool{},
+		account: func() (string, error) {
+			return account, nil
+		},
+	}
+	guard.install(&sess.Handlers)
+	client := ec2.New(sess)
+
+	// Calls that do not change resources are not verified.
+	_, err := client.DescribeInstances(&ec2.DescribeInstancesInput{})
+	require.NoError(t, err)
+
+	terminate := &ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("i-1")}}
+	_, err = client.TerminateInstances(terminate)
+	require.Error(t, err)
+	require.Equal(t, GuardrailViolation, err.(awserr.Error).Code())
+	require.Equal(t, []string{"DescribeInstances"}, actions)
+
+	account = "123456789012"
+	_, err = client.TerminateInstances(terminate)
+	require.NoError(t, err)
+	require.Equal(t, []string{"DescribeInstances", "TerminateInstances"}, actions)
+}
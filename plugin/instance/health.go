@@ -0,0 +1,68 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"net/http"
+)
+
+// HealthCheck is the outcome of a check of the plugin's access to AWS.
+type HealthCheck struct {
+	Name   string
+	Passed bool
+	Error  string `json:",omitempty"`
+}
+
+// HealthReport is the outcome of all health checks.  The plugin is healthy when every check passed.
+type HealthReport struct {
+	Healthy bool
+	Checks  []HealthCheck
+}
+
+// CheckHealth verifies that the credentials of a configuration are valid, that the EC2 API of its region is
+// reachable, and that the instance metadata service is accessible.
+func CheckHealth(config client.ConfigProvider, metadata *ec2metadata.EC2Metadata) HealthReport {
+	report := HealthReport{Healthy: true}
+	check := func(name string, op func() error) {
+		result := HealthCheck{Name: name, Passed: true}
+		if err := op(); err != nil {
+			result.Passed = false
+			result.Error = err.Error()
+			report.Healthy = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	check("credentials", func() error {
+		_, err := sts.New(config).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		return err
+	})
+	check("region", func() error {
+		_, err := ec2.New(config).DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{})
+		return err
+	})
+	check("instance-metadata", func() error {
+		_, err := metadata.GetMetadata("instance-id")
+		return err
+	})
+	return report
+}
+
+// NewHealthHandler creates an HTTP handler that checks the health of the plugin on each request, responding with
+// the report and status 200 if the plugin is healthy, and 503 otherwise.
+func NewHealthHandler(config client.ConfigProvider) http.Handler {
+	metadata := ec2metadata.New(config, aws.NewConfig().WithMaxRetries(0))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := CheckHealth(config, metadata)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
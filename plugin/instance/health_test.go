@@ -0,0 +1,88 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeAWS responds to the requests made by health checks, failing those of the failing actions.
+func fakeAWS(t *testing.T, failing ...string) *httptest.Server {
+	failed := map[string]bool{}
+	for _, action := range failing {
+		failed[action] = true
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := "GetMetadata"
+		if r.Method == "POST" {
+			require.NoError(t, r.ParseForm())
+			action = r.PostForm.Get("Action")
+		}
+		if failed[action] {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`))
+			return
+		}
+
+		switch action {
+		case "GetCallerIdentity":
+			w.Write([]byte(`<GetCallerIdentityResponse><GetCallerIdentityResult>
+  <Arn>arn:aws:iam::123456789012:user/plugin</Arn>
+</GetCallerIdentityResult></GetCallerIdentityResponse>`))
+		case "DescribeAvailabilityZones":
+			w.Write([]byte(`<DescribeAvailabilityZonesResponse><availabilityZoneInfo>
+  <item><zoneName>us-west-2a</zoneName></item>
+</availabilityZoneInfo></DescribeAvailabilityZonesResponse>`))
+		default:
+			w.Write([]byte("i-1"))
+		}
+	}))
+}
+
+func healthOf(t *testing.T, server *httptest.Server) (int, HealthReport) {
+	config := session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+
+	recorder := httptest.NewRecorder()
+	NewHealthHandler(config).ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+
+	report := HealthReport{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	return recorder.Code, report
+}
+
+func TestHealthy(t *testing.T) {
+	server := fakeAWS(t)
+	defer server.Close()
+
+	status, report := healthOf(t, server)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, HealthReport{Healthy: true, Checks: []HealthCheck{
+		{Name: "credentials", Passed: true},
+		{Name: "region", Passed: true},
+		{Name: "instance-metadata", Passed: true},
+	}}, report)
+}
+
+func TestUnhealthy(t *testing.T) {
+	server := fakeAWS(t, "GetCallerIdentity", "GetMetadata")
+	defer server.Close()
+
+	status, report := healthOf(t, server)
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.False(t, report.Healthy)
+	require.Len(t, report.Checks, 3)
+	require.False(t, report.Checks[0].Passed)
+	require.Contains(t, report.Checks[0].Error, "AccessDenied")
+	require.True(t, report.Checks[1].Passed)
+	require.False(t, report.Checks[2].Passed)
+}
@@ -0,0 +1,115 @@
+package instance
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/spf13/pflag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// httpOptions configure the HTTP client of AWS API calls, for networks where AWS endpoints are only reachable through a
+// proxy or with a private certificate authority.
+type httpOptions struct {
+	proxy               string
+	noProxy             bool
+	timeout             time.Duration
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	caBundle            string
+	minTLSVersion       string
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+}
+
+func (o *httpOptions) flags(flags *pflag.FlagSet) {
+	flags.StringVar(
+		&o.proxy,
+		"http-proxy",
+		"",
+		"Proxy URL of AWS API calls, defaulting to the HTTPS_PROXY and NO_PROXY environment variables")
+	flags.BoolVar(&o.noProxy, "no-proxy", false, "Call AWS APIs directly, ignoring the proxy environment variables")
+	flags.DurationVar(&o.timeout, "http-timeout", 0, "Maximum duration of an AWS API call, or 0 for no limit")
+	flags.DurationVar(&o.dialTimeout, "http-dial-timeout", 30*time.Second, "Maximum wait for a connection to AWS")
+	flags.DurationVar(
+		&o.tlsHandshakeTimeout,
+		"tls-handshake-timeout",
+		10*time.Second,
+		"Maximum wait for a TLS handshake with AWS")
+	flags.StringVar(
+		&o.caBundle,
+		"ca-bundle",
+		"",
+		"PEM file of certificate authorities trusted for AWS endpoints, such as those of a TLS-intercepting proxy")
+	flags.StringVar(&o.minTLSVersion, "min-tls-version", "1.2", "Minimum TLS version of AWS API calls, 1.2 or 1.3")
+	flags.IntVar(&o.maxIdleConns, "max-idle-conns", 100, "Maximum number of idle connections to AWS")
+	flags.IntVar(
+		&o.maxIdleConnsPerHost,
+		"max-idle-conns-per-host",
+		10,
+		"Maximum number of idle connections to each AWS endpoint")
+	flags.DurationVar(
+		&o.idleConnTimeout,
+		"idle-conn-timeout",
+		90*time.Second,
+		"Duration an idle connection to AWS is kept open")
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// client creates the HTTP client configured by the options.
+func (o httpOptions) client() (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if o.minTLSVersion != "" {
+		version, known := tlsVersions[o.minTLSVersion]
+		if !known {
+			return nil, fmt.Errorf("Unsupported minimum TLS version %s", o.minTLSVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if o.caBundle != "" {
+		pem, err := ioutil.ReadFile(o.caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA bundle: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", o.caBundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch {
+	case o.noProxy:
+		proxy = nil
+	case o.proxy != "":
+		proxyURL, err := url.Parse(o.proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("Invalid proxy URL %s", o.proxy)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Timeout: o.timeout,
+		Transport: &http.Transport{
+			Proxy:               proxy,
+			DialContext:         (&net.Dialer{Timeout: o.dialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: o.tlsHandshakeTimeout,
+			MaxIdleConns:        o.maxIdleConns,
+			MaxIdleConnsPerHost: o.maxIdleConnsPerHost,
+			IdleConnTimeout:     o.idleConnTimeout,
+		},
+	}, nil
+}
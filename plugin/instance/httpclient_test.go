@@ -0,0 +1,51 @@
+package instance
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientProxy(t *testing.T) {
+	ec2Request := &http.Request{URL: &url.URL{Scheme: "https", Host: "ec2.us-west-2.amazonaws.com"}}
+
+	client, err := httpOptions{proxy: "http://proxy.example.com:3128", timeout: time.Minute}.client()
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, client.Timeout)
+
+	transport := client.Transport.(*http.Transport)
+	proxyURL, err := transport.Proxy(ec2Request)
+	require.NoError(t, err)
+	require.Equal(t, "proxy.example.com:3128", proxyURL.Host)
+	require.Equal(t, uint16(0), transport.TLSClientConfig.MinVersion)
+
+	client, err = httpOptions{noProxy: true, minTLSVersion: "1.3"}.client()
+	require.NoError(t, err)
+	transport = client.Transport.(*http.Transport)
+	require.Nil(t, transport.Proxy)
+	require.Equal(t, uint16(tls.VersionTLS13), transport.TLSClientConfig.MinVersion)
+
+	_, err = httpOptions{proxy: "proxy.example.com"}.client()
+	require.Error(t, err)
+
+	_, err = httpOptions{minTLSVersion: "1.0"}.client()
+	require.Error(t, err)
+}
+
+func TestHTTPClientCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ca-bundle")
+	require.NoError(t, err)
+
+	bundle := filepath.Join(dir, "bundle.pem")
+	require.NoError(t, ioutil.WriteFile(bundle, []byte("not a certificate"), 0600))
+	_, err = httpOptions{caBundle: bundle}.client()
+	require.Error(t, err)
+
+	_, err = httpOptions{caBundle: filepath.Join(dir, "missing.pem")}.client()
+	require.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package instance
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+)
+
+const (
+	// LogicalIDTag is the AWS tag name used to record the logical ID that an instance was provisioned with.
+	LogicalIDTag = "infrakit.logical-id"
+)
+
+// clientToken determines the idempotency token used to launch an instance.  Instances with a logical ID have an
+// identity, so the token is derived from it along with the tags of the instance.  A Provision call that is retried
+// after a timeout will then return the instance launched by the first call rather than launching another.  Instances
+// without a logical ID are indistinguishable from each other, and are launched with a random token.
+func (p awsInstancePlugin) clientToken(spec instance.Spec) string {
+	if spec.LogicalID == nil {
+		return randomString(32)
+	}
+
+	keys, allTags := mergeTags(spec.Tags, p.namespaceTags)
+
+	hash := sha1.New()
+	hash.Write([]byte(*spec.LogicalID))
+	for _, key := range keys {
+		hash.Write([]byte{0})
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(allTags[key]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// isTerminated determines whether an instance has been, or is being, terminated.  EC2 returns the original instance
+// for a reused client token even after it has been terminated.
+func isTerminated(ec2Instance *ec2.Instance) bool {
+	if ec2Instance.State == nil || ec2Instance.State.Name == nil {
+		return false
+	}
+	state := *ec2Instance.State.Name
+	return state == ec2.InstanceStateNameTerminated || state == ec2.InstanceStateNameShuttingDown
+}
+
+// reconcileDuplicates terminates all but the oldest of the instances that share a logical ID, returning the instances
+// that remain.  Duplicates should not exist, but may be launched if a Provision call is retried once the client token
+// of the first call is no longer honored.
+func (p awsInstancePlugin) reconcileDuplicates(instances []*ec2.Instance) []*ec2.Instance {
+	byLogicalID := map[string][]*ec2.Instance{}
+	for _, ec2Instance := range instances {
+		for _, tag := range ec2Instance.Tags {
+			if tag.Key != nil && *tag.Key == LogicalIDTag && tag.Value != nil {
+				byLogicalID[*tag.Value] = append(byLogicalID[*tag.Value], ec2Instance)
+			}
+		}
+	}
+
+	duplicates := map[*ec2.Instance]bool{}
+	duplicateIDs := []*string{}
+	for logicalID, group := range byLogicalID {
+		sort.Sort(byLaunchTime(group))
+
+		for _, duplicate := range group[1:] {
+			log.Warnf(
+				"Terminating instance %s, which duplicates instance %s with logical ID %s",
+				*duplicate.InstanceId,
+				*group[0].InstanceId,
+				logicalID)
+			duplicates[duplicate] = true
+			duplicateIDs = append(duplicateIDs, duplicate.InstanceId)
+		}
+	}
+
+	if len(duplicateIDs) == 0 {
+		return instances
+	}
+
+	_, err := p.client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: duplicateIDs})
+	if err != nil {
+		log.Warnf("Failed to terminate duplicate instances: %s", err)
+	}
+
+	remaining := []*ec2.Instance{}
+	for _, ec2Instance := range instances {
+		if !duplicates[ec2Instance] {
+			remaining = append(remaining, ec2Instance)
+		}
+	}
+	return remaining
+}
+
+type byLaunchTime []*ec2.Instance
+
+func (b byLaunchTime) Len() int {
+	return len(b)
+}
+
+func (b byLaunchTime) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+func (b byLaunchTime) Less(i, j int) bool {
+	left, right := aws.TimeValue(b[i].LaunchTime), aws.TimeValue(b[j].LaunchTime)
+	if left.Equal(right) {
+		return *b[i].InstanceId < *b[j].InstanceId
+	}
+	return left.Before(right)
+}
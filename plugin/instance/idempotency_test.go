@@ -0,0 +1,126 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit.aws/plugin/fault"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestClientToken(t *testing.T) {
+	pluginImpl := awsInstancePlugin{namespaceTags: testNamespace}
+
+	logicalID := instance.LogicalID("10.0.0.1")
+	spec := instance.Spec{Tags: tags, LogicalID: &logicalID}
+	token := pluginImpl.clientToken(spec)
+	require.Equal(t, token, pluginImpl.clientToken(spec))
+	require.True(t, len(token) <= 64)
+
+	otherID := instance.LogicalID("10.0.0.2")
+	require.NotEqual(t, token, pluginImpl.clientToken(instance.Spec{Tags: tags, LogicalID: &otherID}))
+
+	otherTags := map[string]string{"group": "workers", "infrakit.config_sha": "changed"}
+	require.NotEqual(t, token, pluginImpl.clientToken(instance.Spec{Tags: otherTags, LogicalID: &logicalID}))
+
+	require.NotEqual(t, pluginImpl.clientToken(instance.Spec{Tags: tags}), pluginImpl.clientToken(instance.Spec{Tags: tags}))
+}
+
+func TestProvisionTerminatedClientToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	logicalID := instance.LogicalID("10.0.0.1")
+	tokens := []string{}
+	recordToken := func(input *ec2.RunInstancesInput) {
+		tokens = append(tokens, *input.ClientToken)
+	}
+
+	gomock.InOrder(
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).Do(recordToken).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{
+				InstanceId: aws.String("old"),
+				State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameTerminated)},
+			}}}),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).Do(recordToken).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("new")}}}),
+	)
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &inputJSON, Tags: tags, LogicalID: &logicalID})
+	require.NoError(t, err)
+	require.Equal(t, "new", string(*id))
+	require.Equal(t, pluginImpl.clientToken(instance.Spec{Tags: tags, LogicalID: &logicalID}), tokens[0])
+	require.NotEqual(t, tokens[0], tokens[1])
+}
+
+func TestProvisionRecoversLostResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	// The launch takes effect, but its response is lost.
+	injector := fault.New(fault.Config{LostResponseRate: 1})
+	runRequest := fakeRequest(nil)
+	injector.Install(&runRequest.Handlers)
+
+	logicalID := instance.LogicalID("10.0.0.1")
+	token := pluginImpl.clientToken(instance.Spec{Tags: tags, LogicalID: &logicalID})
+
+	gomock.InOrder(
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).Return(runRequest, &ec2.Reservation{}),
+		clientMock.EXPECT().DescribeInstances(&ec2.DescribeInstancesInput{
+			Filters: []*ec2.Filter{{Name: aws.String("client-token"), Values: []*string{aws.String(token)}}},
+		}).Return(describeInstancesResponse([][]string{{"launched"}}, tags, nil), nil),
+		clientMock.EXPECT().CreateTags(gomock.Any()).Return(&ec2.CreateTagsOutput{}, nil),
+	)
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &inputJSON, Tags: tags, LogicalID: &logicalID})
+	require.NoError(t, err)
+	require.Equal(t, "launched", string(*id))
+	require.Equal(t, map[fault.Fault]int{fault.LostResponse: 1}, injector.Injected())
+}
+
+func TestReconcileDuplicates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+
+	launched := time.Now()
+	logicalInstance := func(id string, logicalID string, launchTime time.Time) *ec2.Instance {
+		return &ec2.Instance{
+			InstanceId:       aws.String(id),
+			PrivateIpAddress: aws.String(logicalID),
+			LaunchTime:       aws.Time(launchTime),
+			Tags:             []*ec2.Tag{{Key: aws.String(LogicalIDTag), Value: aws.String(logicalID)}},
+		}
+	}
+
+	clientMock.EXPECT().DescribeInstances(describeGroupRequest(testNamespace, tags, nil)).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{
+			logicalInstance("duplicate", "10.0.0.1", launched.Add(time.Minute)),
+			logicalInstance("original", "10.0.0.1", launched),
+			logicalInstance("other", "10.0.0.2", launched.Add(time.Minute)),
+			{InstanceId: aws.String("unnamed"), PrivateIpAddress: aws.String("10.0.0.3")},
+		}}}}, nil)
+	clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("duplicate")}}).
+		Return(&ec2.TerminateInstancesOutput{}, nil)
+
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+	descriptions, err := pluginImpl.DescribeInstances(tags)
+	require.NoError(t, err)
+
+	ids := []instance.ID{}
+	for _, description := range descriptions {
+		ids = append(ids, description.ID)
+	}
+	require.Equal(t, []instance.ID{"original", "other", "unnamed"}, ids)
+}
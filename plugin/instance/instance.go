@@ -10,8 +10,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+	"github.com/docker/infrakit.aws/plugin/notify"
 	"github.com/docker/infrakit/spi/instance"
 	"sort"
+	"sync"
 	"time"
 )
 
@@ -23,6 +28,66 @@ const (
 type awsInstancePlugin struct {
 	client        ec2iface.EC2API
 	namespaceTags map[string]string
+
+	// describeDetails includes instance details in the tags of instance descriptions.
+	describeDetails bool
+
+	// terminateProtected disables termination protection of instances being destroyed.
+	terminateProtected bool
+
+	// elb registers instances with load balancer target groups, if set.
+	elb elbv2iface.ELBV2API
+
+	// subnets caches the subnets matching SubnetTags of requests.
+	subnets *subnetCache
+
+	// provisions limits the concurrent provisions of each group.
+	provisions *provisionLimiter
+
+	// slots tracks the slots being assigned to instances of groups with Slots.
+	slots *slotAllocator
+
+	// purchases tracks the purchase options being chosen for instances of groups with a PurchaseMix.
+	purchases *purchaseAllocator
+
+	// zones tracks the availability zones being chosen for instances of groups with BalanceZones.
+	zones *zoneBalancer
+
+	// warmClaims tracks the warm pool instances being claimed for instances of groups with a WarmPool.
+	warmClaims *warmPoolClaims
+
+	// warmFills serializes the filling of warm pools, tracking the instances launched to fill them.
+	warmFills *warmPoolFills
+
+	// zoneHealth removes availability zones with sustained failures from the AvailabilityZones of requests, if set.
+	zoneHealth *zoneHealth
+
+	// describeFilters are added to the filters of the DescribeInstances calls of groups.
+	describeFilters describeFilters
+
+	// describeCache caches the results of DescribeInstances, if set.
+	describeCache *describeCache
+
+	// alarms creates CloudWatch alarms of instances, if set.
+	alarms alarmsAPI
+
+	// notifier publishes the outcomes of provisions and destructions, if set.
+	notifier notify.Publisher
+
+	// launches tracks recently launched instances, which may not yet be visible to DescribeInstances, if set.
+	launches *recentLaunches
+
+	// edge looks up the instance types offered in Outposts and Local Zones, if set.
+	edge edgeAPI
+
+	// rootVolumes replaces the root volumes of instances being updated, if set.
+	rootVolumes rootVolumeAPI
+
+	// quorum refuses to destroy managers below quorum, if set.
+	quorum *quorumGuard
+
+	// tagPolicy computes the tags and names of provisioned instances, if set.
+	tagPolicy TagPolicy
 }
 
 type properties struct {
@@ -33,14 +98,22 @@ type properties struct {
 
 // NewInstancePlugin creates a new plugin that creates instances in AWS EC2.
 func NewInstancePlugin(client ec2iface.EC2API, namespaceTags map[string]string) instance.Plugin {
-	return &awsInstancePlugin{client: client, namespaceTags: namespaceTags}
+	return &awsInstancePlugin{
+		client:        client,
+		namespaceTags: namespaceTags,
+		subnets:       newSubnetCache(),
+		provisions:    newProvisionLimiter(0),
+		slots:         newSlotAllocator(),
+		purchases:     newPurchaseAllocator(),
+		zones:         newZoneBalancer(),
+		warmClaims:    newWarmPoolClaims(),
+		warmFills:     newWarmPoolFills(),
+		launches:      newRecentLaunches(),
+	}
 }
 
-func (p awsInstancePlugin) tagInstance(
-	instance *ec2.Instance,
-	systemTags map[string]string,
-	userTags map[string]string) error {
-
+// ec2Tags merges the tags applied to instances and their resources.
+func (p awsInstancePlugin) ec2Tags(systemTags map[string]string, userTags map[string]string) []*ec2.Tag {
 	ec2Tags := []*ec2.Tag{}
 
 	keys, allTags := mergeTags(userTags, systemTags, p.namespaceTags)
@@ -50,20 +123,203 @@ func (p awsInstancePlugin) tagInstance(
 		ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(allTags[key])})
 	}
 
-	_, err := p.client.CreateTags(&ec2.CreateTagsInput{Resources: []*string{instance.InstanceId}, Tags: ec2Tags})
+	return ec2Tags
+}
+
+func (p awsInstancePlugin) tagInstance(
+	instance *ec2.Instance,
+	systemTags map[string]string,
+	userTags map[string]string) error {
+
+	_, err := p.client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{instance.InstanceId},
+		Tags:      p.ec2Tags(systemTags, userTags),
+	})
 	return err
 }
 
+// runInstances launches instances, tagging the instances, volumes, and network interfaces as they are created.
+// Tagging on creation ensures that instances are never left without the tags that identify them.
+func (p awsInstancePlugin) runInstances(
+	input *ec2.RunInstancesInput,
+	tags []*ec2.Tag,
+	request CreateInstanceRequest) (*ec2.Reservation, error) {
+
+	if request.Ipv4PrefixCount > 0 {
+		if err := specifyPrimaryNetworkInterface(input); err != nil {
+			return nil, err
+		}
+	}
+
+	req, reservation := p.client.RunInstancesRequest(input)
+	params := ec2ext.TagSpecificationParams(
+		ec2ext.TagSpecification{ResourceType: ec2ext.ResourceTypeInstance, Tags: tags},
+		ec2ext.TagSpecification{ResourceType: ec2ext.ResourceTypeVolume, Tags: tags},
+		ec2ext.TagSpecification{ResourceType: ec2ext.ResourceTypeNetworkInterface, Tags: tags})
+	for key, value := range ec2ext.Ipv6AddressCountParams(input, request.Ipv6AddressCount) {
+		params[key] = value
+	}
+	for key, value := range ec2ext.Ipv4PrefixCountParams(input, request.Ipv4PrefixCount) {
+		params[key] = value
+	}
+	if ec2ext.Burstable(aws.StringValue(input.InstanceType)) {
+		for key, value := range ec2ext.CreditSpecificationParams(request.CreditSpecification) {
+			params[key] = value
+		}
+	}
+	for key, value := range ec2ext.LaunchOptionsParams(request.EnclaveOptions, request.HibernationOptions) {
+		params[key] = value
+	}
+	for key, value := range ec2ext.MetadataOptionsParams(request.MetadataOptions) {
+		params[key] = value
+	}
+	if request.Spot != nil {
+		for key, value := range ec2ext.SpotMarketParams(request.Spot.MaxPrice) {
+			params[key] = value
+		}
+	}
+	for key, value := range ec2ext.AcceleratorParams(
+		request.ElasticGpuSpecifications,
+		request.ElasticInferenceAccelerators) {
+
+		params[key] = value
+	}
+	err := ec2ext.Send(req, params)
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
 // CreateInstanceRequest is the concrete provision request type.
 type CreateInstanceRequest struct {
+	// Version is the version of the RequestSchema of the properties.  Properties without a version are upgraded
+	// from the earliest version.
+	Version int `json:",omitempty"`
+
 	Tags              map[string]string
 	RunInstancesInput ec2.RunInstancesInput
+	WarmPool          *WarmPool `json:",omitempty"`
+
+	// InstanceTypes are acceptable instance types, tried in order when EC2 has insufficient capacity.
+	InstanceTypes []InstanceTypeOption `json:",omitempty"`
+
+	// AvailabilityZones are acceptable availability zones, tried in order when EC2 has insufficient capacity for
+	// all instance types.
+	AvailabilityZones []AvailabilityZoneOption `json:",omitempty"`
+
+	// BalanceZones launches each instance in the AvailabilityZones with the fewest instances of its group, trying the
+	// other zones in order of their instance counts when the zone has insufficient capacity.
+	BalanceZones bool `json:",omitempty"`
+
+	// SubnetTags selects the subnets of instances by their tags, rather than by ID.  Instances are distributed
+	// across the matching subnets, which may be in several availability zones.
+	SubnetTags map[string]string `json:",omitempty"`
+
+	// SecurityGroupNames are the logical names of security groups, such as those of the security group plugin, added
+	// to the security groups of instances.
+	SecurityGroupNames []string `json:",omitempty"`
+
+	// NetworkInterfaces are secondary network interfaces created and attached to each instance.  Unlike the network
+	// interfaces of RunInstancesInput, they may be in any subnet of the availability zone of the instance.
+	NetworkInterfaces []NetworkInterfaceSpec `json:",omitempty"`
+
+	// StaticNetworkInterface launches instances with a logical ID with a network interface owned by the logical ID,
+	// which is created if it does not exist.  The interface is kept when the instance is destroyed and attached to
+	// its replacement, so the private IP address, and the identity derived from it, persist.
+	StaticNetworkInterface bool `json:",omitempty"`
+
+	// Ipv6AddressCount is the number of IPv6 addresses assigned to the primary network interface of each instance.
+	// The subnet of the instance must have an IPv6 CIDR block.  Subnets that assign IPv6 addresses on creation do not
+	// require a count.
+	Ipv6AddressCount int64 `json:",omitempty"`
+
+	// Ipv4PrefixCount is the number of /28 IPv4 prefixes delegated to the primary network interface of each instance,
+	// for CNI plugins that assign container addresses from prefixes.  The count is not applied to an existing network
+	// interface.
+	Ipv4PrefixCount int64 `json:",omitempty"`
+
+	// CloudConfig is a cloud-config section of user data, rendered as the first part of MIME multi-part user data
+	// followed by the user data of the instance.
+	CloudConfig *CloudConfig `json:",omitempty"`
+
+	// UserDataMerge is how the UserData of RunInstancesInput is combined with the init of the flavor: replace,
+	// prepend, append, or multipart.  By default, the init replaces the UserData.
+	UserDataMerge string `json:",omitempty"`
+
+	// CompressUserData compresses the user data of instances with gzip, which cloud-init decompresses, so that user
+	// data larger than the 16KB limit of EC2 may be used.
+	CompressUserData bool `json:",omitempty"`
+
+	// CreditSpecification is the credit option of the CPU usage of burstable instances, standard or unlimited.  It
+	// is not applied to instance types that are not burstable, such as those an instance type fallback launches.
+	CreditSpecification string `json:",omitempty"`
+
+	// ElasticGpuSpecifications are Elastic GPUs attached to each instance.
+	ElasticGpuSpecifications []ec2ext.ElasticGpuSpecification `json:",omitempty"`
+
+	// ElasticInferenceAccelerators are Elastic Inference accelerators attached to each instance.
+	ElasticInferenceAccelerators []ec2ext.ElasticInferenceAccelerator `json:",omitempty"`
+
+	// EdgeLocation launches instances on an Outpost or in a Local Zone.
+	EdgeLocation *EdgeLocation `json:",omitempty"`
+
+	// Spot launches spot instances rather than on-demand instances.
+	Spot *SpotOptions `json:",omitempty"`
+
+	// PurchaseMix launches the group as a mix of on-demand and spot instances, recorded in the PurchaseOptionTag tag
+	// of each instance.  Spot instances are launched with the Spot options, if any.
+	PurchaseMix *PurchaseMix `json:",omitempty"`
+
+	// EnclaveOptions enables Nitro Enclaves in each instance, which requires a Nitro instance type with at least four
+	// vCPUs.
+	EnclaveOptions *ec2ext.EnclaveOptions `json:",omitempty"`
+
+	// HibernationOptions enables hibernation of each instance, which requires an encrypted EBS root volume large
+	// enough for the memory of the instance.  Instances may not have both enclaves and hibernation.
+	HibernationOptions *ec2ext.HibernationOptions `json:",omitempty"`
+
+	// MetadataOptions configures the instance metadata service of each instance.  With InstanceMetadataTags enabled,
+	// the tags of the instance, such as its group and slot, are served under tags/instance of the instance metadata.
+	MetadataOptions *ec2ext.MetadataOptions `json:",omitempty"`
+
+	// TargetGroupARNs are load balancer target groups that instances are registered with while they exist.
+	TargetGroupARNs []string `json:",omitempty"`
+
+	// Alarms are CloudWatch alarms created for each instance while it exists.
+	Alarms *Alarms `json:",omitempty"`
+
+	// HealthSources are reported in the descriptions of instances, for flavors to derive the health of the group
+	// from: target-groups, the health of the instances in their TargetGroupARNs, and status-checks, their EC2
+	// status checks.
+	HealthSources []string `json:",omitempty"`
+
+	// Confirmation waits for each instance to run, and optionally pass its status checks, before it is reported
+	// provisioned.  Instances that are not confirmed are handled by its failure policy.
+	Confirmation *Confirmation `json:",omitempty"`
+
+	// MaxConcurrentProvisions limits the number of instances of the group provisioned at the same time, overriding
+	// the limit of the plugin.  A negative value removes the limit.
+	MaxConcurrentProvisions int `json:",omitempty"`
+
+	// RestoreVolumes restores the volume of an attachment that has none, such as when a manager is replaced after its
+	// volume was lost, from the newest backup snapshot of the volume.
+	RestoreVolumes bool `json:",omitempty"`
+
+	// Name sets the Name tag, and optionally the hostname, of instances from their group and their slot or logical ID.
+	// A Name in Tags takes precedence.
+	Name *InstanceName `json:",omitempty"`
+
+	// Slots assigns each instance of the group a stable index, recorded in the SlotTag tag of the instance and of its
+	// volumes and network interfaces.  An instance is assigned the lowest index not used by another instance of the
+	// group, so a replacement reuses the index of the instance it replaces.
+	Slots bool `json:",omitempty"`
 }
 
 // Validate performs local checks to determine if the request is valid.
 func (p awsInstancePlugin) Validate(req json.RawMessage) error {
-	// TODO(wfarner): Implement
-	return nil
+	_, err := parseRequest(req)
+	return err
 }
 
 // mergeTags merges multiple maps of tags, implementing 'last write wins' for colliding keys.
@@ -93,19 +349,47 @@ func mergeTags(tagMaps ...map[string]string) ([]string, map[string]string) {
 
 // Provision creates a new instance.
 func (p awsInstancePlugin) Provision(spec instance.Spec) (*instance.ID, error) {
+	id, err := p.provision(spec)
+	p.notifyProvision(spec, id, err)
+	return id, err
+}
+
+func (p awsInstancePlugin) provision(spec instance.Spec) (*instance.ID, error) {
+	launched, err := p.provisionCount(spec, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(launched) != 1 {
+		return nil, errors.New("Unexpected AWS API response")
+	}
+	return launched[0].id, launched[0].err
+}
+
+// launchResult is an instance launched by a provision, along with the error of completing its provision.
+type launchResult struct {
+	id  *instance.ID
+	err error
+}
+
+// provisionCount provisions up to count instances of a spec with one launch, returning the instances that were
+// launched.  Specs of instances with an identity, such as a logical ID or a slot, are provisioned one at a time.
+func (p awsInstancePlugin) provisionCount(spec instance.Spec, count int) ([]launchResult, error) {
+	defer p.describeCache.invalidate()
 
 	if spec.Properties == nil {
 		return nil, errors.New("Properties must be set")
 	}
 
-	request := CreateInstanceRequest{}
-	err := json.Unmarshal(*spec.Properties, &request)
+	request, err := parseRequest(*spec.Properties)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid input formatting: %s", err)
+		return nil, err
 	}
 
+	release := p.provisions.acquireCount(spec.Tags, request.MaxConcurrentProvisions, count)
+	defer release()
+
 	request.RunInstancesInput.MinCount = aws.Int64(1)
-	request.RunInstancesInput.MaxCount = aws.Int64(1)
+	request.RunInstancesInput.MaxCount = aws.Int64(int64(count))
 
 	if spec.LogicalID != nil {
 		if len(request.RunInstancesInput.NetworkInterfaces) > 0 {
@@ -115,8 +399,91 @@ func (p awsInstancePlugin) Provision(spec instance.Spec) (*instance.ID, error) {
 		}
 	}
 
-	if spec.Init != "" {
-		request.RunInstancesInput.UserData = aws.String(spec.Init)
+	// The slot of an instance is chosen before its user data is prepared, since it may name the instance.
+	slot := ""
+	if request.Slots {
+		allocated, release, err := p.allocateSlot(spec.Tags)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		slot = allocated
+	}
+	name, identified := "", false
+	if request.Name != nil {
+		name, identified = request.Name.instanceName(spec.Tags, slot, spec.LogicalID)
+	}
+	tags, name, err := p.policyTags(request, spec.Tags, slot, spec.LogicalID, name)
+	if err != nil {
+		return nil, err
+	}
+	request.Tags = tags
+	hostname := ""
+	if request.Name != nil && request.Name.Hostname && identified {
+		hostname = hostnameOf(name)
+	}
+
+	if err := renderUserData(&request, spec.Init, hostname); err != nil {
+		return nil, err
+	}
+
+	if request.RunInstancesInput.UserData != nil {
+		userData, err := prepareUserData(*request.RunInstancesInput.UserData, request.CompressUserData)
+		if err != nil {
+			return nil, err
+		}
+		request.RunInstancesInput.UserData = aws.String(userData)
+	}
+
+	if err := p.applySubnetTags(&request, spec.LogicalID); err != nil {
+		return nil, err
+	}
+	if err := p.applySecurityGroupNames(&request); err != nil {
+		return nil, err
+	}
+	request.AvailabilityZones = p.zoneHealth.available(request.AvailabilityZones)
+	if request.BalanceZones && spec.LogicalID == nil {
+		release, err := p.balanceZones(&request, spec.Tags)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	if err := p.checkEdgeLocation(&request); err != nil {
+		return nil, err
+	}
+
+	if len(request.TargetGroupARNs) > 0 && p.elb == nil {
+		return nil, errors.New("TargetGroupARNs are not supported without a load balancer client")
+	}
+	spec.Tags = withTargetGroupsTag(spec.Tags, request.TargetGroupARNs)
+
+	if len(request.Alarms.kinds()) > 0 && p.alarms == nil {
+		return nil, errors.New("Alarms are not supported without a CloudWatch client")
+	}
+	spec.Tags = withAlarmsTag(spec.Tags, request.Alarms)
+	spec.Tags = withHealthSourcesTag(spec.Tags, request.HealthSources)
+
+	// Instances with a logical ID, attachments, or a slot have an identity, and may not be drawn from a warm pool.
+	if request.WarmPool != nil && spec.LogicalID == nil && len(spec.Attachments) == 0 && !request.Slots &&
+		request.PurchaseMix == nil {
+
+		key, err := warmPoolKey(request)
+		if err != nil {
+			return nil, err
+		}
+		defer p.fillWarmPool(key, request)
+
+		id, err := p.claimWarmInstance(key, spec, request, name)
+		if err == nil && id != nil {
+			err = p.registerTargets(*id, request.TargetGroupARNs)
+		}
+		if err == nil && id != nil {
+			err = p.createAlarms(*id, request.Alarms)
+		}
+		if err != nil || id != nil {
+			return []launchResult{{id: id, err: err}}, nil
+		}
 	}
 
 	if request.RunInstancesInput.UserData != nil {
@@ -147,6 +514,14 @@ func (p awsInstancePlugin) Provision(spec instance.Spec) (*instance.ID, error) {
 			return nil, errors.New("Failed while looking up volume")
 		}
 
+		if len(volumes.Volumes) != len(spec.Attachments) && request.RestoreVolumes {
+			restored, err := p.restoreMissingVolumes(spec.Attachments, volumes.Volumes, request.RunInstancesInput)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to restore volumes: %s", err)
+			}
+			volumes.Volumes = append(volumes.Volumes, restored...)
+		}
+
 		if len(volumes.Volumes) == len(spec.Attachments) {
 			for _, volume := range volumes.Volumes {
 				awsVolumeIDs = append(awsVolumeIDs, volume.VolumeId)
@@ -159,43 +534,114 @@ func (p awsInstancePlugin) Provision(spec instance.Spec) (*instance.ID, error) {
 		}
 	}
 
-	reservation, err := p.client.RunInstances(&request.RunInstancesInput)
+	systemTags := map[string]string{}
+	for k, v := range spec.Tags {
+		systemTags[k] = v
+	}
+	if spec.LogicalID != nil {
+		systemTags[LogicalIDTag] = string(*spec.LogicalID)
+	}
+	if request.Slots {
+		systemTags[SlotTag] = slot
+	}
+	if name != "" {
+		systemTags[NameTag] = name
+	}
+	if request.PurchaseMix != nil {
+		option, release, err := p.choosePurchase(&request, spec.Tags)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		systemTags[PurchaseOptionTag] = option
+	}
+
+	if request.RunInstancesInput.ClientToken == nil {
+		request.RunInstancesInput.ClientToken = aws.String(p.clientToken(spec))
+	}
+
+	if request.StaticNetworkInterface && spec.LogicalID != nil {
+		err := p.useStaticNetworkInterface(
+			&request.RunInstancesInput,
+			*spec.LogicalID,
+			p.ec2Tags(systemTags, request.Tags))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if metadataTagsEnabledBy(request.MetadataOptions) {
+		if err := checkMetadataTagKeys(p.ec2Tags(systemTags, request.Tags)); err != nil {
+			return nil, err
+		}
+	}
+
+	p.adviseSpot(&request)
+
+	reservation, err := p.launchWithFallback(request, systemTags, spec.LogicalID != nil)
 	if err != nil {
+		if reservation != nil && len(reservation.Instances) > 0 {
+			launched := []launchResult{}
+			for _, ec2Instance := range reservation.Instances {
+				launched = append(launched, launchResult{id: (*instance.ID)(ec2Instance.InstanceId), err: err})
+			}
+			return launched, nil
+		}
 		return nil, err
 	}
 
-	if reservation == nil || len(reservation.Instances) != 1 {
+	if reservation == nil || len(reservation.Instances) == 0 || len(reservation.Instances) > count {
 		return nil, errors.New("Unexpected AWS API response")
 	}
-	ec2Instance := reservation.Instances[0]
-
-	id := (*instance.ID)(ec2Instance.InstanceId)
+	if len(reservation.Instances) == 1 {
+		id, err := p.completeProvision(reservation.Instances[0], request, systemTags, awsVolumeIDs)
+		return []launchResult{{id: id, err: err}}, nil
+	}
 
-	err = p.tagInstance(ec2Instance, spec.Tags, request.Tags)
-	if err != nil {
-		return id, err
+	// The provisions of instances launched together are completed concurrently, since each may wait for its
+	// instance to run.
+	launched := make([]launchResult, len(reservation.Instances))
+	var wait sync.WaitGroup
+	for i, ec2Instance := range reservation.Instances {
+		wait.Add(1)
+		go func(i int, ec2Instance *ec2.Instance) {
+			defer wait.Done()
+			id, err := p.completeProvision(ec2Instance, request, systemTags, awsVolumeIDs)
+			launched[i] = launchResult{id: id, err: err}
+		}(i, ec2Instance)
 	}
+	wait.Wait()
+	return launched, nil
+}
 
-	if len(awsVolumeIDs) > 0 {
-		log.Infof("Waiting for instance %s to enter running state before attaching volume", *id)
-		for {
-			time.Sleep(10 * time.Second)
+// completeProvision attaches the volumes and network interfaces of a launched instance, registers it with its target
+// groups, creates its alarms, and confirms it.
+func (p awsInstancePlugin) completeProvision(
+	ec2Instance *ec2.Instance,
+	request CreateInstanceRequest,
+	systemTags map[string]string,
+	awsVolumeIDs []*string) (*instance.ID, error) {
 
-			inst, err := p.client.DescribeInstances(&ec2.DescribeInstancesInput{
-				InstanceIds: []*string{ec2Instance.InstanceId},
-			})
-			if err == nil {
-				if *inst.Reservations[0].Instances[0].State.Name == ec2.InstanceStateNameRunning {
-					break
-				}
-			} else if awsErr, ok := err.(awserr.Error); ok {
-				if awsErr.Code() == "InvalidInstanceID.NotFound" {
-					return id, nil
-				}
-			}
+	p.launches.record(ec2Instance, p.ec2Tags(systemTags, request.Tags))
 
+	id := (*instance.ID)(ec2Instance.InstanceId)
+
+	// The waits of the provision are limited by the timeout of its confirmation.
+	confirmation := Confirmation{}
+	if request.Confirmation != nil {
+		confirmation = *request.Confirmation
+	}
+	deadline := time.Now().Add(confirmation.timeout())
+
+	// Volumes and network interfaces may only be attached once the instance is running.
+	if len(awsVolumeIDs) > 0 || len(request.NetworkInterfaces) > 0 {
+		log.Infof("Waiting for instance %s to enter running state before attaching volumes and interfaces", *id)
+		if err := p.waitRunning(*id, deadline); err != nil {
+			return nil, p.failProvision(*id, confirmation, err)
 		}
+	}
 
+	if len(awsVolumeIDs) > 0 {
 		for _, awsVolumeID := range awsVolumeIDs {
 			_, err := p.client.AttachVolume(&ec2.AttachVolumeInput{
 				InstanceId: ec2Instance.InstanceId,
@@ -208,14 +654,128 @@ func (p awsInstancePlugin) Provision(spec instance.Spec) (*instance.ID, error) {
 		}
 	}
 
+	err := p.attachNetworkInterfaces(ec2Instance, request.NetworkInterfaces, p.ec2Tags(systemTags, request.Tags))
+	if err != nil {
+		return id, err
+	}
+
+	if err := p.registerTargets(*id, request.TargetGroupARNs); err != nil {
+		return id, err
+	}
+	if err := p.createAlarms(*id, request.Alarms); err != nil {
+		return id, err
+	}
+
+	if request.Confirmation != nil {
+		if err := p.confirm(*id, confirmation, deadline); err != nil {
+			return nil, err
+		}
+	}
 	return id, nil
 }
 
-// Destroy terminates an existing instance.
+// launch launches an instance.  If the outcome of the request is unknown, an instance launched by the request is
+// recovered using the client token, and adopted by tagging it.  A reservation is returned along with any error from
+// adopting a recovered instance.
+func (p awsInstancePlugin) launch(
+	input *ec2.RunInstancesInput,
+	tags []*ec2.Tag,
+	request CreateInstanceRequest) (*ec2.Reservation, error) {
+
+	reservation, err := p.runInstances(input, tags, request)
+	if err == nil && len(reservation.Instances) == 1 && isTerminated(reservation.Instances[0]) {
+		// The client token was used by an instance that has since been terminated.
+		log.Infof(
+			"Instance %s launched with client token %s is terminated, launching a new instance",
+			*reservation.Instances[0].InstanceId,
+			*input.ClientToken)
+		input.ClientToken = aws.String(randomString(32))
+		reservation, err = p.runInstances(input, tags, request)
+	}
+	if err == nil || !mayHaveLaunched(err) {
+		return reservation, err
+	}
+
+	// The instances may have launched even though the response was lost.
+	instances, findErr := p.findByClientToken(*input.ClientToken)
+	if findErr != nil || len(instances) == 0 {
+		return nil, err
+	}
+
+	ids := []*string{}
+	for _, ec2Instance := range instances {
+		log.Warnf("Recovered instance %s after failed launch: %s", *ec2Instance.InstanceId, err)
+		ids = append(ids, ec2Instance.InstanceId)
+	}
+	reservation = &ec2.Reservation{Instances: instances}
+
+	// Adopt the instances, in case they were launched without tags.
+	_, err = p.client.CreateTags(&ec2.CreateTagsInput{Resources: ids, Tags: tags})
+	return reservation, err
+}
+
+// mayHaveLaunched determines whether a failed launch request could have launched an instance.  Requests rejected by
+// EC2, including for insufficient capacity or missing permissions, have no effect, while requests failing with a
+// server error or without a response may have succeeded.
+func mayHaveLaunched(err error) bool {
+	switch awserrors.Classify(err) {
+	case awserrors.Fallback, awserrors.FailFast:
+		return false
+	}
+	if requestErr, is := err.(awserr.RequestFailure); is {
+		return requestErr.StatusCode() >= 500
+	}
+	return true
+}
+
+// findByClientToken finds the instances launched with a client token.
+func (p awsInstancePlugin) findByClientToken(token string) ([]*ec2.Instance, error) {
+	result, err := p.client.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("client-token"), Values: []*string{aws.String(token)}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []*ec2.Instance{}
+	for _, reservation := range result.Reservations {
+		instances = append(instances, reservation.Instances...)
+	}
+	return instances, nil
+}
+
+// Destroy terminates an existing instance.  Instances with termination protection enabled are only terminated if the
+// plugin is configured to disable it.
 func (p awsInstancePlugin) Destroy(id instance.ID) error {
-	result, err := p.client.TerminateInstances(&ec2.TerminateInstancesInput{
-		InstanceIds: []*string{aws.String(string(id))}})
+	tags := p.notificationTags(id)
+	err := p.checkQuorum(id)
+	if err == nil {
+		err = p.destroy(id)
+	}
+	p.notifyDestroy(id, tags, err)
+	return err
+}
+
+func (p awsInstancePlugin) destroy(id instance.ID) error {
+	defer p.describeCache.invalidate()
+
+	input := &ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String(string(id))}}
+	result, err := p.client.TerminateInstances(input)
+	if terminationProtected(err) {
+		if !p.terminateProtected {
+			return fmt.Errorf(
+				"Instance %s has termination protection enabled, and may only be destroyed with --terminate-protected",
+				id)
+		}
 
+		log.Warnf("Disabling termination protection of instance %s", id)
+		if err := p.disableTerminationProtection(id); err != nil {
+			return err
+		}
+		result, err = p.client.TerminateInstances(input)
+	}
 	if err != nil {
 		return err
 	}
@@ -224,17 +784,27 @@ func (p awsInstancePlugin) Destroy(id instance.ID) error {
 		return errors.New("No matching instance")
 	}
 
+	// The instance is only removed from its target groups, and its alarms and network interfaces deleted, once it is
+	// terminating, so that an instance that may not be terminated keeps them.
+	p.deregisterTargets(id)
+	p.deleteAlarms(id)
+	p.deleteNetworkInterfaces(id)
+	p.launches.forget(id)
+
 	return nil
 }
 
 func describeGroupRequest(namespaceTags, tags map[string]string, nextToken *string) *ec2.DescribeInstancesInput {
 
+	// Stopped instances are still members of the group, since they may be started again with the same identity.
 	filters := []*ec2.Filter{
 		{
 			Name: aws.String("instance-state-name"),
 			Values: []*string{
 				aws.String("pending"),
 				aws.String("running"),
+				aws.String("stopping"),
+				aws.String("stopped"),
 			},
 		},
 	}
@@ -251,49 +821,90 @@ func describeGroupRequest(namespaceTags, tags map[string]string, nextToken *stri
 	return &ec2.DescribeInstancesInput{NextToken: nextToken, Filters: filters}
 }
 
-func (p awsInstancePlugin) describeInstances(tags map[string]string, nextToken *string) ([]instance.Description, error) {
+func (p awsInstancePlugin) describeInstances(tags map[string]string, nextToken *string) ([]*ec2.Instance, error) {
+	return p.describeFilteredInstances(tags, groupDescribeFilters{}, nextToken)
+}
+
+// describeFilteredInstances describes the instances matching tags and the additional filters of a group.
+func (p awsInstancePlugin) describeFilteredInstances(
+	tags map[string]string,
+	filters groupDescribeFilters,
+	nextToken *string) ([]*ec2.Instance, error) {
 
-	result, err := p.client.DescribeInstances(describeGroupRequest(p.namespaceTags, tags, nextToken))
+	result, err := p.client.DescribeInstances(filters.apply(describeGroupRequest(p.namespaceTags, tags, nextToken)))
 	if err != nil {
 		return nil, err
 	}
 
-	descriptions := []instance.Description{}
+	instances := []*ec2.Instance{}
 	for _, reservation := range result.Reservations {
-		for _, ec2Instance := range reservation.Instances {
-			tags := map[string]string{}
-			if ec2Instance.Tags != nil {
-				for _, tag := range ec2Instance.Tags {
-					if tag.Key != nil && tag.Value != nil {
-						tags[*tag.Key] = *tag.Value
-					}
-				}
-			}
-
-			descriptions = append(descriptions, instance.Description{
-				ID:        instance.ID(*ec2Instance.InstanceId),
-				LogicalID: (*instance.LogicalID)(ec2Instance.PrivateIpAddress),
-				Tags:      tags,
-			})
-		}
+		instances = append(instances, reservation.Instances...)
 	}
 
 	if result.NextToken != nil {
 		// There are more pages of results.
-		remainingPages, err := p.describeInstances(tags, result.NextToken)
+		remainingPages, err := p.describeFilteredInstances(tags, filters, result.NextToken)
 		if err != nil {
 			return nil, err
 		}
 
-		descriptions = append(descriptions, remainingPages...)
+		instances = append(instances, remainingPages...)
 	}
 
-	return descriptions, nil
+	return filters.matchLaunchTime(instances), nil
 }
 
 // DescribeInstances implements instance.Provisioner.DescribeInstances.
 func (p awsInstancePlugin) DescribeInstances(tags map[string]string) ([]instance.Description, error) {
-	return p.describeInstances(tags, nil)
+	key := describeCacheKey(p.namespaceTags, tags)
+	instances, generation, cached := p.describeCache.lookup(key)
+	if !cached {
+		filters := p.describeFilters.forTags(tags)
+		described, err := p.describeFilteredInstances(tags, filters, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Recent launches are not known to match additional filters.
+		if filters.empty() {
+			described, err = p.includeRecentLaunches(tags, described)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		instances = p.reconcileDuplicates(withoutFailed(described))
+		p.describeCache.store(key, generation, instances)
+	}
+
+	var addresses map[string]interfaceAddresses
+	if p.describeDetails {
+		addresses = p.interfaceAddresses(instances)
+	}
+	health := p.instanceHealth(instances)
+
+	descriptions := []instance.Description{}
+	for _, ec2Instance := range instances {
+		details := detailsOf(ec2Instance)
+		if p.describeDetails {
+			details.IPv6Addresses = addresses[string(details.ID)].ipv6
+			details.IPv4Prefixes = addresses[string(details.ID)].ipv4Prefixes
+			for key, value := range details.detailTags() {
+				details.Tags[key] = value
+			}
+		}
+		for key, value := range health[string(details.ID)] {
+			details.Tags[key] = value
+		}
+
+		descriptions = append(descriptions, instance.Description{
+			ID:        details.ID,
+			LogicalID: (*instance.LogicalID)(ec2Instance.PrivateIpAddress),
+			Tags:      details.Tags,
+		})
+	}
+
+	return descriptions, nil
 }
 
 func (p awsInstancePlugin) describeInstance(id instance.ID) (*ec2.Instance, error) {
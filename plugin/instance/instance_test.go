@@ -5,11 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
 	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
 	"github.com/docker/infrakit/spi/instance"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/url"
 	"testing"
 )
 
@@ -18,6 +24,26 @@ var (
 	tags          = map[string]string{"group": "workers"}
 )
 
+// requestParams returns the parameters added to a fake request when it was sent.
+func requestParams(t *testing.T, req *request.Request) url.Values {
+	body, err := ioutil.ReadAll(req.Body)
+	require.NoError(t, err)
+
+	params, err := url.ParseQuery(string(body))
+	require.NoError(t, err)
+	return params
+}
+
+// fakeRequest creates a request that completes without calling AWS, failing with err if it is not nil.
+func fakeRequest(err error) *request.Request {
+	req := request.New(aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{}, nil, nil)
+	req.SetBufferBody([]byte{})
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		r.Error = err
+	})
+	return req
+}
+
 func TestInstanceLifecycle(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -29,19 +55,9 @@ func TestInstanceLifecycle(t *testing.T) {
 
 	instanceID := "test-id"
 
-	clientMock.EXPECT().RunInstances(gomock.Any()).
-		Return(&ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: &instanceID}}}, nil)
-
-	tagRequest := ec2.CreateTagsInput{
-		Resources: []*string{&instanceID},
-		Tags: []*ec2.Tag{
-			{Key: aws.String("cluster"), Value: aws.String("test")},
-			{Key: aws.String("group"), Value: aws.String("workers")},
-			{Key: aws.String("test"), Value: aws.String("aws-create-test")},
-			{Key: aws.String("type"), Value: aws.String("testing")},
-		},
-	}
-	clientMock.EXPECT().CreateTags(&tagRequest).Return(&ec2.CreateTagsOutput{}, nil)
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: &instanceID}}})
 
 	// TODO(wfarner): Test user-data and private IP plumbing.
 	id, err := pluginImpl.Provision(instance.Spec{Properties: &inputJSON, Tags: tags})
@@ -49,8 +65,23 @@ func TestInstanceLifecycle(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, instanceID, string(*id))
 
+	// The instance is tagged as it is created.
+	params := requestParams(t, runRequest)
+	require.Equal(t, ec2ext.ResourceTypeInstance, params.Get("TagSpecification.1.ResourceType"))
+	expectedTags := [][]string{
+		{"cluster", "test"},
+		{"group", "workers"},
+		{"test", "aws-create-test"},
+		{"type", "testing"},
+	}
+	for i, tag := range expectedTags {
+		require.Equal(t, tag[0], params.Get(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", i+1)))
+		require.Equal(t, tag[1], params.Get(fmt.Sprintf("TagSpecification.1.Tag.%d.Value", i+1)))
+	}
+
 	// Destroy the instance.
 
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
 	clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{&instanceID}}).
 		Return(&ec2.TerminateInstancesOutput{
 			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: &instanceID}}},
@@ -65,7 +96,8 @@ func TestCreateInstanceError(t *testing.T) {
 	clientMock := mock_ec2.NewMockEC2API(ctrl)
 
 	runError := errors.New("request failed")
-	clientMock.EXPECT().RunInstances(gomock.Any()).Return(&ec2.Reservation{}, runError)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).Return(fakeRequest(runError), &ec2.Reservation{})
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil)
 
 	pluginImpl := NewInstancePlugin(clientMock, map[string]string{"cluster": "test"})
 	properties := json.RawMessage("{}")
@@ -75,6 +107,54 @@ func TestCreateInstanceError(t *testing.T) {
 	require.Nil(t, id)
 }
 
+func TestCreateInstanceRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+
+	// EC2 rejected the request, so there is no instance to recover.
+	runError := awserr.NewRequestFailure(awserr.New("InvalidParameterValue", "bad request", nil), 400, "request-id")
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).Return(fakeRequest(runError), &ec2.Reservation{})
+
+	pluginImpl := NewInstancePlugin(clientMock, map[string]string{"cluster": "test"})
+	properties := json.RawMessage("{}")
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+
+	require.Error(t, err)
+	require.Nil(t, id)
+}
+
+func TestCreateInstanceRecovered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+
+	instanceID := "test-id"
+
+	var clientToken *string
+	gomock.InOrder(
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				clientToken = input.ClientToken
+			}).
+			Return(fakeRequest(errors.New("connection reset")), &ec2.Reservation{}),
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Do(func(input *ec2.DescribeInstancesInput) {
+				require.Equal(t, "client-token", *input.Filters[0].Name)
+				require.Equal(t, clientToken, input.Filters[0].Values[0])
+			}).
+			Return(describeInstancesResponse([][]string{{instanceID}}, map[string]string{}, nil), nil),
+		clientMock.EXPECT().CreateTags(gomock.Any()).Return(&ec2.CreateTagsOutput{}, nil),
+	)
+
+	pluginImpl := NewInstancePlugin(clientMock, map[string]string{"cluster": "test"})
+	properties := json.RawMessage("{}")
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+
+	require.NoError(t, err)
+	require.Equal(t, instanceID, string(*id))
+}
+
 func TestDestroyInstanceError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -221,3 +301,134 @@ var inputJSON = json.RawMessage(`{
     }
 }
 `)
+
+func TestProvisionWithIpv6Addresses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	properties := json.RawMessage(`{"Ipv6AddressCount": 2, "RunInstancesInput": {"SubnetId": "subnet-1"}}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	require.Equal(t, "2", params.Get("Ipv6AddressCount"))
+}
+
+func TestProvisionWithIpv4Prefixes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			// Prefixes are requested for the primary network interface, which takes the instance's networking.
+			require.Nil(t, input.SubnetId)
+			require.Nil(t, input.SecurityGroupIds)
+			require.Len(t, input.NetworkInterfaces, 1)
+			require.Equal(t, "subnet-1", *input.NetworkInterfaces[0].SubnetId)
+			require.Equal(t, []*string{aws.String("sg-1")}, input.NetworkInterfaces[0].Groups)
+			require.Equal(t, int64(0), *input.NetworkInterfaces[0].DeviceIndex)
+		}).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	properties := json.RawMessage(`{
+		"Ipv4PrefixCount": 2,
+		"Ipv6AddressCount": 1,
+		"RunInstancesInput": {"SubnetId": "subnet-1", "SecurityGroupIds": ["sg-1"]}
+	}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	require.Equal(t, "2", params.Get("NetworkInterface.1.Ipv4PrefixCount"))
+	require.Equal(t, "1", params.Get("NetworkInterface.1.Ipv6AddressCount"))
+
+	// Security group names may not be given for network interfaces.
+	input := ec2.RunInstancesInput{SecurityGroups: aws.StringSlice([]string{"default"})}
+	require.Error(t, specifyPrimaryNetworkInterface(&input))
+}
+
+func TestProvisionWithAccelerators(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	properties := json.RawMessage(`{
+		"ElasticGpuSpecifications": [{"Type": "eg1.large"}],
+		"ElasticInferenceAccelerators": [{"Type": "eia2.medium", "Count": 2}]
+	}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	require.Equal(t, "eg1.large", params.Get("ElasticGpuSpecification.1.Type"))
+	require.Equal(t, "eia2.medium", params.Get("ElasticInferenceAccelerator.1.Type"))
+	require.Equal(t, "2", params.Get("ElasticInferenceAccelerator.1.Count"))
+}
+
+func TestProvisionWithLaunchOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	properties := json.RawMessage(`{"HibernationOptions": {"Configured": true}}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	require.Equal(t, "true", params.Get("HibernationOptions.Configured"))
+	_, hasEnclaves := params["EnclaveOptions.Enabled"]
+	require.False(t, hasEnclaves)
+
+	properties = json.RawMessage(`{"EnclaveOptions": {"Enabled": true}, "HibernationOptions": {"Configured": true}}`)
+	require.Error(t, pluginImpl.Validate(properties))
+}
+
+func TestProvisionWithCreditSpecification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	launch := func(instanceType string) url.Values {
+		runRequest := fakeRequest(nil)
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+		properties := json.RawMessage(fmt.Sprintf(
+			`{"CreditSpecification": "unlimited", "RunInstancesInput": {"InstanceType": "%s"}}`,
+			instanceType))
+		_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+		require.NoError(t, err)
+		return requestParams(t, runRequest)
+	}
+
+	require.Equal(t, "unlimited", launch("t3.micro").Get("CreditSpecification.CpuCredits"))
+
+	// Instance types that are not burstable reject credit specifications.
+	_, hasCredits := launch("m5.large")["CreditSpecification.CpuCredits"]
+	require.False(t, hasCredits)
+}
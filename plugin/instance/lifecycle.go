@@ -0,0 +1,115 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"github.com/docker/infrakit/spi/instance"
+	"net/url"
+)
+
+// Lifecycle manages the power state of instances without terminating them.  Instances keep their IDs, volumes,
+// and private IP addresses across a stop and start.
+type Lifecycle interface {
+	// Stop shuts down a running instance.
+	Stop(id instance.ID) error
+
+	// Start boots a stopped or hibernated instance.
+	Start(id instance.ID) error
+
+	// Reboot restarts a running instance.
+	Reboot(id instance.ID) error
+
+	// Hibernate suspends a running instance to its root volume.  The instance must have been launched with
+	// hibernation enabled.
+	Hibernate(id instance.ID) error
+}
+
+// Stop implements Lifecycle.Stop.
+func (p awsInstancePlugin) Stop(id instance.ID) error {
+	defer p.describeCache.invalidate()
+
+	result, err := p.client.StopInstances(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String(string(id))}})
+	if err != nil {
+		return err
+	}
+
+	if len(result.StoppingInstances) != 1 {
+		return errors.New("No matching instance")
+	}
+
+	return nil
+}
+
+// Start implements Lifecycle.Start.
+func (p awsInstancePlugin) Start(id instance.ID) error {
+	defer p.describeCache.invalidate()
+
+	result, err := p.client.StartInstances(&ec2.StartInstancesInput{InstanceIds: []*string{aws.String(string(id))}})
+	if err != nil {
+		return err
+	}
+
+	if len(result.StartingInstances) != 1 {
+		return errors.New("No matching instance")
+	}
+
+	return nil
+}
+
+// Reboot implements Lifecycle.Reboot.
+func (p awsInstancePlugin) Reboot(id instance.ID) error {
+	_, err := p.client.RebootInstances(&ec2.RebootInstancesInput{InstanceIds: []*string{aws.String(string(id))}})
+	return err
+}
+
+// Hibernate implements Lifecycle.Hibernate.
+func (p awsInstancePlugin) Hibernate(id instance.ID) error {
+	defer p.describeCache.invalidate()
+
+	// The vendored SDK predates the Hibernate parameter of StopInstances, so it is added to the request directly.
+	req, result := p.client.StopInstancesRequest(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String(string(id))}})
+	err := ec2ext.Send(req, url.Values{"Hibernate": {"true"}})
+	if err != nil {
+		return err
+	}
+
+	if len(result.StoppingInstances) != 1 {
+		return errors.New("No matching instance")
+	}
+
+	return nil
+}
+
+// lifecycle runs an operation of the Lifecycle of the plugin on an instance, holding the lease of its group.
+func (p *lockedPlugin) lifecycle(id instance.ID, op func(Lifecycle) error) error {
+	lifecycle, is := p.Plugin.(Lifecycle)
+	if !is {
+		return errors.New("Instance plugin does not support stopping and starting instances")
+	}
+
+	return p.withLease(p.instanceLockKey(id), func(leaseLoss) error {
+		return op(lifecycle)
+	})
+}
+
+// Stop implements Lifecycle.Stop, holding the lease of the group of the instance.
+func (p *lockedPlugin) Stop(id instance.ID) error {
+	return p.lifecycle(id, func(lifecycle Lifecycle) error { return lifecycle.Stop(id) })
+}
+
+// Start implements Lifecycle.Start, holding the lease of the group of the instance.
+func (p *lockedPlugin) Start(id instance.ID) error {
+	return p.lifecycle(id, func(lifecycle Lifecycle) error { return lifecycle.Start(id) })
+}
+
+// Reboot implements Lifecycle.Reboot, holding the lease of the group of the instance.
+func (p *lockedPlugin) Reboot(id instance.ID) error {
+	return p.lifecycle(id, func(lifecycle Lifecycle) error { return lifecycle.Reboot(id) })
+}
+
+// Hibernate implements Lifecycle.Hibernate, holding the lease of the group of the instance.
+func (p *lockedPlugin) Hibernate(id instance.ID) error {
+	return p.lifecycle(id, func(lifecycle Lifecycle) error { return lifecycle.Hibernate(id) })
+}
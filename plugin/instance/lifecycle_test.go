@@ -0,0 +1,51 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStopStartReboot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	instanceID := "test-id"
+
+	clientMock.EXPECT().StopInstances(&ec2.StopInstancesInput{InstanceIds: []*string{&instanceID}}).
+		Return(&ec2.StopInstancesOutput{
+			StoppingInstances: []*ec2.InstanceStateChange{{InstanceId: &instanceID}}},
+			nil)
+	require.NoError(t, pluginImpl.Stop(instance.ID(instanceID)))
+
+	clientMock.EXPECT().StartInstances(&ec2.StartInstancesInput{InstanceIds: []*string{&instanceID}}).
+		Return(&ec2.StartInstancesOutput{
+			StartingInstances: []*ec2.InstanceStateChange{{InstanceId: &instanceID}}},
+			nil)
+	require.NoError(t, pluginImpl.Start(instance.ID(instanceID)))
+
+	clientMock.EXPECT().RebootInstances(&ec2.RebootInstancesInput{InstanceIds: []*string{&instanceID}}).
+		Return(&ec2.RebootInstancesOutput{}, nil)
+	require.NoError(t, pluginImpl.Reboot(instance.ID(instanceID)))
+}
+
+func TestStopInstanceError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	clientMock.EXPECT().StopInstances(gomock.Any()).Return(nil, errors.New("request failed"))
+	require.Error(t, pluginImpl.Stop(instance.ID("test-id")))
+
+	clientMock.EXPECT().StopInstances(gomock.Any()).Return(&ec2.StopInstancesOutput{}, nil)
+	require.Error(t, pluginImpl.Stop(instance.ID("test-id")))
+}
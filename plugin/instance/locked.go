@@ -0,0 +1,265 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/lock"
+	"github.com/docker/infrakit/spi/instance"
+	"sync"
+	"time"
+)
+
+const (
+	// GroupTag is the tag name used by the group plugin to associate instances with a group.
+	GroupTag = "infrakit.group"
+)
+
+// errLeaseLost is returned by operations that stopped because the lease they held could not be renewed.
+var errLeaseLost = errors.New("The lease of the operation was lost")
+
+// leaseLoss is closed when the lease held by an operation is lost, such that long operations stop between steps.  A
+// nil leaseLoss is never lost.
+type leaseLoss <-chan struct{}
+
+func (l leaseLoss) err() error {
+	select {
+	case <-l:
+		return errLeaseLost
+	default:
+		return nil
+	}
+}
+
+// lockedPlugin serializes mutations of each group across plugins, such as the plugins running on each manager.
+type lockedPlugin struct {
+	instance.Plugin
+	locker  lock.Locker
+	timeout time.Duration
+
+	// held serializes the operations of the plugin on each key, since an owner does not acquire a lease it holds.
+	heldLock sync.Mutex
+	held     map[string]chan struct{}
+}
+
+// NewLockedPlugin wraps a plugin such that instances of a group are only provisioned or destroyed while holding the
+// lease of the group.  Operations wait up to timeout for a lease held by another operation or plugin.
+func NewLockedPlugin(plugin instance.Plugin, locker lock.Locker, timeout time.Duration) instance.Plugin {
+	return &lockedPlugin{Plugin: plugin, locker: locker, timeout: timeout, held: map[string]chan struct{}{}}
+}
+
+// hold waits until no other operation of the plugin holds a key, returning the function that releases it.
+func (p *lockedPlugin) hold(key string, timeout time.Duration) (func(), error) {
+	p.heldLock.Lock()
+	slot, has := p.held[key]
+	if !has {
+		slot = make(chan struct{}, 1)
+		p.held[key] = slot
+	}
+	p.heldLock.Unlock()
+
+	release := func() { <-slot }
+	select {
+	case slot <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	select {
+	case slot <- struct{}{}:
+		return release, nil
+	case <-time.After(timeout):
+		return nil, lock.ErrLocked
+	}
+}
+
+// renew renews a lease until done is closed, closing lost if the lease may not be renewed before it expires.
+func (p *lockedPlugin) renew(lease *lock.Lease, done <-chan struct{}, lost chan<- struct{}) {
+	interval := lease.Expires.Sub(time.Now()) / 3
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+
+		renewed, err := p.locker.Renew(lease)
+		if err == nil {
+			lease = renewed
+			continue
+		}
+		if err != lock.ErrLocked && time.Now().Add(interval).Before(lease.Expires) {
+			log.Warnf("Failed to renew lease %s, retrying: %s", lease, err)
+			continue
+		}
+
+		log.Warnf("Lost lease %s: %s", lease, err)
+		close(lost)
+		return
+	}
+}
+
+// withLease runs an operation holding the lease of a key, renewing the lease until the operation completes.  Long
+// operations stop with errLeaseLost once the lease is lost.
+func (p *lockedPlugin) withLease(key string, op func(lost leaseLoss) error) error {
+	deadline := time.Now().Add(p.timeout)
+	unhold, err := p.hold(key, p.timeout)
+	if err != nil {
+		return fmt.Errorf("Failed to acquire lease of %s: %s", key, err)
+	}
+	defer unhold()
+
+	lease, err := lock.Wait(p.locker, key, deadline.Sub(time.Now()))
+	if err != nil {
+		return fmt.Errorf("Failed to acquire lease of %s: %s", key, err)
+	}
+	log.Infof("Acquired lease %s", lease)
+
+	defer func() {
+		if err := p.locker.Release(lease); err != nil {
+			log.Warnf("Failed to release lease %s: %s", lease, err)
+		}
+	}()
+
+	done := make(chan struct{})
+	lost := make(chan struct{})
+	go p.renew(lease, done, lost)
+	defer close(done)
+
+	if err := op(lost); err != nil {
+		return err
+	}
+	return leaseLoss(lost).err()
+}
+
+func groupLockKey(tags map[string]string) string {
+	if group, has := tags[GroupTag]; has {
+		return "group/" + group
+	}
+	return "ungrouped"
+}
+
+// Provision implements instance.Plugin.Provision.
+func (p *lockedPlugin) Provision(spec instance.Spec) (*instance.ID, error) {
+	var id *instance.ID
+	err := p.withLease(groupLockKey(spec.Tags), func(leaseLoss) error {
+		var err error
+		id, err = p.Plugin.Provision(spec)
+		return err
+	})
+	return id, err
+}
+
+// instanceLockKey is the key of the lease of the group of an existing instance, or of the instance itself if its group
+// is unknown.
+func (p *lockedPlugin) instanceLockKey(id instance.ID) string {
+	key := "instance/" + string(id)
+	if describer, is := p.Plugin.(interface {
+		describeInstance(instance.ID) (*ec2.Instance, error)
+	}); is {
+		if ec2Instance, err := describer.describeInstance(id); err == nil {
+			tags := map[string]string{}
+			for _, tag := range ec2Instance.Tags {
+				if tag.Key != nil && tag.Value != nil {
+					tags[*tag.Key] = *tag.Value
+				}
+			}
+			key = groupLockKey(tags)
+		}
+	}
+	return key
+}
+
+// Destroy implements instance.Plugin.Destroy.
+func (p *lockedPlugin) Destroy(id instance.ID) error {
+	return p.withLease(p.instanceLockKey(id), func(leaseLoss) error {
+		return p.Plugin.Destroy(id)
+	})
+}
+
+// RollingUpdate implements Updater.RollingUpdate, holding the lease of the group for the duration of the
+// update, which stops once the lease is lost.
+func (p *lockedPlugin) RollingUpdate(tags map[string]string, properties json.RawMessage, options UpdateOptions) error {
+	updater, is := p.Plugin.(Updater)
+	if !is {
+		return errors.New("Instance plugin does not support updates")
+	}
+
+	return p.withLease(groupLockKey(tags), func(lost leaseLoss) error {
+		options.lost = lost
+		return updater.RollingUpdate(tags, properties, options)
+	})
+}
+
+// Maintain implements Maintainer.Maintain, holding the lease of the group for the duration of the
+// maintenance, which stops once the lease is lost.
+func (p *lockedPlugin) Maintain(tags map[string]string, properties json.RawMessage, options MaintenanceOptions) error {
+	maintainer, is := p.Plugin.(Maintainer)
+	if !is {
+		return errors.New("Instance plugin does not support maintenance")
+	}
+
+	return p.withLease(groupLockKey(tags), func(lost leaseLoss) error {
+		options.lost = lost
+		return maintainer.Maintain(tags, properties, options)
+	})
+}
+
+// Rebalance implements Rebalancer.Rebalance, holding the lease of the group for the duration of the
+// rebalancing, which stops once the lease is lost.
+func (p *lockedPlugin) Rebalance(tags map[string]string, properties json.RawMessage, options RebalanceOptions) error {
+	rebalancer, is := p.Plugin.(Rebalancer)
+	if !is {
+		return errors.New("Instance plugin does not support rebalancing")
+	}
+
+	return p.withLease(groupLockKey(tags), func(lost leaseLoss) error {
+		options.lost = lost
+		return rebalancer.Rebalance(tags, properties, options)
+	})
+}
+
+// DescribeDetails implements DetailDescriber.DescribeDetails.
+func (p *lockedPlugin) DescribeDetails(tags map[string]string) ([]Details, error) {
+	describer, is := p.Plugin.(DetailDescriber)
+	if !is {
+		return nil, errors.New("Instance plugin does not support describing details")
+	}
+	return describer.DescribeDetails(tags)
+}
+
+// Adopt implements Adopter.Adopt, holding the lease of the group the instance joins.
+func (p *lockedPlugin) Adopt(id instance.ID, tags map[string]string, properties json.RawMessage, force bool) error {
+	adopter, is := p.Plugin.(Adopter)
+	if !is {
+		return errors.New("Instance plugin does not support adoption")
+	}
+
+	return p.withLease(groupLockKey(tags), func(leaseLoss) error {
+		return adopter.Adopt(id, tags, properties, force)
+	})
+}
+
+// Release implements Adopter.Release.
+func (p *lockedPlugin) Release(id instance.ID) error {
+	adopter, is := p.Plugin.(Adopter)
+	if !is {
+		return errors.New("Instance plugin does not support adoption")
+	}
+	return adopter.Release(id)
+}
+
+// Backup implements Backuper.Backup, holding the lease of the backups such that plugins of the same namespace do not
+// snapshot the volumes at the same time.
+func (p *lockedPlugin) Backup(options BackupOptions) error {
+	backuper, is := p.Plugin.(Backuper)
+	if !is {
+		return errors.New("Instance plugin does not support backups")
+	}
+
+	return p.withLease("backups", func(leaseLoss) error {
+		return backuper.Backup(options)
+	})
+}
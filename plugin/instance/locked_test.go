@@ -0,0 +1,202 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit.aws/plugin/lock"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLocker grants leases to keys that are not already held.
+type fakeLocker struct {
+	lock      sync.Mutex
+	held      map[string]bool
+	acquired  []string
+	ttl       time.Duration
+	renewed   int
+	renewLost bool
+}
+
+func (f *fakeLocker) Acquire(key string) (*lock.Lease, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.held[key] {
+		return nil, lock.ErrLocked
+	}
+	f.held[key] = true
+	f.acquired = append(f.acquired, key)
+
+	ttl := f.ttl
+	if ttl == 0 {
+		ttl = time.Minute
+	}
+	return &lock.Lease{Key: key, Expires: time.Now().Add(ttl)}, nil
+}
+
+func (f *fakeLocker) Renew(lease *lock.Lease) (*lock.Lease, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.renewLost || !f.held[lease.Key] {
+		return nil, lock.ErrLocked
+	}
+	f.renewed++
+	renewed := *lease
+	renewed.Expires = time.Now().Add(f.ttl)
+	return &renewed, nil
+}
+
+func (f *fakeLocker) Release(lease *lock.Lease) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.held, lease.Key)
+	return nil
+}
+
+func TestLockedPlugin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	locker := &fakeLocker{held: map[string]bool{}}
+	pluginImpl := NewLockedPlugin(NewInstancePlugin(clientMock, testNamespace), locker, 0)
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &inputJSON, Tags: map[string]string{GroupTag: "workers"}})
+	require.NoError(t, err)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse([][]string{{"test-id"}}, map[string]string{GroupTag: "workers"}, nil), nil)
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(gomock.Any()).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("test-id")}}},
+			nil)
+
+	require.NoError(t, pluginImpl.Destroy(instance.ID("test-id")))
+	require.Equal(t, []string{"group/workers", "group/workers"}, locker.acquired)
+	require.Empty(t, locker.held)
+
+	// Operations fail when the lease is held elsewhere.
+	locker.held["group/workers"] = true
+	_, err = pluginImpl.Provision(instance.Spec{Properties: &inputJSON, Tags: map[string]string{GroupTag: "workers"}})
+	require.Error(t, err)
+}
+
+func TestLockedPluginSerializesOperations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	locker := &fakeLocker{held: map[string]bool{}}
+	pluginImpl := NewLockedPlugin(NewInstancePlugin(clientMock, testNamespace), locker, 10*time.Second)
+
+	var inFlight, peak int
+	var counting sync.Mutex
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(*ec2.RunInstancesInput) {
+			counting.Lock()
+			inFlight++
+			if inFlight > peak {
+				peak = inFlight
+			}
+			counting.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			counting.Lock()
+			inFlight--
+			counting.Unlock()
+		}).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}}).
+		Times(3)
+
+	// Operations of the same plugin take turns with the lease, rather than sharing it.
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := pluginImpl.Provision(
+				instance.Spec{Properties: &inputJSON, Tags: map[string]string{GroupTag: "workers"}})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, <-errs)
+	}
+	require.Equal(t, 1, peak)
+	require.Len(t, locker.acquired, 3)
+}
+
+func TestLockedPluginRenewsLease(t *testing.T) {
+	locker := &fakeLocker{held: map[string]bool{}, ttl: 30 * time.Millisecond}
+	pluginImpl := NewLockedPlugin(nil, locker, 0).(*lockedPlugin)
+
+	// The lease is renewed while the operation runs.
+	err := pluginImpl.withLease("group/workers", func(lost leaseLoss) error {
+		time.Sleep(100 * time.Millisecond)
+		return lost.err()
+	})
+	require.NoError(t, err)
+	require.True(t, locker.renewed > 0)
+
+	// An operation stops once its lease may not be renewed.
+	locker.renewLost = true
+	err = pluginImpl.withLease("group/workers", func(lost leaseLoss) error {
+		select {
+		case <-lost:
+		case <-time.After(time.Second):
+		}
+		return nil
+	})
+	require.Equal(t, errLeaseLost, err)
+	require.Empty(t, locker.held)
+}
+
+func TestRollingUpdateStopsWhenLeaseIsLost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(updateInstances("ami-new", "ami-old"), nil)
+
+	lost := make(chan struct{})
+	close(lost)
+	err := NewInstancePlugin(clientMock, testNamespace).(Updater).RollingUpdate(
+		map[string]string{GroupTag: "workers"},
+		updateJSON,
+		UpdateOptions{BatchSize: 1, HealthTimeout: time.Minute, lost: lost})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Update stopped with 1 instances remaining")
+}
+
+func TestLockedLifecycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	locker := &fakeLocker{held: map[string]bool{}}
+	lifecycle, is := NewLockedPlugin(NewInstancePlugin(clientMock, testNamespace), locker, 0).(Lifecycle)
+	require.True(t, is)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse([][]string{{"test-id"}}, map[string]string{GroupTag: "workers"}, nil), nil)
+	clientMock.EXPECT().StopInstances(gomock.Any()).
+		Return(&ec2.StopInstancesOutput{
+			StoppingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("test-id")}}},
+			nil)
+
+	// Instances are stopped holding the lease of their group.
+	require.NoError(t, lifecycle.Stop(instance.ID("test-id")))
+	require.Equal(t, []string{"group/workers"}, locker.acquired)
+	require.Empty(t, locker.held)
+}
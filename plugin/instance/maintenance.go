@@ -0,0 +1,125 @@
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"strings"
+	"time"
+)
+
+// MaintenanceOptions controls the maintenance of a group.
+type MaintenanceOptions struct {
+	// HealthTimeout is the maximum time to wait for a resumed or replacement instance to pass its status checks.
+	HealthTimeout time.Duration
+
+	// ScheduledOnly limits maintenance to instances with scheduled events, such as system maintenance or instance
+	// retirement, which a stop and start moves to new hardware.
+	ScheduledOnly bool
+
+	// lost stops the maintenance once the lease it holds is lost.
+	lost leaseLoss
+}
+
+// Maintainer cycles the instances of a group through hibernation, keeping their IDs, volumes, addresses, and memory,
+// rather than replacing them.
+type Maintainer interface {
+	// Maintain hibernates and resumes the running instances matching tags, one at a time.  An instance that fails to
+	// hibernate, resume, or pass its status checks is replaced with an instance launched with properties.
+	Maintain(tags map[string]string, properties json.RawMessage, options MaintenanceOptions) error
+}
+
+// scheduledEvents returns the instances with scheduled events that have not completed.
+func (p awsInstancePlugin) scheduledEvents(ids []*string) (map[string]bool, error) {
+	scheduled := map[string]bool{}
+	err := p.client.DescribeInstanceStatusPages(
+		&ec2.DescribeInstanceStatusInput{InstanceIds: ids},
+		func(page *ec2.DescribeInstanceStatusOutput, lastPage bool) bool {
+			for _, status := range page.InstanceStatuses {
+				for _, event := range status.Events {
+					// Events are kept for a while once they complete, with their descriptions marked as such.
+					if !strings.HasPrefix(aws.StringValue(event.Description), "[Completed]") {
+						scheduled[aws.StringValue(status.InstanceId)] = true
+					}
+				}
+			}
+			return true
+		})
+	return scheduled, err
+}
+
+// resume hibernates an instance and starts it again once it has stopped.
+func (p awsInstancePlugin) resume(id instance.ID, timeout time.Duration) error {
+	if err := p.Hibernate(id); err != nil {
+		return fmt.Errorf("Failed to hibernate: %s", err)
+	}
+
+	input := &ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String(string(id))}}
+	if err := p.client.WaitUntilInstanceStopped(input); err != nil {
+		return fmt.Errorf("Failed to wait for hibernation: %s", err)
+	}
+
+	if err := p.Start(id); err != nil {
+		return fmt.Errorf("Failed to resume: %s", err)
+	}
+	return p.waitHealthy(id, timeout)
+}
+
+// Maintain implements Maintainer.Maintain.  Instances are maintained one at a time, so that at most one manager of a
+// quorum is unavailable, and maintenance stops at the first instance that is neither resumed nor replaced.
+func (p awsInstancePlugin) Maintain(
+	tags map[string]string,
+	properties json.RawMessage,
+	options MaintenanceOptions) error {
+
+	instances, err := p.describeInstances(tags, nil)
+	if err != nil {
+		return err
+	}
+
+	running := []*ec2.Instance{}
+	ids := []*string{}
+	for _, ec2Instance := range instances {
+		if ec2Instance.State != nil && aws.StringValue(ec2Instance.State.Name) == ec2.InstanceStateNameRunning {
+			running = append(running, ec2Instance)
+			ids = append(ids, ec2Instance.InstanceId)
+		}
+	}
+
+	if options.ScheduledOnly && len(ids) > 0 {
+		scheduled, err := p.scheduledEvents(ids)
+		if err != nil {
+			return err
+		}
+		pending := []*ec2.Instance{}
+		for _, ec2Instance := range running {
+			if scheduled[*ec2Instance.InstanceId] {
+				pending = append(pending, ec2Instance)
+			}
+		}
+		running = pending
+	}
+	log.Infof("Maintaining %d of %d instances", len(running), len(instances))
+
+	for i, ec2Instance := range running {
+		if err := options.lost.err(); err != nil {
+			return fmt.Errorf("Maintenance stopped with %d instances remaining: %s", len(running)-i, err)
+		}
+
+		id := instance.ID(*ec2Instance.InstanceId)
+		err := p.resume(id, options.HealthTimeout)
+		if err == nil {
+			log.Infof("Resumed instance %s", id)
+			continue
+		}
+
+		log.Warnf("Instance %s was not resumed, replacing it: %s", id, err)
+		if err := p.replace(ec2Instance, properties, options.HealthTimeout); err != nil {
+			return fmt.Errorf("Failed to replace %s: %s", id, err)
+		}
+	}
+	return nil
+}
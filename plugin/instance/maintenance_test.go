@@ -0,0 +1,119 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func healthyStatus() *ec2.DescribeInstanceStatusOutput {
+	return &ec2.DescribeInstanceStatusOutput{InstanceStatuses: []*ec2.InstanceStatus{{
+		InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+		SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+	}}}
+}
+
+func TestMaintain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Maintainer)
+
+	instances := updateInstances("ami-new", "ami-new")
+	for _, ec2Instance := range instances.Reservations[0].Instances {
+		ec2Instance.State = &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)}
+	}
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(instances, nil)
+
+	// Instance a is hibernated and resumed.
+	clientMock.EXPECT().StopInstancesRequest(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String("a")}}).
+		Return(fakeRequest(nil), &ec2.StopInstancesOutput{
+			StoppingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("a")}},
+		})
+	clientMock.EXPECT().WaitUntilInstanceStopped(gomock.Any()).Return(nil)
+	clientMock.EXPECT().StartInstances(&ec2.StartInstancesInput{InstanceIds: []*string{aws.String("a")}}).
+		Return(&ec2.StartInstancesOutput{
+			StartingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("a")}},
+		}, nil)
+
+	// Instance b was not launched with hibernation enabled, and is replaced.
+	clientMock.EXPECT().StopInstancesRequest(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String("b")}}).
+		Return(
+			fakeRequest(awserr.NewRequestFailure(
+				awserr.New("UnsupportedHibernationConfiguration", "not enabled", nil), 400, "")),
+			&ec2.StopInstancesOutput{})
+	clientMock.EXPECT().DescribeInstanceAttribute(gomock.Any()).Return(&ec2.DescribeInstanceAttributeOutput{}, nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("c")}}})
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("b")}}).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("b")}}},
+			nil)
+
+	clientMock.EXPECT().DescribeInstanceStatus(gomock.Any()).Return(healthyStatus(), nil).Times(2)
+
+	err := pluginImpl.Maintain(
+		map[string]string{GroupTag: "workers"},
+		updateJSON,
+		MaintenanceOptions{HealthTimeout: time.Minute})
+	require.NoError(t, err)
+}
+
+func TestMaintainScheduledOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Maintainer)
+
+	instances := updateInstances("ami-new", "ami-new")
+	for _, ec2Instance := range instances.Reservations[0].Instances {
+		ec2Instance.State = &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)}
+	}
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(instances, nil)
+	clientMock.EXPECT().DescribeInstanceStatusPages(gomock.Any(), gomock.Any()).
+		Do(func(input *ec2.DescribeInstanceStatusInput, fn func(*ec2.DescribeInstanceStatusOutput, bool) bool) {
+			fn(&ec2.DescribeInstanceStatusOutput{InstanceStatuses: []*ec2.InstanceStatus{
+				{
+					InstanceId: aws.String("a"),
+					Events: []*ec2.InstanceStatusEvent{{
+						Code:        aws.String(ec2.EventCodeSystemMaintenance),
+						Description: aws.String("[Completed] Scheduled system maintenance"),
+					}},
+				},
+				{
+					InstanceId: aws.String("b"),
+					Events: []*ec2.InstanceStatusEvent{{
+						Code:        aws.String(ec2.EventCodeInstanceRetirement),
+						Description: aws.String("The instance is running on degraded hardware"),
+					}},
+				},
+			}}, true)
+		}).
+		Return(nil)
+
+	// Only instance b has a pending event.
+	clientMock.EXPECT().StopInstancesRequest(&ec2.StopInstancesInput{InstanceIds: []*string{aws.String("b")}}).
+		Return(fakeRequest(nil), &ec2.StopInstancesOutput{
+			StoppingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("b")}},
+		})
+	clientMock.EXPECT().WaitUntilInstanceStopped(gomock.Any()).Return(nil)
+	clientMock.EXPECT().StartInstances(gomock.Any()).
+		Return(&ec2.StartInstancesOutput{
+			StartingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("b")}},
+		}, nil)
+	clientMock.EXPECT().DescribeInstanceStatus(gomock.Any()).Return(healthyStatus(), nil)
+
+	err := pluginImpl.Maintain(
+		map[string]string{GroupTag: "workers"},
+		updateJSON,
+		MaintenanceOptions{HealthTimeout: time.Minute, ScheduledOnly: true})
+	require.NoError(t, err)
+}
@@ -1,8 +1,10 @@
 package instance
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 // MetadataKey is the identifier for a metadata entry.
@@ -31,12 +33,25 @@ const (
 	MetadataAvailabilityZone = MetadataKey("http://169.254.169.254/latest/meta-data/placement/availability-zone")
 )
 
+// MetadataTag is the key of an instance tag, served by the metadata service to instances launched with
+// InstanceMetadataTags enabled.
+func MetadataTag(key string) MetadataKey {
+	return MetadataKey("http://169.254.169.254/latest/meta-data/tags/instance/" + key)
+}
+
+// metadataClient fails fast when the metadata service is unreachable, such as outside of EC2.
+var metadataClient = &http.Client{Timeout: 2 * time.Second}
+
 // GetMetadata returns the value of the metadata by key
 func GetMetadata(key MetadataKey) (string, error) {
-	resp, err := http.Get(string(key))
+	resp, err := metadataClient.Get(string(key))
 	if err != nil {
 		return "", err
 	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return "", fmt.Errorf("Metadata %s is unavailable: %s", key, resp.Status)
+	}
 	buff, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
@@ -51,5 +66,8 @@ func GetRegion() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if az == "" {
+		return "", fmt.Errorf("Metadata %s is empty", MetadataAvailabilityZone)
+	}
 	return az[0 : len(az)-1], nil
 }
@@ -0,0 +1,52 @@
+package instance
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"regexp"
+)
+
+const metadataTagsEnabled = "enabled"
+
+// metadataTagKeyPattern matches the tag keys that instances with metadata tags may have.
+var metadataTagKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9+\-=.,_:@]+$`)
+
+func validateMetadataOptions(options *ec2ext.MetadataOptions) error {
+	if options == nil {
+		return nil
+	}
+	switch options.HttpTokens {
+	case "", "optional", "required":
+	default:
+		return fmt.Errorf("MetadataOptions HttpTokens must be optional or required, not %s", options.HttpTokens)
+	}
+	switch options.InstanceMetadataTags {
+	case "", metadataTagsEnabled, "disabled":
+	default:
+		return fmt.Errorf(
+			"MetadataOptions InstanceMetadataTags must be enabled or disabled, not %s",
+			options.InstanceMetadataTags)
+	}
+	if options.HttpPutResponseHopLimit < 0 || options.HttpPutResponseHopLimit > 64 {
+		return fmt.Errorf("MetadataOptions HttpPutResponseHopLimit must be between 1 and 64")
+	}
+	return nil
+}
+
+func metadataTagsEnabledBy(options *ec2ext.MetadataOptions) bool {
+	return options != nil && options.InstanceMetadataTags == metadataTagsEnabled
+}
+
+// checkMetadataTagKeys checks that the tags of an instance may be served by the metadata service, which rejects
+// launches of instances with tag keys that are not valid metadata paths.
+func checkMetadataTagKeys(tags []*ec2.Tag) error {
+	for _, tag := range tags {
+		key := aws.StringValue(tag.Key)
+		if !metadataTagKeyPattern.MatchString(key) || key == "." || key == ".." || key == "_index" {
+			return fmt.Errorf("Tag %s may not be served by instance metadata, so InstanceMetadataTags may not be enabled", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestProvisionWithMetadataTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	properties := json.RawMessage(`{"MetadataOptions": {"HttpTokens": "required", "InstanceMetadataTags": "enabled"}}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	require.Equal(t, "enabled", params.Get("MetadataOptions.InstanceMetadataTags"))
+	require.Equal(t, "required", params.Get("MetadataOptions.HttpTokens"))
+}
+
+func TestMetadataTagsRejectInvalidKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// No instance is launched with a tag that the metadata service may not serve.
+	pluginImpl := awsInstancePlugin{client: mock_ec2.NewMockEC2API(ctrl), namespaceTags: testNamespace}
+	properties := json.RawMessage(`{
+	  "MetadataOptions": {"InstanceMetadataTags": "enabled"},
+	  "Tags": {"kubernetes.io/cluster/test": "owned"}
+	}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "kubernetes.io/cluster/test")
+}
+
+func TestMetadataOptionsValidation(t *testing.T) {
+	require.Error(t, validateMetadataOptions(&ec2ext.MetadataOptions{InstanceMetadataTags: "on"}))
+	require.Error(t, validateMetadataOptions(&ec2ext.MetadataOptions{HttpTokens: "always"}))
+	require.Error(t, validateMetadataOptions(&ec2ext.MetadataOptions{HttpPutResponseHopLimit: 65}))
+	require.NoError(t, validateMetadataOptions(&ec2ext.MetadataOptions{HttpPutResponseHopLimit: 2}))
+	require.NoError(t, validateMetadataOptions(nil))
+
+	require.NoError(t, checkMetadataTagKeys([]*ec2.Tag{{Key: aws.String(SlotTag)}, {Key: aws.String(GroupTag)}}))
+	require.Error(t, checkMetadataTagKeys([]*ec2.Tag{{Key: aws.String("has space")}}))
+	require.Error(t, checkMetadataTagKeys([]*ec2.Tag{{Key: aws.String("_index")}}))
+}
@@ -0,0 +1,66 @@
+package instance
+
+import (
+	"fmt"
+	"github.com/docker/infrakit/spi/instance"
+	"regexp"
+	"strings"
+)
+
+const (
+	// NameTag is the tag EC2 consoles show as the name of an instance.
+	NameTag = "Name"
+
+	// maxHostnameLength is the maximum length of a hostname label.
+	maxHostnameLength = 63
+)
+
+// invalidHostnameCharacters are the characters that are replaced by hyphens in hostnames.
+var invalidHostnameCharacters = regexp.MustCompile("[^a-z0-9-]+")
+
+// InstanceName names instances after their group and their slot or logical ID, such as mycluster-manager-2.
+type InstanceName struct {
+	// Prefix precedes the names of instances, such as the name of their cluster.
+	Prefix string `json:",omitempty"`
+
+	// Hostname also sets the hostname of instances to their names, from their user data or CloudConfig.  Since the
+	// names of instances without a slot or logical ID are not unique, only instances with either have their hostname
+	// set.
+	Hostname bool `json:",omitempty"`
+}
+
+func (n *InstanceName) validate() error {
+	if n == nil {
+		return nil
+	}
+	if n.Prefix != "" && hostnameOf(n.Prefix) == "" {
+		return fmt.Errorf("Name prefix %s must contain letters or digits", n.Prefix)
+	}
+	return nil
+}
+
+// hostnameOf converts a name to a valid hostname label, in lower case with hyphens in place of other characters.
+func hostnameOf(name string) string {
+	hostname := invalidHostnameCharacters.ReplaceAllString(strings.ToLower(name), "-")
+	if len(hostname) > maxHostnameLength {
+		hostname = hostname[:maxHostnameLength]
+	}
+	return strings.Trim(hostname, "-")
+}
+
+// instanceName returns the name of an instance, and whether it identifies the instance within its group.  The
+// identity of an instance is its slot, or else its logical ID.
+func (n InstanceName) instanceName(tags map[string]string, slot string, logicalID *instance.LogicalID) (string, bool) {
+	identity := slot
+	if identity == "" && logicalID != nil {
+		identity = string(*logicalID)
+	}
+
+	parts := []string{}
+	for _, part := range []string{n.Prefix, tags[GroupTag], identity} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return hostnameOf(strings.Join(parts, "-")), identity != ""
+}
@@ -0,0 +1,78 @@
+package instance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestInstanceName(t *testing.T) {
+	name := InstanceName{Prefix: "MyCluster"}
+	logicalID := instance.LogicalID("10.0.0.5")
+
+	named, identified := name.instanceName(map[string]string{GroupTag: "manager"}, "2", &logicalID)
+	require.Equal(t, "mycluster-manager-2", named)
+	require.True(t, identified)
+
+	named, identified = name.instanceName(map[string]string{GroupTag: "manager"}, "", &logicalID)
+	require.Equal(t, "mycluster-manager-10-0-0-5", named)
+	require.True(t, identified)
+
+	named, identified = name.instanceName(map[string]string{GroupTag: "workers"}, "", nil)
+	require.Equal(t, "mycluster-workers", named)
+	require.False(t, identified)
+
+	require.Error(t, (&InstanceName{Prefix: "--"}).validate())
+}
+
+func TestProvisionWithName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	groupRequest := describeGroupRequest(testNamespace, map[string]string{GroupTag: "manager"}, nil)
+	clientMock.EXPECT().DescribeInstances(groupRequest).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+			{Instances: []*ec2.Instance{slotInstance("0"), slotInstance("1")}},
+		}}, nil)
+
+	runRequest := fakeRequest(nil)
+	var input *ec2.RunInstancesInput
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(runInput *ec2.RunInstancesInput) { input = runInput }).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	properties := json.RawMessage(`{"Slots": true, "Name": {"Prefix": "mycluster", "Hostname": true}}`)
+	_, err := pluginImpl.Provision(instance.Spec{
+		Properties: &properties,
+		Tags:       map[string]string{GroupTag: "manager"},
+		Init:       "#!/bin/sh\ndocker swarm join\n",
+	})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	name := ""
+	for key, values := range params {
+		if values[0] == NameTag {
+			name = params.Get(key[:len(key)-len("Key")] + "Value")
+		}
+	}
+	require.Equal(t, "mycluster-manager-2", name)
+
+	userData, err := base64.StdEncoding.DecodeString(aws.StringValue(input.UserData))
+	require.NoError(t, err)
+	parts, rendered := parseMultipartUserData(string(userData))
+	require.True(t, rendered)
+	require.Equal(t, []userDataPart{
+		{cloudConfigSource, "#cloud-config\n{\"hostname\":\"mycluster-manager-2\"}\n"},
+		{initSource, "#!/bin/sh\ndocker swarm join\n"},
+	}, parts)
+}
@@ -0,0 +1,169 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"time"
+)
+
+const (
+	// NetworkInterfaceInstanceTag is the tag name used to associate secondary network interfaces with the instance
+	// they were created for.
+	NetworkInterfaceInstanceTag = "infrakit.instance-id"
+)
+
+// NetworkInterfaceSpec is a secondary network interface that is created and attached when an instance is provisioned.
+type NetworkInterfaceSpec struct {
+	SubnetID         string   `json:"SubnetId"`
+	SecurityGroupIDs []string `json:"SecurityGroupIds,omitempty"`
+	PrivateIPAddress string   `json:"PrivateIpAddress,omitempty"`
+
+	// SourceDestCheck may be disabled for instances that route traffic, such as NAT instances.
+	SourceDestCheck *bool `json:",omitempty"`
+
+	// DeleteOnTermination deletes the interface when the instance is terminated, and defaults to true.  Interfaces
+	// that are kept on termination are still deleted when the instance is destroyed by the plugin.
+	DeleteOnTermination *bool `json:",omitempty"`
+}
+
+// attachNetworkInterfaces creates the secondary network interfaces of a running instance, attaching them in order
+// after the interfaces the instance was launched with.
+func (p awsInstancePlugin) attachNetworkInterfaces(
+	ec2Instance *ec2.Instance,
+	specs []NetworkInterfaceSpec,
+	tags []*ec2.Tag) error {
+
+	if len(specs) == 0 {
+		return nil
+	}
+
+	deviceIndex := int64(len(ec2Instance.NetworkInterfaces))
+	if deviceIndex == 0 {
+		deviceIndex = 1
+	}
+
+	interfaceTags := append(
+		[]*ec2.Tag{{Key: aws.String(NetworkInterfaceInstanceTag), Value: ec2Instance.InstanceId}},
+		tags...)
+
+	for i, spec := range specs {
+		input := &ec2.CreateNetworkInterfaceInput{
+			SubnetId:    aws.String(spec.SubnetID),
+			Groups:      aws.StringSlice(spec.SecurityGroupIDs),
+			Description: aws.String(fmt.Sprintf("Secondary interface of %s", *ec2Instance.InstanceId)),
+		}
+		if spec.PrivateIPAddress != "" {
+			input.PrivateIpAddress = aws.String(spec.PrivateIPAddress)
+		}
+		created, err := p.client.CreateNetworkInterface(input)
+		if err != nil {
+			return err
+		}
+		interfaceID := created.NetworkInterface.NetworkInterfaceId
+
+		_, err = p.client.CreateTags(&ec2.CreateTagsInput{Resources: []*string{interfaceID}, Tags: interfaceTags})
+		if err != nil {
+			return err
+		}
+
+		if spec.SourceDestCheck != nil {
+			_, err = p.client.ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+				NetworkInterfaceId: interfaceID,
+				SourceDestCheck:    &ec2.AttributeBooleanValue{Value: spec.SourceDestCheck},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		attachment, err := p.client.AttachNetworkInterface(&ec2.AttachNetworkInterfaceInput{
+			InstanceId:         ec2Instance.InstanceId,
+			NetworkInterfaceId: interfaceID,
+			DeviceIndex:        aws.Int64(deviceIndex + int64(i)),
+		})
+		if err != nil {
+			return err
+		}
+
+		deleteOnTermination := spec.DeleteOnTermination == nil || *spec.DeleteOnTermination
+		_, err = p.client.ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: interfaceID,
+			Attachment: &ec2.NetworkInterfaceAttachmentChanges{
+				AttachmentId:        attachment.AttachmentId,
+				DeleteOnTermination: aws.Bool(deleteOnTermination),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteNetworkInterfaces deletes the secondary network interfaces of an instance that would otherwise remain once it
+// is terminated.  Failures are logged rather than returned, since they must not prevent the instance from being
+// destroyed.
+func (p awsInstancePlugin) deleteNetworkInterfaces(id instance.ID) {
+	result, err := p.client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:" + NetworkInterfaceInstanceTag),
+				Values: []*string{aws.String(string(id))},
+			},
+		},
+	})
+	if err != nil {
+		log.Warnf("Failed to look up network interfaces of instance %s: %s", id, err)
+		return
+	}
+
+	for _, networkInterface := range result.NetworkInterfaces {
+		attachment := networkInterface.Attachment
+		if attachment != nil && aws.BoolValue(attachment.DeleteOnTermination) {
+			continue
+		}
+
+		interfaceID := networkInterface.NetworkInterfaceId
+		if attachment != nil {
+			_, err := p.client.DetachNetworkInterface(&ec2.DetachNetworkInterfaceInput{
+				AttachmentId: attachment.AttachmentId,
+				Force:        aws.Bool(true),
+			})
+			if err != nil {
+				log.Warnf("Failed to detach network interface %s: %s", *interfaceID, err)
+				continue
+			}
+			p.waitAvailable(interfaceID, time.Minute)
+		}
+
+		log.Infof("Deleting network interface %s of instance %s", *interfaceID, id)
+		_, err := p.client.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{NetworkInterfaceId: interfaceID})
+		if err != nil {
+			log.Warnf("Failed to delete network interface %s: %s", *interfaceID, err)
+		}
+	}
+}
+
+// waitAvailable waits for a network interface to be detached and become available, returning whether it did within
+// the timeout.
+func (p awsInstancePlugin) waitAvailable(interfaceID *string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := p.client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: []*string{interfaceID},
+		})
+		if err != nil || len(result.NetworkInterfaces) == 0 {
+			return false
+		}
+		if aws.StringValue(result.NetworkInterfaces[0].Status) == ec2.NetworkInterfaceStatusAvailable {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,138 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestProvisionNetworkInterfaces(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	properties := json.RawMessage(`{"NetworkInterfaces": [
+		{"SubnetId": "subnet-a", "SecurityGroupIds": ["sg-a"], "PrivateIpAddress": "10.0.1.5", "SourceDestCheck": false},
+		{"SubnetId": "subnet-b", "DeleteOnTermination": false}
+	]}`)
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{
+			InstanceId:        aws.String("i-1"),
+			NetworkInterfaces: []*ec2.InstanceNetworkInterface{{NetworkInterfaceId: aws.String("eni-0")}},
+		}}})
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(instanceInState("i-1", ec2.InstanceStateNameRunning), nil)
+
+	gomock.InOrder(
+		clientMock.EXPECT().CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{
+			SubnetId:         aws.String("subnet-a"),
+			Groups:           []*string{aws.String("sg-a")},
+			PrivateIpAddress: aws.String("10.0.1.5"),
+			Description:      aws.String("Secondary interface of i-1"),
+		}).Return(&ec2.CreateNetworkInterfaceOutput{
+			NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String("eni-1")}}, nil),
+		clientMock.EXPECT().CreateTags(gomock.Any()).Do(func(input *ec2.CreateTagsInput) {
+			require.Equal(t, []*string{aws.String("eni-1")}, input.Resources)
+			require.Equal(t, NetworkInterfaceInstanceTag, *input.Tags[0].Key)
+			require.Equal(t, "i-1", *input.Tags[0].Value)
+		}).Return(&ec2.CreateTagsOutput{}, nil),
+		clientMock.EXPECT().ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: aws.String("eni-1"),
+			SourceDestCheck:    &ec2.AttributeBooleanValue{Value: aws.Bool(false)},
+		}).Return(&ec2.ModifyNetworkInterfaceAttributeOutput{}, nil),
+		clientMock.EXPECT().AttachNetworkInterface(&ec2.AttachNetworkInterfaceInput{
+			InstanceId:         aws.String("i-1"),
+			NetworkInterfaceId: aws.String("eni-1"),
+			DeviceIndex:        aws.Int64(1),
+		}).Return(&ec2.AttachNetworkInterfaceOutput{AttachmentId: aws.String("attach-1")}, nil),
+		clientMock.EXPECT().ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: aws.String("eni-1"),
+			Attachment: &ec2.NetworkInterfaceAttachmentChanges{
+				AttachmentId:        aws.String("attach-1"),
+				DeleteOnTermination: aws.Bool(true),
+			},
+		}).Return(&ec2.ModifyNetworkInterfaceAttributeOutput{}, nil),
+
+		clientMock.EXPECT().CreateNetworkInterface(gomock.Any()).Return(&ec2.CreateNetworkInterfaceOutput{
+			NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String("eni-2")}}, nil),
+		clientMock.EXPECT().CreateTags(gomock.Any()).Return(&ec2.CreateTagsOutput{}, nil),
+		clientMock.EXPECT().AttachNetworkInterface(&ec2.AttachNetworkInterfaceInput{
+			InstanceId:         aws.String("i-1"),
+			NetworkInterfaceId: aws.String("eni-2"),
+			DeviceIndex:        aws.Int64(2),
+		}).Return(&ec2.AttachNetworkInterfaceOutput{AttachmentId: aws.String("attach-2")}, nil),
+		clientMock.EXPECT().ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: aws.String("eni-2"),
+			Attachment: &ec2.NetworkInterfaceAttachmentChanges{
+				AttachmentId:        aws.String("attach-2"),
+				DeleteOnTermination: aws.Bool(false),
+			},
+		}).Return(&ec2.ModifyNetworkInterfaceAttributeOutput{}, nil),
+	)
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties})
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("i-1"), *id)
+}
+
+func TestDestroyDeletesRetainedNetworkInterfaces(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	gomock.InOrder(
+		clientMock.EXPECT().TerminateInstances(gomock.Any()).
+			Return(&ec2.TerminateInstancesOutput{
+				TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("i-1")}}},
+				nil),
+		clientMock.EXPECT().DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+			Filters: []*ec2.Filter{{
+				Name:   aws.String("tag:" + NetworkInterfaceInstanceTag),
+				Values: []*string{aws.String("i-1")},
+			}},
+		}).Return(&ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []*ec2.NetworkInterface{
+			{
+				NetworkInterfaceId: aws.String("eni-1"),
+				Attachment: &ec2.NetworkInterfaceAttachment{
+					AttachmentId:        aws.String("attach-1"),
+					DeleteOnTermination: aws.Bool(true),
+				},
+			},
+			{
+				NetworkInterfaceId: aws.String("eni-2"),
+				Attachment: &ec2.NetworkInterfaceAttachment{
+					AttachmentId:        aws.String("attach-2"),
+					DeleteOnTermination: aws.Bool(false),
+				},
+			},
+			{NetworkInterfaceId: aws.String("eni-3")},
+		}}, nil),
+		clientMock.EXPECT().DetachNetworkInterface(&ec2.DetachNetworkInterfaceInput{
+			AttachmentId: aws.String("attach-2"),
+			Force:        aws.Bool(true),
+		}).Return(&ec2.DetachNetworkInterfaceOutput{}, nil),
+		clientMock.EXPECT().DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: []*string{aws.String("eni-2")},
+		}).Return(&ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []*ec2.NetworkInterface{{
+			NetworkInterfaceId: aws.String("eni-2"),
+			Status:             aws.String(ec2.NetworkInterfaceStatusAvailable),
+		}}}, nil),
+		clientMock.EXPECT().DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+			NetworkInterfaceId: aws.String("eni-2"),
+		}).Return(&ec2.DeleteNetworkInterfaceOutput{}, nil),
+		clientMock.EXPECT().DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+			NetworkInterfaceId: aws.String("eni-3"),
+		}).Return(&ec2.DeleteNetworkInterfaceOutput{}, nil),
+	)
+
+	require.NoError(t, pluginImpl.Destroy("i-1"))
+}
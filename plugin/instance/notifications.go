@@ -0,0 +1,71 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/infrakit.aws/plugin/notify"
+	"github.com/docker/infrakit/spi/instance"
+	"time"
+)
+
+func (p awsInstancePlugin) publish(event notify.Event) {
+	event.Time = time.Now().UTC()
+	event.Group = event.Tags[GroupTag]
+	if err := p.notifier.Publish(event); err != nil {
+		log.Warnf("Failed to publish %s event of instance %s: %s", event.Type, event.InstanceID, err)
+	}
+}
+
+// notifyProvision publishes the outcome of a provision.  Failed provisions may have launched an instance, which is
+// included in the event.
+func (p awsInstancePlugin) notifyProvision(spec instance.Spec, id *instance.ID, err error) {
+	if p.notifier == nil {
+		return
+	}
+
+	event := notify.Event{Type: notify.Provisioned, Tags: spec.Tags}
+	if id != nil {
+		event.InstanceID = string(*id)
+	}
+	if spec.LogicalID != nil {
+		event.LogicalID = string(*spec.LogicalID)
+	}
+	if err != nil {
+		event.Type = notify.ProvisionFailed
+		event.Error = err.Error()
+	}
+	p.publish(event)
+}
+
+// notificationTags looks up the tags of an instance before it is destroyed, for the event of its destruction.
+func (p awsInstancePlugin) notificationTags(id instance.ID) map[string]string {
+	if p.notifier == nil {
+		return nil
+	}
+
+	ec2Instance, err := p.describeInstance(id)
+	if err != nil {
+		return nil
+	}
+	tags := map[string]string{}
+	for _, tag := range ec2Instance.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+	return tags
+}
+
+// notifyDestroy publishes the outcome of destroying an instance.
+func (p awsInstancePlugin) notifyDestroy(id instance.ID, tags map[string]string, err error) {
+	if p.notifier == nil {
+		return
+	}
+
+	event := notify.Event{Type: notify.Destroyed, InstanceID: string(id), Tags: tags}
+	event.LogicalID = tags[LogicalIDTag]
+	if err != nil {
+		event.Type = notify.DestroyFailed
+		event.Error = err.Error()
+	}
+	p.publish(event)
+}
@@ -0,0 +1,96 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit.aws/plugin/notify"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// fakePublisher records the events published.
+type fakePublisher struct {
+	events []notify.Event
+}
+
+func (f *fakePublisher) Publish(event notify.Event) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestNotifyProvision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	publisher := &fakePublisher{}
+	pluginImpl := &awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		subnets:       newSubnetCache(),
+		provisions:    newProvisionLimiter(0),
+		slots:         newSlotAllocator(),
+		notifier:      publisher,
+	}
+
+	properties := json.RawMessage(`{}`)
+	spec := instance.Spec{Properties: &properties, Tags: map[string]string{GroupTag: "workers"}}
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+	_, err := pluginImpl.Provision(spec)
+	require.NoError(t, err)
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(errors.New("InsufficientInstanceCapacity")), &ec2.Reservation{})
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil)
+	_, err = pluginImpl.Provision(spec)
+	require.Error(t, err)
+
+	require.Len(t, publisher.events, 2)
+	require.Equal(t, notify.Provisioned, publisher.events[0].Type)
+	require.Equal(t, "i-1", publisher.events[0].InstanceID)
+	require.Equal(t, "workers", publisher.events[0].Group)
+	require.False(t, publisher.events[0].Time.IsZero())
+	require.Equal(t, notify.ProvisionFailed, publisher.events[1].Type)
+	require.Empty(t, publisher.events[1].InstanceID)
+	require.Contains(t, publisher.events[1].Error, "InsufficientInstanceCapacity")
+}
+
+func TestNotifyDestroy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	publisher := &fakePublisher{}
+	pluginImpl := &awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		subnets:       newSubnetCache(),
+		provisions:    newProvisionLimiter(0),
+		slots:         newSlotAllocator(),
+		notifier:      publisher,
+	}
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse(
+			[][]string{{"i-1"}},
+			map[string]string{GroupTag: "workers", LogicalIDTag: "10.0.0.2"},
+			nil), nil).
+		AnyTimes()
+	clientMock.EXPECT().TerminateInstances(gomock.Any()).Return(nil, errors.New("UnauthorizedOperation"))
+
+	require.Error(t, pluginImpl.Destroy(instance.ID("i-1")))
+
+	require.Len(t, publisher.events, 1)
+	require.Equal(t, notify.DestroyFailed, publisher.events[0].Type)
+	require.Equal(t, "i-1", publisher.events[0].InstanceID)
+	require.Equal(t, "workers", publisher.events[0].Group)
+	require.Equal(t, "10.0.0.2", publisher.events[0].LogicalID)
+	require.Contains(t, publisher.events[0].Error, "UnauthorizedOperation")
+}
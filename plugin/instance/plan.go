@@ -0,0 +1,233 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+)
+
+const (
+	// PlanCreate is the action of an instance that would be provisioned.
+	PlanCreate = "create"
+
+	// PlanDestroy is the action of an instance that would be destroyed.
+	PlanDestroy = "destroy"
+
+	// PlanRelabel is the action of an instance that would be kept, with some of its tags changed.
+	PlanRelabel = "relabel"
+)
+
+// PlanOptions describe a proposed change of a group.
+type PlanOptions struct {
+	// Size is the proposed size of the group, or a negative size to keep its current size.  It is ignored when
+	// LogicalIDs are set.
+	Size int
+
+	// LogicalIDs are the proposed logical IDs of the instances of a group of pets, such as managers.
+	LogicalIDs []instance.LogicalID
+
+	// Tags are the tags the group provisions its instances with, in addition to the Tags of the properties, such as
+	// the hash of the group's configuration.
+	Tags map[string]string
+}
+
+// PlannedChange is a change of one instance that a proposed change of its group would make.
+type PlannedChange struct {
+	// Action is create, destroy, or relabel.
+	Action string
+
+	// ID is the instance that is destroyed or relabeled.
+	ID *instance.ID `json:",omitempty"`
+
+	// LogicalID is the logical ID of the instance, if any.
+	LogicalID *instance.LogicalID `json:",omitempty"`
+
+	// Reason explains the change.
+	Reason string
+
+	// Tags are the tags that a relabel sets.
+	Tags map[string]string `json:",omitempty"`
+}
+
+// Planner evaluates proposed changes of groups against the instances they have, without changing them.
+type Planner interface {
+	// Plan reports the instances matching tags that would be created, destroyed, or relabeled if the group were
+	// changed to properties and options.
+	Plan(tags map[string]string, properties json.RawMessage, options PlanOptions) ([]PlannedChange, error)
+}
+
+func tagsOf(ec2Instance *ec2.Instance) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range ec2Instance.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags
+}
+
+// Plan implements Planner.Plan.  A group scaling down destroys its instances in the order of their IDs, as the
+// InfraKit group plugin does, and a group of pets destroys the instances whose logical IDs it no longer has.  The
+// instances kept that run another image or instance type than properties are destroyed and replaced, as by
+// RollingUpdate, and those that only differ in their tags are relabeled, which Adopter.Adopt applies.
+func (p awsInstancePlugin) Plan(
+	tags map[string]string,
+	properties json.RawMessage,
+	options PlanOptions) ([]PlannedChange, error) {
+
+	request, err := parseRequest(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	described, err := p.describeInstances(tags, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*ec2.Instance{}
+	ids := []string{}
+	for _, ec2Instance := range withoutFailed(described) {
+		id := aws.StringValue(ec2Instance.InstanceId)
+		byID[id] = ec2Instance
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	changes := []PlannedChange{}
+	destroy := func(ec2Instance *ec2.Instance, reason string) {
+		id := instance.ID(aws.StringValue(ec2Instance.InstanceId))
+		change := PlannedChange{Action: PlanDestroy, ID: &id, Reason: reason}
+		if logicalID, has := tagsOf(ec2Instance)[LogicalIDTag]; has {
+			change.LogicalID = (*instance.LogicalID)(&logicalID)
+		}
+		changes = append(changes, change)
+	}
+
+	kept := []*ec2.Instance{}
+	if len(options.LogicalIDs) > 0 {
+		proposed := map[instance.LogicalID]bool{}
+		for _, logicalID := range options.LogicalIDs {
+			proposed[logicalID] = true
+		}
+		found := map[instance.LogicalID]bool{}
+		for _, id := range ids {
+			logicalID := instance.LogicalID(tagsOf(byID[id])[LogicalIDTag])
+			switch {
+			case !proposed[logicalID]:
+				destroy(byID[id], "Instance does not have a proposed logical ID")
+			case found[logicalID]:
+				destroy(byID[id], fmt.Sprintf("Another instance has logical ID %s", logicalID))
+			default:
+				found[logicalID] = true
+				kept = append(kept, byID[id])
+			}
+		}
+		for i := range options.LogicalIDs {
+			if !found[options.LogicalIDs[i]] {
+				changes = append(changes, PlannedChange{
+					Action:    PlanCreate,
+					LogicalID: &options.LogicalIDs[i],
+					Reason:    fmt.Sprintf("No instance has logical ID %s", options.LogicalIDs[i]),
+				})
+			}
+		}
+	} else {
+		size := options.Size
+		if size < 0 {
+			size = len(ids)
+		}
+		for n, id := range ids {
+			if n < len(ids)-size {
+				destroy(byID[id], fmt.Sprintf("Group scales down from %d to %d instances", len(ids), size))
+			} else {
+				kept = append(kept, byID[id])
+			}
+		}
+		for n := len(ids); n < size; n++ {
+			changes = append(changes, PlannedChange{
+				Action: PlanCreate,
+				Reason: fmt.Sprintf("Group scales up from %d to %d instances", len(ids), size),
+			})
+		}
+	}
+
+	groupTags := map[string]string{}
+	for _, tagMap := range []map[string]string{tags, options.Tags} {
+		for key, value := range tagMap {
+			groupTags[key] = value
+		}
+	}
+	for _, ec2Instance := range kept {
+		id := instance.ID(aws.StringValue(ec2Instance.InstanceId))
+		current := tagsOf(ec2Instance)
+		var logicalID *instance.LogicalID
+		if value, has := current[LogicalIDTag]; has {
+			logicalID = (*instance.LogicalID)(&value)
+		}
+
+		if outdated(ec2Instance, request) {
+			reason := fmt.Sprintf("Instance runs image %s and instance type %s",
+				aws.StringValue(ec2Instance.ImageId),
+				aws.StringValue(ec2Instance.InstanceType))
+			destroy(ec2Instance, reason)
+			changes = append(changes, PlannedChange{
+				Action:    PlanCreate,
+				LogicalID: logicalID,
+				Reason:    fmt.Sprintf("Replaces %s", id),
+			})
+			continue
+		}
+
+		// The proposed tags are computed by the tag policy, if any, as they are when an instance is provisioned.
+		name := ""
+		if request.Name != nil {
+			name, _ = request.Name.instanceName(groupTags, current[SlotTag], logicalID)
+		}
+		userTags, name, err := p.policyTags(request, groupTags, current[SlotTag], logicalID, name)
+		if err != nil {
+			return nil, err
+		}
+		proposedTags := map[string]string{}
+		for _, tagMap := range []map[string]string{userTags, options.Tags, p.namespaceTags} {
+			for key, value := range tagMap {
+				proposedTags[key] = value
+			}
+		}
+		if name != "" {
+			proposedTags[NameTag] = name
+		}
+
+		changed := map[string]string{}
+		for key, value := range proposedTags {
+			if current[key] != value {
+				changed[key] = value
+			}
+		}
+		if len(changed) > 0 {
+			changes = append(changes, PlannedChange{
+				Action:    PlanRelabel,
+				ID:        &id,
+				LogicalID: logicalID,
+				Reason:    "Instance has other tags than the proposed tags",
+				Tags:      changed,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// Plan implements Planner.Plan.  Plans do not change instances, so they do not hold the lease of the group.
+func (p *lockedPlugin) Plan(
+	tags map[string]string,
+	properties json.RawMessage,
+	options PlanOptions) ([]PlannedChange, error) {
+
+	planner, is := p.Plugin.(Planner)
+	if !is {
+		return nil, errors.New("Instance plugin does not support plans")
+	}
+	return planner.Plan(tags, properties, options)
+}
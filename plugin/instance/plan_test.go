@@ -0,0 +1,103 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func planInstance(id, image string, tags map[string]string) *ec2.Instance {
+	ec2Instance := &ec2.Instance{
+		InstanceId:   aws.String(id),
+		ImageId:      aws.String(image),
+		InstanceType: aws.String("t2.micro"),
+	}
+	for key, value := range mergeTagMaps(testNamespace, map[string]string{GroupTag: "workers"}, tags) {
+		ec2Instance.Tags = append(ec2Instance.Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return ec2Instance
+}
+
+func mergeTagMaps(tagMaps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, tagMap := range tagMaps {
+		for key, value := range tagMap {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+func planChanges(t *testing.T, options PlanOptions, instances ...*ec2.Instance) []PlannedChange {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Planner)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: instances}}}, nil)
+
+	changes, err := pluginImpl.Plan(map[string]string{GroupTag: "workers"}, updateJSON, options)
+	require.NoError(t, err)
+	return changes
+}
+
+func TestPlanScaleDown(t *testing.T) {
+	sha := map[string]string{"infrakit.config_sha": "abc"}
+	changes := planChanges(t,
+		PlanOptions{Size: 2, Tags: sha},
+		planInstance("i-3", "ami-new", sha),
+		planInstance("i-1", "ami-new", sha),
+		planInstance("i-2", "ami-old", sha),
+		planInstance("i-4", "ami-new", map[string]string{"infrakit.config_sha": "old"}))
+
+	// The instances with the first IDs are destroyed, including the outdated instance, which is not replaced, and the
+	// instance with other tags is relabeled.
+	require.Len(t, changes, 3)
+	require.Equal(t, PlanDestroy, changes[0].Action)
+	require.Equal(t, instance.ID("i-1"), *changes[0].ID)
+	require.Equal(t, PlanDestroy, changes[1].Action)
+	require.Equal(t, instance.ID("i-2"), *changes[1].ID)
+	require.Equal(t, PlanRelabel, changes[2].Action)
+	require.Equal(t, instance.ID("i-4"), *changes[2].ID)
+	require.Equal(t, map[string]string{"infrakit.config_sha": "abc"}, changes[2].Tags)
+}
+
+func TestPlanScaleUp(t *testing.T) {
+	sha := map[string]string{"infrakit.config_sha": "abc"}
+	changes := planChanges(t,
+		PlanOptions{Size: 3, Tags: sha},
+		planInstance("i-1", "ami-new", sha),
+		planInstance("i-2", "ami-old", sha))
+
+	actions := []string{}
+	for _, change := range changes {
+		actions = append(actions, change.Action)
+	}
+	require.Equal(t, []string{PlanCreate, PlanDestroy, PlanCreate}, actions)
+	require.Equal(t, instance.ID("i-2"), *changes[1].ID)
+	require.Equal(t, "Replaces i-2", changes[2].Reason)
+
+	// A negative size keeps the size of the group.
+	changes = planChanges(t, PlanOptions{Size: -1, Tags: sha}, planInstance("i-1", "ami-new", sha))
+	require.Empty(t, changes)
+}
+
+func TestPlanLogicalIDs(t *testing.T) {
+	changes := planChanges(t,
+		PlanOptions{LogicalIDs: []instance.LogicalID{"10.0.0.1", "10.0.0.2"}},
+		planInstance("i-1", "ami-new", map[string]string{LogicalIDTag: "10.0.0.1"}),
+		planInstance("i-2", "ami-old", map[string]string{LogicalIDTag: "10.0.0.3"}))
+
+	require.Len(t, changes, 2)
+	require.Equal(t, PlanDestroy, changes[0].Action)
+	require.Equal(t, instance.ID("i-2"), *changes[0].ID)
+	require.Equal(t, instance.LogicalID("10.0.0.3"), *changes[0].LogicalID)
+	require.Equal(t, PlanCreate, changes[1].Action)
+	require.Equal(t, instance.LogicalID("10.0.0.2"), *changes[1].LogicalID)
+}
@@ -0,0 +1,257 @@
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PolicyDocument is an IAM policy document.
+type PolicyDocument struct {
+	Version   string
+	Statement []PolicyStatement
+}
+
+// PolicyStatement is a statement of an IAM policy document.
+type PolicyStatement struct {
+	Sid       string
+	Effect    string
+	Action    []string
+	Resource  []string
+	Condition map[string]map[string]string `json:",omitempty"`
+}
+
+// PolicyFeatures are the features of the plugin used by groups, which determine the permissions the plugin requires.
+type PolicyFeatures struct {
+	// Volumes attaches existing volumes to instances, such as the data volumes of managers.
+	Volumes bool
+
+	// RestoreVolumes restores missing volumes from snapshots.
+	RestoreVolumes bool
+
+	// Backups snapshots attached volumes with the backup command.
+	Backups bool
+
+	// RootVolumeUpdates replaces the root volumes of instances with the update command.
+	RootVolumeUpdates bool
+
+	Spot                bool
+	WarmPools           bool
+	NetworkInterfaces   bool
+	SubnetTags          bool
+	SecurityGroupNames  bool
+	EdgeLocations       bool
+	Alarms              bool
+	RecoveryAlarms      bool
+	InstanceProfiles    bool
+	TargetGroupARNs     []string
+	TargetHealth        bool
+	DescribeDetails     bool
+	TerminateProtection bool
+}
+
+// RequestFeatures determines the features used by the instance properties of groups.  Volumes attached by flavors
+// and backups are not part of the properties, so they must be added to the features.
+func RequestFeatures(properties ...json.RawMessage) (PolicyFeatures, error) {
+	features := PolicyFeatures{}
+	targetGroups := map[string]bool{}
+	for _, p := range properties {
+		request, err := parseRequest(p)
+		if err != nil {
+			return features, err
+		}
+
+		run := request.RunInstancesInput
+		features.Spot = features.Spot || request.Spot != nil || request.PurchaseMix != nil
+		features.WarmPools = features.WarmPools || request.WarmPool != nil
+		features.NetworkInterfaces = features.NetworkInterfaces || len(request.NetworkInterfaces) > 0 ||
+			request.StaticNetworkInterface || request.Ipv4PrefixCount > 0
+		features.SubnetTags = features.SubnetTags || len(request.SubnetTags) > 0
+		features.SecurityGroupNames = features.SecurityGroupNames || len(request.SecurityGroupNames) > 0
+		features.EdgeLocations = features.EdgeLocations || request.EdgeLocation != nil
+		features.Alarms = features.Alarms || len(request.Alarms.kinds()) > 0
+		features.RecoveryAlarms = features.RecoveryAlarms || (request.Alarms != nil && request.Alarms.Recover)
+		features.InstanceProfiles = features.InstanceProfiles || run.IamInstanceProfile != nil
+		features.RestoreVolumes = features.RestoreVolumes || request.RestoreVolumes
+		features.Volumes = features.Volumes || request.RestoreVolumes
+		for _, source := range request.HealthSources {
+			features.TargetHealth = features.TargetHealth || source == TargetGroupsHealth
+		}
+		for _, arn := range request.TargetGroupARNs {
+			targetGroups[arn] = true
+		}
+	}
+
+	for arn := range targetGroups {
+		features.TargetGroupARNs = append(features.TargetGroupARNs, arn)
+	}
+	sort.Strings(features.TargetGroupARNs)
+	return features, nil
+}
+
+// resourceTagConditions limits the instances an action applies to to those tagged with the namespace of the plugin.
+func resourceTagConditions(namespaceTags map[string]string) map[string]map[string]string {
+	if len(namespaceTags) == 0 {
+		return nil
+	}
+	equals := map[string]string{}
+	for key, value := range namespaceTags {
+		equals["ec2:ResourceTag/"+key] = value
+	}
+	return map[string]map[string]string{"StringEquals": equals}
+}
+
+// queueARN translates the URL of an SQS queue to its ARN.
+func queueARN(queueURL string) (string, error) {
+	parsed, err := url.Parse(queueURL)
+	if err != nil {
+		return "", err
+	}
+	host := strings.Split(parsed.Host, ".")
+	path := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(host) < 2 || host[0] != "sqs" || len(path) != 2 {
+		return "", fmt.Errorf("Unrecognized SQS queue URL %s", queueURL)
+	}
+	return fmt.Sprintf("arn:aws:sqs:%s:%s:%s", host[1], path[0], path[1]), nil
+}
+
+// Policy creates the least-privilege IAM policy of the plugin, for the features used by its groups and the options of
+// the plugin.  Actions that mutate instances are limited to instances tagged with the namespace of the plugin.
+func (b *Builder) Policy(namespaceTags map[string]string, features PolicyFeatures) (PolicyDocument, error) {
+	features.DescribeDetails = features.DescribeDetails || b.options.describeDetails
+	features.TerminateProtection = features.TerminateProtection || b.options.terminateProtected
+	policy := PolicyDocument{Version: "2012-10-17"}
+	add := func(sid string, actions []string, resources []string, condition map[string]map[string]string) {
+		sort.Strings(actions)
+		policy.Statement = append(policy.Statement, PolicyStatement{
+			Sid:       sid,
+			Effect:    "Allow",
+			Action:    actions,
+			Resource:  resources,
+			Condition: condition,
+		})
+	}
+	all := []string{"*"}
+
+	describe := []string{"ec2:DescribeInstances", "ec2:DescribeInstanceStatus", "ec2:DescribeInstanceAttribute"}
+	if features.Spot {
+		describe = append(describe, "ec2:DescribeSpotPriceHistory")
+	}
+	if features.SubnetTags || features.EdgeLocations || features.RestoreVolumes {
+		describe = append(describe, "ec2:DescribeSubnets")
+	}
+	if features.SecurityGroupNames {
+		describe = append(describe, "ec2:DescribeSecurityGroups")
+	}
+	if features.EdgeLocations {
+		describe = append(describe, "ec2:DescribeInstanceTypeOfferings")
+	}
+	if features.NetworkInterfaces || features.DescribeDetails {
+		describe = append(describe, "ec2:DescribeNetworkInterfaces")
+	}
+	if features.Volumes || features.Backups {
+		describe = append(describe, "ec2:DescribeVolumes")
+	}
+	if features.RestoreVolumes || features.Backups {
+		describe = append(describe, "ec2:DescribeSnapshots")
+	}
+	if features.RootVolumeUpdates {
+		describe = append(describe, "ec2:DescribeReplaceRootVolumeTasks")
+	}
+	add("Describe", describe, all, nil)
+
+	add("Launch", []string{"ec2:RunInstances", "ec2:CreateTags"}, all, nil)
+
+	mutate := []string{
+		"ec2:TerminateInstances",
+		"ec2:StopInstances",
+		"ec2:StartInstances",
+		"ec2:RebootInstances",
+		"ec2:DeleteTags",
+	}
+	if features.TerminateProtection || features.WarmPools {
+		mutate = append(mutate, "ec2:ModifyInstanceAttribute")
+	}
+	if features.Volumes {
+		mutate = append(mutate, "ec2:AttachVolume")
+	}
+	add("NamespaceInstances", mutate, all, resourceTagConditions(namespaceTags))
+
+	if features.NetworkInterfaces {
+		add("NetworkInterfaces", []string{
+			"ec2:CreateNetworkInterface",
+			"ec2:AttachNetworkInterface",
+			"ec2:DetachNetworkInterface",
+			"ec2:DeleteNetworkInterface",
+			"ec2:ModifyNetworkInterfaceAttribute",
+		}, all, nil)
+	}
+	if features.RestoreVolumes {
+		add("RestoreVolumes", []string{"ec2:CreateVolume"}, all, nil)
+	}
+	if features.Backups {
+		add("Backups", []string{"ec2:CreateSnapshot", "ec2:DeleteSnapshot"}, all, nil)
+	}
+	if features.RootVolumeUpdates {
+		add("RootVolumeUpdates", []string{"ec2:CreateReplaceRootVolumeTask"}, all, nil)
+	}
+	if features.EdgeLocations {
+		add("Outposts", []string{"outposts:GetOutpostInstanceTypes"}, all, nil)
+	}
+	if features.Spot {
+		add("SpotServiceLinkedRole", []string{"iam:CreateServiceLinkedRole"}, all,
+			map[string]map[string]string{"StringEquals": {"iam:AWSServiceName": "spot.amazonaws.com"}})
+	}
+	if features.InstanceProfiles {
+		add("PassInstanceRoles", []string{"iam:PassRole"}, all,
+			map[string]map[string]string{"StringEquals": {"iam:PassedToService": "ec2.amazonaws.com"}})
+	}
+	if len(features.TargetGroupARNs) > 0 {
+		add("TargetGroups", []string{
+			"elasticloadbalancing:RegisterTargets",
+			"elasticloadbalancing:DeregisterTargets",
+		}, features.TargetGroupARNs, nil)
+	}
+	if features.TargetHealth {
+		add("TargetHealth", []string{"elasticloadbalancing:DescribeTargetHealth"}, all, nil)
+	}
+	if features.Alarms {
+		add("Alarms", []string{"cloudwatch:PutMetricAlarm", "cloudwatch:DeleteAlarms"},
+			[]string{"arn:aws:cloudwatch:*:*:alarm:infrakit-*"}, nil)
+	}
+	if features.RecoveryAlarms {
+		// Alarms with EC2 actions use the service-linked role of CloudWatch Events, created with the first of them.
+		add("RecoveryAlarmsServiceLinkedRole", []string{"iam:CreateServiceLinkedRole"}, all,
+			map[string]map[string]string{"StringEquals": {"iam:AWSServiceName": "events.amazonaws.com"}})
+	}
+
+	region := b.options.region
+	if region == "" {
+		region = "*"
+	}
+	if b.options.lockTable != "" {
+		add("LockTable",
+			[]string{"dynamodb:CreateTable", "dynamodb:DescribeTable", "dynamodb:UpdateItem"},
+			[]string{fmt.Sprintf("arn:aws:dynamodb:%s:*:table/%s", region, b.options.lockTable)},
+			nil)
+	}
+	if b.options.auditLogGroup != "" {
+		add("AuditLog",
+			[]string{"logs:CreateLogStream", "logs:DescribeLogStreams", "logs:PutLogEvents"},
+			[]string{fmt.Sprintf("arn:aws:logs:%s:*:log-group:%s:*", region, b.options.auditLogGroup)},
+			nil)
+	}
+	if b.options.notifyTopicARN != "" {
+		add("Notifications", []string{"sns:Publish"}, []string{b.options.notifyTopicARN}, nil)
+	}
+	if b.options.notifyQueueURL != "" {
+		arn, err := queueARN(b.options.notifyQueueURL)
+		if err != nil {
+			return policy, err
+		}
+		add("Notifications", []string{"sqs:SendMessage"}, []string{arn}, nil)
+	}
+	return policy, nil
+}
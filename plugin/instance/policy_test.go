@@ -0,0 +1,97 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func statement(t *testing.T, policy PolicyDocument, sid string) PolicyStatement {
+	for _, s := range policy.Statement {
+		if s.Sid == sid {
+			return s
+		}
+	}
+	require.Fail(t, "Missing statement "+sid)
+	return PolicyStatement{}
+}
+
+func hasStatement(policy PolicyDocument, sid string) bool {
+	for _, s := range policy.Statement {
+		if s.Sid == sid {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMinimalPolicy(t *testing.T) {
+	features, err := RequestFeatures(json.RawMessage(`{"RunInstancesInput": {"InstanceType": "t3.micro"}}`))
+	require.NoError(t, err)
+
+	policy, err := (&Builder{}).Policy(testNamespace, features)
+	require.NoError(t, err)
+	require.Equal(t, "2012-10-17", policy.Version)
+	require.Equal(t,
+		[]string{"ec2:DescribeInstanceAttribute", "ec2:DescribeInstanceStatus", "ec2:DescribeInstances"},
+		statement(t, policy, "Describe").Action)
+
+	// Mutations are limited to instances in the namespace.
+	namespaced := statement(t, policy, "NamespaceInstances")
+	require.Contains(t, namespaced.Action, "ec2:TerminateInstances")
+	require.Equal(t,
+		map[string]map[string]string{"StringEquals": {"ec2:ResourceTag/cluster": "test", "ec2:ResourceTag/type": "testing"}},
+		namespaced.Condition)
+
+	for _, sid := range []string{
+		"NetworkInterfaces", "TargetGroups", "TargetHealth", "Alarms", "RecoveryAlarmsServiceLinkedRole",
+		"PassInstanceRoles", "LockTable", "RootVolumeUpdates"} {
+		require.False(t, hasStatement(policy, sid), sid)
+	}
+}
+
+func TestPolicyFeatures(t *testing.T) {
+	features, err := RequestFeatures(
+		json.RawMessage(`{
+		  "RunInstancesInput": {"IamInstanceProfile": {"Name": "workers"}},
+		  "Spot": {},
+		  "TargetGroupARNs": ["arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/web/1"],
+		  "Alarms": {"StatusCheckFailed": true, "Recover": true},
+		  "HealthSources": ["target-groups"]
+		}`),
+		json.RawMessage(`{"RestoreVolumes": true, "StaticNetworkInterface": true, "SecurityGroupNames": ["managers"]}`))
+	require.NoError(t, err)
+	require.True(t, features.Volumes)
+	require.True(t, features.SecurityGroupNames)
+	features.RootVolumeUpdates = true
+
+	builder := &Builder{options: options{
+		region:         "us-west-2",
+		lockTable:      "infrakit-locks",
+		notifyQueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/infrakit",
+	}}
+	policy, err := builder.Policy(testNamespace, features)
+	require.NoError(t, err)
+
+	require.Contains(t, statement(t, policy, "Describe").Action, "ec2:DescribeSpotPriceHistory")
+	require.Contains(t, statement(t, policy, "Describe").Action, "ec2:DescribeSnapshots")
+	require.Contains(t, statement(t, policy, "Describe").Action, "ec2:DescribeSecurityGroups")
+	require.Contains(t, statement(t, policy, "NamespaceInstances").Action, "ec2:AttachVolume")
+	require.Equal(t, []string{"ec2:CreateVolume"}, statement(t, policy, "RestoreVolumes").Action)
+	require.Contains(t, statement(t, policy, "Describe").Action, "ec2:DescribeReplaceRootVolumeTasks")
+	require.Equal(t, []string{"ec2:CreateReplaceRootVolumeTask"}, statement(t, policy, "RootVolumeUpdates").Action)
+	require.Equal(t, features.TargetGroupARNs, statement(t, policy, "TargetGroups").Resource)
+	require.Equal(t, []string{"elasticloadbalancing:DescribeTargetHealth"}, statement(t, policy, "TargetHealth").Action)
+	require.Equal(t,
+		[]string{"arn:aws:dynamodb:us-west-2:*:table/infrakit-locks"},
+		statement(t, policy, "LockTable").Resource)
+	require.Equal(t,
+		[]string{"arn:aws:sqs:us-west-2:123456789012:infrakit"},
+		statement(t, policy, "Notifications").Resource)
+	require.Equal(t,
+		map[string]map[string]string{"StringEquals": {"iam:AWSServiceName": "events.amazonaws.com"}},
+		statement(t, policy, "RecoveryAlarmsServiceLinkedRole").Condition)
+	for _, sid := range []string{"NetworkInterfaces", "Alarms", "PassInstanceRoles", "SpotServiceLinkedRole"} {
+		require.True(t, hasStatement(policy, sid), sid)
+	}
+}
@@ -0,0 +1,31 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// specifyPrimaryNetworkInterface moves the subnet, security groups, and private IP address of a launch request into
+// a specification of the primary network interface, since IPv4 prefixes may only be requested for network
+// interfaces.  Requests that already specify network interfaces are unchanged.
+func specifyPrimaryNetworkInterface(input *ec2.RunInstancesInput) error {
+	if len(input.NetworkInterfaces) > 0 {
+		return nil
+	}
+	if len(input.SecurityGroups) > 0 {
+		return errors.New("Ipv4PrefixCount requires SecurityGroupIds rather than SecurityGroups")
+	}
+
+	input.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{{
+		DeviceIndex:         aws.Int64(0),
+		SubnetId:            input.SubnetId,
+		Groups:              input.SecurityGroupIds,
+		PrivateIpAddress:    input.PrivateIpAddress,
+		DeleteOnTermination: aws.Bool(true),
+	}}
+	input.SubnetId = nil
+	input.SecurityGroupIds = nil
+	input.PrivateIpAddress = nil
+	return nil
+}
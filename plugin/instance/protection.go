@@ -0,0 +1,22 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+)
+
+// terminationProtected determines whether a termination request was rejected due to termination protection.
+func terminationProtected(err error) bool {
+	awsErr, is := err.(awserr.Error)
+	return is && awsErr.Code() == "OperationNotPermitted"
+}
+
+func (p awsInstancePlugin) disableTerminationProtection(id instance.ID) error {
+	_, err := p.client.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:            aws.String(string(id)),
+		DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(false)},
+	})
+	return err
+}
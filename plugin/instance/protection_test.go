@@ -0,0 +1,57 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDestroyProtected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	protected := awserr.New("OperationNotPermitted", "The instance may not be terminated", nil)
+	input := &ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("i-1")}}
+
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+
+	// Protected instances are not terminated by default.
+	clientMock.EXPECT().TerminateInstances(input).Return(nil, protected)
+	pluginImpl := &awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+	require.Error(t, pluginImpl.Destroy("i-1"))
+
+	gomock.InOrder(
+		clientMock.EXPECT().TerminateInstances(input).Return(nil, protected),
+		clientMock.EXPECT().ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+			InstanceId:            aws.String("i-1"),
+			DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(false)},
+		}).Return(&ec2.ModifyInstanceAttributeOutput{}, nil),
+		clientMock.EXPECT().TerminateInstances(input).Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("i-1")}}},
+			nil),
+	)
+	pluginImpl.terminateProtected = true
+	require.NoError(t, pluginImpl.Destroy("i-1"))
+}
+
+func TestDestroyRefusedKeepsAttachments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	elbClient := &fakeELB{targets: map[string][]string{"arn:managers": {"i-1"}}}
+	pluginImpl := &awsInstancePlugin{client: clientMock, elb: elbClient, namespaceTags: testNamespace}
+
+	// The instance is neither described to deregister its targets nor are its network interfaces looked up, which
+	// the mock would reject.
+	clientMock.EXPECT().TerminateInstances(gomock.Any()).
+		Return(nil, awserr.New("OperationNotPermitted", "The instance may not be terminated", nil))
+
+	require.Error(t, pluginImpl.Destroy("i-1"))
+	require.Equal(t, []string{"i-1"}, elbClient.targets["arn:managers"])
+}
@@ -0,0 +1,138 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"sync"
+)
+
+const (
+	// PurchaseOptionTag is the AWS tag name used to record whether an instance of a group with a PurchaseMix was
+	// launched on-demand or as a spot instance.
+	PurchaseOptionTag = "infrakit.purchase-option"
+
+	onDemandPurchase = "on-demand"
+	spotPurchase     = "spot"
+)
+
+// PurchaseMix launches a group as a mix of on-demand and spot instances.  Each provision chooses the purchase option
+// that brings the group closest to the mix, so replacements of destroyed or interrupted instances restore it.
+type PurchaseMix struct {
+	// OnDemandBase is the number of instances of the group launched on-demand before the percentage applies.
+	OnDemandBase int `json:",omitempty"`
+
+	// OnDemandPercentage is the percentage of the instances beyond OnDemandBase launched on-demand, with the rest
+	// launched as spot instances with the Spot options of the request.
+	OnDemandPercentage int `json:",omitempty"`
+}
+
+func (m *PurchaseMix) validate() error {
+	if m == nil {
+		return nil
+	}
+	if m.OnDemandBase < 0 {
+		return errors.New("PurchaseMix OnDemandBase must not be negative")
+	}
+	if m.OnDemandPercentage < 0 || m.OnDemandPercentage > 100 {
+		return errors.New("PurchaseMix OnDemandPercentage must be between 0 and 100")
+	}
+	return nil
+}
+
+// onDemandTarget is the number of on-demand instances of a group of a size.
+func (m PurchaseMix) onDemandTarget(size int) int {
+	if size <= m.OnDemandBase {
+		return size
+	}
+	// The on-demand share is rounded up, so that the mix never has fewer on-demand instances than requested.
+	return m.OnDemandBase + (m.OnDemandPercentage*(size-m.OnDemandBase)+99)/100
+}
+
+// instancePurchase is the purchase option of an instance, from its tag or, for instances that were not tagged, its
+// lifecycle.
+func instancePurchase(ec2Instance *ec2.Instance) string {
+	for _, tag := range ec2Instance.Tags {
+		if aws.StringValue(tag.Key) == PurchaseOptionTag {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	if aws.StringValue(ec2Instance.InstanceLifecycle) == ec2.InstanceLifecycleTypeSpot {
+		return spotPurchase
+	}
+	return onDemandPurchase
+}
+
+// purchaseAllocator tracks the purchase options chosen by provisions in progress, so that concurrent provisions of a
+// group converge to its mix rather than all choosing the same option.
+type purchaseAllocator struct {
+	lock     sync.Mutex
+	reserved map[string]map[string]int
+}
+
+func newPurchaseAllocator() *purchaseAllocator {
+	return &purchaseAllocator{reserved: map[string]map[string]int{}}
+}
+
+// allocate chooses the purchase option of an instance joining a group with its instances, and returns a function that
+// releases the reservation of the option.
+func (a *purchaseAllocator) allocate(key string, mix PurchaseMix, instances []*ec2.Instance) (string, func()) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.reserved[key] == nil {
+		a.reserved[key] = map[string]int{}
+	}
+	reserved := a.reserved[key]
+
+	counts := map[string]int{onDemandPurchase: reserved[onDemandPurchase], spotPurchase: reserved[spotPurchase]}
+	for _, ec2Instance := range instances {
+		counts[instancePurchase(ec2Instance)]++
+	}
+
+	size := counts[onDemandPurchase] + counts[spotPurchase] + 1
+	option := spotPurchase
+	if counts[onDemandPurchase] < mix.onDemandTarget(size) {
+		option = onDemandPurchase
+	}
+	reserved[option]++
+
+	return option, func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		reserved[option]--
+	}
+}
+
+// choosePurchase chooses whether an instance being provisioned in a group with a PurchaseMix is launched on-demand or
+// as a spot instance, applying the option to the request.
+func (p awsInstancePlugin) choosePurchase(
+	request *CreateInstanceRequest,
+	tags map[string]string) (string, func(), error) {
+
+	group, has := tags[GroupTag]
+	if !has {
+		return "", nil, errors.New("PurchaseMix may only be applied to instances of a group")
+	}
+	if p.purchases == nil {
+		return "", nil, errors.New("PurchaseMix is not supported by this plugin")
+	}
+
+	instances, err := p.describeInstances(map[string]string{GroupTag: group}, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to look up the purchase options of group %s: %s", group, err)
+	}
+	// Instances launched recently count toward the mix even when they are not yet visible.
+	instances = p.withRecentLaunches(map[string]string{GroupTag: group}, instances)
+
+	option, release := p.purchases.allocate(groupLockKey(tags), *request.PurchaseMix, instances)
+	if option == spotPurchase {
+		if request.Spot == nil {
+			request.Spot = &SpotOptions{}
+		}
+	} else {
+		request.Spot = nil
+	}
+	return option, release, nil
+}
@@ -0,0 +1,134 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func purchaseInstance(option string) *ec2.Instance {
+	return &ec2.Instance{Tags: []*ec2.Tag{{Key: aws.String(PurchaseOptionTag), Value: aws.String(option)}}}
+}
+
+func TestOnDemandTarget(t *testing.T) {
+	mix := PurchaseMix{OnDemandBase: 2, OnDemandPercentage: 30}
+	require.Equal(t, 1, mix.onDemandTarget(1))
+	require.Equal(t, 2, mix.onDemandTarget(2))
+	require.Equal(t, 3, mix.onDemandTarget(3))
+	require.Equal(t, 3, mix.onDemandTarget(5))
+	require.Equal(t, 4, mix.onDemandTarget(6))
+	require.Equal(t, 5, mix.onDemandTarget(12))
+
+	require.Equal(t, 0, PurchaseMix{}.onDemandTarget(10))
+	require.Equal(t, 10, PurchaseMix{OnDemandPercentage: 100}.onDemandTarget(10))
+}
+
+func TestPurchaseAllocation(t *testing.T) {
+	allocator := newPurchaseAllocator()
+	mix := PurchaseMix{OnDemandPercentage: 50}
+
+	// Untagged spot instances are counted by their lifecycle.
+	instances := []*ec2.Instance{
+		purchaseInstance(onDemandPurchase),
+		{InstanceLifecycle: aws.String(ec2.InstanceLifecycleTypeSpot)},
+		{InstanceLifecycle: aws.String(ec2.InstanceLifecycleTypeSpot)},
+	}
+
+	option, release := allocator.allocate("group/workers", mix, instances)
+	require.Equal(t, onDemandPurchase, option)
+
+	// Concurrent provisions count the reserved options.
+	next, releaseNext := allocator.allocate("group/workers", mix, instances)
+	require.Equal(t, onDemandPurchase, next)
+	last, releaseLast := allocator.allocate("group/workers", mix, instances)
+	require.Equal(t, spotPurchase, last)
+	releaseLast()
+	releaseNext()
+
+	release()
+	option, release = allocator.allocate("group/workers", mix, instances)
+	require.Equal(t, onDemandPurchase, option)
+	release()
+
+	// A destroyed on-demand instance is replaced on-demand.
+	option, release = allocator.allocate("group/workers", mix, instances[1:])
+	require.Equal(t, onDemandPurchase, option)
+	release()
+}
+
+func TestProvisionWithPurchaseMix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	clientMock.EXPECT().DescribeInstances(describeGroupRequest(testNamespace, map[string]string{GroupTag: "workers"}, nil)).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+			{Instances: []*ec2.Instance{purchaseInstance(onDemandPurchase), purchaseInstance(spotPurchase)}},
+		}}, nil)
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	properties := json.RawMessage(`{"PurchaseMix": {"OnDemandPercentage": 30}}`)
+	_, err := pluginImpl.Provision(instance.Spec{
+		Properties: &properties,
+		Tags:       map[string]string{GroupTag: "workers", "infrakit.config_sha": "abc"},
+	})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	require.Equal(t, "spot", params.Get("InstanceMarketOptions.MarketType"))
+	option := ""
+	for key, values := range params {
+		if values[0] == PurchaseOptionTag {
+			option = params.Get(key[:len(key)-len("Key")] + "Value")
+		}
+	}
+	require.Equal(t, spotPurchase, option)
+}
+
+func TestPurchaseMixOfInstancesNotYetVisible(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	// Neither instance is visible to DescribeInstances when the next is provisioned.
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil).Times(2)
+
+	markets := []string{}
+	for _, id := range []string{"i-1", "i-2"} {
+		runRequest := fakeRequest(nil)
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String(id)}}})
+
+		properties := json.RawMessage(`{"PurchaseMix": {"OnDemandPercentage": 50}}`)
+		_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: map[string]string{GroupTag: "workers"}})
+		require.NoError(t, err)
+
+		markets = append(markets, requestParams(t, runRequest).Get("InstanceMarketOptions.MarketType"))
+	}
+
+	// The instance launched first counts toward the mix, so the second is a spot instance.
+	require.Equal(t, []string{"", "spot"}, markets)
+}
+
+func TestPurchaseMixValidation(t *testing.T) {
+	_, err := parseRequest(json.RawMessage(`{"PurchaseMix": {"OnDemandPercentage": 101}}`))
+	require.Error(t, err)
+
+	_, err = parseRequest(json.RawMessage(`{"PurchaseMix": {"OnDemandBase": -1}}`))
+	require.Error(t, err)
+
+	_, err = parseRequest(json.RawMessage(`{"PurchaseMix": {"OnDemandBase": 1, "OnDemandPercentage": 30}}`))
+	require.NoError(t, err)
+}
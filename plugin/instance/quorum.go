@@ -0,0 +1,94 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"strconv"
+	"strings"
+)
+
+// quorumGuard refuses to destroy instances of manager groups when doing so would leave fewer live managers than a
+// quorum, such as when a partial outage has already stopped some of them and the group plugin replaces the rest.
+type quorumGuard struct {
+	// groups are the expected sizes of the manager groups, by group name.
+	groups map[string]int
+
+	// force destroys managers below quorum, with a warning rather than an error.
+	force bool
+}
+
+// parseQuorumGroups parses a list of group=size manager groups.
+func parseQuorumGroups(groupSizes []string) (map[string]int, error) {
+	groups := map[string]int{}
+	for _, groupSize := range groupSizes {
+		nameAndSize := strings.Split(groupSize, "=")
+		if len(nameAndSize) != 2 {
+			return nil, fmt.Errorf("Quorum groups must be formatted as group=size: %s", groupSize)
+		}
+		size, err := strconv.Atoi(nameAndSize[1])
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("Quorum group %s must have a positive size", nameAndSize[0])
+		}
+		groups[nameAndSize[0]] = size
+	}
+	return groups, nil
+}
+
+// quorum is the number of live members of a group of a size that must remain.
+func quorum(size int) int {
+	return size/2 + 1
+}
+
+// checkQuorum returns an error if destroying an instance of a manager group would drop the live instances of the group
+// below quorum.  The members of a group are its instances that are not terminated, or its expected size if larger, and
+// the live members are those running.
+func (p awsInstancePlugin) checkQuorum(id instance.ID) error {
+	if p.quorum == nil {
+		return nil
+	}
+
+	ec2Instance, err := p.describeInstance(id)
+	if err != nil {
+		// An instance that cannot be described is left to Destroy to report.
+		return nil
+	}
+	group := ""
+	for _, tag := range ec2Instance.Tags {
+		if aws.StringValue(tag.Key) == GroupTag {
+			group = aws.StringValue(tag.Value)
+		}
+	}
+	size, managed := p.quorum.groups[group]
+	if !managed || ec2Instance.State == nil || aws.StringValue(ec2Instance.State.Name) != ec2.InstanceStateNameRunning {
+		return nil
+	}
+
+	members, err := p.describeInstances(map[string]string{GroupTag: group}, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to count the live instances of group %s: %s", group, err)
+	}
+	live := 0
+	for _, member := range members {
+		if member.State != nil && aws.StringValue(member.State.Name) == ec2.InstanceStateNameRunning {
+			live++
+		}
+	}
+	if len(members) > size {
+		size = len(members)
+	}
+
+	if live-1 >= quorum(size) {
+		return nil
+	}
+	if p.quorum.force {
+		log.Warnf("Destroying instance %s leaves %d of %d instances of group %s live, below quorum", id, live-1, size, group)
+		return nil
+	}
+	return fmt.Errorf(
+		"Destroying instance %s would leave %d of %d instances of group %s live, below a quorum of %d, "+
+			"and may only be forced with --force-quorum-destroy",
+		id, live-1, size, group, quorum(size))
+}
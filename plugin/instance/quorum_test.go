@@ -0,0 +1,107 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func managerInstance(id, state string) *ec2.Instance {
+	return &ec2.Instance{
+		InstanceId: aws.String(id),
+		State:      &ec2.InstanceState{Name: aws.String(state)},
+		Tags:       []*ec2.Tag{{Key: aws.String(GroupTag), Value: aws.String("managers")}},
+	}
+}
+
+func TestParseQuorumGroups(t *testing.T) {
+	groups, err := parseQuorumGroups([]string{"managers=3"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"managers": 3}, groups)
+
+	_, err = parseQuorumGroups([]string{"managers"})
+	require.Error(t, err)
+	_, err = parseQuorumGroups([]string{"managers=0"})
+	require.Error(t, err)
+}
+
+func TestDestroyBelowQuorum(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := &awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		quorum:        &quorumGuard{groups: map[string]int{"managers": 3}},
+	}
+
+	describe := func(members ...*ec2.Instance) {
+		clientMock.EXPECT().DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String("i-1")}}).
+			Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: members[:1]}}}, nil)
+		groupRequest := describeGroupRequest(testNamespace, map[string]string{GroupTag: "managers"}, nil)
+		clientMock.EXPECT().DescribeInstances(groupRequest).
+			Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: members}}}, nil)
+	}
+
+	// One of three managers is stopped, so destroying another would lose quorum.
+	describe(
+		managerInstance("i-1", ec2.InstanceStateNameRunning),
+		managerInstance("i-2", ec2.InstanceStateNameRunning),
+		managerInstance("i-3", ec2.InstanceStateNameStopped))
+	require.Error(t, pluginImpl.Destroy("i-1"))
+
+	// Instances beyond the expected size of the group raise the quorum.
+	describe(
+		managerInstance("i-1", ec2.InstanceStateNameRunning),
+		managerInstance("i-2", ec2.InstanceStateNameRunning),
+		managerInstance("i-3", ec2.InstanceStateNameRunning),
+		managerInstance("i-4", ec2.InstanceStateNameStopped),
+		managerInstance("i-5", ec2.InstanceStateNameStopped))
+	require.Error(t, pluginImpl.Destroy("i-1"))
+
+	// Forced destructions proceed below quorum.
+	describe(
+		managerInstance("i-1", ec2.InstanceStateNameRunning),
+		managerInstance("i-2", ec2.InstanceStateNameRunning),
+		managerInstance("i-3", ec2.InstanceStateNameStopped))
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("i-1")}}).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("i-1")}}},
+			nil)
+	pluginImpl.quorum.force = true
+	require.NoError(t, pluginImpl.Destroy("i-1"))
+}
+
+func TestDestroyWithQuorum(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := &awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		quorum:        &quorumGuard{groups: map[string]int{"managers": 3}},
+	}
+
+	members := []*ec2.Instance{
+		managerInstance("i-1", ec2.InstanceStateNameRunning),
+		managerInstance("i-2", ec2.InstanceStateNameRunning),
+		managerInstance("i-3", ec2.InstanceStateNameRunning),
+	}
+	clientMock.EXPECT().DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String("i-1")}}).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: members[:1]}}}, nil)
+	groupRequest := describeGroupRequest(testNamespace, map[string]string{GroupTag: "managers"}, nil)
+	clientMock.EXPECT().DescribeInstances(groupRequest).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: members}}}, nil)
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("i-1")}}).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("i-1")}}},
+			nil)
+	require.NoError(t, pluginImpl.Destroy("i-1"))
+}
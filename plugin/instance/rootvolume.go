@@ -0,0 +1,87 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	"github.com/docker/infrakit/spi/instance"
+	"time"
+)
+
+// rootVolumePollInterval is how often a root volume replacement is checked for completion.
+var rootVolumePollInterval = 10 * time.Second
+
+// rootVolumeAPI is the part of the EC2 API used to replace the root volumes of instances, which the vendored SDK does
+// not model.
+type rootVolumeAPI interface {
+	CreateReplaceRootVolumeTask(
+		input *ec2ext.CreateReplaceRootVolumeTaskInput) (*ec2ext.CreateReplaceRootVolumeTaskOutput, error)
+	DescribeReplaceRootVolumeTasks(
+		input *ec2ext.DescribeReplaceRootVolumeTasksInput) (*ec2ext.DescribeReplaceRootVolumeTasksOutput, error)
+}
+
+// replacesRootVolume determines whether an outdated instance is updated by replacing its root volume rather than the
+// instance.  Only the image of a root volume may be replaced, so instances of another instance type are replaced.
+func replacesRootVolume(ec2Instance *ec2.Instance, request CreateInstanceRequest, options UpdateOptions) bool {
+	run := request.RunInstancesInput
+	if !options.ReplaceRootVolume || run.ImageId == nil {
+		return false
+	}
+	return run.InstanceType == nil || aws.StringValue(ec2Instance.InstanceType) == *run.InstanceType
+}
+
+// replaceRootVolume restores the root volume of an instance from an image, deleting the replaced volume, and waits
+// for the instance to pass its status checks after it reboots.  The instance keeps its ID, network interfaces,
+// addresses, and other volumes.
+func (p awsInstancePlugin) replaceRootVolume(ec2Instance *ec2.Instance, imageID string, timeout time.Duration) error {
+	if p.rootVolumes == nil {
+		return errors.New("Root volume replacement is not supported by this plugin")
+	}
+
+	id := instance.ID(*ec2Instance.InstanceId)
+	deadline := time.Now().Add(timeout)
+
+	// The client token makes retries of an update reuse the replacement of the instance with the image.
+	created, err := p.rootVolumes.CreateReplaceRootVolumeTask(&ec2ext.CreateReplaceRootVolumeTaskInput{
+		InstanceId:               ec2Instance.InstanceId,
+		ImageId:                  aws.String(imageID),
+		DeleteReplacedRootVolume: aws.Bool(true),
+		ClientToken:              aws.String(fmt.Sprintf("%s-%s", id, imageID)),
+	})
+	if err != nil {
+		return err
+	}
+	if created.ReplaceRootVolumeTask == nil {
+		return errors.New("Unexpected AWS API response")
+	}
+	taskID := created.ReplaceRootVolumeTask.ReplaceRootVolumeTaskId
+	log.Infof("Replacing root volume of instance %s with image %s (%s)", id, imageID, aws.StringValue(taskID))
+
+	for {
+		tasks, err := p.rootVolumes.DescribeReplaceRootVolumeTasks(&ec2ext.DescribeReplaceRootVolumeTasksInput{
+			ReplaceRootVolumeTaskIds: []*string{taskID},
+		})
+		if err != nil {
+			return err
+		}
+
+		state := ""
+		for _, task := range tasks.ReplaceRootVolumeTasks {
+			state = aws.StringValue(task.TaskState)
+		}
+		switch state {
+		case ec2ext.ReplaceRootVolumeTaskStateSucceeded:
+			return p.waitHealthy(id, deadline.Sub(time.Now()))
+		case ec2ext.ReplaceRootVolumeTaskStateFailed, ec2ext.ReplaceRootVolumeTaskStateFailedDetached:
+			return fmt.Errorf("Replacement of the root volume of instance %s %s", id, state)
+		}
+
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("Root volume of instance %s was not replaced within %s", id, timeout)
+		}
+		time.Sleep(rootVolumePollInterval)
+	}
+}
@@ -0,0 +1,176 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	awsinstance "github.com/docker/infrakit.aws/plugin/instance"
+	instance_rpc "github.com/docker/infrakit/rpc/instance"
+	"github.com/docker/infrakit/spi/instance"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"sync"
+)
+
+// NewClient returns a client of a remote instance plugin, which implements instance.Plugin, Batcher, and Planner.
+func NewClient(protocol, addr string) (*Client, error) {
+	conn, err := net.Dial(protocol, addr)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(conn), nil
+}
+
+func newClient(conn io.ReadWriteCloser) *Client {
+	return &Client{rpc: jsonrpc.NewClient(conn)}
+}
+
+// Client is a client of a remote instance plugin.  Batches are sent with the batch RPCs if the server serves them,
+// and otherwise provisioned and destroyed with an RPC for each instance.
+type Client struct {
+	rpc *rpc.Client
+
+	lock       sync.Mutex
+	negotiated bool
+	api        APIVersionResponse
+}
+
+// Validate performs local validation on a provision request.
+func (c *Client) Validate(properties json.RawMessage) error {
+	req := &instance_rpc.ValidateRequest{Properties: properties}
+	resp := &instance_rpc.ValidateResponse{}
+	return c.rpc.Call("Instance.Validate", req, resp)
+}
+
+// Provision creates a new instance based on the spec.
+func (c *Client) Provision(spec instance.Spec) (*instance.ID, error) {
+	req := &instance_rpc.ProvisionRequest{Spec: spec}
+	resp := &instance_rpc.ProvisionResponse{}
+	if err := c.rpc.Call("Instance.Provision", req, resp); err != nil {
+		return nil, err
+	}
+	return resp.ID, nil
+}
+
+// Destroy terminates an existing instance.
+func (c *Client) Destroy(instance instance.ID) error {
+	req := &instance_rpc.DestroyRequest{Instance: instance}
+	resp := &instance_rpc.DestroyResponse{}
+	return c.rpc.Call("Instance.Destroy", req, resp)
+}
+
+// DescribeInstances returns descriptions of all instances matching all of the provided tags.
+func (c *Client) DescribeInstances(tags map[string]string) ([]instance.Description, error) {
+	req := &instance_rpc.DescribeInstancesRequest{Tags: tags}
+	resp := &instance_rpc.DescribeInstancesResponse{}
+	if err := c.rpc.Call("Instance.DescribeInstances", req, resp); err != nil {
+		return nil, err
+	}
+	return resp.Descriptions, nil
+}
+
+// Close closes the connection to the plugin.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// negotiate negotiates the API with the server once, determining the RPCs it serves.  Servers without the APIVersion
+// RPC serve the InfraKit API alone.
+func (c *Client) negotiate() (APIVersionResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.negotiated {
+		return c.api, nil
+	}
+
+	resp := &APIVersionResponse{}
+	err := c.rpc.Call("Instance.APIVersion", &APIVersionRequest{}, resp)
+	if _, is := err.(rpc.ServerError); is && strings.Contains(err.Error(), "can't find") {
+		log.Debugf("Instance plugin does not negotiate its API, batches are sent an instance at a time")
+		err = nil
+	} else if err != nil {
+		return APIVersionResponse{}, err
+	}
+
+	c.negotiated = true
+	c.api = *resp
+	return c.api, nil
+}
+
+// supportsBatch determines whether the server serves the batch RPCs.
+func (c *Client) supportsBatch() (bool, error) {
+	api, err := c.negotiate()
+	return api.Batch, err
+}
+
+// failedBatch reports the failure of a batch for each of its instances, which are identified if they exist.
+func failedBatch(size int, ids []instance.ID, err error) []awsinstance.BatchResult {
+	results := []awsinstance.BatchResult{}
+	for i := 0; i < size; i++ {
+		result := awsinstance.BatchResult{Error: err.Error()}
+		if i < len(ids) {
+			result.ID = &ids[i]
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ProvisionBatch implements Batcher.ProvisionBatch.
+func (c *Client) ProvisionBatch(specs []instance.Spec) []awsinstance.BatchResult {
+	batch, err := c.supportsBatch()
+	if err != nil {
+		return failedBatch(len(specs), nil, err)
+	}
+	if !batch {
+		return awsinstance.ProvisionEach(c, specs)
+	}
+
+	resp := &ProvisionBatchResponse{}
+	if err := c.rpc.Call("Instance.ProvisionBatch", &ProvisionBatchRequest{Specs: specs}, resp); err != nil {
+		return failedBatch(len(specs), nil, err)
+	}
+	return resp.Results
+}
+
+// DestroyBatch implements Batcher.DestroyBatch.
+func (c *Client) DestroyBatch(ids []instance.ID) []awsinstance.BatchResult {
+	batch, err := c.supportsBatch()
+	if err != nil {
+		return failedBatch(len(ids), ids, err)
+	}
+	if !batch {
+		return awsinstance.DestroyEach(c, ids)
+	}
+
+	resp := &DestroyBatchResponse{}
+	if err := c.rpc.Call("Instance.DestroyBatch", &DestroyBatchRequest{Instances: ids}, resp); err != nil {
+		return failedBatch(len(ids), ids, err)
+	}
+	return resp.Results
+}
+
+// Plan implements Planner.Plan.
+func (c *Client) Plan(
+	tags map[string]string,
+	properties json.RawMessage,
+	options awsinstance.PlanOptions) ([]awsinstance.PlannedChange, error) {
+
+	api, err := c.negotiate()
+	if err != nil {
+		return nil, err
+	}
+	if !api.Plan {
+		return nil, errors.New("Instance plugin does not support plans")
+	}
+
+	resp := &PlanResponse{}
+	req := &PlanRequest{Tags: tags, Properties: properties, Options: options}
+	if err := c.rpc.Call("Instance.Plan", req, resp); err != nil {
+		return nil, err
+	}
+	return resp.Changes, nil
+}
@@ -0,0 +1,172 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	awsinstance "github.com/docker/infrakit.aws/plugin/instance"
+	instance_rpc "github.com/docker/infrakit/rpc/instance"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"testing"
+)
+
+// fakePlugin provisions instances named after the Name tag of their specs, failing specs without one.
+type fakePlugin struct {
+	lock       sync.Mutex
+	provisions int
+	destroyed  []instance.ID
+	batches    int
+}
+
+func (f *fakePlugin) Validate(properties json.RawMessage) error {
+	return nil
+}
+
+func (f *fakePlugin) Provision(spec instance.Spec) (*instance.ID, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.provisions++
+	name, has := spec.Tags["Name"]
+	if !has {
+		return nil, errors.New("No name")
+	}
+	id := instance.ID(fmt.Sprintf("i-%s", name))
+	return &id, nil
+}
+
+func (f *fakePlugin) Destroy(id instance.ID) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.destroyed = append(f.destroyed, id)
+	return nil
+}
+
+func (f *fakePlugin) DescribeInstances(tags map[string]string) ([]instance.Description, error) {
+	return []instance.Description{{ID: "i-a", Tags: tags}}, nil
+}
+
+// fakeBatcher provisions batches itself.
+type fakeBatcher struct {
+	fakePlugin
+}
+
+func (f *fakeBatcher) ProvisionBatch(specs []instance.Spec) []awsinstance.BatchResult {
+	f.batches++
+	return awsinstance.ProvisionEach(&f.fakePlugin, specs)
+}
+
+func (f *fakeBatcher) DestroyBatch(ids []instance.ID) []awsinstance.BatchResult {
+	f.batches++
+	return awsinstance.DestroyEach(&f.fakePlugin, ids)
+}
+
+// fakePlanner plans to create an instance for each group.
+type fakePlanner struct {
+	fakePlugin
+}
+
+func (f *fakePlanner) Plan(
+	tags map[string]string,
+	properties json.RawMessage,
+	options awsinstance.PlanOptions) ([]awsinstance.PlannedChange, error) {
+
+	return []awsinstance.PlannedChange{{Action: awsinstance.PlanCreate, Reason: tags["group"]}}, nil
+}
+
+// serve connects a client to a server of a service.
+func serve(t *testing.T, service interface{}) *Client {
+	server := rpc.NewServer()
+	require.NoError(t, server.Register(service))
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeCodec(jsonrpc.NewServerCodec(serverConn))
+	return newClient(clientConn)
+}
+
+func specs(names ...string) []instance.Spec {
+	specs := []instance.Spec{}
+	for _, name := range names {
+		tags := map[string]string{"group": "workers"}
+		if name != "" {
+			tags["Name"] = name
+		}
+		specs = append(specs, instance.Spec{Tags: tags})
+	}
+	return specs
+}
+
+func requireResults(t *testing.T, results []awsinstance.BatchResult) {
+	require.Len(t, results, 3)
+	require.Equal(t, instance.ID("i-a"), *results[0].ID)
+	require.Nil(t, results[1].ID)
+	require.Equal(t, "No name", results[1].Error)
+	require.Equal(t, instance.ID("i-c"), *results[2].ID)
+	require.Empty(t, results[2].Error)
+}
+
+func TestBatchRPCs(t *testing.T) {
+	plugin := &fakeBatcher{}
+	client := serve(t, PluginServer(plugin))
+	defer client.Close()
+
+	requireResults(t, client.ProvisionBatch(specs("a", "", "c")))
+
+	results := client.DestroyBatch([]instance.ID{"i-a", "i-c"})
+	require.Len(t, results, 2)
+	require.Equal(t, instance.ID("i-c"), *results[1].ID)
+	require.Equal(t, []instance.ID{"i-a", "i-c"}, plugin.destroyed)
+	require.Equal(t, 2, plugin.batches)
+
+	// The RPCs of InfraKit instance plugins are served alongside the batch RPCs.
+	id, err := client.Provision(specs("d")[0])
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("i-d"), *id)
+	descriptions, err := client.DescribeInstances(map[string]string{"group": "workers"})
+	require.NoError(t, err)
+	require.Len(t, descriptions, 1)
+	require.NoError(t, client.Validate(json.RawMessage(`{}`)))
+}
+
+func TestBatchRPCsWithoutBatcher(t *testing.T) {
+	plugin := &fakePlugin{}
+	client := serve(t, PluginServer(plugin))
+	defer client.Close()
+
+	requireResults(t, client.ProvisionBatch(specs("a", "", "c")))
+	require.Equal(t, 3, plugin.provisions)
+}
+
+func TestBatchesWithoutNegotiation(t *testing.T) {
+	// Servers of InfraKit instance plugins are sent an RPC for each instance of a batch.
+	plugin := &fakeBatcher{}
+	client := serve(t, instance_rpc.PluginServer(plugin))
+	defer client.Close()
+
+	requireResults(t, client.ProvisionBatch(specs("a", "", "c")))
+	require.Len(t, client.DestroyBatch([]instance.ID{"i-a"}), 1)
+	require.Equal(t, 3, plugin.provisions)
+	require.Equal(t, []instance.ID{"i-a"}, plugin.destroyed)
+	require.Equal(t, 0, plugin.batches)
+}
+
+func TestPlanRPC(t *testing.T) {
+	client := serve(t, PluginServer(&fakePlanner{}))
+	defer client.Close()
+
+	changes, err := client.Plan(map[string]string{"group": "workers"}, json.RawMessage(`{}`), awsinstance.PlanOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []awsinstance.PlannedChange{{Action: awsinstance.PlanCreate, Reason: "workers"}}, changes)
+
+	// Plans fail without being sent when the plugin does not plan.
+	for _, service := range []interface{}{PluginServer(&fakePlugin{}), instance_rpc.PluginServer(&fakePlugin{})} {
+		client := serve(t, service)
+		defer client.Close()
+		_, err := client.Plan(map[string]string{}, json.RawMessage(`{}`), awsinstance.PlanOptions{})
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"errors"
+	awsinstance "github.com/docker/infrakit.aws/plugin/instance"
+	instance_rpc "github.com/docker/infrakit/rpc/instance"
+	"github.com/docker/infrakit/spi/instance"
+)
+
+// PluginServer returns the RPC service of an instance plugin, which conforms to the net/rpc call convention.
+func PluginServer(p instance.Plugin) *Instance {
+	return &Instance{RPCService: instance_rpc.PluginServer(p), plugin: p}
+}
+
+// Instance is the JSON RPC service of the instance plugin.  It serves the RPCs of InfraKit instance plugins, under
+// the same service name, along with batch and plan RPCs.  It must be exported in order to be registered by the rpc server
+// package.
+type Instance struct {
+	instance_rpc.RPCService
+	plugin instance.Plugin
+}
+
+// APIVersion reports the version of the API, for clients to negotiate the RPCs they use.
+func (p *Instance) APIVersion(req *APIVersionRequest, resp *APIVersionResponse) error {
+	resp.Version = APIVersion
+	resp.Batch = true
+	_, resp.Plan = p.plugin.(awsinstance.Planner)
+	return nil
+}
+
+// ProvisionBatch creates an instance for each spec.  Plugins that do not provision batches themselves provision each
+// instance separately.
+func (p *Instance) ProvisionBatch(req *ProvisionBatchRequest, resp *ProvisionBatchResponse) error {
+	if batcher, is := p.plugin.(awsinstance.Batcher); is {
+		resp.Results = batcher.ProvisionBatch(req.Specs)
+	} else {
+		resp.Results = awsinstance.ProvisionEach(p.plugin, req.Specs)
+	}
+	return nil
+}
+
+// DestroyBatch terminates existing instances.  Plugins that do not destroy batches themselves destroy each instance
+// separately.
+func (p *Instance) DestroyBatch(req *DestroyBatchRequest, resp *DestroyBatchResponse) error {
+	if batcher, is := p.plugin.(awsinstance.Batcher); is {
+		resp.Results = batcher.DestroyBatch(req.Instances)
+	} else {
+		resp.Results = awsinstance.DestroyEach(p.plugin, req.Instances)
+	}
+	return nil
+}
+
+// Plan reports the changes of instances that a proposed change of a group would make, without changing them.
+func (p *Instance) Plan(req *PlanRequest, resp *PlanResponse) error {
+	planner, is := p.plugin.(awsinstance.Planner)
+	if !is {
+		return errors.New("Instance plugin does not support plans")
+	}
+	changes, err := planner.Plan(req.Tags, req.Properties, req.Options)
+	if err != nil {
+		return err
+	}
+	resp.Changes = changes
+	return nil
+}
@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"encoding/json"
+	awsinstance "github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit/spi/instance"
+)
+
+// APIVersion is the version of the RPC API of the plugin, which extends the API of InfraKit instance plugins with
+// batch and plan RPCs.  Servers without the APIVersion RPC serve only the InfraKit API.
+const APIVersion = "infrakit.aws/Instance/1"
+
+// APIVersionRequest is the rpc wrapper for the APIVersion request
+type APIVersionRequest struct {
+}
+
+// APIVersionResponse is the rpc wrapper for the APIVersion response
+type APIVersionResponse struct {
+	Version string
+
+	// Batch reports that the server serves ProvisionBatch and DestroyBatch.
+	Batch bool
+
+	// Plan reports that the server serves Plan.
+	Plan bool
+}
+
+// ProvisionBatchRequest is the rpc wrapper for the ProvisionBatch request
+type ProvisionBatchRequest struct {
+	Specs []instance.Spec
+}
+
+// ProvisionBatchResponse is the rpc wrapper for the ProvisionBatch response
+type ProvisionBatchResponse struct {
+	Results []awsinstance.BatchResult
+}
+
+// DestroyBatchRequest is the rpc wrapper for the DestroyBatch request
+type DestroyBatchRequest struct {
+	Instances []instance.ID
+}
+
+// DestroyBatchResponse is the rpc wrapper for the DestroyBatch response
+type DestroyBatchResponse struct {
+	Results []awsinstance.BatchResult
+}
+
+// PlanRequest is the rpc wrapper for the Plan request
+type PlanRequest struct {
+	Tags       map[string]string
+	Properties json.RawMessage
+	Options    awsinstance.PlanOptions
+}
+
+// PlanResponse is the rpc wrapper for the Plan response
+type PlanResponse struct {
+	Changes []awsinstance.PlannedChange
+}
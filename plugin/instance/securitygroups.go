@@ -0,0 +1,65 @@
+package instance
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// applySecurityGroupNames adds the security groups named by the SecurityGroupNames of a request to the security groups
+// of its instance.  The groups are those of the namespace of the plugin provisioned with the names as logical IDs,
+// such as by the security group plugin.
+func (p awsInstancePlugin) applySecurityGroupNames(request *CreateInstanceRequest) error {
+	if len(request.SecurityGroupNames) == 0 {
+		return nil
+	}
+
+	keys, tags := mergeTags(p.namespaceTags)
+	filters := []*ec2.Filter{{
+		Name:   aws.String(fmt.Sprintf("tag:%s", LogicalIDTag)),
+		Values: aws.StringSlice(request.SecurityGroupNames),
+	}}
+	for _, key := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", key)),
+			Values: []*string{aws.String(tags[key])},
+		})
+	}
+	result, err := p.client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{Filters: filters})
+	if err != nil {
+		return fmt.Errorf("Failed to look up SecurityGroupNames: %s", err)
+	}
+
+	named := map[string][]*string{}
+	for _, group := range result.SecurityGroups {
+		for _, tag := range group.Tags {
+			if aws.StringValue(tag.Key) == LogicalIDTag {
+				named[aws.StringValue(tag.Value)] = append(named[aws.StringValue(tag.Value)], group.GroupId)
+			}
+		}
+	}
+
+	ids := []*string{}
+	for _, name := range request.SecurityGroupNames {
+		switch len(named[name]) {
+		case 0:
+			return fmt.Errorf("No security group is named %s", name)
+		case 1:
+			ids = append(ids, named[name][0])
+		default:
+			return fmt.Errorf("Security group name %s is ambiguous, matching %d groups", name, len(named[name]))
+		}
+	}
+
+	run := &request.RunInstancesInput
+	if len(run.NetworkInterfaces) > 0 {
+		networkInterface := *run.NetworkInterfaces[0]
+		networkInterface.Groups = append(append([]*string{}, networkInterface.Groups...), ids...)
+		run.NetworkInterfaces = append(
+			[]*ec2.InstanceNetworkInterfaceSpecification{&networkInterface},
+			run.NetworkInterfaces[1:]...)
+	} else {
+		run.SecurityGroupIds = append(append([]*string{}, run.SecurityGroupIds...), ids...)
+	}
+	return nil
+}
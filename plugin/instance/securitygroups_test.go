@@ -0,0 +1,67 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func namedSecurityGroup(id, name string) *ec2.SecurityGroup {
+	return &ec2.SecurityGroup{
+		GroupId: aws.String(id),
+		Tags:    []*ec2.Tag{{Key: aws.String(LogicalIDTag), Value: aws.String(name)}},
+	}
+}
+
+func TestApplySecurityGroupNames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(*awsInstancePlugin)
+
+	describe := &ec2.DescribeSecurityGroupsInput{Filters: []*ec2.Filter{
+		{Name: aws.String("tag:infrakit.logical-id"), Values: aws.StringSlice([]string{"managers", "edge"})},
+		{Name: aws.String("tag:cluster"), Values: []*string{aws.String("test")}},
+		{Name: aws.String("tag:type"), Values: []*string{aws.String("testing")}},
+	}}
+	clientMock.EXPECT().DescribeSecurityGroups(describe).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{namedSecurityGroup("sg-edge", "edge"), namedSecurityGroup("sg-m", "managers")},
+	}, nil).Times(2)
+
+	// The groups are added to those of the request, in the order they are named.
+	request := CreateInstanceRequest{
+		SecurityGroupNames: []string{"managers", "edge"},
+		RunInstancesInput:  ec2.RunInstancesInput{SecurityGroupIds: aws.StringSlice([]string{"sg-base"})},
+	}
+	require.NoError(t, pluginImpl.applySecurityGroupNames(&request))
+	require.Equal(t, []string{"sg-base", "sg-m", "sg-edge"},
+		aws.StringValueSlice(request.RunInstancesInput.SecurityGroupIds))
+
+	// Requests with network interfaces add the groups to the primary interface.
+	request = CreateInstanceRequest{
+		SecurityGroupNames: []string{"managers", "edge"},
+		RunInstancesInput: ec2.RunInstancesInput{
+			NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{{DeviceIndex: aws.Int64(0)}},
+		},
+	}
+	require.NoError(t, pluginImpl.applySecurityGroupNames(&request))
+	require.Equal(t, []string{"sg-m", "sg-edge"},
+		aws.StringValueSlice(request.RunInstancesInput.NetworkInterfaces[0].Groups))
+	require.Empty(t, request.RunInstancesInput.SecurityGroupIds)
+
+	// Names of more than one group are ambiguous.
+	clientMock.EXPECT().DescribeSecurityGroups(gomock.Any()).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{namedSecurityGroup("sg-m", "managers"), namedSecurityGroup("sg-n", "managers")},
+	}, nil)
+	request = CreateInstanceRequest{SecurityGroupNames: []string{"managers"}}
+	require.Error(t, pluginImpl.applySecurityGroupNames(&request))
+
+	// Names of no group are not found.
+	clientMock.EXPECT().DescribeSecurityGroups(gomock.Any()).Return(&ec2.DescribeSecurityGroupsOutput{}, nil)
+	request = CreateInstanceRequest{SecurityGroupNames: []string{"unknown"}}
+	require.Error(t, pluginImpl.applySecurityGroupNames(&request))
+}
@@ -0,0 +1,83 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"strconv"
+	"sync"
+)
+
+const (
+	// SlotTag is the AWS tag name used to record the slot of an instance in a group that assigns slots.
+	SlotTag = "infrakit.slot"
+)
+
+// slotAllocator tracks the slots being assigned by provisions in progress.  An instance is only tagged with its slot
+// once it is launched, so concurrent provisions of a group would otherwise choose the same free slot.
+type slotAllocator struct {
+	lock     sync.Mutex
+	reserved map[string]map[int]bool
+}
+
+func newSlotAllocator() *slotAllocator {
+	return &slotAllocator{reserved: map[string]map[int]bool{}}
+}
+
+// allocate reserves the lowest slot of a group that is neither used by one of its instances nor reserved by another
+// provision, and returns a function that releases the reservation.
+func (a *slotAllocator) allocate(key string, instances []*ec2.Instance) (int, func()) {
+	used := map[int]bool{}
+	for _, ec2Instance := range instances {
+		for _, tag := range ec2Instance.Tags {
+			if aws.StringValue(tag.Key) != SlotTag {
+				continue
+			}
+			if slot, err := strconv.Atoi(aws.StringValue(tag.Value)); err == nil {
+				used[slot] = true
+			}
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.reserved[key] == nil {
+		a.reserved[key] = map[int]bool{}
+	}
+	reserved := a.reserved[key]
+
+	slot := 0
+	for used[slot] || reserved[slot] {
+		slot++
+	}
+	reserved[slot] = true
+
+	return slot, func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		delete(reserved, slot)
+	}
+}
+
+// allocateSlot chooses the slot of an instance being provisioned in a group.  Instances being terminated have freed
+// their slots, so a replacement reuses the slot of the instance it replaces.
+func (p awsInstancePlugin) allocateSlot(tags map[string]string) (string, func(), error) {
+	group, has := tags[GroupTag]
+	if !has {
+		return "", nil, errors.New("Slots may only be assigned to instances of a group")
+	}
+	if p.slots == nil {
+		return "", nil, errors.New("Slots are not supported by this plugin")
+	}
+
+	// Instances launched recently hold their slots even when they are not yet visible.
+	instances, err := p.describeInstances(map[string]string{GroupTag: group}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	instances = p.withRecentLaunches(map[string]string{GroupTag: group}, instances)
+
+	slot, release := p.slots.allocate(groupLockKey(tags), instances)
+	return strconv.Itoa(slot), release, nil
+}
@@ -0,0 +1,114 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func slotInstance(slot string) *ec2.Instance {
+	return &ec2.Instance{Tags: []*ec2.Tag{{Key: aws.String(SlotTag), Value: aws.String(slot)}}}
+}
+
+func TestSlotAllocation(t *testing.T) {
+	allocator := newSlotAllocator()
+	instances := []*ec2.Instance{slotInstance("0"), slotInstance("2"), {}}
+
+	slot, release := allocator.allocate("group/workers", instances)
+	require.Equal(t, 1, slot)
+
+	// A concurrent provision skips the reserved slot.
+	next, releaseNext := allocator.allocate("group/workers", instances)
+	require.Equal(t, 3, next)
+	releaseNext()
+
+	other, releaseOther := allocator.allocate("group/managers", instances)
+	require.Equal(t, 1, other)
+	releaseOther()
+
+	release()
+	slot, release = allocator.allocate("group/workers", instances)
+	require.Equal(t, 1, slot)
+	release()
+}
+
+func TestProvisionWithSlot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	clientMock.EXPECT().DescribeInstances(describeGroupRequest(testNamespace, map[string]string{GroupTag: "workers"}, nil)).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+			{Instances: []*ec2.Instance{slotInstance("0"), slotInstance("2")}},
+		}}, nil)
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	properties := json.RawMessage(`{"Slots": true}`)
+	_, err := pluginImpl.Provision(instance.Spec{
+		Properties: &properties,
+		Tags:       map[string]string{GroupTag: "workers", "infrakit.config_sha": "abc"},
+	})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	slot := ""
+	for key, values := range params {
+		if values[0] == SlotTag {
+			slot = params.Get(key[:len(key)-len("Key")] + "Value")
+		}
+	}
+	require.Equal(t, "1", slot)
+}
+
+func TestSlotOfInstanceNotYetVisible(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	// Neither instance is visible to DescribeInstances when the next is provisioned.
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil).Times(2)
+
+	slots := []string{}
+	for _, id := range []string{"i-1", "i-2"} {
+		runRequest := fakeRequest(nil)
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String(id)}}})
+
+		properties := json.RawMessage(`{"Slots": true}`)
+		_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: map[string]string{GroupTag: "workers"}})
+		require.NoError(t, err)
+
+		params := requestParams(t, runRequest)
+		for key, values := range params {
+			if values[0] == SlotTag && strings.HasPrefix(key, "TagSpecification.1.") {
+				slots = append(slots, params.Get(key[:len(key)-len("Key")]+"Value"))
+			}
+		}
+	}
+
+	// The instance launched first holds its slot.
+	require.Equal(t, []string{"0", "1"}, slots)
+}
+
+func TestSlotsRequireGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	properties := json.RawMessage(`{"Slots": true}`)
+	_, err := NewInstancePlugin(mock_ec2.NewMockEC2API(ctrl), testNamespace).Provision(
+		instance.Spec{Properties: &properties})
+	require.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// spotPriceLookback is how far back spot price history is considered recent.
+const spotPriceLookback = 24 * time.Hour
+
+// SpotOptions launches spot instances rather than on-demand instances.
+type SpotOptions struct {
+	// MaxPrice is the maximum hourly price paid for an instance, defaulting to the on-demand price.  A warning is
+	// logged when it is below the recent spot prices of the instance types and availability zones of the group.
+	MaxPrice string `json:",omitempty"`
+
+	// CheapestAvailabilityZone orders the AvailabilityZones of the group by the current spot price of the instance
+	// type, so that instances are launched in the cheapest zone that has capacity.
+	CheapestAvailabilityZone bool `json:",omitempty"`
+}
+
+// spotPrice is the spot price history of an instance type in an availability zone.
+type spotPrice struct {
+	current     float64
+	currentTime time.Time
+	highest     float64
+}
+
+type spotMarket struct {
+	instanceType     string
+	availabilityZone string
+}
+
+// spotPriceHistory looks up the recent Linux spot prices of instance types, by instance type and availability zone.
+func (p awsInstancePlugin) spotPriceHistory(instanceTypes []string) (map[spotMarket]spotPrice, error) {
+	prices := map[spotMarket]spotPrice{}
+	var parseErr error
+	err := p.client.DescribeSpotPriceHistoryPages(
+		&ec2.DescribeSpotPriceHistoryInput{
+			InstanceTypes:       aws.StringSlice(instanceTypes),
+			ProductDescriptions: aws.StringSlice([]string{"Linux/UNIX"}),
+			StartTime:           aws.Time(time.Now().Add(-spotPriceLookback)),
+		},
+		func(output *ec2.DescribeSpotPriceHistoryOutput, lastPage bool) bool {
+			for _, entry := range output.SpotPriceHistory {
+				value, err := strconv.ParseFloat(aws.StringValue(entry.SpotPrice), 64)
+				if err != nil {
+					parseErr = err
+					return false
+				}
+
+				market := spotMarket{aws.StringValue(entry.InstanceType), aws.StringValue(entry.AvailabilityZone)}
+				price := prices[market]
+				if timestamp := aws.TimeValue(entry.Timestamp); timestamp.After(price.currentTime) {
+					price.current = value
+					price.currentTime = timestamp
+				}
+				if value > price.highest {
+					price.highest = value
+				}
+				prices[market] = price
+			}
+			return true
+		})
+	if err == nil {
+		err = parseErr
+	}
+	return prices, err
+}
+
+// requestInstanceTypes are the instance types a request may launch, in order of preference.
+func requestInstanceTypes(request CreateInstanceRequest) []string {
+	instanceTypes := []string{}
+	if len(request.InstanceTypes) == 0 && request.RunInstancesInput.InstanceType != nil {
+		instanceTypes = append(instanceTypes, *request.RunInstancesInput.InstanceType)
+	}
+	for _, option := range request.InstanceTypes {
+		instanceTypes = append(instanceTypes, option.InstanceType)
+	}
+	return instanceTypes
+}
+
+// zonesByPrice orders availability zones by ascending spot price.  Zones without a price are kept in their order
+// after those with a price.
+type zonesByPrice struct {
+	zones  []AvailabilityZoneOption
+	prices []float64
+}
+
+func (z zonesByPrice) Len() int {
+	return len(z.zones)
+}
+
+func (z zonesByPrice) Swap(i, j int) {
+	z.zones[i], z.zones[j] = z.zones[j], z.zones[i]
+	z.prices[i], z.prices[j] = z.prices[j], z.prices[i]
+}
+
+func (z zonesByPrice) Less(i, j int) bool {
+	if z.prices[i] == 0 || z.prices[j] == 0 {
+		return z.prices[j] == 0 && z.prices[i] != 0
+	}
+	return z.prices[i] < z.prices[j]
+}
+
+// adviseSpot checks the maximum spot price of a request against the recent spot prices of its instance types, and
+// orders its availability zones by price if the request chooses the cheapest zone.  Spot prices are advisory, so
+// failures to look them up are logged and the request is launched as configured.
+func (p awsInstancePlugin) adviseSpot(request *CreateInstanceRequest) {
+	if request.Spot == nil {
+		return
+	}
+
+	instanceTypes := requestInstanceTypes(*request)
+	if len(instanceTypes) == 0 {
+		return
+	}
+	prices, err := p.spotPriceHistory(instanceTypes)
+	if err != nil {
+		log.Warnf("Failed to look up spot prices of %s: %s", instanceTypes, err)
+		return
+	}
+
+	zones := []string{}
+	for _, zone := range request.AvailabilityZones {
+		zones = append(zones, zone.AvailabilityZone)
+	}
+	if len(zones) == 0 {
+		zones = []string{availabilityZone(request.RunInstancesInput)}
+	}
+
+	if request.Spot.MaxPrice != "" {
+		maxPrice, err := strconv.ParseFloat(request.Spot.MaxPrice, 64)
+		if err != nil {
+			log.Warnf("Spot MaxPrice %s is not a price: %s", request.Spot.MaxPrice, err)
+		} else {
+			for _, instanceType := range instanceTypes {
+				for _, zone := range zones {
+					price, has := prices[spotMarket{instanceType, zone}]
+					if has && maxPrice < price.highest {
+						log.Warnf(
+							"Spot MaxPrice %s is below the recent spot price %g of %s in %s, currently %g",
+							request.Spot.MaxPrice,
+							price.highest,
+							instanceType,
+							zone,
+							price.current)
+					}
+				}
+			}
+		}
+	}
+
+	if request.Spot.CheapestAvailabilityZone && len(request.AvailabilityZones) > 1 {
+		ordered := zonesByPrice{
+			zones:  append([]AvailabilityZoneOption{}, request.AvailabilityZones...),
+			prices: make([]float64, len(request.AvailabilityZones)),
+		}
+		for i, zone := range ordered.zones {
+			ordered.prices[i] = prices[spotMarket{instanceTypes[0], zone.AvailabilityZone}].current
+		}
+		sort.Stable(ordered)
+		request.AvailabilityZones = ordered.zones
+	}
+}
@@ -0,0 +1,137 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func spotPriceEntry(zone, price string, age time.Duration) *ec2.SpotPrice {
+	return &ec2.SpotPrice{
+		InstanceType:     aws.String("m5.large"),
+		AvailabilityZone: aws.String(zone),
+		SpotPrice:        aws.String(price),
+		Timestamp:        aws.Time(time.Now().Add(-age)),
+	}
+}
+
+func expectSpotPrices(clientMock *mock_ec2.MockEC2API, prices ...*ec2.SpotPrice) {
+	clientMock.EXPECT().DescribeSpotPriceHistoryPages(gomock.Any(), gomock.Any()).
+		Do(func(input *ec2.DescribeSpotPriceHistoryInput, fn func(*ec2.DescribeSpotPriceHistoryOutput, bool) bool) {
+			fn(&ec2.DescribeSpotPriceHistoryOutput{SpotPriceHistory: prices}, true)
+		}).
+		Return(nil)
+}
+
+func TestProvisionSpotInCheapestZone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	expectSpotPrices(clientMock,
+		spotPriceEntry("us-west-2a", "0.040", time.Hour),
+		spotPriceEntry("us-west-2a", "0.035", time.Minute),
+		spotPriceEntry("us-west-2b", "0.030", time.Hour),
+		spotPriceEntry("us-west-2c", "0.020", time.Minute))
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			require.Equal(t, "us-west-2c", *input.Placement.AvailabilityZone)
+		}).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	properties := json.RawMessage(`{
+		"Spot": {"MaxPrice": "0.05", "CheapestAvailabilityZone": true},
+		"RunInstancesInput": {"InstanceType": "m5.large"},
+		"AvailabilityZones": [
+			{"AvailabilityZone": "us-west-2a"},
+			{"AvailabilityZone": "us-west-2b"},
+			{"AvailabilityZone": "us-west-2c"}
+		]
+	}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags})
+	require.NoError(t, err)
+
+	params := requestParams(t, runRequest)
+	require.Equal(t, "spot", params.Get("InstanceMarketOptions.MarketType"))
+	require.Equal(t, "0.05", params.Get("InstanceMarketOptions.SpotOptions.MaxPrice"))
+}
+
+func TestAdviseSpotZoneOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	// Zones without a price follow those with a price, in their configured order.
+	expectSpotPrices(clientMock,
+		spotPriceEntry("us-west-2c", "0.030", time.Minute),
+		spotPriceEntry("us-west-2d", "0.020", time.Minute))
+
+	request := CreateInstanceRequest{
+		Spot:              &SpotOptions{CheapestAvailabilityZone: true},
+		RunInstancesInput: ec2.RunInstancesInput{InstanceType: aws.String("m5.large")},
+		AvailabilityZones: []AvailabilityZoneOption{
+			{AvailabilityZone: "us-west-2a"},
+			{AvailabilityZone: "us-west-2b"},
+			{AvailabilityZone: "us-west-2c"},
+			{AvailabilityZone: "us-west-2d"},
+		},
+	}
+	pluginImpl.adviseSpot(&request)
+
+	zones := []string{}
+	for _, zone := range request.AvailabilityZones {
+		zones = append(zones, zone.AvailabilityZone)
+	}
+	require.Equal(t, []string{"us-west-2d", "us-west-2c", "us-west-2a", "us-west-2b"}, zones)
+}
+
+func TestAdviseSpotPriceLookupFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	clientMock.EXPECT().DescribeSpotPriceHistoryPages(gomock.Any(), gomock.Any()).Return(errors.New("denied"))
+
+	zones := []AvailabilityZoneOption{{AvailabilityZone: "us-west-2b"}, {AvailabilityZone: "us-west-2a"}}
+	request := CreateInstanceRequest{
+		Spot:              &SpotOptions{CheapestAvailabilityZone: true},
+		RunInstancesInput: ec2.RunInstancesInput{InstanceType: aws.String("m5.large")},
+		AvailabilityZones: zones,
+	}
+	pluginImpl.adviseSpot(&request)
+	require.Equal(t, zones, request.AvailabilityZones)
+}
+
+func TestSpotPriceHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	expectSpotPrices(clientMock,
+		spotPriceEntry("us-west-2a", "0.050", 3*time.Hour),
+		spotPriceEntry("us-west-2a", "0.030", time.Minute),
+		spotPriceEntry("us-west-2a", "0.040", time.Hour))
+
+	prices, err := pluginImpl.spotPriceHistory([]string{"m5.large"})
+	require.NoError(t, err)
+	price := prices[spotMarket{"m5.large", "us-west-2a"}]
+	require.Equal(t, 0.030, price.current)
+	require.Equal(t, 0.050, price.highest)
+}
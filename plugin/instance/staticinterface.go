@@ -0,0 +1,131 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"time"
+)
+
+// staticInterfaceTimeout is the maximum time to wait for the static network interface of a replaced instance to be
+// released by its previous instance.
+const staticInterfaceTimeout = 5 * time.Minute
+
+// findStaticNetworkInterface looks up the network interface owned by a logical ID.
+func (p awsInstancePlugin) findStaticNetworkInterface(logicalID instance.LogicalID) (*ec2.NetworkInterface, error) {
+	keys, allTags := mergeTags(map[string]string{LogicalIDTag: string(logicalID)}, p.namespaceTags)
+
+	filters := []*ec2.Filter{}
+	for _, key := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", key)),
+			Values: []*string{aws.String(allTags[key])},
+		})
+	}
+
+	result, err := p.client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(result.NetworkInterfaces) {
+	case 0:
+		return nil, nil
+	case 1:
+		return result.NetworkInterfaces[0], nil
+	default:
+		return nil, fmt.Errorf("Found %d network interfaces for logical ID %s", len(result.NetworkInterfaces), logicalID)
+	}
+}
+
+// createStaticNetworkInterface creates the network interface owned by a logical ID, using the subnet and security
+// groups of the launch request and the logical ID as the private IP address.
+func (p awsInstancePlugin) createStaticNetworkInterface(
+	run *ec2.RunInstancesInput,
+	logicalID instance.LogicalID,
+	tags []*ec2.Tag) (*string, error) {
+
+	input := &ec2.CreateNetworkInterfaceInput{
+		SubnetId:         run.SubnetId,
+		Groups:           run.SecurityGroupIds,
+		PrivateIpAddress: aws.String(string(logicalID)),
+		Description:      aws.String(fmt.Sprintf("Static interface of %s", logicalID)),
+	}
+	if len(run.NetworkInterfaces) > 0 {
+		if run.NetworkInterfaces[0].SubnetId != nil {
+			input.SubnetId = run.NetworkInterfaces[0].SubnetId
+		}
+		if len(run.NetworkInterfaces[0].Groups) > 0 {
+			input.Groups = run.NetworkInterfaces[0].Groups
+		}
+	}
+	if input.SubnetId == nil {
+		return nil, fmt.Errorf("A subnet is required to create the network interface of %s", logicalID)
+	}
+
+	created, err := p.client.CreateNetworkInterface(input)
+	if err != nil {
+		return nil, err
+	}
+	interfaceID := created.NetworkInterface.NetworkInterfaceId
+	log.Infof("Created network interface %s for logical ID %s", *interfaceID, logicalID)
+
+	_, err = p.client.CreateTags(&ec2.CreateTagsInput{Resources: []*string{interfaceID}, Tags: tags})
+	if err != nil {
+		return nil, err
+	}
+	return interfaceID, nil
+}
+
+// useStaticNetworkInterface changes a launch request to attach the network interface owned by a logical ID as the
+// primary interface of the instance, so that the address of the logical ID follows it across replacements.  The
+// interface is created if it does not already exist.
+func (p awsInstancePlugin) useStaticNetworkInterface(
+	run *ec2.RunInstancesInput,
+	logicalID instance.LogicalID,
+	tags []*ec2.Tag) error {
+
+	networkInterface, err := p.findStaticNetworkInterface(logicalID)
+	if err != nil {
+		return err
+	}
+
+	var interfaceID *string
+	if networkInterface == nil {
+		interfaceID, err = p.createStaticNetworkInterface(run, logicalID, tags)
+		if err != nil {
+			return err
+		}
+	} else {
+		interfaceID = networkInterface.NetworkInterfaceId
+		if aws.StringValue(networkInterface.Status) != ec2.NetworkInterfaceStatusAvailable {
+			log.Infof("Waiting for network interface %s of %s to be released", *interfaceID, logicalID)
+			if !p.waitAvailable(interfaceID, staticInterfaceTimeout) {
+				return fmt.Errorf("Network interface %s of %s is still in use", *interfaceID, logicalID)
+			}
+		}
+	}
+
+	// The subnet, security groups, and address belong to the network interface, and EC2 does not assign public
+	// addresses to instances launched with an existing network interface.
+	primary := &ec2.InstanceNetworkInterfaceSpecification{
+		DeviceIndex:         aws.Int64(0),
+		NetworkInterfaceId:  interfaceID,
+		DeleteOnTermination: aws.Bool(false),
+	}
+	if len(run.NetworkInterfaces) > 0 {
+		if aws.BoolValue(run.NetworkInterfaces[0].AssociatePublicIpAddress) {
+			log.Warnf("Instances of %s are launched with a static network interface, and have no public address",
+				logicalID)
+		}
+		run.NetworkInterfaces[0] = primary
+	} else {
+		run.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{primary}
+	}
+	run.SubnetId = nil
+	run.SecurityGroupIds = nil
+	run.PrivateIpAddress = nil
+	return nil
+}
@@ -0,0 +1,97 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var staticInterfaceJSON = json.RawMessage(`{
+	"StaticNetworkInterface": true,
+	"RunInstancesInput": {
+		"NetworkInterfaces": [{
+			"DeviceIndex": 0,
+			"SubnetId": "subnet-m",
+			"Groups": ["sg-m"],
+			"AssociatePublicIpAddress": true
+		}]
+	}
+}`)
+
+func TestProvisionReusesStaticNetworkInterface(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).
+		Do(func(input *ec2.DescribeNetworkInterfacesInput) {
+			filters := map[string]string{}
+			for _, filter := range input.Filters {
+				filters[*filter.Name] = *filter.Values[0]
+			}
+			require.Equal(t, "10.0.0.5", filters["tag:"+LogicalIDTag])
+		}).
+		Return(&ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []*ec2.NetworkInterface{{
+			NetworkInterfaceId: aws.String("eni-1"),
+			Status:             aws.String(ec2.NetworkInterfaceStatusAvailable),
+		}}}, nil)
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			require.Len(t, input.NetworkInterfaces, 1)
+			require.Equal(t, "eni-1", *input.NetworkInterfaces[0].NetworkInterfaceId)
+			require.Nil(t, input.NetworkInterfaces[0].PrivateIpAddress)
+			require.Nil(t, input.NetworkInterfaces[0].AssociatePublicIpAddress)
+			require.False(t, *input.NetworkInterfaces[0].DeleteOnTermination)
+		}).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	logicalID := instance.LogicalID("10.0.0.5")
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &staticInterfaceJSON, LogicalID: &logicalID})
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("i-1"), *id)
+}
+
+func TestProvisionCreatesStaticNetworkInterface(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	gomock.InOrder(
+		clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).
+			Return(&ec2.DescribeNetworkInterfacesOutput{}, nil),
+		clientMock.EXPECT().CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{
+			SubnetId:         aws.String("subnet-m"),
+			Groups:           []*string{aws.String("sg-m")},
+			PrivateIpAddress: aws.String("10.0.0.5"),
+			Description:      aws.String("Static interface of 10.0.0.5"),
+		}).Return(&ec2.CreateNetworkInterfaceOutput{
+			NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String("eni-1")}}, nil),
+		clientMock.EXPECT().CreateTags(gomock.Any()).Do(func(input *ec2.CreateTagsInput) {
+			tags := map[string]string{}
+			for _, tag := range input.Tags {
+				tags[*tag.Key] = *tag.Value
+			}
+			require.Equal(t, "10.0.0.5", tags[LogicalIDTag])
+		}).Return(&ec2.CreateTagsOutput{}, nil),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "eni-1", *input.NetworkInterfaces[0].NetworkInterfaceId)
+			}).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}}),
+	)
+
+	logicalID := instance.LogicalID("10.0.0.5")
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &staticInterfaceJSON, LogicalID: &logicalID})
+	require.NoError(t, err)
+}
@@ -0,0 +1,176 @@
+package instance
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/docker/infrakit/spi/instance"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subnetCacheTTL is how long subnets matching tags are cached before they are looked up again.
+const subnetCacheTTL = 5 * time.Minute
+
+type cachedSubnets struct {
+	subnets []*ec2.Subnet
+	expires time.Time
+}
+
+// subnetCache caches the subnets matching tag filters, and distributes instances across them in turn.
+type subnetCache struct {
+	lock    sync.Mutex
+	subnets map[string]cachedSubnets
+	next    map[string]int
+}
+
+func newSubnetCache() *subnetCache {
+	return &subnetCache{subnets: map[string]cachedSubnets{}, next: map[string]int{}}
+}
+
+func subnetTagsKey(tags map[string]string) string {
+	keys, _ := mergeTags(tags)
+	pairs := []string{}
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+tags[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// bySubnet orders subnets by availability zone and ID, so they are used in a stable order.
+type bySubnet []*ec2.Subnet
+
+func (b bySubnet) Len() int      { return len(b) }
+func (b bySubnet) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b bySubnet) Less(i, j int) bool {
+	if aws.StringValue(b[i].AvailabilityZone) != aws.StringValue(b[j].AvailabilityZone) {
+		return aws.StringValue(b[i].AvailabilityZone) < aws.StringValue(b[j].AvailabilityZone)
+	}
+	return aws.StringValue(b[i].SubnetId) < aws.StringValue(b[j].SubnetId)
+}
+
+func describeSubnets(client ec2iface.EC2API, tags map[string]string) ([]*ec2.Subnet, error) {
+	keys, _ := mergeTags(tags)
+	filters := []*ec2.Filter{{Name: aws.String("state"), Values: []*string{aws.String(ec2.SubnetStateAvailable)}}}
+	for _, key := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", key)),
+			Values: []*string{aws.String(tags[key])},
+		})
+	}
+
+	result, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Subnets) == 0 {
+		return nil, fmt.Errorf("No available subnets match tags %s", subnetTagsKey(tags))
+	}
+
+	subnets := append([]*ec2.Subnet{}, result.Subnets...)
+	sort.Sort(bySubnet(subnets))
+	return subnets, nil
+}
+
+// lookup returns the subnets matching tags, along with the index of the subnet to use next.  A nil cache looks up
+// subnets on every call.
+func (c *subnetCache) lookup(client ec2iface.EC2API, tags map[string]string) ([]*ec2.Subnet, int, error) {
+	if c == nil {
+		subnets, err := describeSubnets(client, tags)
+		return subnets, 0, err
+	}
+
+	key := subnetTagsKey(tags)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cached, exists := c.subnets[key]
+	if !exists || !time.Now().Before(cached.expires) {
+		subnets, err := describeSubnets(client, tags)
+		if err != nil {
+			return nil, 0, err
+		}
+		cached = cachedSubnets{subnets: subnets, expires: time.Now().Add(subnetCacheTTL)}
+		c.subnets[key] = cached
+	}
+
+	next := c.next[key]
+	c.next[key] = next + 1
+	return cached.subnets, next, nil
+}
+
+func containsAddress(subnet *ec2.Subnet, address string) bool {
+	_, cidr, err := net.ParseCIDR(aws.StringValue(subnet.CidrBlock))
+	ip := net.ParseIP(address)
+	return err == nil && ip != nil && cidr.Contains(ip)
+}
+
+func setSubnet(run *ec2.RunInstancesInput, subnet *ec2.Subnet) {
+	if len(run.NetworkInterfaces) > 0 {
+		networkInterface := *run.NetworkInterfaces[0]
+		networkInterface.SubnetId = subnet.SubnetId
+		run.NetworkInterfaces = append(
+			[]*ec2.InstanceNetworkInterfaceSpecification{&networkInterface},
+			run.NetworkInterfaces[1:]...)
+	} else {
+		run.SubnetId = subnet.SubnetId
+	}
+
+	if run.Placement != nil {
+		placement := *run.Placement
+		placement.AvailabilityZone = subnet.AvailabilityZone
+		run.Placement = &placement
+	}
+}
+
+// applySubnetTags chooses the subnets of a request from the subnets matching its SubnetTags.  Instances are
+// distributed across the matching subnets in turn, while an instance with a logical ID is placed in the subnet
+// containing its address.  With AvailabilityZones, each zone without a subnet uses a matching subnet in the zone.
+func (p awsInstancePlugin) applySubnetTags(request *CreateInstanceRequest, logicalID *instance.LogicalID) error {
+	if len(request.SubnetTags) == 0 {
+		return nil
+	}
+
+	subnets, next, err := p.subnets.lookup(p.client, request.SubnetTags)
+	if err != nil {
+		return err
+	}
+
+	if logicalID != nil {
+		for _, subnet := range subnets {
+			if containsAddress(subnet, string(*logicalID)) {
+				setSubnet(&request.RunInstancesInput, subnet)
+				return nil
+			}
+		}
+		return fmt.Errorf("No subnet matching SubnetTags contains %s", *logicalID)
+	}
+
+	if len(request.AvailabilityZones) == 0 {
+		setSubnet(&request.RunInstancesInput, subnets[next%len(subnets)])
+		return nil
+	}
+
+	for i, zone := range request.AvailabilityZones {
+		if zone.SubnetID != "" {
+			continue
+		}
+
+		inZone := []*ec2.Subnet{}
+		for _, subnet := range subnets {
+			if aws.StringValue(subnet.AvailabilityZone) == zone.AvailabilityZone {
+				inZone = append(inZone, subnet)
+			}
+		}
+		if len(inZone) == 0 {
+			return fmt.Errorf("No subnet matching SubnetTags is in %s", zone.AvailabilityZone)
+		}
+		request.AvailabilityZones[i].SubnetID = aws.StringValue(inZone[next%len(inZone)].SubnetId)
+	}
+	return nil
+}
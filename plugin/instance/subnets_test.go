@@ -0,0 +1,87 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func subnet(id, az, cidr string) *ec2.Subnet {
+	return &ec2.Subnet{SubnetId: aws.String(id), AvailabilityZone: aws.String(az), CidrBlock: aws.String(cidr)}
+}
+
+func TestApplySubnetTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(*awsInstancePlugin)
+
+	// Subnets are looked up once, and used in order of availability zone.
+	clientMock.EXPECT().DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: []*ec2.Filter{
+		{Name: aws.String("state"), Values: []*string{aws.String("available")}},
+		{Name: aws.String("tag:Tier"), Values: []*string{aws.String("private")}},
+	}}).Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+		subnet("subnet-b", "us-west-2b", "10.0.2.0/24"),
+		subnet("subnet-a", "us-west-2a", "10.0.1.0/24"),
+	}}, nil)
+
+	chosen := []string{}
+	for i := 0; i < 3; i++ {
+		request := CreateInstanceRequest{
+			SubnetTags:        map[string]string{"Tier": "private"},
+			RunInstancesInput: ec2.RunInstancesInput{Placement: &ec2.Placement{AvailabilityZone: aws.String("us-west-2c")}},
+		}
+		require.NoError(t, pluginImpl.applySubnetTags(&request, nil))
+		chosen = append(chosen, *request.RunInstancesInput.SubnetId)
+		require.Equal(t, map[string]string{"subnet-a": "us-west-2a", "subnet-b": "us-west-2b"}[*request.RunInstancesInput.SubnetId],
+			*request.RunInstancesInput.Placement.AvailabilityZone)
+	}
+	require.Equal(t, []string{"subnet-a", "subnet-b", "subnet-a"}, chosen)
+
+	// Instances with a logical ID are placed in the subnet containing their address.
+	request := CreateInstanceRequest{
+		SubnetTags: map[string]string{"Tier": "private"},
+		RunInstancesInput: ec2.RunInstancesInput{
+			NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{{DeviceIndex: aws.Int64(0)}},
+		},
+	}
+	logicalID := instance.LogicalID("10.0.2.10")
+	require.NoError(t, pluginImpl.applySubnetTags(&request, &logicalID))
+	require.Equal(t, "subnet-b", *request.RunInstancesInput.NetworkInterfaces[0].SubnetId)
+
+	unknown := instance.LogicalID("10.0.9.10")
+	require.Error(t, pluginImpl.applySubnetTags(&request, &unknown))
+
+	// Fallback availability zones without a subnet use a matching subnet in the zone.
+	request = CreateInstanceRequest{
+		SubnetTags: map[string]string{"Tier": "private"},
+		AvailabilityZones: []AvailabilityZoneOption{
+			{AvailabilityZone: "us-west-2a"},
+			{AvailabilityZone: "us-west-2b", SubnetID: "subnet-explicit"},
+		},
+	}
+	require.NoError(t, pluginImpl.applySubnetTags(&request, nil))
+	require.Equal(t, "subnet-a", request.AvailabilityZones[0].SubnetID)
+	require.Equal(t, "subnet-explicit", request.AvailabilityZones[1].SubnetID)
+
+	request.AvailabilityZones = []AvailabilityZoneOption{{AvailabilityZone: "us-west-2c"}}
+	require.Error(t, pluginImpl.applySubnetTags(&request, nil))
+}
+
+func TestApplySubnetTagsNoMatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(*awsInstancePlugin)
+
+	clientMock.EXPECT().DescribeSubnets(gomock.Any()).Return(&ec2.DescribeSubnetsOutput{}, nil)
+
+	request := CreateInstanceRequest{SubnetTags: map[string]string{"Tier": "private"}}
+	require.Error(t, pluginImpl.applySubnetTags(&request, nil))
+}
@@ -0,0 +1,158 @@
+package instance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/yaml"
+	"github.com/docker/infrakit/spi/instance"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TagContext is the context of an instance that a TagPolicy computes the tags of.
+type TagContext struct {
+	// Namespace are the namespace tags of the plugin, such as the cluster of the instance.
+	Namespace map[string]string
+
+	// Group is the group of the instance, from its GroupTag.
+	Group string
+
+	// GroupTags are the tags the group provisions the instance with, such as the hash of its configuration.
+	GroupTags map[string]string
+
+	// Slot is the slot of the instance, if its group has Slots.
+	Slot string
+
+	// LogicalID is the logical ID of the instance, if any.
+	LogicalID string
+
+	// Name is the name of the instance by the Name property, if any.
+	Name string
+
+	// Tags are the Tags of the properties of the group.
+	Tags map[string]string
+}
+
+// TagPolicy computes the tags of provisioned instances, such that an organization enforces its tagging standards for
+// all groups.  The tags replace the Tags of the properties, and apply to the instance, its volumes, and its network
+// interfaces.  A Name tag names the instance in place of the Name property.  The namespace tags and the tags managed by
+// the plugin, such as the group and logical ID of the instance, are kept.
+type TagPolicy interface {
+	// Tags returns the tags of an instance, or an error if the instance may not be provisioned.
+	Tags(context TagContext) (map[string]string, error)
+}
+
+// templateTagPolicy computes tags by rendering a template of a JSON or YAML object of tags with the TagContext.
+type templateTagPolicy struct {
+	template *template.Template
+}
+
+// NewTemplateTagPolicy creates a policy that computes tags with a template of a JSON or YAML object of tags, rendered
+// with the TagContext.  Besides the builtin functions of text/template, templates may use hostname, lower, upper,
+// default, required, which fails the provision when a value is empty, and quote, which renders a value as a quoted
+// string, so that values containing quotes or comments are kept as they are.  Numbers and booleans are tags of their
+// text.
+func NewTemplateTagPolicy(text string) (TagPolicy, error) {
+	tmpl, err := template.New("tags").Option("missingkey=zero").Funcs(template.FuncMap{
+		"hostname": hostnameOf,
+		"lower":    strings.ToLower,
+		"upper":    strings.ToUpper,
+		"quote": func(value string) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+		"required": func(description, value string) (string, error) {
+			if value == "" {
+				return "", fmt.Errorf("%s is required", description)
+			}
+			return value, nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid tag policy template: %s", err)
+	}
+	return &templateTagPolicy{template: tmpl}, nil
+}
+
+// Tags implements TagPolicy.Tags.
+func (t *templateTagPolicy) Tags(context TagContext) (map[string]string, error) {
+	buffer := bytes.Buffer{}
+	if err := t.template.Execute(&buffer, context); err != nil {
+		return nil, fmt.Errorf("Failed to render tag policy: %s", err)
+	}
+	encoded, err := yaml.ToJSON(buffer.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("Tag policy rendered invalid tags: %s", err)
+	}
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("Tag policy must render an object of tags: %s", err)
+	}
+
+	tags := map[string]string{}
+	for key, value := range values {
+		switch value := value.(type) {
+		case nil:
+			tags[key] = ""
+		case string:
+			tags[key] = value
+		case json.Number:
+			tags[key] = value.String()
+		case bool:
+			tags[key] = strconv.FormatBool(value)
+		default:
+			return nil, fmt.Errorf("Tag policy rendered tag %s with a value that is not a string: %v", key, value)
+		}
+	}
+	return tags, nil
+}
+
+// policyTags computes the tags of the properties of an instance and the name of the instance with the tag policy of
+// the plugin.  Without a policy, they are the Tags of the properties and the name by the Name property.
+func (p awsInstancePlugin) policyTags(
+	request CreateInstanceRequest,
+	groupTags map[string]string,
+	slot string,
+	logicalID *instance.LogicalID,
+	name string) (map[string]string, string, error) {
+
+	if p.tagPolicy == nil {
+		return request.Tags, name, nil
+	}
+
+	context := TagContext{
+		Namespace: p.namespaceTags,
+		Group:     groupTags[GroupTag],
+		GroupTags: groupTags,
+		Slot:      slot,
+		Name:      name,
+		Tags:      request.Tags,
+	}
+	if logicalID != nil {
+		context.LogicalID = string(*logicalID)
+	}
+
+	computed, err := p.tagPolicy.Tags(context)
+	if err != nil {
+		return nil, "", err
+	}
+	tags := map[string]string{}
+	for key, value := range computed {
+		if key == NameTag {
+			name = value
+			continue
+		}
+		tags[key] = value
+	}
+	return tags, name, nil
+}
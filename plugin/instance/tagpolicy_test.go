@@ -0,0 +1,159 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+const testTagPolicy = `
+Name: {{ .Namespace.cluster }}-{{ .Group }}-{{ .Slot }}
+CostCenter: {{ .Tags.CostCenter | required "CostCenter" | quote }}
+Owner: {{ .Tags.Owner | default "platform" | quote }}
+Hostname: {{ hostname .Name }}
+`
+
+func TestTemplateTagPolicy(t *testing.T) {
+	policy, err := NewTemplateTagPolicy(testTagPolicy)
+	require.NoError(t, err)
+
+	tags, err := policy.Tags(TagContext{
+		Namespace: map[string]string{"cluster": "prod"},
+		Group:     "workers",
+		Slot:      "2",
+		Name:      "Prod Workers",
+		Tags:      map[string]string{"CostCenter": "cc-1234"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"Name":       "prod-workers-2",
+		"CostCenter": "cc-1234",
+		"Owner":      "platform",
+		"Hostname":   "prod-workers",
+	}, tags)
+
+	_, err = policy.Tags(TagContext{Group: "workers"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "CostCenter is required")
+
+	_, err = NewTemplateTagPolicy("{{ .Group ")
+	require.Error(t, err)
+
+	policy, err = NewTemplateTagPolicy(`["{{ .Group }}"]`)
+	require.NoError(t, err)
+	_, err = policy.Tags(TagContext{Group: "workers"})
+	require.Error(t, err)
+
+	policy, err = NewTemplateTagPolicy("Zones: [a, b]")
+	require.NoError(t, err)
+	_, err = policy.Tags(TagContext{})
+	require.Error(t, err)
+}
+
+func TestTemplateTagPolicyValues(t *testing.T) {
+	policy, err := NewTemplateTagPolicy(testTagPolicy + "Count: 1234\nEnabled: true\nOptional:\n")
+	require.NoError(t, err)
+
+	// Quoted values keep quotes and comment characters, and numbers and booleans are tags of their text.
+	tags, err := policy.Tags(TagContext{
+		Tags: map[string]string{"CostCenter": "1234", "Owner": `team # ops, "it's" \ them`},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "1234", tags["CostCenter"])
+	require.Equal(t, `team # ops, "it's" \ them`, tags["Owner"])
+	require.Equal(t, "1234", tags["Count"])
+	require.Equal(t, "true", tags["Enabled"])
+	require.Equal(t, "", tags["Optional"])
+}
+
+func TestProvisionWithTagPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, map[string]string{"cluster": "prod"}).(*awsInstancePlugin)
+	policy, err := NewTemplateTagPolicy(testTagPolicy + "infrakit.group: other\n")
+	require.NoError(t, err)
+	pluginImpl.tagPolicy = policy
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	properties := json.RawMessage(`{"Name": {"Prefix": "default"}, "Tags": {"CostCenter": "cc-1234", "Team": "a"}}`)
+	_, err = pluginImpl.Provision(instance.Spec{
+		Properties: &properties,
+		Tags:       map[string]string{GroupTag: "workers"},
+	})
+	require.NoError(t, err)
+
+	tags := map[string]string{}
+	params := requestParams(t, runRequest)
+	for key, values := range params {
+		if strings.HasPrefix(key, "TagSpecification.1.") && strings.HasSuffix(key, ".Key") {
+			tags[values[0]] = params.Get(key[:len(key)-len("Key")] + "Value")
+		}
+	}
+
+	// The policy replaces the tags of the properties and names the instance, while the namespace and group tags are
+	// kept.
+	require.Equal(t, map[string]string{
+		"cluster":    "prod",
+		GroupTag:     "workers",
+		"Name":       "prod-workers-",
+		"CostCenter": "cc-1234",
+		"Owner":      "platform",
+		"Hostname":   "default-workers",
+	}, tags)
+
+	// Instances are not provisioned without the tags the policy requires.
+	properties = json.RawMessage(`{}`)
+	_, err = pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: map[string]string{GroupTag: "workers"}})
+	require.Error(t, err)
+}
+
+func TestClaimWarmInstanceWithTagPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, map[string]string{"cluster": "prod"}).(*awsInstancePlugin)
+	policy, err := NewTemplateTagPolicy(testTagPolicy)
+	require.NoError(t, err)
+	pluginImpl.tagPolicy = policy
+
+	// The claimed instance is tagged by the policy, including its name.
+	gomock.InOrder(
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+				{Instances: []*ec2.Instance{warmInstance("warm-1", ec2.InstanceStateNameStopped)}},
+			}}, nil),
+		clientMock.EXPECT().DeleteTags(gomock.Any()).Return(&ec2.DeleteTagsOutput{}, nil),
+		clientMock.EXPECT().CreateTags(gomock.Any()).Do(func(input *ec2.CreateTagsInput) {
+			tags := map[string]string{}
+			for _, tag := range input.Tags {
+				tags[*tag.Key] = *tag.Value
+			}
+			require.Equal(t, "prod-workers-", tags[NameTag])
+			require.Equal(t, "cc-1234", tags["CostCenter"])
+		}).Return(&ec2.CreateTagsOutput{}, nil),
+		clientMock.EXPECT().StartInstances(gomock.Any()).
+			Return(&ec2.StartInstancesOutput{
+				StartingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("warm-1")}}},
+				nil),
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("warm-2")}}}),
+	)
+
+	properties := json.RawMessage(`{"Tags": {"CostCenter": "cc-1234"}, "WarmPool": {"Size": 1}}`)
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: map[string]string{GroupTag: "workers"}})
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("warm-1"), *id)
+}
@@ -0,0 +1,94 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/docker/infrakit/spi/instance"
+	"strings"
+)
+
+const (
+	// TargetGroupsTag is the tag name used to record the target groups that an instance is registered with, such
+	// that the instance is deregistered when it is destroyed.
+	TargetGroupsTag = "infrakit.target-groups"
+)
+
+// NewLoadBalancedInstancePlugin creates a plugin that creates instances in AWS EC2, registering them with the
+// target groups in their properties.
+func NewLoadBalancedInstancePlugin(
+	client ec2iface.EC2API,
+	elbClient elbv2iface.ELBV2API,
+	namespaceTags map[string]string) instance.Plugin {
+
+	return &awsInstancePlugin{
+		client:        client,
+		namespaceTags: namespaceTags,
+		elb:           elbClient,
+		subnets:       newSubnetCache(),
+		provisions:    newProvisionLimiter(0),
+		slots:         newSlotAllocator(),
+		purchases:     newPurchaseAllocator(),
+		zones:         newZoneBalancer(),
+		warmClaims:    newWarmPoolClaims(),
+		warmFills:     newWarmPoolFills(),
+		launches:      newRecentLaunches(),
+	}
+}
+
+func withTargetGroupsTag(tags map[string]string, targetGroupARNs []string) map[string]string {
+	tagged := map[string]string{}
+	for k, v := range tags {
+		tagged[k] = v
+	}
+	delete(tagged, TargetGroupsTag)
+	if len(targetGroupARNs) > 0 {
+		tagged[TargetGroupsTag] = strings.Join(targetGroupARNs, ",")
+	}
+	return tagged
+}
+
+func (p awsInstancePlugin) registerTargets(id instance.ID, targetGroupARNs []string) error {
+	for _, arn := range targetGroupARNs {
+		_, err := p.elb.RegisterTargets(&elbv2.RegisterTargetsInput{
+			TargetGroupArn: aws.String(arn),
+			Targets:        []*elbv2.TargetDescription{{Id: aws.String(string(id))}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deregisterTargets deregisters an instance from the target groups recorded in its tags.  Failures are logged
+// rather than returned, since they must not prevent the instance from being destroyed.
+func (p awsInstancePlugin) deregisterTargets(id instance.ID) {
+	if p.elb == nil {
+		return
+	}
+
+	ec2Instance, err := p.describeInstance(id)
+	if err != nil {
+		// Failures to find the instance are reported when terminating it.
+		return
+	}
+
+	for _, tag := range ec2Instance.Tags {
+		if aws.StringValue(tag.Key) != TargetGroupsTag {
+			continue
+		}
+
+		for _, arn := range strings.Split(aws.StringValue(tag.Value), ",") {
+			_, err := p.elb.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+				TargetGroupArn: aws.String(arn),
+				Targets:        []*elbv2.TargetDescription{{Id: aws.String(string(id))}},
+			})
+			if err != nil {
+				log.Warnf("Failed to deregister instance %s from target group %s: %s", id, arn, err)
+			}
+		}
+	}
+}
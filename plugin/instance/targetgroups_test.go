@@ -0,0 +1,89 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// fakeELB records the targets registered with each target group.
+type fakeELB struct {
+	elbv2iface.ELBV2API
+	targets map[string][]string
+}
+
+func (f *fakeELB) RegisterTargets(input *elbv2.RegisterTargetsInput) (*elbv2.RegisterTargetsOutput, error) {
+	for _, target := range input.Targets {
+		f.targets[*input.TargetGroupArn] = append(f.targets[*input.TargetGroupArn], *target.Id)
+	}
+	return &elbv2.RegisterTargetsOutput{}, nil
+}
+
+func (f *fakeELB) DeregisterTargets(input *elbv2.DeregisterTargetsInput) (*elbv2.DeregisterTargetsOutput, error) {
+	for _, target := range input.Targets {
+		remaining := []string{}
+		for _, id := range f.targets[*input.TargetGroupArn] {
+			if id != *target.Id {
+				remaining = append(remaining, id)
+			}
+		}
+		f.targets[*input.TargetGroupArn] = remaining
+	}
+	return &elbv2.DeregisterTargetsOutput{}, nil
+}
+
+func TestTargetGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	elbClient := &fakeELB{targets: map[string][]string{}}
+	pluginImpl := NewLoadBalancedInstancePlugin(clientMock, elbClient, testNamespace)
+
+	properties := json.RawMessage(`{"TargetGroupARNs": ["arn:managers"]}`)
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &properties})
+	require.NoError(t, err)
+	require.Equal(t, []string{"i-1"}, elbClient.targets["arn:managers"])
+
+	params := requestParams(t, runRequest)
+	tagged := false
+	for key, values := range params {
+		if values[0] == TargetGroupsTag {
+			tagged = params.Get(key[:len(key)-len("Key")]+"Value") == "arn:managers"
+		}
+	}
+	require.True(t, tagged)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(describeInstancesResponse([][]string{{"i-1"}}, map[string]string{TargetGroupsTag: "arn:managers"}, nil), nil)
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(gomock.Any()).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("i-1")}}},
+			nil)
+
+	require.NoError(t, pluginImpl.Destroy(*id))
+	require.Empty(t, elbClient.targets["arn:managers"])
+}
+
+func TestTargetGroupsRequireClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	properties := json.RawMessage(`{"TargetGroupARNs": ["arn:managers"]}`)
+	_, err := NewInstancePlugin(mock_ec2.NewMockEC2API(ctrl), testNamespace).Provision(
+		instance.Spec{Properties: &properties})
+	require.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"sort"
+	"strings"
+)
+
+const (
+	// HealthSourcesTag is the tag name used to record the sources of the health of an instance, beyond its
+	// clustering system, that are reported in its description.
+	HealthSourcesTag = "infrakit.health-sources"
+
+	// TargetHealthTag is the description tag of the health of an instance in its target groups: the least healthy
+	// of its target health states, such as healthy, initial, draining, or unhealthy.
+	TargetHealthTag = "infrakit.target-health"
+
+	// StatusChecksTag is the description tag of the EC2 status checks of an instance: ok, impaired, or
+	// initializing while either check has not yet passed.
+	StatusChecksTag = "infrakit.status-checks"
+
+	// TargetGroupsHealth reports the health of instances in their target groups.
+	TargetGroupsHealth = "target-groups"
+
+	// StatusChecksHealth reports the EC2 status checks of instances.
+	StatusChecksHealth = "status-checks"
+)
+
+// targetHealthSeverity orders target health states from the least to the most severe, so that the state of an
+// instance in several target groups is the most severe of them.
+var targetHealthSeverity = map[string]int{
+	elbv2.TargetHealthStateEnumHealthy:   0,
+	elbv2.TargetHealthStateEnumUnused:    1,
+	elbv2.TargetHealthStateEnumInitial:   2,
+	elbv2.TargetHealthStateEnumDraining:  3,
+	elbv2.TargetHealthStateEnumUnhealthy: 4,
+}
+
+func (r CreateInstanceRequest) validateHealthSources() error {
+	for _, source := range r.HealthSources {
+		switch source {
+		case StatusChecksHealth:
+		case TargetGroupsHealth:
+			if len(r.TargetGroupARNs) == 0 {
+				return fmt.Errorf("HealthSources %s requires TargetGroupARNs", TargetGroupsHealth)
+			}
+		default:
+			return fmt.Errorf("HealthSources must be %s or %s: %s", TargetGroupsHealth, StatusChecksHealth, source)
+		}
+	}
+	return nil
+}
+
+func withHealthSourcesTag(tags map[string]string, sources []string) map[string]string {
+	tagged := map[string]string{}
+	for k, v := range tags {
+		tagged[k] = v
+	}
+	delete(tagged, HealthSourcesTag)
+	if len(sources) > 0 {
+		sorted := append([]string{}, sources...)
+		sort.Strings(sorted)
+		tagged[HealthSourcesTag] = strings.Join(sorted, ",")
+	}
+	return tagged
+}
+
+func hasHealthSource(ec2Instance *ec2.Instance, source string) bool {
+	for _, tagged := range strings.Split(tagValue(ec2Instance.Tags, HealthSourcesTag), ",") {
+		if tagged == source {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceHealth looks up the health of the instances tagged with health sources, returning the description tags of
+// each instance by ID.  Failures are logged rather than returned, so that the instances are still described, with
+// their health unknown.
+func (p awsInstancePlugin) instanceHealth(instances []*ec2.Instance) map[string]map[string]string {
+	health := map[string]map[string]string{}
+	statusChecked := []*string{}
+	targets := map[string][]*elbv2.TargetDescription{}
+	for _, ec2Instance := range instances {
+		if hasHealthSource(ec2Instance, StatusChecksHealth) {
+			statusChecked = append(statusChecked, ec2Instance.InstanceId)
+		}
+		if hasHealthSource(ec2Instance, TargetGroupsHealth) && p.elb != nil {
+			for _, arn := range strings.Split(tagValue(ec2Instance.Tags, TargetGroupsTag), ",") {
+				if arn != "" {
+					targets[arn] = append(targets[arn], &elbv2.TargetDescription{Id: ec2Instance.InstanceId})
+				}
+			}
+		}
+	}
+	add := func(id, key, value string) {
+		if health[id] == nil {
+			health[id] = map[string]string{}
+		}
+		health[id][key] = value
+	}
+
+	if len(statusChecked) > 0 {
+		err := p.client.DescribeInstanceStatusPages(
+			&ec2.DescribeInstanceStatusInput{InstanceIds: statusChecked},
+			func(page *ec2.DescribeInstanceStatusOutput, lastPage bool) bool {
+				for _, status := range page.InstanceStatuses {
+					add(aws.StringValue(status.InstanceId), StatusChecksTag, statusChecks(status))
+				}
+				return true
+			})
+		if err != nil {
+			log.Warnf("Failed to look up the status checks of instances: %s", err)
+		}
+	}
+
+	arns := []string{}
+	for arn := range targets {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	for _, arn := range arns {
+		result, err := p.elb.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: aws.String(arn),
+			Targets:        targets[arn],
+		})
+		if err != nil {
+			log.Warnf("Failed to look up the target health of target group %s: %s", arn, err)
+			continue
+		}
+		for _, description := range result.TargetHealthDescriptions {
+			if description.Target == nil || description.TargetHealth == nil {
+				continue
+			}
+			id := aws.StringValue(description.Target.Id)
+			state := aws.StringValue(description.TargetHealth.State)
+			if previous, has := health[id][TargetHealthTag]; has &&
+				targetHealthSeverity[previous] >= targetHealthSeverity[state] {
+				continue
+			}
+			add(id, TargetHealthTag, state)
+		}
+	}
+	return health
+}
+
+// statusChecks summarizes the instance and system status checks of an instance.
+func statusChecks(status *ec2.InstanceStatus) string {
+	checks := []*ec2.InstanceStatusSummary{status.InstanceStatus, status.SystemStatus}
+	passed := 0
+	for _, check := range checks {
+		switch aws.StringValue(check.Status) {
+		case ec2.SummaryStatusImpaired:
+			return ec2.SummaryStatusImpaired
+		case ec2.SummaryStatusOk:
+			passed++
+		}
+	}
+	if passed == len(checks) {
+		return ec2.SummaryStatusOk
+	}
+	return ec2.SummaryStatusInitializing
+}
@@ -0,0 +1,86 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// fakeTargetHealth reports the health of targets in each target group.
+type fakeTargetHealth struct {
+	fakeELB
+	states map[string]map[string]string
+}
+
+func (f *fakeTargetHealth) DescribeTargetHealth(
+	input *elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error) {
+
+	output := &elbv2.DescribeTargetHealthOutput{}
+	for _, target := range input.Targets {
+		output.TargetHealthDescriptions = append(output.TargetHealthDescriptions, &elbv2.TargetHealthDescription{
+			Target:       target,
+			TargetHealth: &elbv2.TargetHealth{State: aws.String(f.states[*input.TargetGroupArn][*target.Id])},
+		})
+	}
+	return output, nil
+}
+
+func TestValidateHealthSources(t *testing.T) {
+	_, err := parseRequest(json.RawMessage(`{"HealthSources": ["status-checks"]}`))
+	require.NoError(t, err)
+	_, err = parseRequest(json.RawMessage(`{"HealthSources": ["target-groups"], "TargetGroupARNs": ["arn:web"]}`))
+	require.NoError(t, err)
+
+	_, err = parseRequest(json.RawMessage(`{"HealthSources": ["target-groups"]}`))
+	require.Error(t, err)
+	_, err = parseRequest(json.RawMessage(`{"HealthSources": ["ping"]}`))
+	require.Error(t, err)
+}
+
+func TestInstanceHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	elbClient := &fakeTargetHealth{states: map[string]map[string]string{
+		"arn:web": {"i-1": "healthy", "i-2": "healthy"},
+		"arn:api": {"i-1": "draining", "i-2": "healthy"},
+	}}
+	pluginImpl := NewLoadBalancedInstancePlugin(clientMock, elbClient, testNamespace).(*awsInstancePlugin)
+
+	clientMock.EXPECT().DescribeInstanceStatusPages(gomock.Any(), gomock.Any()).
+		Do(func(input *ec2.DescribeInstanceStatusInput, fn func(*ec2.DescribeInstanceStatusOutput, bool) bool) {
+			require.Equal(t, []*string{aws.String("i-2")}, input.InstanceIds)
+			fn(&ec2.DescribeInstanceStatusOutput{InstanceStatuses: []*ec2.InstanceStatus{{
+				InstanceId:     aws.String("i-2"),
+				InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String("ok")},
+				SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String("initializing")},
+			}}}, true)
+		}).
+		Return(nil)
+
+	tags := func(values ...string) []*ec2.Tag {
+		tags := []*ec2.Tag{}
+		for i := 0; i < len(values); i += 2 {
+			tags = append(tags, &ec2.Tag{Key: aws.String(values[i]), Value: aws.String(values[i+1])})
+		}
+		return tags
+	}
+	health := pluginImpl.instanceHealth([]*ec2.Instance{
+		{InstanceId: aws.String("i-1"), Tags: tags(HealthSourcesTag, "target-groups", TargetGroupsTag, "arn:web,arn:api")},
+		{
+			InstanceId: aws.String("i-2"),
+			Tags:       tags(HealthSourcesTag, "status-checks,target-groups", TargetGroupsTag, "arn:web"),
+		},
+		{InstanceId: aws.String("i-3"), Tags: tags(TargetGroupsTag, "arn:web")},
+	})
+	require.Equal(t, map[string]map[string]string{
+		"i-1": {TargetHealthTag: "draining"},
+		"i-2": {TargetHealthTag: "healthy", StatusChecksTag: "initializing"},
+	}, health)
+}
@@ -0,0 +1,244 @@
+package instance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"strings"
+	"time"
+)
+
+// UpdateOptions controls a rolling update.
+type UpdateOptions struct {
+	// BatchSize is the number of instances replaced at a time.
+	BatchSize int
+
+	// HealthTimeout is the maximum time to wait for a replacement instance to pass its status checks.
+	HealthTimeout time.Duration
+
+	// ContinueOnFailure continues replacing instances after a failed replacement, rather than pausing the update.
+	ContinueOnFailure bool
+
+	// ReplaceRootVolume updates the image of instances by replacing their root volumes, rather than the instances, so
+	// that they keep their network interfaces, addresses, and data volumes.  Instances of another instance type are
+	// replaced.
+	ReplaceRootVolume bool
+
+	// lost stops the update once the lease it holds is lost.
+	lost leaseLoss
+}
+
+// Updater replaces the instances of a group that do not match the group's current configuration.
+type Updater interface {
+	// RollingUpdate replaces the instances matching tags whose image or instance type differs from properties.
+	RollingUpdate(tags map[string]string, properties json.RawMessage, options UpdateOptions) error
+}
+
+// outdated determines whether an instance was launched with a different image or instance type than a request.
+func outdated(ec2Instance *ec2.Instance, request CreateInstanceRequest) bool {
+	run := request.RunInstancesInput
+	if run.ImageId != nil && aws.StringValue(ec2Instance.ImageId) != *run.ImageId {
+		return true
+	}
+	if run.InstanceType != nil && aws.StringValue(ec2Instance.InstanceType) != *run.InstanceType {
+		return true
+	}
+	return false
+}
+
+// replacementTags are the tags with managedTagPrefix that replacements keep, since they are set by the group and flavor
+// plugins rather than by this plugin.
+var replacementTags = map[string]bool{
+	GroupTag:                   true,
+	"infrakit.config_sha":      true,
+	"infrakit.swarm.type":      true,
+	"infrakit.kubernetes.type": true,
+}
+
+// replacementSpec builds the spec of an instance that replaces ec2Instance, keeping its tags, the init of its user
+// data, and its logical ID.  Tags set by AWS and by the plugin itself are excluded, since the plugin sets its tags
+// again from properties when the replacement is provisioned.
+func (p awsInstancePlugin) replacementSpec(ec2Instance *ec2.Instance, properties json.RawMessage) (instance.Spec, error) {
+	spec := instance.Spec{Properties: &properties, Tags: map[string]string{}}
+
+	for _, tag := range ec2Instance.Tags {
+		key, value := aws.StringValue(tag.Key), aws.StringValue(tag.Value)
+		switch {
+		case strings.HasPrefix(key, "aws:"):
+		case key == LogicalIDTag:
+			logicalID := instance.LogicalID(value)
+			spec.LogicalID = &logicalID
+		case strings.HasPrefix(key, managedTagPrefix) && !replacementTags[key]:
+		default:
+			spec.Tags[key] = value
+		}
+	}
+
+	attribute, err := p.client.DescribeInstanceAttribute(&ec2.DescribeInstanceAttributeInput{
+		InstanceId: ec2Instance.InstanceId,
+		Attribute:  aws.String(ec2.InstanceAttributeNameUserData),
+	})
+	if err != nil {
+		return spec, err
+	}
+	if attribute.UserData != nil && attribute.UserData.Value != nil {
+		userData, err := base64.StdEncoding.DecodeString(*attribute.UserData.Value)
+		if err != nil {
+			return spec, err
+		}
+		// The replacement compresses the user data again if its properties require it.
+		userData, err = decompressUserData(userData)
+		if err != nil {
+			return spec, err
+		}
+		spec.Init = initOf(string(userData))
+	}
+
+	return spec, nil
+}
+
+// waitHealthy waits for an instance to run and pass its status checks.
+func (p awsInstancePlugin) waitHealthy(id instance.ID, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := p.client.DescribeInstanceStatus(&ec2.DescribeInstanceStatusInput{
+			InstanceIds: []*string{aws.String(string(id))},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range status.InstanceStatuses {
+			if aws.StringValue(s.InstanceStatus.Status) == ec2.SummaryStatusOk &&
+				aws.StringValue(s.SystemStatus.Status) == ec2.SummaryStatusOk {
+				p.zoneHealth.recordSuccess(aws.StringValue(s.AvailabilityZone))
+				return nil
+			}
+			if aws.StringValue(s.InstanceStatus.Status) == ec2.SummaryStatusImpaired ||
+				aws.StringValue(s.SystemStatus.Status) == ec2.SummaryStatusImpaired {
+				err := fmt.Errorf("Instance %s is impaired", id)
+				p.zoneHealth.recordFailure(aws.StringValue(s.AvailabilityZone), err.Error())
+				return err
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("Instance %s did not pass status checks within %s", id, timeout)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// replace replaces an instance.  Instances with a logical ID are destroyed before their replacement is provisioned,
+// since the replacement takes over the logical ID.  Other instances are destroyed once their replacement is healthy.
+func (p awsInstancePlugin) replace(ec2Instance *ec2.Instance, properties json.RawMessage, timeout time.Duration) error {
+	old := instance.ID(*ec2Instance.InstanceId)
+
+	spec, err := p.replacementSpec(ec2Instance, properties)
+	if err != nil {
+		return err
+	}
+
+	if spec.LogicalID != nil {
+		if err := p.Destroy(old); err != nil {
+			return err
+		}
+	}
+
+	id, err := p.Provision(spec)
+	if err != nil {
+		return err
+	}
+	log.Infof("Replacing instance %s with %s", old, *id)
+
+	if err := p.waitHealthy(*id, timeout); err != nil {
+		return err
+	}
+
+	if spec.LogicalID == nil {
+		return p.Destroy(old)
+	}
+	return nil
+}
+
+// RollingUpdate implements Updater.RollingUpdate.  Instances are replaced in batches, and the update pauses at the
+// first failed replacement unless ContinueOnFailure is set.
+func (p awsInstancePlugin) RollingUpdate(
+	tags map[string]string,
+	properties json.RawMessage,
+	options UpdateOptions) error {
+
+	request, err := parseRequest(properties)
+	if err != nil {
+		return err
+	}
+
+	instances, err := p.describeInstances(tags, nil)
+	if err != nil {
+		return err
+	}
+
+	pending := []*ec2.Instance{}
+	for _, ec2Instance := range instances {
+		if outdated(ec2Instance, request) {
+			pending = append(pending, ec2Instance)
+		}
+	}
+	log.Infof("%d of %d instances need to be replaced", len(pending), len(instances))
+
+	batchSize := options.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	failures := []string{}
+	for start := 0; start < len(pending); start += batchSize {
+		if err := options.lost.err(); err != nil {
+			return fmt.Errorf("Update stopped with %d instances remaining: %s", len(pending)-start, err)
+		}
+
+		end := start + batchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		errs := make(chan error, end-start)
+		for _, ec2Instance := range pending[start:end] {
+			go func(ec2Instance *ec2.Instance) {
+				var err error
+				if replacesRootVolume(ec2Instance, request, options) {
+					err = p.replaceRootVolume(ec2Instance, *request.RunInstancesInput.ImageId, options.HealthTimeout)
+				} else {
+					err = p.replace(ec2Instance, properties, options.HealthTimeout)
+				}
+				if err != nil {
+					err = fmt.Errorf("Failed to replace %s: %s", *ec2Instance.InstanceId, err)
+				}
+				errs <- err
+			}(ec2Instance)
+		}
+
+		for range pending[start:end] {
+			if err := <-errs; err != nil {
+				log.Warn(err)
+				failures = append(failures, err.Error())
+			}
+		}
+
+		if len(failures) > 0 && !options.ContinueOnFailure {
+			return fmt.Errorf(
+				"Update paused with %d instances remaining: %s",
+				len(pending)-end,
+				strings.Join(failures, "; "))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Update completed with failures: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package instance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/ec2ext"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var updateJSON = json.RawMessage(`{
+    "RunInstancesInput": {
+        "ImageId": "ami-new",
+        "InstanceType": "t2.micro"
+    }
+}`)
+
+func updateInstances(images ...string) *ec2.DescribeInstancesOutput {
+	instances := []*ec2.Instance{}
+	for i, image := range images {
+		instances = append(instances, &ec2.Instance{
+			InstanceId:   aws.String(string('a' + rune(i))),
+			ImageId:      aws.String(image),
+			InstanceType: aws.String("t2.micro"),
+			Tags: []*ec2.Tag{
+				{Key: aws.String(GroupTag), Value: aws.String("workers")},
+				{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("stack")},
+			},
+		})
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: instances}}}
+}
+
+func TestRollingUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Updater)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(updateInstances("ami-new", "ami-old"), nil)
+	clientMock.EXPECT().DescribeInstanceAttribute(gomock.Any()).
+		Return(&ec2.DescribeInstanceAttributeOutput{
+			UserData: &ec2.AttributeValue{Value: aws.String(base64.StdEncoding.EncodeToString([]byte("init")))},
+		}, nil)
+
+	runRequest := fakeRequest(nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(runRequest, &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("c")}}})
+	clientMock.EXPECT().DescribeInstanceStatus(gomock.Any()).
+		Return(&ec2.DescribeInstanceStatusOutput{InstanceStatuses: []*ec2.InstanceStatus{{
+			InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+			SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+		}}}, nil)
+
+	// The outdated instance is only terminated once its replacement is healthy.
+	clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+	clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("b")}}).
+		Return(&ec2.TerminateInstancesOutput{
+			TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("b")}}},
+			nil)
+
+	err := pluginImpl.RollingUpdate(
+		map[string]string{GroupTag: "workers"},
+		updateJSON,
+		UpdateOptions{BatchSize: 1, HealthTimeout: time.Minute})
+	require.NoError(t, err)
+
+	keys := map[string]bool{}
+	params := requestParams(t, runRequest)
+	for i := 1; params.Get(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", i)) != ""; i++ {
+		keys[params.Get(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", i))] = true
+	}
+	require.True(t, keys[GroupTag])
+	require.False(t, keys["aws:cloudformation:stack-name"])
+}
+
+func TestReplacementSpec(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	clientMock.EXPECT().DescribeInstanceAttribute(gomock.Any()).Return(&ec2.DescribeInstanceAttributeOutput{}, nil)
+
+	tags := map[string]string{
+		GroupTag:              "workers",
+		"infrakit.config_sha": "abc",
+		"infrakit.swarm.type": "worker",
+		LogicalIDTag:          "worker-1",
+		SlotTag:               "3",
+		PurchaseOptionTag:     spotPurchase,
+		TargetGroupsTag:       "arn:old",
+		AlarmsTag:             "recover",
+		HealthSourcesTag:      "elb",
+		FailedTag:             "true",
+		"aws:autoscaling:x":   "y",
+		"team":                "ops",
+	}
+	ec2Instance := &ec2.Instance{InstanceId: aws.String("a")}
+	for k, v := range tags {
+		ec2Instance.Tags = append(ec2Instance.Tags, &ec2.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	// Only the tags of the group and flavor plugins are kept, since the plugin sets its own from the properties.
+	spec, err := NewInstancePlugin(clientMock, testNamespace).(*awsInstancePlugin).replacementSpec(ec2Instance, updateJSON)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		GroupTag:              "workers",
+		"infrakit.config_sha": "abc",
+		"infrakit.swarm.type": "worker",
+		"team":                "ops",
+	}, spec.Tags)
+	require.Equal(t, "worker-1", string(*spec.LogicalID))
+
+	// Tags of features no longer in the properties are removed.
+	stale := map[string]string{
+		GroupTag:         "workers",
+		TargetGroupsTag:  "arn:old",
+		AlarmsTag:        "recover",
+		HealthSourcesTag: "elb",
+	}
+	require.Equal(t, map[string]string{GroupTag: "workers"},
+		withAlarmsTag(withHealthSourcesTag(withTargetGroupsTag(stale, nil), nil), nil))
+}
+
+func TestRollingUpdatePausesOnFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Updater)
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(updateInstances("ami-old", "ami-old"), nil)
+	clientMock.EXPECT().DescribeInstanceAttribute(gomock.Any()).Return(&ec2.DescribeInstanceAttributeOutput{}, nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Return(fakeRequest(awserr.NewRequestFailure(awserr.New("InvalidAMIID.NotFound", "not found", nil), 400, "")), nil)
+
+	err := pluginImpl.RollingUpdate(
+		map[string]string{GroupTag: "workers"},
+		updateJSON,
+		UpdateOptions{BatchSize: 1, HealthTimeout: time.Minute})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 instances remaining")
+}
+
+// fakeRootVolumes completes root volume replacements, recording the replaced instances.
+type fakeRootVolumes struct {
+	replaced []string
+	state    string
+}
+
+func (f *fakeRootVolumes) CreateReplaceRootVolumeTask(
+	input *ec2ext.CreateReplaceRootVolumeTaskInput) (*ec2ext.CreateReplaceRootVolumeTaskOutput, error) {
+
+	f.replaced = append(f.replaced, *input.InstanceId+"="+*input.ImageId)
+	return &ec2ext.CreateReplaceRootVolumeTaskOutput{
+		ReplaceRootVolumeTask: &ec2ext.ReplaceRootVolumeTask{ReplaceRootVolumeTaskId: aws.String("replacevol-1")},
+	}, nil
+}
+
+func (f *fakeRootVolumes) DescribeReplaceRootVolumeTasks(
+	input *ec2ext.DescribeReplaceRootVolumeTasksInput) (*ec2ext.DescribeReplaceRootVolumeTasksOutput, error) {
+
+	return &ec2ext.DescribeReplaceRootVolumeTasksOutput{ReplaceRootVolumeTasks: []*ec2ext.ReplaceRootVolumeTask{
+		{ReplaceRootVolumeTaskId: input.ReplaceRootVolumeTaskIds[0], TaskState: aws.String(f.state)},
+	}}, nil
+}
+
+func TestRollingUpdateReplacesRootVolume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	rootVolumes := &fakeRootVolumes{state: ec2ext.ReplaceRootVolumeTaskStateSucceeded}
+	pluginImpl := &awsInstancePlugin{client: clientMock, namespaceTags: testNamespace, rootVolumes: rootVolumes}
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(updateInstances("ami-new", "ami-old"), nil)
+	clientMock.EXPECT().DescribeInstanceStatus(
+		&ec2.DescribeInstanceStatusInput{InstanceIds: []*string{aws.String("b")}}).
+		Return(&ec2.DescribeInstanceStatusOutput{InstanceStatuses: []*ec2.InstanceStatus{{
+			InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+			SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+		}}}, nil)
+
+	// The instance is kept, so no instance is launched or terminated.
+	err := pluginImpl.RollingUpdate(
+		map[string]string{GroupTag: "workers"},
+		updateJSON,
+		UpdateOptions{BatchSize: 1, HealthTimeout: time.Minute, ReplaceRootVolume: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b=ami-new"}, rootVolumes.replaced)
+}
+
+func TestRootVolumeReplacementFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	rootVolumes := &fakeRootVolumes{state: ec2ext.ReplaceRootVolumeTaskStateFailed}
+	pluginImpl := &awsInstancePlugin{client: clientMock, namespaceTags: testNamespace, rootVolumes: rootVolumes}
+
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(updateInstances("ami-old"), nil)
+
+	err := pluginImpl.RollingUpdate(
+		map[string]string{GroupTag: "workers"},
+		updateJSON,
+		UpdateOptions{BatchSize: 1, HealthTimeout: time.Minute, ReplaceRootVolume: true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed")
+}
+
+func TestReplacesRootVolume(t *testing.T) {
+	request, err := parseRequest(updateJSON)
+	require.NoError(t, err)
+
+	sameType := &ec2.Instance{InstanceType: aws.String("t2.micro")}
+	otherType := &ec2.Instance{InstanceType: aws.String("t2.large")}
+	options := UpdateOptions{ReplaceRootVolume: true}
+
+	require.True(t, replacesRootVolume(sameType, request, options))
+	require.False(t, replacesRootVolume(otherType, request, options))
+	require.False(t, replacesRootVolume(sameType, request, UpdateOptions{}))
+}
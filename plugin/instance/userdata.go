@@ -0,0 +1,62 @@
+package instance
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+)
+
+// maxUserDataSize is the limit of EC2 on the size of user data, before it is base64 encoded.
+const maxUserDataSize = 16 * 1024
+
+// gzipMagic are the leading bytes of gzip data, which cloud-init recognizes and decompresses.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// prepareUserData checks that user data fits the limit of EC2, compressing it with gzip first if requested.
+func prepareUserData(userData string, compress bool) (string, error) {
+	prepared := []byte(userData)
+	if compress {
+		buffer := bytes.Buffer{}
+		writer, err := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+		if err != nil {
+			return "", err
+		}
+		if _, err := writer.Write(prepared); err != nil {
+			return "", err
+		}
+		if err := writer.Close(); err != nil {
+			return "", err
+		}
+		prepared = buffer.Bytes()
+	}
+
+	if len(prepared) > maxUserDataSize {
+		if compress {
+			return "", fmt.Errorf(
+				"User data is %d bytes compressed from %d bytes, exceeding the limit of %d bytes",
+				len(prepared),
+				len(userData),
+				maxUserDataSize)
+		}
+		return "", fmt.Errorf(
+			"User data is %d bytes, exceeding the limit of %d bytes; set CompressUserData to compress it",
+			len(prepared),
+			maxUserDataSize)
+	}
+	return string(prepared), nil
+}
+
+// decompressUserData reverses the compression of user data, if it is compressed.
+func decompressUserData(userData []byte) ([]byte, error) {
+	if !bytes.HasPrefix(userData, gzipMagic) {
+		return userData, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(userData))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,74 @@
+package instance
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestPrepareUserData(t *testing.T) {
+	userData, err := prepareUserData("#!/bin/sh", false)
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh", userData)
+
+	large := "#!/bin/sh\n" + strings.Repeat("echo infrakit\n", 2000)
+	_, err = prepareUserData(large, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "28010 bytes")
+
+	compressed, err := prepareUserData(large, true)
+	require.NoError(t, err)
+	require.True(t, len(compressed) < maxUserDataSize)
+
+	decompressed, err := decompressUserData([]byte(compressed))
+	require.NoError(t, err)
+	require.Equal(t, large, string(decompressed))
+
+	// Data that does not compress below the limit is still rejected.
+	random := make([]byte, 2*maxUserDataSize)
+	_, err = rand.Read(random)
+	require.NoError(t, err)
+	_, err = prepareUserData(string(random), true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "compressed from 32768 bytes")
+}
+
+func TestDecompressUncompressedUserData(t *testing.T) {
+	userData, err := decompressUserData([]byte("#!/bin/sh"))
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh", string(userData))
+}
+
+func TestProvisionWithCompressedUserData(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	var userData string
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			userData = *input.UserData
+		}).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("test-id")}}})
+
+	init := strings.Repeat("echo infrakit\n", 2000)
+	properties := json.RawMessage(`{"CompressUserData": true}`)
+	_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: tags, Init: init})
+	require.NoError(t, err)
+
+	decoded, err := base64.StdEncoding.DecodeString(userData)
+	require.NoError(t, err)
+	decompressed, err := decompressUserData(decoded)
+	require.NoError(t, err)
+	require.Equal(t, init, string(decompressed))
+}
@@ -0,0 +1,200 @@
+package instance
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+)
+
+const (
+	// UserDataReplace uses the init of the flavor in place of the UserData of the properties.
+	UserDataReplace = "replace"
+
+	// UserDataPrepend runs the UserData of the properties before the init of the flavor, as a single shell script.
+	UserDataPrepend = "prepend"
+
+	// UserDataAppend runs the UserData of the properties after the init of the flavor, as a single shell script.
+	UserDataAppend = "append"
+
+	// UserDataMultipart runs the UserData of the properties and then the init of the flavor, as parts of MIME
+	// multi-part user data.
+	UserDataMultipart = "multipart"
+
+	// userDataMarker precedes the source of each section of a merged shell script.
+	userDataMarker = "# infrakit.user-data: "
+
+	// Sources of user data.
+	cloudConfigSource = "cloud-config"
+	propertiesSource  = "properties"
+	initSource        = "init"
+	mergedSource      = "merged"
+)
+
+func validateUserDataMerge(mode string) error {
+	switch mode {
+	case "", UserDataReplace, UserDataPrepend, UserDataAppend, UserDataMultipart:
+		return nil
+	}
+	return fmt.Errorf("UserDataMerge must be one of %s, %s, %s, or %s: %s",
+		UserDataReplace, UserDataPrepend, UserDataAppend, UserDataMultipart, mode)
+}
+
+// mergeUserData combines the UserData of the properties with the init of the flavor.  When only one of them is set, it
+// is used as is.
+func mergeUserData(properties, init, mode string) ([]userDataPart, error) {
+	switch {
+	case properties == "" && init == "":
+		return nil, nil
+	case init == "":
+		return []userDataPart{{propertiesSource, properties}}, nil
+	case properties == "":
+		return []userDataPart{{initSource, init}}, nil
+	}
+
+	switch mode {
+	case UserDataPrepend:
+		merged, err := concatenateScripts(mode, userDataPart{propertiesSource, properties}, userDataPart{initSource, init})
+		return []userDataPart{{mergedSource, merged}}, err
+	case UserDataAppend:
+		merged, err := concatenateScripts(mode, userDataPart{initSource, init}, userDataPart{propertiesSource, properties})
+		return []userDataPart{{mergedSource, merged}}, err
+	case UserDataMultipart:
+		return []userDataPart{{propertiesSource, properties}, {initSource, init}}, nil
+	}
+
+	if properties != init {
+		log.Warnf("The init of the flavor replaces the UserData of the properties; set UserDataMerge to combine them")
+	}
+	return []userDataPart{{initSource, init}}, nil
+}
+
+// concatenateScripts concatenates shell scripts of the same interpreter, marking the source of each section.
+func concatenateScripts(mode string, first, second userDataPart) (string, error) {
+	firstLines := strings.SplitN(first.content, "\n", 2)
+	secondLines := strings.SplitN(second.content, "\n", 2)
+	if !strings.HasPrefix(firstLines[0], "#!") || firstLines[0] != secondLines[0] {
+		return "", fmt.Errorf(
+			"UserDataMerge %s requires shell scripts of the same interpreter, found %q and %q; use %s instead",
+			mode,
+			firstLines[0],
+			secondLines[0],
+			UserDataMultipart)
+	}
+
+	script := firstLines[0] + "\n"
+	for _, section := range []struct {
+		source string
+		lines  []string
+	}{{first.source, firstLines}, {second.source, secondLines}} {
+		script += userDataMarker + section.source + "\n"
+		if len(section.lines) == 2 && section.lines[1] != "" {
+			script += strings.TrimSuffix(section.lines[1], "\n") + "\n"
+		}
+	}
+	return script, nil
+}
+
+// renderUserData sets the user data of a request from its UserData, the init of the flavor, and its CloudConfig.  The
+// CloudConfig, along with the hostname if it is set, is rendered as the first part of multi-part user data.
+func renderUserData(request *CreateInstanceRequest, init, hostname string) error {
+	parts, err := mergeUserData(aws.StringValue(request.RunInstancesInput.UserData), init, request.UserDataMerge)
+	if err != nil {
+		return err
+	}
+
+	if request.CloudConfig != nil || hostname != "" {
+		config := CloudConfig{}
+		if request.CloudConfig != nil {
+			config = *request.CloudConfig
+		}
+		rendered, err := config.render(hostname)
+		if err != nil {
+			return err
+		}
+		parts = append([]userDataPart{{cloudConfigSource, rendered}}, parts...)
+	}
+
+	switch len(parts) {
+	case 0:
+		return nil
+	case 1:
+		request.RunInstancesInput.UserData = aws.String(parts[0].content)
+		return nil
+	}
+	userData, err := multipartUserData(parts...)
+	if err != nil {
+		return err
+	}
+	request.RunInstancesInput.UserData = aws.String(userData)
+	return nil
+}
+
+// parseMultipartUserData returns the parts of multi-part user data rendered by the plugin.
+func parseMultipartUserData(userData string) ([]userDataPart, bool) {
+	headerAndBody := strings.SplitN(userData, "\n\n", 2)
+	if len(headerAndBody) != 2 {
+		return nil, false
+	}
+	mediaType, params, err := mime.ParseMediaType(
+		strings.TrimPrefix(strings.SplitN(headerAndBody[0], "\n", 2)[0], "Content-Type: "))
+	if err != nil || mediaType != "multipart/mixed" || params["boundary"] != userDataBoundary {
+		return nil, false
+	}
+
+	parts := []userDataPart{}
+	reader := multipart.NewReader(strings.NewReader(headerAndBody[1]), userDataBoundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return parts, true
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, userDataPart{part.Header.Get(userDataPartHeader), string(content)})
+	}
+}
+
+// initOf recovers the init of the flavor from the user data of an instance, which the plugin may have merged with
+// the UserData and CloudConfig of its properties.  User data not merged by the plugin is returned as is.
+func initOf(userData string) string {
+	parts, rendered := parseMultipartUserData(userData)
+	if !rendered {
+		parts = []userDataPart{{mergedSource, userData}}
+	}
+
+	for _, part := range parts {
+		switch {
+		case part.source == initSource:
+			return part.content
+		case part.source == mergedSource && strings.Contains(part.content, "\n"+userDataMarker+initSource+"\n"):
+			return initOfScript(part.content)
+		}
+	}
+	if rendered {
+		return ""
+	}
+	return userData
+}
+
+// initOfScript returns the section of a merged shell script from the init of the flavor.
+func initOfScript(script string) string {
+	lines := strings.Split(script, "\n")
+	init := []string{lines[0]}
+	inInit := false
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, userDataMarker) {
+			inInit = line == userDataMarker+initSource
+			continue
+		}
+		if inInit {
+			init = append(init, line)
+		}
+	}
+	return strings.TrimSuffix(strings.Join(init, "\n"), "\n") + "\n"
+}
@@ -0,0 +1,84 @@
+package instance
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMergeUserData(t *testing.T) {
+	properties := "#!/bin/sh\necho properties\n"
+	init := "#!/bin/sh\necho init\n"
+
+	parts, err := mergeUserData(properties, "", "")
+	require.NoError(t, err)
+	require.Equal(t, []userDataPart{{propertiesSource, properties}}, parts)
+
+	parts, err = mergeUserData(properties, init, "")
+	require.NoError(t, err)
+	require.Equal(t, []userDataPart{{initSource, init}}, parts)
+
+	parts, err = mergeUserData(properties, init, UserDataPrepend)
+	require.NoError(t, err)
+	require.Equal(t, []userDataPart{{mergedSource,
+		"#!/bin/sh\n# infrakit.user-data: properties\necho properties\n# infrakit.user-data: init\necho init\n"}}, parts)
+
+	parts, err = mergeUserData(properties, init, UserDataAppend)
+	require.NoError(t, err)
+	require.Equal(t, []userDataPart{{mergedSource,
+		"#!/bin/sh\n# infrakit.user-data: init\necho init\n# infrakit.user-data: properties\necho properties\n"}}, parts)
+
+	parts, err = mergeUserData(properties, init, UserDataMultipart)
+	require.NoError(t, err)
+	require.Equal(t, []userDataPart{{propertiesSource, properties}, {initSource, init}}, parts)
+
+	_, err = mergeUserData("#cloud-config\n{}\n", init, UserDataPrepend)
+	require.Error(t, err)
+	_, err = mergeUserData("#!/bin/bash\necho properties\n", init, UserDataAppend)
+	require.Error(t, err)
+
+	require.Error(t, validateUserDataMerge("interleave"))
+}
+
+func TestRenderUserData(t *testing.T) {
+	request := CreateInstanceRequest{}
+	require.NoError(t, renderUserData(&request, "", ""))
+	require.Nil(t, request.RunInstancesInput.UserData)
+
+	request.RunInstancesInput.UserData = aws.String("#cloud-config\n{}\n")
+	require.NoError(t, renderUserData(&request, "", ""))
+	require.Equal(t, "#cloud-config\n{}\n", *request.RunInstancesInput.UserData)
+
+	request.UserDataMerge = UserDataMultipart
+	require.NoError(t, renderUserData(&request, "#!/bin/sh\necho init\n", "workers-1"))
+	parts, rendered := parseMultipartUserData(*request.RunInstancesInput.UserData)
+	require.True(t, rendered)
+	require.Equal(t, []userDataPart{
+		{cloudConfigSource, "#cloud-config\n{\"hostname\":\"workers-1\"}\n"},
+		{propertiesSource, "#cloud-config\n{}\n"},
+		{initSource, "#!/bin/sh\necho init\n"},
+	}, parts)
+}
+
+func TestInitOf(t *testing.T) {
+	init := "#!/bin/sh\necho init\n"
+	require.Equal(t, init, initOf(init))
+
+	for _, mode := range []string{UserDataReplace, UserDataPrepend, UserDataAppend, UserDataMultipart} {
+		request := CreateInstanceRequest{UserDataMerge: mode, CloudConfig: &CloudConfig{Packages: []string{"jq"}}}
+		request.RunInstancesInput.UserData = aws.String("#!/bin/sh\necho properties\n")
+		require.NoError(t, renderUserData(&request, init, ""))
+		require.Equal(t, init, initOf(*request.RunInstancesInput.UserData), mode)
+
+		request = CreateInstanceRequest{UserDataMerge: mode}
+		request.RunInstancesInput.UserData = aws.String("#!/bin/sh\necho properties\n")
+		require.NoError(t, renderUserData(&request, init, ""))
+		require.Equal(t, init, initOf(*request.RunInstancesInput.UserData), mode)
+	}
+
+	// User data rendered without an init has no init to recover.
+	request := CreateInstanceRequest{CloudConfig: &CloudConfig{Packages: []string{"jq"}}}
+	request.RunInstancesInput.UserData = aws.String("#!/bin/sh\necho properties\n")
+	require.NoError(t, renderUserData(&request, "", ""))
+	require.Equal(t, "", initOf(*request.RunInstancesInput.UserData))
+}
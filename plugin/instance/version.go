@@ -0,0 +1,72 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/infrakit.aws/plugin/migrate"
+	"github.com/docker/infrakit.aws/plugin/strict"
+)
+
+// RequestSchema is the schema of the plugin properties of a group, which are decoded as a CreateInstanceRequest.
+// Properties of older versions are upgraded when they are parsed.
+var RequestSchema = migrate.Schema{
+	Name: "instance properties",
+	Migrations: []migrate.Migration{
+		{
+			// Version 1 names the launch request RunInstancesInput, which earlier properties named
+			// run_instances_input.  The old name is otherwise ignored when decoding.
+			Version: 1,
+			Upgrade: func(document migrate.Document) error {
+				return document.Rename("run_instances_input", "RunInstancesInput")
+			},
+		},
+	},
+}
+
+// parseRequest upgrades and decodes plugin properties, rejecting fields that are not properties.
+func parseRequest(properties json.RawMessage) (CreateInstanceRequest, error) {
+	request := CreateInstanceRequest{}
+
+	upgraded, err := RequestSchema.Upgrade(properties)
+	if err != nil {
+		return request, err
+	}
+
+	if err := strict.Unmarshal(upgraded, &request); err != nil {
+		return request, fmt.Errorf("Invalid input formatting: %s", err)
+	}
+	if request.EnclaveOptions != nil && request.EnclaveOptions.Enabled &&
+		request.HibernationOptions != nil && request.HibernationOptions.Configured {
+
+		return request, errors.New("EnclaveOptions and HibernationOptions may not both be enabled")
+	}
+	if err := request.EdgeLocation.validate(request); err != nil {
+		return request, err
+	}
+	if err := request.PurchaseMix.validate(); err != nil {
+		return request, err
+	}
+	if err := validateMetadataOptions(request.MetadataOptions); err != nil {
+		return request, err
+	}
+	if err := request.validateBalanceZones(); err != nil {
+		return request, err
+	}
+	if err := request.Name.validate(); err != nil {
+		return request, err
+	}
+	if err := request.CloudConfig.validate(); err != nil {
+		return request, err
+	}
+	if err := validateUserDataMerge(request.UserDataMerge); err != nil {
+		return request, err
+	}
+	if err := request.validateHealthSources(); err != nil {
+		return request, err
+	}
+	if err := request.Confirmation.validate(); err != nil {
+		return request, err
+	}
+	return request, nil
+}
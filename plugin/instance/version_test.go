@@ -0,0 +1,36 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseRequestUpgrades(t *testing.T) {
+	request, err := parseRequest(json.RawMessage(`{"run_instances_input": {"ImageId": "ami-1"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "ami-1", *request.RunInstancesInput.ImageId)
+	require.Equal(t, RequestSchema.Current(), request.Version)
+
+	request, err = parseRequest(json.RawMessage(`{"Version": 1, "RunInstancesInput": {"ImageId": "ami-2"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "ami-2", *request.RunInstancesInput.ImageId)
+}
+
+func TestValidateRejectsFutureVersions(t *testing.T) {
+	pluginImpl := awsInstancePlugin{}
+	require.NoError(t, pluginImpl.Validate(json.RawMessage(`{"RunInstancesInput": {}}`)))
+
+	err := pluginImpl.Validate(json.RawMessage(`{"Version": 99, "RunInstancesInput": {}}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "newer than the latest supported version")
+
+	require.Error(t, pluginImpl.Validate(json.RawMessage(`{"RunInstancesInput": []}`)))
+}
+
+func TestValidateRejectsUnknownFields(t *testing.T) {
+	pluginImpl := awsInstancePlugin{}
+	err := pluginImpl.Validate(json.RawMessage(`{"RunInstancesInput": {"ImageID": "ami-1", "InstanceTyp": "t2.micro"}}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Unknown field RunInstancesInput.InstanceTyp, did you mean InstanceType?")
+}
@@ -0,0 +1,296 @@
+package instance
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"sync"
+	"time"
+)
+
+const (
+	// WarmPoolTag is the AWS tag name used to identify stopped instances held in a warm pool.
+	WarmPoolTag = "infrakit.warm-pool"
+)
+
+// WarmPool configures a pool of pre-provisioned, stopped instances.  When an instance is provisioned, a stopped
+// instance from the pool is started in place of launching a new instance.  Provisioning falls back to launching a
+// new instance when the pool is empty.
+//
+// Instances in the pool are launched without user data, and are stopped on a subsequent provision once they are
+// running.  The user data of a claimed instance is replaced before it is started, so the image must be configured
+// to run user data on every boot.
+type WarmPool struct {
+	// Size is the number of stopped instances to keep available.
+	Size int
+}
+
+// warmPoolClaims tracks the warm pool instances being claimed by provisions in progress.  A claimed instance remains
+// stopped and tagged with its pool until its claim completes, so concurrent provisions of a pool would otherwise claim
+// the same instance.
+type warmPoolClaims struct {
+	lock    sync.Mutex
+	claimed map[string]bool
+}
+
+func newWarmPoolClaims() *warmPoolClaims {
+	return &warmPoolClaims{claimed: map[string]bool{}}
+}
+
+// claim reserves the first of the stopped instances of a pool that is not claimed by another provision, and returns
+// a function that releases the reservation, or nil if every instance is claimed.
+func (c *warmPoolClaims) claim(stopped []*ec2.Instance) (*ec2.Instance, func()) {
+	if c == nil {
+		if len(stopped) == 0 {
+			return nil, nil
+		}
+		return stopped[0], func() {}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, ec2Instance := range stopped {
+		id := aws.StringValue(ec2Instance.InstanceId)
+		if c.claimed[id] {
+			continue
+		}
+		c.claimed[id] = true
+		return ec2Instance, func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			delete(c.claimed, id)
+		}
+	}
+	return nil, nil
+}
+
+// warmPoolFills serializes the filling of each warm pool, and tracks the instances launched to fill it.  Concurrent
+// provisions would otherwise each see the same shortfall and launch it, as would a provision that follows before the
+// instances launched by the previous one are visible to DescribeInstances.
+type warmPoolFills struct {
+	lock  sync.Mutex
+	pools map[string]*warmPoolFill
+}
+
+type warmPoolFill struct {
+	lock     sync.Mutex
+	launched map[string]time.Time
+}
+
+func newWarmPoolFills() *warmPoolFills {
+	return &warmPoolFills{pools: map[string]*warmPoolFill{}}
+}
+
+// fill locks a pool for filling, returning the function that unlocks it.
+func (f *warmPoolFills) fill(key string) (*warmPoolFill, func()) {
+	if f == nil {
+		return nil, func() {}
+	}
+
+	f.lock.Lock()
+	pool, has := f.pools[key]
+	if !has {
+		pool = &warmPoolFill{launched: map[string]time.Time{}}
+		f.pools[key] = pool
+	}
+	f.lock.Unlock()
+
+	pool.lock.Lock()
+	return pool, pool.lock.Unlock
+}
+
+// inFlight counts the instances launched for a pool within the visibility window that are not among its members,
+// forgetting the others.
+func (f *warmPoolFill) inFlight(members []*ec2.Instance) int {
+	if f == nil {
+		return 0
+	}
+
+	visible := map[string]bool{}
+	for _, member := range members {
+		visible[aws.StringValue(member.InstanceId)] = true
+	}
+
+	count := 0
+	for id, launched := range f.launched {
+		if visible[id] || time.Since(launched) > launchVisibilityWindow {
+			delete(f.launched, id)
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+func (f *warmPoolFill) record(reservation *ec2.Reservation) {
+	if f == nil || reservation == nil {
+		return
+	}
+	for _, ec2Instance := range reservation.Instances {
+		f.launched[aws.StringValue(ec2Instance.InstanceId)] = time.Now()
+	}
+}
+
+// warmPoolKey identifies the pool for a request, such that instances are only reused for identical configurations.
+// User data is excluded since it is replaced when an instance is claimed.
+func warmPoolKey(request CreateInstanceRequest) (string, error) {
+	runInstancesInput := request.RunInstancesInput
+	runInstancesInput.UserData = nil
+
+	config, err := json.Marshal(struct {
+		Tags              map[string]string
+		RunInstancesInput ec2.RunInstancesInput
+	}{Tags: request.Tags, RunInstancesInput: runInstancesInput})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha1.Sum(config)
+	return hex.EncodeToString(hash[:])[:16], nil
+}
+
+func (p awsInstancePlugin) describeWarmPool(key string, states ...string) ([]*ec2.Instance, error) {
+	stateValues := []*string{}
+	for _, state := range states {
+		stateValues = append(stateValues, aws.String(state))
+	}
+
+	filters := []*ec2.Filter{
+		{Name: aws.String("instance-state-name"), Values: stateValues},
+		{Name: aws.String(fmt.Sprintf("tag:%s", WarmPoolTag)), Values: []*string{aws.String(key)}},
+	}
+
+	keys, namespaceTags := mergeTags(p.namespaceTags)
+	for _, k := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", k)),
+			Values: []*string{aws.String(namespaceTags[k])},
+		})
+	}
+
+	instances := []*ec2.Instance{}
+	input := ec2.DescribeInstancesInput{Filters: filters}
+	for {
+		result, err := p.client.DescribeInstances(&input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, reservation := range result.Reservations {
+			instances = append(instances, reservation.Instances...)
+		}
+
+		if result.NextToken == nil {
+			return instances, nil
+		}
+		input.NextToken = result.NextToken
+	}
+}
+
+// claimWarmInstance starts a stopped instance from the warm pool, tagging it with its name, if any, and returning nil
+// if the pool is empty.
+func (p awsInstancePlugin) claimWarmInstance(
+	key string,
+	spec instance.Spec,
+	request CreateInstanceRequest,
+	name string) (*instance.ID, error) {
+
+	stopped, err := p.describeWarmPool(key, ec2.InstanceStateNameStopped)
+	if err != nil {
+		return nil, err
+	}
+	ec2Instance, release := p.warmClaims.claim(stopped)
+	if ec2Instance == nil {
+		log.Infof("Warm pool %s is empty, launching a new instance", key)
+		return nil, nil
+	}
+	defer release()
+
+	id := (*instance.ID)(ec2Instance.InstanceId)
+	log.Infof("Claiming instance %s from warm pool %s", *id, key)
+
+	_, err = p.client.DeleteTags(&ec2.DeleteTagsInput{
+		Resources: []*string{ec2Instance.InstanceId},
+		Tags:      []*ec2.Tag{{Key: aws.String(WarmPoolTag)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	systemTags := map[string]string{}
+	for k, v := range spec.Tags {
+		systemTags[k] = v
+	}
+	if name != "" {
+		systemTags[NameTag] = name
+	}
+	err = p.tagInstance(ec2Instance, systemTags, request.Tags)
+	if err != nil {
+		return id, err
+	}
+
+	if request.RunInstancesInput.UserData != nil {
+		_, err = p.client.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+			InstanceId: ec2Instance.InstanceId,
+			UserData:   &ec2.BlobAttributeValue{Value: []byte(*request.RunInstancesInput.UserData)},
+		})
+		if err != nil {
+			return id, err
+		}
+	}
+
+	return id, p.Start(*id)
+}
+
+// fillWarmPool stops pool instances that have finished launching, and launches instances to replace those that
+// were claimed.  Pools are filled by one provision at a time, counting the instances launched by earlier fills.
+func (p awsInstancePlugin) fillWarmPool(key string, request CreateInstanceRequest) {
+	pool, unlock := p.warmFills.fill(key)
+	defer unlock()
+
+	members, err := p.describeWarmPool(
+		key,
+		ec2.InstanceStateNamePending,
+		ec2.InstanceStateNameRunning,
+		ec2.InstanceStateNameStopping,
+		ec2.InstanceStateNameStopped)
+	if err != nil {
+		log.Warnf("Failed to describe warm pool %s: %s", key, err)
+		return
+	}
+
+	for _, member := range members {
+		if *member.State.Name == ec2.InstanceStateNameRunning {
+			if err := p.Stop(instance.ID(*member.InstanceId)); err != nil {
+				log.Warnf("Failed to stop warm pool instance %s: %s", *member.InstanceId, err)
+			}
+		}
+	}
+
+	missing := request.WarmPool.Size - len(members) - pool.inFlight(members)
+	if missing <= 0 {
+		return
+	}
+
+	log.Infof("Launching %d instances for warm pool %s", missing, key)
+	launch := request.RunInstancesInput
+	launch.UserData = nil
+	launch.MinCount = aws.Int64(int64(missing))
+	launch.MaxCount = aws.Int64(int64(missing))
+
+	reservation, err := p.runInstances(
+		&launch,
+		p.ec2Tags(map[string]string{WarmPoolTag: key}, map[string]string{}),
+		request)
+	if err != nil {
+		log.Warnf("Failed to launch warm pool instances: %s", err)
+		return
+	}
+	pool.record(reservation)
+}
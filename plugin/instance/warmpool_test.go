@@ -0,0 +1,150 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var warmPoolJSON = json.RawMessage(`{
+    "Tags": {"test": "aws-create-test"},
+    "RunInstancesInput": {
+        "ImageId": "ami-30ee0d50",
+        "InstanceType": "t2.micro"
+    },
+    "WarmPool": {"Size": 2}
+}`)
+
+func warmInstance(id string, state string) *ec2.Instance {
+	return &ec2.Instance{InstanceId: aws.String(id), State: &ec2.InstanceState{Name: aws.String(state)}}
+}
+
+func TestProvisionFromWarmPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace}
+
+	gomock.InOrder(
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+				{Instances: []*ec2.Instance{warmInstance("warm-1", ec2.InstanceStateNameStopped)}},
+			}}, nil),
+		clientMock.EXPECT().DeleteTags(gomock.Any()).Return(&ec2.DeleteTagsOutput{}, nil),
+		clientMock.EXPECT().CreateTags(gomock.Any()).Return(&ec2.CreateTagsOutput{}, nil),
+		clientMock.EXPECT().ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+			InstanceId: aws.String("warm-1"),
+			UserData:   &ec2.BlobAttributeValue{Value: []byte("echo hello")},
+		}).Return(&ec2.ModifyInstanceAttributeOutput{}, nil),
+		clientMock.EXPECT().StartInstances(gomock.Any()).
+			Return(&ec2.StartInstancesOutput{
+				StartingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("warm-1")}}},
+				nil),
+
+		// Replenish the pool, stopping an instance that finished launching.
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+				{Instances: []*ec2.Instance{warmInstance("warm-2", ec2.InstanceStateNameRunning)}},
+			}}, nil),
+		clientMock.EXPECT().StopInstances(gomock.Any()).
+			Return(&ec2.StopInstancesOutput{
+				StoppingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("warm-2")}}},
+				nil),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, int64(1), *input.MaxCount)
+				require.Nil(t, input.UserData)
+			}).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("warm-3")}}}),
+	)
+
+	id, err := pluginImpl.Provision(instance.Spec{Properties: &warmPoolJSON, Tags: tags, Init: "echo hello"})
+	require.NoError(t, err)
+	require.Equal(t, "warm-1", string(*id))
+}
+
+func TestWarmPoolClaims(t *testing.T) {
+	claims := newWarmPoolClaims()
+	stopped := []*ec2.Instance{
+		warmInstance("warm-1", ec2.InstanceStateNameStopped),
+		warmInstance("warm-2", ec2.InstanceStateNameStopped),
+	}
+
+	claimed, release := claims.claim(stopped)
+	require.Equal(t, "warm-1", *claimed.InstanceId)
+
+	// A concurrent provision skips the claimed instance.
+	next, releaseNext := claims.claim(stopped)
+	require.Equal(t, "warm-2", *next.InstanceId)
+
+	none, _ := claims.claim(stopped)
+	require.Nil(t, none)
+
+	release()
+	releaseNext()
+	claimed, release = claims.claim(stopped)
+	require.Equal(t, "warm-1", *claimed.InstanceId)
+	release()
+}
+
+func TestFillWarmPoolCountsLaunchesInFlight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := awsInstancePlugin{client: clientMock, namespaceTags: testNamespace, warmFills: newWarmPoolFills()}
+	request, err := parseRequest(warmPoolJSON)
+	require.NoError(t, err)
+
+	// The instances launched by the first fill are not yet visible to the next.
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil).Times(2)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			require.Equal(t, int64(2), *input.MaxCount)
+		}).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{
+			{InstanceId: aws.String("warm-1")},
+			{InstanceId: aws.String("warm-2")},
+		}})
+
+	pluginImpl.fillWarmPool("pool", request)
+	pluginImpl.fillWarmPool("pool", request)
+
+	// Once visible, the instances are counted as members, and those that never became visible are no longer counted
+	// once the visibility window passes.
+	clientMock.EXPECT().DescribeInstances(gomock.Any()).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{
+			warmInstance("warm-1", ec2.InstanceStateNameStopped),
+		}}}}, nil)
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			require.Equal(t, int64(1), *input.MaxCount)
+		}).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("warm-3")}}})
+
+	pluginImpl.warmFills.pools["pool"].launched["warm-2"] = time.Now().Add(-launchVisibilityWindow - time.Second)
+	pluginImpl.fillWarmPool("pool", request)
+}
+
+func TestWarmPoolKey(t *testing.T) {
+	request := CreateInstanceRequest{RunInstancesInput: ec2.RunInstancesInput{ImageId: aws.String("ami-1")}}
+	key, err := warmPoolKey(request)
+	require.NoError(t, err)
+
+	request.RunInstancesInput.UserData = aws.String("echo hello")
+	sameKey, err := warmPoolKey(request)
+	require.NoError(t, err)
+	require.Equal(t, key, sameKey)
+
+	request.RunInstancesInput.ImageId = aws.String("ami-2")
+	otherKey, err := warmPoolKey(request)
+	require.NoError(t, err)
+	require.NotEqual(t, key, otherKey)
+}
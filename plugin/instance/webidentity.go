@@ -0,0 +1,119 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// WebIdentityProviderName is the name of the credentials provider that assumes a role with a web identity token.
+	WebIdentityProviderName = "WebIdentityProvider"
+)
+
+// webIdentityRoler is the part of the STS API used to assume a role with a web identity token.
+type webIdentityRoler interface {
+	AssumeRoleWithWebIdentity(*sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error)
+}
+
+// webIdentityProvider retrieves credentials by assuming a role with an OIDC token read from a file, such as the
+// service account token that EKS projects into pods with IAM roles for service accounts.  The token is read on each
+// retrieval, since it is rotated while the plugin runs.
+type webIdentityProvider struct {
+	credentials.Expiry
+
+	client      webIdentityRoler
+	roleARN     string
+	tokenFile   string
+	sessionName string
+
+	// renewWindow is how long before they expire credentials are renewed.
+	renewWindow time.Duration
+
+	expiration time.Time
+}
+
+// webIdentityOptions locate the token and role of web identity credentials.
+type webIdentityOptions struct {
+	tokenFile   string
+	roleARN     string
+	sessionName string
+}
+
+// fromEnvironment fills options that are not set from the environment variables set by EKS.
+func (o webIdentityOptions) fromEnvironment() webIdentityOptions {
+	if o.tokenFile == "" {
+		o.tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	if o.roleARN == "" {
+		o.roleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+	if o.sessionName == "" {
+		o.sessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
+	}
+	if o.sessionName == "" {
+		o.sessionName = fmt.Sprintf("infrakit-%d", time.Now().UnixNano())
+	}
+	return o
+}
+
+// configured determines whether web identity credentials are used.  Both the token file and the role are required.
+func (o webIdentityOptions) configured() (bool, error) {
+	switch {
+	case o.tokenFile == "" && o.roleARN == "":
+		return false, nil
+	case o.tokenFile == "":
+		return false, errors.New("A web identity token file is required to assume a role with a web identity")
+	case o.roleARN == "":
+		return false, errors.New("A role ARN is required to use the web identity token file " + o.tokenFile)
+	}
+	return true, nil
+}
+
+func newWebIdentityProvider(client webIdentityRoler, options webIdentityOptions) *webIdentityProvider {
+	return &webIdentityProvider{
+		client:      client,
+		roleARN:     options.roleARN,
+		tokenFile:   options.tokenFile,
+		sessionName: options.sessionName,
+		renewWindow: defaultRenewWindow,
+	}
+}
+
+// Retrieve implements credentials.Provider.Retrieve.
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return credentials.Value{ProviderName: WebIdentityProviderName},
+			fmt.Errorf("Failed to read web identity token: %s", err)
+	}
+
+	result, err := p.client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.roleARN),
+		RoleSessionName:  aws.String(p.sessionName),
+		WebIdentityToken: aws.String(strings.TrimSpace(string(token))),
+	})
+	if err != nil {
+		return credentials.Value{ProviderName: WebIdentityProviderName},
+			fmt.Errorf("Failed to assume role %s with a web identity: %s", p.roleARN, err)
+	}
+
+	p.expiration = aws.TimeValue(result.Credentials.Expiration)
+	p.SetExpiration(p.expiration, p.renewWindow)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(result.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(result.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(result.Credentials.SessionToken),
+		ProviderName:    WebIdentityProviderName,
+	}, nil
+}
+
+func (p *webIdentityProvider) expiresAt() time.Time {
+	return p.expiration
+}
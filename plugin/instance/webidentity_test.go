@@ -0,0 +1,88 @@
+package instance
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeWebIdentityRoler struct {
+	input *sts.AssumeRoleWithWebIdentityInput
+	err   error
+}
+
+func (f *fakeWebIdentityRoler) AssumeRoleWithWebIdentity(
+	input *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+
+	f.input = input
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.AssumeRoleWithWebIdentityOutput{Credentials: &sts.Credentials{
+		AccessKeyId:     aws.String("key"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func TestWebIdentityProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web-identity")
+	require.NoError(t, err)
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("oidc-token\n"), 0600))
+
+	client := &fakeWebIdentityRoler{}
+	provider := newWebIdentityProvider(client, webIdentityOptions{
+		tokenFile:   tokenFile,
+		roleARN:     "arn:aws:iam::123456789012:role/infrakit",
+		sessionName: "plugin",
+	})
+	require.True(t, provider.IsExpired())
+
+	value, err := provider.Retrieve()
+	require.NoError(t, err)
+	require.Equal(t, "key", value.AccessKeyID)
+	require.Equal(t, "token", value.SessionToken)
+	require.Equal(t, "oidc-token", *client.input.WebIdentityToken)
+	require.Equal(t, "plugin", *client.input.RoleSessionName)
+	require.False(t, provider.IsExpired())
+
+	client.err = errors.New("denied")
+	_, err = provider.Retrieve()
+	require.Error(t, err)
+
+	provider.tokenFile = filepath.Join(dir, "missing")
+	_, err = provider.Retrieve()
+	require.Error(t, err)
+}
+
+func TestWebIdentityOptions(t *testing.T) {
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_ROLE_SESSION_NAME", "")
+
+	configured, err := webIdentityOptions{}.fromEnvironment().configured()
+	require.NoError(t, err)
+	require.False(t, configured)
+
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/token")
+	_, err = webIdentityOptions{}.fromEnvironment().configured()
+	require.Error(t, err)
+
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/infrakit")
+	t.Setenv("AWS_ROLE_SESSION_NAME", "pod")
+	options := webIdentityOptions{}.fromEnvironment()
+	configured, err = options.configured()
+	require.NoError(t, err)
+	require.True(t, configured)
+	require.Equal(t, "pod", options.sessionName)
+
+	options = webIdentityOptions{roleARN: "arn:aws:iam::123456789012:role/other"}.fromEnvironment()
+	require.Equal(t, "arn:aws:iam::123456789012:role/other", options.roleARN)
+}
@@ -0,0 +1,123 @@
+package instance
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/infrakit.aws/plugin/notify"
+	"sync"
+	"time"
+)
+
+// zoneState is the health of an availability zone.
+type zoneState struct {
+	// failures is the number of consecutive launch and health failures in the zone.
+	failures int
+
+	// failed is set while the zone is removed from the placement of instances.
+	failed bool
+
+	// until is the end of the cool-down of a failed zone, after which the zone is probed by the next launch.
+	until time.Time
+}
+
+// zoneHealth detects availability zones with sustained launch and health failures, such as during an outage of the
+// zone, and removes them from the AvailabilityZones of requests.  Once the cool-down of a failed zone ends, launches
+// probe the zone again: a success restores it, while a failure removes it for another cool-down.
+type zoneHealth struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	zones     map[string]*zoneState
+	notifier  notify.Publisher
+}
+
+func newZoneHealth(threshold int, cooldown time.Duration, notifier notify.Publisher) *zoneHealth {
+	if threshold < 1 {
+		return nil
+	}
+	return &zoneHealth{threshold: threshold, cooldown: cooldown, zones: map[string]*zoneState{}, notifier: notifier}
+}
+
+func (h *zoneHealth) state(zone string) *zoneState {
+	state, has := h.zones[zone]
+	if !has {
+		state = &zoneState{}
+		h.zones[zone] = state
+	}
+	return state
+}
+
+func (h *zoneHealth) publish(eventType, zone, reason string) {
+	if h.notifier == nil {
+		return
+	}
+	event := notify.Event{Time: time.Now().UTC(), Type: eventType, AvailabilityZone: zone, Error: reason}
+	if err := h.notifier.Publish(event); err != nil {
+		log.Warnf("Failed to publish %s event of availability zone %s: %s", eventType, zone, err)
+	}
+}
+
+// recordFailure records a launch that failed for lack of capacity in a zone, or an instance in the zone that failed
+// its status checks.
+func (h *zoneHealth) recordFailure(zone string, reason string) {
+	if h == nil || zone == "" {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state := h.state(zone)
+	state.failures++
+	switch {
+	case state.failed:
+		// The probe of the zone failed.
+		state.until = time.Now().Add(h.cooldown)
+		log.Warnf("Availability zone %s is still failing, retrying in %s: %s", zone, h.cooldown, reason)
+	case state.failures >= h.threshold:
+		state.failed = true
+		state.until = time.Now().Add(h.cooldown)
+		log.Warnf("Removing availability zone %s from placement for %s after %d failures: %s",
+			zone, h.cooldown, state.failures, reason)
+		h.publish(notify.ZoneFailed, zone, reason)
+	}
+}
+
+// recordSuccess records a launch or healthy instance in a zone, restoring the zone if it failed.
+func (h *zoneHealth) recordSuccess(zone string) {
+	if h == nil || zone == "" {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state := h.state(zone)
+	state.failures = 0
+	if state.failed {
+		state.failed = false
+		log.Infof("Restoring availability zone %s to placement", zone)
+		h.publish(notify.ZoneRestored, zone, "")
+	}
+}
+
+// available returns the zones that are not failed, or are due to be probed.  When every zone has failed, all of the
+// zones are returned, since an instance may yet be launched in one of them.
+func (h *zoneHealth) available(zones []AvailabilityZoneOption) []AvailabilityZoneOption {
+	if h == nil || len(zones) < 2 {
+		return zones
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	available := []AvailabilityZoneOption{}
+	for _, zone := range zones {
+		state, has := h.zones[zone.AvailabilityZone]
+		if !has || !state.failed || !now.Before(state.until) {
+			available = append(available, zone)
+		}
+	}
+	if len(available) == 0 {
+		log.Warnf("Every availability zone of the instance has failed, placing it in any of them")
+		return zones
+	}
+	return available
+}
@@ -0,0 +1,97 @@
+package instance
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit.aws/plugin/notify"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestZoneFailover(t *testing.T) {
+	publisher := &fakePublisher{}
+	health := newZoneHealth(2, time.Hour, publisher)
+
+	health.recordFailure("us-west-2a", "no capacity")
+	require.Equal(t, []string{"us-west-2a", "us-west-2b", "us-west-2c"}, zoneNames(health.available(balancedZones)))
+
+	// Sustained failures remove the zone until its cool-down ends.
+	health.recordFailure("us-west-2a", "no capacity")
+	require.Equal(t, []string{"us-west-2b", "us-west-2c"}, zoneNames(health.available(balancedZones)))
+	require.Len(t, publisher.events, 1)
+	require.Equal(t, notify.ZoneFailed, publisher.events[0].Type)
+	require.Equal(t, "us-west-2a", publisher.events[0].AvailabilityZone)
+
+	// Once the cool-down ends, a failed probe removes the zone again.
+	health.zones["us-west-2a"].until = time.Now()
+	require.Equal(t, []string{"us-west-2a", "us-west-2b", "us-west-2c"}, zoneNames(health.available(balancedZones)))
+	health.recordFailure("us-west-2a", "no capacity")
+	require.Equal(t, []string{"us-west-2b", "us-west-2c"}, zoneNames(health.available(balancedZones)))
+	require.Len(t, publisher.events, 1)
+
+	// A successful probe restores the zone.
+	health.zones["us-west-2a"].until = time.Now()
+	health.recordSuccess("us-west-2a")
+	require.Equal(t, []string{"us-west-2a", "us-west-2b", "us-west-2c"}, zoneNames(health.available(balancedZones)))
+	require.Len(t, publisher.events, 2)
+	require.Equal(t, notify.ZoneRestored, publisher.events[1].Type)
+
+	// Instances are placed in any zone when every zone has failed.
+	for _, zone := range balancedZones {
+		health.recordFailure(zone.AvailabilityZone, "impaired")
+		health.recordFailure(zone.AvailabilityZone, "impaired")
+	}
+	require.Equal(t, []string{"us-west-2a", "us-west-2b", "us-west-2c"}, zoneNames(health.available(balancedZones)))
+
+	require.Nil(t, newZoneHealth(0, time.Hour, nil))
+}
+
+func TestProvisionSkipsFailedZones(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := &awsInstancePlugin{
+		client:        clientMock,
+		namespaceTags: testNamespace,
+		provisions:    newProvisionLimiter(0),
+		zoneHealth:    newZoneHealth(1, time.Hour, nil),
+	}
+
+	properties := json.RawMessage(`{
+	    "RunInstancesInput": {"Placement": {"AvailabilityZone": "us-west-2a"}},
+	    "AvailabilityZones": [{"AvailabilityZone": "us-west-2a"}, {"AvailabilityZone": "us-west-2b"}]
+	}`)
+	capacityError := awserr.New("InsufficientInstanceCapacity", "no capacity", nil)
+
+	gomock.InOrder(
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "us-west-2a", *input.Placement.AvailabilityZone)
+			}).
+			Return(fakeRequest(capacityError), &ec2.Reservation{}),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "us-west-2b", *input.Placement.AvailabilityZone)
+			}).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}}),
+
+		// The failed zone is not attempted by the next provision.
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "us-west-2b", *input.Placement.AvailabilityZone)
+			}).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-2")}}}),
+	)
+
+	for range []int{1, 2} {
+		_, err := pluginImpl.Provision(instance.Spec{Properties: &properties, Tags: map[string]string{GroupTag: "workers"}})
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,267 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RebalanceOptions controls the rebalancing of a group across its availability zones.
+type RebalanceOptions struct {
+	// HealthTimeout is the maximum time to wait for a replacement instance to pass its status checks.
+	HealthTimeout time.Duration
+
+	// lost stops the rebalancing once the lease it holds is lost.
+	lost leaseLoss
+}
+
+// Rebalancer replaces the instances of a group to restore the balance of the group across its availability zones,
+// such as once a zone recovers from an outage that moved its instances to other zones.
+type Rebalancer interface {
+	// Rebalance replaces instances matching tags in the availability zones of properties with the most instances,
+	// until no zone has more than one instance more than another.
+	Rebalance(tags map[string]string, properties json.RawMessage, options RebalanceOptions) error
+}
+
+func (r CreateInstanceRequest) validateBalanceZones() error {
+	if !r.BalanceZones {
+		return nil
+	}
+	if len(r.AvailabilityZones) < 2 {
+		return errors.New("BalanceZones requires at least two AvailabilityZones")
+	}
+	if r.Spot != nil && r.Spot.CheapestAvailabilityZone {
+		return errors.New("BalanceZones may not be set with Spot CheapestAvailabilityZone")
+	}
+	return nil
+}
+
+func instanceZone(ec2Instance *ec2.Instance) string {
+	if ec2Instance.Placement == nil {
+		return ""
+	}
+	return aws.StringValue(ec2Instance.Placement.AvailabilityZone)
+}
+
+// zoneCounts counts the instances in each of the availability zones.
+func zoneCounts(zones []AvailabilityZoneOption, instances []*ec2.Instance) map[string]int {
+	counts := map[string]int{}
+	for _, zone := range zones {
+		counts[zone.AvailabilityZone] = 0
+	}
+	for _, ec2Instance := range instances {
+		if _, listed := counts[instanceZone(ec2Instance)]; listed {
+			counts[instanceZone(ec2Instance)]++
+		}
+	}
+	return counts
+}
+
+// zonesByCount orders availability zones by ascending instance count.
+type zonesByCount struct {
+	zones  []AvailabilityZoneOption
+	counts map[string]int
+}
+
+func (z zonesByCount) Len() int {
+	return len(z.zones)
+}
+
+func (z zonesByCount) Swap(i, j int) {
+	z.zones[i], z.zones[j] = z.zones[j], z.zones[i]
+}
+
+func (z zonesByCount) Less(i, j int) bool {
+	return z.counts[z.zones[i].AvailabilityZone] < z.counts[z.zones[j].AvailabilityZone]
+}
+
+// zoneBalancer tracks the availability zones chosen by provisions in progress, so that concurrent provisions of a
+// group spread across its zones rather than all choosing the same zone.
+type zoneBalancer struct {
+	lock     sync.Mutex
+	reserved map[string]map[string]int
+}
+
+func newZoneBalancer() *zoneBalancer {
+	return &zoneBalancer{reserved: map[string]map[string]int{}}
+}
+
+// order sorts the availability zones of an instance joining a group with its instances by their instance counts,
+// keeping the listed order of zones with the same count, and returns a function that releases the reservation of the
+// first zone.
+func (b *zoneBalancer) order(
+	key string,
+	zones []AvailabilityZoneOption,
+	instances []*ec2.Instance) ([]AvailabilityZoneOption, func()) {
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.reserved[key] == nil {
+		b.reserved[key] = map[string]int{}
+	}
+	reserved := b.reserved[key]
+
+	counts := zoneCounts(zones, instances)
+	for zone := range counts {
+		counts[zone] += reserved[zone]
+	}
+
+	ordered := zonesByCount{zones: append([]AvailabilityZoneOption{}, zones...), counts: counts}
+	sort.Stable(ordered)
+
+	zone := ordered.zones[0].AvailabilityZone
+	reserved[zone]++
+	return ordered.zones, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		reserved[zone]--
+	}
+}
+
+// balanceZones orders the AvailabilityZones of a request for an instance of a group with BalanceZones, such that the
+// instance is launched in the zone with the fewest instances of the group that has capacity.
+func (p awsInstancePlugin) balanceZones(request *CreateInstanceRequest, tags map[string]string) (func(), error) {
+	group, has := tags[GroupTag]
+	if !has {
+		return nil, errors.New("BalanceZones may only be applied to instances of a group")
+	}
+	if p.zones == nil {
+		return nil, errors.New("BalanceZones is not supported by this plugin")
+	}
+
+	instances, err := p.describeInstances(map[string]string{GroupTag: group}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up the availability zones of group %s: %s", group, err)
+	}
+
+	ordered, release := p.zones.order(groupLockKey(tags), request.AvailabilityZones, instances)
+	request.AvailabilityZones = ordered
+	return release, nil
+}
+
+// Rebalance implements Rebalancer.Rebalance.  Each instance in the zone with the most instances is replaced by an
+// instance launched in the zone with the fewest, which is destroyed once its replacement is healthy.  Instances with
+// a logical ID are not moved, since their private IP address belongs to a subnet.
+func (p awsInstancePlugin) Rebalance(
+	tags map[string]string,
+	properties json.RawMessage,
+	options RebalanceOptions) error {
+
+	request, err := parseRequest(properties)
+	if err != nil {
+		return err
+	}
+	if !request.BalanceZones {
+		return errors.New("Rebalancing requires BalanceZones")
+	}
+
+	moved := map[string]bool{}
+	for {
+		if err := options.lost.err(); err != nil {
+			return fmt.Errorf("Rebalancing stopped: %s", err)
+		}
+
+		instances, err := p.describeInstances(tags, nil)
+		if err != nil {
+			return err
+		}
+
+		counts := zoneCounts(request.AvailabilityZones, instances)
+		fewest, most := "", ""
+		for _, zone := range request.AvailabilityZones {
+			if fewest == "" || counts[zone.AvailabilityZone] < counts[fewest] {
+				fewest = zone.AvailabilityZone
+			}
+			if most == "" || counts[zone.AvailabilityZone] > counts[most] {
+				most = zone.AvailabilityZone
+			}
+		}
+		if counts[most]-counts[fewest] <= 1 {
+			log.Infof("Instances are balanced across availability zones: %v", counts)
+			return nil
+		}
+
+		var candidate *ec2.Instance
+		for _, ec2Instance := range instances {
+			id := aws.StringValue(ec2Instance.InstanceId)
+			if instanceZone(ec2Instance) == most && !moved[id] && !hasTag(ec2Instance, LogicalIDTag) {
+				candidate = ec2Instance
+				break
+			}
+		}
+		if candidate == nil {
+			return fmt.Errorf("No instance in %s may be moved to restore the balance of zones %v", most, counts)
+		}
+		moved[*candidate.InstanceId] = true
+
+		log.Infof("Moving instance %s out of %s, which has %d instances to %d in %s",
+			*candidate.InstanceId, most, counts[most], counts[fewest], fewest)
+		if err := p.move(candidate, fewest, properties, options.HealthTimeout); err != nil {
+			return fmt.Errorf("Failed to move %s: %s", *candidate.InstanceId, err)
+		}
+	}
+}
+
+// launchedZone is the availability zone of an instance provisioned by the plugin, from its launch if it is tracked.
+func (p awsInstancePlugin) launchedZone(id instance.ID) (string, error) {
+	if launched := p.launches.launched(id); launched != nil && instanceZone(launched) != "" {
+		return instanceZone(launched), nil
+	}
+	ec2Instance, err := p.describeInstance(id)
+	if err != nil {
+		return "", err
+	}
+	return instanceZone(ec2Instance), nil
+}
+
+// move replaces an instance by one launched in zone, the zone with the fewest instances of its group, destroying the
+// instance once its replacement is healthy.  A replacement that is launched in another zone, such as when the zone
+// lacks capacity, or that fails to become healthy is destroyed, so that the group does not grow.
+func (p awsInstancePlugin) move(
+	ec2Instance *ec2.Instance,
+	zone string,
+	properties json.RawMessage,
+	timeout time.Duration) error {
+
+	spec, err := p.replacementSpec(ec2Instance, properties)
+	if err != nil {
+		return err
+	}
+
+	id, err := p.Provision(spec)
+	if err != nil {
+		return err
+	}
+
+	launchedZone, err := p.launchedZone(*id)
+	if err == nil && launchedZone != zone {
+		err = fmt.Errorf("Replacement %s was launched in %s rather than %s", *id, launchedZone, zone)
+	}
+	if err == nil {
+		err = p.waitHealthy(*id, timeout)
+	}
+	if err != nil {
+		if destroyErr := p.Destroy(*id); destroyErr != nil {
+			log.Warnf("Failed to destroy replacement %s: %s", *id, destroyErr)
+		}
+		return err
+	}
+	return p.Destroy(instance.ID(*ec2Instance.InstanceId))
+}
+
+func hasTag(ec2Instance *ec2.Instance, key string) bool {
+	for _, tag := range ec2Instance.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package instance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var balancedZones = []AvailabilityZoneOption{
+	{AvailabilityZone: "us-west-2a"},
+	{AvailabilityZone: "us-west-2b"},
+	{AvailabilityZone: "us-west-2c"},
+}
+
+func zonedInstances(zones ...string) []*ec2.Instance {
+	instances := []*ec2.Instance{}
+	for i, zone := range zones {
+		instances = append(instances, &ec2.Instance{
+			InstanceId: aws.String(string('a' + rune(i))),
+			Placement:  &ec2.Placement{AvailabilityZone: aws.String(zone)},
+			Tags:       []*ec2.Tag{{Key: aws.String(GroupTag), Value: aws.String("workers")}},
+		})
+	}
+	return instances
+}
+
+func zoneNames(zones []AvailabilityZoneOption) []string {
+	names := []string{}
+	for _, zone := range zones {
+		names = append(names, zone.AvailabilityZone)
+	}
+	return names
+}
+
+func TestZoneBalancerOrder(t *testing.T) {
+	balancer := newZoneBalancer()
+	instances := zonedInstances("us-west-2a", "us-west-2a", "us-west-2c", "eu-west-1a")
+
+	ordered, release := balancer.order("group/workers", balancedZones, instances)
+	require.Equal(t, []string{"us-west-2b", "us-west-2c", "us-west-2a"}, zoneNames(ordered))
+
+	// Concurrent provisions count the reserved zones.
+	next, releaseNext := balancer.order("group/workers", balancedZones, instances)
+	require.Equal(t, []string{"us-west-2b", "us-west-2c", "us-west-2a"}, zoneNames(next))
+	last, releaseLast := balancer.order("group/workers", balancedZones, instances)
+	require.Equal(t, []string{"us-west-2c", "us-west-2a", "us-west-2b"}, zoneNames(last))
+	releaseLast()
+	releaseNext()
+	release()
+
+	ordered, release = balancer.order("group/workers", balancedZones, instances)
+	require.Equal(t, "us-west-2b", ordered[0].AvailabilityZone)
+	release()
+}
+
+func TestBalanceZonesValidation(t *testing.T) {
+	_, err := parseRequest(json.RawMessage(`{"BalanceZones": true, "AvailabilityZones": [{"AvailabilityZone": "a"}]}`))
+	require.Error(t, err)
+
+	_, err = parseRequest(json.RawMessage(`{
+		"BalanceZones": true,
+		"AvailabilityZones": [{"AvailabilityZone": "a"}, {"AvailabilityZone": "b"}],
+		"Spot": {"CheapestAvailabilityZone": true}
+	}`))
+	require.Error(t, err)
+
+	_, err = parseRequest(json.RawMessage(`{
+		"BalanceZones": true,
+		"AvailabilityZones": [{"AvailabilityZone": "a"}, {"AvailabilityZone": "b"}]
+	}`))
+	require.NoError(t, err)
+}
+
+var balancedJSON = json.RawMessage(`{
+	"BalanceZones": true,
+	"AvailabilityZones": [
+		{"AvailabilityZone": "us-west-2a"},
+		{"AvailabilityZone": "us-west-2b"},
+		{"AvailabilityZone": "us-west-2c"}
+	]
+}`)
+
+func TestProvisionBalancesZones(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace)
+
+	groupRequest := describeGroupRequest(testNamespace, map[string]string{GroupTag: "workers"}, nil)
+	clientMock.EXPECT().DescribeInstances(groupRequest).
+		Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+			{Instances: zonedInstances("us-west-2a", "us-west-2b")},
+		}}, nil)
+
+	clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+		Do(func(input *ec2.RunInstancesInput) {
+			require.Equal(t, "us-west-2c", *input.Placement.AvailabilityZone)
+		}).
+		Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-1")}}})
+
+	_, err := pluginImpl.Provision(instance.Spec{
+		Properties: &balancedJSON,
+		Tags:       map[string]string{GroupTag: "workers", "infrakit.config_sha": "abc"},
+	})
+	require.NoError(t, err)
+}
+
+func TestRebalance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Rebalancer)
+
+	describe := func(instances []*ec2.Instance) *gomock.Call {
+		return clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: instances}}}, nil)
+	}
+
+	// The instances of a recovered zone were replaced in the other zones.
+	unbalanced := zonedInstances("us-west-2a", "us-west-2a", "us-west-2b", "us-west-2b", "us-west-2a")
+	gomock.InOrder(
+		describe(unbalanced),
+		clientMock.EXPECT().DescribeInstanceAttribute(gomock.Any()).
+			Return(&ec2.DescribeInstanceAttributeOutput{
+				UserData: &ec2.AttributeValue{Value: aws.String(base64.StdEncoding.EncodeToString([]byte("init")))},
+			}, nil),
+		describe(unbalanced),
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Do(func(input *ec2.RunInstancesInput) {
+				require.Equal(t, "us-west-2c", *input.Placement.AvailabilityZone)
+			}).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{
+				InstanceId: aws.String("f"),
+				Placement:  &ec2.Placement{AvailabilityZone: aws.String("us-west-2c")},
+			}}}),
+		clientMock.EXPECT().DescribeInstanceStatus(gomock.Any()).
+			Return(&ec2.DescribeInstanceStatusOutput{InstanceStatuses: []*ec2.InstanceStatus{{
+				InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+				SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+			}}}, nil),
+		clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("a")}}).
+			Return(&ec2.TerminateInstancesOutput{
+				TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("a")}}},
+				nil),
+		clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil),
+		describe(zonedInstances("us-west-2c", "us-west-2a", "us-west-2b", "us-west-2b", "us-west-2a")),
+	)
+
+	options := RebalanceOptions{HealthTimeout: time.Minute}
+	require.NoError(t, pluginImpl.Rebalance(map[string]string{GroupTag: "workers"}, balancedJSON, options))
+}
+
+func TestRebalanceDestroysFailedReplacement(t *testing.T) {
+	for _, test := range []struct {
+		zone   string
+		status string
+		err    string
+	}{
+		{zone: "us-west-2a", err: "Replacement f was launched in us-west-2a rather than us-west-2c"},
+		{zone: "us-west-2c", status: ec2.SummaryStatusImpaired, err: "Instance f is impaired"},
+	} {
+		ctrl := gomock.NewController(t)
+
+		clientMock := mock_ec2.NewMockEC2API(ctrl)
+		pluginImpl := NewInstancePlugin(clientMock, testNamespace).(Rebalancer)
+
+		unbalanced := zonedInstances("us-west-2a", "us-west-2a", "us-west-2b", "us-west-2b", "us-west-2a")
+		clientMock.EXPECT().DescribeInstances(gomock.Any()).
+			Return(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: unbalanced}}}, nil).
+			Times(2)
+		clientMock.EXPECT().DescribeInstanceAttribute(gomock.Any()).Return(&ec2.DescribeInstanceAttributeOutput{}, nil)
+		clientMock.EXPECT().RunInstancesRequest(gomock.Any()).
+			Return(fakeRequest(nil), &ec2.Reservation{Instances: []*ec2.Instance{{
+				InstanceId: aws.String("f"),
+				Placement:  &ec2.Placement{AvailabilityZone: aws.String(test.zone)},
+			}}})
+		if test.status != "" {
+			clientMock.EXPECT().DescribeInstanceStatus(gomock.Any()).
+				Return(&ec2.DescribeInstanceStatusOutput{InstanceStatuses: []*ec2.InstanceStatus{{
+					InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(test.status)},
+					SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusOk)},
+				}}}, nil)
+		}
+
+		// The replacement is destroyed, keeping the instance it would have replaced, and the rebalancing stops.
+		clientMock.EXPECT().TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{aws.String("f")}}).
+			Return(&ec2.TerminateInstancesOutput{
+				TerminatingInstances: []*ec2.InstanceStateChange{{InstanceId: aws.String("f")}}},
+				nil)
+		clientMock.EXPECT().DescribeNetworkInterfaces(gomock.Any()).Return(&ec2.DescribeNetworkInterfacesOutput{}, nil)
+
+		options := RebalanceOptions{HealthTimeout: time.Minute}
+		err := pluginImpl.Rebalance(map[string]string{GroupTag: "workers"}, balancedJSON, options)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), test.err)
+
+		ctrl.Finish()
+	}
+}
@@ -0,0 +1,161 @@
+package lock
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+	"time"
+)
+
+const keyAttribute = "LockKey"
+
+// DynamoDBLocker grants leases using conditional writes to a DynamoDB table.  Each key is an item recording the
+// owner, the expiry time, and the fencing token of its lease.
+type DynamoDBLocker struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+	owner  string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewDynamoDBLocker creates a locker that grants leases to owner for the duration of ttl.
+func NewDynamoDBLocker(client dynamodbiface.DynamoDBAPI, table, owner string, ttl time.Duration) *DynamoDBLocker {
+	return &DynamoDBLocker{client: client, table: table, owner: owner, ttl: ttl, now: time.Now}
+}
+
+func keyOf(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{keyAttribute: {S: aws.String(key)}}
+}
+
+func number(n int64) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(n, 10))}
+}
+
+func conditionFailed(err error) bool {
+	awsErr, is := err.(awserr.Error)
+	return is && awsErr.Code() == "ConditionalCheckFailedException"
+}
+
+// Acquire implements Locker.Acquire.  A lease is granted with a new fencing token if the key is unleased or the lease
+// has expired.  An owner does not acquire a lease it already holds, so that each operation has its own token.
+func (d *DynamoDBLocker) Acquire(key string) (*Lease, error) {
+	now := d.now()
+	expires := now.Add(d.ttl)
+
+	output, err := d.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(d.table),
+		Key:       keyOf(key),
+		UpdateExpression: aws.String(
+			"SET LeaseOwner = :owner, Expires = :expires, FencingToken = if_not_exists(FencingToken, :zero) + :one"),
+		ConditionExpression: aws.String("attribute_not_exists(LeaseOwner) OR Expires <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(d.owner)},
+			":now":     number(now.UnixNano()),
+			":expires": number(expires.UnixNano()),
+			":zero":    number(0),
+			":one":     number(1),
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if conditionFailed(err) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attribute := output.Attributes["FencingToken"]
+	if attribute == nil {
+		return nil, errors.New("Lock item has no fencing token")
+	}
+
+	token, err := strconv.ParseInt(aws.StringValue(attribute.N), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Lease{Key: key, Owner: d.owner, Token: token, Expires: time.Unix(0, expires.UnixNano())}, nil
+}
+
+// Renew implements Locker.Renew.  The lease is extended for the duration of ttl, keeping its fencing token.
+func (d *DynamoDBLocker) Renew(lease *Lease) (*Lease, error) {
+	now := d.now()
+	expires := now.Add(d.ttl)
+
+	_, err := d.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(d.table),
+		Key:                 keyOf(lease.Key),
+		UpdateExpression:    aws.String("SET Expires = :expires"),
+		ConditionExpression: aws.String("LeaseOwner = :owner AND FencingToken = :token AND Expires > :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(lease.Owner)},
+			":token":   number(lease.Token),
+			":now":     number(now.UnixNano()),
+			":expires": number(expires.UnixNano()),
+		},
+	})
+	if conditionFailed(err) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	renewed := *lease
+	renewed.Expires = time.Unix(0, expires.UnixNano())
+	return &renewed, nil
+}
+
+// Release implements Locker.Release.  The item is kept with an expired lease, so that the fencing token continues
+// to increase.  Releasing a lease that has since been granted to another owner has no effect.
+func (d *DynamoDBLocker) Release(lease *Lease) error {
+	_, err := d.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(d.table),
+		Key:                 keyOf(lease.Key),
+		UpdateExpression:    aws.String("SET Expires = :zero"),
+		ConditionExpression: aws.String("LeaseOwner = :owner AND FencingToken = :token"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(lease.Owner)},
+			":token": number(lease.Token),
+			":zero":  number(0),
+		},
+	})
+	if conditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// EnsureTable creates the lock table if it does not exist.
+func EnsureTable(client dynamodbiface.DynamoDBAPI, table string) error {
+	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err == nil {
+		return nil
+	}
+	if awsErr, is := err.(awserr.Error); !is || awsErr.Code() != "ResourceNotFoundException" {
+		return err
+	}
+
+	_, err = client.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(keyAttribute), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(keyAttribute), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return client.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+}
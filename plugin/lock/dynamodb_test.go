@@ -0,0 +1,117 @@
+package lock
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type lockItem struct {
+	owner   string
+	expires int64
+	token   int64
+}
+
+// fakeDynamoDB evaluates the conditional updates made by DynamoDBLocker against items held in memory.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]*lockItem
+}
+
+func parseNumber(value *dynamodb.AttributeValue) int64 {
+	n, _ := strconv.ParseInt(*value.N, 10, 64)
+	return n
+}
+
+func (f *fakeDynamoDB) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	key := *input.Key[keyAttribute].S
+	item, exists := f.items[key]
+	values := input.ExpressionAttributeValues
+	failed := awserr.New("ConditionalCheckFailedException", "The conditional request failed", nil)
+
+	switch *input.ConditionExpression {
+	case "LeaseOwner = :owner AND FencingToken = :token AND Expires > :now":
+		if !exists || item.owner != *values[":owner"].S || item.token != parseNumber(values[":token"]) ||
+			item.expires <= parseNumber(values[":now"]) {
+			return nil, failed
+		}
+		item.expires = parseNumber(values[":expires"])
+	case "attribute_not_exists(LeaseOwner) OR Expires <= :now":
+		if !exists {
+			item = &lockItem{}
+			f.items[key] = item
+		} else if item.expires > parseNumber(values[":now"]) {
+			return nil, failed
+		}
+		item.owner = *values[":owner"].S
+		item.expires = parseNumber(values[":expires"])
+		item.token++
+	case "LeaseOwner = :owner AND FencingToken = :token":
+		if !exists || item.owner != *values[":owner"].S || item.token != parseNumber(values[":token"]) {
+			return nil, failed
+		}
+		item.expires = 0
+	}
+
+	return &dynamodb.UpdateItemOutput{Attributes: map[string]*dynamodb.AttributeValue{
+		"FencingToken": number(item.token),
+	}}, nil
+}
+
+func TestDynamoDBLocker(t *testing.T) {
+	client := &fakeDynamoDB{items: map[string]*lockItem{}}
+
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+
+	first := NewDynamoDBLocker(client, "locks", "first", time.Minute)
+	first.now = clock
+	second := NewDynamoDBLocker(client, "locks", "second", time.Minute)
+	second.now = clock
+
+	lease, err := first.Acquire("group/workers")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), lease.Token)
+
+	// The lease may not be acquired again, even by its owner, but may be renewed, keeping the fencing token.
+	_, err = first.Acquire("group/workers")
+	require.Equal(t, ErrLocked, err)
+	now = now.Add(30 * time.Second)
+	renewed, err := first.Renew(lease)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), renewed.Token)
+	require.Equal(t, now.Add(time.Minute).Unix(), renewed.Expires.Unix())
+
+	_, err = second.Acquire("group/workers")
+	require.Equal(t, ErrLocked, err)
+
+	// Other keys are independent.
+	_, err = second.Acquire("group/managers")
+	require.NoError(t, err)
+
+	// An expired lease may be taken by another owner, with a new fencing token.
+	now = now.Add(2 * time.Minute)
+	taken, err := second.Acquire("group/workers")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), taken.Token)
+
+	// A lease that changed hands may not be renewed.
+	_, err = first.Renew(renewed)
+	require.Equal(t, ErrLocked, err)
+
+	// Releasing a lease that changed hands has no effect.
+	require.NoError(t, first.Release(lease))
+	_, err = first.Acquire("group/workers")
+	require.Equal(t, ErrLocked, err)
+
+	require.NoError(t, second.Release(taken))
+	lease, err = first.Acquire("group/workers")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), lease.Token)
+	require.Equal(t, aws.Time(now.Add(time.Minute)).Unix(), lease.Expires.Unix())
+}
@@ -0,0 +1,52 @@
+// Package lock provides leases that prevent multiple processes, such as instance plugins running on each manager,
+// from concurrently mutating the same resource.
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLocked is returned when a lease is held by another owner.
+var ErrLocked = errors.New("Lease is held by another owner")
+
+// Lease is the exclusive right to mutate a resource until it expires.
+type Lease struct {
+	Key   string
+	Owner string
+
+	// Token is a fencing token, which increases each time the lease changes hands.  Operations made with a lease
+	// may be ordered by token to detect those made by an owner whose lease expired.
+	Token int64
+
+	Expires time.Time
+}
+
+func (l Lease) String() string {
+	return fmt.Sprintf("%s (owner %s, fencing token %d)", l.Key, l.Owner, l.Token)
+}
+
+// Locker grants leases.
+type Locker interface {
+	// Acquire takes the lease for a key, returning ErrLocked if it is held, including by the same owner.
+	Acquire(key string) (*Lease, error)
+
+	// Renew extends a lease before it expires, returning ErrLocked if it has expired or changed hands.
+	Renew(lease *Lease) (*Lease, error)
+
+	// Release gives up a lease before it expires.
+	Release(lease *Lease) error
+}
+
+// Wait acquires a lease, retrying while it is held by another owner until the timeout elapses.
+func Wait(locker Locker, key string, timeout time.Duration) (*Lease, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lease, err := locker.Acquire(key)
+		if err != ErrLocked || !time.Now().Before(deadline) {
+			return lease, err
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,118 @@
+// Package migrate upgrades versioned JSON documents, such as specs, from older versions of their schema.
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// VersionField is the field of a document that holds the version of its schema.  Documents without it are version 0.
+const VersionField = "Version"
+
+// Document is a decoded JSON object.
+type Document map[string]interface{}
+
+// Object returns the field of a document that is an object, if it is one.
+func (d Document) Object(key string) (Document, bool) {
+	object, is := d[key].(map[string]interface{})
+	return Document(object), is
+}
+
+// Rename renames a field, failing if the document has both the old and the new field.
+func (d Document) Rename(old, new string) error {
+	value, has := d[old]
+	if !has {
+		return nil
+	}
+	if _, conflict := d[new]; conflict {
+		return fmt.Errorf("%s was renamed to %s, and only one of them may be set", old, new)
+	}
+	d[new] = value
+	delete(d, old)
+	return nil
+}
+
+// Migration upgrades documents from the previous version of a schema.
+type Migration struct {
+	// Version is the version of documents once they are upgraded.
+	Version int
+
+	// Upgrade changes a document of the previous version in place.
+	Upgrade func(document Document) error
+}
+
+// Schema is the sequence of migrations of a kind of document.  The version of the last migration is the current
+// version.
+type Schema struct {
+	// Name describes the documents in errors, such as "cluster spec".
+	Name string
+
+	// Migrations are ordered by version.
+	Migrations []Migration
+}
+
+// Current is the current version of the schema.
+func (s Schema) Current() int {
+	if len(s.Migrations) == 0 {
+		return 0
+	}
+	return s.Migrations[len(s.Migrations)-1].Version
+}
+
+// Version returns the version of a document.
+func (s Schema) Version(document Document) (int, error) {
+	value, has := document[VersionField]
+	if !has || value == nil {
+		return 0, nil
+	}
+
+	number, is := value.(float64)
+	if !is || number != float64(int(number)) || number < 0 {
+		return 0, fmt.Errorf("%s %s must be a whole number, not %v", s.Name, VersionField, value)
+	}
+	version := int(number)
+	if version > s.Current() {
+		return 0, fmt.Errorf(
+			"%s version %d is newer than the latest supported version %d, and requires a newer release",
+			s.Name,
+			version,
+			s.Current())
+	}
+	return version, nil
+}
+
+// UpgradeDocument upgrades a document in place to the current version, recording the version in the document.
+func (s Schema) UpgradeDocument(document Document) error {
+	version, err := s.Version(document)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range s.Migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := migration.Upgrade(document); err != nil {
+			return fmt.Errorf("Failed to upgrade %s to version %d: %s", s.Name, migration.Version, err)
+		}
+	}
+
+	if s.Current() > 0 {
+		document[VersionField] = s.Current()
+	}
+	return nil
+}
+
+// Upgrade upgrades a JSON document to the current version.  Documents that are not JSON objects are returned
+// unchanged, to be rejected when they are decoded.
+func (s Schema) Upgrade(data []byte) ([]byte, error) {
+	document := Document{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return data, nil
+	}
+
+	if err := s.UpgradeDocument(document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
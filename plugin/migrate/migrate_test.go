@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testSchema = Schema{
+	Name: "test spec",
+	Migrations: []Migration{
+		{Version: 1, Upgrade: func(document Document) error { return document.Rename("old_name", "Name") }},
+		{Version: 2, Upgrade: func(document Document) error {
+			if config, is := document.Object("Config"); is {
+				document["Size"] = config["Size"]
+				delete(config, "Size")
+			}
+			return nil
+		}},
+	},
+}
+
+func upgrade(t *testing.T, data string) map[string]interface{} {
+	upgraded, err := testSchema.Upgrade([]byte(data))
+	require.NoError(t, err)
+	document := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(upgraded, &document))
+	return document
+}
+
+func TestUpgrade(t *testing.T) {
+	require.Equal(t, 2, testSchema.Current())
+
+	require.Equal(t,
+		map[string]interface{}{"Version": 2.0, "Name": "a", "Size": 3.0, "Config": map[string]interface{}{}},
+		upgrade(t, `{"old_name": "a", "Config": {"Size": 3}}`))
+
+	// Migrations of earlier versions are not applied again.
+	require.Equal(t,
+		map[string]interface{}{"Version": 2.0, "old_name": "a", "Size": 3.0, "Config": map[string]interface{}{}},
+		upgrade(t, `{"Version": 1, "old_name": "a", "Config": {"Size": 3}}`))
+
+	require.Equal(t,
+		map[string]interface{}{"Version": 2.0, "Config": map[string]interface{}{"Size": 3.0}},
+		upgrade(t, `{"Version": 2, "Config": {"Size": 3}}`))
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	_, err := testSchema.Upgrade([]byte(`{"Version": 3}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "test spec version 3 is newer than the latest supported version 2")
+
+	_, err = testSchema.Upgrade([]byte(`{"Version": "two"}`))
+	require.Error(t, err)
+
+	_, err = testSchema.Upgrade([]byte(`{"old_name": "a", "Name": "b"}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "old_name was renamed to Name")
+
+	// Documents that are not objects are left to be rejected when they are decoded.
+	data, err := testSchema.Upgrade([]byte(`[]`))
+	require.NoError(t, err)
+	require.Equal(t, "[]", string(data))
+}
@@ -0,0 +1,160 @@
+// Package notify publishes the outcomes of instance operations, so that external automation can react to them.
+package notify
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"time"
+)
+
+const (
+	// Provisioned is the type of events of instances that were provisioned.
+	Provisioned = "provisioned"
+
+	// ProvisionFailed is the type of events of provisions that failed.
+	ProvisionFailed = "provision-failed"
+
+	// Destroyed is the type of events of instances that were destroyed.
+	Destroyed = "destroyed"
+
+	// DestroyFailed is the type of events of instances that failed to be destroyed.
+	DestroyFailed = "destroy-failed"
+
+	// ZoneFailed is the type of events of availability zones removed from the placement of instances after sustained
+	// launch or health failures.
+	ZoneFailed = "zone-failed"
+
+	// ZoneRestored is the type of events of failed availability zones restored to the placement of instances.
+	ZoneRestored = "zone-restored"
+)
+
+// Event is the outcome of an instance operation.
+type Event struct {
+	Time time.Time
+	Type string
+
+	// InstanceID is the instance provisioned or destroyed.  Failed provisions may not have an instance.
+	InstanceID string            `json:",omitempty"`
+	Group      string            `json:",omitempty"`
+	LogicalID  string            `json:",omitempty"`
+	Tags       map[string]string `json:",omitempty"`
+
+	// AvailabilityZone is the zone of zone events.
+	AvailabilityZone string `json:",omitempty"`
+
+	// Error is the reason an operation failed.
+	Error string `json:",omitempty"`
+}
+
+// Publisher publishes events.
+type Publisher interface {
+	Publish(event Event) error
+}
+
+// newQueryClient creates a client of an AWS query protocol API, for services that are not vendored.
+func newQueryClient(config client.ConfigProvider, serviceName, apiVersion string) *client.Client {
+	c := config.ClientConfig(serviceName)
+	queryClient := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   serviceName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+		},
+		c.Handlers)
+	queryClient.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	queryClient.Handlers.Build.PushBackNamed(query.BuildHandler)
+	queryClient.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	queryClient.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	queryClient.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return queryClient
+}
+
+func send(queryClient *client.Client, action string, input interface{}) error {
+	operation := &request.Operation{Name: action, HTTPMethod: "POST", HTTPPath: "/"}
+	return queryClient.NewRequest(operation, input, &struct{}{}).Send()
+}
+
+// messageAttribute is a string attribute of an SNS or SQS message.
+type messageAttribute struct {
+	DataType    string
+	StringValue string
+}
+
+// attributes are the attributes of the message of an event, which subscriptions may filter on.
+func attributes(event Event) map[string]messageAttribute {
+	attributes := map[string]messageAttribute{"type": {DataType: "String", StringValue: event.Type}}
+	if event.Group != "" {
+		attributes["group"] = messageAttribute{DataType: "String", StringValue: event.Group}
+	}
+	return attributes
+}
+
+type publishInput struct {
+	TopicArn          string
+	Subject           string
+	Message           string
+	MessageAttributes map[string]messageAttribute `locationNameKey:"Name" locationNameValue:"Value"`
+}
+
+// SNSPublisher publishes events to an SNS topic.  SNS is not vendored, so the client is assembled from the SDK's query
+// protocol handlers.
+type SNSPublisher struct {
+	client   *client.Client
+	topicARN string
+}
+
+// NewSNSPublisher creates a publisher to an SNS topic.
+func NewSNSPublisher(config client.ConfigProvider, topicARN string) *SNSPublisher {
+	return &SNSPublisher{client: newQueryClient(config, "sns", "2010-03-31"), topicARN: topicARN}
+}
+
+// Publish implements Publisher.Publish.
+func (s *SNSPublisher) Publish(event Event) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return send(s.client, "Publish", &publishInput{
+		TopicArn:          s.topicARN,
+		Subject:           "InfraKit instance " + event.Type,
+		Message:           string(message),
+		MessageAttributes: attributes(event),
+	})
+}
+
+type sendMessageInput struct {
+	QueueUrl          string
+	MessageBody       string
+	MessageAttributes map[string]messageAttribute `locationName:"MessageAttribute" locationNameKey:"Name" locationNameValue:"Value" flattened:"true"`
+}
+
+// SQSPublisher sends events to an SQS queue.  SQS is not vendored, so the client is assembled from the SDK's query
+// protocol handlers.
+type SQSPublisher struct {
+	client   *client.Client
+	queueURL string
+}
+
+// NewSQSPublisher creates a publisher to an SQS queue.
+func NewSQSPublisher(config client.ConfigProvider, queueURL string) *SQSPublisher {
+	return &SQSPublisher{client: newQueryClient(config, "sqs", "2012-11-05"), queueURL: queueURL}
+}
+
+// Publish implements Publisher.Publish.
+func (s *SQSPublisher) Publish(event Event) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return send(s.client, "SendMessage", &sendMessageInput{
+		QueueUrl:          s.queueURL,
+		MessageBody:       string(message),
+		MessageAttributes: attributes(event),
+	})
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeService records the parameters of the requests made to a query protocol API.
+func fakeService(t *testing.T, response string) (*httptest.Server, *url.Values) {
+	values := &url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		*values = r.PostForm
+		w.Write([]byte(response))
+	}))
+	return server, values
+}
+
+func testConfig(endpoint string) *session.Session {
+	return session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(endpoint).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+}
+
+var testEvent = Event{
+	Time:       time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+	Type:       ProvisionFailed,
+	InstanceID: "i-1",
+	Group:      "workers",
+	Error:      "InsufficientInstanceCapacity",
+}
+
+func TestSNSPublisher(t *testing.T) {
+	server, values := fakeService(t, `<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`)
+	defer server.Close()
+
+	topic := "arn:aws:sns:us-west-2:123456789012:infrakit"
+	require.NoError(t, NewSNSPublisher(testConfig(server.URL), topic).Publish(testEvent))
+
+	require.Equal(t, "Publish", values.Get("Action"))
+	require.Equal(t, topic, values.Get("TopicArn"))
+	require.Equal(t, "group", values.Get("MessageAttributes.entry.1.Name"))
+	require.Equal(t, "workers", values.Get("MessageAttributes.entry.1.Value.StringValue"))
+	require.Equal(t, "type", values.Get("MessageAttributes.entry.2.Name"))
+	require.Equal(t, ProvisionFailed, values.Get("MessageAttributes.entry.2.Value.StringValue"))
+	require.Equal(t, "String", values.Get("MessageAttributes.entry.2.Value.DataType"))
+
+	event := Event{}
+	require.NoError(t, json.Unmarshal([]byte(values.Get("Message")), &event))
+	require.Equal(t, testEvent, event)
+}
+
+func TestSQSPublisher(t *testing.T) {
+	server, values := fakeService(t, `<SendMessageResponse><SendMessageResult></SendMessageResult></SendMessageResponse>`)
+	defer server.Close()
+
+	queue := "https://sqs.us-west-2.amazonaws.com/123456789012/infrakit"
+	require.NoError(t, NewSQSPublisher(testConfig(server.URL), queue).Publish(testEvent))
+
+	require.Equal(t, "SendMessage", values.Get("Action"))
+	require.Equal(t, queue, values.Get("QueueUrl"))
+	require.Equal(t, "type", values.Get("MessageAttribute.2.Name"))
+	require.Equal(t, ProvisionFailed, values.Get("MessageAttribute.2.Value.StringValue"))
+
+	event := Event{}
+	require.NoError(t, json.Unmarshal([]byte(values.Get("MessageBody")), &event))
+	require.Equal(t, testEvent, event)
+}
+
+func TestPublishError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<ErrorResponse><Error><Code>AuthorizationError</Code><Message>denied</Message></Error></ErrorResponse>`))
+	}))
+	defer server.Close()
+
+	err := NewSNSPublisher(testConfig(server.URL), "arn:aws:sns:us-west-2:123456789012:infrakit").Publish(testEvent)
+	require.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit.aws/plugin/securitygroup"
+	"github.com/docker/infrakit.aws/plugin/yaml"
+	"github.com/docker/infrakit/cli"
+	instance_plugin "github.com/docker/infrakit/rpc/instance"
+	instance_spi "github.com/docker/infrakit/spi/instance"
+	"github.com/spf13/cobra"
+)
+
+// parseTags parses a list of key=value tags.
+func parseTags(tagKVs []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tagKV := range tagKVs {
+		keyAndValue := strings.Split(tagKV, "=")
+		if len(keyAndValue) != 2 {
+			return nil, errors.New("Tags must be formatted as key=value")
+		}
+
+		tags[keyAndValue[0]] = keyAndValue[1]
+	}
+	return tags, nil
+}
+
+// buildPlugin creates the security group plugin with the AWS configuration of the instance plugin flags.
+func buildPlugin(builder *instance.Builder, namespaceTags []string) (instance_spi.Plugin, error) {
+	namespace, err := parseTags(namespaceTags)
+	if err != nil {
+		return nil, errors.New("Namespace tags must be formatted as key=value")
+	}
+	config, err := builder.ConfigProvider()
+	if err != nil {
+		return nil, err
+	}
+	return securitygroup.NewSecurityGroupPlugin(ec2.New(config), namespace), nil
+}
+
+// updateCommand creates a command that replaces the rules of the security groups of a group.
+func updateCommand(builder *instance.Builder, namespaceTags *[]string) *cobra.Command {
+	var group string
+	update := &cobra.Command{
+		Use:   "update <properties file>",
+		Short: "Replace the rules of the security groups of a group with those of its properties",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) != 1 || group == "" {
+				c.Usage()
+				os.Exit(1)
+			}
+
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			properties, err := yaml.ToJSON(data)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			plugin, err := buildPlugin(builder, *namespaceTags)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			err = plugin.(securitygroup.Updater).Update(map[string]string{instance.GroupTag: group}, properties)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+	update.Flags().StringVar(&group, "group", "", "Group whose security groups are updated")
+	return update
+}
+
+func main() {
+
+	builder := &instance.Builder{}
+
+	var logLevel int
+	var name string
+	var namespaceTags []string
+	cmd := &cobra.Command{
+		Use:   os.Args[0],
+		Short: "AWS security group plugin",
+		Run: func(c *cobra.Command, args []string) {
+			plugin, err := buildPlugin(builder, namespaceTags)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			cli.SetLogLevel(logLevel)
+			cli.RunPlugin(name, instance_plugin.PluginServer(plugin))
+		},
+	}
+
+	cmd.Flags().IntVar(&logLevel, "log", cli.DefaultLogLevel, "Logging level. 0 is least verbose. Max is 5")
+	cmd.Flags().StringVar(&name, "name", "securitygroup-aws", "Plugin name to advertise for discovery")
+	cmd.PersistentFlags().StringSliceVar(
+		&namespaceTags,
+		"namespace-tags",
+		[]string{},
+		"A list of key=value resource tags to namespace all resources created")
+	cmd.PersistentFlags().AddFlagSet(builder.Flags())
+
+	cmd.AddCommand(cli.VersionCommand())
+	cmd.AddCommand(updateCommand(builder, &namespaceTags))
+
+	err := cmd.Execute()
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,87 @@
+package securitygroup
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"sort"
+	"strings"
+)
+
+// protocolNames are the names EC2 reports for protocols that may be given by number.
+var protocolNames = map[string]string{"1": "icmp", "6": "tcp", "17": "udp", "58": "icmpv6", "all": "-1"}
+
+func protocol(permission *ec2.IpPermission) string {
+	name := strings.ToLower(aws.StringValue(permission.IpProtocol))
+	if mapped, has := protocolNames[name]; has {
+		return mapped
+	}
+	return name
+}
+
+// ruleKey identifies a rule by its protocol, ports, and source or destination.
+func ruleKey(permission *ec2.IpPermission, peer string) string {
+	if protocol(permission) == "-1" {
+		// EC2 does not report the ports of rules of all protocols.
+		return fmt.Sprintf("-1:%s", peer)
+	}
+	return fmt.Sprintf("%s:%d-%d:%s",
+		protocol(permission), aws.Int64Value(permission.FromPort), aws.Int64Value(permission.ToPort), peer)
+}
+
+// rulePermission is a permission of a single source or destination, as authorized or revoked.
+func rulePermission(permission *ec2.IpPermission) *ec2.IpPermission {
+	rule := &ec2.IpPermission{IpProtocol: aws.String(protocol(permission))}
+	if protocol(permission) != "-1" {
+		rule.FromPort = permission.FromPort
+		rule.ToPort = permission.ToPort
+	}
+	return rule
+}
+
+// flattenRules splits permissions into rules of a single source or destination each, by ruleKey.
+func flattenRules(permissions []*ec2.IpPermission) map[string]*ec2.IpPermission {
+	rules := map[string]*ec2.IpPermission{}
+	for _, permission := range permissions {
+		for _, ipRange := range permission.IpRanges {
+			rule := rulePermission(permission)
+			rule.IpRanges = []*ec2.IpRange{ipRange}
+			rules[ruleKey(permission, "cidr="+aws.StringValue(ipRange.CidrIp))] = rule
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			rule := rulePermission(permission)
+			rule.UserIdGroupPairs = []*ec2.UserIdGroupPair{{GroupId: pair.GroupId}}
+			rules[ruleKey(permission, "group="+aws.StringValue(pair.GroupId))] = rule
+		}
+		for _, prefixList := range permission.PrefixListIds {
+			rule := rulePermission(permission)
+			rule.PrefixListIds = []*ec2.PrefixListId{prefixList}
+			rules[ruleKey(permission, "prefix-list="+aws.StringValue(prefixList.PrefixListId))] = rule
+		}
+	}
+	return rules
+}
+
+// diffRules returns the rules of desired that are missing from actual, and the rules of actual that are not desired,
+// in the order of their keys.
+func diffRules(desired, actual []*ec2.IpPermission) (missing, extra []*ec2.IpPermission) {
+	want := flattenRules(desired)
+	have := flattenRules(actual)
+	return subtractRules(want, have), subtractRules(have, want)
+}
+
+func subtractRules(rules, subtracted map[string]*ec2.IpPermission) []*ec2.IpPermission {
+	keys := []string{}
+	for key := range rules {
+		if _, has := subtracted[key]; !has {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	remaining := []*ec2.IpPermission{}
+	for _, key := range keys {
+		remaining = append(remaining, rules[key])
+	}
+	return remaining
+}
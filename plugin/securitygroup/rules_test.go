@@ -0,0 +1,54 @@
+package securitygroup
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func permission(protocol string, from, to int64, cidrs ...string) *ec2.IpPermission {
+	p := &ec2.IpPermission{IpProtocol: aws.String(protocol), FromPort: aws.Int64(from), ToPort: aws.Int64(to)}
+	for _, cidr := range cidrs {
+		p.IpRanges = append(p.IpRanges, &ec2.IpRange{CidrIp: aws.String(cidr)})
+	}
+	return p
+}
+
+func TestDiffRules(t *testing.T) {
+	desired := []*ec2.IpPermission{
+		permission("6", 22, 22, "10.0.0.0/16", "10.1.0.0/16"),
+		{
+			IpProtocol:       aws.String("tcp"),
+			FromPort:         aws.Int64(2377),
+			ToPort:           aws.Int64(2377),
+			UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-workers")}},
+		},
+	}
+	actual := []*ec2.IpPermission{
+		permission("tcp", 22, 22, "10.0.0.0/16"),
+		permission("tcp", 80, 80, "0.0.0.0/0"),
+	}
+
+	missing, extra := diffRules(desired, actual)
+	require.Equal(t, []*ec2.IpPermission{
+		permission("tcp", 22, 22, "10.1.0.0/16"),
+		{
+			IpProtocol:       aws.String("tcp"),
+			FromPort:         aws.Int64(2377),
+			ToPort:           aws.Int64(2377),
+			UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-workers")}},
+		},
+	}, missing)
+	require.Equal(t, []*ec2.IpPermission{permission("tcp", 80, 80, "0.0.0.0/0")}, extra)
+
+	// Rules of all protocols match regardless of their ports, which EC2 does not report.
+	allTraffic := &ec2.IpPermission{
+		IpProtocol: aws.String("-1"),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+	}
+	missing, extra = diffRules([]*ec2.IpPermission{permission("all", 0, 65535, "0.0.0.0/0")},
+		[]*ec2.IpPermission{allTraffic})
+	require.Empty(t, missing)
+	require.Empty(t, extra)
+}
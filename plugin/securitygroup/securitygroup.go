@@ -0,0 +1,288 @@
+// Package securitygroup is an instance plugin whose instances are EC2 security groups, so that security groups are
+// committed by a group plugin like any other resource of a cluster.  Each security group is named by the logical ID
+// it is provisioned with, by which the instance plugin adds it to the security groups of instances.
+package securitygroup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/docker/infrakit.aws/plugin/awserrors"
+	awsinstance "github.com/docker/infrakit.aws/plugin/instance"
+	"github.com/docker/infrakit.aws/plugin/strict"
+	"github.com/docker/infrakit/spi/instance"
+	"sort"
+)
+
+// defaultDescription is the description of security groups whose properties do not set one.
+const defaultDescription = "Managed by InfraKit"
+
+// CreateSecurityGroupRequest is the properties of a security group.
+type CreateSecurityGroupRequest struct {
+	// VpcID is the VPC of the security group.
+	VpcID string
+
+	// Description is the description of the security group, which may not be changed once it is created.
+	Description string `json:",omitempty"`
+
+	Tags map[string]string `json:",omitempty"`
+
+	// Ingress are the rules of inbound traffic.
+	Ingress []*ec2.IpPermission `json:",omitempty"`
+
+	// Egress are the rules of outbound traffic.  When not set, the rule allowing all outbound traffic that security
+	// groups are created with is kept.
+	Egress []*ec2.IpPermission `json:",omitempty"`
+}
+
+// Updater replaces the rules of existing security groups.
+type Updater interface {
+	// Update replaces the rules of the security groups matching tags with those of properties, authorizing the
+	// missing rules before revoking those no longer allowed.
+	Update(tags map[string]string, properties json.RawMessage) error
+}
+
+type securityGroupPlugin struct {
+	client        ec2iface.EC2API
+	namespaceTags map[string]string
+}
+
+// NewSecurityGroupPlugin creates a new plugin that manages security groups.
+func NewSecurityGroupPlugin(client ec2iface.EC2API, namespaceTags map[string]string) instance.Plugin {
+	return &securityGroupPlugin{client: client, namespaceTags: namespaceTags}
+}
+
+func parseRequest(properties json.RawMessage) (CreateSecurityGroupRequest, error) {
+	request := CreateSecurityGroupRequest{}
+	if err := strict.Unmarshal(properties, &request); err != nil {
+		return request, fmt.Errorf("Invalid input formatting: %s", err)
+	}
+	if request.VpcID == "" {
+		return request, errors.New("VpcID must be set")
+	}
+	return request, nil
+}
+
+// Validate performs local validation on a provision request.
+func (p securityGroupPlugin) Validate(req json.RawMessage) error {
+	_, err := parseRequest(req)
+	return err
+}
+
+// mergeTags merges maps of tags, with the tags of later maps taking precedence.
+func mergeTags(tagMaps ...map[string]string) ([]string, map[string]string) {
+	tags := map[string]string{}
+	for _, tagMap := range tagMaps {
+		for key, value := range tagMap {
+			tags[key] = value
+		}
+	}
+	keys := []string{}
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, tags
+}
+
+func ec2Tags(keys []string, tags map[string]string) []*ec2.Tag {
+	ec2Tags := []*ec2.Tag{}
+	for _, key := range keys {
+		ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return ec2Tags
+}
+
+// describeGroups returns the security groups of the namespace matching tags.
+func (p securityGroupPlugin) describeGroups(tags map[string]string) ([]*ec2.SecurityGroup, error) {
+	keys, allTags := mergeTags(tags, p.namespaceTags)
+	filters := []*ec2.Filter{}
+	for _, key := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("tag:" + key),
+			Values: []*string{aws.String(allTags[key])},
+		})
+	}
+
+	result, err := p.client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{Filters: filters})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up security groups: %s", err)
+	}
+	return result.SecurityGroups, nil
+}
+
+// Provision creates a security group named by the logical ID of the spec.  A security group of the logical ID that
+// already exists, such as one created by a Provision call that timed out, has its rules and tags updated instead.
+func (p securityGroupPlugin) Provision(spec instance.Spec) (*instance.ID, error) {
+	if spec.Properties == nil {
+		return nil, errors.New("Properties must be set")
+	}
+	if spec.LogicalID == nil {
+		return nil, errors.New("Security groups must be provisioned with a logical ID, which names them")
+	}
+	request, err := parseRequest(*spec.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	name := string(*spec.LogicalID)
+	keys, tags := mergeTags(request.Tags, spec.Tags, p.namespaceTags, map[string]string{awsinstance.LogicalIDTag: name})
+
+	existing, err := p.describeGroups(map[string]string{awsinstance.LogicalIDTag: name})
+	if err != nil {
+		return nil, err
+	}
+
+	var group *ec2.SecurityGroup
+	if len(existing) > 0 {
+		group = existing[0]
+		log.Infof("Updating existing security group %s of %s", aws.StringValue(group.GroupId), name)
+	} else {
+		description := request.Description
+		if description == "" {
+			description = defaultDescription
+		}
+		created, err := p.client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+			GroupName:   aws.String(name),
+			Description: aws.String(description),
+			VpcId:       aws.String(request.VpcID),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create security group %s: %s", name, err)
+		}
+
+		described, err := p.client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+			GroupIds: []*string{created.GroupId},
+		})
+		if err != nil || len(described.SecurityGroups) == 0 {
+			return nil, fmt.Errorf("Failed to look up created security group %s: %v", *created.GroupId, err)
+		}
+		group = described.SecurityGroups[0]
+	}
+
+	_, err = p.client.CreateTags(&ec2.CreateTagsInput{Resources: []*string{group.GroupId}, Tags: ec2Tags(keys, tags)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to tag security group %s: %s", *group.GroupId, err)
+	}
+	if err := p.reconcileRules(group, request); err != nil {
+		return nil, err
+	}
+
+	id := instance.ID(*group.GroupId)
+	return &id, nil
+}
+
+// reconcileRules authorizes the rules of a request missing from a security group, then revokes the rules of the group
+// that the request does not allow.
+func (p securityGroupPlugin) reconcileRules(group *ec2.SecurityGroup, request CreateSecurityGroupRequest) error {
+	missing, extra := diffRules(request.Ingress, group.IpPermissions)
+	if len(missing) > 0 {
+		_, err := p.client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: missing,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to authorize ingress of security group %s: %s", *group.GroupId, err)
+		}
+	}
+	if len(extra) > 0 {
+		_, err := p.client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: extra,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to revoke ingress of security group %s: %s", *group.GroupId, err)
+		}
+	}
+
+	if request.Egress == nil {
+		return nil
+	}
+	missing, extra = diffRules(request.Egress, group.IpPermissionsEgress)
+	if len(missing) > 0 {
+		_, err := p.client.AuthorizeSecurityGroupEgress(&ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: missing,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to authorize egress of security group %s: %s", *group.GroupId, err)
+		}
+	}
+	if len(extra) > 0 {
+		_, err := p.client.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: extra,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to revoke egress of security group %s: %s", *group.GroupId, err)
+		}
+	}
+	return nil
+}
+
+// Update implements Updater.Update.
+func (p securityGroupPlugin) Update(tags map[string]string, properties json.RawMessage) error {
+	request, err := parseRequest(properties)
+	if err != nil {
+		return err
+	}
+
+	groups, err := p.describeGroups(tags)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := p.reconcileRules(group, request); err != nil {
+			return err
+		}
+		log.Infof("Updated the rules of security group %s", *group.GroupId)
+	}
+	return nil
+}
+
+// Destroy deletes a security group.  Security groups of instances or network interfaces may not be deleted until the
+// instances are destroyed.
+func (p securityGroupPlugin) Destroy(id instance.ID) error {
+	_, err := p.client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String(string(id))})
+	switch awserrors.Code(err) {
+	case "":
+		return nil
+	case "InvalidGroup.NotFound":
+		return nil
+	case "DependencyViolation":
+		return fmt.Errorf("Security group %s is still used by instances or network interfaces: %s", id, err)
+	}
+	return fmt.Errorf("Failed to delete security group %s: %s", id, err)
+}
+
+// DescribeInstances returns descriptions of the security groups matching all of the provided tags.
+func (p securityGroupPlugin) DescribeInstances(tags map[string]string) ([]instance.Description, error) {
+	groups, err := p.describeGroups(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := []instance.Description{}
+	for _, group := range groups {
+		groupTags := map[string]string{}
+		for _, tag := range group.Tags {
+			groupTags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+
+		var logicalID *instance.LogicalID
+		if name, has := groupTags[awsinstance.LogicalIDTag]; has {
+			id := instance.LogicalID(name)
+			logicalID = &id
+		}
+		descriptions = append(descriptions, instance.Description{
+			ID:        instance.ID(*group.GroupId),
+			LogicalID: logicalID,
+			Tags:      groupTags,
+		})
+	}
+	return descriptions, nil
+}
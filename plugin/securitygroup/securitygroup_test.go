@@ -0,0 +1,190 @@
+package securitygroup
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit.aws/mock/ec2"
+	"github.com/docker/infrakit/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testNamespace = map[string]string{"cluster": "test"}
+
+func groupSpec(t *testing.T, name string, request CreateSecurityGroupRequest) instance.Spec {
+	properties, err := json.Marshal(request)
+	require.NoError(t, err)
+	raw := json.RawMessage(properties)
+	logicalID := instance.LogicalID(name)
+	return instance.Spec{
+		Properties: &raw,
+		Tags:       map[string]string{"infrakit.group": "security"},
+		LogicalID:  &logicalID,
+	}
+}
+
+func namedFilters(name string) []*ec2.Filter {
+	return []*ec2.Filter{
+		{Name: aws.String("tag:cluster"), Values: []*string{aws.String("test")}},
+		{Name: aws.String("tag:infrakit.logical-id"), Values: []*string{aws.String(name)}},
+	}
+}
+
+func TestProvisionCreatesSecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	plugin := NewSecurityGroupPlugin(clientMock, testNamespace)
+
+	request := CreateSecurityGroupRequest{
+		VpcID:   "vpc-1",
+		Ingress: []*ec2.IpPermission{permission("tcp", 22, 22, "10.0.0.0/16")},
+	}
+
+	clientMock.EXPECT().DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{Filters: namedFilters("managers")}).
+		Return(&ec2.DescribeSecurityGroupsOutput{}, nil)
+	clientMock.EXPECT().CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String("managers"),
+		Description: aws.String(defaultDescription),
+		VpcId:       aws.String("vpc-1"),
+	}).Return(&ec2.CreateSecurityGroupOutput{GroupId: aws.String("sg-1")}, nil)
+	clientMock.EXPECT().DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: []*string{aws.String("sg-1")}}).
+		Return(&ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{{
+			GroupId:             aws.String("sg-1"),
+			IpPermissionsEgress: []*ec2.IpPermission{permission("-1", 0, 0, "0.0.0.0/0")},
+		}}}, nil)
+	clientMock.EXPECT().CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String("sg-1")},
+		Tags: []*ec2.Tag{
+			{Key: aws.String("cluster"), Value: aws.String("test")},
+			{Key: aws.String("infrakit.group"), Value: aws.String("security")},
+			{Key: aws.String("infrakit.logical-id"), Value: aws.String("managers")},
+		},
+	}).Return(&ec2.CreateTagsOutput{}, nil)
+	clientMock.EXPECT().AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String("sg-1"),
+		IpPermissions: []*ec2.IpPermission{permission("tcp", 22, 22, "10.0.0.0/16")},
+	}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil)
+
+	id, err := plugin.Provision(groupSpec(t, "managers", request))
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("sg-1"), *id)
+}
+
+func TestProvisionUpdatesExistingSecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	plugin := NewSecurityGroupPlugin(clientMock, testNamespace)
+
+	request := CreateSecurityGroupRequest{
+		VpcID:   "vpc-1",
+		Ingress: []*ec2.IpPermission{permission("tcp", 443, 443, "0.0.0.0/0")},
+		Egress:  []*ec2.IpPermission{permission("tcp", 443, 443, "0.0.0.0/0")},
+	}
+
+	clientMock.EXPECT().DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{Filters: namedFilters("edge")}).
+		Return(&ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{{
+			GroupId:             aws.String("sg-2"),
+			IpPermissions:       []*ec2.IpPermission{permission("tcp", 80, 80, "0.0.0.0/0")},
+			IpPermissionsEgress: []*ec2.IpPermission{permission("-1", 0, 0, "0.0.0.0/0")},
+		}}}, nil)
+	clientMock.EXPECT().CreateTags(gomock.Any()).Return(&ec2.CreateTagsOutput{}, nil)
+
+	// Missing rules are authorized before extra rules are revoked.
+	gomock.InOrder(
+		clientMock.EXPECT().AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String("sg-2"),
+			IpPermissions: []*ec2.IpPermission{permission("tcp", 443, 443, "0.0.0.0/0")},
+		}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil),
+		clientMock.EXPECT().RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       aws.String("sg-2"),
+			IpPermissions: []*ec2.IpPermission{permission("tcp", 80, 80, "0.0.0.0/0")},
+		}).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil),
+		clientMock.EXPECT().AuthorizeSecurityGroupEgress(&ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       aws.String("sg-2"),
+			IpPermissions: []*ec2.IpPermission{permission("tcp", 443, 443, "0.0.0.0/0")},
+		}).Return(&ec2.AuthorizeSecurityGroupEgressOutput{}, nil),
+		clientMock.EXPECT().RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+			GroupId: aws.String("sg-2"),
+			IpPermissions: []*ec2.IpPermission{{
+				IpProtocol: aws.String("-1"),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			}},
+		}).Return(&ec2.RevokeSecurityGroupEgressOutput{}, nil),
+	)
+
+	id, err := plugin.Provision(groupSpec(t, "edge", request))
+	require.NoError(t, err)
+	require.Equal(t, instance.ID("sg-2"), *id)
+}
+
+func TestProvisionRequiresLogicalID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	plugin := NewSecurityGroupPlugin(mock_ec2.NewMockEC2API(ctrl), testNamespace)
+	spec := groupSpec(t, "managers", CreateSecurityGroupRequest{VpcID: "vpc-1"})
+	spec.LogicalID = nil
+	_, err := plugin.Provision(spec)
+	require.Error(t, err)
+
+	require.Error(t, plugin.Validate(json.RawMessage(`{}`)))
+	require.Error(t, plugin.Validate(json.RawMessage(`{"VpcID": "vpc-1", "Rules": []}`)))
+	require.NoError(t, plugin.Validate(json.RawMessage(`{"VpcID": "vpc-1"}`)))
+}
+
+func TestDestroySecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	plugin := NewSecurityGroupPlugin(clientMock, testNamespace)
+
+	clientMock.EXPECT().DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String("sg-1")}).
+		Return(&ec2.DeleteSecurityGroupOutput{}, nil)
+	require.NoError(t, plugin.Destroy(instance.ID("sg-1")))
+
+	clientMock.EXPECT().DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String("sg-2")}).
+		Return(nil, awserr.New("InvalidGroup.NotFound", "not found", nil))
+	require.NoError(t, plugin.Destroy(instance.ID("sg-2")))
+
+	clientMock.EXPECT().DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String("sg-3")}).
+		Return(nil, awserr.New("DependencyViolation", "in use", nil))
+	err := plugin.Destroy(instance.ID("sg-3"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "still used")
+}
+
+func TestDescribeSecurityGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientMock := mock_ec2.NewMockEC2API(ctrl)
+	plugin := NewSecurityGroupPlugin(clientMock, testNamespace)
+
+	clientMock.EXPECT().DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{Filters: []*ec2.Filter{
+		{Name: aws.String("tag:cluster"), Values: []*string{aws.String("test")}},
+		{Name: aws.String("tag:infrakit.group"), Values: []*string{aws.String("security")}},
+	}}).Return(&ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{{
+		GroupId: aws.String("sg-1"),
+		Tags: []*ec2.Tag{
+			{Key: aws.String("infrakit.group"), Value: aws.String("security")},
+			{Key: aws.String("infrakit.logical-id"), Value: aws.String("managers")},
+		},
+	}}}, nil)
+
+	descriptions, err := plugin.DescribeInstances(map[string]string{"infrakit.group": "security"})
+	require.NoError(t, err)
+	logicalID := instance.LogicalID("managers")
+	require.Equal(t, []instance.Description{{
+		ID:        instance.ID("sg-1"),
+		LogicalID: &logicalID,
+		Tags:      map[string]string{"infrakit.group": "security", "infrakit.logical-id": "managers"},
+	}}, descriptions)
+}
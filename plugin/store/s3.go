@@ -0,0 +1,146 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"sort"
+	"time"
+)
+
+// S3Snapshot is a Snapshot stored as an object in an S3 bucket.  Objects are encrypted with a KMS key if one is
+// configured, and with S3-managed keys otherwise.
+type S3Snapshot struct {
+	client   s3iface.S3API
+	bucket   string
+	key      string
+	kmsKeyID string
+}
+
+// NewS3Snapshot creates a snapshot stored in an S3 object.  kmsKeyID is optional.
+func NewS3Snapshot(client s3iface.S3API, bucket, key, kmsKeyID string) *S3Snapshot {
+	return &S3Snapshot{client: client, bucket: bucket, key: key, kmsKeyID: kmsKeyID}
+}
+
+// Save implements Snapshot.Save.
+func (s *S3Snapshot) Save(obj interface{}) error {
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	input := s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(s.key),
+		Body:                 bytes.NewReader(data),
+		ContentType:          aws.String("application/json"),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	}
+	if s.kmsKeyID != "" {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	}
+
+	_, err = s.client.PutObject(&input)
+	return err
+}
+
+// Load implements Snapshot.Load.
+func (s *S3Snapshot) Load(output interface{}) error {
+	return s.LoadVersion("", output)
+}
+
+// LoadVersion loads a previous version of the snapshot, as listed by Versions.  The latest version is loaded if
+// versionID is empty.
+func (s *S3Snapshot) LoadVersion(versionID string, output interface{}) error {
+	input := s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.key)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
+	object, err := s.client.GetObject(&input)
+	if err != nil {
+		if awsErr, is := err.(awserr.Error); is && awsErr.Code() == "NoSuchKey" {
+			return nil
+		}
+		return err
+	}
+	defer object.Body.Close()
+
+	return json.NewDecoder(object.Body).Decode(output)
+}
+
+// Version is a saved version of a snapshot.
+type Version struct {
+	ID       string
+	Modified time.Time
+}
+
+// Versions lists the saved versions of the snapshot, newest first.  Versions are retained when the bucket has
+// versioning enabled.
+func (s *S3Snapshot) Versions() ([]Version, error) {
+	versions := []Version{}
+	err := s.client.ListObjectVersionsPages(
+		&s3.ListObjectVersionsInput{Bucket: aws.String(s.bucket), Prefix: aws.String(s.key)},
+		func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+			for _, version := range page.Versions {
+				if aws.StringValue(version.Key) == s.key {
+					versions = append(versions, Version{
+						ID:       aws.StringValue(version.VersionId),
+						Modified: aws.TimeValue(version.LastModified),
+					})
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(newestFirst(versions))
+	return versions, nil
+}
+
+type newestFirst []Version
+
+func (v newestFirst) Len() int {
+	return len(v)
+}
+
+func (v newestFirst) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
+
+func (v newestFirst) Less(i, j int) bool {
+	return v[i].Modified.After(v[j].Modified)
+}
+
+// EnsureBucket creates a bucket if it does not exist, and enables versioning so that previous snapshots may be
+// recovered.
+func EnsureBucket(client s3iface.S3API, bucket, region string) error {
+	_, err := client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		if awsErr, is := err.(awserr.RequestFailure); !is || awsErr.StatusCode() != 404 {
+			return err
+		}
+
+		input := s3.CreateBucketInput{Bucket: aws.String(bucket)}
+		// Buckets are created in us-east-1 unless another region is specified.
+		if region != "us-east-1" {
+			input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+		}
+		_, err = client.CreateBucket(&input)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(s3.BucketVersioningStatusEnabled)},
+	})
+	return err
+}
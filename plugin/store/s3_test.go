@@ -0,0 +1,82 @@
+package store
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeS3 serves objects from memory, recording the encryption headers of stored objects.
+type fakeS3 struct {
+	objects    map[string][]byte
+	encryption map[string]string
+	kmsKeys    map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+		f.encryption[r.URL.Path] = r.Header.Get("x-amz-server-side-encryption")
+		f.kmsKeys[r.URL.Path] = r.Header.Get("x-amz-server-side-encryption-aws-kms-key-id")
+	case "GET":
+		body, exists := f.objects[r.URL.Path]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Write(body)
+	}
+}
+
+func testClient(t *testing.T, url string) *s3.S3 {
+	return s3.New(session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(url).
+		WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+		WithMaxRetries(0)))
+}
+
+type state struct {
+	Groups []string
+}
+
+func TestS3Snapshot(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, encryption: map[string]string{}, kmsKeys: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	snapshot := NewS3Snapshot(testClient(t, server.URL), "bucket", "cluster/state.json", "")
+
+	// Loading a snapshot that was never saved leaves the output unchanged.
+	loaded := state{Groups: []string{"default"}}
+	require.NoError(t, snapshot.Load(&loaded))
+	require.Equal(t, []string{"default"}, loaded.Groups)
+
+	require.NoError(t, snapshot.Save(state{Groups: []string{"managers", "workers"}}))
+	require.Equal(t, s3.ServerSideEncryptionAes256, fake.encryption["/bucket/cluster/state.json"])
+
+	loaded = state{}
+	require.NoError(t, snapshot.Load(&loaded))
+	require.Equal(t, []string{"managers", "workers"}, loaded.Groups)
+}
+
+func TestS3SnapshotKMS(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, encryption: map[string]string{}, kmsKeys: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	snapshot := NewS3Snapshot(testClient(t, server.URL), "bucket", "state.json", "alias/infrakit")
+	require.NoError(t, snapshot.Save(state{}))
+	require.Equal(t, s3.ServerSideEncryptionAwsKms, fake.encryption["/bucket/state.json"])
+	require.Equal(t, "alias/infrakit", fake.kmsKeys["/bucket/state.json"])
+}
@@ -0,0 +1,13 @@
+// Package store persists state, such as committed group specs, outside of the instances that use it.  This allows
+// re-provisioned managers to recover the desired state of the cluster.
+package store
+
+// Snapshot saves and loads a single document.
+type Snapshot interface {
+	// Save replaces the document with the JSON encoding of obj.
+	Save(obj interface{}) error
+
+	// Load decodes the document into output.  If the document does not exist, output is left unchanged and no
+	// error is returned.
+	Load(output interface{}) error
+}
@@ -0,0 +1,222 @@
+// Package strict detects fields of JSON documents that are not decoded, such as misspelled field names, which
+// encoding/json silently ignores.
+package strict
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal decodes a JSON document like json.Unmarshal, failing if the document has fields that the value does not
+// decode.  The error lists every unknown field, suggesting the known field it most resembles.
+func Unmarshal(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	return Check(document, reflect.TypeOf(v))
+}
+
+// Check checks a decoded JSON document against the type it is decoded into.
+func Check(document interface{}, t reflect.Type) error {
+	unknown := []string{}
+	check(document, t, "", &unknown)
+	if len(unknown) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(unknown, "\n"))
+}
+
+// jsonFields maps the names of the JSON fields decoded into a struct type to the field types, including the fields of
+// embedded structs.
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				jsonFields(fieldType, fields)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// Unexported fields are not decoded.
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+}
+
+func opaque(t reflect.Type) bool {
+	return t.Implements(unmarshalerType) ||
+		reflect.PtrTo(t).Implements(unmarshalerType) ||
+		t.Implements(textUnmarshalerType) ||
+		reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func check(document interface{}, t reflect.Type, path string, unknown *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if opaque(t) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, is := document.(map[string]interface{})
+		if !is {
+			return
+		}
+		fields := map[string]reflect.Type{}
+		jsonFields(t, fields)
+
+		keys := []string{}
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			name, found := match(key, fields)
+			if !found {
+				message := fmt.Sprintf("Unknown field %s", join(path, key))
+				if suggestion := suggest(key, fields); suggestion != "" {
+					message = fmt.Sprintf("%s, did you mean %s?", message, suggestion)
+				}
+				*unknown = append(*unknown, message)
+				continue
+			}
+			check(object[key], fields[name], join(path, key), unknown)
+		}
+
+	case reflect.Map:
+		object, is := document.(map[string]interface{})
+		if !is {
+			return
+		}
+		keys := []string{}
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			check(object[key], t.Elem(), join(path, key), unknown)
+		}
+
+	case reflect.Slice, reflect.Array:
+		list, is := document.([]interface{})
+		if !is {
+			return
+		}
+		for i, item := range list {
+			check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), unknown)
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// match finds the field a key is decoded into.  Like encoding/json, an exact match is preferred over a match that
+// ignores case.
+func match(key string, fields map[string]reflect.Type) (string, bool) {
+	if _, has := fields[key]; has {
+		return key, true
+	}
+	for name := range fields {
+		if strings.EqualFold(name, key) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.Replace(strings.Replace(name, "_", "", -1), "-", "", -1))
+}
+
+// suggest returns the field whose name is nearest to an unknown key, ignoring case, underscores, and hyphens, if any
+// is near enough to be a likely misspelling.
+func suggest(key string, fields map[string]reflect.Type) string {
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best := ""
+	bestDistance := 0
+	for _, name := range names {
+		distance := editDistance(normalize(key), normalize(name))
+		if best == "" || distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+
+	limit := len(key) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	if best == "" || bestDistance > limit {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
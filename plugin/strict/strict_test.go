@@ -0,0 +1,71 @@
+package strict
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type embedded struct {
+	Embedded string
+}
+
+type testConfig struct {
+	RunInstancesInput ec2.RunInstancesInput
+	SubnetID          string `json:"SubnetId,omitempty"`
+	Tags              map[string]string
+	Options           []struct{ Name string }
+	Raw               json.RawMessage
+	Any               interface{}
+	Time              time.Time
+	Ignored           string `json:"-"`
+	hidden            string
+	embedded
+}
+
+func TestUnmarshal(t *testing.T) {
+	config := testConfig{}
+	require.NoError(t, Unmarshal([]byte(`{
+		"RunInstancesInput": {"ImageId": "ami-1", "placement": {"AvailabilityZone": "us-west-2a"}},
+		"SubnetId": "subnet-1",
+		"Tags": {"any": "tag"},
+		"Options": [{"Name": "a"}],
+		"Raw": {"any": "field"},
+		"Any": {"any": "field"},
+		"Time": "2017-01-02T03:04:05Z",
+		"Embedded": "value"
+	}`), &config))
+	require.Equal(t, "ami-1", *config.RunInstancesInput.ImageId)
+	require.Equal(t, "value", config.Embedded)
+}
+
+func TestUnknownFields(t *testing.T) {
+	config := testConfig{}
+	err := Unmarshal([]byte(`{
+		"run_instance_nput": {},
+		"RunInstancesInput": {"ImageId": "ami-1", "InstanceTyp": "t2.micro"},
+		"SubnetID": "subnet-1",
+		"Options": [{"Name": "a"}, {"Nmae": "b"}],
+		"Ignored": "value",
+		"hidden": "value",
+		"Unrelated": true
+	}`), &config)
+	require.Error(t, err)
+	require.Equal(t,
+		"Unknown field Ignored\n"+
+			"Unknown field Options[1].Nmae, did you mean Name?\n"+
+			"Unknown field RunInstancesInput.InstanceTyp, did you mean InstanceType?\n"+
+			"Unknown field Unrelated\n"+
+			"Unknown field hidden\n"+
+			"Unknown field run_instance_nput, did you mean RunInstancesInput?",
+		err.Error())
+}
+
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("abc", "abc"))
+	require.Equal(t, 3, editDistance("", "abc"))
+	require.Equal(t, 1, editDistance("kiten", "kitten"))
+	require.Equal(t, 3, editDistance("kitten", "sitting"))
+}
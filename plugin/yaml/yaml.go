@@ -0,0 +1,200 @@
+// Package yaml converts YAML documents to JSON, so that specs may be written in YAML and decoded as JSON.
+//
+// Documents are parsed with gopkg.in/yaml.v3.  Plain scalars are converted to JSON numbers, booleans, and nulls as
+// they resolve in YAML, except that integers written with leading zeros, such as file modes like 0644, are kept as
+// strings, since the fields they are written for are strings.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"math"
+	"regexp"
+)
+
+// leadingZeros matches the numbers written with leading zeros, which are kept as strings.
+var leadingZeros = regexp.MustCompile(`^[-+]?0[0-9]`)
+
+// IsJSON determines whether a document is JSON rather than YAML, by its first character.
+func IsJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// ToJSON converts a single YAML document to JSON.  JSON documents are returned unchanged.
+func ToJSON(data []byte) ([]byte, error) {
+	if IsJSON(data) {
+		return data, nil
+	}
+
+	documents, err := Documents(data)
+	if err != nil {
+		return nil, err
+	}
+	switch len(documents) {
+	case 0:
+		return []byte("null"), nil
+	case 1:
+		return documents[0], nil
+	default:
+		return nil, fmt.Errorf("Expected a single YAML document, found %d", len(documents))
+	}
+}
+
+// Documents converts each document of a YAML stream, separated by --- lines, to JSON.  Empty documents are omitted.
+func Documents(data []byte) ([][]byte, error) {
+	documents := [][]byte{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		node := yaml.Node{}
+		err := decoder.Decode(&node)
+		if err == io.EOF {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := convert(&node)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+
+		document, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+}
+
+// convert converts a YAML node to the value encoded as its JSON.
+func convert(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return convert(node.Content[0])
+	case yaml.AliasNode:
+		return convert(node.Alias)
+	case yaml.MappingNode:
+		return convertMapping(node)
+	case yaml.SequenceNode:
+		sequence := []interface{}{}
+		for _, item := range node.Content {
+			value, err := convert(item)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+		}
+		return sequence, nil
+	case yaml.ScalarNode:
+		return convertScalar(node)
+	}
+	return nil, fmt.Errorf("YAML line %d: unexpected node", node.Line)
+}
+
+// convertMapping converts a mapping to a JSON object.  The keys of merged mappings, written as << keys, are
+// overridden by the keys of the mapping.
+func convertMapping(node *yaml.Node) (interface{}, error) {
+	mapping := map[string]interface{}{}
+	merged := map[string]interface{}{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		if key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge" {
+			if err := merge(merged, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("YAML line %d: keys must be scalars", key.Line)
+		}
+		if _, has := mapping[key.Value]; has {
+			return nil, fmt.Errorf("YAML line %d: duplicate key %s", key.Line, key.Value)
+		}
+
+		converted, err := convert(value)
+		if err != nil {
+			return nil, err
+		}
+		mapping[key.Value] = converted
+	}
+
+	for key, value := range merged {
+		if _, has := mapping[key]; !has {
+			mapping[key] = value
+		}
+	}
+	return mapping, nil
+}
+
+// merge adds the keys of a merged mapping, or a sequence of them in order of precedence, that are not already set.
+func merge(merged map[string]interface{}, node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	sources := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		sources = node.Content
+	}
+	for _, source := range sources {
+		value, err := convert(source)
+		if err != nil {
+			return err
+		}
+		mapping, is := value.(map[string]interface{})
+		if !is {
+			return fmt.Errorf("YAML line %d: only mappings may be merged", source.Line)
+		}
+		for key, value := range mapping {
+			if _, has := merged[key]; !has {
+				merged[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// convertScalar converts a scalar to a JSON string, number, boolean, or null.
+func convertScalar(node *yaml.Node) (interface{}, error) {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var value bool
+		err := node.Decode(&value)
+		return value, err
+	case "!!int":
+		if leadingZeros.MatchString(node.Value) {
+			return node.Value, nil
+		}
+		var value interface{}
+		err := node.Decode(&value)
+		return value, err
+	case "!!float":
+		var value float64
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		// JSON has no infinities or NaN, and floats with leading zeros are kept as written, like integers.
+		if leadingZeros.MatchString(node.Value) || math.IsInf(value, 0) || math.IsNaN(value) {
+			return node.Value, nil
+		}
+		return value, nil
+	}
+	return node.Value, nil
+}
@@ -0,0 +1,172 @@
+package yaml
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func decode(t *testing.T, data string) interface{} {
+	converted, err := ToJSON([]byte(data))
+	require.NoError(t, err)
+	var value interface{}
+	require.NoError(t, json.Unmarshal(converted, &value))
+	return value
+}
+
+func TestToJSON(t *testing.T) {
+	require.Equal(t,
+		map[string]interface{}{
+			"ClusterName": "test",
+			"Version":     1.0,
+			"Enabled":     true,
+			"Nothing":     nil,
+			"Ratio":       0.5,
+			"Mode":        420.0,
+			"Permissions": "0644",
+			"Zip":         "-00501",
+			"Answer":      "yes",
+			"Version2":    "1.10.0",
+			"Quoted":      "a: 'b' # not a comment",
+			"Single":      "it's",
+			"Url":         "http://example.com/#anchor",
+			"Tags":        map[string]interface{}{"team": "platform", "env": "prod"},
+			"Ports":       []interface{}{2377.0, "7946"},
+			"Groups": []interface{}{
+				map[string]interface{}{
+					"Name": "Managers",
+					"Size": 3.0,
+					"Config": map[string]interface{}{
+						"RunInstancesInput": map[string]interface{}{"ImageId": "ami-1"},
+					},
+				},
+				map[string]interface{}{"Name": "Workers", "Subnets": []interface{}{"a", "b"}},
+			},
+			"Nested": []interface{}{[]interface{}{"a", "b"}, "c"},
+		},
+		decode(t, `
+# A cluster spec.
+ClusterName: test   # the name
+Version: 1
+Enabled: true
+Nothing:
+Ratio: .5
+Mode: 0o644
+Permissions: 0644
+Zip: -00501
+Answer: yes
+Version2: 1.10.0
+Quoted: "a: 'b' # not a comment"
+Single: 'it''s'
+Url: http://example.com/#anchor
+Tags: {team: platform, env: "prod"}
+Ports: [2377, "7946"]
+Groups:
+- Name: Managers
+  Size: 3
+  Config:
+    RunInstancesInput:
+      ImageId: ami-1
+- Name: Workers
+  Subnets:
+    - a
+    - b
+Nested:
+  - - a
+    - b
+  - c
+`))
+}
+
+func TestBlockScalars(t *testing.T) {
+	require.Equal(t,
+		map[string]interface{}{
+			"Literal": "#!/bin/sh\necho \"hello\" # kept\n\n  indented\n",
+			"Strip":   "line",
+			"Keep":    "line\n\n",
+			"Folded":  "folded text\ncontinues\n",
+			"After":   "value",
+		},
+		decode(t, `
+Literal: |
+  #!/bin/sh
+  echo "hello" # kept
+
+    indented
+Strip: |-
+  line
+Keep: |+
+  line
+
+Folded: >
+  folded
+  text
+
+  continues
+After: value
+`))
+}
+
+func TestAnchors(t *testing.T) {
+	require.Equal(t,
+		map[string]interface{}{
+			"Defaults": map[string]interface{}{"Size": 3.0, "Zone": "a"},
+			"Managers": map[string]interface{}{"Size": 3.0, "Zone": "b"},
+			"Subnets":  []interface{}{"a", "b"},
+			"Again":    []interface{}{"a", "b"},
+		},
+		decode(t, `
+Defaults: &defaults
+  Size: 3
+  Zone: a
+Managers:
+  <<: *defaults
+  Zone: b
+Subnets: &subnets [a, b]
+Again: *subnets
+`))
+}
+
+func TestDocuments(t *testing.T) {
+	documents, err := Documents([]byte(`
+%YAML 1.1
+---
+ClusterName: test
+---
+# An empty document is omitted.
+---
+Name: Workers
+...
+`))
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+	require.JSONEq(t, `{"ClusterName": "test"}`, string(documents[0]))
+	require.JSONEq(t, `{"Name": "Workers"}`, string(documents[1]))
+
+	_, err = ToJSON([]byte("a: 1\n---\nb: 2\n"))
+	require.Error(t, err)
+}
+
+func TestJSONUnchanged(t *testing.T) {
+	converted, err := ToJSON([]byte(`  {"a": 1}`))
+	require.NoError(t, err)
+	require.Equal(t, `  {"a": 1}`, string(converted))
+}
+
+func TestErrors(t *testing.T) {
+	for _, data := range []string{
+		"a: 1\na: 2\n",
+		"a: 1\n   b: 2\n",
+		"a: *missing\n",
+		"? [a]\n: b\n",
+		"a: [1, 2\n",
+		"a: \"unterminated\n",
+		"a:\n\t- b\n",
+	} {
+		_, err := ToJSON([]byte(data))
+		require.Error(t, err, data)
+	}
+
+	_, err := ToJSON([]byte("a: 1\na: 2\n"))
+	require.Contains(t, err.Error(), "YAML line 2: duplicate key a")
+}